@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +13,8 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"incident-simulation/pkg/slogx"
 )
 
 type TransactionRequest struct {
@@ -28,11 +31,20 @@ type TransactionResponse struct {
 	Error         string      `json:"error,omitempty"`
 }
 
-
-
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	envErr := godotenv.Load()
+
+	// Export slog records over OTLP when OTEL_LOGS_EXPORTER=otlp
+	logger, shutdownLogs, err := slogx.New(context.Background(), "core-api-service")
+	if err != nil {
+		slog.Error("Failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownLogs(context.Background())
+	slog.SetDefault(logger)
+
+	if envErr != nil {
 		slog.Info("No .env file found, using defaults")
 	}
 
@@ -46,8 +58,6 @@ func main() {
 	startCoreService(dbServiceURL)
 }
 
-
-
 func startCoreService(dbServiceURL string) {
 	mux := http.NewServeMux()
 
@@ -143,6 +153,9 @@ func startCoreService(dbServiceURL string) {
 		json.NewEncoder(w).Encode(dbResp)
 	})
 
+	// Changes LOG_LEVEL at runtime
+	mux.Handle("/debug/loglevel", slogx.LevelHandler())
+
 	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
 		// Check database service health
 		resp, err := client.Get(dbServiceURL + "/db/health")
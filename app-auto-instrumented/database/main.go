@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"math/rand"
 	"net/http"
+	"os"
 	"sync/atomic"
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"incident-simulation/pkg/slogx"
 )
 
 // Global incident state
@@ -31,11 +35,20 @@ type DatabaseResponse struct {
 	Timestamp int64       `json:"timestamp"`
 }
 
-
-
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	envErr := godotenv.Load()
+
+	// Export slog records over OTLP when OTEL_LOGS_EXPORTER=otlp
+	logger, shutdownLogs, err := slogx.New(context.Background(), "database-service")
+	if err != nil {
+		slog.Error("Failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownLogs(context.Background())
+	slog.SetDefault(logger)
+
+	if envErr != nil {
 		slog.Info("No .env file found, using defaults")
 	}
 
@@ -46,8 +59,6 @@ func main() {
 	startDatabaseService()
 }
 
-
-
 func incidentSimulator() {
 	ticker := time.NewTicker(45 * time.Second)
 	defer ticker.Stop()
@@ -221,6 +232,9 @@ func startDatabaseService() {
 		})
 	})
 
+	// Changes LOG_LEVEL at runtime
+	mux.Handle("/debug/loglevel", slogx.LevelHandler())
+
 	slog.Info("🗄️  Database Service running on :8081")
 	if err := http.ListenAndServe(":8081", mux); err != nil {
 		slog.Error("Server failed", "error", err)
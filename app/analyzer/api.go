@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+
+	"analyzer-service/canary"
+	"analyzer-service/logcluster"
+	"analyzer-service/remediation"
+	"analyzer-service/runbook"
+	"analyzer-service/slo"
+	"analyzer-service/topology"
+	"analyzer-service/tracewatch"
+	"incident-simulation/pkg/alerting"
+	"incident-simulation/pkg/anomaly"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// Default page size of the incident list
+const defaultListLimit = 100
+
+type errorResponse struct {
+	Error string `json:"error"`
+	httpx.ErrorRef
+}
+
+type CreateIncidentRequest struct {
+	Service   string            `json:"service"`
+	Type      string            `json:"type"`
+	Severity  string            `json:"severity"`
+	Summary   string            `json:"summary"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	StartedAt time.Time         `json:"started_at"`
+}
+
+type AnnotationRequest struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+type FeedbackRequest struct {
+	Verdict string `json:"verdict"`
+	Note    string `json:"note"`
+}
+
+type FeedbackResponse struct {
+	Incident Incident        `json:"incident"`
+	Tuning   *anomaly.Tuning `json:"tuning,omitempty"`
+}
+
+// api serves the incident timeline REST endpoints
+type api struct {
+	store      *Store
+	tuner      *anomaly.Tuner
+	clusters   *logcluster.Clusterer // nil when log clustering is off
+	traces     *tracewatch.Detector  // nil when trace anomaly detection is off
+	runbooks   *runbook.Library
+	remediator *remediation.Engine // nil when REMEDIATIONS_FILE is unset
+	topology   *topology.Builder   // nil when the service graph is off
+	canary     *canary.Analyzer    // nil when canary analysis is off
+	budget     *slo.Tracker        // nil when error budget tracking is off
+	maxLimit   int
+	// Admin endpoints need adminToken as a bearer token, or devMode without one
+	adminToken string
+	devMode    bool
+}
+
+func (a *api) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/incidents", a.listIncidents)
+	mux.HandleFunc("POST /api/v1/incidents", a.createIncident)
+	mux.HandleFunc("GET /api/v1/incidents/{id}", a.getIncident)
+	mux.HandleFunc("POST /api/v1/incidents/{id}/annotations", a.annotateIncident)
+	mux.HandleFunc("POST /api/v1/incidents/{id}/feedback", a.feedback)
+	mux.HandleFunc("GET /api/v1/tuning", a.listTunings)
+	mux.HandleFunc("GET /api/v1/log-clusters", a.listLogClusters)
+	mux.HandleFunc("GET /api/v1/trace-anomalies", a.listTraceAnomalies)
+	mux.HandleFunc("GET /api/v1/trace-operations", a.listTraceOperations)
+	mux.HandleFunc("GET /api/v1/runbooks", a.listRunbooks)
+	mux.HandleFunc("GET /api/v1/runbooks/{name}", a.getRunbook)
+	mux.HandleFunc("PUT /api/v1/runbooks/{name}", a.admin(a.putRunbook))
+	mux.HandleFunc("DELETE /api/v1/runbooks/{name}", a.admin(a.deleteRunbook))
+	mux.HandleFunc("GET /api/v1/remediations", a.listRemediations)
+	mux.HandleFunc("POST /api/v1/incidents/{id}/remediations/{action}", a.admin(a.runRemediation))
+	mux.HandleFunc("GET /topology", a.getTopology)
+	// Target of pkg/deploy (DEPLOY_EVENTS_URL)
+	mux.HandleFunc("POST /api/v1/deployments", a.recordDeployment)
+	mux.HandleFunc("GET /api/v1/deployments", a.listDeployments)
+	// Polled by the core API to roll back a failing database canary
+	mux.HandleFunc("GET /api/v1/canary", a.getCanaryVerdict)
+	// Polled by the load generator to hold back risky traffic (FREEZE_URL)
+	mux.HandleFunc("GET /api/v1/error-budget", a.getErrorBudget)
+	// Generic webhook target for pkg/alerting (ALERT_WEBHOOK_URL)
+	mux.HandleFunc("POST /api/v1/alerts", a.receiveAlert)
+}
+
+func (a *api) listIncidents(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Incidents")
+	defer span.End()
+
+	q := r.URL.Query()
+	f := Filter{
+		Service:  q.Get("service"),
+		Type:     q.Get("type"),
+		Severity: q.Get("severity"),
+		Status:   q.Get("status"),
+		Verdict:  q.Get("verdict"),
+		Limit:    defaultListLimit,
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		f.Limit = n
+	}
+	f.Limit = min(f.Limit, a.maxLimit)
+
+	incidents, err := a.store.List(f)
+	if err != nil {
+		span.SetStatus(codes.Error, "list failed")
+		logx.Errorw(ctx, "❌ Failed to list incidents", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to list incidents")
+		return
+	}
+	span.SetAttributes(attribute.Int("incident.count", len(incidents)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"incidents": incidents})
+}
+
+func (a *api) createIncident(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Create Incident")
+	defer span.End()
+
+	var req CreateIncidentRequest
+	if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Service == "" || req.Type == "" {
+		writeError(w, r, http.StatusBadRequest, "service and type are required")
+		return
+	}
+	if req.Severity == "" {
+		req.Severity = "warning"
+	}
+	now := time.Now().UTC()
+	if req.StartedAt.IsZero() {
+		req.StartedAt = now
+	}
+
+	inc := Incident{
+		Service:   req.Service,
+		Type:      req.Type,
+		Severity:  req.Severity,
+		Summary:   req.Summary,
+		Labels:    req.Labels,
+		StartedAt: req.StartedAt,
+	}
+	inc.record("opened", req.Summary, req.StartedAt)
+	if err := a.store.Create(&inc); err != nil {
+		span.SetStatus(codes.Error, "create failed")
+		logx.Errorw(ctx, "❌ Failed to create incident", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to create incident")
+		return
+	}
+	incidentOpened(ctx, a.remediator, inc)
+	span.SetAttributes(attribute.String("incident.id", inc.ID))
+	logx.Infow(ctx, "📝 Incident recorded", "incident.id", inc.ID, "incident.service", inc.Service, "incident.type", inc.Type)
+	writeJSON(w, http.StatusCreated, inc)
+}
+
+func (a *api) getIncident(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "Get Incident")
+	defer span.End()
+
+	id := r.PathValue("id")
+	span.SetAttributes(attribute.String("incident.id", id))
+	inc, err := a.store.Get(id)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, inc)
+}
+
+func (a *api) annotateIncident(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Annotate Incident")
+	defer span.End()
+
+	id := r.PathValue("id")
+	span.SetAttributes(attribute.String("incident.id", id))
+	var req AnnotationRequest
+	if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		writeError(w, r, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	now := time.Now().UTC()
+	inc, err := a.store.Update(id, func(inc *Incident) error {
+		inc.Annotations = append(inc.Annotations, Annotation{Time: now, Author: req.Author, Text: req.Text})
+		inc.record("annotated", req.Text, now)
+		return nil
+	})
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	logx.Infow(ctx, "🗒️ Incident annotated", "incident.id", id, "author", req.Author)
+	writeJSON(w, http.StatusCreated, inc)
+}
+
+// feedback marks an incident as a true or false positive. Incidents opened by
+// an anomaly score alert also update the tuned sensitivity of that series; a
+// changed verdict takes the earlier one back first.
+func (a *api) feedback(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Incident Feedback")
+	defer span.End()
+
+	id := r.PathValue("id")
+	span.SetAttributes(attribute.String("incident.id", id))
+	var req FeedbackRequest
+	if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Verdict != VerdictTruePositive && req.Verdict != VerdictFalsePositive {
+		writeError(w, r, http.StatusBadRequest,
+			fmt.Sprintf("verdict must be %q or %q", VerdictTruePositive, VerdictFalsePositive))
+		return
+	}
+
+	now := time.Now().UTC()
+	var previous string
+	inc, err := a.store.Update(id, func(inc *Incident) error {
+		previous, inc.Verdict = inc.Verdict, req.Verdict
+		inc.record("feedback", strings.TrimSpace(req.Verdict+" "+req.Note), now)
+		return nil
+	})
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.String("incident.verdict", inc.Verdict))
+	verdictCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("verdict", inc.Verdict),
+		attribute.String("incident_type", inc.Type),
+	))
+	logx.Infow(ctx, "⚖️ Incident feedback recorded", "incident.id", id, "incident.verdict", inc.Verdict)
+
+	resp := FeedbackResponse{Incident: inc}
+	series, tuned := strings.CutSuffix(inc.Series, anomaly.ScoreSuffix)
+	if tuned && previous != inc.Verdict {
+		if previous != "" {
+			if _, err := a.tuner.Feedback(series, inc.Labels, previous == VerdictTruePositive, true); err != nil {
+				logx.Errorw(ctx, "❌ Failed to retract tuning feedback", "incident.id", id, "error", err)
+			}
+		}
+		tuning, err := a.tuner.Feedback(series, inc.Labels, inc.Verdict == VerdictTruePositive, false)
+		if err != nil {
+			logx.Errorw(ctx, "❌ Failed to persist tuning", "incident.id", id, "error", err)
+		}
+		span.SetAttributes(attribute.Float64("anomaly.sensitivity", tuning.Sensitivity))
+		logx.Infow(ctx, "🎚️ Series sensitivity tuned", "series", series, "anomaly.sensitivity", tuning.Sensitivity,
+			"true_positives", tuning.TruePositives, "false_positives", tuning.FalsePositives)
+		resp.Tuning = &tuning
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listTunings returns the learned per-series sensitivities
+func (a *api) listTunings(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Tunings")
+	defer span.End()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tunings": a.tuner.Tunings()})
+}
+
+func (a *api) receiveAlert(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Receive Alert")
+	defer span.End()
+
+	var n alerting.Notification
+	if err := jsonx.NewDecoder(r.Body).Decode(&n); err != nil || n.Fingerprint == "" || n.State == "" {
+		writeError(w, r, http.StatusBadRequest, "fingerprint and state are required")
+		return
+	}
+	span.SetAttributes(
+		attribute.String("alert.rule", n.Rule),
+		attribute.String("alert.state", n.State),
+	)
+
+	inc, opened, err := a.store.RecordNotification(n, time.Now().UTC())
+	if errors.Is(err, errNotFound) {
+		// Resolve for an alert we never saw firing; nothing to close
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "record failed")
+		logx.Errorw(ctx, "❌ Failed to record alert", "alert.rule", n.Rule, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to record alert")
+		return
+	}
+	span.SetAttributes(attribute.String("incident.id", inc.ID))
+	if opened {
+		incidentOpened(ctx, a.remediator, inc)
+		logx.Warnw(ctx, "🚨 Incident opened from alert", "incident.id", inc.ID, "alert.rule", n.Rule, "incident.type", inc.Type)
+		writeJSON(w, http.StatusCreated, inc)
+		return
+	}
+	writeJSON(w, http.StatusOK, inc)
+}
+
+func (a *api) storeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errNotFound) {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	logx.Errorw(r.Context(), "❌ Incident store error", "error", err)
+	writeError(w, r, http.StatusInternalServerError, "incident store error")
+}
+
+func incidentAttributes(inc Incident) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("service", inc.Service),
+		attribute.String("incident_type", inc.Type),
+		attribute.String("severity", inc.Severity),
+	)
+}
+
+// admin guards h, which changes the analyzer or acts on the services. With an
+// admin token configured requests must carry it; without one h is only served
+// in DEV_MODE, like the services' admin endpoints.
+func (a *api) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.adminToken == "" {
+			if !a.devMode {
+				writeError(w, r, http.StatusForbidden, "admin endpoints need ANALYZER_ADMIN_TOKEN or DEV_MODE")
+				return
+			}
+			h(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="analyzer-admin"`)
+			writeError(w, r, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg, ErrorRef: httpx.NewErrorRef(r.Context(), w)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	jsonx.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"analyzer-service/remediation"
+	"analyzer-service/runbook"
+	"incident-simulation/pkg/jsonx"
+)
+
+const testRemediations = `
+actions:
+  - name: clear-incident
+    classes: [deadlock]
+    method: POST
+    url: http://127.0.0.1:1/db/admin/clear
+`
+
+// newTestAPI serves the API of a fresh store, the built-in runbooks written
+// to a temporary RUNBOOKS_FILE and a dry-run remediation action
+func newTestAPI(t *testing.T, adminToken string, devMode bool) (*api, http.Handler) {
+	t.Helper()
+	initMetrics(context.Background())
+	dir := t.TempDir()
+
+	store, err := OpenStore(filepath.Join(dir, "incidents.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if store.runbooks, err = runbook.Load(filepath.Join(dir, "runbooks.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := filepath.Join(dir, "remediations.yaml")
+	if err := os.WriteFile(actions, []byte(testRemediations), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	remediator, err := remediation.Load(remediation.Config{RemediationsFile: actions, RemediationDryRun: true}, http.DefaultClient, remediationTimeline(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// maxLimit is small enough for the list tests to reach
+	a := &api{store: store, runbooks: store.runbooks, remediator: remediator, maxLimit: 4,
+		adminToken: adminToken, devMode: devMode}
+	mux := http.NewServeMux()
+	a.register(mux)
+	return a, mux
+}
+
+// seedIncidents creates incidents through the API, oldest first, and returns their IDs
+func seedIncidents(t *testing.T, h http.Handler, bodies ...string) []string {
+	t.Helper()
+	var ids []string
+	for _, body := range bodies {
+		rec := serve(h, http.MethodPost, "/api/v1/incidents", body, "")
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d; body %s", body, rec.Code, rec.Body)
+		}
+		var inc Incident
+		if err := jsonx.Unmarshal(rec.Body.Bytes(), &inc); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, inc.ID)
+	}
+	return ids
+}
+
+// serve sends a request with body to h, with token as its bearer token when set
+func serve(h http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRunRemediationNeedsAdmin(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		adminToken string
+		devMode    bool
+		header     string
+		wantStatus int
+	}{
+		{"no token configured", "", false, "", http.StatusForbidden},
+		{"no token configured with a token sent", "", false, "Bearer secret", http.StatusForbidden},
+		{"dev mode", "", true, "", http.StatusOK},
+		{"missing token", "secret", false, "", http.StatusUnauthorized},
+		{"missing token in dev mode", "secret", true, "", http.StatusUnauthorized},
+		{"wrong token", "secret", false, "Bearer wrong", http.StatusUnauthorized},
+		{"token without scheme", "secret", false, "secret", http.StatusUnauthorized},
+		{"token", "secret", false, "Bearer secret", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, h := newTestAPI(t, tc.adminToken, tc.devMode)
+			inc := &Incident{Service: "database-service", Type: "deadlock", Severity: "critical", Summary: "deadlock"}
+			if err := a.store.Create(inc); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/incidents/"+inc.ID+"/remediations/clear-incident", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			runs := len(a.remediator.Recent(10))
+			if ran := tc.wantStatus == http.StatusOK; (runs == 1) != ran {
+				t.Errorf("%d runs recorded, want ran %v", runs, ran)
+			}
+			if rec.Code == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Errorf("WWW-Authenticate = %q, want a Bearer challenge", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestRunbookEditsNeedAdmin(t *testing.T) {
+	const body = `{"title":"Restart","classes":["deadlock"],"steps":[{"title":"Restart the pool"}]}`
+	for _, tc := range []struct {
+		name         string
+		method, path string
+		adminToken   string
+		devMode      bool
+		token        string
+		wantStatus   int
+	}{
+		{"put without a token configured", http.MethodPut, "/api/v1/runbooks/restart", "", false, "", http.StatusForbidden},
+		{"put in dev mode", http.MethodPut, "/api/v1/runbooks/restart", "", true, "", http.StatusCreated},
+		{"put without the token", http.MethodPut, "/api/v1/runbooks/restart", "secret", false, "", http.StatusUnauthorized},
+		{"put with a wrong token", http.MethodPut, "/api/v1/runbooks/restart", "secret", false, "wrong", http.StatusUnauthorized},
+		{"put with the token", http.MethodPut, "/api/v1/runbooks/restart", "secret", false, "secret", http.StatusCreated},
+		{"delete without a token configured", http.MethodDelete, "/api/v1/runbooks/database-slowdown", "", false, "", http.StatusForbidden},
+		{"delete in dev mode", http.MethodDelete, "/api/v1/runbooks/database-slowdown", "", true, "", http.StatusNoContent},
+		{"delete without the token", http.MethodDelete, "/api/v1/runbooks/database-slowdown", "secret", true, "", http.StatusUnauthorized},
+		{"delete with the token", http.MethodDelete, "/api/v1/runbooks/database-slowdown", "secret", false, "secret", http.StatusNoContent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, h := newTestAPI(t, tc.adminToken, tc.devMode)
+			before := len(a.runbooks.List())
+			if rec := serve(h, tc.method, tc.path, body, tc.token); rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			// Reads stay open whatever the guard says
+			if rec := serve(h, http.MethodGet, "/api/v1/runbooks", "", ""); rec.Code != http.StatusOK {
+				t.Errorf("list status = %d, want 200", rec.Code)
+			}
+			if changed := len(a.runbooks.List()) != before; changed != (tc.wantStatus < 300) {
+				t.Errorf("runbooks changed %v after status %d", changed, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestListIncidents(t *testing.T) {
+	a, h := newTestAPI(t, "", false)
+	ids := seedIncidents(t, h,
+		`{"service":"database-service","type":"deadlock","severity":"critical"}`,
+		`{"service":"core-api-service","type":"high_latency","severity":"warning"}`,
+		`{"service":"database-service","type":"disk_full","severity":"critical"}`,
+		`{"service":"payment-gateway","type":"high_latency"}`,
+		`{"service":"database-service","type":"deadlock","severity":"warning"}`,
+		`{"service":"core-api-service","type":"error_spike","severity":"critical"}`,
+	)
+	if _, err := a.store.Update(ids[2], func(inc *Incident) error { inc.Status = StatusResolved; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(h, http.MethodPost, "/api/v1/incidents/"+ids[0]+"/feedback", `{"verdict":"false_positive"}`, ""); rec.Code != http.StatusOK {
+		t.Fatalf("feedback: status %d; body %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		want  []int // indexes into ids, newest first
+	}{
+		{"newest first up to the max limit", "", []int{5, 4, 3, 2}},
+		{"limit", "?limit=2", []int{5, 4}},
+		{"limit above the max", "?limit=50", []int{5, 4, 3, 2}},
+		{"service", "?service=database-service", []int{4, 2, 0}},
+		{"service and type", "?service=database-service&type=deadlock", []int{4, 0}},
+		{"severity with its default", "?severity=warning", []int{4, 3, 1}},
+		{"severity and limit", "?severity=critical&limit=2", []int{5, 2}},
+		{"status", "?status=resolved", []int{2}},
+		{"open", "?status=open&service=database-service", []int{4, 0}},
+		{"verdict", "?verdict=false_positive", []int{0}},
+		{"no match", "?service=auth-service", []int{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/api/v1/incidents"+tc.query, "", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+			var body struct {
+				Incidents []Incident `json:"incidents"`
+			}
+			if err := jsonx.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Incidents == nil {
+				t.Fatalf("incidents is null, want a list: %s", rec.Body)
+			}
+			var got, want []string
+			for _, inc := range body.Incidents {
+				got = append(got, inc.ID)
+			}
+			for _, i := range tc.want {
+				want = append(want, ids[i])
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("incidents %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestIncidentRequestErrors(t *testing.T) {
+	a, h := newTestAPI(t, "", true)
+	ids := seedIncidents(t, h, `{"service":"database-service","type":"deadlock"}`)
+
+	for _, tc := range []struct {
+		name         string
+		method, path string
+		body         string
+		wantStatus   int
+		wantError    string
+	}{
+		{"limit zero", http.MethodGet, "/api/v1/incidents?limit=0", "", http.StatusBadRequest, "limit must be a positive integer"},
+		{"negative limit", http.MethodGet, "/api/v1/incidents?limit=-1", "", http.StatusBadRequest, "limit must be a positive integer"},
+		{"limit not a number", http.MethodGet, "/api/v1/incidents?limit=ten", "", http.StatusBadRequest, "limit must be a positive integer"},
+		{"create without type", http.MethodPost, "/api/v1/incidents", `{"service":"database-service"}`, http.StatusBadRequest, "service and type are required"},
+		{"create with invalid body", http.MethodPost, "/api/v1/incidents", `{"service":`, http.StatusBadRequest, "invalid request body"},
+		{"get unknown incident", http.MethodGet, "/api/v1/incidents/inc-99999999", "", http.StatusNotFound, "incident not found"},
+		{"annotate unknown incident", http.MethodPost, "/api/v1/incidents/inc-99999999/annotations", `{"text":"looking"}`, http.StatusNotFound, "incident not found"},
+		{"annotate without text", http.MethodPost, "/api/v1/incidents/" + ids[0] + "/annotations", `{"text":"  "}`, http.StatusBadRequest, "text is required"},
+		{"feedback on unknown incident", http.MethodPost, "/api/v1/incidents/inc-99999999/feedback", `{"verdict":"true_positive"}`, http.StatusNotFound, "incident not found"},
+		{"unknown verdict", http.MethodPost, "/api/v1/incidents/" + ids[0] + "/feedback", `{"verdict":"maybe"}`, http.StatusBadRequest, "verdict must be"},
+		{"remediate unknown incident", http.MethodPost, "/api/v1/incidents/inc-99999999/remediations/clear-incident", "", http.StatusNotFound, "incident not found"},
+		{"unknown remediation", http.MethodPost, "/api/v1/incidents/" + ids[0] + "/remediations/reboot", "", http.StatusNotFound, "unknown remediation action"},
+		{"get unknown runbook", http.MethodGet, "/api/v1/runbooks/nope", "", http.StatusNotFound, "runbook not found"},
+		{"delete unknown runbook", http.MethodDelete, "/api/v1/runbooks/nope", "", http.StatusNotFound, "runbook not found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(h, tc.method, tc.path, tc.body, "")
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			var body errorResponse
+			if err := jsonx.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(body.Error, tc.wantError) {
+				t.Errorf("error = %q, want it to contain %q", body.Error, tc.wantError)
+			}
+		})
+	}
+
+	// Failed requests leave the incident as it was
+	inc, err := a.store.Get(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inc.Annotations) != 0 || inc.Verdict != "" {
+		t.Errorf("incident changed by rejected requests: %+v", inc)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"analyzer-service/canary"
+	"incident-simulation/pkg/logx"
+)
+
+// canaryQuery reads the canary analysis inputs from Prometheus
+func canaryQuery(prom *promClient) canary.Query {
+	return func(ctx context.Context, expr string, at time.Time) ([]canary.Sample, error) {
+		samples, err := prom.query(ctx, expr, at)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]canary.Sample, len(samples))
+		for i, s := range samples {
+			out[i] = canary.Sample{Labels: s.Labels, Value: s.Value}
+		}
+		return out, nil
+	}
+}
+
+// canaryVerdicts counts every verdict and logs when it changes, a fail as
+// a warning since the routing layer rolls the canary back on it
+func canaryVerdicts() func(context.Context, canary.Verdict) {
+	var last string
+	return func(ctx context.Context, v canary.Verdict) {
+		canaryVerdictCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("verdict", v.Verdict)))
+		if v.Verdict == last {
+			return
+		}
+		last = v.Verdict
+
+		ctx, span := otel.Tracer("analyzer-service").Start(ctx, "Canary Verdict")
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("canary.verdict", v.Verdict),
+			attribute.StringSlice("canary.failed_checks", v.Failed),
+			attribute.Float64("canary.calls", v.Canary.Calls),
+		)
+		fields := []interface{}{"canary.verdict", v.Verdict, "canary.failed_checks", strings.Join(v.Failed, ","),
+			"canary.error_rate", v.Canary.ErrorRate, "baseline.error_rate", v.Baseline.ErrorRate,
+			"canary.p95_ms", v.Canary.P95Ms, "baseline.p95_ms", v.Baseline.P95Ms}
+		if v.Verdict == canary.Fail {
+			logx.Warnw(ctx, "🐤 Database canary failed analysis", fields...)
+			return
+		}
+		logx.Infow(ctx, "🐤 Database canary verdict changed", fields...)
+	}
+}
+
+// getCanaryVerdict returns the latest canary verdict, inconclusive before the
+// first analysis; the core API polls it (DB_CANARY_VERDICT_URL)
+func (a *api) getCanaryVerdict(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "Get Canary Verdict")
+	defer span.End()
+
+	if a.canary == nil {
+		writeError(w, r, http.StatusNotFound, "canary analysis is not configured")
+		return
+	}
+	v, ok := a.canary.Latest()
+	if !ok {
+		v = canary.Verdict{Verdict: canary.Inconclusive}
+	}
+	span.SetAttributes(attribute.String("canary.verdict", v.Verdict))
+	writeJSON(w, http.StatusOK, v)
+}
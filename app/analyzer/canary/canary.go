@@ -0,0 +1,334 @@
+// Package canary judges the canary version of the database service against
+// the stable one from the core API's db_backend_call_duration_seconds
+// histogram in Prometheus.
+//
+// Every CANARY_ANALYSIS_INTERVAL the calls of the last CANARY_ANALYSIS_WINDOW
+// are split by track. The canary fails when its error rate is more than
+// CANARY_MAX_ERROR_RATIO times the stable one, or when a one-sided
+// Mann-Whitney U test over the latency buckets finds it slower at
+// CANARY_ALPHA and its p95 is more than CANARY_MAX_LATENCY_RATIO times the
+// stable p95. The test alone flags differences too small to matter once
+// traffic is high, the ratio alone is noisy while it is low. With fewer than
+// CANARY_MIN_CALLS calls on either track the verdict is inconclusive. The latest
+// verdict is served for the routing layer, which takes the canary out of
+// rotation on a fail.
+package canary
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Verdicts
+const (
+	Pass         = "pass"
+	Fail         = "fail"
+	Inconclusive = "inconclusive"
+)
+
+// Checks a verdict is made of
+const (
+	CheckErrorRate = "error_rate"
+	CheckLatency   = "latency"
+)
+
+// Deploy tracks the core API labels its database calls with
+const (
+	trackStable = "stable"
+	trackCanary = "canary"
+)
+
+// Error rates below this count as this, so one canary error against a
+// stable version without errors does not fail it
+const minErrorRate = 0.01
+
+// Config tunes the analysis
+type Config struct {
+	CanaryInterval        time.Duration `env:"CANARY_ANALYSIS_INTERVAL" flag:"canary-analysis-interval" default:"1m" usage:"How often the database canary is compared with the stable version (0 disables)"`
+	CanaryWindow          time.Duration `env:"CANARY_ANALYSIS_WINDOW" flag:"canary-analysis-window" default:"10m" usage:"Database calls of this long ago and newer are compared"`
+	CanaryMinCalls        int           `env:"CANARY_MIN_CALLS" flag:"canary-min-calls" default:"50" usage:"Canary calls in the window needed for a pass or fail"`
+	CanaryMaxErrorRatio   float64       `env:"CANARY_MAX_ERROR_RATIO" flag:"canary-max-error-ratio" default:"2" usage:"Fail when the canary error rate is more than this many times the stable one"`
+	CanaryMaxLatencyRatio float64       `env:"CANARY_MAX_LATENCY_RATIO" flag:"canary-max-latency-ratio" default:"1.5" usage:"Fail a significantly slower canary whose p95 is more than this many times the stable p95"`
+	CanaryAlpha           float64       `env:"CANARY_ALPHA" flag:"canary-alpha" default:"0.01" usage:"Significance level of the Mann-Whitney test that the canary is slower"`
+}
+
+// Sample is one element of an instant vector
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Query evaluates a PromQL expression at the given time
+type Query func(ctx context.Context, expr string, at time.Time) ([]Sample, error)
+
+// Track is what one version did over the window
+type Track struct {
+	Calls     float64 `json:"calls"`
+	Errors    float64 `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+
+	buckets []bucket
+}
+
+// bucket is the calls no slower than le that are slower than the bucket below
+type bucket struct {
+	le    float64
+	count float64
+}
+
+// Check is one comparison of the canary with the stable version
+type Check struct {
+	Name      string  `json:"name"`
+	Passed    bool    `json:"passed"`
+	Ratio     float64 `json:"ratio"`
+	Threshold float64 `json:"threshold"`
+	PValue    float64 `json:"p_value,omitempty"` // latency only
+}
+
+// Verdict is the outcome of one analysis
+type Verdict struct {
+	Verdict  string    `json:"verdict"`
+	Time     time.Time `json:"time"`
+	Window   string    `json:"window"`
+	Baseline Track     `json:"baseline"`
+	Canary   Track     `json:"canary"`
+	Checks   []Check   `json:"checks,omitempty"`
+	Failed   []string  `json:"failed,omitempty"` // names of the failed checks
+}
+
+// Analyzer compares the two tracks periodically and keeps the latest verdict
+type Analyzer struct {
+	cfg       Config
+	query     Query
+	onVerdict func(context.Context, Verdict)
+
+	mu     sync.Mutex
+	latest *Verdict
+}
+
+// New returns an analyzer reading Prometheus through query; onVerdict, if
+// set, is called with every verdict
+func New(cfg Config, query Query, onVerdict func(context.Context, Verdict)) *Analyzer {
+	return &Analyzer{cfg: cfg, query: query, onVerdict: onVerdict}
+}
+
+// Run analyzes every interval until ctx is done
+func (a *Analyzer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			v, err := a.Analyze(ctx, now)
+			if err != nil {
+				if err.Error() != lastErr {
+					log.Printf("Canary analysis: query failed: %v", err)
+					lastErr = err.Error()
+				}
+				continue
+			}
+			lastErr = ""
+			if a.onVerdict != nil {
+				a.onVerdict(ctx, v)
+			}
+		}
+	}
+}
+
+// Latest returns the most recent verdict
+func (a *Analyzer) Latest() (Verdict, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.latest == nil {
+		return Verdict{}, false
+	}
+	return *a.latest, true
+}
+
+// Analyze compares the tracks over the window ending at now
+func (a *Analyzer) Analyze(ctx context.Context, now time.Time) (Verdict, error) {
+	rng := promDuration(a.cfg.CanaryWindow)
+	calls, err := a.query(ctx, fmt.Sprintf(`sum by (track, status) (increase(db_backend_call_duration_seconds_count[%s]))`, rng), now)
+	if err != nil {
+		return Verdict{}, err
+	}
+	buckets, err := a.query(ctx, fmt.Sprintf(`sum by (track, le) (increase(db_backend_call_duration_seconds_bucket[%s]))`, rng), now)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	tracks := map[string]*Track{trackStable: {}, trackCanary: {}}
+	for _, s := range calls {
+		t, ok := tracks[s.Labels["track"]]
+		if !ok {
+			continue
+		}
+		t.Calls += s.Value
+		if s.Labels["status"] == "error" {
+			t.Errors += s.Value
+		}
+	}
+	cumulative := map[string]map[float64]float64{trackStable: {}, trackCanary: {}}
+	for _, s := range buckets {
+		le, err := strconv.ParseFloat(s.Labels["le"], 64)
+		if c, ok := cumulative[s.Labels["track"]]; ok && err == nil {
+			c[le] += s.Value
+		}
+	}
+	bounds := bucketBounds(cumulative)
+	for name, t := range tracks {
+		t.buckets = perBucket(cumulative[name], bounds)
+		if t.Calls > 0 {
+			t.ErrorRate = t.Errors / t.Calls
+		}
+		t.P50Ms = quantile(0.5, t.buckets) * 1000
+		t.P95Ms = quantile(0.95, t.buckets) * 1000
+	}
+
+	v := compare(a.cfg, *tracks[trackStable], *tracks[trackCanary])
+	v.Time = now.UTC()
+	v.Window = a.cfg.CanaryWindow.String()
+	a.mu.Lock()
+	a.latest = &v
+	a.mu.Unlock()
+	return v, nil
+}
+
+// compare judges canary against baseline
+func compare(cfg Config, baseline, canary Track) Verdict {
+	v := Verdict{Verdict: Inconclusive, Baseline: baseline, Canary: canary}
+	if canary.Calls < float64(cfg.CanaryMinCalls) || baseline.Calls < float64(cfg.CanaryMinCalls) {
+		return v
+	}
+
+	errorRatio := math.Max(canary.ErrorRate, minErrorRate) / math.Max(baseline.ErrorRate, minErrorRate)
+	v.Checks = append(v.Checks, Check{
+		Name:      CheckErrorRate,
+		Passed:    errorRatio <= cfg.CanaryMaxErrorRatio,
+		Ratio:     errorRatio,
+		Threshold: cfg.CanaryMaxErrorRatio,
+	})
+
+	latency := Check{Name: CheckLatency, Passed: true, Threshold: cfg.CanaryMaxLatencyRatio, PValue: 1}
+	if baseline.P95Ms > 0 {
+		latency.Ratio = canary.P95Ms / baseline.P95Ms
+	}
+	if len(baseline.buckets) > 0 && len(baseline.buckets) == len(canary.buckets) {
+		latency.PValue = mannWhitney(baseline.buckets, canary.buckets)
+		latency.Passed = latency.PValue >= cfg.CanaryAlpha || latency.Ratio <= cfg.CanaryMaxLatencyRatio
+	}
+	v.Checks = append(v.Checks, latency)
+
+	v.Verdict = Pass
+	for _, c := range v.Checks {
+		if !c.Passed {
+			v.Verdict = Fail
+			v.Failed = append(v.Failed, c.Name)
+		}
+	}
+	return v
+}
+
+// mannWhitney returns the one-sided p-value of the canary calls being
+// slower than the baseline calls, from their counts in the same buckets.
+// Calls in one bucket are ties; the normal approximation is tie corrected.
+func mannWhitney(baseline, canary []bucket) float64 {
+	var n1, n2, u, ties, below float64
+	for i := range baseline {
+		b, c := baseline[i].count, canary[i].count
+		// Canary calls rank above the baseline calls of lower buckets and
+		// tie with those of their own
+		u += c * (below + b/2)
+		below += b
+		n1 += b
+		n2 += c
+		t := b + c
+		ties += t*t*t - t
+	}
+	n := n1 + n2
+	if n1 == 0 || n2 == 0 || n < 2 {
+		return 1
+	}
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (u - n1*n2/2 - 0.5) / math.Sqrt(variance)
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// bucketBounds returns the upper bounds of both tracks' buckets, ascending
+func bucketBounds(cumulative map[string]map[float64]float64) []float64 {
+	seen := make(map[float64]bool)
+	var bounds []float64
+	for _, c := range cumulative {
+		for le := range c {
+			if !seen[le] {
+				seen[le] = true
+				bounds = append(bounds, le)
+			}
+		}
+	}
+	sort.Float64s(bounds)
+	return bounds
+}
+
+// perBucket turns cumulative bucket counts into counts per bucket; increase()
+// extrapolates each series on its own, so a count never goes below zero
+func perBucket(cumulative map[float64]float64, bounds []float64) []bucket {
+	buckets := make([]bucket, len(bounds))
+	var prev float64
+	for i, le := range bounds {
+		c := math.Max(cumulative[le], prev)
+		buckets[i] = bucket{le: le, count: c - prev}
+		prev = c
+	}
+	return buckets
+}
+
+// quantile interpolates the q-quantile in seconds within its bucket, as
+// histogram_quantile does
+func quantile(q float64, buckets []bucket) float64 {
+	var total float64
+	for _, b := range buckets {
+		total += b.count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * total
+	var seen, lower float64
+	for _, b := range buckets {
+		if seen+b.count >= rank && b.count > 0 {
+			if math.IsInf(b.le, 1) {
+				return lower
+			}
+			return lower + (b.le-lower)*(rank-seen)/b.count
+		}
+		seen += b.count
+		if !math.IsInf(b.le, 1) {
+			lower = b.le
+		}
+	}
+	return lower
+}
+
+// promDuration formats d as a PromQL range
+func promDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
@@ -0,0 +1,151 @@
+package canary
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buckets holds counts in buckets with upper bounds 1, 2, 3...
+func buckets(counts ...float64) []bucket {
+	bs := make([]bucket, len(counts))
+	for i, c := range counts {
+		bs[i] = bucket{le: float64(i + 1), count: c}
+	}
+	return bs
+}
+
+func TestMannWhitney(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		baseline, canary []bucket
+		want             float64
+	}{
+		// U = 9 of 9, the textbook 0.0404 (two-sided 0.0808) with continuity correction
+		{"canary slower", buckets(1, 1, 1, 0, 0, 0), buckets(0, 0, 0, 1, 1, 1), 0.040427799},
+		{"canary faster", buckets(0, 0, 0, 1, 1, 1), buckets(1, 1, 1, 0, 0, 0), 0.985451834},
+		// Baseline 1,2,2,3 against canary 2,3,3,4: U = 13 of 16 counting ties as halves
+		{"ties across buckets", buckets(1, 2, 1, 0), buckets(0, 1, 2, 1), 0.086016854},
+		{"same distribution", buckets(10, 10), buckets(10, 10), 0.506228231},
+		// Every call ties, so there is no variance to test against
+		{"all in one bucket", buckets(5), buckets(5), 1},
+		{"no canary calls", buckets(3, 2), buckets(0, 0), 1},
+		{"no baseline calls", buckets(0, 0), buckets(3, 2), 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mannWhitney(tc.baseline, tc.canary); math.Abs(got-tc.want) > 1e-6 {
+				t.Errorf("mannWhitney() = %.9f, want %.9f", got, tc.want)
+			}
+		})
+	}
+}
+
+var testConfig = Config{
+	CanaryMinCalls:        50,
+	CanaryMaxErrorRatio:   2,
+	CanaryMaxLatencyRatio: 1.5,
+	CanaryAlpha:           0.01,
+}
+
+// track builds a Track of the calls in buckets with upper bounds of 1s, 2s,
+// 3s... and errors of them
+func track(errors float64, counts ...float64) Track {
+	t := Track{Errors: errors, buckets: buckets(counts...)}
+	for _, c := range counts {
+		t.Calls += c
+	}
+	if t.Calls > 0 {
+		t.ErrorRate = t.Errors / t.Calls
+	}
+	t.P95Ms = quantile(0.95, t.buckets) * 1000
+	return t
+}
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		baseline, canary Track
+		want             string
+		failed           []string
+	}{
+		{"too few canary calls", track(0, 100, 100, 0), track(20, 0, 10, 30), Inconclusive, nil},
+		{"too few baseline calls", track(0, 10, 10, 0), track(0, 100, 100, 0), Inconclusive, nil},
+		{"same as stable", track(2, 400, 100, 0), track(2, 400, 100, 0), Pass, nil},
+		{"clear latency regression", track(0, 400, 100, 0), track(0, 50, 150, 300), Fail, []string{CheckLatency}},
+		{"clear error regression", track(5, 400, 100, 0), track(100, 400, 100, 0), Fail, []string{CheckErrorRate}},
+		{"both regress", track(5, 400, 100, 0), track(100, 50, 150, 300), Fail, []string{CheckErrorRate, CheckLatency}},
+		// One error against none stays under the error rate floor
+		{"one error against none", track(0, 400, 100, 0), track(1, 400, 100, 0), Pass, nil},
+		// Significantly slower, but the p95 is within the ratio
+		{"slower within the latency ratio", track(0, 1000, 1000, 100), track(0, 800, 1200, 100), Pass, nil},
+		// The p95 doubles but the sample is too small to tell
+		{"p95 doubled on little traffic", track(0, 48, 2, 0), track(0, 46, 3, 1), Pass, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := compare(testConfig, tc.baseline, tc.canary)
+			if v.Verdict != tc.want || !slices.Equal(v.Failed, tc.failed) {
+				t.Fatalf("verdict %s failing %v, want %s failing %v; checks %+v", v.Verdict, v.Failed, tc.want, tc.failed, v.Checks)
+			}
+			if tc.want == Inconclusive && len(v.Checks) != 0 {
+				t.Errorf("inconclusive verdict has checks %+v", v.Checks)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	// Stable calls are mostly under 10ms; the canary's mostly between 50ms and 100ms
+	cumulative := map[string][]float64{
+		trackStable: {400, 490, 500, 500},
+		trackCanary: {20, 60, 450, 500},
+	}
+	les := []string{"0.01", "0.05", "0.1", "+Inf"}
+	query := func(_ context.Context, expr string, _ time.Time) ([]Sample, error) {
+		var out []Sample
+		for track, counts := range cumulative {
+			if strings.Contains(expr, "_count[") {
+				out = append(out, Sample{Labels: map[string]string{"track": track, "status": "ok"}, Value: counts[len(counts)-1]})
+				continue
+			}
+			for i, le := range les {
+				out = append(out, Sample{Labels: map[string]string{"track": track, "le": le}, Value: counts[i]})
+			}
+		}
+		out = append(out, Sample{Labels: map[string]string{"track": "unknown", "le": "0.01"}, Value: 1000})
+		return out, nil
+	}
+
+	a := New(Config{CanaryWindow: 10 * time.Minute, CanaryMinCalls: 50, CanaryMaxErrorRatio: 2, CanaryMaxLatencyRatio: 1.5, CanaryAlpha: 0.01}, query, nil)
+	if _, ok := a.Latest(); ok {
+		t.Fatal("Latest() before any analysis")
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v, err := a.Analyze(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Verdict != Fail || !slices.Equal(v.Failed, []string{CheckLatency}) {
+		t.Errorf("verdict %s failing %v, want fail on latency", v.Verdict, v.Failed)
+	}
+	if v.Baseline.Calls != 500 || v.Canary.Calls != 500 || v.Window != "10m0s" || !v.Time.Equal(now) {
+		t.Errorf("verdict %+v", v)
+	}
+	// Interpolated within the bucket: rank 475 of the stable calls lies in (0.01, 0.05]
+	if want := (0.01 + 0.04*75.0/90) * 1000; math.Abs(v.Baseline.P95Ms-want) > 1e-9 {
+		t.Errorf("stable p95 = %g ms, want %g", v.Baseline.P95Ms, want)
+	}
+	if latest, ok := a.Latest(); !ok || latest.Verdict != v.Verdict {
+		t.Errorf("Latest() = %+v, %v", latest, ok)
+	}
+}
+
+func TestPromDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{10 * time.Minute: "10m", 90 * time.Second: "90s", time.Hour: "60m"} {
+		if got := promDuration(d); got != want {
+			t.Errorf("promDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
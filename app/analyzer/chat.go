@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"analyzer-service/llm"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+const chatSystemPrompt = `You are the on-call assistant for the incident simulation services (core-api-service, database-service, payment-gateway, auth-service, worker-service).
+Answer the operator's question using only the evidence below. Cite every fact you use inline with the tag it carries, e.g. [metric:database-service/latency_p95_seconds], [trace:<id>], [incident:<id>] or [deployment:<id>].
+When errors or latency rise soon after a deployment of the affected service, name that deployment as the likely cause.
+If the evidence does not explain what happened, say so and suggest what to look at next. Be brief.`
+
+// ChatRequest is the OpenAI chat completion request; only the fields the
+// analyzer uses are read
+type ChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []llm.Message `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type chatChoice struct {
+	Index        int          `json:"index"`
+	Message      *llm.Message `json:"message,omitempty"`
+	Delta        *llm.Message `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+// ChatResponse is a chat.completion object, or one chat.completion.chunk when
+// streaming. Evidence is an extension carried by the first chunk.
+type ChatResponse struct {
+	ID       string       `json:"id"`
+	Object   string       `json:"object"`
+	Created  int64        `json:"created"`
+	Model    string       `json:"model"`
+	Choices  []chatChoice `json:"choices"`
+	Evidence *Evidence    `json:"evidence,omitempty"`
+}
+
+type chatError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// chat answers questions about the simulated services from their telemetry
+type chat struct {
+	gatherer *evidenceGatherer
+	llm      llm.Provider
+	model    string // configured model, reported when the request names none
+	timeout  time.Duration
+}
+
+func (c *chat) register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /chat", c.complete)
+	// OpenAI-compatible path so chat UIs and SDKs can point at the analyzer
+	mux.HandleFunc("POST /v1/chat/completions", c.complete)
+}
+
+func (c *chat) complete(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Chat Completion")
+	defer span.End()
+	start := time.Now()
+
+	var req ChatRequest
+	if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeChatError(w, http.StatusBadRequest, "invalid_request_error", "invalid request body")
+		return
+	}
+	question := lastUserMessage(req.Messages)
+	if question == "" {
+		writeChatError(w, http.StatusBadRequest, "invalid_request_error", "messages must contain a user message")
+		return
+	}
+	span.SetAttributes(attribute.Bool("chat.stream", req.Stream))
+
+	evidence := c.gatherer.gather(ctx, question, time.Now())
+	span.SetAttributes(
+		attribute.Int("chat.evidence.metrics", len(evidence.Metrics)),
+		attribute.Int("chat.evidence.suspects", len(evidence.Suspects)),
+		attribute.Int("chat.evidence.incidents", len(evidence.Incidents)),
+	)
+
+	// Earlier system messages from the client are replaced by the analyzer's
+	messages := []llm.Message{{Role: "system", Content: chatSystemPrompt + "\n\nEvidence:\n" + evidence.prompt()}}
+	for _, m := range req.Messages {
+		if m.Role != "system" {
+			messages = append(messages, m)
+		}
+	}
+
+	resp := ChatResponse{
+		ID:      "chatcmpl-" + trace.SpanContextFromContext(ctx).TraceID().String(),
+		Created: start.Unix(),
+		Model:   req.Model,
+	}
+	if resp.Model == "" {
+		resp.Model = c.model
+	}
+
+	llmCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	llmReq := llm.Request{Model: req.Model, Messages: messages}
+	stream := newChunkWriter(w, resp)
+	var answer string
+	var err error
+	if req.Stream {
+		err = c.llm.Stream(llmCtx, llmReq, func(delta string) error {
+			if !stream.started {
+				stream.start(&evidence)
+			}
+			return stream.delta(delta)
+		})
+	} else {
+		answer, err = c.llm.Complete(llmCtx, llmReq)
+	}
+
+	if err != nil && !stream.started {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "llm request failed")
+		chatRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "error")))
+		logx.Errorw(ctx, "❌ Chat completion failed", "error", err)
+		writeChatError(w, http.StatusBadGateway, "upstream_error", fmt.Sprintf("llm request failed: %v", err))
+		return
+	}
+
+	outcome := "ok"
+	if err != nil {
+		// Already streaming: tell the reader in-band and still cite the evidence
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "llm stream interrupted")
+		logx.Warnw(ctx, "⚠️ Chat stream interrupted", "error", err)
+		outcome = "interrupted"
+		stream.delta(fmt.Sprintf("\n\n[answer interrupted: %v]", err))
+	}
+	chatRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+	chatDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.Bool("stream", req.Stream)))
+	logx.Infow(ctx, "💬 Chat answered", "chat.stream", req.Stream, "chat.duration_ms", time.Since(start).Milliseconds(),
+		"chat.evidence.suspects", len(evidence.Suspects))
+
+	if !req.Stream {
+		stop := "stop"
+		resp.Object = "chat.completion"
+		resp.Evidence = &evidence
+		resp.Choices = []chatChoice{{
+			Message:      &llm.Message{Role: "assistant", Content: answer + evidence.sources()},
+			FinishReason: &stop,
+		}}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	if !stream.started {
+		stream.start(&evidence)
+	}
+	stream.delta(evidence.sources())
+	stream.finish()
+}
+
+// chunkWriter writes chat.completion.chunk server-sent events
+type chunkWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	resp    ChatResponse
+	started bool
+}
+
+func newChunkWriter(w http.ResponseWriter, resp ChatResponse) *chunkWriter {
+	flusher, _ := w.(http.Flusher)
+	resp.Object = "chat.completion.chunk"
+	return &chunkWriter{w: w, flusher: flusher, resp: resp}
+}
+
+// start sends the headers and the role chunk carrying the evidence
+func (s *chunkWriter) start(evidence *Evidence) {
+	s.started = true
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+
+	first := s.resp
+	first.Evidence = evidence
+	first.Choices = []chatChoice{{Delta: &llm.Message{Role: "assistant"}}}
+	s.send(first)
+}
+
+func (s *chunkWriter) delta(content string) error {
+	chunk := s.resp
+	chunk.Choices = []chatChoice{{Delta: &llm.Message{Content: content}}}
+	return s.send(chunk)
+}
+
+func (s *chunkWriter) finish() {
+	stop := "stop"
+	chunk := s.resp
+	chunk.Choices = []chatChoice{{Delta: &llm.Message{}, FinishReason: &stop}}
+	s.send(chunk)
+	fmt.Fprint(s.w, "data: [DONE]\n\n")
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *chunkWriter) send(chunk ChatResponse) error {
+	data, err := jsonx.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func lastUserMessage(messages []llm.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" && strings.TrimSpace(messages[i].Content) != "" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+func writeChatError(w http.ResponseWriter, status int, kind, msg string) {
+	var body chatError
+	body.Error.Message, body.Error.Type = msg, kind
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,175 @@
+// Command evaluate scores the analyzer's incidents against the ground truth
+// of the database service's incident history and prints precision, recall,
+// detection latency and a confusion matrix by incident type. It exits
+// non-zero when precision or recall falls below the given minimums, so a
+// detector change can be checked against a recorded run.
+//
+//	go run ./cmd/evaluate --window 6h
+//	go run ./cmd/evaluate --service core-api-service --format json
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"analyzer-service/evaluation"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/jsonx"
+)
+
+// Config is the evaluation tool configuration
+type Config struct {
+	AnalyzerURL    string        `env:"ANALYZER_URL" flag:"analyzer-url" default:"http://127.0.0.1:8084" usage:"Analyzer base URL the detections are read from"`
+	GroundTruthURL string        `env:"GROUND_TRUTH_URL" flag:"ground-truth-url" default:"http://127.0.0.1:8081" usage:"Database service base URL whose GET /db/incidents is the ground truth"`
+	Window         time.Duration `env:"EVAL_WINDOW" flag:"window" default:"24h" usage:"Incidents and detections of this long ago and newer are scored"`
+	Grace          time.Duration `env:"EVAL_GRACE" flag:"grace" default:"2m" usage:"Detections opened this long after an incident ended still match it"`
+	Service        string        `env:"EVAL_SERVICE" flag:"service" usage:"Only score the analyzer's incidents of this service (empty scores all)"`
+	MaxDetections  int           `env:"EVAL_MAX_DETECTIONS" flag:"max-detections" default:"500" usage:"Most recent analyzer incidents read, at most the analyzer's INCIDENT_LIST_MAX_LIMIT"`
+	MinPrecision   float64       `env:"EVAL_MIN_PRECISION" flag:"min-precision" default:"0" usage:"Exit non-zero when precision is below this"`
+	MinRecall      float64       `env:"EVAL_MIN_RECALL" flag:"min-recall" default:"0" usage:"Exit non-zero when recall is below this"`
+	Format         string        `env:"EVAL_FORMAT" flag:"format" default:"text" usage:"Report format: text or json"`
+	Timeout        time.Duration `env:"EVAL_TIMEOUT" flag:"timeout" default:"30s" usage:"Timeout of each request"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Window <= 0 || c.Grace < 0 {
+		errs = append(errs, errors.New("EVAL_WINDOW must be positive and EVAL_GRACE not negative"))
+	}
+	if c.MaxDetections < 1 {
+		errs = append(errs, errors.New("EVAL_MAX_DETECTIONS must be at least 1"))
+	}
+	if c.MinPrecision < 0 || c.MinPrecision > 1 || c.MinRecall < 0 || c.MinRecall > 1 {
+		errs = append(errs, errors.New("EVAL_MIN_PRECISION and EVAL_MIN_RECALL must be between 0 and 1"))
+	}
+	if c.Format != "text" && c.Format != "json" {
+		errs = append(errs, errors.New("EVAL_FORMAT must be text or json"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("EVAL_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	client := &http.Client{Timeout: cfg.Timeout}
+	until := time.Now()
+	since := until.Add(-cfg.Window)
+
+	truths, err := readGroundTruth(ctx, client, cfg.GroundTruthURL, since, until)
+	if err != nil {
+		log.Fatalf("Failed to read the ground truth: %v", err)
+	}
+	detections, err := readDetections(ctx, client, cfg.AnalyzerURL, cfg.Service, cfg.MaxDetections)
+	if err != nil {
+		log.Fatalf("Failed to read the analyzer's incidents: %v", err)
+	}
+	log.Printf("🔬 Scoring %d detection(s) against %d incident(s) overlapping the window since %s", len(detections), len(truths), since.Format(time.RFC3339))
+
+	report := evaluation.Evaluate(truths, detections, since, until, cfg.Grace)
+	if cfg.Format == "json" {
+		err = jsonx.NewEncoder(os.Stdout).Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write the report: %v", err)
+	}
+
+	if report.Precision < cfg.MinPrecision || report.Recall < cfg.MinRecall {
+		log.Printf("❌ Precision %.3f or recall %.3f below the minimum %.3f and %.3f", report.Precision, report.Recall, cfg.MinPrecision, cfg.MinRecall)
+		os.Exit(1)
+	}
+}
+
+// incidentPage is a page of the database service's GET /db/incidents
+type incidentPage struct {
+	Incidents []struct {
+		ID        int64      `json:"id"`
+		Type      string     `json:"type"`
+		StartedAt time.Time  `json:"started_at"`
+		EndedAt   *time.Time `json:"ended_at"`
+	} `json:"incidents"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// readGroundTruth reads every incident overlapping [since, until], a page at
+// a time. Those that started before since are only kept so their detections
+// are not scored as false positives.
+func readGroundTruth(ctx context.Context, client *http.Client, baseURL string, since, until time.Time) ([]evaluation.Truth, error) {
+	var truths []evaluation.Truth
+	query := url.Values{"since": {since.Format(time.RFC3339)}, "until": {until.Format(time.RFC3339)}, "limit": {"500"}}
+	for {
+		var page incidentPage
+		if err := getJSON(ctx, client, baseURL+"/db/incidents?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+		for _, inc := range page.Incidents {
+			t := evaluation.Truth{ID: inc.ID, Type: inc.Type, StartedAt: inc.StartedAt}
+			if inc.EndedAt != nil {
+				t.EndedAt = *inc.EndedAt
+			}
+			truths = append(truths, t)
+		}
+		if page.NextCursor == "" {
+			return truths, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// readDetections reads the analyzer's newest incidents; Evaluate applies the
+// window
+func readDetections(ctx context.Context, client *http.Client, baseURL, service string, limit int) ([]evaluation.Detection, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if service != "" {
+		query.Set("service", service)
+	}
+	var resp struct {
+		Incidents []struct {
+			ID        string    `json:"id"`
+			Service   string    `json:"service"`
+			Type      string    `json:"type"`
+			StartedAt time.Time `json:"started_at"`
+		} `json:"incidents"`
+	}
+	if err := getJSON(ctx, client, baseURL+"/api/v1/incidents?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	var detections []evaluation.Detection
+	for _, inc := range resp.Incidents {
+		detections = append(detections, evaluation.Detection{ID: inc.ID, Service: inc.Service, Type: inc.Type, StartedAt: inc.StartedAt})
+	}
+	return detections, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+	}
+	return jsonx.NewDecoder(resp.Body).Decode(v)
+}
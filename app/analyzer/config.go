@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"analyzer-service/canary"
+	"analyzer-service/llm"
+	"analyzer-service/logcluster"
+	"analyzer-service/otlpreceiver"
+	"analyzer-service/remediation"
+	"analyzer-service/slo"
+	"analyzer-service/topology"
+	"analyzer-service/tracewatch"
+	"incident-simulation/pkg/config"
+)
+
+// Config is the analyzer service configuration
+type Config struct {
+	config.Telemetry
+	config.Audit
+	config.Profiling
+	config.Dev
+	config.AnomalyTuning
+	config.Correlation
+	llm.Config
+
+	ListenAddr   string `env:"LISTEN_ADDR" flag:"listen" default:":8084" usage:"HTTP listen address"`
+	IncidentDB   string `env:"INCIDENT_DB" flag:"incident-db" default:"incidents.db" usage:"BoltDB file holding incident records"`
+	MaxListLimit int    `env:"INCIDENT_LIST_MAX_LIMIT" flag:"incident-list-max-limit" default:"500" usage:"Most incidents returned by one list request"`
+	// AdminToken guards the endpoints that change runbooks or run remediations
+	AdminToken   string `env:"ANALYZER_ADMIN_TOKEN" flag:"admin-token" secret:"true" usage:"Bearer token required to edit runbooks and run remediations on demand; without one they need DEV_MODE"`
+	RunbooksFile string `env:"RUNBOOKS_FILE" flag:"runbooks-file" default:"runbooks.yaml" usage:"YAML runbooks attached to incidents by class; written on the first API edit (empty keeps edits in memory)"`
+
+	// Deployments recorded through POST /api/v1/deployments
+	DeployCorrelationWindow time.Duration `env:"DEPLOY_CORRELATION_WINDOW" flag:"deploy-correlation-window" default:"15m" usage:"Incidents starting this long after a deployment of their service name it as suspected (0 disables)"`
+
+	// Chat endpoint
+	PrometheusURL string        `env:"PROMETHEUS_URL" flag:"prometheus-url" default:"http://localhost:9090" usage:"Prometheus HTTP API queried for chat evidence (empty disables metrics)"`
+	LLMTimeout    time.Duration `env:"LLM_TIMEOUT" flag:"llm-timeout" default:"60s" usage:"Time limit for one chat answer"`
+	ChatWindow    time.Duration `env:"CHAT_WINDOW" flag:"chat-window" default:"15m" usage:"Evidence window when the question names no time"`
+
+	LogCluster  logcluster.Config
+	Traces      tracewatch.Config
+	Remediation remediation.Config
+	Canary      canary.Config
+	SLO         slo.Config
+	Topology    topology.Config
+	Receiver    otlpreceiver.Config
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.IncidentDB == "" {
+		errs = append(errs, errors.New("INCIDENT_DB must not be empty"))
+	}
+	if c.MaxListLimit <= 0 {
+		errs = append(errs, errors.New("INCIDENT_LIST_MAX_LIMIT must be positive"))
+	}
+	if c.LLMTimeout <= 0 || c.ChatWindow <= 0 {
+		errs = append(errs, errors.New("LLM_TIMEOUT and CHAT_WINDOW must be positive"))
+	}
+	if c.LogCluster.LogClusterEmbedder != "local" && c.LogCluster.LogClusterEmbedder != "llm" {
+		errs = append(errs, errors.New("LOG_CLUSTER_EMBEDDER must be local or llm"))
+	}
+	if c.Topology.TopologyInterval > 0 && c.Topology.TopologyWindow < time.Minute {
+		errs = append(errs, errors.New("TOPOLOGY_WINDOW must be at least 1m"))
+	}
+	if c.DeployCorrelationWindow < 0 {
+		errs = append(errs, errors.New("DEPLOY_CORRELATION_WINDOW must not be negative"))
+	}
+	if c.Remediation.RemediationTimeout <= 0 {
+		errs = append(errs, errors.New("REMEDIATION_TIMEOUT must be positive"))
+	}
+	if c.Canary.CanaryInterval > 0 {
+		if c.Canary.CanaryWindow < time.Minute || c.Canary.CanaryMinCalls < 1 {
+			errs = append(errs, errors.New("CANARY_ANALYSIS_WINDOW must be at least 1m and CANARY_MIN_CALLS at least 1"))
+		}
+		if c.Canary.CanaryMaxErrorRatio < 1 || c.Canary.CanaryMaxLatencyRatio < 1 {
+			errs = append(errs, errors.New("CANARY_MAX_ERROR_RATIO and CANARY_MAX_LATENCY_RATIO must be at least 1"))
+		}
+		if c.Canary.CanaryAlpha <= 0 || c.Canary.CanaryAlpha >= 1 {
+			errs = append(errs, errors.New("CANARY_ALPHA must be between 0 and 1"))
+		}
+	}
+	if c.SLO.SLOInterval > 0 {
+		if c.SLO.SLOObjective <= 0 || c.SLO.SLOObjective >= 1 {
+			errs = append(errs, errors.New("SLO_OBJECTIVE must be between 0 and 1"))
+		}
+		if c.SLO.SLOWindow < time.Minute || c.SLO.SLOService == "" {
+			errs = append(errs, errors.New("SLO_WINDOW must be at least 1m and SLO_SERVICE must not be empty"))
+		}
+		if c.SLO.SLOFreezeBelow >= 1 {
+			errs = append(errs, errors.New("SLO_FREEZE_BELOW must be below 1"))
+		}
+	}
+	errs = append(errs, c.Batching.Validate(), c.Sampling.Validate(), c.Logging.Validate())
+	return errors.Join(errs...)
+}
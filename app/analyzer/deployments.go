@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/deploy"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// recordDeployment stores a deployment event POSTed by pkg/deploy
+// (DEPLOY_EVENTS_URL); incidents of the same service opened within
+// DEPLOY_CORRELATION_WINDOW after it name it as their suspected deployment
+func (a *api) recordDeployment(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Record Deployment")
+	defer span.End()
+
+	var e deploy.Event
+	if err := jsonx.NewDecoder(r.Body).Decode(&e); err != nil || e.Service == "" || e.Version == "" {
+		writeError(w, r, http.StatusBadRequest, "service and version are required")
+		return
+	}
+	if e.Kind == "" {
+		e.Kind = deploy.KindDeploy
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	span.SetAttributes(
+		attribute.String("deployment.service", e.Service),
+		attrs.DeployKind(e.Kind),
+		attrs.DeployVersion(e.Version),
+	)
+
+	d := Deployment{Event: e}
+	if err := a.store.RecordDeployment(&d); err != nil {
+		span.SetStatus(codes.Error, "record failed")
+		logx.Errorw(ctx, "❌ Failed to record deployment", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to record deployment")
+		return
+	}
+	deploymentsRecorded.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("service", d.Service),
+		attribute.String("kind", d.Kind),
+	))
+	logx.Infow(ctx, "🚢 Deployment recorded", "deployment.id", d.ID, "deployment.service", d.Service,
+		"deploy.kind", d.Kind, "deploy.version", d.Version, "deploy.previous_version", d.PreviousVersion)
+	writeJSON(w, http.StatusCreated, d)
+}
+
+// listDeployments returns recorded deployments, newest first, optionally of
+// one ?service= and no older than ?since= (a Go duration such as 1h)
+func (a *api) listDeployments(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Deployments")
+	defer span.End()
+
+	q := r.URL.Query()
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, "since must be a positive duration such as 1h")
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, a.maxLimit)
+	}
+
+	deployments, err := a.store.Deployments(q.Get("service"), since, limit)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("deployment.count", len(deployments)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deployments": deployments})
+}
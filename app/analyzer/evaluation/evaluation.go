@@ -0,0 +1,260 @@
+// Package evaluation scores the analyzer's detections against the incidents
+// the simulator actually ran, the database service's GET /db/incidents.
+//
+// A detection matches the latest ground-truth incident it started during, or
+// within the grace period after it ended, since alerts fire on windows that
+// lag the fault. Both sides are scored by the same window rule: an incident
+// counts when it started in the window, and so does a detection, unless it
+// matches an incident that started before the window, which is left out
+// with it. Precision is the share of detections that match an incident,
+// recall the share of incidents matched by at least one detection, and the
+// detection latency of an incident is how long after its start the first
+// matching detection opened. The confusion matrix counts detections by the
+// incident type they matched ("none" for false positives) and their own type,
+// plus the incidents nothing detected in the "missed" column.
+package evaluation
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Row and column of the confusion matrix that have no incident or detection
+const (
+	None   = "none"
+	Missed = "missed"
+)
+
+// Truth is an incident the simulator ran. EndedAt is zero while it is active.
+type Truth struct {
+	ID        int64
+	Type      string
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// Detection is an incident the analyzer opened
+type Detection struct {
+	ID        string
+	Service   string
+	Type      string
+	StartedAt time.Time
+}
+
+// Latency summarizes detection latencies, in seconds
+type Latency struct {
+	Mean float64 `json:"mean_seconds"`
+	P50  float64 `json:"p50_seconds"`
+	P95  float64 `json:"p95_seconds"`
+	Max  float64 `json:"max_seconds"`
+}
+
+// TypeStats is the recall and latency of one incident type
+type TypeStats struct {
+	Incidents int     `json:"incidents"`
+	Detected  int     `json:"detected"`
+	Recall    float64 `json:"recall"`
+	Latency   Latency `json:"latency"`
+}
+
+// Report is the outcome of an evaluation
+type Report struct {
+	Since          time.Time                 `json:"since"`
+	Until          time.Time                 `json:"until"`
+	Incidents      int                       `json:"incidents"`
+	Detections     int                       `json:"detections"`
+	TruePositives  int                       `json:"true_positives"`
+	FalsePositives int                       `json:"false_positives"`
+	Missed         int                       `json:"missed"`
+	Precision      float64                   `json:"precision"`
+	Recall         float64                   `json:"recall"`
+	F1             float64                   `json:"f1"`
+	Latency        Latency                   `json:"latency"`
+	ByType         map[string]TypeStats      `json:"by_type"`
+	Confusion      map[string]map[string]int `json:"confusion"`
+}
+
+// Evaluate joins detections against truths over [since, until]; an incident
+// still active counts as ending at until. truths should include the incidents
+// overlapping since, so detections of them are not scored as false positives.
+func Evaluate(truths []Truth, detections []Detection, since, until time.Time, grace time.Duration) Report {
+	r := Report{Since: since, Until: until, ByType: map[string]TypeStats{}, Confusion: map[string]map[string]int{}}
+	truths = append([]Truth(nil), truths...)
+	sort.Slice(truths, func(i, j int) bool { return truths[i].StartedAt.Before(truths[j].StartedAt) })
+	inWindow := func(t time.Time) bool { return !t.Before(since) && !t.After(until) }
+
+	first := make([]time.Time, len(truths))
+	for _, d := range detections {
+		if !inWindow(d.StartedAt) {
+			continue
+		}
+		i := match(truths, d.StartedAt, until, grace)
+		if i >= 0 && !inWindow(truths[i].StartedAt) {
+			continue
+		}
+		r.Detections++
+		if i < 0 {
+			r.FalsePositives++
+			r.count(None, d.Type)
+			continue
+		}
+		r.TruePositives++
+		r.count(truths[i].Type, d.Type)
+		if first[i].IsZero() || d.StartedAt.Before(first[i]) {
+			first[i] = d.StartedAt
+		}
+	}
+
+	var all []float64
+	byType := map[string][]float64{}
+	for i, t := range truths {
+		if !inWindow(t.StartedAt) {
+			continue
+		}
+		r.Incidents++
+		stats := r.ByType[t.Type]
+		stats.Incidents++
+		if first[i].IsZero() {
+			r.Missed++
+			r.count(t.Type, Missed)
+		} else {
+			stats.Detected++
+			latency := max(first[i].Sub(t.StartedAt), 0).Seconds()
+			all = append(all, latency)
+			byType[t.Type] = append(byType[t.Type], latency)
+		}
+		r.ByType[t.Type] = stats
+	}
+	for typ, stats := range r.ByType {
+		stats.Recall = ratio(stats.Detected, stats.Incidents)
+		stats.Latency = summarize(byType[typ])
+		r.ByType[typ] = stats
+	}
+
+	r.Precision = ratio(r.TruePositives, r.Detections)
+	r.Recall = ratio(r.Incidents-r.Missed, r.Incidents)
+	if r.Precision+r.Recall > 0 {
+		r.F1 = 2 * r.Precision * r.Recall / (r.Precision + r.Recall)
+	}
+	r.Latency = summarize(all)
+	return r
+}
+
+// match returns the index of the latest truth at whose start or in whose
+// grace period at is, or -1
+func match(truths []Truth, at, until time.Time, grace time.Duration) int {
+	for i := len(truths) - 1; i >= 0; i-- {
+		t := truths[i]
+		if at.Before(t.StartedAt) {
+			continue
+		}
+		end := t.EndedAt
+		if end.IsZero() {
+			end = until
+		}
+		if !at.After(end.Add(grace)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Report) count(truth, detected string) {
+	if r.Confusion[truth] == nil {
+		r.Confusion[truth] = map[string]int{}
+	}
+	r.Confusion[truth][detected]++
+}
+
+func ratio(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
+
+func summarize(latencies []float64) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sorted := append([]float64(nil), latencies...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	return Latency{
+		Mean: sum / float64(len(sorted)),
+		P50:  quantile(sorted, 0.5),
+		P95:  quantile(sorted, 0.95),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// quantile is the nearest-rank q quantile of sorted
+func quantile(sorted []float64, q float64) float64 {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// WriteText writes the report as tables for a terminal
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Window\t%s to %s\n", r.Since.Format(time.RFC3339), r.Until.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Incidents\t%d (%d missed)\n", r.Incidents, r.Missed)
+	fmt.Fprintf(tw, "Detections\t%d (%d true, %d false positives)\n", r.Detections, r.TruePositives, r.FalsePositives)
+	fmt.Fprintf(tw, "Precision\t%.3f\n", r.Precision)
+	fmt.Fprintf(tw, "Recall\t%.3f\n", r.Recall)
+	fmt.Fprintf(tw, "F1\t%.3f\n", r.F1)
+	fmt.Fprintf(tw, "Detection latency\tmean %s  p50 %s  p95 %s  max %s\n",
+		seconds(r.Latency.Mean), seconds(r.Latency.P50), seconds(r.Latency.P95), seconds(r.Latency.Max))
+
+	fmt.Fprintln(tw, "\nIncident type\tIncidents\tDetected\tRecall\tMean latency\tp95 latency")
+	for _, typ := range sortedKeys(r.ByType) {
+		s := r.ByType[typ]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.3f\t%s\t%s\n", typ, s.Incidents, s.Detected, s.Recall, seconds(s.Latency.Mean), seconds(s.Latency.P95))
+	}
+
+	// Detected types as columns, missed incidents last
+	columns := map[string]bool{}
+	for _, row := range r.Confusion {
+		for col := range row {
+			if col != Missed {
+				columns[col] = true
+			}
+		}
+	}
+	cols := append(sortedKeys(columns), Missed)
+	fmt.Fprintf(tw, "\nIncident \\ detected\t%s\n", strings.Join(cols, "\t"))
+	rows := sortedKeys(r.Confusion)
+	// False positives go last too
+	if i := sort.SearchStrings(rows, None); i < len(rows) && rows[i] == None {
+		rows = append(append(rows[:i:i], rows[i+1:]...), None)
+	}
+	for _, row := range rows {
+		cells := make([]string, len(cols))
+		for i, col := range cols {
+			cells[i] = fmt.Sprint(r.Confusion[row][col])
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", row, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(100 * time.Millisecond).String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
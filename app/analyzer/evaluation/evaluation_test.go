@@ -0,0 +1,222 @@
+package evaluation
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	since = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until = since.Add(time.Hour)
+)
+
+// at is minutes after since
+func at(minutes float64) time.Time {
+	return since.Add(time.Duration(minutes * float64(time.Minute)))
+}
+
+func truth(id int64, typ string, start, end float64) Truth {
+	t := Truth{ID: id, Type: typ, StartedAt: at(start)}
+	if end >= 0 {
+		t.EndedAt = at(end)
+	}
+	return t
+}
+
+func detection(typ string, start float64) Detection {
+	return Detection{ID: "inc-" + typ, Service: "core-api-service", Type: typ, StartedAt: at(start)}
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		truths     []Truth
+		detections []Detection
+		grace      time.Duration
+		// Counts compared with the report
+		incidents, detected, tp, fp, missed int
+		confusion                           map[string]map[string]int
+	}{
+		{
+			name:       "detected during the incident",
+			truths:     []Truth{truth(1, "deadlock", 10, 20)},
+			detections: []Detection{detection("deadlock", 12)},
+			incidents:  1, detected: 1, tp: 1,
+			confusion: map[string]map[string]int{"deadlock": {"deadlock": 1}},
+		},
+		{
+			name:       "detected within the grace period",
+			truths:     []Truth{truth(1, "deadlock", 10, 20)},
+			detections: []Detection{detection("deadlock", 21)},
+			grace:      2 * time.Minute,
+			incidents:  1, detected: 1, tp: 1,
+			confusion: map[string]map[string]int{"deadlock": {"deadlock": 1}},
+		},
+		{
+			name:       "detected after the grace period",
+			truths:     []Truth{truth(1, "deadlock", 10, 20)},
+			detections: []Detection{detection("deadlock", 23)},
+			grace:      2 * time.Minute,
+			incidents:  1, detected: 1, fp: 1, missed: 1,
+			confusion: map[string]map[string]int{"deadlock": {Missed: 1}, None: {"deadlock": 1}},
+		},
+		{
+			name:       "detected before the incident",
+			truths:     []Truth{truth(1, "deadlock", 10, 20)},
+			detections: []Detection{detection("deadlock", 9)},
+			incidents:  1, detected: 1, fp: 1, missed: 1,
+			confusion: map[string]map[string]int{"deadlock": {Missed: 1}, None: {"deadlock": 1}},
+		},
+		{
+			name:       "active incident runs until the end of the window",
+			truths:     []Truth{truth(1, "high_latency", 50, -1)},
+			detections: []Detection{detection("high_latency", 59)},
+			incidents:  1, detected: 1, tp: 1,
+			confusion: map[string]map[string]int{"high_latency": {"high_latency": 1}},
+		},
+		{
+			name:       "overlapping incidents match the latest",
+			truths:     []Truth{truth(1, "deadlock", 10, 30), truth(2, "high_latency", 15, 25)},
+			detections: []Detection{detection("high_latency", 16), detection("deadlock", 27)},
+			incidents:  2, detected: 2, tp: 2,
+			confusion: map[string]map[string]int{"deadlock": {"deadlock": 1}, "high_latency": {"high_latency": 1}},
+		},
+		{
+			name:       "grace of the earlier incident inside the next",
+			truths:     []Truth{truth(1, "deadlock", 10, 20), truth(2, "disk_full", 21, 30)},
+			detections: []Detection{detection("deadlock", 21.5)},
+			grace:      2 * time.Minute,
+			incidents:  2, detected: 1, tp: 1, missed: 1,
+			confusion: map[string]map[string]int{"disk_full": {"deadlock": 1}, "deadlock": {Missed: 1}},
+		},
+		{
+			name:       "several detections of one incident",
+			truths:     []Truth{truth(1, "deadlock", 10, 20)},
+			detections: []Detection{detection("deadlock", 14), detection("pool_exhaustion", 12)},
+			incidents:  1, detected: 2, tp: 2,
+			confusion: map[string]map[string]int{"deadlock": {"deadlock": 1, "pool_exhaustion": 1}},
+		},
+		{
+			name:       "no incidents",
+			detections: []Detection{detection("deadlock", 5)},
+			detected:   1, fp: 1,
+			confusion: map[string]map[string]int{None: {"deadlock": 1}},
+		},
+		{
+			name:       "incident that started before the window is left out with its detections",
+			truths:     []Truth{truth(1, "deadlock", -10, 5), truth(2, "disk_full", 30, 40)},
+			detections: []Detection{detection("deadlock", -8), detection("deadlock", 3), detection("disk_full", 31)},
+			incidents:  1, detected: 1, tp: 1,
+			confusion: map[string]map[string]int{"disk_full": {"disk_full": 1}},
+		},
+		{
+			name:       "detection before the window of no incident",
+			detections: []Detection{detection("deadlock", -5)},
+			confusion:  map[string]map[string]int{},
+		},
+		{
+			name:       "incident and detection after the window",
+			truths:     []Truth{truth(1, "deadlock", 61, 70)},
+			detections: []Detection{detection("deadlock", 62)},
+			confusion:  map[string]map[string]int{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Evaluate(tc.truths, tc.detections, since, until, tc.grace)
+			if r.Incidents != tc.incidents || r.Detections != tc.detected || r.TruePositives != tc.tp || r.FalsePositives != tc.fp || r.Missed != tc.missed {
+				t.Errorf("incidents %d, detections %d, tp %d, fp %d, missed %d; want %d, %d, %d, %d, %d",
+					r.Incidents, r.Detections, r.TruePositives, r.FalsePositives, r.Missed,
+					tc.incidents, tc.detected, tc.tp, tc.fp, tc.missed)
+			}
+			if !equalConfusion(r.Confusion, tc.confusion) {
+				t.Errorf("confusion = %v, want %v", r.Confusion, tc.confusion)
+			}
+			if r.Precision < 0 || r.Precision > 1 || r.Recall < 0 || r.Recall > 1 {
+				t.Errorf("precision %g and recall %g out of range", r.Precision, r.Recall)
+			}
+		})
+	}
+}
+
+func equalConfusion(got, want map[string]map[string]int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for row, cols := range want {
+		if len(got[row]) != len(cols) {
+			return false
+		}
+		for col, n := range cols {
+			if got[row][col] != n {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestEvaluateScores(t *testing.T) {
+	truths := []Truth{
+		truth(1, "deadlock", 0, 10),
+		truth(2, "deadlock", 20, 30),
+		truth(3, "disk_full", 40, 50),
+		truth(4, "disk_full", 52, 55),
+	}
+	detections := []Detection{
+		detection("deadlock", 1),   // 60s after incident 1
+		detection("deadlock", 0.5), // 30s, the first of incident 1
+		detection("deadlock", 23),  // 180s after incident 2
+		detection("disk_full", 42), // 120s after incident 3
+		detection("deadlock", 35),  // false positive
+	}
+	r := Evaluate(truths, detections, since, until, time.Minute)
+
+	if r.TruePositives != 4 || r.FalsePositives != 1 || r.Missed != 1 {
+		t.Fatalf("tp %d, fp %d, missed %d; want 4, 1, 1", r.TruePositives, r.FalsePositives, r.Missed)
+	}
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"precision", r.Precision, 0.8},
+		{"recall", r.Recall, 0.75},
+		{"f1", r.F1, 2 * 0.8 * 0.75 / (0.8 + 0.75)},
+		{"mean latency", r.Latency.Mean, 110},
+		{"p50 latency", r.Latency.P50, 120},
+		{"p95 latency", r.Latency.P95, 180},
+		{"max latency", r.Latency.Max, 180},
+		{"deadlock recall", r.ByType["deadlock"].Recall, 1},
+		{"disk_full recall", r.ByType["disk_full"].Recall, 0.5},
+		{"disk_full mean latency", r.ByType["disk_full"].Latency.Mean, 120},
+	} {
+		if d := c.got - c.want; d > 1e-9 || d < -1e-9 {
+			t.Errorf("%s = %g, want %g", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	r := Evaluate([]Truth{truth(1, "deadlock", 0, 10), truth(2, "disk_full", 20, 30)},
+		[]Detection{detection("deadlock", 1), detection("deadlock", 40)}, since, until, 0)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	// Rows with their cells single-spaced
+	var rows []string
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		rows = append(rows, strings.Join(strings.Fields(line), " "))
+	}
+	for _, want := range []string{"Precision 0.500", "Recall 0.500", "Incident \\ detected deadlock missed", "disk_full 0 1"} {
+		if !slices.Contains(rows, want) {
+			t.Errorf("report has no row %q:\n%s", want, b.String())
+		}
+	}
+	// False positives are the last row
+	if last := rows[len(rows)-1]; last != None+" 1 0" {
+		t.Errorf("last row = %q, want %q", last, None+" 1 0")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"incident-simulation/pkg/correlation"
+	"incident-simulation/pkg/logx"
+)
+
+// chatService maps the words people use for a service to its telemetry name
+type chatService struct {
+	Name          string
+	Keywords      []string
+	IncidentGauge string
+}
+
+var chatServices = []chatService{
+	{Name: "core-api-service", Keywords: []string{"checkout", "transaction", "transfer", "core", "api", "cost", "spend", "tenant"}},
+	{Name: "database-service", Keywords: []string{"database", "db", "query", "queries", "pool"}, IncidentGauge: "db_incident_active"},
+	{Name: "payment-gateway", Keywords: []string{"payment", "card", "charge"}, IncidentGauge: "payment_incident_active"},
+	{Name: "auth-service", Keywords: []string{"auth", "login", "token", "session"}, IncidentGauge: "auth_incident_active"},
+	{Name: "worker-service", Keywords: []string{"worker", "outbox", "lag", "replication"}, IncidentGauge: "worker_incident_active"},
+}
+
+var (
+	atTimePattern     = regexp.MustCompile(`(?i)\b(?:at|around|near|about)\s+(\d{1,2}):(\d{2})\b`)
+	lastWindowPattern = regexp.MustCompile(`(?i)\b(?:last|past)\s+(\d+)\s*(m|mins?|minutes?|h|hrs?|hours?)\b`)
+	wordPattern       = regexp.MustCompile(`[a-z]+`)
+)
+
+// MetricSnapshot is one metric value quoted as evidence
+type MetricSnapshot struct {
+	Name    string  `json:"name"`
+	Service string  `json:"service"`
+	Query   string  `json:"query"`
+	Value   float64 `json:"value"`
+}
+
+// Evidence is the telemetry gathered to answer one question
+type Evidence struct {
+	Start       time.Time             `json:"start"`
+	End         time.Time             `json:"end"`
+	Services    []string              `json:"services"`
+	Metrics     []MetricSnapshot      `json:"metrics,omitempty"`
+	Suspects    []correlation.Suspect `json:"suspects,omitempty"`
+	Incidents   []Incident            `json:"incidents,omitempty"`
+	Deployments []Deployment          `json:"deployments,omitempty"`
+	Warnings    []string              `json:"warnings,omitempty"`
+}
+
+// evidenceGatherer pulls metrics from Prometheus, traces and logs through
+// pkg/correlation, and overlapping incidents and recent deployments from the
+// store
+type evidenceGatherer struct {
+	prom       *promClient
+	correlator *correlation.Correlator
+	store      *Store
+	window     time.Duration
+}
+
+// questionWindow reads "at 14:05" (centred on that minute, in local time) or
+// "last 30 minutes" from the question and falls back to the default window
+func questionWindow(question string, now time.Time, window time.Duration) (time.Time, time.Time) {
+	if m := atTimePattern.FindStringSubmatch(question); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 24 && minute < 60 {
+			at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+			if at.After(now) {
+				at = at.AddDate(0, 0, -1)
+			}
+			start, end := at.Add(-window/2), at.Add(window/2)
+			if end.After(now) {
+				end = now
+			}
+			return start, end
+		}
+	}
+	if m := lastWindowPattern.FindStringSubmatch(question); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := time.Minute
+		if strings.HasPrefix(strings.ToLower(m[2]), "h") {
+			unit = time.Hour
+		}
+		if n > 0 {
+			return now.Add(-time.Duration(n) * unit), now
+		}
+	}
+	return now.Add(-window), now
+}
+
+// questionServices returns the services the question mentions, or all of them
+func questionServices(question string) []chatService {
+	words := make(map[string]bool)
+	for _, w := range wordPattern.FindAllString(strings.ToLower(question), -1) {
+		words[w] = true
+	}
+	var out []chatService
+	for _, s := range chatServices {
+		for _, k := range s.Keywords {
+			if words[k] {
+				out = append(out, s)
+				break
+			}
+		}
+	}
+	if len(out) == 0 {
+		return chatServices
+	}
+	return out
+}
+
+func (g *evidenceGatherer) gather(ctx context.Context, question string, now time.Time) Evidence {
+	start, end := questionWindow(question, now, g.window)
+	services := questionServices(question)
+	ev := Evidence{Start: start, End: end}
+	for _, s := range services {
+		ev.Services = append(ev.Services, s.Name)
+	}
+
+	if g.prom != nil {
+		ev.Metrics = g.metrics(ctx, services, start, end, &ev.Warnings)
+	}
+
+	if g.correlator != nil {
+		report, err := g.correlator.Correlate(ctx, correlation.Anomaly{Start: start, End: end})
+		if err != nil {
+			ev.Warnings = append(ev.Warnings, err.Error())
+		}
+		ev.Warnings = append(ev.Warnings, report.Warnings...)
+		ev.Suspects = report.Suspects
+		if len(ev.Suspects) > 5 {
+			ev.Suspects = ev.Suspects[:5]
+		}
+	}
+
+	incidents, err := g.store.List(Filter{Limit: defaultListLimit})
+	if err != nil {
+		logx.Errorw(ctx, "❌ Failed to list incidents for chat", "error", err)
+		ev.Warnings = append(ev.Warnings, "incident store unavailable")
+	}
+	for _, inc := range incidents {
+		if inc.StartedAt.After(end) || (inc.ResolvedAt != nil && inc.ResolvedAt.Before(start)) {
+			continue
+		}
+		ev.Incidents = append(ev.Incidents, inc)
+	}
+
+	// A deployment shortly before the window can be what broke it
+	deployments, err := g.store.Deployments("", start.Add(-g.window), defaultListLimit)
+	if err != nil {
+		logx.Errorw(ctx, "❌ Failed to list deployments for chat", "error", err)
+		ev.Warnings = append(ev.Warnings, "deployment history unavailable")
+	}
+	for _, d := range deployments {
+		if !d.Time.After(end) {
+			ev.Deployments = append(ev.Deployments, d)
+		}
+	}
+	return ev
+}
+
+// metrics snapshots request rate, error ratio, p95 latency, request cost (in
+// total and for the three costliest tenants) and the simulator's incident
+// gauge of each service, averaged over the window
+func (g *evidenceGatherer) metrics(ctx context.Context, services []chatService, start, end time.Time, warnings *[]string) []MetricSnapshot {
+	rng := fmt.Sprintf("%ds", max(int(end.Sub(start).Seconds()), 60))
+
+	var out []MetricSnapshot
+	for _, s := range services {
+		queries := []struct{ name, expr string }{
+			{"request_rate", fmt.Sprintf(`sum(rate(http_server_responses_total{job=%q}[%s]))`, s.Name, rng)},
+			{"error_ratio", fmt.Sprintf(`sum(rate(http_server_responses_total{job=%q,status_class="5xx"}[%s])) / sum(rate(http_server_responses_total{job=%q}[%s]))`,
+				s.Name, rng, s.Name, rng)},
+			{"latency_p95_seconds", fmt.Sprintf(`histogram_quantile(0.95, sum by (le) (rate(http_server_request_duration_seconds_bucket{job=%q}[%s])))`, s.Name, rng)},
+			{"cost_rate", fmt.Sprintf(`sum(rate(request_cost_units_total{job=%q}[%s]))`, s.Name, rng)},
+			{"tenant_cost_rate", fmt.Sprintf(`topk(3, sum by (tenant) (rate(request_cost_units_total{job=%q}[%s])))`, s.Name, rng)},
+		}
+		if s.IncidentGauge != "" {
+			queries = append(queries, struct{ name, expr string }{s.IncidentGauge, fmt.Sprintf(`max(max_over_time(%s[%s]))`, s.IncidentGauge, rng)})
+		}
+
+		for _, q := range queries {
+			samples, err := g.prom.query(ctx, q.expr, end)
+			if err != nil {
+				*warnings = append(*warnings, fmt.Sprintf("%s %s: %v", s.Name, q.name, err))
+				continue
+			}
+			for _, smp := range samples {
+				name := q.name
+				if tenant := smp.Labels["tenant"]; tenant != "" {
+					name += "{tenant=" + tenant + "}"
+				}
+				out = append(out, MetricSnapshot{Name: name, Service: s.Name, Query: q.expr, Value: smp.Value})
+			}
+		}
+	}
+	return out
+}
+
+// prompt renders the evidence for the model, one citable fact per line
+func (ev Evidence) prompt() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Window: %s to %s\n", ev.Start.Format(time.RFC3339), ev.End.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Services: %s\n", strings.Join(ev.Services, ", "))
+
+	b.WriteString("\nMetrics (averaged over the window):\n")
+	if len(ev.Metrics) == 0 {
+		b.WriteString("- none available\n")
+	}
+	for _, m := range ev.Metrics {
+		fmt.Fprintf(&b, "- [metric:%s/%s] %.4g\n", m.Service, m.Name, m.Value)
+	}
+
+	b.WriteString("\nError suspects from traces and logs:\n")
+	if len(ev.Suspects) == 0 {
+		b.WriteString("- none found\n")
+	}
+	for _, s := range ev.Suspects {
+		fmt.Fprintf(&b, "- %s: score %.2f, %d error spans, %d error logs, avg error span %.0fms, operations %s\n",
+			s.Component, s.Score, s.ErrorSpans, s.ErrorLogs, s.AvgSpanDuration, strings.Join(s.Operations, ", "))
+		if len(s.FailingDependencies) > 0 {
+			fmt.Fprintf(&b, "  - calls failing %s\n", strings.Join(s.FailingDependencies, ", "))
+		}
+		for _, id := range s.ExemplarTraces {
+			fmt.Fprintf(&b, "  - [trace:%s]\n", id)
+		}
+		for _, c := range s.LogClusters {
+			fmt.Fprintf(&b, "  - log x%d: %s\n", c.Count, c.Template)
+		}
+	}
+
+	b.WriteString("\nIncidents overlapping the window:\n")
+	if len(ev.Incidents) == 0 {
+		b.WriteString("- none\n")
+	}
+	for _, inc := range ev.Incidents {
+		fmt.Fprintf(&b, "- [incident:%s] %s %s on %s (%s) started %s: %s\n",
+			inc.ID, inc.Severity, inc.Type, inc.Service, inc.Status, inc.StartedAt.Format(time.RFC3339), inc.Summary)
+		if d := inc.SuspectedDeployment; d != nil {
+			fmt.Fprintf(&b, "  - started %s after [deployment:%s] of %s\n",
+				inc.StartedAt.Sub(d.Time).Round(time.Second), d.ID, d.Version)
+		}
+	}
+
+	b.WriteString("\nDeployments during or shortly before the window:\n")
+	if len(ev.Deployments) == 0 {
+		b.WriteString("- none\n")
+	}
+	for _, d := range ev.Deployments {
+		fmt.Fprintf(&b, "- [deployment:%s] %s of %s %s (was %s) at %s\n",
+			d.ID, d.Kind, d.Service, d.Version, d.PreviousVersion, d.Time.Format(time.RFC3339))
+	}
+
+	for _, w := range ev.Warnings {
+		fmt.Fprintf(&b, "\nWarning: %s", w)
+	}
+	return b.String()
+}
+
+// sources lists the cited evidence after the answer so every reply carries
+// the trace IDs and metric values it was based on
+func (ev Evidence) sources() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\n---\nEvidence %s – %s\n", ev.Start.Format(time.RFC3339), ev.End.Format(time.RFC3339))
+	for _, m := range ev.Metrics {
+		fmt.Fprintf(&b, "- metric %s/%s = %.4g\n", m.Service, m.Name, m.Value)
+	}
+	for _, s := range ev.Suspects {
+		for _, id := range s.ExemplarTraces {
+			fmt.Fprintf(&b, "- trace %s (%s)\n", id, s.Component)
+		}
+	}
+	for _, inc := range ev.Incidents {
+		fmt.Fprintf(&b, "- incident %s (%s, %s)\n", inc.ID, inc.Type, inc.Status)
+	}
+	for _, d := range ev.Deployments {
+		fmt.Fprintf(&b, "- deployment %s (%s %s)\n", d.ID, d.Service, d.Version)
+	}
+	if len(ev.Metrics)+len(ev.Suspects)+len(ev.Incidents)+len(ev.Deployments) == 0 {
+		b.WriteString("- no telemetry found for this window\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// Anthropic is a client for the Anthropic Messages API. It has no embeddings
+// endpoint, so Embed returns ErrEmbeddingsUnsupported.
+type Anthropic struct {
+	BaseURL   string
+	APIKey    string
+	Model     string
+	MaxTokens int
+	Client    *http.Client
+}
+
+type anthropicRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature float64   `json:"temperature"`
+	Stream      bool      `json:"stream,omitempty"`
+}
+
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a *Anthropic) request(req Request, stream bool) anthropicRequest {
+	system, messages := split(req.Messages)
+	r := anthropicRequest{Model: req.Model, System: system, Messages: messages, MaxTokens: req.MaxTokens,
+		Temperature: req.Temperature, Stream: stream}
+	if r.Model == "" {
+		r.Model = a.Model
+	}
+	if r.MaxTokens == 0 {
+		r.MaxTokens = a.MaxTokens
+	}
+	return r
+}
+
+func (a *Anthropic) header() http.Header {
+	h := http.Header{}
+	h.Set("x-api-key", a.APIKey)
+	h.Set("anthropic-version", anthropicVersion)
+	return h
+}
+
+func (a *Anthropic) Complete(ctx context.Context, req Request) (string, error) {
+	var resp anthropicEvent
+	if err := postJSON(ctx, a.Client, a.BaseURL+"/v1/messages", a.header(), a.request(req, false), &resp); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, c := range resp.Content {
+		if c.Type == "text" {
+			b.WriteString(c.Text)
+		}
+	}
+	return b.String(), nil
+}
+
+func (a *Anthropic) Stream(ctx context.Context, req Request, onDelta func(string) error) error {
+	h := a.header()
+	h.Set("Accept", "text/event-stream")
+	resp, err := post(ctx, a.Client, a.BaseURL+"/v1/messages", h, a.request(req, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readEvents(resp.Body, func(data string) (bool, error) {
+		var ev anthropicEvent
+		if err := jsonx.Unmarshal([]byte(data), &ev); err != nil {
+			return false, fmt.Errorf("decode llm stream: %w", err)
+		}
+		switch ev.Type {
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" && ev.Delta.Text != "" {
+				return false, onDelta(ev.Delta.Text)
+			}
+		case "message_stop":
+			return true, nil
+		case "error":
+			return false, fmt.Errorf("llm stream error %s: %s", ev.Error.Type, ev.Error.Message)
+		}
+		return false, nil
+	})
+}
+
+func (a *Anthropic) Embed(context.Context, []string) ([][]float64, error) {
+	return nil, ErrEmbeddingsUnsupported
+}
@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"time"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// Bedrock is a client for the AWS Bedrock Converse API, signed with SigV4 so
+// no AWS SDK is needed. Embeddings use the Titan text embedding models.
+type Bedrock struct {
+	BaseURL     string
+	Region      string
+	Model       string
+	EmbedModel  string
+	MaxTokens   int
+	Credentials Credentials
+	Client      *http.Client
+}
+
+type bedrockContent struct {
+	Text string `json:"text"`
+}
+
+type bedrockMessage struct {
+	Role    string           `json:"role"`
+	Content []bedrockContent `json:"content"`
+}
+
+type bedrockRequest struct {
+	Messages        []bedrockMessage `json:"messages"`
+	System          []bedrockContent `json:"system,omitempty"`
+	InferenceConfig struct {
+		MaxTokens   int     `json:"maxTokens"`
+		Temperature float64 `json:"temperature"`
+	} `json:"inferenceConfig"`
+}
+
+func (b *Bedrock) request(req Request) (string, bedrockRequest) {
+	model := req.Model
+	if model == "" {
+		model = b.Model
+	}
+	system, messages := split(req.Messages)
+
+	var r bedrockRequest
+	if system != "" {
+		r.System = []bedrockContent{{Text: system}}
+	}
+	for _, m := range messages {
+		r.Messages = append(r.Messages, bedrockMessage{Role: m.Role, Content: []bedrockContent{{Text: m.Content}}})
+	}
+	r.InferenceConfig.MaxTokens, r.InferenceConfig.Temperature = req.MaxTokens, req.Temperature
+	if r.InferenceConfig.MaxTokens == 0 {
+		r.InferenceConfig.MaxTokens = b.MaxTokens
+	}
+	return model, r
+}
+
+// do signs and sends a POST to /model/{model}/{action}
+func (b *Bedrock) do(ctx context.Context, model, action string, body interface{}) (*http.Response, error) {
+	data, err := jsonx.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		b.BaseURL+"/model/"+awsEscape(model)+"/"+action, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	b.Credentials.sign(req, data, b.Region, "bedrock", time.Now())
+	return send(b.Client, req)
+}
+
+func (b *Bedrock) Complete(ctx context.Context, req Request) (string, error) {
+	model, body := b.request(req)
+	resp, err := b.do(ctx, model, "converse", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Output struct {
+			Message bedrockMessage `json:"message"`
+		} `json:"output"`
+	}
+	if err := jsonx.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode llm response: %w", err)
+	}
+	var text string
+	for _, c := range out.Output.Message.Content {
+		text += c.Text
+	}
+	return text, nil
+}
+
+// Stream reads the binary event stream of /converse-stream
+func (b *Bedrock) Stream(ctx context.Context, req Request, onDelta func(string) error) error {
+	model, body := b.request(req)
+	resp, err := b.do(ctx, model, "converse-stream", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	for {
+		headers, payload, err := readEventStreamMessage(resp.Body)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read llm stream: %w", err)
+		}
+		if headers[":message-type"] == "exception" {
+			var e struct {
+				Message string `json:"message"`
+			}
+			jsonx.Unmarshal(payload, &e)
+			return fmt.Errorf("llm stream error %s: %s", headers[":exception-type"], e.Message)
+		}
+
+		switch headers[":event-type"] {
+		case "contentBlockDelta":
+			var ev struct {
+				Delta struct {
+					Text string `json:"text"`
+				} `json:"delta"`
+			}
+			if err := jsonx.Unmarshal(payload, &ev); err != nil {
+				return fmt.Errorf("decode llm stream: %w", err)
+			}
+			if ev.Delta.Text != "" {
+				if err := onDelta(ev.Delta.Text); err != nil {
+					return err
+				}
+			}
+		case "messageStop":
+			return nil
+		}
+	}
+}
+
+// Embed calls the Titan embedding model once per text
+func (b *Bedrock) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, 0, len(texts))
+	for _, text := range texts {
+		resp, err := b.do(ctx, b.EmbedModel, "invoke", map[string]string{"inputText": text})
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Embedding []float64 `json:"embedding"`
+		}
+		err = jsonx.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode llm response: %w", err)
+		}
+		out = append(out, body.Embedding)
+	}
+	return out, nil
+}
+
+// readEventStreamMessage decodes one application/vnd.amazon.eventstream
+// message: a prelude with the total and header lengths, the headers, the
+// payload and a CRC32 over everything before it. Only string headers are kept.
+func readEventStreamMessage(r io.Reader) (map[string]string, []byte, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(r, prelude[:]); err != nil {
+		return nil, nil, err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, nil, errors.New("event stream prelude checksum mismatch")
+	}
+	if total < 16+headersLen || total > 16<<20 {
+		return nil, nil, fmt.Errorf("event stream message of %d bytes is malformed", total)
+	}
+
+	msg := make([]byte, total-12)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, nil, err
+	}
+	body, sum := msg[:len(msg)-4], binary.BigEndian.Uint32(msg[len(msg)-4:])
+	if crc32.Update(crc32.ChecksumIEEE(prelude[:]), crc32.IEEETable, body) != sum {
+		return nil, nil, errors.New("event stream message checksum mismatch")
+	}
+
+	headers := make(map[string]string)
+	h := body[:headersLen]
+	for len(h) > 0 {
+		n := int(h[0])
+		if len(h) < 2+n {
+			return nil, nil, errors.New("event stream header is truncated")
+		}
+		name, kind := string(h[1:1+n]), h[1+n]
+		h = h[2+n:]
+
+		var size int
+		switch kind {
+		case 0, 1: // bool true/false
+		case 2:
+			size = 1
+		case 3:
+			size = 2
+		case 4:
+			size = 4
+		case 5, 8: // int64, timestamp
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7: // bytes, string
+			if len(h) < 2 {
+				return nil, nil, errors.New("event stream header is truncated")
+			}
+			l := int(binary.BigEndian.Uint16(h))
+			h = h[2:]
+			if len(h) < l {
+				return nil, nil, errors.New("event stream header is truncated")
+			}
+			if kind == 7 {
+				headers[name] = string(h[:l])
+			}
+			size = l
+		default:
+			return nil, nil, fmt.Errorf("event stream header type %d is unknown", kind)
+		}
+		if len(h) < size {
+			return nil, nil, errors.New("event stream header is truncated")
+		}
+		h = h[size:]
+	}
+	return headers, body[headersLen:], nil
+}
@@ -0,0 +1,210 @@
+// Package llm talks to the language models behind the analyzer's AI features.
+//
+// Provider hides the vendor: OpenAI-compatible HTTP APIs, Anthropic, a local
+// Ollama and AWS Bedrock all implement it, and New picks one from Config, so
+// the same features run against a cloud API or fully air-gapped.
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// Providers selectable with LLM_PROVIDER
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+	ProviderBedrock   = "bedrock"
+)
+
+// ErrEmbeddingsUnsupported is returned by providers without an embeddings API
+var ErrEmbeddingsUnsupported = errors.New("llm: provider has no embeddings API")
+
+// Message is one chat turn; Role is system, user or assistant
+type Message struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+// Request is a chat completion request; an empty Model uses the configured one
+type Request struct {
+	Model       string
+	Messages    []Message
+	Temperature float64
+	MaxTokens   int
+}
+
+// Provider is a chat and embedding model backend
+type Provider interface {
+	// Complete returns the whole answer
+	Complete(ctx context.Context, req Request) (string, error)
+	// Stream calls onDelta with every content fragment as it arrives; an
+	// error from onDelta stops the stream
+	Stream(ctx context.Context, req Request, onDelta func(string) error) error
+	// Embed returns one vector per input text
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// Config selects and configures the provider
+type Config struct {
+	LLMProvider   string `env:"LLM_PROVIDER" flag:"llm-provider" default:"openai" usage:"LLM backend: openai (any OpenAI-compatible API), anthropic, ollama or bedrock"`
+	LLMBaseURL    string `env:"LLM_BASE_URL" flag:"llm-base-url" usage:"API base URL (default: the provider's public endpoint, or http://localhost:11434 for ollama)"`
+	LLMAPIKey     string `env:"LLM_API_KEY" flag:"llm-api-key" secret:"true" usage:"API key for openai and anthropic"`
+	LLMModel      string `env:"LLM_MODEL" flag:"llm-model" usage:"Chat model used when a request does not name one (default per provider)"`
+	LLMEmbedModel string `env:"LLM_EMBED_MODEL" flag:"llm-embed-model" usage:"Embedding model (default per provider)"`
+	LLMMaxTokens  int    `env:"LLM_MAX_TOKENS" flag:"llm-max-tokens" default:"1024" usage:"Answer length limit when a request sets none"`
+
+	AWSRegion          string `env:"AWS_REGION" flag:"aws-region" default:"us-east-1" usage:"Bedrock region"`
+	AWSAccessKeyID     string `env:"AWS_ACCESS_KEY_ID" flag:"aws-access-key-id" usage:"Bedrock access key"`
+	AWSSecretAccessKey string `env:"AWS_SECRET_ACCESS_KEY" flag:"aws-secret-access-key" secret:"true" usage:"Bedrock secret key"`
+	AWSSessionToken    string `env:"AWS_SESSION_TOKEN" flag:"aws-session-token" secret:"true" usage:"Bedrock session token for temporary credentials"`
+}
+
+// Per-provider defaults: base URL, chat model, embedding model
+var defaults = map[string][3]string{
+	ProviderOpenAI:    {"https://api.openai.com/v1", "gpt-4o-mini", "text-embedding-3-small"},
+	ProviderAnthropic: {"https://api.anthropic.com", "claude-3-5-haiku-latest", ""},
+	ProviderOllama:    {"http://localhost:11434", "llama3.1", "nomic-embed-text"},
+	ProviderBedrock:   {"", "anthropic.claude-3-5-haiku-20241022-v1:0", "amazon.titan-embed-text-v2:0"},
+}
+
+// WithDefaults fills the base URL and models the provider needs
+func (c Config) WithDefaults() Config {
+	d := defaults[c.LLMProvider]
+	if c.LLMBaseURL == "" {
+		c.LLMBaseURL = d[0]
+		if c.LLMProvider == ProviderBedrock {
+			c.LLMBaseURL = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", c.AWSRegion)
+		}
+	}
+	if c.LLMModel == "" {
+		c.LLMModel = d[1]
+	}
+	if c.LLMEmbedModel == "" {
+		c.LLMEmbedModel = d[2]
+	}
+	return c
+}
+
+// New returns the configured provider
+func New(cfg Config, client *http.Client) (Provider, error) {
+	cfg = cfg.WithDefaults()
+	if cfg.LLMMaxTokens <= 0 {
+		return nil, errors.New("LLM_MAX_TOKENS must be positive")
+	}
+	base := strings.TrimSuffix(cfg.LLMBaseURL, "/")
+
+	switch cfg.LLMProvider {
+	case ProviderOpenAI:
+		return &OpenAI{BaseURL: base, APIKey: cfg.LLMAPIKey, Model: cfg.LLMModel, EmbedModel: cfg.LLMEmbedModel,
+			MaxTokens: cfg.LLMMaxTokens, Client: client}, nil
+	case ProviderAnthropic:
+		if cfg.LLMAPIKey == "" {
+			return nil, errors.New("LLM_API_KEY is required for the anthropic provider")
+		}
+		return &Anthropic{BaseURL: base, APIKey: cfg.LLMAPIKey, Model: cfg.LLMModel,
+			MaxTokens: cfg.LLMMaxTokens, Client: client}, nil
+	case ProviderOllama:
+		return &Ollama{BaseURL: base, Model: cfg.LLMModel, EmbedModel: cfg.LLMEmbedModel,
+			MaxTokens: cfg.LLMMaxTokens, Client: client}, nil
+	case ProviderBedrock:
+		if cfg.AWSAccessKeyID == "" || cfg.AWSSecretAccessKey == "" {
+			return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for the bedrock provider")
+		}
+		return &Bedrock{BaseURL: base, Region: cfg.AWSRegion, Model: cfg.LLMModel, EmbedModel: cfg.LLMEmbedModel,
+			MaxTokens: cfg.LLMMaxTokens, Client: client,
+			Credentials: Credentials{AccessKeyID: cfg.AWSAccessKeyID, SecretAccessKey: cfg.AWSSecretAccessKey, SessionToken: cfg.AWSSessionToken},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q (want openai, anthropic, ollama or bedrock)", cfg.LLMProvider)
+	}
+}
+
+// split separates system messages, which Anthropic and Bedrock take apart
+// from the conversation
+func split(messages []Message) (string, []Message) {
+	var system []string
+	var rest []Message
+	for _, m := range messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		rest = append(rest, m)
+	}
+	return strings.Join(system, "\n\n"), rest
+}
+
+// post sends body as JSON and returns the response when it is 200 OK
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body interface{}) (*http.Response, error) {
+	data, err := jsonx.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(client, req)
+}
+
+// send turns any status other than 200 OK into an error carrying the body
+func send(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("llm request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("llm returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// postJSON sends body and decodes the JSON response into out
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body, out interface{}) error {
+	resp, err := post(ctx, client, url, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := jsonx.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode llm response: %w", err)
+	}
+	return nil
+}
+
+// readEvents calls fn with the data of every server-sent event in r until fn
+// reports done
+func readEvents(r io.Reader, fn func(data string) (done bool, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		done, err := fn(strings.TrimSpace(data))
+		if err != nil || done {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read llm stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// Ollama is a client for the native API of a local Ollama server, for
+// air-gapped setups where no hosted model is reachable
+type Ollama struct {
+	BaseURL    string
+	Model      string
+	EmbedModel string
+	MaxTokens  int
+	Client     *http.Client
+}
+
+type ollamaRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	Options  struct {
+		Temperature float64 `json:"temperature"`
+		NumPredict  int     `json:"num_predict"`
+	} `json:"options"`
+}
+
+type ollamaResponse struct {
+	Message Message `json:"message"`
+	Done    bool    `json:"done"`
+	Error   string  `json:"error"`
+}
+
+func (o *Ollama) request(req Request, stream bool) ollamaRequest {
+	r := ollamaRequest{Model: req.Model, Messages: req.Messages, Stream: stream}
+	if r.Model == "" {
+		r.Model = o.Model
+	}
+	r.Options.Temperature, r.Options.NumPredict = req.Temperature, req.MaxTokens
+	if r.Options.NumPredict == 0 {
+		r.Options.NumPredict = o.MaxTokens
+	}
+	return r
+}
+
+func (o *Ollama) Complete(ctx context.Context, req Request) (string, error) {
+	var resp ollamaResponse
+	if err := postJSON(ctx, o.Client, o.BaseURL+"/api/chat", nil, o.request(req, false), &resp); err != nil {
+		return "", err
+	}
+	return resp.Message.Content, nil
+}
+
+// Stream reads the newline-delimited JSON that /api/chat streams
+func (o *Ollama) Stream(ctx context.Context, req Request, onDelta func(string) error) error {
+	resp, err := post(ctx, o.Client, o.BaseURL+"/api/chat", nil, o.request(req, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var chunk ollamaResponse
+		if err := jsonx.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return fmt.Errorf("decode llm stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("llm stream error: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			if err := onDelta(chunk.Message.Content); err != nil {
+				return err
+			}
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read llm stream: %w", err)
+	}
+	return nil
+}
+
+func (o *Ollama) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	var resp struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	body := map[string]interface{}{"model": o.EmbedModel, "input": texts}
+	if err := postJSON(ctx, o.Client, o.BaseURL+"/api/embed", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("llm returned %d embeddings for %d inputs", len(resp.Embeddings), len(texts))
+	}
+	return resp.Embeddings, nil
+}
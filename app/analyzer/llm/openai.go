@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// OpenAI is a client for OpenAI-compatible APIs (OpenAI, Azure OpenAI, vLLM,
+// LM Studio, Ollama's /v1 and most gateways)
+type OpenAI struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	EmbedModel string
+	MaxTokens  int
+	Client     *http.Client
+}
+
+type openAIRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream"`
+	Temperature float64   `json:"temperature"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+		Delta   Message `json:"delta"`
+	} `json:"choices"`
+}
+
+func (o *OpenAI) request(req Request, stream bool) openAIRequest {
+	r := openAIRequest{Model: req.Model, Messages: req.Messages, Stream: stream, Temperature: req.Temperature, MaxTokens: req.MaxTokens}
+	if r.Model == "" {
+		r.Model = o.Model
+	}
+	if r.MaxTokens == 0 {
+		r.MaxTokens = o.MaxTokens
+	}
+	return r
+}
+
+func (o *OpenAI) header() http.Header {
+	h := http.Header{}
+	if o.APIKey != "" {
+		h.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	return h
+}
+
+func (o *OpenAI) Complete(ctx context.Context, req Request) (string, error) {
+	var resp openAIResponse
+	if err := postJSON(ctx, o.Client, o.BaseURL+"/chat/completions", o.header(), o.request(req, false), &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("llm returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (o *OpenAI) Stream(ctx context.Context, req Request, onDelta func(string) error) error {
+	h := o.header()
+	h.Set("Accept", "text/event-stream")
+	resp, err := post(ctx, o.Client, o.BaseURL+"/chat/completions", h, o.request(req, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readEvents(resp.Body, func(data string) (bool, error) {
+		if data == "[DONE]" {
+			return true, nil
+		}
+		var chunk openAIResponse
+		if err := jsonx.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("decode llm stream: %w", err)
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content == "" {
+				continue
+			}
+			if err := onDelta(c.Delta.Content); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+}
+
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	body := map[string]interface{}{"model": o.EmbedModel, "input": texts}
+	if err := postJSON(ctx, o.Client, o.BaseURL+"/embeddings", o.header(), body, &resp); err != nil {
+		return nil, err
+	}
+
+	out := make([][]float64, len(texts))
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(out) {
+			out[d.Index] = d.Embedding
+		}
+	}
+	return out, nil
+}
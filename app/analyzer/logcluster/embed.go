@@ -0,0 +1,82 @@
+package logcluster
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Embedder turns log templates into vectors; llm.Provider satisfies it
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// HashEmbedder embeds text locally by hashing its words and word pairs into a
+// fixed number of dimensions. It needs no model or network, so clustering
+// works air-gapped; a provider model groups paraphrased messages better.
+type HashEmbedder struct {
+	Dims int
+}
+
+func (h HashEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	dims := h.Dims
+	if dims <= 0 {
+		dims = 256
+	}
+
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		v := make([]float64, dims)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '<' && r != '>' && r != '_'
+		})
+		for j, w := range words {
+			add(v, w, 1)
+			if j > 0 {
+				add(v, words[j-1]+" "+w, 0.5)
+			}
+		}
+		out[i] = normalize(v)
+	}
+	return out, nil
+}
+
+// add hashes a feature to a dimension and a sign so collisions cancel out
+func add(v []float64, feature string, weight float64) {
+	f := fnv.New64a()
+	f.Write([]byte(feature))
+	sum := f.Sum64()
+	if sum&1 == 1 {
+		weight = -weight
+	}
+	v[(sum>>1)%uint64(len(v))] += weight
+}
+
+func normalize(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// cosine of two normalised vectors
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
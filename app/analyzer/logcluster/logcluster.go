@@ -0,0 +1,417 @@
+// Package logcluster groups error log messages by meaning and reports new
+// failure signatures.
+//
+// Each poll reads the error logs written since the previous one, reduces them
+// to message templates, embeds every template not seen before and assigns it
+// to the closest cluster by cosine similarity, or starts a new cluster. A
+// cluster that appears after the warmup raises a novel event, and one whose
+// per-poll volume jumps above its EWMA baseline raises a spike event. Both
+// resolve once the cluster goes quiet again.
+package logcluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"incident-simulation/pkg/correlation"
+	"incident-simulation/pkg/jsonx"
+)
+
+// Event kinds and states
+const (
+	KindNovel = "novel"
+	KindSpike = "spike"
+
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Templates remembered for lookup without embedding; beyond this new
+// templates are embedded on every poll
+const maxTemplates = 5000
+
+// Config tunes clustering and event detection
+type Config struct {
+	LogClusterInterval    time.Duration `env:"LOG_CLUSTER_INTERVAL" flag:"log-cluster-interval" default:"30s" usage:"How often error logs are clustered (0 disables)"`
+	LogClusterEmbedder    string        `env:"LOG_CLUSTER_EMBEDDER" flag:"log-cluster-embedder" default:"local" usage:"local (hashed words, offline) or llm (the LLM_PROVIDER embedding model)"`
+	LogClusterThreshold   float64       `env:"LOG_CLUSTER_THRESHOLD" flag:"log-cluster-threshold" default:"0.8" usage:"Cosine similarity needed to join an existing cluster"`
+	LogClusterWarmup      int           `env:"LOG_CLUSTER_WARMUP" flag:"log-cluster-warmup" default:"10" usage:"Polls before new clusters count as novel"`
+	LogClusterAlpha       float64       `env:"LOG_CLUSTER_ALPHA" flag:"log-cluster-alpha" default:"0.1" usage:"EWMA smoothing of each cluster's volume per poll"`
+	LogClusterSpikeFactor float64       `env:"LOG_CLUSTER_SPIKE_FACTOR" flag:"log-cluster-spike-factor" default:"4" usage:"Standard deviations above the baseline volume that count as a spike"`
+	LogClusterMinSpike    int           `env:"LOG_CLUSTER_MIN_SPIKE" flag:"log-cluster-min-spike" default:"20" usage:"Fewest lines in one poll that can be a spike"`
+	LogClusterStateFile   string        `env:"LOG_CLUSTER_STATE_FILE" flag:"log-cluster-state-file" default:"log-clusters.json" usage:"Persists clusters across restarts (empty keeps them in memory)"`
+}
+
+func (c Config) validate() error {
+	var errs []error
+	if c.LogClusterThreshold <= 0 || c.LogClusterThreshold >= 1 {
+		errs = append(errs, errors.New("LOG_CLUSTER_THRESHOLD must be between 0 and 1"))
+	}
+	if c.LogClusterAlpha <= 0 || c.LogClusterAlpha > 1 {
+		errs = append(errs, errors.New("LOG_CLUSTER_ALPHA must be in (0, 1]"))
+	}
+	if c.LogClusterSpikeFactor <= 0 || c.LogClusterMinSpike <= 0 || c.LogClusterWarmup < 0 {
+		errs = append(errs, errors.New("LOG_CLUSTER_SPIKE_FACTOR and LOG_CLUSTER_MIN_SPIKE must be positive, LOG_CLUSTER_WARMUP not negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Cluster is a group of similar error messages
+type Cluster struct {
+	ID        string         `json:"id"`
+	Template  string         `json:"template"` // first template, the cluster's name
+	Example   string         `json:"example"`
+	Templates int            `json:"templates"`
+	Services  map[string]int `json:"services"`
+	Count     int64          `json:"count"`
+	TraceIDs  []string       `json:"trace_ids,omitempty"`
+	FirstSeen time.Time      `json:"first_seen"`
+	LastSeen  time.Time      `json:"last_seen"`
+	// Mean and Variance of the lines per poll
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"`
+	Centroid []float64 `json:"centroid,omitempty"`
+}
+
+// Service is the service that logged most of the cluster
+func (c Cluster) Service() string {
+	var best string
+	for s, n := range c.Services {
+		if n > c.Services[best] || (n == c.Services[best] && s < best) {
+			best = s
+		}
+	}
+	return best
+}
+
+// Event reports a novel cluster or a volume spike starting or ending
+type Event struct {
+	Kind     string    `json:"kind"`
+	State    string    `json:"state"`
+	Time     time.Time `json:"time"`
+	Cluster  Cluster   `json:"cluster"`
+	Count    int       `json:"count"`    // lines in this poll
+	Expected float64   `json:"expected"` // baseline lines per poll
+}
+
+type state struct {
+	Embedder  string            `json:"embedder"`
+	Polls     int               `json:"polls"`
+	Clusters  []*Cluster        `json:"clusters"`
+	Templates map[string]string `json:"templates"` // template -> cluster ID
+}
+
+// Clusterer keeps the clusters and raises events through onEvent
+type Clusterer struct {
+	cfg          Config
+	embedder     Embedder
+	embedderName string
+	onEvent      func(context.Context, Event)
+
+	mu        sync.Mutex
+	polls     int
+	clusters  map[string]*Cluster
+	templates map[string]string
+	active    map[string]bool // kind/cluster ID of firing events
+	seq       int
+}
+
+// New returns a Clusterer and restores cfg.LogClusterStateFile if it was
+// written with the same embedder
+func New(cfg Config, embedder Embedder, embedderName string, onEvent func(context.Context, Event)) (*Clusterer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	c := &Clusterer{
+		cfg:          cfg,
+		embedder:     embedder,
+		embedderName: embedderName,
+		onEvent:      onEvent,
+		clusters:     make(map[string]*Cluster),
+		templates:    make(map[string]string),
+		active:       make(map[string]bool),
+	}
+	if cfg.LogClusterStateFile == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(cfg.LogClusterStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read log clusters: %w", err)
+	}
+	var saved state
+	if err := jsonx.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse log clusters %s: %w", cfg.LogClusterStateFile, err)
+	}
+	if saved.Embedder != embedderName {
+		log.Printf("Log clusters in %s were built with %q, starting over with %q", cfg.LogClusterStateFile, saved.Embedder, embedderName)
+		return c, nil
+	}
+	c.polls = saved.Polls
+	for _, cl := range saved.Clusters {
+		c.clusters[cl.ID] = cl
+		c.seq++
+	}
+	for t, id := range saved.Templates {
+		if c.clusters[id] != nil {
+			c.templates[t] = id
+		}
+	}
+	return c, nil
+}
+
+// Observe clusters one poll's error lines and returns the events it raised
+func (c *Clusterer) Observe(ctx context.Context, lines []correlation.LogLine, now time.Time) ([]Event, error) {
+	byTemplate := make(map[string][]correlation.LogLine)
+	for _, l := range lines {
+		t := correlation.Template(l.Message)
+		byTemplate[t] = append(byTemplate[t], l)
+	}
+
+	c.mu.Lock()
+	var unknown []string
+	for t := range byTemplate {
+		if _, ok := c.templates[t]; !ok {
+			unknown = append(unknown, t)
+		}
+	}
+	c.mu.Unlock()
+	sort.Strings(unknown)
+
+	// Embedding may call a remote model, so it runs outside the lock
+	var vectors [][]float64
+	if len(unknown) > 0 {
+		var err error
+		if vectors, err = c.embedder.Embed(ctx, unknown); err != nil {
+			return nil, fmt.Errorf("embed log templates: %w", err)
+		}
+		if len(vectors) != len(unknown) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d templates", len(vectors), len(unknown))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.polls++
+	warm := c.polls > c.cfg.LogClusterWarmup
+
+	var events []Event
+	novel := make(map[string]bool)
+	assigned := make(map[string]string, len(unknown)) // also past maxTemplates
+	for i, t := range unknown {
+		cl, created := c.assign(t, normalize(vectors[i]), byTemplate[t][0], now)
+		assigned[t] = cl.ID
+		if created && warm {
+			novel[cl.ID] = true
+		}
+	}
+
+	counts := make(map[string]int)
+	for t, ls := range byTemplate {
+		id, ok := c.templates[t]
+		if !ok {
+			id = assigned[t]
+		}
+		cl := c.clusters[id]
+		if cl == nil {
+			continue
+		}
+		counts[id] += len(ls)
+		cl.Count += int64(len(ls))
+		cl.LastSeen = now
+		for _, l := range ls {
+			cl.Services[l.Service]++
+			if l.TraceID != "" && len(cl.TraceIDs) < 5 && !slices.Contains(cl.TraceIDs, l.TraceID) {
+				cl.TraceIDs = append(cl.TraceIDs, l.TraceID)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(c.clusters))
+	for id := range c.clusters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		cl, n := c.clusters[id], counts[id]
+		expected := cl.Mean
+		std := math.Max(math.Sqrt(cl.Variance), math.Sqrt(math.Max(cl.Mean, 1)))
+		spiking := warm && !novel[id] && n >= c.cfg.LogClusterMinSpike && float64(n) > cl.Mean+c.cfg.LogClusterSpikeFactor*std
+
+		events = append(events, c.transition(KindNovel, cl, novel[id], n > 0, n, expected, now)...)
+		events = append(events, c.transition(KindSpike, cl, spiking, spiking, n, expected, now)...)
+
+		// Spikes stay out of the baseline so a long one keeps firing
+		if !spiking {
+			diff := float64(n) - cl.Mean
+			cl.Mean += c.cfg.LogClusterAlpha * diff
+			cl.Variance = (1 - c.cfg.LogClusterAlpha) * (cl.Variance + c.cfg.LogClusterAlpha*diff*diff)
+		}
+	}
+
+	for _, e := range events {
+		log.Printf("Log cluster %s %s: %s (%d lines, expected %.1f)", e.Kind, e.State, e.Cluster.Template, e.Count, e.Expected)
+	}
+	return events, nil
+}
+
+// transition fires an event when start is set and resolves an active one once
+// hold is no longer set
+func (c *Clusterer) transition(kind string, cl *Cluster, start, hold bool, n int, expected float64, now time.Time) []Event {
+	key := kind + "/" + cl.ID
+	e := Event{Kind: kind, Time: now, Cluster: *cl, Count: n, Expected: expected}
+	e.Cluster.Centroid = nil
+	switch {
+	case start && !c.active[key]:
+		c.active[key] = true
+		e.State = StateFiring
+		return []Event{e}
+	case c.active[key] && !hold && !start:
+		delete(c.active, key)
+		e.State = StateResolved
+		return []Event{e}
+	}
+	return nil
+}
+
+// assign puts a template into the closest cluster or a new one
+func (c *Clusterer) assign(template string, v []float64, line correlation.LogLine, now time.Time) (*Cluster, bool) {
+	var best *Cluster
+	bestSim := c.cfg.LogClusterThreshold
+	for _, cl := range c.clusters {
+		if sim := cosine(v, cl.Centroid); sim >= bestSim {
+			best, bestSim = cl, sim
+		}
+	}
+
+	created := best == nil
+	if created {
+		c.seq++
+		best = &Cluster{
+			ID:        fmt.Sprintf("lc-%05d", c.seq),
+			Template:  template,
+			Example:   line.Message,
+			Services:  make(map[string]int),
+			FirstSeen: now,
+			Centroid:  v,
+		}
+		c.clusters[best.ID] = best
+	} else {
+		// Running mean of the member templates, kept on the unit sphere
+		n := float64(best.Templates)
+		for i := range best.Centroid {
+			best.Centroid[i] = (best.Centroid[i]*n + v[i]) / (n + 1)
+		}
+		normalize(best.Centroid)
+	}
+	best.Templates++
+	if len(c.templates) < maxTemplates {
+		c.templates[template] = best.ID
+	}
+	return best, created
+}
+
+// Clusters returns every cluster, largest first, without centroids
+func (c *Clusterer) Clusters() []Cluster {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]Cluster, 0, len(c.clusters))
+	for _, cl := range c.clusters {
+		cp := *cl
+		cp.Centroid = nil
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Run polls source every interval and saves the clusters after each poll
+func (c *Clusterer) Run(ctx context.Context, source correlation.LogSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	since := time.Now()
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			lines, err := source.ErrorLogs(ctx, since, now)
+			if err != nil {
+				// An unreachable backend fails every poll; say so once
+				if err.Error() != lastErr {
+					log.Printf("Log clustering: fetch failed: %v", err)
+					lastErr = err.Error()
+				}
+				continue
+			}
+			lastErr = ""
+			events, err := c.Observe(ctx, lines, now)
+			if err != nil {
+				log.Printf("Log clustering: %v", err)
+				continue
+			}
+			since = now
+			for _, e := range events {
+				if c.onEvent != nil {
+					c.onEvent(ctx, e)
+				}
+			}
+			if err := c.Save(); err != nil {
+				log.Printf("Log clustering: %v", err)
+			}
+		}
+	}
+}
+
+// Save writes the clusters to the state file atomically
+func (c *Clusterer) Save() error {
+	if c.cfg.LogClusterStateFile == "" {
+		return nil
+	}
+	c.mu.Lock()
+	clusters := make([]*Cluster, 0, len(c.clusters))
+	for _, cl := range c.clusters {
+		clusters = append(clusters, cl)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ID < clusters[j].ID })
+	data, err := jsonx.Marshal(state{Embedder: c.embedderName, Polls: c.polls, Clusters: clusters, Templates: c.templates})
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode log clusters: %w", err)
+	}
+
+	path := c.cfg.LogClusterStateFile
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("save log clusters: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save log clusters: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save log clusters: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
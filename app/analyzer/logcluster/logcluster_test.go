@@ -0,0 +1,176 @@
+package logcluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/correlation"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// countingEmbedder hashes like the local embedder and records the templates it embedded
+type countingEmbedder struct {
+	HashEmbedder
+	embedded []string
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	e.embedded = append(e.embedded, texts...)
+	return e.HashEmbedder.Embed(ctx, texts)
+}
+
+func newTestClusterer(t *testing.T) (*Clusterer, *countingEmbedder) {
+	t.Helper()
+	e := &countingEmbedder{}
+	c, err := New(Config{
+		LogClusterThreshold:   0.8,
+		LogClusterWarmup:      1,
+		LogClusterAlpha:       0.1,
+		LogClusterSpikeFactor: 4,
+		LogClusterMinSpike:    20,
+	}, e, "local", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, e
+}
+
+func lines(service string, msgs ...string) []correlation.LogLine {
+	out := make([]correlation.LogLine, len(msgs))
+	for i, m := range msgs {
+		out[i] = correlation.LogLine{Time: testNow, Service: service, Message: m}
+	}
+	return out
+}
+
+func TestObserveMergesVariableTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msgs []string
+	}{
+		{"numbers and durations", []string{
+			"query timed out after 5012ms on shard 3",
+			"query timed out after 30s on shard 12",
+			"query timed out after 250ms on shard 7",
+		}},
+		{"transaction and user IDs", []string{
+			"transaction txn_1700000000_42 for user_abc failed",
+			"transaction txn_1700000001_7 for user_x-9 failed",
+		}},
+		{"UUIDs and hex IDs", []string{
+			"order 3f2b8c1e-9a4d-4f7e-8b2a-1c0d9e8f7a6b rejected by 5b8efff798038103d269b633813fc60c",
+			"order 00000000-0000-4000-8000-000000000000 rejected by eee19b7ec3c1b174",
+		}},
+		{"quoted values", []string{
+			`lock wait timeout on table "accounts"`,
+			`lock wait timeout on table "ledger_entries"`,
+		}},
+		{"spacing", []string{
+			"connection refused   by 10.0.0.1",
+			" connection refused by 10.0.0.2 ",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, e := newTestClusterer(t)
+			if _, err := c.Observe(context.Background(), lines("database-service", tc.msgs...), testNow); err != nil {
+				t.Fatal(err)
+			}
+			clusters := c.Clusters()
+			if len(clusters) != 1 {
+				t.Fatalf("%d clusters, want 1: %+v", len(clusters), clusters)
+			}
+			cl := clusters[0]
+			if cl.Count != int64(len(tc.msgs)) || cl.Templates != 1 || len(e.embedded) != 1 {
+				t.Errorf("cluster %q: count %d, %d templates, %d embedded; want %d, 1, 1",
+					cl.Template, cl.Count, cl.Templates, len(e.embedded), len(tc.msgs))
+			}
+			if cl.Example != tc.msgs[0] || cl.Services["database-service"] != len(tc.msgs) {
+				t.Errorf("cluster example %q, services %v", cl.Example, cl.Services)
+			}
+		})
+	}
+}
+
+func TestObserveKeepsTemplatesApart(t *testing.T) {
+	c, _ := newTestClusterer(t)
+	msgs := []string{
+		"connection pool exhausted, 50 connections in use",
+		"deadlock detected on table \"accounts\"",
+		"payment declined by issuer for txn_1_2",
+		"disk full writing WAL segment 42",
+		"connection pool exhausted, 49 connections in use",
+	}
+	if _, err := c.Observe(context.Background(), lines("database-service", msgs...), testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters := c.Clusters()
+	if len(clusters) != 4 {
+		t.Fatalf("%d clusters, want 4: %+v", len(clusters), clusters)
+	}
+	// Largest first: the pool messages share one
+	if clusters[0].Count != 2 || clusters[0].Template != "connection pool exhausted, <num> connections in use" {
+		t.Errorf("largest cluster %q with %d lines", clusters[0].Template, clusters[0].Count)
+	}
+	seen := make(map[string]bool)
+	for _, cl := range clusters {
+		if seen[cl.ID] {
+			t.Errorf("cluster %s listed twice", cl.ID)
+		}
+		seen[cl.ID] = true
+		if cl.Templates != 1 {
+			t.Errorf("cluster %q holds %d templates, want 1", cl.Template, cl.Templates)
+		}
+	}
+}
+
+func TestObserveMergesSimilarTemplates(t *testing.T) {
+	c, e := newTestClusterer(t)
+	// Different templates, but close enough in embedding to share a cluster
+	msgs := []string{
+		"failed to connect to database service after 3 retries",
+		"failed to connect to database service after 5 retries: connection refused",
+		"failed to connect to the database service after 2 attempts",
+	}
+	if _, err := c.Observe(context.Background(), lines("core-api-service", msgs...), testNow); err != nil {
+		t.Fatal(err)
+	}
+	clusters := c.Clusters()
+	if len(clusters) != 1 || clusters[0].Templates != 3 || clusters[0].Count != 3 || len(e.embedded) != 3 {
+		t.Errorf("clusters %+v after embedding %v, want one of all 3 templates", clusters, e.embedded)
+	}
+}
+
+func TestObserveRemembersTemplates(t *testing.T) {
+	c, e := newTestClusterer(t)
+	ctx := context.Background()
+	if _, err := c.Observe(ctx, lines("database-service", "query timed out after 50ms"), testNow); err != nil {
+		t.Fatal(err)
+	}
+	// The same template with other values is looked up, not embedded again
+	events, err := c.Observe(ctx, lines("core-api-service", "query timed out after 75ms", "query timed out after 1s"), testNow.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.embedded) != 1 {
+		t.Errorf("embedded %v, want the template once", e.embedded)
+	}
+	clusters := c.Clusters()
+	if len(clusters) != 1 || clusters[0].Count != 3 || clusters[0].Services["core-api-service"] != 2 {
+		t.Fatalf("clusters %+v, want one of 3 lines", clusters)
+	}
+	if len(events) != 0 {
+		t.Errorf("events %+v for a known cluster", events)
+	}
+
+	// After the warmup a new template is novel
+	events, err = c.Observe(ctx, lines("payment-gateway", "card network unreachable"), testNow.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != KindNovel || events[0].State != StateFiring || events[0].Cluster.Template != "card network unreachable" {
+		t.Errorf("events %+v, want the new cluster firing as novel", events)
+	}
+}
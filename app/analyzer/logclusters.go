@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"analyzer-service/logcluster"
+	"analyzer-service/remediation"
+	"incident-simulation/pkg/alerting"
+	"incident-simulation/pkg/logx"
+)
+
+// Incident types of log cluster events
+var logClusterTypes = map[string]string{
+	logcluster.KindNovel: "novel_error_signature",
+	logcluster.KindSpike: "error_signature_spike",
+}
+
+// logClusterIncidents records novel clusters and volume spikes on the incident
+// timeline the same way alert webhooks do, so they open and resolve incidents
+func logClusterIncidents(store *Store, remediator *remediation.Engine) func(context.Context, logcluster.Event) {
+	return func(ctx context.Context, e logcluster.Event) {
+		logClusterEvents.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("kind", e.Kind),
+			attribute.String("state", e.State),
+		))
+
+		inc, opened, err := store.RecordNotification(logClusterNotification(e), e.Time)
+		if err != nil {
+			logx.Errorw(ctx, "❌ Failed to record log cluster event", "log_cluster.id", e.Cluster.ID, "error", err)
+			return
+		}
+		if opened {
+			incidentOpened(ctx, remediator, inc)
+			logx.Warnw(ctx, "🧬 Incident opened from log cluster", "incident.id", inc.ID, "log_cluster.id", e.Cluster.ID,
+				"log_cluster.kind", e.Kind, "log_cluster.template", e.Cluster.Template)
+		}
+	}
+}
+
+func logClusterNotification(e logcluster.Event) alerting.Notification {
+	n := alerting.Notification{
+		Fingerprint: fmt.Sprintf("logcluster/%s/%s", e.Kind, e.Cluster.ID),
+		Rule:        "LogCluster" + map[string]string{logcluster.KindNovel: "Novel", logcluster.KindSpike: "Spike"}[e.Kind],
+		State:       alerting.StateFiring,
+		Severity:    "warning",
+		Series:      "log_cluster",
+		Value:       float64(e.Count),
+		StartsAt:    e.Time,
+		Labels: map[string]string{
+			"service":       e.Cluster.Service(),
+			"incident_type": logClusterTypes[e.Kind],
+			"cluster":       e.Cluster.ID,
+			"template":      e.Cluster.Template,
+		},
+	}
+	switch e.Kind {
+	case logcluster.KindNovel:
+		n.Summary = fmt.Sprintf("New error signature from %s: %s", e.Cluster.Service(), e.Cluster.Example)
+	default:
+		n.Summary = fmt.Sprintf("%d %q errors in one poll, about %.1f expected", e.Count, e.Cluster.Template, e.Expected)
+	}
+	if e.State == logcluster.StateResolved {
+		n.State, n.EndsAt = alerting.StateResolved, e.Time
+		n.Summary = fmt.Sprintf("Log cluster %s is back to normal", e.Cluster.ID)
+	}
+	return n
+}
+
+// listLogClusters returns the error log clusters, largest first
+func (a *api) listLogClusters(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Log Clusters")
+	defer span.End()
+
+	clusters := []logcluster.Cluster{}
+	if a.clusters != nil {
+		clusters = a.clusters.Clusters()
+	}
+	span.SetAttributes(attribute.Int("log_cluster.count", len(clusters)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"clusters": clusters})
+}
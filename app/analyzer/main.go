@@ -0,0 +1,467 @@
+// Command analyzer keeps the incident timeline: incidents opened from alert
+// webhooks or the REST API, their annotations and true/false positive feedback,
+// which tunes the per-series sensitivity of the anomaly detector. Its /chat
+// endpoint answers questions about the services from their metrics, traces,
+// logs and incidents through an OpenAI-compatible model.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"analyzer-service/canary"
+	"analyzer-service/llm"
+	"analyzer-service/logcluster"
+	"analyzer-service/otlpreceiver"
+	"analyzer-service/remediation"
+	"analyzer-service/runbook"
+	"analyzer-service/slo"
+	"analyzer-service/topology"
+	"analyzer-service/tracewatch"
+	"incident-simulation/pkg/anomaly"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/correlation"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/probes"
+	"incident-simulation/pkg/profiling"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Metrics
+var (
+	incidentsOpened      metric.Int64Counter
+	verdictCounter       metric.Int64Counter
+	chatRequests         metric.Int64Counter
+	chatDuration         metric.Float64Histogram
+	logClusterEvents     metric.Int64Counter
+	traceAnomalies       metric.Int64Counter
+	remediationRuns      metric.Int64Counter
+	deploymentsRecorded  metric.Int64Counter
+	otlpItems            metric.Int64Counter
+	canaryVerdictCounter metric.Int64Counter
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Load configuration (flags > env > .env > YAML > defaults)
+	var cfg Config
+	config.MustLoad(&cfg)
+	log.Println("⚙️  Analyzer Service configuration:")
+	config.Print(log.Writer(), &cfg)
+
+	// In-memory buffer of recent spans and logs for /debug/telemetry/recent
+	recorder := telemetry.NewRecorder("analyzer-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	// Export outcomes for /debug/otel
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	// Per-minute latency histograms and error counts for /debug/latency-heatmap and /debug/export
+	heatmap := telemetry.NewHeatmap("analyzer-service", cfg.LatencyHeatmapMinutes)
+
+	// Initialize OpenTelemetry
+	shutdown := initOpenTelemetry(ctx, "analyzer-service", cfg.Telemetry, recorder, health, heatmap)
+	defer shutdown()
+
+	// Optional pprof endpoints and continuous profiling
+	stopProfiling := profiling.Start("analyzer-service", cfg.Profiling, "localhost:6064")
+	defer stopProfiling()
+
+	// Audit trail of incidents, deployments and admin actions
+	if err := audit.Setup("analyzer-service", cfg.AuditLogFile, cfg.AuditLogKeep); err != nil {
+		log.Fatalf("Invalid audit log: %v", err)
+	}
+	defer audit.Close()
+
+	store, err := OpenStore(cfg.IncidentDB)
+	if err != nil {
+		log.Fatalf("Failed to open incident store: %v", err)
+	}
+	defer store.Close()
+
+	// Remediation runbooks attached to new incidents by type and service
+	runbooks, err := runbook.Load(cfg.RunbooksFile)
+	if err != nil {
+		log.Fatalf("Failed to load runbooks: %v", err)
+	}
+	store.runbooks = runbooks
+	store.deployWindow = cfg.DeployCorrelationWindow
+
+	// Per-series sensitivities learned from incident feedback
+	tuner, err := anomaly.NewTuner(anomaly.TunerConfig{
+		TargetPrecision: cfg.AnomalyTargetPrecision,
+		MinSensitivity:  cfg.AnomalyMinSensitivity,
+		MaxSensitivity:  cfg.AnomalyMaxSensitivity,
+		StateFile:       cfg.AnomalyTuningFile,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load anomaly tuning: %v", err)
+	}
+
+	// Chat model backend (OpenAI-compatible, Anthropic, Ollama or Bedrock)
+	provider, err := llm.New(cfg.Config, &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)})
+	if err != nil {
+		log.Fatalf("Invalid LLM settings: %v", err)
+	}
+
+	// Initialize metrics
+	initMetrics(ctx)
+	if err := buildinfo.RegisterMetric("analyzer-service"); err != nil {
+		logx.Errorw(ctx, "Failed to create build info gauge", "error", err)
+	}
+
+	// OTLP receiver: the services export straight to the analyzer, which keeps
+	// a copy for the detectors below and forwards everything to the backend
+	var receiver *otlpreceiver.Receiver
+	if cfg.Receiver.Enabled() {
+		forward, err := telemetry.NewOTLPOptions(cfg.OTLP)
+		if err != nil {
+			log.Fatalf("Invalid OTLP settings: %v", err)
+		}
+		receiver, err = otlpreceiver.New(cfg.Receiver, forward, countOTLPItems)
+		if err != nil {
+			log.Fatalf("Invalid OTLP receiver settings: %v", err)
+		}
+		if err := receiver.Start(ctx); err != nil {
+			log.Fatalf("Failed to start the OTLP receiver: %v", err)
+		}
+	}
+
+	// Remediation actions against the services' admin APIs
+	var remediator *remediation.Engine
+	if cfg.Remediation.RemediationsFile != "" {
+		client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+		remediator, err = remediation.Load(cfg.Remediation, client, remediationTimeline(store))
+		if err != nil {
+			log.Fatalf("Invalid remediation settings: %v", err)
+		}
+	}
+
+	// Error log clustering over Loki, the telemetry buffers or received logs
+	correlator := correlation.FromConfig(cfg.Correlation)
+	if receiver != nil {
+		correlator.Traces, correlator.Logs = receiver, receiver
+	}
+	var clusterer *logcluster.Clusterer
+	if cfg.LogCluster.LogClusterInterval > 0 && correlator.Logs != nil {
+		var embedder logcluster.Embedder = logcluster.HashEmbedder{}
+		embedderName := "local"
+		if cfg.LogCluster.LogClusterEmbedder == "llm" {
+			embedder = provider
+			embedderName = cfg.LLMProvider + "/" + cfg.WithDefaults().LLMEmbedModel
+		}
+		clusterer, err = logcluster.New(cfg.LogCluster, embedder, embedderName, logClusterIncidents(store, remediator))
+		if err != nil {
+			log.Fatalf("Invalid log clustering settings: %v", err)
+		}
+		go clusterer.Run(ctx, correlator.Logs, cfg.LogCluster.LogClusterInterval)
+		initLogClusterMetrics(clusterer)
+	}
+
+	// Span latency and trace structure baselines over received spans, the
+	// telemetry buffers or Tempo
+	var detector *tracewatch.Detector
+	if source := spanSource(cfg, receiver); cfg.Traces.TraceAnomalyInterval > 0 && source != nil {
+		detector, err = tracewatch.New(cfg.Traces, countTraceAnomaly, traceAnomalyIncidents(store, remediator))
+		if err != nil {
+			log.Fatalf("Invalid trace anomaly settings: %v", err)
+		}
+		go detector.Run(ctx, source, cfg.Traces.TraceAnomalyInterval)
+	}
+
+	// Service graph from the same spans, on its own cursor so it does not
+	// take spans away from the detector
+	var graph *topology.Builder
+	if source := spanSource(cfg, receiver); cfg.Topology.TopologyInterval > 0 && source != nil {
+		graph = topology.New(cfg.Topology)
+		correlator.Topology = graph
+		go graph.Run(ctx, source, cfg.Topology.TopologyInterval)
+	}
+
+	// Database canary against the stable version, and the error budget whose
+	// exhaustion freezes risky traffic, both from metrics in Prometheus
+	var canaryAnalyzer *canary.Analyzer
+	var budget *slo.Tracker
+	if cfg.PrometheusURL != "" {
+		prom := &promClient{baseURL: cfg.PrometheusURL, client: &http.Client{Timeout: 10 * time.Second}}
+		if cfg.Canary.CanaryInterval > 0 {
+			canaryAnalyzer = canary.New(cfg.Canary, canaryQuery(prom), canaryVerdicts())
+			go canaryAnalyzer.Run(ctx, cfg.Canary.CanaryInterval)
+		}
+		if cfg.SLO.SLOInterval > 0 {
+			budget = slo.New(cfg.SLO, sloQuery(prom), errorBudgetFreezes)
+			initErrorBudgetMetrics(budget)
+			go budget.Run(ctx, cfg.SLO.SLOInterval)
+		}
+	}
+
+	// Start analyzer service
+	startAnalyzerService(cfg, store, tuner, provider, correlator, clusterer, detector, graph, canaryAnalyzer, budget, remediator, recorder, health, heatmap)
+}
+
+func initOpenTelemetry(ctx context.Context, serviceName string, cfg config.Telemetry, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) func() {
+	// Resource with service information; OTEL_RESOURCE_ATTRIBUTES overrides it
+	res, err := telemetry.NewResource(ctx, serviceName)
+	if err != nil {
+		log.Fatalf("Failed to create resource: %v", err)
+	}
+
+	// OTLP (endpoint, TLS, headers) or stdout/file exporters
+	exporters, err := telemetry.NewExporters(cfg.OTLP, cfg.Output)
+	if err != nil {
+		log.Fatalf("Invalid telemetry exporter settings: %v", err)
+	}
+
+	// Trace exporter
+	traceExporter, err := exporters.Trace(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create trace exporter: %v", err)
+	}
+
+	// Batch span processor whose queue /debug/otel reports
+	spans := telemetry.NewBatchSpanProcessor(health.Spans(traceExporter), cfg.Batching)
+	health.TrackQueue(spans)
+
+	// Personal data is scrubbed before spans and log records are exported or buffered
+	scrubber := telemetry.NewScrubber(cfg.Scrubbing)
+
+	// Trace provider
+	tp := trace.NewTracerProvider(
+		trace.WithSpanProcessor(scrubber.SpanProcessor(spans)),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(recorder)),
+		trace.WithResource(res),
+		// Ratio sampling, overridden for debug requests
+		trace.WithSampler(telemetry.NewSampler(cfg.Sampling)),
+	)
+	otel.SetTracerProvider(tp)
+
+	// Metric exporter
+	metricExporter, err := exporters.Metric(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create metric exporter: %v", err)
+	}
+
+	views, err := telemetry.ParseViewConfig(cfg.MetricViewBuckets, cfg.MetricViewDropAttributes)
+	if err != nil {
+		log.Fatalf("Invalid metric views: %v", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(telemetry.View(views)),
+		sdkmetric.WithReader(telemetry.NewPeriodicReader(heatmap.Metrics(health.Metrics(metricExporter)), cfg.Batching)),
+	)
+	// Caps the attribute sets of every counter and histogram the service creates
+	otel.SetMeterProvider(telemetry.GuardCardinality(mp, cfg.MetricCardinalityLimit, views))
+
+	// Log Provider
+	exporter, err := exporters.Log(ctx)
+	if err != nil {
+		log.Fatalf("failed to create log exporter: %v", err)
+	}
+
+	// Set up the LoggerProvider with a batch processor
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(scrubber.LogProcessor()),
+		sdklog.WithProcessor(telemetry.NewBatchLogProcessor(health.Logs(exporter), cfg.Batching)),
+		sdklog.WithProcessor(recorder),
+	)
+
+	// Set the global logger provider
+	global.SetLoggerProvider(provider)
+
+	// Bridge logrus to OpenTelemetry; logx adds service and trace fields
+	logx.Setup(serviceName, provider)
+	if _, err := logx.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	// Text map propagators from OTEL_PROPAGATORS
+	propagator, err := telemetry.NewPropagator(cfg.Propagators)
+	if err != nil {
+		log.Fatalf("Invalid propagator settings: %v", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down tracer provider", "error", err)
+		}
+		if err := mp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down meter provider", "error", err)
+		}
+		provider.Shutdown(ctx)
+		exporters.Close()
+	}
+}
+
+func initMetrics(ctx context.Context) {
+	meter := otel.Meter("analyzer-service")
+
+	var err error
+	incidentsOpened, err = meter.Int64Counter("analyzer_incidents_opened_total",
+		metric.WithDescription("Incidents recorded, by service, type and severity"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create incidents counter", "error", err)
+	}
+
+	verdictCounter, err = meter.Int64Counter("analyzer_incident_verdicts_total",
+		metric.WithDescription("True and false positive verdicts given to incidents"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create verdict counter", "error", err)
+	}
+
+	chatRequests, err = meter.Int64Counter("analyzer_chat_requests_total",
+		metric.WithDescription("Chat questions answered, by outcome"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create chat counter", "error", err)
+	}
+
+	chatDuration, err = meter.Float64Histogram("analyzer_chat_duration_seconds",
+		metric.WithDescription("Time to gather evidence and stream a chat answer"),
+		metric.WithUnit("s"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create chat duration histogram", "error", err)
+	}
+
+	logClusterEvents, err = meter.Int64Counter("analyzer_log_cluster_events_total",
+		metric.WithDescription("Novel error log clusters and cluster volume spikes, by kind and state"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create log cluster event counter", "error", err)
+	}
+
+	traceAnomalies, err = meter.Int64Counter("analyzer_trace_anomalies_total",
+		metric.WithDescription("Spans slower than their operation's learned p99 and trace structure changes, by kind and service"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create trace anomaly counter", "error", err)
+	}
+
+	remediationRuns, err = meter.Int64Counter("analyzer_remediations_total",
+		metric.WithDescription("Remediation actions run, by action, trigger and outcome"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create remediation counter", "error", err)
+	}
+
+	deploymentsRecorded, err = meter.Int64Counter("analyzer_deployments_total",
+		metric.WithDescription("Deployment events recorded, by service and kind"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create deployment counter", "error", err)
+	}
+
+	otlpItems, err = meter.Int64Counter("analyzer_otlp_items_total",
+		metric.WithDescription("Spans, metrics and log records the OTLP receiver received, sampled out, forwarded or dropped, by signal and outcome"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create OTLP receiver counter", "error", err)
+	}
+
+	canaryVerdictCounter, err = meter.Int64Counter("analyzer_canary_verdicts_total",
+		metric.WithDescription("Database canary analyses, by verdict"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create canary verdict counter", "error", err)
+	}
+}
+
+// initLogClusterMetrics reports the number of known error log clusters
+// spanSource returns a span source with a cursor of its own: over the OTLP
+// receiver when it runs, else over the telemetry buffers or Tempo
+func spanSource(cfg Config, receiver *otlpreceiver.Receiver) tracewatch.SpanSource {
+	if receiver != nil {
+		return receiver.Cursor()
+	}
+	return tracewatch.SourceFromConfig(cfg.Correlation, cfg.Traces.TraceFetchLimit)
+}
+
+// countOTLPItems counts what the OTLP receiver received, sampled out, forwarded or dropped
+func countOTLPItems(signal, outcome string, items int) {
+	otlpItems.Add(context.Background(), int64(items), metric.WithAttributes(
+		attribute.String("signal", signal),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func initLogClusterMetrics(clusterer *logcluster.Clusterer) {
+	_, err := otel.Meter("analyzer-service").Int64ObservableGauge("analyzer_log_clusters",
+		metric.WithDescription("Error log clusters known to the analyzer"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(len(clusterer.Clusters())))
+			return nil
+		}))
+	if err != nil {
+		log.Printf("Failed to create log cluster gauge: %v", err)
+	}
+}
+
+func startAnalyzerService(cfg Config, store *Store, tuner *anomaly.Tuner, provider llm.Provider,
+	correlator *correlation.Correlator, clusterer *logcluster.Clusterer, detector *tracewatch.Detector,
+	graph *topology.Builder, canaryAnalyzer *canary.Analyzer, budget *slo.Tracker, remediator *remediation.Engine,
+	recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) {
+	mux := http.NewServeMux()
+	(&api{store: store, tuner: tuner, clusters: clusterer, traces: detector, runbooks: store.runbooks,
+		remediator: remediator, topology: graph, canary: canaryAnalyzer, budget: budget,
+		maxLimit: cfg.MaxListLimit, adminToken: cfg.AdminToken, devMode: cfg.DevMode}).register(mux)
+
+	gatherer := &evidenceGatherer{
+		correlator: correlator,
+		store:      store,
+		window:     cfg.ChatWindow,
+	}
+	if cfg.PrometheusURL != "" {
+		gatherer.prom = &promClient{baseURL: cfg.PrometheusURL, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	(&chat{gatherer: gatherer, llm: provider, model: cfg.WithDefaults().LLMModel, timeout: cfg.LLMTimeout}).register(mux)
+
+	mux.HandleFunc("GET /analyzer/health", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("analyzer-service").Start(r.Context(), "Analyzer Health Check")
+		defer span.End()
+
+		w.Header().Set("Content-Type", "application/json")
+		jsonx.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    "healthy",
+			"timestamp": time.Now().Unix(),
+		})
+	})
+
+	// Kubernetes probes sit outside tracing
+	prober := probes.New(2 * time.Second)
+	if cfg.TelemetryExporter == telemetry.ExporterOTLP {
+		prober.AddCheck("otlp_collector", probes.TCPCheck(telemetry.CollectorAddr(cfg.OTLP)))
+		// Not ready until telemetry has reached the collector once
+		prober.AddCheck("telemetry_export", health.Ready)
+	}
+
+	root := http.NewServeMux()
+	prober.Register(root)
+	if cfg.TelemetryBufferSize > 0 {
+		root.Handle("GET /debug/telemetry/recent", recorder)
+	}
+	root.Handle("GET /debug/otel", health)
+	root.Handle("GET /debug/audit", audit.Handler())
+	root.Handle("/debug/loglevel", logx.LevelHandler(audit.Warn))
+	if heatmap.Enabled() {
+		root.Handle("GET /debug/latency-heatmap", heatmap)
+		root.Handle("GET /debug/export", heatmap.Export())
+	}
+	root.Handle("GET /version", buildinfo.Handler("analyzer-service"))
+	handler := httpx.Metrics("analyzer-service", mux)
+	// X-Debug-Trace and DEBUG_TRACE_USERS requests are sampled whatever TRACE_SAMPLE_RATIO says
+	root.Handle("/", telemetry.DebugTraces(cfg.Sampling, nil, otelhttp.NewHandler(httpx.TraceResponse(handler), "analyzer-service")))
+
+	prober.MarkStarted()
+	log.Printf("🔎 Analyzer Service running on %s", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, root))
+}
@@ -0,0 +1,108 @@
+package otlpreceiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"incident-simulation/pkg/telemetry"
+)
+
+// forwarder sends received requests on to the backend over OTLP/HTTP, one at
+// a time and in arrival order, so a slow backend delays forwarding but never
+// the services' exports
+type forwarder struct {
+	client  *http.Client
+	baseURL string
+	headers map[string]string
+	queue   chan export
+	count   Counter
+
+	failing bool
+}
+
+type export struct {
+	signal string
+	body   []byte
+	items  int
+}
+
+func newForwarder(opts telemetry.OTLPOptions, queueSize int, count Counter) *forwarder {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !opts.Insecure {
+		transport.TLSClientConfig = opts.TLS
+	}
+	return &forwarder{
+		client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		baseURL: opts.BaseURL,
+		headers: opts.Headers,
+		queue:   make(chan export, queueSize),
+		count:   count,
+	}
+}
+
+// enqueue queues msg, or drops it when the queue is full
+func (f *forwarder) enqueue(signal string, msg proto.Message, items int) {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		f.count(signal, "dropped", items)
+		return
+	}
+	select {
+	case f.queue <- export{signal: signal, body: body, items: items}:
+	default:
+		f.count(signal, "dropped", items)
+	}
+}
+
+func (f *forwarder) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-f.queue:
+			err := f.send(ctx, e)
+			switch {
+			case err != nil:
+				f.count(e.signal, "forward_failed", e.items)
+				if !f.failing {
+					log.Printf("⚠️ Forwarding OTLP %s to %s failing: %v", e.signal, f.baseURL, err)
+					f.failing = true
+				}
+			default:
+				f.count(e.signal, "forwarded", e.items)
+				if f.failing {
+					log.Printf("✅ Forwarding OTLP to %s recovered", f.baseURL)
+					f.failing = false
+				}
+			}
+		}
+	}
+}
+
+func (f *forwarder) send(ctx context.Context, e export) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.baseURL+"/v1/"+e.signal, bytes.NewReader(e.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range f.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("backend returned %d", resp.StatusCode)
+	}
+	return nil
+}
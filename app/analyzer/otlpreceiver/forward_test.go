@@ -0,0 +1,151 @@
+package otlpreceiver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"incident-simulation/pkg/telemetry"
+)
+
+// backend answers exports with the statuses in order, then 200, and keeps
+// the requests it received
+type backend struct {
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func (b *backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.received = append(b.received, r)
+	b.bodies = append(b.bodies, body)
+	if len(b.statuses) > 0 {
+		w.WriteHeader(b.statuses[0])
+		b.statuses = b.statuses[1:]
+	}
+}
+
+func (b *backend) requests() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.received)
+}
+
+// newForwardingReceiver forwards to b with room for queue exports
+func newForwardingReceiver(t *testing.T, b *backend, queue int, sampleRate float64) (*Receiver, *counts) {
+	t.Helper()
+	srv := httptest.NewServer(b)
+	t.Cleanup(srv.Close)
+	c := &counts{}
+	r, err := New(Config{OTLPReceiverBufferSize: 100, OTLPReceiverQueueSize: queue, OTLPReceiverSampleRate: sampleRate, OTLPReceiverForward: true},
+		telemetry.OTLPOptions{BaseURL: srv.URL, Insecure: true, Headers: map[string]string{"X-Scope-OrgID": "sim"}}, c.count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, c
+}
+
+// waitFor polls until cond holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestForwardDropsWhenQueueFull(t *testing.T) {
+	b := &backend{}
+	r, c := newForwardingReceiver(t, b, 2, 1)
+
+	// Nothing drains the queue yet: the third export does not fit
+	for range 3 {
+		r.consume(SignalTraces, traceRequest(testTraceID))
+	}
+	if got := c.get("traces/dropped"); got != 1 {
+		t.Errorf("%d spans dropped, want 1", got)
+	}
+	// The detectors see every span, forwarded or not
+	if got := c.get("traces/received"); got != 3 {
+		t.Errorf("%d spans received, want 3", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.forward.run(ctx)
+	waitFor(t, "the queued exports", func() bool { return c.get("traces/forwarded") == 2 })
+	if n := b.requests(); n != 2 {
+		t.Errorf("backend got %d requests, want the 2 queued", n)
+	}
+}
+
+func TestForwardFailureIsNotRetried(t *testing.T) {
+	b := &backend{statuses: []int{http.StatusServiceUnavailable}}
+	r, c := newForwardingReceiver(t, b, 10, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.forward.run(ctx)
+
+	// The failed export is counted and given up rather than retried, and
+	// the exports after it go through
+	for range 3 {
+		r.consume(SignalTraces, traceRequest(testTraceID))
+	}
+	waitFor(t, "all exports", func() bool { return c.get("traces/forward_failed")+c.get("traces/forwarded") == 3 })
+	if failed, forwarded := c.get("traces/forward_failed"), c.get("traces/forwarded"); failed != 1 || forwarded != 2 {
+		t.Errorf("%d spans failed and %d forwarded, want 1 and 2", failed, forwarded)
+	}
+	if n := b.requests(); n != 3 {
+		t.Errorf("backend got %d requests, want 3 with no retry", n)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	req := b.received[len(b.received)-1]
+	if req.URL.Path != "/v1/traces" || req.Header.Get("Content-Type") != "application/x-protobuf" || req.Header.Get("X-Scope-OrgID") != "sim" {
+		t.Errorf("forwarded %s with headers %v", req.URL.Path, req.Header)
+	}
+	var got coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(b.bodies[len(b.bodies)-1], &got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&got, traceRequest(testTraceID)) {
+		t.Errorf("forwarded %v, want the received request", &got)
+	}
+}
+
+func TestForwardSampling(t *testing.T) {
+	b := &backend{}
+	r, c := newForwardingReceiver(t, b, 10, 0)
+
+	ok := traceRequest(testTraceID)
+	ok.ResourceSpans[0].ScopeSpans[0].Spans[0].Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK}
+	r.consume(SignalTraces, ok)
+	r.consume(SignalTraces, traceRequest(testTraceID))
+
+	if got := c.get("traces/sampled_out"); got != 1 {
+		t.Errorf("%d spans sampled out, want the successful one", got)
+	}
+	if got := len(r.forward.queue); got != 1 {
+		t.Errorf("%d exports queued, want the one with the error span", got)
+	}
+	// Both are still buffered for the detectors
+	spans, _ := r.Cursor().Spans(context.Background(), time.Time{})
+	if len(spans) != 2 {
+		t.Errorf("%d spans buffered, want 2", len(spans))
+	}
+}
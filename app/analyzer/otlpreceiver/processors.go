@@ -0,0 +1,291 @@
+package otlpreceiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// pipeline is what a collector's processors would do to received telemetry:
+// enrich adds looked-up attributes and redact hashes personal data, both
+// before the detectors see it, and sample thins traces before forwarding
+type pipeline struct {
+	redact     map[string]bool
+	redactKey  []byte
+	lookups    []lookup
+	sampleRate float64
+}
+
+// lookup adds attributes to anything carrying Attribute, chosen by its value:
+// an exact match first, else the longest CIDR prefix containing an IP value
+type lookup struct {
+	Attribute string                       `yaml:"attribute"`
+	Values    map[string]map[string]string `yaml:"values"`
+
+	prefixes []netip.Prefix // CIDR keys of Values, longest first
+}
+
+func newPipeline(cfg Config) (*pipeline, error) {
+	p := &pipeline{redactKey: []byte(cfg.OTLPReceiverRedactKey), sampleRate: cfg.OTLPReceiverSampleRate}
+	for _, key := range strings.Split(cfg.OTLPReceiverRedact, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			if p.redact == nil {
+				p.redact = make(map[string]bool)
+			}
+			p.redact[key] = true
+		}
+	}
+	if cfg.OTLPReceiverEnrichFile != "" {
+		lookups, err := loadLookups(cfg.OTLPReceiverEnrichFile)
+		if err != nil {
+			return nil, err
+		}
+		p.lookups = lookups
+	}
+	return p, nil
+}
+
+func loadLookups(path string) ([]lookup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read enrichment lookups: %w", err)
+	}
+	var file struct {
+		Lookups []lookup `yaml:"lookups"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse enrichment lookups %s: %w", path, err)
+	}
+	for i := range file.Lookups {
+		l := &file.Lookups[i]
+		if l.Attribute == "" || len(l.Values) == 0 {
+			return nil, fmt.Errorf("enrichment lookup %d: attribute and values are required", i+1)
+		}
+		for key := range l.Values {
+			if prefix, err := netip.ParsePrefix(key); err == nil {
+				l.prefixes = append(l.prefixes, prefix.Masked())
+			}
+		}
+		sort.Slice(l.prefixes, func(a, b int) bool { return l.prefixes[a].Bits() > l.prefixes[b].Bits() })
+	}
+	return file.Lookups, nil
+}
+
+// find returns the attributes to add for value, nil when nothing matches
+func (l *lookup) find(value string) map[string]string {
+	if attrs, ok := l.Values[value]; ok {
+		return attrs
+	}
+	if len(l.prefixes) == 0 {
+		return nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return l.Values[prefix.String()]
+		}
+	}
+	return nil
+}
+
+// enabled reports whether process has anything to do
+func (p *pipeline) enabled() bool {
+	return len(p.redact) > 0 || len(p.lookups) > 0
+}
+
+// process enriches and redacts msg in place
+func (p *pipeline) process(msg proto.Message) {
+	if !p.enabled() {
+		return
+	}
+	switch m := msg.(type) {
+	case *coltracepb.ExportTraceServiceRequest:
+		for _, rs := range m.ResourceSpans {
+			if rs.Resource != nil {
+				rs.Resource.Attributes = p.attributes(rs.Resource.Attributes)
+			}
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					s.Attributes = p.attributes(s.Attributes)
+					for _, e := range s.Events {
+						p.redactAll(e.Attributes)
+					}
+				}
+			}
+		}
+	case *collogspb.ExportLogsServiceRequest:
+		for _, rl := range m.ResourceLogs {
+			if rl.Resource != nil {
+				rl.Resource.Attributes = p.attributes(rl.Resource.Attributes)
+			}
+			for _, sl := range rl.ScopeLogs {
+				for _, l := range sl.LogRecords {
+					l.Attributes = p.attributes(l.Attributes)
+				}
+			}
+		}
+	case *colmetricspb.ExportMetricsServiceRequest:
+		// Data points only lose personal data: enriching them would add series
+		for _, rm := range m.ResourceMetrics {
+			if rm.Resource != nil {
+				rm.Resource.Attributes = p.attributes(rm.Resource.Attributes)
+			}
+			for _, sm := range rm.ScopeMetrics {
+				for _, metric := range sm.Metrics {
+					for _, kvs := range dataPointAttributes(metric) {
+						p.redactAll(kvs)
+					}
+				}
+			}
+		}
+	}
+}
+
+// attributes enriches then redacts kvs; lookups match on the original
+// values and never replace an attribute that is already set
+func (p *pipeline) attributes(kvs []*commonpb.KeyValue) []*commonpb.KeyValue {
+	for i := range p.lookups {
+		l := &p.lookups[i]
+		var added map[string]string
+		for _, kv := range kvs {
+			if kv.Key == l.Attribute {
+				added = l.find(anyString(kv.Value))
+				break
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(added))
+		for k := range added {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	next:
+		for _, k := range keys {
+			for _, kv := range kvs {
+				if kv.Key == k {
+					continue next
+				}
+			}
+			kvs = append(kvs, stringKV(k, added[k]))
+		}
+	}
+	p.redactAll(kvs)
+	return kvs
+}
+
+// redactAll replaces the values of redacted attributes by a keyed hash, so
+// the same user still groups together without the backend storing who it is
+func (p *pipeline) redactAll(kvs []*commonpb.KeyValue) {
+	for _, kv := range kvs {
+		if !p.redact[kv.Key] {
+			continue
+		}
+		mac := hmac.New(sha256.New, p.redactKey)
+		mac.Write([]byte(anyString(kv.Value)))
+		kv.Value = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{
+			StringValue: "redacted:" + hex.EncodeToString(mac.Sum(nil)[:8]),
+		}}
+	}
+}
+
+// sample drops the spans and log records of traces outside the sample rate
+// from msg and returns how many it dropped. Error spans, logs at ERROR or
+// above and logs outside a trace are always kept; metrics are never sampled.
+func (p *pipeline) sample(msg proto.Message) int {
+	if p.sampleRate >= 1 {
+		return 0
+	}
+	dropped := 0
+	switch m := msg.(type) {
+	case *coltracepb.ExportTraceServiceRequest:
+		for _, rs := range m.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				kept := ss.Spans[:0]
+				for _, s := range ss.Spans {
+					if s.Status.GetCode() == tracepb.Status_STATUS_CODE_ERROR || p.sampled(s.TraceId) {
+						kept = append(kept, s)
+					}
+				}
+				dropped += len(ss.Spans) - len(kept)
+				ss.Spans = kept
+			}
+		}
+	case *collogspb.ExportLogsServiceRequest:
+		for _, rl := range m.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				kept := sl.LogRecords[:0]
+				for _, l := range sl.LogRecords {
+					if l.SeverityNumber >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR || len(l.TraceId) == 0 || p.sampled(l.TraceId) {
+						kept = append(kept, l)
+					}
+				}
+				dropped += len(sl.LogRecords) - len(kept)
+				sl.LogRecords = kept
+			}
+		}
+	}
+	return dropped
+}
+
+// sampled makes the SDK's TraceIDRatioBased decision, so every span of a
+// trace shares it and services sampling at the same rate agree with it
+func (p *pipeline) sampled(traceID []byte) bool {
+	if len(traceID) != 16 {
+		return true
+	}
+	return binary.BigEndian.Uint64(traceID[8:16])>>1 < uint64(p.sampleRate*math.Exp2(63))
+}
+
+func dataPointAttributes(m *metricspb.Metric) [][]*commonpb.KeyValue {
+	var out [][]*commonpb.KeyValue
+	switch d := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range d.Gauge.DataPoints {
+			out = append(out, dp.Attributes)
+		}
+	case *metricspb.Metric_Sum:
+		for _, dp := range d.Sum.DataPoints {
+			out = append(out, dp.Attributes)
+		}
+	case *metricspb.Metric_Histogram:
+		for _, dp := range d.Histogram.DataPoints {
+			out = append(out, dp.Attributes)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range d.ExponentialHistogram.DataPoints {
+			out = append(out, dp.Attributes)
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range d.Summary.DataPoints {
+			out = append(out, dp.Attributes)
+		}
+	}
+	return out
+}
+
+func stringKV(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
@@ -0,0 +1,396 @@
+// Package otlpreceiver lets the analyzer stand in for the OpenTelemetry
+// Collector: the services export OTLP/HTTP or OTLP/gRPC straight to it, it
+// keeps a copy of the spans and log records for the detectors and forwards
+// every request to the real backend.
+//
+// Between receiving and buffering a small pipeline stands in for collector
+// processors: attributes from OTLP_RECEIVER_ENRICH_FILE lookups are added and
+// the values of OTLP_RECEIVER_REDACT attributes hashed, so the detectors and
+// the backend see the same data. OTLP_RECEIVER_SAMPLE_RATE thins traces on
+// the way to the backend only; the detectors always see every span.
+//
+// Received spans feed tracewatch and topology through Cursor and the
+// correlator through ErrorSpans and ErrorLogs, so detection works on what the
+// services send instead of polling their telemetry buffers or Tempo. Metrics
+// are only forwarded; the analyzer reads them back from Prometheus.
+package otlpreceiver
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"analyzer-service/tracewatch"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/correlation"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Signals, as used in metric attributes and OTLP/HTTP paths
+const (
+	SignalTraces  = "traces"
+	SignalMetrics = "metrics"
+	SignalLogs    = "logs"
+)
+
+// Config enables the receiver and sizes its buffers
+type Config struct {
+	OTLPReceiverHTTPAddr   string `env:"OTLP_RECEIVER_HTTP_ADDR" flag:"otlp-receiver-http-addr" usage:"Accept OTLP/HTTP from the services on this address, e.g. :4318 (empty disables)"`
+	OTLPReceiverGRPCAddr   string `env:"OTLP_RECEIVER_GRPC_ADDR" flag:"otlp-receiver-grpc-addr" usage:"Accept OTLP/gRPC from the services on this address, e.g. :4317 (empty disables)"`
+	OTLPReceiverForward    bool   `env:"OTLP_RECEIVER_FORWARD" flag:"otlp-receiver-forward" default:"true" usage:"Forward received telemetry to OTEL_EXPORTER_OTLP_ENDPOINT, as a collector would"`
+	OTLPReceiverBufferSize int    `env:"OTLP_RECEIVER_BUFFER_SIZE" flag:"otlp-receiver-buffer-size" default:"50000" usage:"Received spans, and separately log records, kept for the detectors"`
+	OTLPReceiverQueueSize  int    `env:"OTLP_RECEIVER_QUEUE_SIZE" flag:"otlp-receiver-queue-size" default:"1000" usage:"Export requests waiting to be forwarded before new ones are dropped"`
+
+	// Processors
+	OTLPReceiverRedact     string  `env:"OTLP_RECEIVER_REDACT" flag:"otlp-receiver-redact" default:"user.id,user_id,enduser.id,app.transfer.recipient" usage:"Comma-separated attributes whose values are replaced by a keyed hash (empty disables)"`
+	OTLPReceiverRedactKey  string  `env:"OTLP_RECEIVER_REDACT_KEY" flag:"otlp-receiver-redact-key" secret:"true" usage:"HMAC key of the redaction hash; without one a known value can be hashed and matched"`
+	OTLPReceiverEnrichFile string  `env:"OTLP_RECEIVER_ENRICH_FILE" flag:"otlp-receiver-enrich-file" usage:"YAML lookups adding attributes by an attribute's value, e.g. tenant tier or client geo (empty disables)"`
+	OTLPReceiverSampleRate float64 `env:"OTLP_RECEIVER_SAMPLE_RATE" flag:"otlp-receiver-sample-rate" default:"1" usage:"Share of traces forwarded, by trace ID; error spans and error logs are always forwarded"`
+
+	// Reflection and call logging of the OTLP/gRPC listener
+	config.GRPC
+}
+
+// Enabled reports whether either listener is configured
+func (c Config) Enabled() bool {
+	return c.OTLPReceiverHTTPAddr != "" || c.OTLPReceiverGRPCAddr != ""
+}
+
+func (c Config) validate(forward telemetry.OTLPOptions) error {
+	var errs []error
+	if c.OTLPReceiverBufferSize <= 0 || c.OTLPReceiverQueueSize <= 0 {
+		errs = append(errs, errors.New("OTLP_RECEIVER_BUFFER_SIZE and OTLP_RECEIVER_QUEUE_SIZE must be positive"))
+	}
+	if c.OTLPReceiverSampleRate < 0 || c.OTLPReceiverSampleRate > 1 {
+		errs = append(errs, errors.New("OTLP_RECEIVER_SAMPLE_RATE must be between 0 and 1"))
+	}
+	if c.OTLPReceiverForward && c.OTLPReceiverHTTPAddr != "" && sameLocalAddr(forward.Endpoint, c.OTLPReceiverHTTPAddr) {
+		errs = append(errs, errors.New("OTEL_EXPORTER_OTLP_ENDPOINT points at OTLP_RECEIVER_HTTP_ADDR, received telemetry would be forwarded to itself"))
+	}
+	return errors.Join(errs...)
+}
+
+// Counter is told how many items of a signal reached an outcome: received,
+// sampled_out, forwarded, forward_failed or dropped
+type Counter func(signal, outcome string, items int)
+
+// Receiver buffers what the services export and forwards it
+type Receiver struct {
+	cfg      Config
+	count    Counter
+	pipeline *pipeline
+	forward  *forwarder
+
+	mu    sync.Mutex
+	spans ring[span]
+	logs  ring[logRecord]
+}
+
+// span is a received span with what the correlator needs on top of tracewatch
+type span struct {
+	tracewatch.Span
+	start time.Time
+	attrs map[string]string
+}
+
+type logRecord struct {
+	time     time.Time
+	service  string
+	severity logspb.SeverityNumber
+	body     string
+	traceID  string
+}
+
+// New returns a receiver forwarding to forward when OTLP_RECEIVER_FORWARD is
+// set; count may be nil
+func New(cfg Config, forward telemetry.OTLPOptions, count Counter) (*Receiver, error) {
+	if err := cfg.validate(forward); err != nil {
+		return nil, err
+	}
+	p, err := newPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if count == nil {
+		count = func(string, string, int) {}
+	}
+	r := &Receiver{
+		cfg:      cfg,
+		count:    count,
+		pipeline: p,
+		spans:    newRing[span](cfg.OTLPReceiverBufferSize),
+		logs:     newRing[logRecord](cfg.OTLPReceiverBufferSize),
+	}
+	if cfg.OTLPReceiverForward {
+		r.forward = newForwarder(forward, cfg.OTLPReceiverQueueSize, count)
+	}
+	return r, nil
+}
+
+// consume runs one export request through the pipeline, tees it into the
+// buffers and queues what sampling keeps for forwarding
+func (r *Receiver) consume(signal string, msg proto.Message) {
+	r.pipeline.process(msg)
+	var items int
+	switch m := msg.(type) {
+	case *coltracepb.ExportTraceServiceRequest:
+		items = r.addSpans(m)
+	case *collogspb.ExportLogsServiceRequest:
+		items = r.addLogs(m)
+	case *colmetricspb.ExportMetricsServiceRequest:
+		for _, rm := range m.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				items += len(sm.Metrics)
+			}
+		}
+	}
+	r.count(signal, "received", items)
+	if r.forward == nil {
+		return
+	}
+	if dropped := r.pipeline.sample(msg); dropped > 0 {
+		r.count(signal, "sampled_out", dropped)
+		if items -= dropped; items == 0 {
+			return
+		}
+	}
+	r.forward.enqueue(signal, msg, items)
+}
+
+func (r *Receiver) addSpans(req *coltracepb.ExportTraceServiceRequest) int {
+	var spans []span
+	for _, rs := range req.ResourceSpans {
+		service := serviceName(rs.Resource)
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				start := time.Unix(0, int64(s.StartTimeUnixNano))
+				end := time.Unix(0, int64(s.EndTimeUnixNano))
+				spans = append(spans, span{
+					Span: tracewatch.Span{
+						TraceID:  hex.EncodeToString(s.TraceId),
+						SpanID:   hex.EncodeToString(s.SpanId),
+						ParentID: hex.EncodeToString(s.ParentSpanId),
+						Service:  service,
+						Name:     s.Name,
+						End:      end,
+						Duration: end.Sub(start),
+						Error:    s.Status.GetCode() == tracepb.Status_STATUS_CODE_ERROR,
+					},
+					start: start,
+					attrs: attributes(s.Attributes),
+				})
+			}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range spans {
+		r.spans.add(s)
+	}
+	return len(spans)
+}
+
+func (r *Receiver) addLogs(req *collogspb.ExportLogsServiceRequest) int {
+	var records []logRecord
+	for _, rl := range req.ResourceLogs {
+		service := serviceName(rl.Resource)
+		for _, sl := range rl.ScopeLogs {
+			for _, l := range sl.LogRecords {
+				ts := l.TimeUnixNano
+				if ts == 0 {
+					ts = l.ObservedTimeUnixNano
+				}
+				records = append(records, logRecord{
+					time:     time.Unix(0, int64(ts)),
+					service:  service,
+					severity: l.SeverityNumber,
+					body:     anyString(l.Body),
+					traceID:  hex.EncodeToString(l.TraceId),
+				})
+			}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range records {
+		r.logs.add(l)
+	}
+	return len(records)
+}
+
+// Cursor returns a span source of its own, which hands out every received
+// span once; the detector and the topology builder each need one
+func (r *Receiver) Cursor() tracewatch.SpanSource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &cursor{r: r, seq: r.spans.oldest()}
+}
+
+type cursor struct {
+	r   *Receiver
+	seq uint64
+}
+
+func (c *cursor) Spans(_ context.Context, _ time.Time) ([]tracewatch.Span, error) {
+	c.r.mu.Lock()
+	items, next := c.r.spans.since(c.seq)
+	c.r.mu.Unlock()
+	c.seq = next
+
+	spans := make([]tracewatch.Span, len(items))
+	for i, s := range items {
+		spans[i] = s.Span
+	}
+	return spans, nil
+}
+
+// ErrorSpans returns buffered error spans that ended in the window and carry attrs
+func (r *Receiver) ErrorSpans(_ context.Context, start, end time.Time, attrs map[string]string) ([]correlation.Span, error) {
+	r.mu.Lock()
+	items, _ := r.spans.since(0)
+	r.mu.Unlock()
+
+	var spans []correlation.Span
+next:
+	for _, s := range items {
+		if !s.Error || s.End.Before(start) || s.End.After(end) {
+			continue
+		}
+		for k, v := range attrs {
+			if s.attrs[k] != v {
+				continue next
+			}
+		}
+		spans = append(spans, correlation.Span{
+			TraceID:    s.TraceID,
+			SpanID:     s.SpanID,
+			Service:    s.Service,
+			Operation:  s.Name,
+			Duration:   s.Duration,
+			Start:      s.start,
+			Attributes: s.attrs,
+		})
+	}
+	return spans, nil
+}
+
+// ErrorLogs returns buffered log records at ERROR severity or above in the window
+func (r *Receiver) ErrorLogs(_ context.Context, start, end time.Time) ([]correlation.LogLine, error) {
+	r.mu.Lock()
+	items, _ := r.logs.since(0)
+	r.mu.Unlock()
+
+	var lines []correlation.LogLine
+	for _, l := range items {
+		if l.severity < logspb.SeverityNumber_SEVERITY_NUMBER_ERROR || l.time.Before(start) || l.time.After(end) {
+			continue
+		}
+		lines = append(lines, correlation.LogLine{Time: l.time, Service: l.service, Message: l.body, TraceID: l.traceID})
+	}
+	return lines, nil
+}
+
+// ring keeps the newest items and numbers every item ever added
+type ring[T any] struct {
+	items []T
+	next  uint64
+}
+
+func newRing[T any](size int) ring[T] {
+	return ring[T]{items: make([]T, size)}
+}
+
+func (r *ring[T]) add(v T) {
+	r.items[r.next%uint64(len(r.items))] = v
+	r.next++
+}
+
+// oldest is the number of the oldest item still kept
+func (r *ring[T]) oldest() uint64 {
+	if r.next < uint64(len(r.items)) {
+		return 0
+	}
+	return r.next - uint64(len(r.items))
+}
+
+// since returns the kept items numbered seq or later, oldest first, and the
+// number the next item will get
+func (r *ring[T]) since(seq uint64) ([]T, uint64) {
+	seq = max(seq, r.oldest())
+	out := make([]T, 0, r.next-min(seq, r.next))
+	for i := seq; i < r.next; i++ {
+		out = append(out, r.items[i%uint64(len(r.items))])
+	}
+	return out, r.next
+}
+
+func serviceName(res *resourcepb.Resource) string {
+	for _, kv := range res.GetAttributes() {
+		if kv.Key == "service.name" {
+			return anyString(kv.Value)
+		}
+	}
+	return "unknown"
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	if len(kvs) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		out[kv.Key] = anyString(kv.Value)
+	}
+	return out
+}
+
+// anyString renders scalar values as the SDK's attribute.Value.Emit does
+func anyString(v *commonpb.AnyValue) string {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return x.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(x.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(x.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(x.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(x.BytesValue)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// sameLocalAddr reports whether endpoint (host:port) reaches the local listen
+// address addr
+func sameLocalAddr(endpoint, addr string) bool {
+	eHost, ePort, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return false
+	}
+	aHost, aPort, err := net.SplitHostPort(addr)
+	if err != nil || ePort != aPort {
+		return false
+	}
+	local := func(h string) bool {
+		return h == "" || h == "localhost" || h == "0.0.0.0" || h == "::" || net.ParseIP(h).IsLoopback()
+	}
+	return eHost == aHost || (local(eHost) && local(aHost))
+}
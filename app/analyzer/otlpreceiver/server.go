@@ -0,0 +1,221 @@
+package otlpreceiver
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip-compressed exports
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"incident-simulation/pkg/grpcx"
+)
+
+// maxBodyBytes bounds one decompressed OTLP/HTTP request
+const maxBodyBytes = 32 << 20
+
+// Start listens on the configured addresses and serves until ctx is done;
+// it fails when a listener cannot be bound. Receiving is not traced, as its
+// spans would be sent along with the telemetry they describe.
+func (r *Receiver) Start(ctx context.Context) error {
+	var httpLn, grpcLn net.Listener
+	var err error
+	if r.cfg.OTLPReceiverHTTPAddr != "" {
+		if httpLn, err = net.Listen("tcp", r.cfg.OTLPReceiverHTTPAddr); err != nil {
+			return fmt.Errorf("otlp receiver: %w", err)
+		}
+	}
+	if r.cfg.OTLPReceiverGRPCAddr != "" {
+		if grpcLn, err = net.Listen("tcp", r.cfg.OTLPReceiverGRPCAddr); err != nil {
+			if httpLn != nil {
+				httpLn.Close()
+			}
+			return fmt.Errorf("otlp receiver: %w", err)
+		}
+	}
+
+	if r.forward != nil {
+		go r.forward.run(ctx)
+	}
+	if httpLn != nil {
+		server := &http.Server{Handler: r.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(httpLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("OTLP/HTTP receiver stopped: %v", err)
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+		log.Printf("📥 OTLP/HTTP receiver listening on %s", httpLn.Addr())
+	}
+	if grpcLn != nil {
+		server := grpcx.NewServer(r.cfg.GRPC, grpc.MaxRecvMsgSize(maxBodyBytes))
+		coltracepb.RegisterTraceServiceServer(server, traceServer{r: r})
+		colmetricspb.RegisterMetricsServiceServer(server, metricsServer{r: r})
+		collogspb.RegisterLogsServiceServer(server, logsServer{r: r})
+		go func() {
+			if err := server.Serve(grpcLn); err != nil {
+				log.Printf("OTLP/gRPC receiver stopped: %v", err)
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			server.GracefulStop()
+		}()
+		log.Printf("📥 OTLP/gRPC receiver listening on %s", grpcLn.Addr())
+	}
+	return nil
+}
+
+// Handler serves the OTLP/HTTP paths, in binary protobuf or JSON
+func (r *Receiver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/traces", r.httpExport(SignalTraces, func() (proto.Message, proto.Message) {
+		return &coltracepb.ExportTraceServiceRequest{}, &coltracepb.ExportTraceServiceResponse{}
+	}))
+	mux.Handle("POST /v1/metrics", r.httpExport(SignalMetrics, func() (proto.Message, proto.Message) {
+		return &colmetricspb.ExportMetricsServiceRequest{}, &colmetricspb.ExportMetricsServiceResponse{}
+	}))
+	mux.Handle("POST /v1/logs", r.httpExport(SignalLogs, func() (proto.Message, proto.Message) {
+		return &collogspb.ExportLogsServiceRequest{}, &collogspb.ExportLogsServiceResponse{}
+	}))
+	return mux
+}
+
+func (r *Receiver) httpExport(signal string, messages func() (req, resp proto.Message)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		isJSON := mediaType == "application/json"
+		if !isJSON && mediaType != "application/x-protobuf" {
+			http.Error(w, "Content-Type must be application/x-protobuf or application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := io.Reader(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = io.LimitReader(gz, maxBodyBytes)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		msg, resp := messages()
+		if isJSON {
+			if err = protojson.Unmarshal(data, msg); err == nil {
+				hexIDs(msg)
+			}
+		} else {
+			err = proto.Unmarshal(data, msg)
+		}
+		if err != nil {
+			http.Error(w, "invalid OTLP "+signal+" request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.consume(signal, msg)
+
+		var out []byte
+		if isJSON {
+			out, _ = protojson.Marshal(resp)
+		} else {
+			out, _ = proto.Marshal(resp)
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Write(out)
+	})
+}
+
+// hexIDs corrects the IDs of spans and log records in a JSON request: OTLP/JSON
+// encodes them in hex, which protojson read as base64. Hex digits are base64
+// characters and the IDs are whole base64 quanta, so re-encoding the decoded
+// bytes gives back the hex text.
+func hexIDs(msg proto.Message) {
+	fix := func(id *[]byte) {
+		if len(*id) == 0 {
+			return
+		}
+		if b, err := hex.DecodeString(base64.StdEncoding.EncodeToString(*id)); err == nil {
+			*id = b
+		}
+	}
+	switch m := msg.(type) {
+	case *coltracepb.ExportTraceServiceRequest:
+		for _, rs := range m.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					fix(&s.TraceId)
+					fix(&s.SpanId)
+					fix(&s.ParentSpanId)
+					for _, l := range s.Links {
+						fix(&l.TraceId)
+						fix(&l.SpanId)
+					}
+				}
+			}
+		}
+	case *collogspb.ExportLogsServiceRequest:
+		for _, rl := range m.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				for _, l := range sl.LogRecords {
+					fix(&l.TraceId)
+					fix(&l.SpanId)
+				}
+			}
+		}
+	}
+}
+
+type traceServer struct {
+	coltracepb.UnimplementedTraceServiceServer
+	r *Receiver
+}
+
+func (s traceServer) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.r.consume(SignalTraces, req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	r *Receiver
+}
+
+func (s metricsServer) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.r.consume(SignalMetrics, req)
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+type logsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	r *Receiver
+}
+
+func (s logsServer) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.r.consume(SignalLogs, req)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
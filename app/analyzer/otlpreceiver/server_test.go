@@ -0,0 +1,270 @@
+package otlpreceiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"incident-simulation/pkg/telemetry"
+)
+
+const (
+	testTraceID = "5b8efff798038103d269b633813fc60c"
+	testSpanID  = "eee19b7ec3c1b174"
+	testParent  = "eee19b7ec3c1b173"
+)
+
+var testEnd = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// counts records a Counter's calls by signal/outcome
+type counts struct {
+	mu sync.Mutex
+	n  map[string]int
+}
+
+func (c *counts) count(signal, outcome string, items int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n == nil {
+		c.n = make(map[string]int)
+	}
+	c.n[signal+"/"+outcome] += items
+}
+
+func (c *counts) get(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n[key]
+}
+
+// newTestReceiver buffers what it receives and forwards nothing
+func newTestReceiver(t *testing.T) (*Receiver, *counts) {
+	t.Helper()
+	c := &counts{}
+	r, err := New(Config{OTLPReceiverBufferSize: 100, OTLPReceiverQueueSize: 10, OTLPReceiverSampleRate: 1}, telemetry.OTLPOptions{}, c.count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, c
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// traceRequest holds one failed span of core-api-service with traceID
+func traceRequest(traceID string) *coltracepb.ExportTraceServiceRequest {
+	return &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "core-api-service"}}},
+		}},
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+			TraceId:           mustHex(traceID),
+			SpanId:            mustHex(testSpanID),
+			ParentSpanId:      mustHex(testParent),
+			Name:              "Process Transaction",
+			StartTimeUnixNano: uint64(testEnd.Add(-250 * time.Millisecond).UnixNano()),
+			EndTimeUnixNano:   uint64(testEnd.UnixNano()),
+			Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR},
+			Attributes: []*commonpb.KeyValue{
+				{Key: "http.response.status_code", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 500}}},
+			},
+		}}}},
+	}}}
+}
+
+// OTLP/JSON of traceRequest(testTraceID): IDs in hex, 64-bit integers as strings
+const traceJSON = `{"resourceSpans":[{
+	"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"core-api-service"}}]},
+	"scopeSpans":[{"spans":[{
+		"traceId":"` + testTraceID + `","spanId":"` + testSpanID + `","parentSpanId":"` + testParent + `",
+		"name":"Process Transaction",
+		"startTimeUnixNano":"1704110399750000000","endTimeUnixNano":"1704110400000000000",
+		"status":{"code":2},
+		"attributes":[{"key":"http.response.status_code","value":{"intValue":"500"}}]
+	}]}]
+}]}`
+
+const logsJSON = `{"resourceLogs":[{
+	"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"database-service"}}]},
+	"scopeLogs":[{"logRecords":[{
+		"timeUnixNano":"1704110400000000000","severityNumber":17,
+		"body":{"stringValue":"deadlock detected"},
+		"traceId":"` + testTraceID + `","spanId":"` + testSpanID + `"
+	}]}]
+}]}`
+
+func mustMarshal(t *testing.T, m proto.Message) string {
+	t.Helper()
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func gzipped(s string) string {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	gz.Write([]byte(s))
+	gz.Close()
+	return b.String()
+}
+
+func TestHTTPTraces(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        func(t *testing.T) string
+	}{
+		{"protobuf", "application/x-protobuf", "", func(t *testing.T) string { return mustMarshal(t, traceRequest(testTraceID)) }},
+		{"gzip protobuf", "application/x-protobuf", "gzip", func(t *testing.T) string { return gzipped(mustMarshal(t, traceRequest(testTraceID))) }},
+		{"json", "application/json", "", func(*testing.T) string { return traceJSON }},
+		{"json with charset", "application/json; charset=utf-8", "", func(*testing.T) string { return traceJSON }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, c := newTestReceiver(t)
+			req := httptest.NewRequest(http.MethodPost, "/v1/traces", strings.NewReader(tc.body(t)))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			rec := httptest.NewRecorder()
+			r.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+			if got, want := rec.Header().Get("Content-Type"), strings.Split(tc.contentType, ";")[0]; got != want {
+				t.Errorf("response Content-Type = %q, want %q", got, want)
+			}
+			if n := c.get("traces/received"); n != 1 {
+				t.Errorf("%d spans counted received, want 1", n)
+			}
+
+			spans, _ := r.Cursor().Spans(context.Background(), time.Time{})
+			if len(spans) != 1 {
+				t.Fatalf("%d spans buffered, want 1", len(spans))
+			}
+			s := spans[0]
+			if s.TraceID != testTraceID || s.SpanID != testSpanID || s.ParentID != testParent {
+				t.Errorf("IDs %s/%s/%s, want %s/%s/%s", s.TraceID, s.SpanID, s.ParentID, testTraceID, testSpanID, testParent)
+			}
+			if s.Service != "core-api-service" || s.Name != "Process Transaction" || !s.Error || s.Duration != 250*time.Millisecond {
+				t.Errorf("span %+v", s)
+			}
+
+			errs, _ := r.ErrorSpans(context.Background(), testEnd.Add(-time.Minute), testEnd, map[string]string{"http.response.status_code": "500"})
+			if len(errs) != 1 || errs[0].TraceID != testTraceID {
+				t.Errorf("ErrorSpans() = %+v, want the span", errs)
+			}
+		})
+	}
+}
+
+func TestHTTPLogsJSON(t *testing.T) {
+	r, _ := newTestReceiver(t)
+	req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader(logsJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+
+	lines, _ := r.ErrorLogs(context.Background(), testEnd.Add(-time.Minute), testEnd)
+	if len(lines) != 1 {
+		t.Fatalf("%d error logs, want 1", len(lines))
+	}
+	if l := lines[0]; l.TraceID != testTraceID || l.Service != "database-service" || l.Message != "deadlock detected" {
+		t.Errorf("log line %+v", l)
+	}
+}
+
+func TestHexIDs(t *testing.T) {
+	req := traceRequest(testTraceID)
+	s := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	s.Links = []*tracepb.Span_Link{{TraceId: mustHex(testTraceID), SpanId: mustHex(testSpanID)}}
+	ids := []struct {
+		name string
+		id   *[]byte
+		want string
+	}{
+		{"trace", &s.TraceId, testTraceID},
+		{"span", &s.SpanId, testSpanID},
+		{"parent", &s.ParentSpanId, testParent},
+		{"link trace", &s.Links[0].TraceId, testTraceID},
+		{"link span", &s.Links[0].SpanId, testSpanID},
+	}
+	// What protojson makes of hex IDs: their text read as base64
+	for _, id := range ids {
+		b, err := base64.StdEncoding.DecodeString(id.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*id.id = b
+	}
+
+	hexIDs(req)
+	for _, id := range ids {
+		if got := hex.EncodeToString(*id.id); got != id.want {
+			t.Errorf("%s ID = %s, want %s", id.name, got, id.want)
+		}
+	}
+}
+
+func TestHTTPRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		encoding    string
+		body        string
+		want        int
+	}{
+		{"text body", http.MethodPost, "/v1/traces", "text/plain", "", "hello", http.StatusUnsupportedMediaType},
+		{"invalid protobuf", http.MethodPost, "/v1/traces", "application/x-protobuf", "", "\xff\xff\xff", http.StatusBadRequest},
+		{"invalid json", http.MethodPost, "/v1/metrics", "application/json", "", `{"resourceMetrics":`, http.StatusBadRequest},
+		{"unknown json field", http.MethodPost, "/v1/logs", "application/json", "", `{"resourceLogz":[]}`, http.StatusBadRequest},
+		{"invalid gzip", http.MethodPost, "/v1/traces", "application/x-protobuf", "gzip", "not gzip", http.StatusBadRequest},
+		{"GET", http.MethodGet, "/v1/traces", "application/json", "", "", http.StatusMethodNotAllowed},
+		{"unknown signal", http.MethodPost, "/v1/profiles", "application/json", "", "{}", http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, c := newTestReceiver(t)
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			rec := httptest.NewRecorder()
+			r.Handler().ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tc.want, rec.Body)
+			}
+			if len(c.n) != 0 {
+				t.Errorf("rejected request counted: %v", c.n)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// promClient runs instant queries against the Prometheus HTTP API
+type promClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// promSample is one element of an instant vector
+type promSample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+type promResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// query evaluates expr at the given time
+func (p *promClient) query(ctx context.Context, expr string, at time.Time) ([]promSample, error) {
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("time", strconv.FormatInt(at.Unix(), 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.baseURL, "/")+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body promResponse
+	if err := jsonx.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode prometheus response: %w", err)
+	}
+	if body.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", body.Error)
+	}
+	if body.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("prometheus returned %s, want vector", body.Data.ResultType)
+	}
+
+	samples := make([]promSample, 0, len(body.Data.Result))
+	for _, r := range body.Data.Result {
+		s, _ := r.Value[1].(string)
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		samples = append(samples, promSample{Labels: r.Metric, Value: v})
+	}
+	return samples, nil
+}
@@ -0,0 +1,313 @@
+// Package remediation runs configured actions against the services' admin
+// APIs, automatically when an incident of a matching class opens or on demand.
+//
+// An action is one HTTP request, such as clearing the database incident,
+// turning off a feature flag or scaling the connection pool. Its URL and body
+// may use {incident_id}, {class} and {service}. Every run is a span, so the
+// admin call joins the incident's trace, and an audit log record.
+package remediation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// Triggers and outcomes of an execution
+const (
+	TriggerAuto   = "auto"
+	TriggerManual = "manual"
+
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDryRun  = "dry_run"
+)
+
+const maxRecent = 200
+
+// ErrUnknownAction is returned for an action name that is not configured
+var ErrUnknownAction = errors.New("unknown remediation action")
+
+// Action is one remediation request
+type Action struct {
+	Name        string        `yaml:"name" json:"name"`
+	Description string        `yaml:"description" json:"description,omitempty"`
+	Classes     []string      `yaml:"classes" json:"classes"`
+	Services    []string      `yaml:"services" json:"services,omitempty"` // empty matches every service
+	Method      string        `yaml:"method" json:"method"`
+	URL         string        `yaml:"url" json:"url"`
+	Body        string        `yaml:"body" json:"body,omitempty"`
+	Auto        bool          `yaml:"auto" json:"auto"`         // run when a matching incident opens
+	Cooldown    time.Duration `yaml:"cooldown" json:"cooldown"` // between automatic runs per service
+}
+
+func (a *Action) validate() error {
+	if a.Name == "" || a.URL == "" {
+		return errors.New("name and url are required")
+	}
+	if len(a.Classes) == 0 {
+		return errors.New("at least one class is required")
+	}
+	if a.Method == "" {
+		a.Method = http.MethodPost
+	}
+	if a.Cooldown == 0 {
+		a.Cooldown = 5 * time.Minute
+	}
+	return nil
+}
+
+func (a Action) matches(t Target) bool {
+	class := false
+	for _, c := range a.Classes {
+		class = class || c == t.Class
+	}
+	if !class {
+		return false
+	}
+	if len(a.Services) == 0 {
+		return true
+	}
+	for _, s := range a.Services {
+		if s == t.Service {
+			return true
+		}
+	}
+	return false
+}
+
+// Target is the incident an action runs for
+type Target struct {
+	IncidentID string
+	Class      string
+	Service    string
+}
+
+// Execution records one run of an action
+type Execution struct {
+	Action     string    `json:"action"`
+	IncidentID string    `json:"incident_id"`
+	Trigger    string    `json:"trigger"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Outcome    string    `json:"outcome"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Response   string    `json:"response,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	TraceID    string    `json:"trace_id,omitempty"`
+}
+
+// Config is how the analyzer enables remediation
+type Config struct {
+	RemediationsFile   string        `env:"REMEDIATIONS_FILE" flag:"remediations-file" usage:"YAML file with remediation actions (empty disables remediation)"`
+	RemediationDryRun  bool          `env:"REMEDIATION_DRY_RUN" flag:"remediation-dry-run" usage:"Record remediation runs without calling the services"`
+	RemediationTimeout time.Duration `env:"REMEDIATION_TIMEOUT" flag:"remediation-timeout" default:"10s" usage:"Time limit for one remediation request"`
+}
+
+// Engine holds the actions and the history of their runs
+type Engine struct {
+	actions []Action
+	client  *http.Client
+	dryRun  bool
+	timeout time.Duration
+	onDone  func(context.Context, Execution)
+
+	mu      sync.Mutex
+	lastRun map[string]time.Time // action/service -> last automatic run
+	recent  []Execution
+}
+
+// Load reads the actions in cfg.RemediationsFile; onDone is called after every run
+func Load(cfg Config, client *http.Client, onDone func(context.Context, Execution)) (*Engine, error) {
+	data, err := os.ReadFile(cfg.RemediationsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read remediations: %w", err)
+	}
+	var file struct {
+		Actions []Action `yaml:"actions"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse remediations %s: %w", cfg.RemediationsFile, err)
+	}
+	seen := make(map[string]bool)
+	for i := range file.Actions {
+		a := &file.Actions[i]
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("remediation %q: %w", a.Name, err)
+		}
+		if seen[a.Name] {
+			return nil, fmt.Errorf("remediation %q is defined twice", a.Name)
+		}
+		seen[a.Name] = true
+	}
+	return &Engine{
+		actions: file.Actions,
+		client:  client,
+		dryRun:  cfg.RemediationDryRun,
+		timeout: cfg.RemediationTimeout,
+		onDone:  onDone,
+		lastRun: make(map[string]time.Time),
+	}, nil
+}
+
+// Actions returns the configured actions in file order
+func (e *Engine) Actions() []Action {
+	return e.actions
+}
+
+// Recent returns up to limit executions, newest first
+func (e *Engine) Recent(limit int) []Execution {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Execution, 0, min(limit, len(e.recent)))
+	for i := len(e.recent) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, e.recent[i])
+	}
+	return out
+}
+
+// OnIncident starts the automatic actions matching a newly opened incident,
+// skipping those still cooling down for the service
+func (e *Engine) OnIncident(ctx context.Context, t Target) {
+	now := time.Now()
+	for _, a := range e.actions {
+		if !a.Auto || !a.matches(t) {
+			continue
+		}
+		key := a.Name + "/" + t.Service
+		e.mu.Lock()
+		last, ran := e.lastRun[key]
+		if ran && now.Sub(last) < a.Cooldown {
+			e.mu.Unlock()
+			logx.Infow(ctx, "⏳ Remediation skipped during cooldown", "remediation.action", a.Name, "incident.id", t.IncidentID,
+				"cooldown_remaining", (a.Cooldown - now.Sub(last)).Round(time.Second).String())
+			continue
+		}
+		e.lastRun[key] = now
+		e.mu.Unlock()
+
+		// The incident request may finish first; the run stays in its trace
+		go e.execute(context.WithoutCancel(ctx), a, t, TriggerAuto)
+	}
+}
+
+// Run executes the named action for t now, whatever its class, Auto flag or cooldown
+func (e *Engine) Run(ctx context.Context, name string, t Target) (Execution, error) {
+	for _, a := range e.actions {
+		if a.Name == name {
+			return e.execute(ctx, a, t, TriggerManual), nil
+		}
+	}
+	return Execution{}, ErrUnknownAction
+}
+
+func (e *Engine) execute(ctx context.Context, a Action, t Target, trigger string) Execution {
+	replacer := strings.NewReplacer("{incident_id}", t.IncidentID, "{class}", t.Class, "{service}", t.Service)
+	url, body := replacer.Replace(a.URL), replacer.Replace(a.Body)
+
+	ctx, span := otel.Tracer("analyzer-service").Start(ctx, "Remediation "+a.Name, trace.WithAttributes(
+		attribute.String("remediation.action", a.Name),
+		attribute.String("remediation.trigger", trigger),
+		attribute.Bool("remediation.dry_run", e.dryRun),
+		attribute.String("incident.id", t.IncidentID),
+		attrs.IncidentType(t.Class),
+		semconv.HTTPRequestMethodKey.String(a.Method),
+		semconv.URLFull(url),
+	))
+	defer span.End()
+
+	start := time.Now()
+	ex := Execution{
+		Action:     a.Name,
+		IncidentID: t.IncidentID,
+		Trigger:    trigger,
+		Time:       start.UTC(),
+		Method:     a.Method,
+		URL:        url,
+		Outcome:    OutcomeSuccess,
+		TraceID:    span.SpanContext().TraceID().String(),
+	}
+
+	if e.dryRun {
+		ex.Outcome = OutcomeDryRun
+	} else if err := e.call(ctx, a.Method, url, body, &ex); err != nil {
+		ex.Outcome, ex.Error = OutcomeFailure, err.Error()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	ex.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	span.SetAttributes(attribute.String("remediation.outcome", ex.Outcome))
+	if ex.StatusCode != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(ex.StatusCode))
+	}
+
+	audit.Warn(ctx, "remediation.executed", "🛠️ Remediation executed", "remediation.action", a.Name, "remediation.trigger", trigger,
+		"remediation.outcome", ex.Outcome, "incident.id", t.IncidentID, "http.request.method", a.Method, "url.full", url,
+		"http.response.status_code", ex.StatusCode, "error", ex.Error)
+
+	e.mu.Lock()
+	e.recent = append(e.recent, ex)
+	if len(e.recent) > maxRecent {
+		e.recent = e.recent[len(e.recent)-maxRecent:]
+	}
+	e.mu.Unlock()
+	if e.onDone != nil {
+		e.onDone(ctx, ex)
+	}
+	return ex
+}
+
+// call sends the request, keeping the start of the response for the record
+func (e *Engine) call(ctx context.Context, method, url, body string, ex *Execution) error {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	ex.StatusCode, ex.Response = resp.StatusCode, strings.TrimSpace(string(msg))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned %d", method, url, resp.StatusCode)
+	}
+	return nil
+}
+
+// MarshalJSON writes the cooldown as a duration string
+func (a Action) MarshalJSON() ([]byte, error) {
+	type plain Action
+	return jsonx.Marshal(struct {
+		plain
+		Cooldown string `json:"cooldown"`
+	}{plain(a), a.Cooldown.String()})
+}
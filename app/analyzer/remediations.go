@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"analyzer-service/remediation"
+	"incident-simulation/pkg/logx"
+)
+
+// remediationTimeline counts every remediation run and adds it to its incident's timeline
+func remediationTimeline(store *Store) func(context.Context, remediation.Execution) {
+	return func(ctx context.Context, ex remediation.Execution) {
+		remediationRuns.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("action", ex.Action),
+			attribute.String("trigger", ex.Trigger),
+			attribute.String("outcome", ex.Outcome),
+		))
+
+		detail := fmt.Sprintf("%s (%s): %s %s -> %s", ex.Action, ex.Trigger, ex.Method, ex.URL, ex.Outcome)
+		if ex.Error != "" {
+			detail += ": " + ex.Error
+		}
+		_, err := store.Update(ex.IncidentID, func(inc *Incident) error {
+			inc.record("remediation", detail, ex.Time)
+			return nil
+		})
+		if err != nil {
+			logx.Errorw(ctx, "❌ Failed to record remediation", "incident.id", ex.IncidentID, "remediation.action", ex.Action, "error", err)
+		}
+	}
+}
+
+// incidentOpened counts a new incident and starts its automatic remediations
+func incidentOpened(ctx context.Context, remediator *remediation.Engine, inc Incident) {
+	incidentsOpened.Add(ctx, 1, incidentAttributes(inc))
+	if remediator != nil {
+		remediator.OnIncident(ctx, remediationTarget(inc))
+	}
+}
+
+func remediationTarget(inc Incident) remediation.Target {
+	return remediation.Target{IncidentID: inc.ID, Class: inc.Type, Service: inc.Service}
+}
+
+// listRemediations returns the configured actions and their recent runs
+func (a *api) listRemediations(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Remediations")
+	defer span.End()
+
+	actions, executions := []remediation.Action{}, []remediation.Execution{}
+	if a.remediator != nil {
+		actions, executions = a.remediator.Actions(), a.remediator.Recent(a.maxLimit)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"actions": actions, "executions": executions})
+}
+
+// runRemediation executes an action for an incident on demand and waits for it
+func (a *api) runRemediation(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Run Remediation")
+	defer span.End()
+
+	id, name := r.PathValue("id"), r.PathValue("action")
+	span.SetAttributes(attribute.String("incident.id", id), attribute.String("remediation.action", name))
+	if a.remediator == nil {
+		writeError(w, r, http.StatusNotFound, "remediation is not configured")
+		return
+	}
+	inc, err := a.store.Get(id)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	ex, err := a.remediator.Run(ctx, name, remediationTarget(inc))
+	if errors.Is(err, remediation.ErrUnknownAction) {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	status := http.StatusOK
+	if ex.Outcome == remediation.OutcomeFailure {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, ex)
+}
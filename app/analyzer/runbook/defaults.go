@@ -0,0 +1,159 @@
+package runbook
+
+// Defaults cover the incidents the simulated services inject and the ones the
+// analyzer opens itself
+var Defaults = []Runbook{
+	{
+		Name:     "database-connectivity",
+		Title:    "Database unreachable or timing out",
+		Classes:  []string{"connection_timeout", "connection_refused"},
+		Services: []string{"database-service"},
+		Steps: []Step{
+			{Title: "Confirm the database answers health checks", Command: "curl -s localhost:8081/db/health"},
+			{Title: "Check whether the simulator reports an active incident", Command: "curl -s localhost:8081/db/events"},
+			{Title: "Compare core-api errors with database errors", Detail: "If only core-api-service fails, look at its client timeouts and circuit breaker rather than the database"},
+			{Title: "Wait for the incident to clear or restart the database service", Detail: "Simulated connectivity incidents last 15-90 seconds"},
+		},
+	},
+	{
+		Name:     "database-slowdown",
+		Title:    "Slow or deadlocked database queries",
+		Classes:  []string{"high_latency", "deadlock", "database_slowdown"},
+		Services: []string{"database-service", "core-api-service"},
+		Steps: []Step{
+			{Title: "Find which operations are slow", Detail: "Break db_query_duration_seconds down by db.operation; deadlocks hit transfer, deposit and withdrawal hardest"},
+			{Title: "Open an example trace", Command: "curl -s localhost:8084/api/v1/trace-anomalies"},
+			{Title: "Check pool wait time", Detail: "A rising db_pool_wait_duration_seconds means slow queries are holding connections"},
+			{Title: "Shed write traffic until latency recovers", Detail: "Lower the load generator rate or pause transfer scenarios"},
+		},
+	},
+	{
+		Name:     "database-disk-full",
+		Title:    "Database writes failing on a full disk",
+		Classes:  []string{"disk_full"},
+		Services: []string{"database-service"},
+		Steps: []Step{
+			{Title: "Confirm only writes fail", Detail: "get_balance keeps working while transfer, deposit and withdrawal error"},
+			{Title: "Free space or fail writes over to a replica"},
+			{Title: "Replay rejected transfers once writes succeed again"},
+		},
+	},
+	{
+		Name:     "database-bad-instance",
+		Title:    "One database replica failing while the others are healthy",
+		Classes:  []string{"bad_instance"},
+		Services: []string{"database-service"},
+		Steps: []Step{
+			{Title: "Split errors and latency by instance", Detail: "Break db_queries_total and db_query_duration_seconds down by instance (service.instance.id); a bad one stands out while the rest stay flat"},
+			{Title: "Confirm the spread matches the replica count", Detail: "Behind the DB_INSTANCES balancer roughly 1/N of requests fail"},
+			{Title: "Restart or drain the bad replica", Detail: "Killing its process makes the supervisor start a fresh one on the same port"},
+		},
+	},
+	{
+		Name:    "connection-pool-exhaustion",
+		Title:   "Connection pool exhausted",
+		Classes: []string{"pool_exhaustion", "downstream_saturation"},
+		Steps: []Step{
+			{Title: "Check pool saturation and rejections", Detail: "db_pool_exhausted_total rising with db_pool_saturation near 1 means callers queue for connections"},
+			{Title: "Look for leaked or long-held connections", Detail: "Long database spans under one parent point at the caller holding connections"},
+			{Title: "Raise DB_POOL_MAX_CONNECTIONS or cut concurrency upstream"},
+		},
+	},
+	{
+		Name:     "retry-storm",
+		Title:    "Callers retrying a failing database into a storm",
+		Classes:  []string{"error_storm"},
+		Services: []string{"core-api-service", "database-service"},
+		Steps: []Step{
+			{Title: "Compare attempts with calls", Detail: "db_call_retry_amplification near DB_CALL_ATTEMPTS means nearly every call is retried; db_call_retries_total by reason shows what the database answered"},
+			{Title: "Check whether the load outlasts the outage", Detail: "db_errors_total with error_type=error_storm stops when the storm ends; errors that go on at the amplified rate are the retries themselves"},
+			{Title: "Cut the retries", Detail: "Lower DB_CALL_ATTEMPTS, or raise DB_RETRY_BACKOFF so callers stop coming back in step"},
+		},
+	},
+	{
+		Name:     "resource-exhaustion",
+		Title:    "Service leaking memory or goroutines, or burning CPU",
+		Classes:  []string{"memory_leak", "cpu_spin", "goroutine_leak"},
+		Services: []string{"database-service"},
+		Steps: []Step{
+			{Title: "Check the runtime metrics", Detail: "go.memory.used climbing without a drop after GC points at a leak; high go.schedule.duration with flat traffic points at CPU spin; db_goroutine_growth_per_minute staying positive points at a goroutine leak"},
+			{Title: "Take a heap or CPU profile", Command: "go tool pprof -top http://localhost:6061/debug/pprof/heap", Detail: "Needs PPROF_ENABLED=true; use /debug/pprof/profile?seconds=10 for CPU and /debug/pprof/goroutine?debug=1 for blocked goroutines"},
+			{Title: "Restart the service if memory nears its limit", Detail: "Simulated leaks are released when the incident resolves"},
+		},
+	},
+	{
+		Name:     "connection-churn",
+		Title:    "Callers reconnecting for every request",
+		Classes:  []string{"connection_churn"},
+		Services: []string{"core-api-service", "database-service"},
+		Steps: []Step{
+			{Title: "Confirm connections are not reused", Detail: "http_client_connections_total with reused=false near the request rate, and http_client_dial_duration_seconds climbing"},
+			{Title: "Check keep-alives on both ends", Detail: "HTTP_CLIENT_KEEP_ALIVES=false on the caller or a server answering Connection: close forces a dial per request"},
+			{Title: "Raise HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST if the pool is too small for the concurrency"},
+		},
+	},
+	{
+		Name:     "outbox-lag",
+		Title:    "Outbox events published late",
+		Classes:  []string{"poller_stall", "slow_publish"},
+		Services: []string{"worker-service", "database-service"},
+		Steps: []Step{
+			{Title: "Check the worker's health", Command: "curl -s localhost:8085/worker/health"},
+			{Title: "Tell a stalled poller from a slow one", Detail: "worker_outbox_last_poll_age_seconds climbing means no polls at all; steady polls with a rising worker_outbox_lag_seconds mean publishing is slow"},
+			{Title: "Watch the backlog drain", Detail: "db_outbox_oldest_event_age_seconds is the replication lag; db_outbox_dropped_total rising means events are being lost"},
+			{Title: "Restart the worker if it stays stalled", Detail: "Pending events stay in the outbox and are published once it polls again"},
+		},
+	},
+	{
+		Name:     "payment-provider-degradation",
+		Title:    "Payment gateway degraded",
+		Classes:  []string{"three_ds_timeout", "fraud_hold", "partial_outage", "throttling"},
+		Services: []string{"payment-gateway", "core-api-service"},
+		Steps: []Step{
+			{Title: "Check the gateway health", Command: "curl -s localhost:8082/payments/health"},
+			{Title: "Split failures by decline reason", Detail: "Throttling and partial outages are retryable; fraud holds and 3DS timeouts need the customer"},
+			{Title: "Back off retries to the provider", Detail: "Retrying throttled payments lengthens the incident"},
+		},
+	},
+	{
+		Name:     "token-validation-failures",
+		Title:    "Tokens rejected after clock skew or key rotation",
+		Classes:  []string{"clock_skew", "key_rotation"},
+		Services: []string{"auth-service", "core-api-service"},
+		Steps: []Step{
+			{Title: "Check the published signing keys", Command: "curl -s localhost:8083/.well-known/jwks.json"},
+			{Title: "Compare token iat/exp with the server clock", Detail: "Tokens issued in the future point at clock skew"},
+			{Title: "Refresh the verifier's key cache", Detail: "After a rotation, verifiers holding the old JWKS reject every new token"},
+		},
+	},
+	{
+		Name:    "validation-storm",
+		Title:   "Upstream sending invalid requests",
+		Classes: []string{"upstream_validation_storm"},
+		Steps: []Step{
+			{Title: "Find the client sending invalid requests", Detail: "Break api_validation_errors_total down by field and look up the callers in example traces"},
+			{Title: "Rate-limit or block the offending client"},
+			{Title: "Do not page the service owners", Detail: "The service is rejecting bad input as designed"},
+		},
+	},
+	{
+		Name:    "new-error-signature",
+		Title:   "New or surging error log signature",
+		Classes: []string{"novel_error_signature", "error_signature_spike", "unclassified_errors"},
+		Steps: []Step{
+			{Title: "Read the cluster's template and example", Command: "curl -s localhost:8084/api/v1/log-clusters"},
+			{Title: "Open one of the cluster's traces", Detail: "The cluster keeps a few trace IDs of matching logs"},
+			{Title: "Ask the analyzer what changed", Command: `curl -N localhost:8084/chat -d '{"messages":[{"role":"user","content":"what changed in the last 15 minutes?"}]}'`},
+		},
+	},
+	{
+		Name:    "trace-anomaly",
+		Title:   "Spans slower than usual or a changed call graph",
+		Classes: []string{"span_latency_anomaly", "trace_structure_change"},
+		Steps: []Step{
+			{Title: "Read the anomaly and its example traces", Command: "curl -s localhost:8084/api/v1/trace-anomalies"},
+			{Title: "Compare with the operation's baseline", Command: "curl -s localhost:8084/api/v1/trace-operations"},
+			{Title: "Check for a deploy or configuration change", Detail: "A new or missing child span usually means the code path changed"},
+		},
+	},
+}
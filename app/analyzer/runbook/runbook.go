@@ -0,0 +1,232 @@
+// Package runbook keeps remediation runbooks keyed on incident classification.
+//
+// A runbook lists the incident types or classes it applies to (the
+// simulator's incident_type label, the classifier's class, or the analyzer's
+// own log cluster and trace anomaly types), optionally narrowed to some
+// services, and the steps an operator takes. The library starts from a
+// built-in set; once it is edited it lives in a YAML file that replaces the
+// built-ins entirely.
+package runbook
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Step is one remediation action
+type Step struct {
+	Title   string `yaml:"title" json:"title"`
+	Detail  string `yaml:"detail,omitempty" json:"detail,omitempty"`
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// Runbook is a named list of steps for some incident classes
+type Runbook struct {
+	Name     string   `yaml:"name" json:"name"`
+	Title    string   `yaml:"title" json:"title"`
+	Classes  []string `yaml:"classes" json:"classes"`
+	Services []string `yaml:"services,omitempty" json:"services,omitempty"` // empty matches every service
+	Steps    []Step   `yaml:"steps" json:"steps"`
+	Links    []string `yaml:"links,omitempty" json:"links,omitempty"`
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Validate checks the fields a runbook needs to be matched and followed
+func (rb Runbook) Validate() error {
+	var errs []error
+	if !namePattern.MatchString(rb.Name) {
+		errs = append(errs, errors.New("name must be lowercase letters, digits and dashes"))
+	}
+	if rb.Title == "" {
+		errs = append(errs, errors.New("title is required"))
+	}
+	if len(rb.Classes) == 0 {
+		errs = append(errs, errors.New("at least one class is required"))
+	}
+	if len(rb.Steps) == 0 {
+		errs = append(errs, errors.New("at least one step is required"))
+	}
+	for i, s := range rb.Steps {
+		if s.Title == "" {
+			errs = append(errs, fmt.Errorf("step %d needs a title", i+1))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// matches reports whether the runbook applies and whether it names the service
+func (rb Runbook) matches(class, service string) (ok, specific bool) {
+	found := false
+	for _, c := range rb.Classes {
+		found = found || c == class
+	}
+	if !found {
+		return false, false
+	}
+	if len(rb.Services) == 0 {
+		return true, false
+	}
+	for _, s := range rb.Services {
+		if s == service {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// Library holds the runbooks and persists edits to a YAML file
+type Library struct {
+	path string
+
+	mu       sync.RWMutex
+	runbooks map[string]Runbook
+}
+
+type file struct {
+	Runbooks []Runbook `yaml:"runbooks"`
+}
+
+// Load reads the runbooks at path, or starts from the built-in set when the
+// file does not exist yet; an empty path keeps edits in memory
+func Load(path string) (*Library, error) {
+	l := &Library{path: path, runbooks: make(map[string]Runbook)}
+	runbooks := Defaults
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("read runbooks: %w", err)
+		default:
+			var f file
+			if err := yaml.Unmarshal(data, &f); err != nil {
+				return nil, fmt.Errorf("parse runbooks %s: %w", path, err)
+			}
+			runbooks = f.Runbooks
+		}
+	}
+
+	for _, rb := range runbooks {
+		if err := rb.Validate(); err != nil {
+			return nil, fmt.Errorf("runbook %q: %w", rb.Name, err)
+		}
+		l.runbooks[rb.Name] = rb
+	}
+	return l, nil
+}
+
+// Match returns the runbooks for an incident class, those written for the
+// service first
+func (l *Library) Match(class, service string) []Runbook {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var specific, generic []Runbook
+	for _, rb := range l.sorted() {
+		switch ok, forService := rb.matches(class, service); {
+		case forService:
+			specific = append(specific, rb)
+		case ok:
+			generic = append(generic, rb)
+		}
+	}
+	return append(specific, generic...)
+}
+
+// List returns every runbook by name
+func (l *Library) List() []Runbook {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sorted()
+}
+
+// Get returns the runbook called name
+func (l *Library) Get(name string) (Runbook, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	rb, ok := l.runbooks[name]
+	return rb, ok
+}
+
+// Put adds or replaces a runbook and saves the library; the boolean reports
+// whether it is new
+func (l *Library) Put(rb Runbook) (bool, error) {
+	if err := rb.Validate(); err != nil {
+		return false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous, existed := l.runbooks[rb.Name]
+	l.runbooks[rb.Name] = rb
+	if err := l.save(); err != nil {
+		if existed {
+			l.runbooks[rb.Name] = previous
+		} else {
+			delete(l.runbooks, rb.Name)
+		}
+		return false, err
+	}
+	return !existed, nil
+}
+
+// Delete removes a runbook and saves the library; the boolean reports whether
+// it existed
+func (l *Library) Delete(name string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous, existed := l.runbooks[name]
+	if !existed {
+		return false, nil
+	}
+	delete(l.runbooks, name)
+	if err := l.save(); err != nil {
+		l.runbooks[name] = previous
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *Library) sorted() []Runbook {
+	out := make([]Runbook, 0, len(l.runbooks))
+	for _, rb := range l.runbooks {
+		out = append(out, rb)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// save writes the whole library to the file atomically; callers hold mu
+func (l *Library) save() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(file{Runbooks: l.sorted()})
+	if err != nil {
+		return fmt.Errorf("encode runbooks: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return fmt.Errorf("save runbooks: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save runbooks: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save runbooks: %w", err)
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"analyzer-service/runbook"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// listRunbooks returns every runbook, or those matching ?class= and ?service=
+func (a *api) listRunbooks(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Runbooks")
+	defer span.End()
+
+	var runbooks []runbook.Runbook
+	if class := r.URL.Query().Get("class"); class != "" {
+		runbooks = a.runbooks.Match(class, r.URL.Query().Get("service"))
+	} else {
+		runbooks = a.runbooks.List()
+	}
+	if runbooks == nil {
+		runbooks = []runbook.Runbook{}
+	}
+	span.SetAttributes(attribute.Int("runbook.count", len(runbooks)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"runbooks": runbooks})
+}
+
+func (a *api) getRunbook(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "Get Runbook")
+	defer span.End()
+
+	name := r.PathValue("name")
+	span.SetAttributes(attribute.String("runbook.name", name))
+	rb, ok := a.runbooks.Get(name)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "runbook not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, rb)
+}
+
+// putRunbook adds or replaces the runbook named in the path. Incidents keep
+// the runbooks they opened with.
+func (a *api) putRunbook(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Put Runbook")
+	defer span.End()
+
+	var rb runbook.Runbook
+	if err := jsonx.NewDecoder(r.Body).Decode(&rb); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	rb.Name = r.PathValue("name")
+	span.SetAttributes(attribute.String("runbook.name", rb.Name))
+	if err := rb.Validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, strings.ReplaceAll(err.Error(), "\n", "; "))
+		return
+	}
+
+	created, err := a.runbooks.Put(rb)
+	if err != nil {
+		span.SetStatus(codes.Error, "save failed")
+		logx.Errorw(ctx, "❌ Failed to save runbook", "runbook.name", rb.Name, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to save runbook")
+		return
+	}
+	logx.Infow(ctx, "📘 Runbook saved", "runbook.name", rb.Name, "runbook.classes", rb.Classes, "created", created)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, rb)
+}
+
+func (a *api) deleteRunbook(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("analyzer-service").Start(r.Context(), "Delete Runbook")
+	defer span.End()
+
+	name := r.PathValue("name")
+	span.SetAttributes(attribute.String("runbook.name", name))
+	existed, err := a.runbooks.Delete(name)
+	if err != nil {
+		span.SetStatus(codes.Error, "save failed")
+		logx.Errorw(ctx, "❌ Failed to delete runbook", "runbook.name", name, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to delete runbook")
+		return
+	}
+	if !existed {
+		writeError(w, r, http.StatusNotFound, "runbook not found")
+		return
+	}
+	logx.Infow(ctx, "🗑️ Runbook deleted", "runbook.name", name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"analyzer-service/slo"
+	"incident-simulation/pkg/logx"
+)
+
+// sloQuery reads the error ratio of the budget from Prometheus
+func sloQuery(prom *promClient) slo.Query {
+	return func(ctx context.Context, expr string, at time.Time) (float64, bool, error) {
+		samples, err := prom.query(ctx, expr, at)
+		if err != nil || len(samples) == 0 {
+			return 0, false, err
+		}
+		return samples[0].Value, true, nil
+	}
+}
+
+// errorBudgetFreezes logs and traces the start and end of a freeze
+func errorBudgetFreezes(ctx context.Context, s slo.Status) {
+	ctx, span := otel.Tracer("analyzer-service").Start(ctx, "Error Budget Freeze")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("slo.service", s.Service),
+		attribute.Bool("slo.freeze", s.Freeze),
+		attribute.Float64("slo.budget_remaining", s.BudgetRemaining),
+	)
+	if s.Freeze {
+		logx.Warnw(ctx, "🧊 Error budget exhausted, freezing", "slo.service", s.Service, "slo.objective", s.Objective,
+			"slo.error_ratio", s.ErrorRatio, "slo.budget_remaining", s.BudgetRemaining)
+		return
+	}
+	logx.Infow(ctx, "🌤️ Error budget recovered, freeze lifted", "slo.service", s.Service,
+		"slo.error_ratio", s.ErrorRatio, "slo.budget_remaining", s.BudgetRemaining)
+}
+
+// initErrorBudgetMetrics reports the remaining budget and whether it is frozen
+func initErrorBudgetMetrics(tracker *slo.Tracker) {
+	meter := otel.Meter("analyzer-service")
+	_, err := meter.Float64ObservableGauge("analyzer_error_budget_remaining",
+		metric.WithDescription("Share of the service's error budget left over the SLO window, negative once overspent"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			s := tracker.Status()
+			o.Observe(s.BudgetRemaining, metric.WithAttributes(attribute.String("service", s.Service)))
+			return nil
+		}))
+	if err != nil {
+		log.Printf("Failed to create error budget gauge: %v", err)
+	}
+	_, err = meter.Int64ObservableGauge("analyzer_error_budget_freeze",
+		metric.WithDescription("1 while the service's error budget is exhausted and traffic should be held back"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			s := tracker.Status()
+			var frozen int64
+			if s.Freeze {
+				frozen = 1
+			}
+			o.Observe(frozen, metric.WithAttributes(attribute.String("service", s.Service)))
+			return nil
+		}))
+	if err != nil {
+		log.Printf("Failed to create error budget freeze gauge: %v", err)
+	}
+}
+
+// getErrorBudget returns the error budget and the freeze signal the load
+// generator polls (FREEZE_URL)
+func (a *api) getErrorBudget(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "Get Error Budget")
+	defer span.End()
+
+	if a.budget == nil {
+		writeError(w, r, http.StatusNotFound, "error budget tracking is not configured")
+		return
+	}
+	s := a.budget.Status()
+	span.SetAttributes(attribute.Bool("slo.freeze", s.Freeze))
+	writeJSON(w, http.StatusOK, s)
+}
@@ -0,0 +1,129 @@
+// Package slo tracks the error budget of one service and turns its
+// exhaustion into a freeze signal.
+//
+// Every SLO_INTERVAL the error ratio of SLO_SERVICE over the last SLO_WINDOW
+// is read from http_server_responses_total in Prometheus (5xx responses over
+// all of them) and compared with the budget SLO_OBJECTIVE leaves. Once the
+// remaining share of the budget drops to SLO_FREEZE_BELOW the service is
+// frozen: clients that honour the signal, such as the load generator, hold
+// back risky traffic until the budget recovers above it.
+package slo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Config tunes the objective and the freeze
+type Config struct {
+	SLOInterval    time.Duration `env:"SLO_INTERVAL" flag:"slo-interval" default:"30s" usage:"How often the error budget is evaluated (0 disables)"`
+	SLOService     string        `env:"SLO_SERVICE" flag:"slo-service" default:"core-api-service" usage:"Prometheus job whose error budget is tracked"`
+	SLOObjective   float64       `env:"SLO_OBJECTIVE" flag:"slo-objective" default:"0.99" usage:"Share of responses that must not be 5xx"`
+	SLOWindow      time.Duration `env:"SLO_WINDOW" flag:"slo-window" default:"1h" usage:"Window the error budget is spent over"`
+	SLOFreezeBelow float64       `env:"SLO_FREEZE_BELOW" flag:"slo-freeze-below" default:"0" usage:"Freeze once this share of the error budget or less remains (0 freezes when it is exhausted)"`
+}
+
+// Query evaluates a PromQL expression to one value at the given time; ok
+// is false when the expression returned nothing, e.g. without traffic
+type Query func(ctx context.Context, expr string, at time.Time) (value float64, ok bool, err error)
+
+// Status is the error budget at one evaluation
+type Status struct {
+	Service         string    `json:"service"`
+	Objective       float64   `json:"objective"`
+	Window          string    `json:"window"`
+	ErrorRatio      float64   `json:"error_ratio"`
+	BudgetRemaining float64   `json:"budget_remaining"` // share of the budget left, negative once overspent
+	Freeze          bool      `json:"freeze"`
+	FrozenSince     time.Time `json:"frozen_since,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+// Tracker evaluates the budget periodically and keeps the latest status
+type Tracker struct {
+	cfg      Config
+	query    Query
+	onChange func(context.Context, Status)
+
+	mu     sync.Mutex
+	latest Status
+}
+
+// New returns a tracker reading Prometheus through query; onChange, if set,
+// is called whenever the freeze starts or ends
+func New(cfg Config, query Query, onChange func(context.Context, Status)) *Tracker {
+	return &Tracker{
+		cfg:      cfg,
+		query:    query,
+		onChange: onChange,
+		latest:   Status{Service: cfg.SLOService, Objective: cfg.SLOObjective, Window: cfg.SLOWindow.String(), BudgetRemaining: 1},
+	}
+}
+
+// Run evaluates every interval until ctx is done
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := t.Evaluate(ctx, now); err != nil {
+				if err.Error() != lastErr {
+					log.Printf("Error budget: query failed: %v", err)
+					lastErr = err.Error()
+				}
+				continue
+			}
+			lastErr = ""
+		}
+	}
+}
+
+// Status returns the latest evaluation; before the first one the budget is full
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.latest
+}
+
+// Evaluate reads the error ratio over the window ending at now
+func (t *Tracker) Evaluate(ctx context.Context, now time.Time) error {
+	rng := fmt.Sprintf("%ds", int(t.cfg.SLOWindow.Seconds()))
+	ratio, ok, err := t.query(ctx, fmt.Sprintf(`sum(increase(http_server_responses_total{job=%q,status_class="5xx"}[%s])) / sum(increase(http_server_responses_total{job=%q}[%s]))`,
+		t.cfg.SLOService, rng, t.cfg.SLOService, rng), now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		ratio = 0
+	}
+
+	t.mu.Lock()
+	s := t.latest
+	s.ErrorRatio = ratio
+	s.BudgetRemaining = 1 - ratio/(1-t.cfg.SLOObjective)
+	s.Time = now.UTC()
+	freeze := s.BudgetRemaining <= t.cfg.SLOFreezeBelow
+	changed := freeze != s.Freeze
+	switch {
+	case freeze && changed:
+		s.FrozenSince = s.Time
+	case !freeze:
+		s.FrozenSince = time.Time{}
+	}
+	s.Freeze = freeze
+	t.latest = s
+	t.mu.Unlock()
+
+	if changed && t.onChange != nil {
+		t.onChange(ctx, s)
+	}
+	return nil
+}
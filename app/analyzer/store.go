@@ -0,0 +1,386 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"analyzer-service/runbook"
+	"incident-simulation/pkg/alerting"
+	"incident-simulation/pkg/deploy"
+	"incident-simulation/pkg/jsonx"
+)
+
+// Incident statuses and verdicts
+const (
+	StatusOpen     = "open"
+	StatusResolved = "resolved"
+
+	VerdictTruePositive  = "true_positive"
+	VerdictFalsePositive = "false_positive"
+)
+
+var (
+	incidentsBucket    = []byte("incidents")
+	fingerprintsBucket = []byte("fingerprints") // alert fingerprint -> open incident ID
+	deploymentsBucket  = []byte("deployments")
+
+	errNotFound = errors.New("incident not found")
+)
+
+// Incident is one detected incident with its timeline and operator feedback
+type Incident struct {
+	ID          string            `json:"id"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Series      string            `json:"series,omitempty"` // alerting series that opened it
+	Service     string            `json:"service"`
+	Type        string            `json:"type"`
+	Severity    string            `json:"severity"`
+	Summary     string            `json:"summary"`
+	Status      string            `json:"status"`
+	Verdict     string            `json:"verdict,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	StartedAt   time.Time         `json:"started_at"`
+	ResolvedAt  *time.Time        `json:"resolved_at,omitempty"`
+	Annotations []Annotation      `json:"annotations,omitempty"`
+	// Runbooks matched when the incident opened, most specific first
+	Runbooks []runbook.Runbook `json:"runbooks,omitempty"`
+	// SuspectedDeployment is the last deployment of the service shortly
+	// before the incident started
+	SuspectedDeployment *Deployment     `json:"suspected_deployment,omitempty"`
+	Timeline            []TimelineEntry `json:"timeline"`
+}
+
+// Deployment is a rollout or rollback announced by pkg/deploy
+type Deployment struct {
+	ID string `json:"id"`
+	deploy.Event
+}
+
+// Annotation is a note attached to an incident by an operator
+type Annotation struct {
+	Time   time.Time `json:"time"`
+	Author string    `json:"author,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// TimelineEntry records one thing that happened to an incident
+type TimelineEntry struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+func (inc *Incident) record(event, detail string, at time.Time) {
+	inc.Timeline = append(inc.Timeline, TimelineEntry{Time: at, Event: event, Detail: detail})
+}
+
+// Filter selects incidents for listing; empty fields match everything
+type Filter struct {
+	Service  string
+	Type     string
+	Severity string
+	Status   string
+	Verdict  string
+	Limit    int
+}
+
+func (f Filter) match(inc Incident) bool {
+	return (f.Service == "" || inc.Service == f.Service) &&
+		(f.Type == "" || inc.Type == f.Type) &&
+		(f.Severity == "" || inc.Severity == f.Severity) &&
+		(f.Status == "" || inc.Status == f.Status) &&
+		(f.Verdict == "" || inc.Verdict == f.Verdict)
+}
+
+// Store keeps incidents in a BoltDB file, keyed by a zero-padded sequence so
+// cursor order is creation order
+type Store struct {
+	db *bolt.DB
+	// runbooks are attached to new incidents when set
+	runbooks *runbook.Library
+	// deployWindow is how long after a deployment a new incident of the same
+	// service is blamed on it; 0 turns that off
+	deployWindow time.Duration
+}
+
+// OpenStore opens (or creates) the incident database at path
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open incident store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{incidentsBucket, fingerprintsBucket, deploymentsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init incident store: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error { return s.db.Close() }
+
+// Create assigns an ID to inc and stores it
+func (s *Store) Create(inc *Incident) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.create(tx, inc)
+	})
+}
+
+func (s *Store) create(tx *bolt.Tx, inc *Incident) error {
+	b := tx.Bucket(incidentsBucket)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	inc.ID = fmt.Sprintf("inc-%08d", seq)
+	if inc.Status == "" {
+		inc.Status = StatusOpen
+	}
+	if s.runbooks != nil && inc.Runbooks == nil {
+		inc.Runbooks = s.runbooks.Match(inc.Type, inc.Service)
+		for _, rb := range inc.Runbooks {
+			inc.record("runbook", rb.Name+": "+rb.Title, inc.StartedAt)
+		}
+	}
+	if s.deployWindow > 0 && inc.SuspectedDeployment == nil {
+		if d, ok := lastDeployment(tx.Bucket(deploymentsBucket), inc.Service, inc.StartedAt, s.deployWindow); ok {
+			inc.SuspectedDeployment = &d
+			inc.record("deployment", fmt.Sprintf("%s of %s %s, %s before the incident",
+				d.Kind, d.Service, d.Version, inc.StartedAt.Sub(d.Time).Round(time.Second)), inc.StartedAt)
+		}
+	}
+	if inc.Fingerprint != "" && inc.Status == StatusOpen {
+		if err := tx.Bucket(fingerprintsBucket).Put([]byte(inc.Fingerprint), []byte(inc.ID)); err != nil {
+			return err
+		}
+	}
+	return put(b, *inc)
+}
+
+// Get returns the incident with id
+func (s *Store) Get(id string) (Incident, error) {
+	var inc Incident
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		inc, err = get(tx.Bucket(incidentsBucket), id)
+		return err
+	})
+	return inc, err
+}
+
+// List returns matching incidents, newest first
+func (s *Store) List(f Filter) ([]Incident, error) {
+	out := []Incident{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(incidentsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var inc Incident
+			if err := jsonx.Unmarshal(v, &inc); err != nil {
+				return fmt.Errorf("decode incident %s: %w", k, err)
+			}
+			if !f.match(inc) {
+				continue
+			}
+			out = append(out, inc)
+			if f.Limit > 0 && len(out) >= f.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Update applies fn to the stored incident and saves the result
+func (s *Store) Update(id string, fn func(*Incident) error) (Incident, error) {
+	var inc Incident
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(incidentsBucket)
+		var err error
+		if inc, err = get(b, id); err != nil {
+			return err
+		}
+		if err := fn(&inc); err != nil {
+			return err
+		}
+		return put(b, inc)
+	})
+	return inc, err
+}
+
+// RecordNotification opens an incident for a firing alert, adds repeats to its
+// timeline and resolves it when the alert resolves. The boolean reports whether
+// a new incident was opened.
+func (s *Store) RecordNotification(n alerting.Notification, now time.Time) (Incident, bool, error) {
+	var inc Incident
+	var opened bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, fps := tx.Bucket(incidentsBucket), tx.Bucket(fingerprintsBucket)
+
+		id := fps.Get([]byte(n.Fingerprint))
+		if id == nil {
+			if n.State != alerting.StateFiring {
+				return errNotFound
+			}
+			startedAt := n.StartsAt
+			if startedAt.IsZero() {
+				startedAt = now
+			}
+			inc = Incident{
+				Fingerprint: n.Fingerprint,
+				Series:      n.Series,
+				Service:     notificationService(n),
+				Type:        notificationType(n),
+				Severity:    n.Severity,
+				Summary:     n.Summary,
+				Labels:      n.Labels,
+				StartedAt:   startedAt,
+			}
+			inc.record("opened", fmt.Sprintf("%s: %s", n.Rule, n.Summary), startedAt)
+			if n.Runbook != "" {
+				inc.record("runbook", n.Runbook, startedAt)
+			}
+			opened = true
+			return s.create(tx, &inc)
+		}
+
+		var err error
+		if inc, err = get(b, string(id)); err != nil {
+			return err
+		}
+		if n.State == alerting.StateResolved {
+			resolvedAt := n.EndsAt
+			if resolvedAt.IsZero() {
+				resolvedAt = now
+			}
+			inc.Status, inc.ResolvedAt = StatusResolved, &resolvedAt
+			inc.record("resolved", n.Summary, resolvedAt)
+			if err := fps.Delete([]byte(n.Fingerprint)); err != nil {
+				return err
+			}
+		} else {
+			inc.record("notified", n.Summary, now)
+		}
+		return put(b, inc)
+	})
+	return inc, opened, err
+}
+
+// RecordDeployment assigns an ID to d and stores it
+func (s *Store) RecordDeployment(d *Deployment) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deploymentsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		d.ID = fmt.Sprintf("dep-%08d", seq)
+		v, err := jsonx.Marshal(d)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(d.ID), v)
+	})
+}
+
+// Deployments returns deployments of service (any service when empty) at or
+// after since, newest first
+func (s *Store) Deployments(service string, since time.Time, limit int) ([]Deployment, error) {
+	out := []Deployment{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deploymentsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var d Deployment
+			if err := jsonx.Unmarshal(v, &d); err != nil {
+				return fmt.Errorf("decode deployment %s: %w", k, err)
+			}
+			if d.Time.Before(since) {
+				break
+			}
+			if service != "" && !sameService(d.Service, service) {
+				continue
+			}
+			out = append(out, d)
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// lastDeployment finds the newest deployment of service in the window before at
+func lastDeployment(b *bolt.Bucket, service string, at time.Time, window time.Duration) (Deployment, bool) {
+	c := b.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		var d Deployment
+		if jsonx.Unmarshal(v, &d) != nil {
+			continue
+		}
+		if at.Sub(d.Time) > window {
+			break
+		}
+		if !d.Time.After(at) && sameService(d.Service, service) {
+			return d, true
+		}
+	}
+	return Deployment{}, false
+}
+
+// sameService matches service names with and without the -service suffix,
+// since alerts label core-api what traces call core-api-service
+func sameService(a, b string) bool {
+	return strings.TrimSuffix(a, "-service") == strings.TrimSuffix(b, "-service")
+}
+
+// notificationService takes the service from the alert labels
+func notificationService(n alerting.Notification) string {
+	for _, key := range []string{"service", "service.name", "job"} {
+		if v := n.Labels[key]; v != "" {
+			return v
+		}
+	}
+	return "unknown"
+}
+
+// notificationType prefers the classifier's class, then the simulator's incident type
+func notificationType(n alerting.Notification) string {
+	for _, key := range []string{"class", "incident_type"} {
+		if v := n.Labels[key]; v != "" {
+			return v
+		}
+	}
+	return n.Rule
+}
+
+func get(b *bolt.Bucket, id string) (Incident, error) {
+	var inc Incident
+	v := b.Get([]byte(id))
+	if v == nil {
+		return inc, errNotFound
+	}
+	if err := jsonx.Unmarshal(v, &inc); err != nil {
+		return inc, fmt.Errorf("decode incident %s: %w", id, err)
+	}
+	return inc, nil
+}
+
+func put(b *bolt.Bucket, inc Incident) error {
+	v, err := jsonx.Marshal(inc)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(inc.ID), v)
+}
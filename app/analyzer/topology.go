@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// getTopology returns the service graph as JSON, or as Graphviz DOT for
+// ?format=dot or Accept: text/vnd.graphviz
+func (a *api) getTopology(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "Get Topology")
+	defer span.End()
+
+	if a.topology == nil {
+		writeError(w, r, http.StatusNotFound, "service graph is not configured")
+		return
+	}
+	graph := a.topology.Graph(time.Now())
+	span.SetAttributes(attribute.Int("topology.nodes", len(graph.Nodes)), attribute.Int("topology.edges", len(graph.Edges)))
+
+	if r.URL.Query().Get("format") == "dot" || strings.Contains(r.Header.Get("Accept"), "text/vnd.graphviz") {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		graph.WriteDOT(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, graph)
+}
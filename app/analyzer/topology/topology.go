@@ -0,0 +1,314 @@
+// Package topology builds a live service dependency graph from spans.
+//
+// A span whose parent belongs to another service is a call from the parent's
+// service to its own. Calls and spans are counted in one-minute buckets over a
+// sliding window, so nodes carry span and error counts and edges carry call
+// rate, error ratio and latency percentiles of the callee's spans. The graph
+// is served as JSON or Graphviz DOT and tells root-cause ranking which
+// services depend on which.
+package topology
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"analyzer-service/tracewatch"
+)
+
+// Callee span durations kept per edge and minute for the percentiles
+const maxDurations = 500
+
+// Config tunes the graph
+type Config struct {
+	TopologyInterval time.Duration `env:"TOPOLOGY_INTERVAL" flag:"topology-interval" default:"15s" usage:"How often spans are fetched for the service graph (0 disables)"`
+	TopologyWindow   time.Duration `env:"TOPOLOGY_WINDOW" flag:"topology-window" default:"15m" usage:"Calls older than this drop out of the service graph"`
+}
+
+// Node is a service in the graph
+type Node struct {
+	Service    string  `json:"service"`
+	Spans      int     `json:"spans"`
+	Errors     int     `json:"errors"`
+	ErrorRatio float64 `json:"error_ratio"`
+}
+
+// Edge is calls from Source to Target
+type Edge struct {
+	Source        string   `json:"source"`
+	Target        string   `json:"target"`
+	Calls         int      `json:"calls"`
+	Errors        int      `json:"errors"`
+	ErrorRatio    float64  `json:"error_ratio"`
+	CallsPerMin   float64  `json:"calls_per_minute"`
+	P50Ms         float64  `json:"p50_ms"`
+	P95Ms         float64  `json:"p95_ms"`
+	TopOperations []string `json:"operations,omitempty"` // callee span names, busiest first
+}
+
+// Graph is the service graph over Start..End
+type Graph struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Nodes []Node    `json:"nodes"`
+	Edges []Edge    `json:"edges"`
+}
+
+type nodeBucket struct {
+	spans, errors int
+}
+
+type edgeBucket struct {
+	calls, errors int
+	durations     []float64 // milliseconds, a uniform sample once full
+	operations    map[string]int
+}
+
+type edgeKey struct {
+	source, target string
+}
+
+// Builder accumulates spans into the graph
+type Builder struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	traces *tracewatch.Assembler
+	nodes  map[string]map[int64]*nodeBucket  // service -> minute -> counts
+	edges  map[edgeKey]map[int64]*edgeBucket // edge -> minute -> counts
+}
+
+func New(cfg Config) *Builder {
+	return &Builder{
+		window: cfg.TopologyWindow,
+		traces: tracewatch.NewAssembler(),
+		nodes:  make(map[string]map[int64]*nodeBucket),
+		edges:  make(map[edgeKey]map[int64]*edgeBucket),
+	}
+}
+
+// Observe adds one poll's spans; calls are counted once their trace is complete
+func (b *Builder) Observe(spans []tracewatch.Span, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, t := range b.traces.Add(spans, now) {
+		for _, s := range t {
+			minute := s.End.Unix() / 60
+			n := bucket(b.nodes, s.Service, minute, func() *nodeBucket { return &nodeBucket{} })
+			n.spans++
+			if s.Error {
+				n.errors++
+			}
+
+			parent, ok := t[s.ParentID]
+			if !ok || parent.Service == s.Service {
+				continue
+			}
+			e := bucket(b.edges, edgeKey{parent.Service, s.Service}, minute, func() *edgeBucket {
+				return &edgeBucket{operations: make(map[string]int)}
+			})
+			e.calls++
+			if s.Error {
+				e.errors++
+			}
+			e.operations[s.Name]++
+			ms := float64(s.Duration) / float64(time.Millisecond)
+			if len(e.durations) < maxDurations {
+				e.durations = append(e.durations, ms)
+			} else if i := rand.Intn(e.calls); i < maxDurations {
+				e.durations[i] = ms
+			}
+		}
+	}
+	b.prune(now)
+}
+
+func bucket[K comparable, B any](m map[K]map[int64]*B, key K, minute int64, create func() *B) *B {
+	byMinute := m[key]
+	if byMinute == nil {
+		byMinute = make(map[int64]*B)
+		m[key] = byMinute
+	}
+	v := byMinute[minute]
+	if v == nil {
+		v = create()
+		byMinute[minute] = v
+	}
+	return v
+}
+
+// prune drops buckets that left the window; callers hold mu
+func (b *Builder) prune(now time.Time) {
+	oldest := now.Add(-b.window).Unix() / 60
+	for service, byMinute := range b.nodes {
+		for m := range byMinute {
+			if m < oldest {
+				delete(byMinute, m)
+			}
+		}
+		if len(byMinute) == 0 {
+			delete(b.nodes, service)
+		}
+	}
+	for key, byMinute := range b.edges {
+		for m := range byMinute {
+			if m < oldest {
+				delete(byMinute, m)
+			}
+		}
+		if len(byMinute) == 0 {
+			delete(b.edges, key)
+		}
+	}
+}
+
+// Graph returns the graph over the window ending at now
+func (b *Builder) Graph(now time.Time) Graph {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(now)
+
+	g := Graph{Start: now.Add(-b.window).UTC(), End: now.UTC(), Nodes: []Node{}, Edges: []Edge{}}
+	for service, byMinute := range b.nodes {
+		n := Node{Service: service}
+		for _, c := range byMinute {
+			n.Spans += c.spans
+			n.Errors += c.errors
+		}
+		n.ErrorRatio = ratio(n.Errors, n.Spans)
+		g.Nodes = append(g.Nodes, n)
+	}
+
+	minutes := math.Max(b.window.Minutes(), 1)
+	for key, byMinute := range b.edges {
+		e := Edge{Source: key.source, Target: key.target}
+		var durations []float64
+		operations := make(map[string]int)
+		for _, c := range byMinute {
+			e.Calls += c.calls
+			e.Errors += c.errors
+			durations = append(durations, c.durations...)
+			for op, n := range c.operations {
+				operations[op] += n
+			}
+		}
+		e.ErrorRatio = ratio(e.Errors, e.Calls)
+		e.CallsPerMin = math.Round(float64(e.Calls)/minutes*100) / 100
+		sort.Float64s(durations)
+		e.P50Ms, e.P95Ms = percentile(durations, 0.5), percentile(durations, 0.95)
+		e.TopOperations = topOperations(operations, 3)
+		g.Edges = append(g.Edges, e)
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Service < g.Nodes[j].Service })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].Source != g.Edges[j].Source {
+			return g.Edges[i].Source < g.Edges[j].Source
+		}
+		return g.Edges[i].Target < g.Edges[j].Target
+	})
+	return g
+}
+
+// Dependencies returns the services component called within the window,
+// implementing correlation.Topology
+func (b *Builder) Dependencies(component string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var deps []string
+	for key := range b.edges {
+		if key.source == component {
+			deps = append(deps, key.target)
+		}
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// Run polls source every interval
+func (b *Builder) Run(ctx context.Context, source tracewatch.SpanSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			spans, err := source.Spans(ctx, now)
+			if err != nil {
+				if err.Error() != lastErr {
+					log.Printf("Service graph: fetch failed: %v", err)
+					lastErr = err.Error()
+				}
+				continue
+			}
+			lastErr = ""
+			b.Observe(spans, now)
+		}
+	}
+}
+
+// WriteDOT renders the graph for Graphviz; edges with more than 5% errors are red
+func (g Graph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph topology {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&sb, "  %q [label=%q];\n", n.Service,
+			fmt.Sprintf("%s\n%d spans, %.1f%% errors", n.Service, n.Spans, n.ErrorRatio*100))
+	}
+	for _, e := range g.Edges {
+		color := "black"
+		if e.ErrorRatio > 0.05 {
+			color = "red"
+		}
+		fmt.Fprintf(&sb, "  %q -> %q [label=%q, color=%s, penwidth=%.1f];\n", e.Source, e.Target,
+			fmt.Sprintf("%.1f/min, %.1f%% err, p95 %.0fms", e.CallsPerMin, e.ErrorRatio*100, e.P95Ms),
+			color, 1+math.Min(math.Log10(1+e.CallsPerMin), 3))
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*10000) / 10000
+}
+
+// percentile of sorted values, nearest rank
+func percentile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return math.Round(sorted[max(i, 0)]*100) / 100
+}
+
+func topOperations(counts map[string]int, n int) []string {
+	ops := make([]string, 0, len(counts))
+	for op := range counts {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if counts[ops[i]] != counts[ops[j]] {
+			return counts[ops[i]] > counts[ops[j]]
+		}
+		return ops[i] < ops[j]
+	})
+	if len(ops) > n {
+		ops = ops[:n]
+	}
+	return ops
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"analyzer-service/remediation"
+	"analyzer-service/tracewatch"
+	"incident-simulation/pkg/alerting"
+	"incident-simulation/pkg/logx"
+)
+
+// Incident types of trace anomaly events
+var traceAnomalyTypes = map[string]string{
+	tracewatch.KindSlowSpan:     "span_latency_anomaly",
+	tracewatch.KindNewChild:     "trace_structure_change",
+	tracewatch.KindMissingChild: "trace_structure_change",
+}
+
+// countTraceAnomaly counts anomalous spans whether or not they open an incident
+func countTraceAnomaly(ctx context.Context, a tracewatch.Anomaly) {
+	traceAnomalies.Add(ctx, int64(a.Count), metric.WithAttributes(
+		attribute.String("kind", a.Kind),
+		attribute.String("service", a.Service),
+	))
+}
+
+// traceAnomalyIncidents records trace anomaly events on the incident timeline
+// the same way alert webhooks do, so they open and resolve incidents
+func traceAnomalyIncidents(store *Store, remediator *remediation.Engine) func(context.Context, tracewatch.Event) {
+	return func(ctx context.Context, e tracewatch.Event) {
+		inc, opened, err := store.RecordNotification(traceAnomalyNotification(e), e.Anomaly.Time)
+		if err != nil {
+			logx.Errorw(ctx, "❌ Failed to record trace anomaly", "trace_anomaly.operation", e.Anomaly.Operation, "error", err)
+			return
+		}
+		if opened {
+			incidentOpened(ctx, remediator, inc)
+			logx.Warnw(ctx, "🧭 Incident opened from trace anomaly", "incident.id", inc.ID, "trace_anomaly.kind", e.Anomaly.Kind,
+				"trace_anomaly.operation", e.Anomaly.Operation, "trace_anomaly.child", e.Anomaly.Child)
+		}
+	}
+}
+
+func traceAnomalyNotification(e tracewatch.Event) alerting.Notification {
+	a := e.Anomaly
+	n := alerting.Notification{
+		Fingerprint: fmt.Sprintf("tracewatch/%s/%s/%s", a.Kind, a.Operation, a.Child),
+		Rule:        "TraceAnomaly",
+		State:       alerting.StateFiring,
+		Severity:    "warning",
+		Series:      "trace_" + a.Kind,
+		Value:       float64(a.Count),
+		StartsAt:    a.Time,
+		Labels: map[string]string{
+			"service":       a.Service,
+			"incident_type": traceAnomalyTypes[a.Kind],
+			"operation":     a.Operation,
+			"trace_ids":     strings.Join(a.TraceIDs, ","),
+		},
+	}
+	if a.Child != "" {
+		n.Labels["child"] = a.Child
+	}
+	switch a.Kind {
+	case tracewatch.KindSlowSpan:
+		n.Summary = fmt.Sprintf("%d %s spans slower than the learned p99 of %.1fms (up to %.1fms)", a.Count, a.Operation, a.P99Ms, a.MaxMs)
+	case tracewatch.KindNewChild:
+		n.Summary = fmt.Sprintf("%s started calling %s, never seen under it before", a.Operation, a.Child)
+	default:
+		n.Summary = fmt.Sprintf("%s no longer calls %s, present in %.0f%% of its spans before", a.Operation, a.Child, a.Presence*100)
+	}
+	if e.State == tracewatch.StateResolved {
+		n.State, n.EndsAt = alerting.StateResolved, a.Time
+		n.Summary = fmt.Sprintf("Traces of %s are back to normal", a.Operation)
+	}
+	return n
+}
+
+// listTraceAnomalies returns the most recent trace anomalies, newest first
+func (a *api) listTraceAnomalies(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Trace Anomalies")
+	defer span.End()
+
+	anomalies := []tracewatch.Anomaly{}
+	if a.traces != nil {
+		anomalies = a.traces.Recent(a.maxLimit)
+	}
+	span.SetAttributes(attribute.Int("trace_anomaly.count", len(anomalies)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"anomalies": anomalies})
+}
+
+// listTraceOperations returns the learned latency and structure baselines
+func (a *api) listTraceOperations(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("analyzer-service").Start(r.Context(), "List Trace Operations")
+	defer span.End()
+
+	operations := []tracewatch.OperationStats{}
+	if a.traces != nil {
+		operations = a.traces.Operations()
+	}
+	span.SetAttributes(attribute.Int("trace_operation.count", len(operations)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"operations": operations})
+}
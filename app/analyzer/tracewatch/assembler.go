@@ -0,0 +1,61 @@
+package tracewatch
+
+import "time"
+
+// Traces remembered after they are handed over so a late duplicate is ignored
+const doneRetention = 10 * time.Minute
+
+// Trace is the spans of one trace by span ID
+type Trace map[string]Span
+
+type pendingTrace struct {
+	spans   Trace
+	updated int // poll that last added a span
+}
+
+// Assembler groups polled spans into traces. A trace is complete once a poll
+// brings no more of its spans, which copes with parents ending after their
+// children and with sources returning the same trace twice.
+type Assembler struct {
+	pending map[string]*pendingTrace
+	done    map[string]time.Time
+	poll    int
+}
+
+func NewAssembler() *Assembler {
+	return &Assembler{pending: make(map[string]*pendingTrace), done: make(map[string]time.Time)}
+}
+
+// Add takes one poll's spans and returns the traces that are now complete.
+// It is not safe for concurrent use.
+func (a *Assembler) Add(spans []Span, now time.Time) []Trace {
+	a.poll++
+	for _, s := range spans {
+		if _, ok := a.done[s.TraceID]; ok {
+			continue
+		}
+		t := a.pending[s.TraceID]
+		if t == nil {
+			t = &pendingTrace{spans: make(Trace)}
+			a.pending[s.TraceID] = t
+		}
+		t.spans[s.SpanID] = s
+		t.updated = a.poll
+	}
+
+	var complete []Trace
+	for id, t := range a.pending {
+		if t.updated == a.poll {
+			continue
+		}
+		complete = append(complete, t.spans)
+		delete(a.pending, id)
+		a.done[id] = now
+	}
+	for id, at := range a.done {
+		if now.Sub(at) > doneRetention {
+			delete(a.done, id)
+		}
+	}
+	return complete
+}
@@ -0,0 +1,236 @@
+package tracewatch
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Span is one finished span with its place in the trace
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Service  string
+	Name     string
+	End      time.Time
+	Duration time.Duration
+	Error    bool
+}
+
+// Operation is the key spans are grouped by
+func (s Span) Operation() string { return s.Service + "/" + s.Name }
+
+// SpanSource returns the spans that finished since the previous call
+type SpanSource interface {
+	Spans(ctx context.Context, until time.Time) ([]Span, error)
+}
+
+// SourceFromConfig prefers the services' telemetry buffers, like
+// correlation.FromConfig, and falls back to Tempo; nil when neither is set
+func SourceFromConfig(cfg config.Correlation, fetchLimit int) SpanSource {
+	client := &http.Client{Timeout: 15 * time.Second}
+	if len(cfg.TelemetryBufferURLs) > 0 {
+		return &BufferSource{BaseURLs: cfg.TelemetryBufferURLs, Client: client, since: make(map[string]time.Time)}
+	}
+	if cfg.TempoURL != "" {
+		return &TempoSource{BaseURL: cfg.TempoURL, Client: client, Limit: fetchLimit}
+	}
+	return nil
+}
+
+// BufferSource reads /debug/telemetry/recent of every service and remembers
+// the newest span end it saw per service, so no span is read twice
+type BufferSource struct {
+	BaseURLs []string
+	Client   *http.Client
+
+	since map[string]time.Time
+}
+
+type recentResponse struct {
+	Service string                 `json:"service"`
+	Spans   []telemetry.RecentSpan `json:"spans"`
+}
+
+func (b *BufferSource) Spans(ctx context.Context, until time.Time) ([]Span, error) {
+	var spans []Span
+	var lastErr error
+	ok := 0
+	for _, base := range b.BaseURLs {
+		since, seen := b.since[base]
+		if !seen {
+			// Start with what is already buffered
+			since = until.Add(-5 * time.Minute)
+		}
+		var resp recentResponse
+		u := strings.TrimRight(base, "/") + "/debug/telemetry/recent?since=" + url.QueryEscape(since.Format(time.RFC3339Nano))
+		if err := getJSON(ctx, b.Client, u, &resp); err != nil {
+			lastErr = err
+			continue
+		}
+		ok++
+		newest := since
+		for _, s := range resp.Spans {
+			if s.Time.Before(since) {
+				continue
+			}
+			if s.Time.After(newest) {
+				newest = s.Time
+			}
+			spans = append(spans, Span{
+				TraceID:  s.TraceID,
+				SpanID:   s.SpanID,
+				ParentID: s.ParentSpanID,
+				Service:  resp.Service,
+				Name:     s.Name,
+				End:      s.Time,
+				Duration: time.Duration(s.DurationMs * float64(time.Millisecond)),
+				Error:    s.Status == codes.Error.String(),
+			})
+		}
+		b.since[base] = newest.Add(time.Nanosecond)
+	}
+	if ok == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return spans, nil
+}
+
+// TempoSource finds recent traces with a TraceQL search and fetches each one
+// whole, since search results carry no parent span IDs
+type TempoSource struct {
+	BaseURL string
+	Client  *http.Client
+	Limit   int
+
+	last time.Time
+}
+
+type tempoSearch struct {
+	Traces []struct {
+		TraceID string `json:"traceID"`
+	} `json:"traces"`
+}
+
+// tempoTrace is the OTLP JSON of /api/traces/{id}; IDs are base64
+type tempoTrace struct {
+	Batches []struct {
+		Resource struct {
+			Attributes []tempoAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID           string `json:"traceId"`
+				SpanID            string `json:"spanId"`
+				ParentSpanID      string `json:"parentSpanId"`
+				Name              string `json:"name"`
+				StartTimeUnixNano string `json:"startTimeUnixNano"`
+				EndTimeUnixNano   string `json:"endTimeUnixNano"`
+				Status            struct {
+					// STATUS_CODE_ERROR, or 2 in older Tempo versions
+					Code interface{} `json:"code"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"batches"`
+}
+
+type tempoAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func (t *TempoSource) Spans(ctx context.Context, until time.Time) ([]Span, error) {
+	start := t.last
+	if start.IsZero() {
+		start = until.Add(-time.Minute)
+	}
+	params := url.Values{}
+	params.Set("q", "{}")
+	params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(until.Unix(), 10))
+	params.Set("limit", strconv.Itoa(t.Limit))
+
+	base := strings.TrimRight(t.BaseURL, "/")
+	var found tempoSearch
+	if err := getJSON(ctx, t.Client, base+"/api/search?"+params.Encode(), &found); err != nil {
+		return nil, err
+	}
+	t.last = until
+
+	var spans []Span
+	for _, tr := range found.Traces {
+		var trace tempoTrace
+		if err := getJSON(ctx, t.Client, base+"/api/traces/"+tr.TraceID, &trace); err != nil {
+			return spans, err
+		}
+		for _, batch := range trace.Batches {
+			service := "unknown"
+			for _, a := range batch.Resource.Attributes {
+				if a.Key == "service.name" {
+					service = a.Value.StringValue
+				}
+			}
+			for _, scope := range batch.ScopeSpans {
+				for _, s := range scope.Spans {
+					startNs, _ := strconv.ParseInt(s.StartTimeUnixNano, 10, 64)
+					endNs, _ := strconv.ParseInt(s.EndTimeUnixNano, 10, 64)
+					spans = append(spans, Span{
+						TraceID:  hexID(s.TraceID),
+						SpanID:   hexID(s.SpanID),
+						ParentID: hexID(s.ParentSpanID),
+						Service:  service,
+						Name:     s.Name,
+						End:      time.Unix(0, endNs),
+						Duration: time.Duration(endNs - startNs),
+						Error:    s.Status.Code == "STATUS_CODE_ERROR" || s.Status.Code == float64(2),
+					})
+				}
+			}
+		}
+	}
+	return spans, nil
+}
+
+// hexID turns a base64 OTLP JSON ID into the hex form used everywhere else
+func hexID(id string) string {
+	if _, err := hex.DecodeString(id); err == nil && (len(id) == 16 || len(id) == 32) {
+		return id
+	}
+	b, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return id
+	}
+	return hex.EncodeToString(b)
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", req.URL.Path, resp.StatusCode)
+	}
+	return jsonx.NewDecoder(resp.Body).Decode(out)
+}
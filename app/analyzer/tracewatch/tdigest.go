@@ -0,0 +1,146 @@
+package tracewatch
+
+import (
+	"math"
+	"sort"
+)
+
+// Centroid is a cluster of nearby values in a Digest
+type Centroid struct {
+	Mean   float64 `json:"m"`
+	Weight float64 `json:"w"`
+}
+
+// Digest is a merging t-digest: a few hundred centroids that estimate any
+// quantile, most accurately in the tails, from a stream of values. Centroids
+// near q=0 and q=1 stay small under the k1 scale function so p99 keeps its
+// resolution.
+type Digest struct {
+	Compression float64    `json:"compression"`
+	Centroids   []Centroid `json:"centroids"`
+	Count       float64    `json:"count"`
+	Min         float64    `json:"min"`
+	Max         float64    `json:"max"`
+
+	buffer []float64
+}
+
+// NewDigest returns an empty digest; compression 100 keeps about 100-200 centroids
+func NewDigest(compression float64) *Digest {
+	return &Digest{Compression: compression, Min: math.Inf(1), Max: math.Inf(-1)}
+}
+
+// Add records one value
+func (d *Digest) Add(x float64) {
+	d.buffer = append(d.buffer, x)
+	d.Min, d.Max = math.Min(d.Min, x), math.Max(d.Max, x)
+	if len(d.buffer) >= int(5*d.Compression) {
+		d.flush()
+	}
+}
+
+// Total is the weight of all recorded values
+func (d *Digest) Total() float64 {
+	return d.Count + float64(len(d.buffer))
+}
+
+// Scale multiplies every weight by f, so older values fade as new ones arrive
+func (d *Digest) Scale(f float64) {
+	d.flush()
+	for i := range d.Centroids {
+		d.Centroids[i].Weight *= f
+	}
+	d.Count *= f
+}
+
+// Merge adds the values recorded in o, as if they had been added to d
+func (d *Digest) Merge(o *Digest) {
+	o.flush()
+	if len(o.Centroids) == 0 {
+		return
+	}
+	d.Min, d.Max = math.Min(d.Min, o.Min), math.Max(d.Max, o.Max)
+	d.merge(o.Centroids)
+}
+
+// flush merges the buffered values into the centroids
+func (d *Digest) flush() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	d.merge(nil)
+}
+
+// merge compresses the centroids, the buffered values and more into new centroids
+func (d *Digest) merge(more []Centroid) {
+	all := make([]Centroid, 0, len(d.Centroids)+len(more)+len(d.buffer))
+	all = append(append(all, d.Centroids...), more...)
+	for _, x := range d.buffer {
+		all = append(all, Centroid{Mean: x, Weight: 1})
+	}
+	d.buffer = d.buffer[:0]
+	if len(all) == 0 {
+		return
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+
+	var total float64
+	for _, c := range all {
+		total += c.Weight
+	}
+
+	out := make([]Centroid, 0, len(d.Centroids)+1)
+	cur := all[0]
+	var before float64 // weight left of cur
+	for _, c := range all[1:] {
+		merged := cur.Weight + c.Weight
+		if d.k(before+merged, total)-d.k(before, total) <= 1 {
+			cur.Mean += (c.Mean - cur.Mean) * c.Weight / merged
+			cur.Weight = merged
+			continue
+		}
+		out = append(out, cur)
+		before += cur.Weight
+		cur = c
+	}
+	d.Centroids = append(out, cur)
+	d.Count = total
+}
+
+// k is the k1 scale function: δ/2π · asin(2q−1)
+func (d *Digest) k(w, total float64) float64 {
+	q := math.Min(math.Max(w/total, 0), 1)
+	return d.Compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// Quantile estimates the q-quantile, interpolating between centroid centres
+func (d *Digest) Quantile(q float64) float64 {
+	d.flush()
+	if len(d.Centroids) == 0 {
+		return math.NaN()
+	}
+	if len(d.Centroids) == 1 {
+		return d.Centroids[0].Mean
+	}
+
+	target := q * d.Count
+	first := d.Centroids[0]
+	if target <= first.Weight/2 {
+		return d.Min + (first.Mean-d.Min)*target/(first.Weight/2)
+	}
+	var cum float64
+	for i := 0; i < len(d.Centroids)-1; i++ {
+		a, b := d.Centroids[i], d.Centroids[i+1]
+		left, right := cum+a.Weight/2, cum+a.Weight+b.Weight/2
+		if target <= right {
+			return a.Mean + (b.Mean-a.Mean)*(target-left)/(right-left)
+		}
+		cum += a.Weight
+	}
+	last := d.Centroids[len(d.Centroids)-1]
+	rest := d.Count - last.Weight/2
+	if target >= d.Count {
+		return d.Max
+	}
+	return last.Mean + (d.Max-last.Mean)*(target-rest)/(last.Weight/2)
+}
@@ -0,0 +1,151 @@
+package tracewatch
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"testing"
+)
+
+var testQuantiles = []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999}
+
+// samples returns n values drawn by draw from a seeded source
+func samples(n int, draw func(*rand.Rand) float64) []float64 {
+	r := rand.New(rand.NewPCG(1, 2))
+	xs := make([]float64, n)
+	for i := range xs {
+		xs[i] = draw(r)
+	}
+	return xs
+}
+
+// rankError is how far the rank of v in sorted is from q, as a share of the values
+func rankError(sorted []float64, v, q float64) float64 {
+	return math.Abs(float64(sort.SearchFloat64s(sorted, v))/float64(len(sorted)) - q)
+}
+
+// checkQuantiles compares the quantiles of d with the values behind it. The
+// tails get a tighter bound, as the scale function keeps their centroids small.
+func checkQuantiles(t *testing.T, d *Digest, values []float64) {
+	t.Helper()
+	sorted := slices.Sorted(slices.Values(values))
+	for _, q := range testQuantiles {
+		limit := 0.01
+		if q < 0.05 || q > 0.95 {
+			limit = 0.002
+		}
+		if got := d.Quantile(q); rankError(sorted, got, q) > limit {
+			t.Errorf("Quantile(%g) = %g at rank %.4f, want within %g of q",
+				q, got, float64(sort.SearchFloat64s(sorted, got))/float64(len(sorted)), limit)
+		}
+	}
+}
+
+func TestDigestQuantiles(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		draw func(*rand.Rand) float64
+	}{
+		{"uniform", func(r *rand.Rand) float64 { return r.Float64() * 100 }},
+		// Span durations: most fast, a long tail of slow ones
+		{"lognormal", func(r *rand.Rand) float64 { return math.Exp(r.NormFloat64()*1.5 + 3) }},
+		{"exponential", func(r *rand.Rand) float64 { return r.ExpFloat64() * 20 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			values := samples(20000, tc.draw)
+			d := NewDigest(digestCompression)
+			for _, v := range values {
+				d.Add(v)
+			}
+			checkQuantiles(t, d, values)
+
+			if d.Total() != float64(len(values)) {
+				t.Errorf("Total() = %g, want %d", d.Total(), len(values))
+			}
+			if n := len(d.Centroids); n > 2*digestCompression {
+				t.Errorf("%d centroids, want at most %d", n, 2*digestCompression)
+			}
+			if d.Quantile(0) != slices.Min(values) || d.Quantile(1) != slices.Max(values) {
+				t.Errorf("Quantile(0), Quantile(1) = %g, %g; want the min and max %g, %g",
+					d.Quantile(0), d.Quantile(1), slices.Min(values), slices.Max(values))
+			}
+		})
+	}
+}
+
+func TestDigestMerge(t *testing.T) {
+	values := samples(20000, func(r *rand.Rand) float64 { return math.Exp(r.NormFloat64()*1.5 + 3) })
+	// The digests hold different ranges, so neither alone is close to the whole
+	sorted := slices.Sorted(slices.Values(values))
+	low, high := NewDigest(digestCompression), NewDigest(digestCompression)
+	for i, v := range sorted {
+		if i%3 == 0 || v > sorted[len(sorted)/2] {
+			high.Add(v)
+		} else {
+			low.Add(v)
+		}
+	}
+
+	low.Merge(high)
+	checkQuantiles(t, low, values)
+	if low.Total() != float64(len(values)) || low.Min != sorted[0] || low.Max != sorted[len(sorted)-1] {
+		t.Errorf("merged total %g, min %g, max %g; want %d, %g, %g",
+			low.Total(), low.Min, low.Max, len(values), sorted[0], sorted[len(sorted)-1])
+	}
+
+	// Merging an empty digest changes nothing
+	before := low.Quantile(0.99)
+	low.Merge(NewDigest(digestCompression))
+	if got := low.Quantile(0.99); got != before || low.Total() != float64(len(values)) {
+		t.Errorf("after merging an empty digest p99 = %g, total %g; want %g, %d", got, low.Total(), before, len(values))
+	}
+	// and an empty digest takes on what it merges
+	empty := NewDigest(digestCompression)
+	empty.Merge(low)
+	if got := empty.Quantile(0.99); got != before || empty.Min != low.Min || empty.Max != low.Max {
+		t.Errorf("empty digest after merge p99 = %g, min %g, max %g; want %g, %g, %g", got, empty.Min, empty.Max, before, low.Min, low.Max)
+	}
+}
+
+func TestDigestSmall(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		values []float64
+		want   map[float64]float64 // quantile -> value
+	}{
+		{"single value", []float64{42}, map[float64]float64{0: 42, 0.5: 42, 0.99: 42, 1: 42}},
+		{"repeated value", []float64{7, 7, 7, 7}, map[float64]float64{0: 7, 0.5: 7, 1: 7}},
+		{"two values", []float64{10, 20}, map[float64]float64{0: 10, 0.5: 15, 1: 20}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewDigest(digestCompression)
+			for _, v := range tc.values {
+				d.Add(v)
+			}
+			for q, want := range tc.want {
+				if got := d.Quantile(q); math.Abs(got-want) > 1e-9 {
+					t.Errorf("Quantile(%g) = %g, want %g", q, got, want)
+				}
+			}
+		})
+	}
+
+	d := NewDigest(digestCompression)
+	if got := d.Quantile(0.5); !math.IsNaN(got) || d.Total() != 0 {
+		t.Errorf("empty digest: Quantile(0.5) = %g, Total() = %g; want NaN, 0", got, d.Total())
+	}
+}
+
+func TestDigestScale(t *testing.T) {
+	values := samples(5000, func(r *rand.Rand) float64 { return r.ExpFloat64() * 20 })
+	d := NewDigest(digestCompression)
+	for _, v := range values {
+		d.Add(v)
+	}
+	p99 := d.Quantile(0.99)
+	d.Scale(0.5)
+	if got := d.Quantile(0.99); math.Abs(got-p99) > 1e-9 || d.Total() != 2500 {
+		t.Errorf("after Scale(0.5) p99 = %g, total %g; want %g, 2500", got, d.Total(), p99)
+	}
+}
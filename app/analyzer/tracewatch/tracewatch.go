@@ -0,0 +1,378 @@
+// Package tracewatch learns what normal traces look like and flags the ones
+// that are not.
+//
+// Every operation (service and span name) keeps a t-digest of its span
+// durations; once it has enough samples, a span longer than a configurable
+// factor of the learned p99 is a latency anomaly. Every operation also counts
+// how often each child operation appears under it, so a child that was never
+// seen before, or one that is almost always present but missing, is a
+// structural anomaly. Spans are grouped into traces and a trace is analysed
+// once a poll brings no more of its spans.
+package tracewatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// Anomaly kinds and event states
+const (
+	KindSlowSpan     = "slow_span"
+	KindNewChild     = "new_child"
+	KindMissingChild = "missing_child"
+
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+const (
+	digestCompression = 100
+	// Operations past this many samples have their weights halved, so the
+	// baselines follow gradual change
+	maxBaselineWeight = 20000
+	maxRecent         = 200
+)
+
+// Config tunes the detector
+type Config struct {
+	TraceAnomalyInterval time.Duration `env:"TRACE_ANOMALY_INTERVAL" flag:"trace-anomaly-interval" default:"30s" usage:"How often spans are fetched and analysed (0 disables)"`
+	TraceP99Factor       float64       `env:"TRACE_P99_FACTOR" flag:"trace-p99-factor" default:"2" usage:"A span longer than this multiple of its operation's learned p99 is anomalous"`
+	TraceMinSamples      int           `env:"TRACE_MIN_SAMPLES" flag:"trace-min-samples" default:"200" usage:"Spans (or parent spans) an operation needs before it is judged"`
+	TraceMinSlowSpans    int           `env:"TRACE_MIN_SLOW_SPANS" flag:"trace-min-slow-spans" default:"3" usage:"Slow spans of one operation in a poll that open an incident"`
+	TraceChildPresence   float64       `env:"TRACE_CHILD_PRESENCE" flag:"trace-child-presence" default:"0.99" usage:"Share of parents a child must appear under before its absence is anomalous"`
+	TraceFetchLimit      int           `env:"TRACE_FETCH_LIMIT" flag:"trace-fetch-limit" default:"50" usage:"Traces fetched from Tempo per poll"`
+	TraceStateFile       string        `env:"TRACE_STATE_FILE" flag:"trace-state-file" default:"trace-baselines.json" usage:"Persists the learned baselines (empty keeps them in memory)"`
+}
+
+func (c Config) validate() error {
+	var errs []error
+	if c.TraceP99Factor < 1 {
+		errs = append(errs, errors.New("TRACE_P99_FACTOR must be at least 1"))
+	}
+	if c.TraceMinSamples <= 0 || c.TraceMinSlowSpans <= 0 || c.TraceFetchLimit <= 0 {
+		errs = append(errs, errors.New("TRACE_MIN_SAMPLES, TRACE_MIN_SLOW_SPANS and TRACE_FETCH_LIMIT must be positive"))
+	}
+	if c.TraceChildPresence <= 0 || c.TraceChildPresence > 1 {
+		errs = append(errs, errors.New("TRACE_CHILD_PRESENCE must be in (0, 1]"))
+	}
+	return errors.Join(errs...)
+}
+
+// baseline is what the detector has learned about one operation
+type baseline struct {
+	Durations *Digest            `json:"durations"` // milliseconds
+	Parents   float64            `json:"parents"`   // spans whose children were counted
+	Children  map[string]float64 `json:"children"`  // child operation -> parents it appeared under
+}
+
+// Anomaly is one kind of deviation of one operation within a poll
+type Anomaly struct {
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Service   string    `json:"service"`
+	Child     string    `json:"child,omitempty"`
+	Count     int       `json:"count"`
+	P99Ms     float64   `json:"p99_ms,omitempty"`
+	MaxMs     float64   `json:"max_ms,omitempty"`
+	// Presence is how often Child used to appear under Operation
+	Presence float64  `json:"presence,omitempty"`
+	TraceIDs []string `json:"trace_ids"`
+}
+
+func (a Anomaly) key() string { return a.Kind + "/" + a.Operation + "/" + a.Child }
+
+// Event is an anomaly starting or ending
+type Event struct {
+	State   string  `json:"state"`
+	Anomaly Anomaly `json:"anomaly"`
+}
+
+// OperationStats summarises a baseline for the API
+type OperationStats struct {
+	Operation string             `json:"operation"`
+	Samples   float64            `json:"samples"`
+	P50Ms     float64            `json:"p50_ms"`
+	P99Ms     float64            `json:"p99_ms"`
+	Children  map[string]float64 `json:"children,omitempty"` // child -> presence
+}
+
+// Detector holds the baselines and the traces waiting to be analysed
+type Detector struct {
+	cfg       Config
+	onAnomaly func(context.Context, Anomaly)
+	onEvent   func(context.Context, Event)
+
+	mu        sync.Mutex
+	traces    *Assembler
+	baselines map[string]*baseline
+	active    map[string]Anomaly
+	recent    []Anomaly
+}
+
+// New returns a Detector and restores cfg.TraceStateFile if present
+func New(cfg Config, onAnomaly func(context.Context, Anomaly), onEvent func(context.Context, Event)) (*Detector, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	d := &Detector{
+		cfg:       cfg,
+		onAnomaly: onAnomaly,
+		onEvent:   onEvent,
+		traces:    NewAssembler(),
+		baselines: make(map[string]*baseline),
+		active:    make(map[string]Anomaly),
+	}
+	if cfg.TraceStateFile == "" {
+		return d, nil
+	}
+
+	data, err := os.ReadFile(cfg.TraceStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read trace baselines: %w", err)
+	}
+	if err := jsonx.Unmarshal(data, &d.baselines); err != nil {
+		return nil, fmt.Errorf("parse trace baselines %s: %w", cfg.TraceStateFile, err)
+	}
+	return d, nil
+}
+
+// Observe adds one poll's spans and analyses the traces that are complete
+func (d *Detector) Observe(spans []Span, now time.Time) ([]Anomaly, []Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	found := make(map[string]*Anomaly)
+	for _, t := range d.traces.Add(spans, now) {
+		d.analyse(t, now, found)
+	}
+
+	anomalies := make([]Anomaly, 0, len(found))
+	for _, a := range found {
+		anomalies = append(anomalies, *a)
+	}
+	sort.Slice(anomalies, func(i, j int) bool { return anomalies[i].key() < anomalies[j].key() })
+	d.recent = append(d.recent, anomalies...)
+	if len(d.recent) > maxRecent {
+		d.recent = d.recent[len(d.recent)-maxRecent:]
+	}
+	return anomalies, d.transitions(found, now)
+}
+
+// analyse judges every span of a trace against the baselines, then learns from it
+func (d *Detector) analyse(t Trace, now time.Time, found map[string]*Anomaly) {
+	children := make(map[string]map[string]bool) // parent span ID -> child operations
+	for _, s := range t {
+		if _, ok := t[s.ParentID]; ok {
+			if children[s.ParentID] == nil {
+				children[s.ParentID] = make(map[string]bool)
+			}
+			children[s.ParentID][s.Operation()] = true
+		}
+	}
+
+	ids := make([]string, 0, len(t))
+	for id := range t {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s := t[id]
+		op := s.Operation()
+		b := d.baselines[op]
+		if b == nil {
+			b = &baseline{Durations: NewDigest(digestCompression), Children: make(map[string]float64)}
+			d.baselines[op] = b
+		}
+		ms := float64(s.Duration) / float64(time.Millisecond)
+
+		if b.Durations.Total() >= float64(d.cfg.TraceMinSamples) {
+			if p99 := b.Durations.Quantile(0.99); ms > d.cfg.TraceP99Factor*p99 {
+				a := record(found, Anomaly{Kind: KindSlowSpan, Time: now, Operation: op, Service: s.Service}, s.TraceID)
+				a.P99Ms, a.MaxMs = p99, math.Max(a.MaxMs, ms)
+			}
+		}
+		b.Durations.Add(ms)
+
+		kids := children[id]
+		if b.Parents >= float64(d.cfg.TraceMinSamples) {
+			for child := range kids {
+				if b.Children[child] == 0 {
+					record(found, Anomaly{Kind: KindNewChild, Time: now, Operation: op, Service: s.Service, Child: child}, s.TraceID)
+				}
+			}
+			for child, n := range b.Children {
+				if presence := n / b.Parents; presence >= d.cfg.TraceChildPresence && !kids[child] {
+					a := record(found, Anomaly{Kind: KindMissingChild, Time: now, Operation: op, Service: s.Service, Child: child}, s.TraceID)
+					a.Presence = presence
+				}
+			}
+		}
+		b.Parents++
+		for child := range kids {
+			b.Children[child]++
+		}
+
+		if b.Durations.Total() > maxBaselineWeight {
+			b.Durations.Scale(0.5)
+		}
+		if b.Parents > maxBaselineWeight {
+			b.Parents /= 2
+			for child := range b.Children {
+				b.Children[child] /= 2
+			}
+		}
+	}
+}
+
+// record counts one occurrence of an anomaly and keeps a few example traces
+func record(found map[string]*Anomaly, a Anomaly, traceID string) *Anomaly {
+	existing, ok := found[a.key()]
+	if !ok {
+		existing = &a
+		found[a.key()] = existing
+	}
+	existing.Count++
+	if len(existing.TraceIDs) < 3 {
+		existing.TraceIDs = append(existing.TraceIDs, traceID)
+	}
+	return existing
+}
+
+// transitions fires events for anomalies that crossed their threshold and
+// resolves active ones that were absent this poll
+func (d *Detector) transitions(found map[string]*Anomaly, now time.Time) []Event {
+	var events []Event
+	for key, a := range found {
+		min := 1
+		if a.Kind == KindSlowSpan {
+			min = d.cfg.TraceMinSlowSpans
+		}
+		if _, active := d.active[key]; !active && a.Count >= min {
+			d.active[key] = *a
+			events = append(events, Event{State: StateFiring, Anomaly: *a})
+		}
+	}
+	for key, a := range d.active {
+		if _, ok := found[key]; !ok {
+			delete(d.active, key)
+			a.Time, a.Count = now, 0
+			events = append(events, Event{State: StateResolved, Anomaly: a})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Anomaly.key() < events[j].Anomaly.key() })
+	return events
+}
+
+// Recent returns up to limit anomalies, newest first
+func (d *Detector) Recent(limit int) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Anomaly, 0, min(limit, len(d.recent)))
+	for i := len(d.recent) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, d.recent[i])
+	}
+	return out
+}
+
+// Operations summarises every learned baseline
+func (d *Detector) Operations() []OperationStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]OperationStats, 0, len(d.baselines))
+	for op, b := range d.baselines {
+		st := OperationStats{Operation: op, Samples: b.Durations.Total(), P50Ms: b.Durations.Quantile(0.5), P99Ms: b.Durations.Quantile(0.99)}
+		if b.Parents > 0 && len(b.Children) > 0 {
+			st.Children = make(map[string]float64, len(b.Children))
+			for child, n := range b.Children {
+				st.Children[child] = math.Round(n/b.Parents*1000) / 1000
+			}
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Operation < out[j].Operation })
+	return out
+}
+
+// Run polls source every interval and saves the baselines after each poll
+func (d *Detector) Run(ctx context.Context, source SpanSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			spans, err := source.Spans(ctx, now)
+			if err != nil {
+				if err.Error() != lastErr {
+					log.Printf("Trace anomaly detection: fetch failed: %v", err)
+					lastErr = err.Error()
+				}
+				continue
+			}
+			lastErr = ""
+
+			anomalies, events := d.Observe(spans, now)
+			for _, a := range anomalies {
+				if d.onAnomaly != nil {
+					d.onAnomaly(ctx, a)
+				}
+			}
+			for _, e := range events {
+				log.Printf("Trace anomaly %s %s: %s %s (%d spans)", e.State, e.Anomaly.Kind, e.Anomaly.Operation, e.Anomaly.Child, e.Anomaly.Count)
+				if d.onEvent != nil {
+					d.onEvent(ctx, e)
+				}
+			}
+			if err := d.Save(); err != nil {
+				log.Printf("Trace anomaly detection: %v", err)
+			}
+		}
+	}
+}
+
+// Save writes the baselines to the state file atomically
+func (d *Detector) Save() error {
+	if d.cfg.TraceStateFile == "" {
+		return nil
+	}
+	d.mu.Lock()
+	for _, b := range d.baselines {
+		b.Durations.flush()
+	}
+	data, err := jsonx.Marshal(d.baselines)
+	d.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode trace baselines: %w", err)
+	}
+
+	path := d.cfg.TraceStateFile
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("save trace baselines: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save trace baselines: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save trace baselines: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
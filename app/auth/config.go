@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"incident-simulation/pkg/config"
+)
+
+// Config is the auth service configuration
+type Config struct {
+	config.Telemetry
+	config.Audit
+	config.Profiling
+	config.Dev
+	config.Simulation
+
+	ListenAddr          string        `env:"LISTEN_ADDR" flag:"listen" default:":8083" usage:"HTTP listen address"`
+	TokenIssuer         string        `env:"TOKEN_ISSUER" flag:"token-issuer" default:"auth-service" usage:"iss claim of issued tokens"`
+	TokenAudience       string        `env:"TOKEN_AUDIENCE" flag:"token-audience" default:"core-api" usage:"aud claim of issued tokens"`
+	TokenTTL            time.Duration `env:"TOKEN_TTL" flag:"token-ttl" default:"15m" usage:"Lifetime of issued tokens"`
+	IncidentInterval    time.Duration `env:"INCIDENT_INTERVAL" flag:"incident-interval" default:"90s" usage:"How often the simulator considers starting an incident"`
+	IncidentProbability float64       `env:"INCIDENT_PROBABILITY" flag:"incident-probability" default:"0.15" usage:"Chance of starting an incident at each interval"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.TokenTTL <= 0 {
+		errs = append(errs, errors.New("TOKEN_TTL must be positive"))
+	}
+	if c.IncidentInterval <= 0 {
+		errs = append(errs, errors.New("INCIDENT_INTERVAL must be positive"))
+	}
+	if c.IncidentProbability < 0 || c.IncidentProbability > 1 {
+		errs = append(errs, errors.New("INCIDENT_PROBABILITY must be between 0 and 1"))
+	}
+	errs = append(errs, c.Batching.Validate(), c.Sampling.Validate(), c.Logging.Validate())
+	return errors.Join(errs...)
+}
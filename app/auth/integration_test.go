@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/jwt"
+	"incident-simulation/pkg/telemetry"
+	"incident-simulation/pkg/telemetry/telemetrytest"
+)
+
+// newTestService builds the auth service with its real telemetry setup
+// exporting to an in-memory collector and a fresh published signing key;
+// flush shuts the providers down so everything emitted so far has arrived
+func newTestService(t *testing.T) (http.Handler, *telemetrytest.Collector, jwt.Key, func()) {
+	t.Helper()
+	collector := telemetrytest.NewCollector(t)
+
+	var cfg Config
+	if err := config.Load(&cfg, []string{
+		"-telemetry-exporter=otlp", "-otlp-insecure", "-otlp-endpoint=" + collector.Endpoint(),
+	}); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.mu.Lock()
+	state.signing, state.published, state.incident, state.skew = key, []jwt.Key{key}, "none", 0
+	state.mu.Unlock()
+
+	ctx := context.Background()
+	recorder := telemetry.NewRecorder("auth-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	heatmap := telemetry.NewHeatmap("auth-service", cfg.LatencyHeatmapMinutes)
+	shutdown := initOpenTelemetry(ctx, "auth-service", cfg.Telemetry, recorder, health, heatmap)
+	initMetrics(ctx)
+	handler := newAuthHandler(cfg, recorder, health, heatmap)
+
+	var once sync.Once
+	flush := func() { once.Do(shutdown) }
+	t.Cleanup(flush)
+	return handler, collector, key, flush
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIssueTokenTelemetry(t *testing.T) {
+	handler, collector, key, flush := newTestService(t)
+
+	rec := serve(handler, http.MethodPost, "/auth/token", `{"user_id":"user_1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	server := collector.Span(t, "auth-service")
+	if server.Kind != "server" || server.StatusCode != "unset" {
+		t.Errorf("server span kind %s status %s, want server unset", server.Kind, server.StatusCode)
+	}
+	span := collector.Span(t, "Issue Token")
+	if span.ParentSpanID != server.SpanID || span.StatusCode != "unset" {
+		t.Errorf("Issue Token parent %s status %s, want %s unset", span.ParentSpanID, span.StatusCode, server.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "Issue Token", span.Attributes, map[string]string{
+		"user.id":                 "user_1",
+		"auth.scope":              defaultScope,
+		"auth.key_id":             key.ID,
+		"auth.clock_skew_seconds": "0",
+		"sim.incident.type":       "none",
+	})
+
+	assertCount(t, collector, "auth_tokens_issued_total", map[string]string{"incident_type": "none"}, 1)
+	assertHistogramCount(t, collector, "auth_token_issue_duration_seconds", nil, 1)
+
+	logs := collector.LogsWithBody("Token issued")
+	if len(logs) != 1 {
+		t.Fatalf("got %d token logs, want 1", len(logs))
+	}
+	if logs[0].Severity != "info" || logs[0].SpanID != span.SpanID {
+		t.Errorf("token log severity %q span %s, want info %s", logs[0].Severity, logs[0].SpanID, span.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "token log", logs[0].Attributes, map[string]string{"user.id": "user_1", "auth.key_id": key.ID})
+}
+
+func TestIssueTokenInvalidTelemetry(t *testing.T) {
+	handler, collector, _, flush := newTestService(t)
+
+	rec := serve(handler, http.MethodPost, "/auth/token", `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	flush()
+
+	if server := collector.Span(t, "auth-service"); server.StatusCode != "unset" {
+		t.Errorf("server span status %s, want unset for a 400", server.StatusCode)
+	}
+	span := collector.Span(t, "Issue Token")
+	if span.StatusCode != "error" || span.StatusMessage != "invalid token request" {
+		t.Errorf("Issue Token status %s %q, want error \"invalid token request\"", span.StatusCode, span.StatusMessage)
+	}
+	if points := collector.PointsNamed("auth_tokens_issued_total", nil); len(points) != 0 {
+		t.Errorf("auth_tokens_issued_total recorded for an invalid request: %+v", points)
+	}
+}
+
+func TestJWKSTelemetry(t *testing.T) {
+	handler, collector, key, flush := newTestService(t)
+
+	rec := serve(handler, http.MethodGet, "/.well-known/jwks.json", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), key.ID) {
+		t.Fatalf("status = %d body %s, want 200 with key %s", rec.Code, rec.Body, key.ID)
+	}
+	flush()
+
+	span := collector.Span(t, "Get JWKS")
+	if span.StatusCode != "unset" {
+		t.Errorf("Get JWKS status %s, want unset", span.StatusCode)
+	}
+	telemetrytest.AssertAttributes(t, "Get JWKS", span.Attributes, map[string]string{"auth.published_keys": "1"})
+	assertCount(t, collector, "auth_jwks_requests_total", nil, 1)
+}
+
+func assertCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want float64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Value != want {
+		t.Errorf("%s%v points = %+v, want one of %g", name, attrs, points, want)
+	}
+}
+
+func assertHistogramCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want uint64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Count != want {
+		t.Errorf("%s%v points = %+v, want one with count %d", name, attrs, points, want)
+	}
+}
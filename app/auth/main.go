@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/chaos"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/jwt"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/probes"
+	"incident-simulation/pkg/profiling"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Incident catalogue of the auth service
+var incidentTypes = []string{"clock_skew", "key_rotation"}
+
+// Scopes granted when a token request does not ask for specific ones
+const defaultScope = "transactions:write balance:read"
+
+// authState holds the signing keys and the active incident, if any
+type authState struct {
+	mu sync.RWMutex
+	// signing signs new tokens; published is what the JWKS endpoint serves
+	signing   jwt.Key
+	published []jwt.Key
+	incident  string
+	// skew is added to the clock while a clock_skew incident is active
+	skew time.Duration
+}
+
+var state = &authState{incident: "none"}
+
+func (s *authState) now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Now().Add(s.skew)
+}
+
+func (s *authState) snapshot() (incident string, skew time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.incident, s.skew
+}
+
+func (s *authState) keySet() jwt.KeySet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ks := jwt.KeySet{Keys: make([]jwt.JWK, 0, len(s.published))}
+	for _, k := range s.published {
+		ks.Keys = append(ks.Keys, k.JWK())
+	}
+	return ks
+}
+
+type TokenRequest struct {
+	UserID string `json:"user_id"`
+	Scope  string `json:"scope"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// Metrics
+var (
+	tokenCounter    metric.Int64Counter
+	jwksCounter     metric.Int64Counter
+	rotationCounter metric.Int64Counter
+	issueDuration   metric.Float64Histogram
+	incidentGauge   metric.Int64ObservableGauge
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Load configuration (flags > env > .env > YAML > defaults)
+	var cfg Config
+	config.MustLoad(&cfg)
+	log.Println("⚙️  Auth Service configuration:")
+	config.Print(log.Writer(), &cfg)
+
+	// Seeded runs replay the same simulator decisions
+	if cfg.SimSeed != 0 {
+		simrand.Seed(cfg.SimSeed)
+	}
+
+	// In-memory buffer of recent spans and logs for /debug/telemetry/recent
+	recorder := telemetry.NewRecorder("auth-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	// Export outcomes for /debug/otel
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	// Per-minute latency histograms and error counts for /debug/latency-heatmap and /debug/export
+	heatmap := telemetry.NewHeatmap("auth-service", cfg.LatencyHeatmapMinutes)
+
+	// Initialize OpenTelemetry
+	shutdown := initOpenTelemetry(ctx, "auth-service", cfg.Telemetry, recorder, health, heatmap)
+	defer shutdown()
+
+	// Optional pprof endpoints and continuous profiling
+	stopProfiling := profiling.Start("auth-service", cfg.Profiling, "localhost:6063")
+	defer stopProfiling()
+
+	// Audit trail of incidents, deployments and admin actions
+	if err := audit.Setup("auth-service", cfg.AuditLogFile, cfg.AuditLogKeep); err != nil {
+		log.Fatalf("Invalid audit log: %v", err)
+	}
+	defer audit.Close()
+
+	// Initial signing key, published right away
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+	state.signing, state.published = key, []jwt.Key{key}
+
+	// Initialize metrics
+	initMetrics(ctx)
+	if err := buildinfo.RegisterMetric("auth-service"); err != nil {
+		logx.Errorw(ctx, "Failed to create build info gauge", "error", err)
+	}
+	if cfg.SimLabelSpans {
+		if err := telemetry.LabelIncidents(func() (bool, string) {
+			kind, _ := state.snapshot()
+			return kind != "none", kind
+		}); err != nil {
+			logx.Errorw(ctx, "Failed to label spans with the active incident", "error", err)
+		}
+	}
+
+	// Start background incident simulator
+	go incidentSimulator(ctx, cfg.IncidentInterval, cfg.IncidentProbability, cfg.TokenTTL)
+
+	// Start auth service
+	startAuthService(cfg, recorder, health, heatmap)
+}
+
+func initOpenTelemetry(ctx context.Context, serviceName string, cfg config.Telemetry, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) func() {
+	// Resource with service information; OTEL_RESOURCE_ATTRIBUTES overrides it
+	res, err := telemetry.NewResource(ctx, serviceName)
+	if err != nil {
+		log.Fatalf("Failed to create resource: %v", err)
+	}
+
+	// OTLP (endpoint, TLS, headers) or stdout/file exporters
+	exporters, err := telemetry.NewExporters(cfg.OTLP, cfg.Output)
+	if err != nil {
+		log.Fatalf("Invalid telemetry exporter settings: %v", err)
+	}
+
+	// Trace exporter
+	traceExporter, err := exporters.Trace(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create trace exporter: %v", err)
+	}
+
+	// Batch span processor whose queue /debug/otel reports
+	spans := telemetry.NewBatchSpanProcessor(health.Spans(traceExporter), cfg.Batching)
+	health.TrackQueue(spans)
+
+	// Personal data is scrubbed before spans and log records are exported or buffered
+	scrubber := telemetry.NewScrubber(cfg.Scrubbing)
+
+	// Trace provider
+	tp := trace.NewTracerProvider(
+		trace.WithSpanProcessor(scrubber.SpanProcessor(spans)),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(recorder)),
+		trace.WithResource(res),
+		// Ratio sampling, overridden for debug requests
+		trace.WithSampler(telemetry.NewSampler(cfg.Sampling)),
+	)
+	otel.SetTracerProvider(tp)
+
+	// Metric exporter
+	metricExporter, err := exporters.Metric(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create metric exporter: %v", err)
+	}
+
+	views, err := telemetry.ParseViewConfig(cfg.MetricViewBuckets, cfg.MetricViewDropAttributes)
+	if err != nil {
+		log.Fatalf("Invalid metric views: %v", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(telemetry.View(views)),
+		sdkmetric.WithReader(telemetry.NewPeriodicReader(heatmap.Metrics(health.Metrics(metricExporter)), cfg.Batching)),
+	)
+	// Caps the attribute sets of every counter and histogram the service creates
+	otel.SetMeterProvider(telemetry.GuardCardinality(mp, cfg.MetricCardinalityLimit, views))
+
+	// Log Provider
+	exporter, err := exporters.Log(ctx)
+	if err != nil {
+		log.Fatalf("failed to create log exporter: %v", err)
+	}
+
+	// Set up the LoggerProvider with a batch processor
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(scrubber.LogProcessor()),
+		sdklog.WithProcessor(telemetry.NewBatchLogProcessor(health.Logs(exporter), cfg.Batching)),
+		sdklog.WithProcessor(recorder),
+	)
+
+	// Set the global logger provider
+	global.SetLoggerProvider(provider)
+
+	// Bridge logrus to OpenTelemetry; logx adds service and trace fields
+	logx.Setup(serviceName, provider)
+	if _, err := logx.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	// Text map propagators from OTEL_PROPAGATORS
+	propagator, err := telemetry.NewPropagator(cfg.Propagators)
+	if err != nil {
+		log.Fatalf("Invalid propagator settings: %v", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down tracer provider", "error", err)
+		}
+		if err := mp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down meter provider", "error", err)
+		}
+		provider.Shutdown(ctx)
+		exporters.Close()
+	}
+}
+
+func initMetrics(ctx context.Context) {
+	meter := otel.Meter("auth-service")
+
+	var err error
+	tokenCounter, err = meter.Int64Counter("auth_tokens_issued_total",
+		metric.WithDescription("Total number of access tokens issued"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create token counter", "error", err)
+	}
+
+	jwksCounter, err = meter.Int64Counter("auth_jwks_requests_total",
+		metric.WithDescription("Total number of JWKS document requests"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create JWKS counter", "error", err)
+	}
+
+	rotationCounter, err = meter.Int64Counter("auth_key_rotations_total",
+		metric.WithDescription("Total number of signing key rotations"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create key rotation counter", "error", err)
+	}
+
+	issueDuration, err = meter.Float64Histogram("auth_token_issue_duration_seconds",
+		metric.WithDescription("Token issuance duration in seconds"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create token issue duration histogram", "error", err)
+	}
+
+	incidentGauge, err = meter.Int64ObservableGauge("auth_incident_active",
+		metric.WithDescription("Whether an auth service incident is currently active"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create incident gauge", "error", err)
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		incident, skew := state.snapshot()
+		var v int64
+		if incident != "none" {
+			v = 1
+		}
+		o.ObserveInt64(incidentGauge, v, metric.WithAttributes(
+			attribute.String("incident_type", incident),
+			attribute.Int64("clock_skew_seconds", int64(skew.Seconds())),
+		))
+		return nil
+	}, incidentGauge)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register incident gauge callback", "error", err)
+	}
+}
+
+func incidentSimulator(ctx context.Context, interval time.Duration, probability float64, tokenTTL time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if incident, _ := state.snapshot(); incident != "none" || simrand.Float64() >= probability {
+			continue
+		}
+
+		kind := incidentTypes[simrand.Intn(len(incidentTypes))]
+		switch kind {
+		case "clock_skew":
+			// Far enough either way to push nbf into the future or exp into the past
+			skew := tokenTTL + time.Duration(1+simrand.Intn(10))*time.Minute
+			if simrand.Intn(2) == 0 {
+				skew = -skew
+			}
+			state.mu.Lock()
+			state.incident, state.skew = kind, skew
+			state.mu.Unlock()
+			audit.Warn(ctx, "incident.started", "🚨 AUTH INCIDENT: clock skew", "incident_type", kind, "clock_skew", skew.String())
+
+		case "key_rotation":
+			// Sign with a new key before it is published in the JWKS
+			key, err := jwt.GenerateKey()
+			if err != nil {
+				logx.Errorw(ctx, "Failed to generate signing key", "error", err)
+				continue
+			}
+			state.mu.Lock()
+			state.incident, state.signing = kind, key
+			state.mu.Unlock()
+			rotationCounter.Add(ctx, 1, metric.WithAttributes(attribute.Bool("published", false)))
+			audit.Warn(ctx, "incident.started", "🚨 AUTH INCIDENT: signing with unpublished key", "incident_type", kind, "auth.key_id", key.ID)
+		}
+
+		// Incident duration: 20-90 seconds
+		duration := time.Duration(20+simrand.Intn(70)) * time.Second
+		go func() {
+			time.Sleep(duration)
+			state.mu.Lock()
+			state.incident, state.skew = "none", 0
+			if kind == "key_rotation" {
+				// Publish the new key and keep the previous one for tokens still in flight
+				state.published = append([]jwt.Key{state.signing}, state.published[0])
+			}
+			state.mu.Unlock()
+			audit.Record(ctx, "incident.resolved", "✅ AUTH INCIDENT RESOLVED", "incident_type", kind)
+		}()
+	}
+}
+
+// newAuthHandler builds the auth service routes with their middleware
+func newAuthHandler(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /auth/token", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer("auth-service").Start(r.Context(), "Issue Token")
+		defer span.End()
+
+		start := time.Now()
+		incident, skew := state.snapshot()
+		span.SetAttributes(attrs.IncidentType(incident))
+
+		var req TokenRequest
+		if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+			span.SetStatus(codes.Error, "invalid token request")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			jsonx.NewEncoder(w).Encode(map[string]string{"error": "user_id is required"})
+			return
+		}
+		if req.Scope == "" {
+			req.Scope = defaultScope
+		}
+
+		// Credential check latency
+		time.Sleep(time.Duration(10+simrand.Intn(40)) * time.Millisecond)
+
+		now := state.now()
+		state.mu.RLock()
+		key := state.signing
+		state.mu.RUnlock()
+
+		token, err := jwt.Sign(jwt.Claims{
+			Issuer:    cfg.TokenIssuer,
+			Subject:   req.UserID,
+			Audience:  cfg.TokenAudience,
+			ID:        fmt.Sprintf("tok_%d_%d", now.UnixNano(), simrand.Intn(10000)),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(cfg.TokenTTL).Unix(),
+			Scope:     req.Scope,
+		}, key)
+		if err != nil {
+			span.SetStatus(codes.Error, "token signing failed")
+			logx.Errorw(ctx, "❌ Failed to sign token", "user.id", req.UserID, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		span.SetAttributes(
+			semconv.UserID(req.UserID),
+			attribute.String("auth.scope", req.Scope),
+			attribute.String("auth.key_id", key.ID),
+			attribute.Int64("auth.clock_skew_seconds", int64(skew.Seconds())),
+		)
+		issueDuration.Record(ctx, time.Since(start).Seconds())
+		tokenCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("incident_type", incident)))
+		logx.Infow(ctx, "🔑 Token issued", "user.id", req.UserID, "auth.key_id", key.ID, "auth.scope", req.Scope)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		jsonx.NewEncoder(w).Encode(TokenResponse{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(cfg.TokenTTL.Seconds()),
+			Scope:       req.Scope,
+		})
+	})
+
+	mux.HandleFunc("GET /.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer("auth-service").Start(r.Context(), "Get JWKS")
+		defer span.End()
+
+		ks := state.keySet()
+		span.SetAttributes(attribute.Int("auth.published_keys", len(ks.Keys)))
+		jwksCounter.Add(ctx, 1)
+
+		w.Header().Set("Content-Type", "application/json")
+		jsonx.NewEncoder(w).Encode(ks)
+	})
+
+	mux.HandleFunc("GET /auth/health", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("auth-service").Start(r.Context(), "Auth Health Check")
+		defer span.End()
+
+		incident, skew := state.snapshot()
+		span.SetAttributes(attrs.IncidentType(incident))
+
+		w.Header().Set("Content-Type", "application/json")
+		jsonx.NewEncoder(w).Encode(map[string]interface{}{
+			"status":             "healthy",
+			"incident_type":      incident,
+			"clock_skew_seconds": int64(skew.Seconds()),
+			"timestamp":          time.Now().Unix(),
+		})
+	})
+
+	// Kubernetes probes sit outside tracing and incident simulation
+	prober := probes.New(2 * time.Second)
+	if cfg.TelemetryExporter == telemetry.ExporterOTLP {
+		prober.AddCheck("otlp_collector", probes.TCPCheck(telemetry.CollectorAddr(cfg.OTLP)))
+		// Not ready until telemetry has reached the collector once
+		prober.AddCheck("telemetry_export", health.Ready)
+	}
+
+	root := http.NewServeMux()
+	prober.Register(root)
+	if cfg.TelemetryBufferSize > 0 {
+		root.Handle("GET /debug/telemetry/recent", recorder)
+	}
+	root.Handle("GET /debug/otel", health)
+	root.Handle("GET /debug/audit", audit.Handler())
+	root.Handle("/debug/loglevel", logx.LevelHandler(audit.Warn))
+	if heatmap.Enabled() {
+		root.Handle("GET /debug/latency-heatmap", heatmap)
+		root.Handle("GET /debug/export", heatmap.Export())
+	}
+	root.Handle("GET /version", buildinfo.Handler("auth-service"))
+	// X-Chaos-* fault injection is a development-only feature
+	var handler http.Handler = mux
+	if cfg.DevMode {
+		handler = chaos.Middleware("auth-service", handler)
+	}
+	handler = httpx.Metrics("auth-service", handler)
+	// X-Debug-Trace and DEBUG_TRACE_USERS requests are sampled whatever TRACE_SAMPLE_RATIO says
+	root.Handle("/", telemetry.DebugTraces(cfg.Sampling, nil, otelhttp.NewHandler(httpx.TraceResponse(handler), "auth-service")))
+
+	prober.MarkStarted()
+	return root
+}
+
+func startAuthService(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) {
+	root := newAuthHandler(cfg, recorder, health, heatmap)
+	log.Printf("🔐 Auth Service running on %s", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, root))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Grafana dashboard JSON model, limited to what the generator emits
+
+type dashboard struct {
+	UID           string   `json:"uid"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description,omitempty"`
+	Tags          []string `json:"tags"`
+	Editable      bool     `json:"editable"`
+	Refresh       string   `json:"refresh"`
+	SchemaVersion int      `json:"schemaVersion"`
+	Time          timeSpan `json:"time"`
+	Panels        []panel  `json:"panels"`
+}
+
+type timeSpan struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type panel struct {
+	ID          int         `json:"id"`
+	Type        string      `json:"type"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	GridPos     gridPos     `json:"gridPos"`
+	Datasource  *datasource `json:"datasource,omitempty"`
+	Targets     []target    `json:"targets,omitempty"`
+	FieldConfig fieldConfig `json:"fieldConfig"`
+	Collapsed   *bool       `json:"collapsed,omitempty"`
+}
+
+type gridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+	Min  *int   `json:"min,omitempty"`
+	Max  *int   `json:"max,omitempty"`
+}
+
+// builder lays panels out two per row
+type builder struct {
+	ds     *datasource
+	panels []panel
+	x, y   int
+}
+
+func newBuilder(datasourceUID string) *builder {
+	return &builder{ds: &datasource{Type: "prometheus", UID: datasourceUID}}
+}
+
+func (b *builder) row(title string) {
+	if b.x != 0 {
+		b.x, b.y = 0, b.y+8
+	}
+	collapsed := false
+	b.panels = append(b.panels, panel{
+		ID:        len(b.panels) + 1,
+		Type:      "row",
+		Title:     title,
+		GridPos:   gridPos{X: 0, Y: b.y, W: 24, H: 1},
+		Collapsed: &collapsed,
+	})
+	b.y++
+}
+
+func (b *builder) add(p panel) {
+	p.ID = len(b.panels) + 1
+	if p.Type == "" {
+		p.Type = "timeseries"
+	}
+	p.Datasource = b.ds
+	p.GridPos = gridPos{X: b.x, Y: b.y, W: 12, H: 8}
+	for i := range p.Targets {
+		p.Targets[i].RefID = string(rune('A' + i))
+	}
+	b.panels = append(b.panels, p)
+	if b.x == 0 {
+		b.x = 12
+	} else {
+		b.x, b.y = 0, b.y+8
+	}
+}
+
+// instrumentPanel charts one instrument the way its kind is read: counters as
+// per-second rates, histograms as quantiles, gauges as current values. groupBy
+// adds labels to every aggregation, e.g. job on shared instruments.
+func instrumentPanel(inst instrument, groupBy ...string) panel {
+	labels := append(append([]string{}, groupBy...), inst.Attributes...)
+	by := ""
+	legend := inst.Name
+	if len(labels) > 0 {
+		by = " by (" + strings.Join(labels, ", ") + ")"
+		legend = strings.Join(legendLabels(labels), " ")
+	}
+
+	p := panel{
+		Title:       inst.Name,
+		Description: inst.Description,
+	}
+	switch inst.Kind {
+	case kindCounter:
+		p.Targets = []target{{
+			Expr:         fmt.Sprintf("sum%s (rate(%s[$__rate_interval]))", by, inst.Name),
+			LegendFormat: legend,
+		}}
+		p.FieldConfig.Defaults.Unit = "ops"
+	case kindHistogram:
+		bucketBy := " by (" + strings.Join(append(append([]string{}, groupBy...), "le"), ", ") + ")"
+		for _, q := range quantiles {
+			p.Targets = append(p.Targets, target{
+				Expr:         fmt.Sprintf("histogram_quantile(%s, sum%s (rate(%s_bucket[$__rate_interval])))", q.value, bucketBy, inst.Name),
+				LegendFormat: strings.TrimSpace(strings.Join(legendLabels(groupBy), " ") + " " + q.name),
+			})
+		}
+		p.FieldConfig.Defaults.Unit = histogramUnit(inst)
+	default:
+		p.Targets = []target{{
+			Expr:         fmt.Sprintf("sum%s (%s)", by, inst.Name),
+			LegendFormat: legend,
+		}}
+	}
+	return p
+}
+
+var quantiles = []struct{ name, value string }{{"p50", "0.5"}, {"p95", "0.95"}, {"p99", "0.99"}}
+
+func legendLabels(labels []string) []string {
+	out := make([]string, len(labels))
+	for i, l := range labels {
+		out[i] = "{{" + l + "}}"
+	}
+	return out
+}
+
+func histogramUnit(inst instrument) string {
+	switch {
+	case strings.HasSuffix(inst.Name, "_seconds") || inst.Unit == "s":
+		return "s"
+	case strings.HasSuffix(inst.Name, "_bytes") || inst.Unit == "By":
+		return "bytes"
+	default:
+		return "short"
+	}
+}
@@ -0,0 +1,232 @@
+// Command dashgen builds the Grafana dashboards from the metrics the services
+// actually create. It parses the service sources for OTel instruments and the
+// attribute keys they are recorded with, and emits one dashboard per service,
+// one for the shared HTTP middleware and an incident overview. Regenerate after
+// changing instrumentation; --check fails when the files on disk are stale.
+//
+//	go run ./cmd/dashgen --out ../stack/dashboards
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"incident-simulation/pkg/config"
+)
+
+// Config is the dashboard generator configuration
+type Config struct {
+	SourceDir     string `env:"DASHGEN_SOURCE" flag:"source" usage:"The app/ directory holding the service sources (default: found from the working directory)"`
+	OutDir        string `env:"DASHGEN_OUT" flag:"out" default:"dashboards" usage:"Directory the dashboard JSON files are written to"`
+	DatasourceUID string `env:"DASHGEN_DATASOURCE_UID" flag:"datasource-uid" default:"metrics" usage:"UID of the Prometheus/Mimir datasource (cmd/stackgen provisions metrics)"`
+	Check         bool   `env:"DASHGEN_CHECK" flag:"check" usage:"Only report whether the files in --out are up to date"`
+}
+
+// Services with their own dashboard: directory under app/ and title
+var services = []struct{ dir, title string }{
+	{"core", "Core API"},
+	{"database", "Database"},
+	{"payment-gateway", "Payment Gateway"},
+	{"auth", "Auth"},
+	{"analyzer", "Analyzer"},
+	{"worker", "Worker"},
+}
+
+// Middleware packages every service runs; their panels are split by job
+var sharedPackages = []string{"pkg/httpx", "pkg/chaos"}
+
+// Instruments on the overview; generation fails if one of them disappears
+var overviewMetrics = []string{
+	"api_transactions_total",
+	"api_errors_total",
+	"api_response_time_seconds",
+	"db_query_duration_seconds",
+	"db_errors_total",
+}
+
+func main() {
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	source := cfg.SourceDir
+	if source == "" {
+		var err error
+		if source, err = findAppDir(); err != nil {
+			log.Fatalf("Cannot locate the app/ directory, pass --source: %v", err)
+		}
+	}
+
+	dashboards, err := generate(source, cfg.DatasourceUID)
+	if err != nil {
+		log.Fatalf("Failed to generate dashboards: %v", err)
+	}
+
+	var stale []string
+	for _, d := range dashboards {
+		content, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode dashboard %s: %v", d.UID, err)
+		}
+		content = append(content, '\n')
+		path := filepath.Join(cfg.OutDir, d.UID+".json")
+
+		if cfg.Check {
+			if existing, err := os.ReadFile(path); err != nil || !bytes.Equal(existing, content) {
+				stale = append(stale, path)
+			}
+			continue
+		}
+		if err := os.MkdirAll(cfg.OutDir, 0o755); err != nil {
+			log.Fatalf("Failed to create %s: %v", cfg.OutDir, err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		log.Printf("📊 %s: %d panels", path, len(d.Panels))
+	}
+
+	if cfg.Check {
+		if len(stale) > 0 {
+			log.Fatalf("❌ Dashboards out of date, rerun dashgen: %s", strings.Join(stale, ", "))
+		}
+		log.Printf("✅ %d dashboards in %s are up to date", len(dashboards), cfg.OutDir)
+	}
+}
+
+func generate(source, datasourceUID string) ([]dashboard, error) {
+	byName := make(map[string]instrument)
+	var incidents []instrument
+	var dashboards []dashboard
+
+	for _, svc := range services {
+		instruments, err := scanPackage(filepath.Join(source, svc.dir))
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", svc.dir, err)
+		}
+		if len(instruments) == 0 {
+			return nil, fmt.Errorf("no instruments found in %s", svc.dir)
+		}
+
+		b := newBuilder(datasourceUID)
+		for _, kind := range []struct{ kind, title string }{
+			{kindCounter, "Counters"},
+			{kindHistogram, "Latencies and sizes"},
+			{kindGauge, "Gauges"},
+		} {
+			var panels []panel
+			for _, inst := range instruments {
+				if inst.Kind == kind.kind {
+					panels = append(panels, instrumentPanel(inst))
+				}
+			}
+			if len(panels) == 0 {
+				continue
+			}
+			b.row(kind.title)
+			for _, p := range panels {
+				b.add(p)
+			}
+		}
+		for _, inst := range instruments {
+			byName[inst.Name] = inst
+			if strings.HasSuffix(inst.Name, "_incident_active") {
+				incidents = append(incidents, inst)
+			}
+		}
+
+		dashboards = append(dashboards, newDashboard("svc-"+svc.dir, svc.title,
+			fmt.Sprintf("Every instrument created in app/%s, generated by cmd/dashgen", svc.dir), b.panels))
+	}
+
+	b := newBuilder(datasourceUID)
+	for _, pkg := range sharedPackages {
+		instruments, err := scanPackage(filepath.Join(source, pkg))
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", pkg, err)
+		}
+		b.row(pkg)
+		for _, inst := range instruments {
+			b.add(instrumentPanel(inst, "job"))
+		}
+	}
+	dashboards = append(dashboards, newDashboard("svc-http", "HTTP Servers",
+		"Shared middleware instruments split by service (job), generated by cmd/dashgen", b.panels))
+
+	overview, err := overviewDashboard(byName, incidents, datasourceUID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]dashboard{overview}, dashboards...), nil
+}
+
+// overviewDashboard puts every *_incident_active gauge next to the headline
+// transaction, error and latency series
+func overviewDashboard(byName map[string]instrument, incidents []instrument, datasourceUID string) (dashboard, error) {
+	b := newBuilder(datasourceUID)
+
+	b.row("Incidents")
+	if len(incidents) == 0 {
+		return dashboard{}, errors.New("overview: no *_incident_active gauge is emitted any more")
+	}
+	zero, one := 0, 1
+	active := panel{
+		Title:       "Active incidents",
+		Description: "1 while a simulated incident is running, by service and incident type",
+		FieldConfig: fieldConfig{Defaults: fieldDefaults{Min: &zero, Max: &one}},
+	}
+	for _, inst := range incidents {
+		p := instrumentPanel(inst)
+		p.Targets[0].LegendFormat = strings.TrimSuffix(inst.Name, "_incident_active") + " " + p.Targets[0].LegendFormat
+		active.Targets = append(active.Targets, p.Targets[0])
+	}
+	b.add(active)
+
+	b.row("Golden signals")
+	for _, name := range overviewMetrics {
+		inst, ok := byName[name]
+		if !ok {
+			return dashboard{}, fmt.Errorf("overview: %s is no longer emitted", name)
+		}
+		b.add(instrumentPanel(inst))
+	}
+
+	return newDashboard("overview", "Incident Overview",
+		"Incident state and golden signals across services, generated by cmd/dashgen", b.panels), nil
+}
+
+func newDashboard(uid, title, description string, panels []panel) dashboard {
+	return dashboard{
+		UID:           "ai-obs-" + uid,
+		Title:         title,
+		Description:   description,
+		Tags:          []string{"ai-driven-observability", "generated"},
+		Refresh:       "30s",
+		SchemaVersion: 39,
+		Time:          timeSpan{From: "now-1h", To: "now"},
+		Panels:        panels,
+	}
+}
+
+// findAppDir walks up from the working directory to the directory holding app/go.mod
+func findAppDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "app", "go.mod")); err == nil {
+			return filepath.Join(dir, "app"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no app/go.mod in any parent directory")
+		}
+		dir = parent
+	}
+}
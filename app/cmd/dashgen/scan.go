@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Instrument kinds as they appear in the OTel metric API
+const (
+	kindCounter   = "counter"
+	kindHistogram = "histogram"
+	kindGauge     = "gauge"
+)
+
+var instrumentKinds = map[string]string{
+	"Int64Counter":                 kindCounter,
+	"Float64Counter":               kindCounter,
+	"Int64ObservableCounter":       kindCounter,
+	"Float64ObservableCounter":     kindCounter,
+	"Int64Histogram":               kindHistogram,
+	"Float64Histogram":             kindHistogram,
+	"Int64UpDownCounter":           kindGauge,
+	"Float64UpDownCounter":         kindGauge,
+	"Int64ObservableUpDownCounter": kindGauge,
+	"Int64ObservableGauge":         kindGauge,
+	"Float64ObservableGauge":       kindGauge,
+}
+
+// instrument is one metric found in the source
+type instrument struct {
+	Name        string
+	Kind        string
+	Description string
+	Unit        string
+	// Attribute keys recorded with the instrument anywhere in its package
+	Attributes []string
+}
+
+// scanPackage returns the instruments created in the Go files of dir and the
+// attribute keys they are recorded with. Instruments are matched to their
+// Add/Record/Observe calls through the variable or field they are assigned to.
+func scanPackage(dir string) ([]instrument, error) {
+	fset := token.NewFileSet()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ast.File
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") || strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, e.Name()), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	found := make(map[string]*instrument) // by bound variable
+	var order []string
+	attrs := make(map[string]map[string]bool)
+
+	// Instrument creation: <var>, err = meter.<Kind>("name", opts...)
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			assign, ok := n.(*ast.AssignStmt)
+			if !ok || len(assign.Rhs) != 1 || len(assign.Lhs) == 0 {
+				return true
+			}
+			call, ok := assign.Rhs[0].(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			kind, ok := instrumentKinds[sel.Sel.Name]
+			if !ok {
+				return true
+			}
+			name, ok := stringLit(call.Args[0])
+			if !ok {
+				return true
+			}
+
+			inst := &instrument{Name: name, Kind: kind}
+			for _, opt := range call.Args[1:] {
+				optCall, ok := opt.(*ast.CallExpr)
+				if !ok || len(optCall.Args) != 1 {
+					continue
+				}
+				optSel, ok := optCall.Fun.(*ast.SelectorExpr)
+				if !ok {
+					continue
+				}
+				switch optSel.Sel.Name {
+				case "WithDescription":
+					inst.Description, _ = stringLit(optCall.Args[0])
+				case "WithUnit":
+					inst.Unit, _ = stringLit(optCall.Args[0])
+				}
+			}
+			bound := exprString(assign.Lhs[0])
+			if _, dup := found[bound]; !dup {
+				order = append(order, bound)
+			}
+			found[bound] = inst
+			return true
+		})
+	}
+
+	// Recording: <var>.Add/Record(ctx, v, opts...) and o.Observe*(<var>, v, opts...)
+	for _, f := range files {
+		locals := localAssignments(f)
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			var bound string
+			var opts []ast.Expr
+			switch sel.Sel.Name {
+			case "Add", "Record":
+				bound, opts = exprString(sel.X), call.Args
+			case "ObserveInt64", "ObserveFloat64":
+				if len(call.Args) > 0 {
+					bound, opts = exprString(call.Args[0]), call.Args[1:]
+				}
+			default:
+				return true
+			}
+			if _, ok := found[bound]; !ok {
+				return true
+			}
+			if attrs[bound] == nil {
+				attrs[bound] = make(map[string]bool)
+			}
+			for _, opt := range opts {
+				collectAttributeKeys(opt, locals, attrs[bound], 0)
+			}
+			return true
+		})
+	}
+
+	out := make([]instrument, 0, len(order))
+	for _, bound := range order {
+		inst := found[bound]
+		for k := range attrs[bound] {
+			inst.Attributes = append(inst.Attributes, k)
+		}
+		sort.Strings(inst.Attributes)
+		out = append(out, *inst)
+	}
+	return out, nil
+}
+
+// collectAttributeKeys adds the keys of attribute.<Type>("key", ...) calls in e,
+// following identifiers to their assignments in the same file
+func collectAttributeKeys(e ast.Expr, locals map[string][]ast.Expr, keys map[string]bool, depth int) {
+	if depth > 4 {
+		return
+	}
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && exprString(sel.X) == "attribute" && len(n.Args) > 0 {
+				if key, ok := stringLit(n.Args[0]); ok {
+					keys[key] = true
+				}
+			}
+		case *ast.Ident:
+			for _, rhs := range locals[n.Name] {
+				collectAttributeKeys(rhs, locals, keys, depth+1)
+			}
+		}
+		return true
+	})
+}
+
+// localAssignments maps every identifier assigned in f to the expressions assigned to it
+func localAssignments(f *ast.File) map[string][]ast.Expr {
+	locals := make(map[string][]ast.Expr)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignStmt); ok && len(assign.Lhs) == len(assign.Rhs) {
+			for i, lhs := range assign.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok {
+					locals[id.Name] = append(locals[id.Name], assign.Rhs[i])
+				}
+			}
+		}
+		return true
+	})
+	return locals
+}
+
+func stringLit(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// exprString renders identifiers and selectors such as e.firing
+func exprString(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.StarExpr:
+		return exprString(e.X)
+	default:
+		return fmt.Sprintf("%T", e)
+	}
+}
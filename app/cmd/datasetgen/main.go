@@ -0,0 +1,319 @@
+// Command datasetgen produces a training dataset for offline models: a
+// feature matrix of per-minute metrics per service, labelled with the
+// simulated incident of every minute (see pkg/dataset), as CSV or Parquet.
+//
+// It either collects from the running stack, reading every target's GET
+// /debug/export each poll interval for the whole duration, optionally
+// starting the stack itself with cmd/dev, or reads /debug/export NDJSON
+// files saved earlier. Labels come from the database service's GET
+// /db/incidents, or from its DB_INCIDENT_HISTORY_FILE.
+//
+//	SIM_PRESET=training-data go run ./cmd/datasetgen --run-stack --duration 6h --out dataset.parquet --format parquet
+//	go run ./cmd/datasetgen --input core.jsonl,db.jsonl --incidents-file incidents.jsonl --out dataset.csv
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/dataset"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Config is the dataset generator configuration
+type Config struct {
+	Targets       string        `env:"DATASET_TARGETS" flag:"targets" default:"http://127.0.0.1:8080,http://127.0.0.1:8081,http://127.0.0.1:8082,http://127.0.0.1:8083,http://127.0.0.1:8085" usage:"Comma-separated base URLs of the services whose /debug/export is collected"`
+	Duration      time.Duration `env:"DATASET_DURATION" flag:"duration" default:"1h" usage:"How long to collect from the running stack"`
+	PollInterval  time.Duration `env:"DATASET_POLL_INTERVAL" flag:"poll-interval" default:"5m" usage:"How often the targets are read; keep it well below their LATENCY_HEATMAP_MINUTES"`
+	RunStack      bool          `env:"DATASET_RUN_STACK" flag:"run-stack" usage:"Start the stack with cmd/dev for the collection and stop it afterwards; run from the app directory"`
+	Input         string        `env:"DATASET_INPUT" flag:"input" usage:"Comma-separated /debug/export NDJSON files to build the dataset from instead of collecting"`
+	IncidentsURL  string        `env:"DATASET_INCIDENTS_URL" flag:"incidents-url" default:"http://127.0.0.1:8081" usage:"Database service base URL whose GET /db/incidents labels the minutes"`
+	IncidentsFile string        `env:"DATASET_INCIDENTS_FILE" flag:"incidents-file" usage:"DB_INCIDENT_HISTORY_FILE to label the minutes from instead of DATASET_INCIDENTS_URL"`
+	Out           string        `env:"DATASET_OUT" flag:"out" default:"dataset.csv" usage:"File the dataset is written to"`
+	Format        string        `env:"DATASET_FORMAT" flag:"format" default:"csv" usage:"Dataset format: csv or parquet"`
+	Timeout       time.Duration `env:"DATASET_TIMEOUT" flag:"timeout" default:"30s" usage:"Timeout of each request"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Input == "" && (c.Duration <= 0 || c.PollInterval <= 0) {
+		errs = append(errs, errors.New("DATASET_DURATION and DATASET_POLL_INTERVAL must be positive"))
+	}
+	if c.Input != "" && c.RunStack {
+		errs = append(errs, errors.New("DATASET_RUN_STACK collects from the stack and cannot be combined with DATASET_INPUT"))
+	}
+	if c.IncidentsURL == "" && c.IncidentsFile == "" {
+		errs = append(errs, errors.New("DATASET_INCIDENTS_URL or DATASET_INCIDENTS_FILE must be set"))
+	}
+	if c.Format != "csv" && c.Format != "parquet" {
+		errs = append(errs, errors.New("DATASET_FORMAT must be csv or parquet"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("DATASET_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	if err := run(ctx, cfg); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+// run collects or reads the telemetry, labels it and writes the dataset. A
+// stack it started runs until the labels have been read from it.
+func run(ctx context.Context, cfg Config) error {
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	var summaries []telemetry.MinuteSummary
+	var err error
+	if cfg.Input != "" {
+		if summaries, err = readInputs(split(cfg.Input)); err != nil {
+			return fmt.Errorf("read the telemetry exports: %w", err)
+		}
+	} else {
+		if cfg.RunStack {
+			stopStack, err := startStack(ctx)
+			if err != nil {
+				return fmt.Errorf("start the stack: %w", err)
+			}
+			defer stopStack()
+		}
+		// Ctrl-C ends the collection early; the minutes so far are still written
+		summaries = collect(ctx, client, split(cfg.Targets), cfg.Duration, cfg.PollInterval)
+	}
+	if len(summaries) == 0 {
+		return errors.New("no telemetry minutes to build a dataset from")
+	}
+
+	var incidents []dataset.Incident
+	if cfg.IncidentsFile != "" {
+		incidents, err = readIncidentsFile(cfg.IncidentsFile)
+	} else {
+		since := summaries[0].Minute
+		for _, s := range summaries {
+			if s.Minute.Before(since) {
+				since = s.Minute
+			}
+		}
+		incidents, err = fetchIncidents(context.WithoutCancel(ctx), client, cfg.IncidentsURL, since)
+	}
+	if err != nil {
+		return fmt.Errorf("read the incident labels: %w", err)
+	}
+
+	frame := dataset.Build(summaries, incidents)
+	if err := write(frame, cfg.Out, cfg.Format); err != nil {
+		return fmt.Errorf("write the dataset: %w", err)
+	}
+	active := 0
+	for _, l := range frame.Labels {
+		if l.Active {
+			active++
+		}
+	}
+	log.Printf("✅ %d minutes × %d features (%d minutes in %d incidents) written to %s", len(frame.Minutes), len(frame.Features), active, len(incidents), cfg.Out)
+	return nil
+}
+
+func split(list string) []string {
+	var out []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// startStack builds cmd/dev and runs it until the returned function is called
+func startStack(ctx context.Context) (func(), error) {
+	binDir, err := os.MkdirTemp("", "incident-sim-datasetgen-")
+	if err != nil {
+		return nil, err
+	}
+	bin := filepath.Join(binDir, "dev")
+	build := exec.CommandContext(ctx, "go", "build", "-o", bin, "./cmd/dev")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		os.RemoveAll(binDir)
+		return nil, fmt.Errorf("build cmd/dev: %w", err)
+	}
+
+	stackCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	cmd := exec.CommandContext(stackCtx, bin)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = time.Minute
+	if err := cmd.Start(); err != nil {
+		cancel()
+		os.RemoveAll(binDir)
+		return nil, err
+	}
+	log.Printf("🚀 Started the stack with cmd/dev")
+	return func() {
+		log.Printf("🛑 Stopping the stack")
+		cancel()
+		cmd.Wait()
+		os.RemoveAll(binDir)
+	}, nil
+}
+
+// collect reads every target's recent minutes each interval until duration
+// has passed or ctx is done. Each read covers twice the interval, so a slow
+// or failed read leaves no gap; Build keeps the last reading of a minute.
+func collect(ctx context.Context, client *http.Client, targets []string, duration, interval time.Duration) []telemetry.MinuteSummary {
+	log.Printf("📡 Collecting %s of telemetry from %s every %s", duration, strings.Join(targets, ", "), interval)
+	deadline := time.After(duration)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var out []telemetry.MinuteSummary
+	poll := func(ctx context.Context) {
+		for _, target := range targets {
+			minutes, err := fetchExport(ctx, client, target, 2*interval)
+			if err != nil {
+				log.Printf("⚠️ Failed to read %s: %v", target, err)
+				continue
+			}
+			out = append(out, minutes...)
+		}
+	}
+	for {
+		select {
+		case <-ticker.C:
+			poll(ctx)
+		case <-deadline:
+			// One more read, after the last full minute has closed
+			select {
+			case <-time.After(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute + 5*time.Second))):
+			case <-ctx.Done():
+			}
+			poll(context.WithoutCancel(ctx))
+			return out
+		case <-ctx.Done():
+			poll(context.WithoutCancel(ctx))
+			return out
+		}
+	}
+}
+
+func fetchExport(ctx context.Context, client *http.Client, target string, window time.Duration) ([]telemetry.MinuteSummary, error) {
+	resp, err := get(ctx, client, target+"/debug/export?window="+url.QueryEscape(window.String()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return dataset.ReadSummaries(resp.Body)
+}
+
+// fetchIncidents reads every incident since since, a page at a time
+func fetchIncidents(ctx context.Context, client *http.Client, baseURL string, since time.Time) ([]dataset.Incident, error) {
+	var out []dataset.Incident
+	query := url.Values{"since": {since.Format(time.RFC3339)}, "limit": {"500"}}
+	for {
+		resp, err := get(ctx, client, baseURL+"/db/incidents?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Incidents  []dataset.Incident `json:"incidents"`
+			NextCursor string             `json:"next_cursor"`
+		}
+		err = jsonx.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page.Incidents...)
+		if page.NextCursor == "" {
+			return out, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+func get(ctx context.Context, client *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func readInputs(paths []string) ([]telemetry.MinuteSummary, error) {
+	var out []telemetry.MinuteSummary
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		minutes, err := dataset.ReadSummaries(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		out = append(out, minutes...)
+	}
+	return out, nil
+}
+
+func readIncidentsFile(path string) ([]dataset.Incident, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	incidents, err := dataset.ReadIncidents(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return incidents, nil
+}
+
+// write saves the frame, written aside and renamed so a failed run never
+// leaves half a dataset
+func write(frame *dataset.Frame, path, format string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if format == "parquet" {
+		err = frame.WriteParquet(f)
+	} else {
+		err = frame.WriteCSV(f)
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,204 @@
+// Command dev runs the whole demo locally: it builds the selected services,
+// starts them in dependency order with their URLs wired to each other,
+// restarts any that crash and prefixes their output with the service name.
+// Ctrl-C stops everything.
+//
+//	go run ./cmd/dev
+//	go run ./cmd/dev --services database,payment-gateway,core,loadgen --dev-mode
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"incident-simulation/pkg/config"
+)
+
+// Config is the dev runner configuration
+type Config struct {
+	Services          string        `env:"DEV_SERVICES" flag:"services" default:"database,analyzer,payment-gateway,auth,worker,core,loadgen" usage:"Comma-separated services to run"`
+	SourceDir         string        `env:"DEV_SOURCE" flag:"source" usage:"The repository's app directory (default: found from the working directory)"`
+	DevMode           bool          `env:"DEV_DEV_MODE" flag:"dev-mode" usage:"Run the services with DEV_MODE (X-Chaos-* headers, admin endpoints)"`
+	TelemetryExporter string        `env:"DEV_TELEMETRY_EXPORTER" flag:"telemetry-exporter" usage:"TELEMETRY_EXPORTER for every service, e.g. stdout when no collector runs (default: each service's own)"`
+	ReadyTimeout      time.Duration `env:"DEV_READY_TIMEOUT" flag:"ready-timeout" default:"30s" usage:"How long to wait for a service's /startupz before starting the next one anyway"`
+	RestartDelay      time.Duration `env:"DEV_RESTART_DELAY" flag:"restart-delay" default:"1s" usage:"Pause before restarting a crashed service; doubles while it keeps crashing"`
+	MaxRestartDelay   time.Duration `env:"DEV_MAX_RESTART_DELAY" flag:"max-restart-delay" default:"30s" usage:"Longest pause between restarts"`
+	StopTimeout       time.Duration `env:"DEV_STOP_TIMEOUT" flag:"stop-timeout" default:"10s" usage:"How long a service may take to exit after the interrupt before it is killed"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.ReadyTimeout <= 0 {
+		errs = append(errs, errors.New("DEV_READY_TIMEOUT must be positive"))
+	}
+	if c.RestartDelay <= 0 || c.MaxRestartDelay < c.RestartDelay {
+		errs = append(errs, errors.New("DEV_RESTART_DELAY must be positive and DEV_MAX_RESTART_DELAY at least that"))
+	}
+	if c.StopTimeout <= 0 {
+		errs = append(errs, errors.New("DEV_STOP_TIMEOUT must be positive"))
+	}
+	switch c.TelemetryExporter {
+	case "", "otlp", "stdout", "file":
+	default:
+		errs = append(errs, fmt.Errorf("DEV_TELEMETRY_EXPORTER must be otlp, stdout or file, got %q", c.TelemetryExporter))
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	source := cfg.SourceDir
+	if source == "" {
+		var err error
+		if source, err = findAppDir(); err != nil {
+			log.Fatalf("Cannot locate the app directory, pass --source: %v", err)
+		}
+	}
+
+	procs, err := plan(cfg, strings.Split(cfg.Services, ","), source)
+	if err != nil {
+		log.Fatalf("Invalid service selection: %v", err)
+	}
+
+	binDir, err := os.MkdirTemp("", "incident-sim-dev-")
+	if err != nil {
+		log.Fatalf("Failed to create the build directory: %v", err)
+	}
+	defer os.RemoveAll(binDir)
+
+	out := newMux(os.Stdout, procs)
+	if err := buildAll(ctx, procs, binDir, out); err != nil {
+		log.Fatalf("Build failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.supervise(ctx, cfg, out)
+		}()
+		if p.spec.Port != 0 {
+			p.waitReady(ctx, cfg.ReadyTimeout)
+		}
+	}
+	if ctx.Err() == nil {
+		log.Printf("✅ Running %s; Ctrl-C stops everything", strings.Join(names(procs), ", "))
+	}
+
+	<-ctx.Done()
+	log.Printf("🛑 Stopping services")
+	wg.Wait()
+}
+
+// plan resolves the selected services into processes in start order
+func plan(cfg Config, selected []string, appDir string) ([]*process, error) {
+	enabled := make(map[string]bool)
+	for _, n := range selected {
+		if n = strings.TrimSpace(n); n != "" {
+			enabled[n] = true
+		}
+	}
+	if len(enabled) == 0 {
+		return nil, errors.New("no services selected")
+	}
+
+	known := make(map[string]bool, len(catalog))
+	for _, spec := range catalog {
+		known[spec.Dir] = true
+	}
+	var unknown []string
+	for n := range enabled {
+		if !known[n] {
+			unknown = append(unknown, n)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown services %s", strings.Join(unknown, ", "))
+	}
+
+	var procs []*process
+	for _, spec := range catalog {
+		if !enabled[spec.Dir] {
+			continue
+		}
+		for _, req := range spec.Requires {
+			if !enabled[req] {
+				return nil, fmt.Errorf("%s needs %s", spec.Dir, req)
+			}
+		}
+
+		var env []string
+		if cfg.DevMode {
+			env = append(env, "DEV_MODE=true")
+		}
+		if cfg.TelemetryExporter != "" {
+			env = append(env, "TELEMETRY_EXPORTER="+cfg.TelemetryExporter)
+		}
+		links := make([]string, 0, len(spec.Links))
+		for dep := range spec.Links {
+			links = append(links, dep)
+		}
+		sort.Strings(links)
+		for _, dep := range links {
+			if enabled[dep] {
+				env = append(env, spec.Links[dep])
+			} else if v, ok := spec.Unlinked[dep]; ok {
+				env = append(env, v)
+			}
+		}
+		procs = append(procs, &process{spec: spec, dir: filepath.Join(appDir, spec.Dir), env: env})
+	}
+	return procs, nil
+}
+
+// findAppDir walks up from the working directory to the app directory, the
+// one holding go.mod next to the service directories
+func findAppDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, candidate := range []string{dir, filepath.Join(dir, "app")} {
+			if _, err := os.Stat(filepath.Join(candidate, "go.mod")); err == nil {
+				if _, err := os.Stat(filepath.Join(candidate, "core")); err == nil {
+					return candidate, nil
+				}
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no app/go.mod in any parent directory")
+		}
+		dir = parent
+	}
+}
+
+func names(procs []*process) []string {
+	out := make([]string, len(procs))
+	for i, p := range procs {
+		out[i] = p.spec.Dir
+	}
+	return out
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceSpec describes one service under app/ the runner can start
+type serviceSpec struct {
+	// Directory under app/, also the log prefix
+	Dir string
+	// Listen port whose /startupz gates the next service; 0 for none
+	Port int
+	// Services that must be selected too
+	Requires []string
+	// Environment that points at other services; only set when those run
+	Links map[string]string
+	// Environment set instead when a linked service is left out
+	Unlinked map[string]string
+}
+
+// The services under app/, in start order. Their URL defaults already point
+// at 127.0.0.1, so links only cover what is off by default.
+var catalog = []serviceSpec{
+	{Dir: "database", Port: 8081},
+	{Dir: "analyzer", Port: 8084},
+	{
+		Dir:  "payment-gateway",
+		Port: 8082,
+		Links: map[string]string{
+			"analyzer": "DEPLOY_EVENTS_URL=http://127.0.0.1:8084/api/v1/deployments",
+		},
+	},
+	{Dir: "auth", Port: 8083},
+	{Dir: "worker", Port: 8085, Requires: []string{"database"}},
+	{
+		Dir:      "core",
+		Port:     8080,
+		Requires: []string{"database", "payment-gateway"},
+		Links: map[string]string{
+			"analyzer": "DEPLOY_EVENTS_URL=http://127.0.0.1:8084/api/v1/deployments",
+			// The load generator plays the edge proxy, naming its clients in X-Forwarded-For
+			"loadgen": "RATE_LIMIT_TRUSTED_PROXIES=127.0.0.1,::1",
+		},
+	},
+	{
+		Dir:      "loadgen",
+		Requires: []string{"core"},
+		Unlinked: map[string]string{
+			"auth": "AUTH_SERVICE_URL=",
+		},
+	},
+}
+
+// process is one service binary and the environment it runs with
+type process struct {
+	spec serviceSpec
+	dir  string
+	env  []string
+	bin  string
+}
+
+// buildAll compiles every service into binDir, in parallel
+func buildAll(ctx context.Context, procs []*process, binDir string, out *mux) error {
+	log.Printf("🔨 Building %s", strings.Join(names(procs), ", "))
+	errs := make([]error, len(procs))
+	var wg sync.WaitGroup
+	for i, p := range procs {
+		p.bin = filepath.Join(binDir, p.spec.Dir)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.CommandContext(ctx, "go", "build", "-o", p.bin, ".")
+			cmd.Dir = p.dir
+			cmd.Stdout, cmd.Stderr = out.writer(p.spec.Dir), out.writer(p.spec.Dir)
+			if err := cmd.Run(); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", p.spec.Dir, err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// supervise runs the service from its directory, so its .env and relative
+// paths resolve as with go run, and restarts it until ctx is done. The
+// restart delay doubles while the service keeps exiting within a minute.
+func (p *process) supervise(ctx context.Context, cfg Config, out *mux) {
+	delay := cfg.RestartDelay
+	for {
+		cmd := exec.CommandContext(ctx, p.bin)
+		cmd.Dir = p.dir
+		cmd.Env = append(os.Environ(), p.env...)
+		cmd.Stdout, cmd.Stderr = out.writer(p.spec.Dir), out.writer(p.spec.Dir)
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = cfg.StopTimeout
+
+		started := time.Now()
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			delay = cfg.RestartDelay
+		}
+		log.Printf("💥 %s exited (%v), restarting in %s", p.spec.Dir, err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, cfg.MaxRestartDelay)
+	}
+}
+
+// waitReady polls the service's /startupz until it answers 200, timeout passes
+// or ctx is done
+func (p *process) waitReady(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	url := fmt.Sprintf("http://127.0.0.1:%d/startupz", p.spec.Port)
+	client := &http.Client{Timeout: time.Second}
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				log.Printf("⚠️  %s not ready after %s, starting the rest anyway", p.spec.Dir, timeout)
+			}
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// mux interleaves the output of every service line by line, each line
+// prefixed with the service name
+type mux struct {
+	mu    sync.Mutex
+	out   io.Writer
+	width int
+}
+
+func newMux(out io.Writer, procs []*process) *mux {
+	m := &mux{out: out}
+	for _, p := range procs {
+		m.width = max(m.width, len(p.spec.Dir))
+	}
+	return m
+}
+
+func (m *mux) writer(name string) io.Writer {
+	return &prefixWriter{mux: m, prefix: fmt.Sprintf("%-*s | ", m.width, name)}
+}
+
+// prefixWriter holds back partial lines until their newline arrives
+type prefixWriter struct {
+	mux    *mux
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		w.mux.mu.Lock()
+		_, err := fmt.Fprintf(w.mux.out, "%s%s\n", w.prefix, w.buf[:i])
+		w.mux.mu.Unlock()
+		w.buf = w.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Command replay plays back a request recording made by the core API with
+// RECORD_FILE set, reproducing the original traffic pattern against a target.
+//
+//	go run ./cmd/replay --file requests.jsonl --speed 10
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/replay"
+)
+
+// Config is the replay tool configuration
+type Config struct {
+	ReplayFile  string        `env:"REPLAY_FILE" flag:"file" required:"true" usage:"Recording written by the core API's RECORD_FILE"`
+	TargetURL   string        `env:"TARGET_URL" flag:"target" default:"http://127.0.0.1:8080" usage:"Base URL the requests are sent to"`
+	Speed       float64       `env:"REPLAY_SPEED" flag:"speed" default:"1" usage:"Time compression: 1 keeps the original timing, 10 is ten times faster, 0 sends back to back"`
+	MaxInFlight int           `env:"REPLAY_MAX_IN_FLIGHT" flag:"max-in-flight" default:"100" usage:"Maximum concurrent requests"`
+	Timeout     time.Duration `env:"REPLAY_TIMEOUT" flag:"timeout" default:"30s" usage:"Per-request timeout"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Speed < 0 {
+		errs = append(errs, errors.New("REPLAY_SPEED must not be negative"))
+	}
+	if c.MaxInFlight < 1 {
+		errs = append(errs, errors.New("REPLAY_MAX_IN_FLIGHT must be at least 1"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("REPLAY_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	f, err := os.Open(cfg.ReplayFile)
+	if err != nil {
+		log.Fatalf("Failed to open recording: %v", err)
+	}
+	entries, err := replay.Read(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Failed to read recording %s: %v", cfg.ReplayFile, err)
+	}
+	if len(entries) == 0 {
+		log.Fatalf("Recording %s is empty", cfg.ReplayFile)
+	}
+
+	span := entries[len(entries)-1].Time.Sub(entries[0].Time)
+	log.Printf("⏯️  Replaying %d requests recorded over %s against %s (speed %g)",
+		len(entries), span.Round(time.Millisecond), cfg.TargetURL, cfg.Speed)
+
+	var (
+		mu       sync.Mutex
+		statuses = make(map[[2]int]int)
+		failures int
+	)
+	start := time.Now()
+	client := &http.Client{Timeout: cfg.Timeout}
+	replay.Play(ctx, client, cfg.TargetURL, entries, cfg.Speed, cfg.MaxInFlight, func(r replay.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Err != nil {
+			failures++
+			log.Printf("❌ %s %s: %v", r.Entry.Method, r.Entry.Path, r.Err)
+			return
+		}
+		statuses[[2]int{r.Entry.Status, r.Status}]++
+	})
+
+	// Summary of recorded vs replayed status codes
+	keys := make([][2]int, 0, len(statuses))
+	sent, changed := failures, 0
+	for k, n := range statuses {
+		keys = append(keys, k)
+		sent += n
+		if k[0] != k[1] {
+			changed += n
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	log.Printf("✅ Replayed %d/%d requests in %s", sent, len(entries), time.Since(start).Round(time.Millisecond))
+	for _, k := range keys {
+		log.Printf("   recorded %d → replayed %d: %d", k[0], k[1], statuses[k])
+	}
+	log.Printf("   %d with a different status, %d transport errors", changed, failures)
+}
@@ -0,0 +1,103 @@
+// Command stackgen writes a Docker Compose (or Podman) stack that runs the
+// selected services wired to an OpenTelemetry Collector, a trace backend (Tempo
+// or Jaeger), a metrics backend (Prometheus or Mimir), Loki and Grafana with
+// provisioned datasources.
+//
+//	go run ./cmd/stackgen --out ../stack --services core,database,payment-gateway --traces jaeger
+//	docker compose -f ../stack/docker-compose.yaml up --build
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"incident-simulation/pkg/config"
+)
+
+// Config is the stack generator configuration
+type Config struct {
+	OutDir    string `env:"STACKGEN_OUT" flag:"out" default:"stack" usage:"Directory the stack files are written to"`
+	Services  string `env:"STACKGEN_SERVICES" flag:"services" default:"core,database,payment-gateway,auth,analyzer,worker,loadgen" usage:"Comma-separated services to run"`
+	Engine    string `env:"STACKGEN_ENGINE" flag:"engine" default:"docker" usage:"Container engine: docker or podman"`
+	Traces    string `env:"STACKGEN_TRACES" flag:"traces" default:"tempo" usage:"Trace backend: tempo or jaeger"`
+	Metrics   string `env:"STACKGEN_METRICS" flag:"metrics" default:"prometheus" usage:"Metrics backend: prometheus or mimir"`
+	SourceDir string `env:"STACKGEN_SOURCE" flag:"source" usage:"Repository root used as build context (default: found from the working directory)"`
+	DevMode   bool   `env:"STACKGEN_DEV_MODE" flag:"dev-mode" usage:"Run the services with DEV_MODE (X-Chaos-* headers)"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Engine != "docker" && c.Engine != "podman" {
+		errs = append(errs, fmt.Errorf("STACKGEN_ENGINE must be docker or podman, got %q", c.Engine))
+	}
+	if c.Traces != "tempo" && c.Traces != "jaeger" {
+		errs = append(errs, fmt.Errorf("STACKGEN_TRACES must be tempo or jaeger, got %q", c.Traces))
+	}
+	if c.Metrics != "prometheus" && c.Metrics != "mimir" {
+		errs = append(errs, fmt.Errorf("STACKGEN_METRICS must be prometheus or mimir, got %q", c.Metrics))
+	}
+	if c.OutDir == "" {
+		errs = append(errs, errors.New("STACKGEN_OUT must not be empty"))
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	source := cfg.SourceDir
+	if source == "" {
+		var err error
+		if source, err = findRepoRoot(); err != nil {
+			log.Fatalf("Cannot locate the repository root, pass --source: %v", err)
+		}
+	}
+
+	s, err := newStack(cfg, strings.Split(cfg.Services, ","), source)
+	if err != nil {
+		log.Fatalf("Invalid stack: %v", err)
+	}
+	files, err := s.render()
+	if err != nil {
+		log.Fatalf("Failed to render stack: %v", err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(cfg.OutDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	compose := filepath.Join(cfg.OutDir, "docker-compose.yaml")
+	log.Printf("✅ Wrote %d files for %s to %s", len(files), strings.Join(s.serviceNames(), ", "), cfg.OutDir)
+	log.Printf("   go run ./cmd/dashgen --out %s", filepath.Join(cfg.OutDir, "dashboards"))
+	log.Printf("   %s compose -f %s up --build", cfg.Engine, compose)
+}
+
+// findRepoRoot walks up from the working directory to the directory holding app/go.mod
+func findRepoRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "app", "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no app/go.mod in any parent directory")
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Collector address every service exports OTLP/HTTP to
+const collectorEndpoint = "otel-collector:4318"
+
+// serviceSpec describes one application service that can be put in the stack
+type serviceSpec struct {
+	// Directory under app/ and compose service name
+	Dir  string
+	Port int
+	// Services that must be in the stack too
+	Requires []string
+	// Environment that points at other services; only set when those are enabled
+	Links map[string]string
+	// Environment set instead when a linked service is left out
+	Unlinked map[string]string
+}
+
+// The services under app/, in start order
+var catalog = []serviceSpec{
+	{Dir: "database", Port: 8081},
+	{Dir: "analyzer", Port: 8084},
+	{
+		Dir:  "payment-gateway",
+		Port: 8082,
+		Links: map[string]string{
+			"analyzer": "DEPLOY_EVENTS_URL=http://analyzer:8084/api/v1/deployments",
+		},
+	},
+	{Dir: "auth", Port: 8083},
+	{
+		Dir:      "worker",
+		Port:     8085,
+		Requires: []string{"database"},
+		Links: map[string]string{
+			"database": "DB_SERVICE_URL=http://database:8081",
+		},
+	},
+	{
+		Dir:      "core",
+		Port:     8080,
+		Requires: []string{"database", "payment-gateway"},
+		Links: map[string]string{
+			"database":        "DB_SERVICE_URL=http://database:8081",
+			"payment-gateway": "PAYMENT_GATEWAY_URL=http://payment-gateway:8082",
+			"auth":            "AUTH_SERVICE_URL=http://auth:8083",
+			"analyzer":        "DEPLOY_EVENTS_URL=http://analyzer:8084/api/v1/deployments",
+		},
+	},
+	{
+		Dir:      "loadgen",
+		Requires: []string{"core"},
+		Links: map[string]string{
+			"core": "CORE_SERVICE_URL=http://core:8080",
+			"auth": "AUTH_SERVICE_URL=http://auth:8083",
+		},
+		Unlinked: map[string]string{
+			"auth": "AUTH_SERVICE_URL=",
+		},
+	},
+}
+
+// service is a service as rendered into the compose file
+type service struct {
+	Name      string
+	Port      int
+	Env       []string
+	DependsOn []string
+}
+
+// stack is everything the templates need
+type stack struct {
+	Engine   string
+	Traces   string
+	Metrics  string
+	Services []service
+
+	// Build context relative to the output directory, and the Dockerfile relative to the context
+	Context    string
+	Dockerfile string
+}
+
+func newStack(cfg Config, names []string, source string) (*stack, error) {
+	enabled := make(map[string]bool)
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			enabled[n] = true
+		}
+	}
+	if len(enabled) == 0 {
+		return nil, fmt.Errorf("no services selected")
+	}
+
+	known := make(map[string]bool, len(catalog))
+	for _, spec := range catalog {
+		known[spec.Dir] = true
+	}
+	var unknown []string
+	for n := range enabled {
+		if !known[n] {
+			unknown = append(unknown, n)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown services %s", strings.Join(unknown, ", "))
+	}
+
+	// Paths are written relative to the output directory so the stack can be moved with the repo
+	outAbs, err := filepath.Abs(cfg.OutDir)
+	if err != nil {
+		return nil, err
+	}
+	sourceAbs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	context, err := filepath.Rel(outAbs, sourceAbs)
+	if err != nil {
+		return nil, fmt.Errorf("build context: %w", err)
+	}
+	dockerfile, err := filepath.Rel(sourceAbs, filepath.Join(outAbs, "Dockerfile.service"))
+	if err != nil {
+		return nil, fmt.Errorf("dockerfile path: %w", err)
+	}
+
+	s := &stack{
+		Engine:     cfg.Engine,
+		Traces:     cfg.Traces,
+		Metrics:    cfg.Metrics,
+		Context:    filepath.ToSlash(context),
+		Dockerfile: filepath.ToSlash(dockerfile),
+	}
+	for _, spec := range catalog {
+		if !enabled[spec.Dir] {
+			continue
+		}
+		for _, req := range spec.Requires {
+			if !enabled[req] {
+				return nil, fmt.Errorf("%s needs %s", spec.Dir, req)
+			}
+		}
+
+		svc := service{
+			Name:      spec.Dir,
+			Port:      spec.Port,
+			Env:       []string{"OTEL_EXPORTER_OTLP_ENDPOINT=" + collectorEndpoint},
+			DependsOn: []string{"otel-collector"},
+		}
+		if cfg.DevMode {
+			svc.Env = append(svc.Env, "DEV_MODE=true")
+		}
+		links := make([]string, 0, len(spec.Links))
+		for dep := range spec.Links {
+			links = append(links, dep)
+		}
+		sort.Strings(links)
+		for _, dep := range links {
+			if enabled[dep] {
+				svc.Env = append(svc.Env, spec.Links[dep])
+				svc.DependsOn = append(svc.DependsOn, dep)
+			} else if env, ok := spec.Unlinked[dep]; ok {
+				svc.Env = append(svc.Env, env)
+			}
+		}
+		s.Services = append(s.Services, svc)
+	}
+	return s, nil
+}
+
+func (s *stack) serviceNames() []string {
+	names := make([]string, len(s.Services))
+	for i, svc := range s.Services {
+		names[i] = svc.Name
+	}
+	return names
+}
+
+// Image qualifies short image names; Podman does not assume docker.io
+func (s *stack) Image(name string) string {
+	if s.Engine != "podman" {
+		return name
+	}
+	first, _, found := strings.Cut(name, "/")
+	switch {
+	case !found:
+		return "docker.io/library/" + name
+	case strings.ContainsAny(first, ".:"):
+		return name
+	default:
+		return "docker.io/" + name
+	}
+}
+
+// RemoteWriteURL is where the collector and Tempo's metrics generator push metrics
+func (s *stack) RemoteWriteURL() string {
+	if s.Metrics == "mimir" {
+		return "http://mimir:9009/api/v1/push"
+	}
+	return "http://prometheus:9090/api/v1/write"
+}
+
+// Mount is a read-only bind mount, relabeled for SELinux under Podman
+func (s *stack) Mount(host, container string) string {
+	if s.Engine == "podman" {
+		return host + ":" + container + ":ro,Z"
+	}
+	return host + ":" + container + ":ro"
+}
+
+// render returns the stack files keyed by path relative to the output directory
+func (s *stack) render() (map[string][]byte, error) {
+	files := map[string]string{
+		"docker-compose.yaml":                   composeTemplate,
+		"Dockerfile.service":                    dockerfileTemplate,
+		"otel-collector.yaml":                   collectorTemplate,
+		"grafana/provisioning/datasources.yaml": datasourcesTemplate,
+		"grafana/provisioning/dashboards.yaml":  dashboardsTemplate,
+	}
+	if s.Traces == "tempo" {
+		files["tempo.yaml"] = tempoTemplate
+	}
+	switch s.Metrics {
+	case "prometheus":
+		files["prometheus.yaml"] = prometheusTemplate
+	case "mimir":
+		files["mimir.yaml"] = mimirTemplate
+	}
+
+	out := make(map[string][]byte, len(files))
+	for name, text := range files {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, s); err != nil {
+			return nil, fmt.Errorf("render %s: %w", name, err)
+		}
+		out[name] = buf.Bytes()
+	}
+	return out, nil
+}
@@ -0,0 +1,327 @@
+package main
+
+const composeTemplate = `# Generated by cmd/stackgen ({{.Engine}}, {{.Traces}}, {{.Metrics}}); regenerate instead of editing
+name: ai-observability
+
+services:
+{{- range .Services}}
+  {{.Name}}:
+    build:
+      context: {{$.Context}}
+      dockerfile: {{$.Dockerfile}}
+      args:
+        SERVICE: {{.Name}}
+        VERSION: ${VERSION:-1.0.0}
+        GIT_SHA: ${GIT_SHA:-unknown}
+        BUILD_TIME: ${BUILD_TIME:-unknown}
+{{- if .Port}}
+    ports:
+      - '{{.Port}}:{{.Port}}'
+{{- end}}
+    environment:
+{{- range .Env}}
+      - {{.}}
+{{- end}}
+    depends_on:
+{{- range .DependsOn}}
+      - {{.}}
+{{- end}}
+    restart: on-failure
+{{end}}
+  otel-collector:
+    image: {{.Image "otel/opentelemetry-collector-contrib:latest"}}
+    command: ['--config=/etc/otelcol/config.yaml']
+    volumes:
+      - {{.Mount "./otel-collector.yaml" "/etc/otelcol/config.yaml"}}
+    ports:
+      - '4317:4317' # OTLP gRPC
+      - '4318:4318' # OTLP HTTP
+    depends_on:
+      - loki
+      - {{.Traces}}
+      - {{.Metrics}}
+{{if eq .Traces "tempo"}}
+  tempo:
+    image: {{.Image "grafana/tempo:latest"}}
+    command: ['-config.file=/etc/tempo.yaml']
+    volumes:
+      - {{.Mount "./tempo.yaml" "/etc/tempo.yaml"}}
+    ports:
+      - '3200:3200'
+    depends_on:
+      - {{.Metrics}}
+{{else}}
+  jaeger:
+    image: {{.Image "jaegertracing/all-in-one:latest"}}
+    environment:
+      - COLLECTOR_OTLP_ENABLED=true
+    ports:
+      - '16686:16686' # Jaeger UI
+{{end}}
+{{- if eq .Metrics "prometheus"}}
+  prometheus:
+    image: {{.Image "prom/prometheus:latest"}}
+    command:
+      - '--config.file=/etc/prometheus/prometheus.yaml'
+      - '--web.enable-remote-write-receiver'
+      - '--enable-feature=exemplar-storage'
+    volumes:
+      - {{.Mount "./prometheus.yaml" "/etc/prometheus/prometheus.yaml"}}
+    ports:
+      - '9090:9090'
+{{else}}
+  mimir:
+    image: {{.Image "grafana/mimir:latest"}}
+    command: ['-config.file=/etc/mimir.yaml']
+    volumes:
+      - {{.Mount "./mimir.yaml" "/etc/mimir.yaml"}}
+    ports:
+      - '9009:9009'
+{{end}}
+  loki:
+    image: {{.Image "grafana/loki:latest"}}
+    command: ['-config.file=/etc/loki/local-config.yaml']
+    ports:
+      - '3100:3100'
+
+  grafana:
+    image: {{.Image "grafana/grafana:latest"}}
+    environment:
+      - GF_AUTH_ANONYMOUS_ENABLED=true
+      - GF_AUTH_ANONYMOUS_ORG_ROLE=Admin
+      - GF_AUTH_DISABLE_LOGIN_FORM=true
+    volumes:
+      - {{.Mount "./grafana/provisioning/datasources.yaml" "/etc/grafana/provisioning/datasources/datasources.yaml"}}
+      - {{.Mount "./grafana/provisioning/dashboards.yaml" "/etc/grafana/provisioning/dashboards/dashboards.yaml"}}
+      - {{.Mount "./dashboards" "/var/lib/grafana/dashboards"}}
+    ports:
+      - '3000:3000'
+    depends_on:
+      - loki
+      - {{.Traces}}
+      - {{.Metrics}}
+`
+
+// Builds one service from app/<SERVICE>, stamping VERSION, GIT_SHA and
+// BUILD_TIME into pkg/buildinfo; the build context is the repository root
+const dockerfileTemplate = `# Generated by cmd/stackgen; the build context is the repository root
+FROM {{.Image "golang:1.25-alpine"}} AS build
+ARG SERVICE
+ARG VERSION=1.0.0
+ARG GIT_SHA=unknown
+ARG BUILD_TIME=unknown
+WORKDIR /src
+COPY app app
+WORKDIR /src/app/${SERVICE}
+RUN CGO_ENABLED=0 go build -ldflags "\
+      -X incident-simulation/pkg/buildinfo.Version=${VERSION} \
+      -X incident-simulation/pkg/buildinfo.Commit=${GIT_SHA} \
+      -X incident-simulation/pkg/buildinfo.BuildTime=${BUILD_TIME}" \
+    -o /out/service .
+
+FROM {{.Image "alpine:latest"}}
+RUN apk --no-cache add ca-certificates
+COPY --from=build /out/service /usr/local/bin/service
+ENTRYPOINT ["/usr/local/bin/service"]
+`
+
+const collectorTemplate = `# Generated by cmd/stackgen
+receivers:
+  otlp:
+    protocols:
+      grpc:
+        endpoint: 0.0.0.0:4317
+      http:
+        endpoint: 0.0.0.0:4318
+
+processors:
+  batch: {}
+
+exporters:
+  otlp/traces:
+    endpoint: {{.Traces}}:4317
+    tls:
+      insecure: true
+  prometheusremotewrite:
+    endpoint: {{.RemoteWriteURL}}
+    tls:
+      insecure: true
+  otlphttp/loki:
+    endpoint: http://loki:3100/otlp
+
+service:
+  pipelines:
+    traces:
+      receivers: [otlp]
+      processors: [batch]
+      exporters: [otlp/traces]
+    metrics:
+      receivers: [otlp]
+      processors: [batch]
+      exporters: [prometheusremotewrite]
+    logs:
+      receivers: [otlp]
+      processors: [batch]
+      exporters: [otlphttp/loki]
+`
+
+// Tempo also derives span metrics and the service graph into the metrics backend
+const tempoTemplate = `# Generated by cmd/stackgen
+server:
+  http_listen_port: 3200
+
+distributor:
+  receivers:
+    otlp:
+      protocols:
+        grpc:
+          endpoint: 0.0.0.0:4317
+        http:
+          endpoint: 0.0.0.0:4318
+
+storage:
+  trace:
+    backend: local
+    wal:
+      path: /tmp/tempo/wal
+    local:
+      path: /tmp/tempo/blocks
+
+metrics_generator:
+  registry:
+    external_labels:
+      source: tempo
+  storage:
+    path: /tmp/tempo/generator/wal
+    remote_write:
+      - url: {{.RemoteWriteURL}}
+        send_exemplars: true
+
+overrides:
+  defaults:
+    metrics_generator:
+      processors: [service-graphs, span-metrics]
+`
+
+// Prometheus only receives remote writes from the collector and Tempo
+const prometheusTemplate = `# Generated by cmd/stackgen
+global:
+  scrape_interval: 15s
+
+scrape_configs:
+  - job_name: prometheus
+    static_configs:
+      - targets: ['localhost:9090']
+`
+
+// Single-process Mimir with filesystem storage, fine for a local stack
+const mimirTemplate = `# Generated by cmd/stackgen
+multitenancy_enabled: false
+
+server:
+  http_listen_port: 9009
+  log_level: warn
+
+blocks_storage:
+  backend: filesystem
+  filesystem:
+    dir: /tmp/mimir/blocks
+  bucket_store:
+    sync_dir: /tmp/mimir/tsdb-sync
+  tsdb:
+    dir: /tmp/mimir/tsdb
+
+compactor:
+  data_dir: /tmp/mimir/compactor
+  sharding_ring:
+    kvstore:
+      store: memberlist
+
+distributor:
+  ring:
+    instance_addr: 127.0.0.1
+    kvstore:
+      store: memberlist
+
+ingester:
+  ring:
+    instance_addr: 127.0.0.1
+    kvstore:
+      store: memberlist
+    replication_factor: 1
+
+ruler_storage:
+  backend: filesystem
+  filesystem:
+    dir: /tmp/mimir/rules
+
+store_gateway:
+  sharding_ring:
+    replication_factor: 1
+`
+
+// Datasources link logs to traces by trace_id and traces back to logs and metrics
+const datasourcesTemplate = `# Generated by cmd/stackgen
+apiVersion: 1
+
+datasources:
+  - name: {{if eq .Metrics "mimir"}}Mimir{{else}}Prometheus{{end}}
+    uid: metrics
+    type: prometheus
+    access: proxy
+    url: {{if eq .Metrics "mimir"}}http://mimir:9009/prometheus{{else}}http://prometheus:9090{{end}}
+    isDefault: true
+    jsonData:
+      exemplarTraceIdDestinations:
+        - name: trace_id
+          datasourceUid: traces
+
+  - name: Loki
+    uid: logs
+    type: loki
+    access: proxy
+    url: http://loki:3100
+    jsonData:
+      derivedFields:
+        - name: trace_id
+          matcherType: label
+          matcherRegex: trace_id
+          datasourceUid: traces
+          url: '$${__value.raw}'
+{{if eq .Traces "tempo"}}
+  - name: Tempo
+    uid: traces
+    type: tempo
+    access: proxy
+    url: http://tempo:3200
+    jsonData:
+      tracesToLogsV2:
+        datasourceUid: logs
+        filterByTraceID: true
+      serviceMap:
+        datasourceUid: metrics
+      nodeGraph:
+        enabled: true
+{{else}}
+  - name: Jaeger
+    uid: traces
+    type: jaeger
+    access: proxy
+    url: http://jaeger:16686
+    jsonData:
+      tracesToLogsV2:
+        datasourceUid: logs
+        filterByTraceID: true
+{{end}}`
+
+// Loads the JSON written by cmd/dashgen into <out>/dashboards
+const dashboardsTemplate = `# Generated by cmd/stackgen
+apiVersion: 1
+
+providers:
+  - name: generated
+    folder: AI Observability
+    type: file
+    options:
+      path: /var/lib/grafana/dashboards
+`
@@ -0,0 +1,84 @@
+// Command tracetest sends known requests through the running stack and checks
+// the traces they produce against a YAML file of expectations, fetching each
+// trace by ID from Tempo or Jaeger. It exits non-zero when an expectation
+// fails, so it doubles as a local smoke test after a change.
+//
+//	go run ./cmd/tracetest --file cmd/tracetest/transaction.example.yaml
+//	go run ./cmd/tracetest --file tests.yaml --backend jaeger --backend-url http://localhost:16686
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/tracetest"
+)
+
+// Config is the trace test tool configuration
+type Config struct {
+	TestsFile  string        `env:"TRACETEST_FILE" flag:"file" required:"true" usage:"YAML file with the requests to send and the spans their traces must have"`
+	TargetURL  string        `env:"TARGET_URL" flag:"target" default:"http://127.0.0.1:8080" usage:"Base URL the requests are sent to"`
+	Backend    string        `env:"TRACETEST_BACKEND" flag:"backend" default:"tempo" usage:"Trace backend the traces are fetched from: tempo or jaeger"`
+	BackendURL string        `env:"TRACETEST_BACKEND_URL" flag:"backend-url" default:"http://localhost:3200" usage:"Base URL of the trace backend's HTTP API"`
+	Timeout    time.Duration `env:"TRACETEST_TIMEOUT" flag:"timeout" default:"30s" usage:"Timeout of each request and trace fetch"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Backend != "tempo" && c.Backend != "jaeger" {
+		errs = append(errs, errors.New("TRACETEST_BACKEND must be tempo or jaeger"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("TRACETEST_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	tests, err := tracetest.Load(cfg.TestsFile)
+	if err != nil {
+		log.Fatalf("Failed to load trace tests: %v", err)
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	fetcher, err := tracetest.NewFetcher(cfg.Backend, cfg.BackendURL, client)
+	if err != nil {
+		log.Fatalf("Invalid trace backend: %v", err)
+	}
+
+	log.Printf("🔬 Running %d trace test(s) against %s, traces from %s at %s", len(tests), cfg.TargetURL, cfg.Backend, cfg.BackendURL)
+	failed := 0
+	for _, t := range tests {
+		res, err := tracetest.Run(ctx, client, fetcher, cfg.TargetURL, t)
+		switch {
+		case err != nil:
+			failed++
+			log.Printf("❌ %s: %v", t.Name, err)
+		case !res.Passed():
+			failed++
+			log.Printf("❌ %s (trace %s, status %d, %d spans):", t.Name, res.TraceID, res.Status, res.Spans)
+			for _, f := range res.Failures {
+				log.Printf("   %s", f)
+			}
+		default:
+			log.Printf("✅ %s (trace %s, %d spans, %s)", t.Name, res.TraceID, res.Spans, res.Duration.Round(time.Millisecond))
+		}
+	}
+	if failed > 0 {
+		log.Printf("%d of %d trace tests failed", failed, len(tests))
+		os.Exit(1)
+	}
+	log.Printf("All %d trace tests passed", len(tests))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/jwt"
+	"incident-simulation/pkg/logx"
+)
+
+// Auth error classes reported as error_type in metrics and auth.error_class on spans
+const (
+	authUnauthenticated = "auth_unauthenticated" // 401: missing or invalid token
+	authExpired         = "auth_expired"         // 401: token past its exp
+	authForbidden       = "auth_forbidden"       // 403: valid token, not allowed
+)
+
+// authFailure is a rejected request with its HTTP status, class and reason
+type authFailure struct {
+	status int
+	class  string
+	reason string
+	err    error
+}
+
+// requiredScope returns the scope a route needs
+func requiredScope(r *http.Request) string {
+	if r.Method == http.MethodPost && (r.URL.Path == "/api/transaction" || r.URL.Path == "/api/transactions/batch") {
+		return "transactions:write"
+	}
+	return "balance:read"
+}
+
+type claimsKey struct{}
+
+// claimsFromContext returns the verified token claims of the request, nil
+// for an anonymous one
+func claimsFromContext(ctx context.Context) *jwt.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*jwt.Claims)
+	return claims
+}
+
+// checkSubject rejects a request body acting for userID with a token issued
+// to another user; the middleware only sees the {id} of balance paths
+func checkSubject(ctx context.Context, userID string) *authFailure {
+	claims := claimsFromContext(ctx)
+	if claims == nil || userID == claims.Subject {
+		return nil
+	}
+	return &authFailure{http.StatusForbidden, authForbidden, "subject_mismatch", fmt.Errorf("token for %s cannot act for %s", claims.Subject, userID)}
+}
+
+// authenticate verifies the bearer token of r; a nil failure means the request may proceed
+func authenticate(r *http.Request, verifier *jwt.Verifier, required bool) (*jwt.Claims, *authFailure) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		if required {
+			return nil, &authFailure{http.StatusUnauthorized, authUnauthenticated, "missing_token", errors.New("no bearer token")}
+		}
+		return nil, nil
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, &authFailure{http.StatusUnauthorized, authUnauthenticated, "malformed_token", errors.New("authorization header is not a bearer token")}
+	}
+
+	claims, err := verifier.Verify(strings.TrimSpace(token))
+	switch {
+	case err == nil:
+	case errors.Is(err, jwt.ErrExpired):
+		return nil, &authFailure{http.StatusUnauthorized, authExpired, "token_expired", err}
+	case errors.Is(err, jwt.ErrNotYetValid):
+		return nil, &authFailure{http.StatusUnauthorized, authUnauthenticated, "token_not_yet_valid", err}
+	case errors.Is(err, jwt.ErrUnknownKey):
+		return nil, &authFailure{http.StatusUnauthorized, authUnauthenticated, "unknown_key", err}
+	case errors.Is(err, jwt.ErrSignature):
+		return nil, &authFailure{http.StatusUnauthorized, authUnauthenticated, "invalid_signature", err}
+	case errors.Is(err, jwt.ErrIssuer), errors.Is(err, jwt.ErrAudience), errors.Is(err, jwt.ErrNoExpiry):
+		return nil, &authFailure{http.StatusUnauthorized, authUnauthenticated, "invalid_claims", err}
+	default:
+		return nil, &authFailure{http.StatusUnauthorized, authUnauthenticated, "malformed_token", err}
+	}
+
+	if scope := requiredScope(r); !claims.HasScope(scope) {
+		return &claims, &authFailure{http.StatusForbidden, authForbidden, "insufficient_scope", fmt.Errorf("token lacks scope %s", scope)}
+	}
+	if id := userPathID(r.URL.Path); id != "" && id != claims.Subject {
+		return &claims, &authFailure{http.StatusForbidden, authForbidden, "subject_mismatch", fmt.Errorf("token for %s cannot access %s", claims.Subject, id)}
+	}
+	return &claims, nil
+}
+
+// userPathID extracts {id} from /api/user/{id}/balance; the middleware runs before
+// the mux so r.PathValue is not populated yet
+func userPathID(path string) string {
+	rest, ok := strings.CutPrefix(path, "/api/user/")
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	return id
+}
+
+// maxUserPeekBytes bounds how much of a transaction body requestUserID reads
+const maxUserPeekBytes = 64 << 10
+
+// requestUserID returns the user a request is for, for DEBUG_TRACE_USERS: the
+// {id} of a balance read or the user_id of a transaction, whose body is read
+// and put back for the handler
+func requestUserID(r *http.Request) string {
+	if id := userPathID(r.URL.Path); id != "" {
+		return id
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/api/transaction" || r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxUserPeekBytes))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	var req TransactionRequest
+	if jsonx.Unmarshal(body, &req) != nil {
+		return ""
+	}
+	return req.UserID
+}
+
+// authMiddleware verifies bearer tokens on every /api/ route except health checks.
+// Without AUTH_REQUIRED, requests without a token pass but presented tokens are always verified.
+func authMiddleware(next http.Handler, verifier *jwt.Verifier, required bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		span := oteltrace.SpanFromContext(ctx)
+
+		claims, failure := authenticate(r, verifier, required)
+		if claims != nil {
+			span.SetAttributes(
+				semconv.EnduserID(claims.Subject),
+				attrs.UserScope(claims.Scope),
+			)
+		}
+		if failure != nil {
+			rejectUnauthorized(ctx, w, failure)
+			return
+		}
+
+		if claims != nil {
+			span.SetAttributes(attribute.String("auth.result", "ok"))
+			r = r.WithContext(context.WithValue(ctx, claimsKey{}, claims))
+		} else {
+			span.SetAttributes(attribute.String("auth.result", "anonymous"))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectUnauthorized writes a 401/403 response and records the failure under its own error class
+func rejectUnauthorized(ctx context.Context, w http.ResponseWriter, f *authFailure) {
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("auth.result", "failure"),
+		attribute.String("auth.error_class", f.class),
+		attribute.String("auth.failure_reason", f.reason),
+	)
+	span.AddEvent("auth_failed", oteltrace.WithAttributes(attribute.String("auth.failure_reason", f.reason)))
+	span.SetStatus(codes.Error, f.class)
+
+	authFailureCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("error_class", f.class),
+		attribute.String("reason", f.reason),
+	))
+	errorCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("error_type", f.class),
+	))
+
+	logx.Warnw(ctx, "🔒 Request rejected", "http.status_code", f.status, "auth.error_class", f.class, "auth.failure_reason", f.reason, "error", f.err)
+
+	challenge := `Bearer error="invalid_token"`
+	if f.status == http.StatusForbidden {
+		challenge = `Bearer error="insufficient_scope"`
+	}
+	ref := httpx.NewErrorRef(ctx, w)
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`%s, error_description=%q`, challenge, f.reason))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.status)
+	jsonx.NewEncoder(w).Encode(map[string]string{
+		"status":   "error",
+		"error":    f.reason,
+		"class":    f.class,
+		"trace_id": ref.TraceID,
+		"error_id": ref.ErrorID,
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/jwt"
+)
+
+// authServer publishes key as the auth service's JWKS and answers every other
+// request as a successful database and payment gateway
+func authServer(t *testing.T, key jwt.Key) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/.well-known/jwks.json" {
+			json.NewEncoder(w).Encode(jwt.KeySet{Keys: []jwt.JWK{key.JWK()}})
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"result":"success"},"payment_id":"pay_1","status":"authorized"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestTransactionSubject(t *testing.T) {
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := authServer(t, key)
+	handler, collector, flush := newTestService(t, "-db-service-url="+srv, "-payment-gateway-url="+srv, "-auth-service-url="+srv, "-auth-required")
+
+	token, err := jwt.Sign(jwt.Claims{
+		Issuer:    "auth-service",
+		Subject:   "user_1",
+		Audience:  "core-api",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Scope:     "transactions:write balance:read",
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		method, path string
+		body         string
+		token        string
+		wantStatus   int
+		wantReason   string
+	}{
+		{"own transaction", http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`, token, http.StatusOK, ""},
+		{"transaction for another user", http.MethodPost, "/api/transaction", `{"user_id":"user_2","amount":5,"operation":"balance_check"}`, token, http.StatusForbidden, "subject_mismatch"},
+		{"transaction without user", http.MethodPost, "/api/transaction", `{"amount":5,"operation":"balance_check"}`, token, http.StatusForbidden, "subject_mismatch"},
+		{"random transaction acts for the subject", http.MethodGet, "/api/transaction", "", token, http.StatusOK, ""},
+		{"batch with another user", http.MethodPost, "/api/transactions/batch", `{"transactions":[{"user_id":"user_1","amount":5,"operation":"balance_check"},{"user_id":"user_2","amount":5,"operation":"balance_check"}]}`, token, http.StatusForbidden, "subject_mismatch"},
+		{"balance of another user", http.MethodGet, "/api/user/user_2/balance", "", token, http.StatusForbidden, "subject_mismatch"},
+		{"no token", http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`, "", http.StatusUnauthorized, "missing_token"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if tc.wantReason != "" {
+				var body struct {
+					Error string `json:"error"`
+				}
+				json.Unmarshal(rec.Body.Bytes(), &body)
+				if body.Error != tc.wantReason {
+					t.Errorf("error = %q, want %q", body.Error, tc.wantReason)
+				}
+			}
+		})
+	}
+	flush()
+
+	assertCount(t, collector, "api_auth_failures_total", map[string]string{"error_class": authForbidden, "reason": "subject_mismatch"}, 4)
+}
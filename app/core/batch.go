@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/costing"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/simrand"
+)
+
+type BatchRequest struct {
+	Transactions []TransactionRequest `json:"transactions"`
+}
+
+type BatchItemResult struct {
+	Index         int          `json:"index"`
+	TransactionID string       `json:"transaction_id,omitempty"`
+	Status        string       `json:"status"`
+	Data          interface{}  `json:"data,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	Fields        []FieldError `json:"fields,omitempty"`
+}
+
+type BatchResponse struct {
+	BatchID   string            `json:"batch_id"`
+	Status    string            `json:"status"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Timestamp int64             `json:"timestamp"`
+	httpx.ErrorRef
+}
+
+// batchHandler serves POST /api/transactions/batch. Items go to the database
+// service at most concurrency at a time, each in its own span under the batch
+// span and linked to it, so a batch renders as a fan-out trace. Items are
+// validated like single transactions but, unlike /api/transaction, skip
+// payment authorization.
+func batchHandler(client *http.Client, db *dbRoutes, maxItems, concurrency int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer("core-api-service").Start(r.Context(), "Process Transaction Batch")
+		defer span.End()
+
+		start := time.Now()
+		defer func() {
+			responseTime.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+				attribute.String("service", "core-api"),
+				attribute.String("operation", "transaction_batch"),
+				attribute.String("method", r.Method),
+			))
+		}()
+
+		batchID := fmt.Sprintf("batch_%d_%d", time.Now().Unix(), simrand.Intn(10000))
+		span.SetAttributes(attrs.BatchID(batchID))
+
+		var req BatchRequest
+		if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil {
+			rejectBatch(ctx, w, batchID, "invalid request body")
+			return
+		}
+		if len(req.Transactions) == 0 || len(req.Transactions) > maxItems {
+			rejectBatch(ctx, w, batchID, fmt.Sprintf("a batch holds 1 to %d transactions", maxItems))
+			return
+		}
+		span.SetAttributes(attrs.BatchSize(len(req.Transactions)))
+		for _, item := range req.Transactions {
+			if failure := checkSubject(ctx, item.UserID); failure != nil {
+				rejectUnauthorized(ctx, w, failure)
+				return
+			}
+		}
+		costing.SetOperation(ctx, "transaction_batch", float64(len(req.Transactions)))
+		batchSize.Record(ctx, int64(len(req.Transactions)))
+
+		logx.Infow(ctx, "📦 Processing transaction batch", "batch.id", batchID, "batch.size", len(req.Transactions))
+
+		results := make([]BatchItemResult, len(req.Transactions))
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, item := range req.Transactions {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = processBatchItem(ctx, client, db, batchID, i, item)
+			}()
+		}
+		wg.Wait()
+
+		resp := BatchResponse{BatchID: batchID, Results: results, Timestamp: time.Now().Unix()}
+		for _, res := range results {
+			if res.Status == "success" {
+				resp.Succeeded++
+			} else {
+				resp.Failed++
+			}
+		}
+		switch {
+		case resp.Failed == 0:
+			resp.Status = "success"
+		case resp.Succeeded == 0:
+			resp.Status = "failed"
+			span.SetStatus(codes.Error, "every batch item failed")
+		default:
+			resp.Status = "partial"
+		}
+		span.SetAttributes(
+			attribute.Int("batch.succeeded", resp.Succeeded),
+			attribute.Int("batch.failed", resp.Failed),
+		)
+
+		logx.Infow(ctx, "📦 Transaction batch done", "batch.id", batchID, "batch.status", resp.Status, "batch.succeeded", resp.Succeeded, "batch.failed", resp.Failed)
+		w.Header().Set("Content-Type", "application/json")
+		jsonx.NewEncoder(w).Encode(resp)
+	}
+}
+
+// processBatchItem validates and stores one transaction of a batch
+func processBatchItem(ctx context.Context, client *http.Client, db *dbRoutes, batchID string, index int, req TransactionRequest) BatchItemResult {
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Process Batch Item",
+		trace.WithLinks(trace.LinkFromContext(ctx, attrs.BatchID(batchID))))
+	defer span.End()
+
+	transactionID := fmt.Sprintf("txn_%d_%d", time.Now().Unix(), simrand.Intn(10000))
+	span.SetAttributes(
+		attrs.BatchID(batchID),
+		attrs.BatchIndex(index),
+		attrs.TransactionID(transactionID),
+		semconv.UserID(req.UserID),
+		attrs.TransactionAmount(req.Amount),
+		attrs.TransactionOperation(req.Operation),
+	)
+	result := BatchItemResult{Index: index, TransactionID: transactionID}
+
+	if fieldErrs := validateTransaction(req); len(fieldErrs) > 0 {
+		span.SetStatus(codes.Error, "validation failed")
+		errorCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("error_type", "validation_error"),
+		))
+		recordValidationErrors(ctx, fieldErrs)
+		result.Status, result.Error, result.Fields = "error", "request validation failed", fieldErrs
+		return result
+	}
+
+	dbStart := time.Now()
+	dbResp, err := storeTransaction(ctx, client, db, transactionID, req)
+	dbCallDuration.Record(ctx, time.Since(dbStart).Seconds(), metric.WithAttributes(
+		attribute.String("db_operation", req.Operation),
+	))
+	if err != nil {
+		errorType := "database_error"
+		if transferType, ok := transferErrorType(err); ok {
+			errorType = transferType
+			span.SetStatus(codes.Error, "transfer failed")
+		} else if reason := httpx.CancelReason(err); reason != "" {
+			errorType = reason
+			httpx.RecordCancel(span, reason)
+		} else {
+			span.SetStatus(codes.Error, "database service call failed")
+		}
+		transactionCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("status", "failed"),
+			attribute.String("error_type", errorType),
+		))
+		errorCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("error_type", errorType),
+		))
+		logx.Errorw(ctx, "❌ Batch item failed: database error", "batch.id", batchID, "batch.index", index, "transaction.id", transactionID, "error", err)
+		result.Status, result.Error = "failed", fmt.Sprintf("database service error: %v", err)
+		return result
+	}
+
+	transactionCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("status", "success"),
+		attribute.String("operation", req.Operation),
+	))
+	result.Status, result.Data = "success", dbResp
+	return result
+}
+
+func rejectBatch(ctx context.Context, w http.ResponseWriter, batchID, msg string) {
+	trace.SpanFromContext(ctx).SetStatus(codes.Error, msg)
+	errorCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("error_type", "invalid_request"),
+	))
+	resp := BatchResponse{
+		BatchID:   batchID,
+		Status:    "error",
+		Error:     msg,
+		Timestamp: time.Now().Unix(),
+		ErrorRef:  httpx.NewErrorRef(ctx, w),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	jsonx.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/deploy"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/telemetry"
+)
+
+// withBenchProviders installs SDK tracer and meter providers that record but
+// never export, and silences the log, for the benchmark
+func withBenchProviders(b *testing.B) {
+	tp := trace.NewTracerProvider()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewManualReader()))
+	prevTP, prevMP := otel.GetTracerProvider(), otel.GetMeterProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	logrus.SetOutput(io.Discard)
+	b.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetMeterProvider(prevMP)
+		logrus.SetOutput(os.Stderr)
+		tp.Shutdown(context.Background())
+		mp.Shutdown(context.Background())
+	})
+}
+
+// BenchmarkTransactionHandler runs deposits through the whole request path
+// against in-process payment and database servers: the middleware, JSON
+// decoding, validation, span attributes, metric recording, both downstream
+// calls and the encoded response. Spans and metrics are recorded by the SDK
+// but not exported, so the numbers are the request path's own.
+//
+// Baseline is about 230µs, 67KB and 636 allocs per request. Nearly all of it
+// is the two downstream HTTP round trips (client, server and otelhttp on both
+// ends) and span recording, which pooling cannot remove; the stages this
+// service owns are benchmarked on their own below. The target is to keep
+// those at zero allocations for metric attributes and recording and at the
+// decoded fields alone for the request body, so the handler total only moves
+// with the downstream calls.
+func BenchmarkTransactionHandler(b *testing.B) {
+	withBenchProviders(b)
+
+	db := fakeServer(b, http.StatusOK, `{"status":"success","data":{"user_id":"user_1","result":"success","affected_rows":1}}`)
+	payments := fakeServer(b, http.StatusOK, `{"payment_id":"pay_1","status":"authorized","network":"visa"}`)
+	var cfg Config
+	if err := config.Load(&cfg, []string{
+		"-db-service-url=" + db, "-payment-gateway-url=" + payments, "-auth-service-url=" + db,
+		"-rate-limit-ip-rps=0", "-rate-limit-user-rps=0",
+	}); err != nil {
+		b.Fatal(err)
+	}
+	recorder := telemetry.NewRecorder("core-api-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	heatmap := telemetry.NewHeatmap("core-api-service", cfg.LatencyHeatmapMinutes)
+	deploys := deploy.New("core-api-service", cfg.Deploy, http.DefaultClient, logDeployment)
+	initMetrics(context.Background())
+	handler := newCoreHandler(cfg, recorder, health, heatmap, deploys)
+	body := strings.NewReader(`{"user_id":"user_1","amount":25,"operation":"deposit"}`)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		body.Seek(0, io.SeekStart)
+		req := httptest.NewRequest(http.MethodPost, "/api/transaction", body)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+var benchBody = []byte(`{"user_id":"user_1","amount":25,"operation":"deposit"}`)
+
+// BenchmarkDecodeTransaction decodes a request body through the pooled buffer
+// the handler uses, and through a decoder per request as before
+func BenchmarkDecodeTransaction(b *testing.B) {
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var req TransactionRequest
+			if err := httpx.DecodeJSON(bytes.NewReader(benchBody), &req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var req TransactionRequest
+			if err := jsonx.NewDecoder(bytes.NewReader(benchBody)).Decode(&req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkTransactionAttributes builds the metric attributes of a successful
+// transaction from the pre-built sets, and per request as before
+func BenchmarkTransactionAttributes(b *testing.B) {
+	var sink []metric.AddOption
+	b.Run("prebuilt", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			sink = transactionSuccessAttrs.Get("deposit").Add
+		}
+	})
+	b.Run("per request", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			sink = []metric.AddOption{metric.WithAttributes(attribute.String("status", "success"), attribute.String("operation", "deposit"))}
+		}
+	})
+	_ = sink
+}
+
+// BenchmarkRecordMetrics records the response time and transaction count of a
+// request into the SDK with the pre-built sets, and with attributes built per
+// request as before
+func BenchmarkRecordMetrics(b *testing.B) {
+	withBenchProviders(b)
+	initMetrics(context.Background())
+	ctx := context.Background()
+
+	b.Run("prebuilt", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			responseTime.Record(ctx, 0.01, responseTimeAttrs.Get(http.MethodPost).Record...)
+			transactionCounter.Add(ctx, 1, transactionSuccessAttrs.Get("deposit").Add...)
+		}
+	})
+	b.Run("per request", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			responseTime.Record(ctx, 0.01, metric.WithAttributes(
+				attribute.String("service", "core-api"),
+				attribute.String("operation", "transaction"),
+				attribute.String("method", http.MethodPost),
+			))
+			transactionCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("status", "success"), attribute.String("operation", "deposit")))
+		}
+	})
+}
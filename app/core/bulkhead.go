@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/logx"
+)
+
+// Dependencies with a bulkhead, the dependency attribute of its metrics
+const (
+	bulkheadDatabase = "database"
+	bulkheadCache    = "cache"
+	bulkheadPayment  = "payment"
+	bulkheadShadow   = "shadow"
+)
+
+// bulkhead caps the calls in flight to one dependency, so a slow database
+// or payment gateway ties up at most its own share of the handlers instead
+// of all of them. A call waits up to maxWait for a slot and is rejected
+// after that.
+type bulkhead struct {
+	dependency string
+	slots      chan struct{}
+	maxWait    time.Duration
+}
+
+// newBulkhead returns nil, which admits every call, when size is 0
+func newBulkhead(dependency string, size int, maxWait time.Duration) *bulkhead {
+	if size <= 0 {
+		return nil
+	}
+	return &bulkhead{dependency: dependency, slots: make(chan struct{}, size), maxWait: maxWait}
+}
+
+// bulkheadError is a call a full bulkhead turned away
+type bulkheadError struct {
+	dependency string
+}
+
+func (e *bulkheadError) Error() string { return e.dependency + " bulkhead is full" }
+
+// bulkheadRejected tells whether err comes from a full bulkhead
+func bulkheadRejected(err error) bool {
+	var berr *bulkheadError
+	return errors.As(err, &berr)
+}
+
+// acquire takes a slot, returning the func that frees it. A rejection is
+// recorded on the span in ctx: app.bulkhead.dependency, app.bulkhead.rejected
+// and a bulkhead.rejected event.
+func (b *bulkhead) acquire(ctx context.Context) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, nil
+	default:
+	}
+	if b.maxWait > 0 {
+		timer := time.NewTimer(b.maxWait)
+		defer timer.Stop()
+		select {
+		case b.slots <- struct{}{}:
+			return b.release, nil
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attrs.BulkheadDependency(b.dependency), attrs.BulkheadRejected(true))
+	span.AddEvent("bulkhead.rejected", oteltrace.WithAttributes(
+		attribute.Int("bulkhead.in_use", len(b.slots)),
+		attribute.Int("bulkhead.capacity", cap(b.slots)),
+	))
+	span.SetStatus(codes.Error, b.dependency+" bulkhead full")
+	bulkheadRejections.Add(ctx, 1, metric.WithAttributes(attribute.String("dependency", b.dependency)))
+	logx.Warnw(ctx, "🚧 Bulkhead full, call rejected", "bulkhead.dependency", b.dependency, "bulkhead.capacity", cap(b.slots))
+	return nil, &bulkheadError{dependency: b.dependency}
+}
+
+func (b *bulkhead) release() { <-b.slots }
+
+// registerBulkheadGauges reports the slots in use and the share of the
+// capacity they are, per dependency
+func registerBulkheadGauges(ctx context.Context, bulkheads ...*bulkhead) {
+	var active []*bulkhead
+	for _, b := range bulkheads {
+		if b != nil {
+			active = append(active, b)
+		}
+	}
+	if len(active) == 0 {
+		return
+	}
+	meter := otel.Meter("core-api-service")
+	_, err := meter.Int64ObservableGauge("api_bulkhead_in_use",
+		metric.WithDescription("Calls in flight to a dependency as counted by its bulkhead"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			for _, b := range active {
+				o.Observe(int64(len(b.slots)), metric.WithAttributes(attribute.String("dependency", b.dependency)))
+			}
+			return nil
+		}))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create bulkhead in use gauge", "error", err)
+	}
+	_, err = meter.Float64ObservableGauge("api_bulkhead_utilization",
+		metric.WithDescription("Share of a dependency's bulkhead slots in use, 0 to 1; calls are rejected at 1"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			for _, b := range active {
+				o.Observe(float64(len(b.slots))/float64(cap(b.slots)), metric.WithAttributes(attribute.String("dependency", b.dependency)))
+			}
+			return nil
+		}))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create bulkhead utilization gauge", "error", err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/simrand"
+)
+
+// Results of a cached balance read, in api_balance_cache_requests_total and
+// app.cache.result
+const (
+	cacheHit       = "hit"
+	cacheStale     = "stale"
+	cacheMiss      = "miss"
+	cacheCoalesced = "coalesced"
+	cacheDisabled  = "disabled"
+)
+
+// readOperations leave balances as they are; every other successful
+// database call drops the user's cached balance
+var readOperations = map[string]bool{
+	"get_balance":   true,
+	"balance_check": true,
+}
+
+// maxCachedBalances bounds the users cached, as maxFallbackBalances does
+const maxCachedBalances = 10000
+
+// cacheLoadTimeout bounds a database load shared by several readers, which
+// outlives the request that started it
+const cacheLoadTimeout = 10 * time.Second
+
+// Length of a simulated cache_disabled incident
+const (
+	cacheOutageMin = 30 * time.Second
+	cacheOutageMax = 90 * time.Second
+)
+
+// cacheOutage is set while a simulated cache_disabled incident sends every
+// balance read to the database
+var cacheOutage atomic.Bool
+
+// cachedBalance is a balance read, or the mark a write left, and when the
+// read that produced it started
+type cachedBalance struct {
+	value interface{} // nil for a write's mark
+	at    time.Time
+}
+
+// balanceCache answers get_balance from memory for ttl after a database
+// read, and with the old value for a further stale window while one request
+// refreshes it in the background. Concurrent misses for the same user share
+// one database call, so an expiring popular entry does not stampede the
+// database. Writes through callDatabaseService drop the user's entry.
+type balanceCache struct {
+	ttl   time.Duration
+	stale time.Duration
+	loads singleflight.Group
+	fills *bulkhead // caps the loads in flight
+
+	mu      sync.Mutex
+	entries map[string]cachedBalance
+}
+
+// newBalanceCache returns nil, which never caches, when ttl is 0
+func newBalanceCache(ttl, stale time.Duration, fills *bulkhead) *balanceCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &balanceCache{ttl: ttl, stale: stale, fills: fills, entries: make(map[string]cachedBalance)}
+}
+
+// get returns the balance of userID, from the cache or from load. The result
+// goes on the span in ctx and into api_balance_cache_requests_total.
+func (c *balanceCache) get(ctx context.Context, userID string, load func(context.Context) (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return load(ctx)
+	}
+	if cacheOutage.Load() {
+		c.record(ctx, cacheDisabled)
+		return load(ctx)
+	}
+
+	if e, ok := c.lookup(userID); ok {
+		age := time.Since(e.at)
+		if age < c.ttl {
+			c.record(ctx, cacheHit)
+			return e.value, nil
+		}
+		if age < c.ttl+c.stale {
+			c.record(ctx, cacheStale)
+			c.loads.DoChan(userID, c.loader(ctx, userID, load, nil))
+			return e.value, nil
+		}
+	}
+
+	var leader bool
+	results := c.loads.DoChan(userID, c.loader(ctx, userID, load, &leader))
+	select {
+	case r := <-results:
+		result := cacheCoalesced
+		if leader {
+			result = cacheMiss
+		}
+		c.record(ctx, result)
+		return r.Val, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loader returns the shared database load of userID. It runs under a
+// Balance Cache Load span of the request that started it, without that
+// request's cancellation, since other readers may be waiting on it.
+func (c *balanceCache) loader(ctx context.Context, userID string, load func(context.Context) (interface{}, error), leader *bool) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		if leader != nil {
+			*leader = true
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout)
+		defer cancel()
+		ctx, span := otel.Tracer("core-api-service").Start(ctx, "Balance Cache Load")
+		defer span.End()
+
+		release, err := c.fills.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		started := time.Now()
+		value, err := load(ctx)
+		if err == nil {
+			c.put(userID, cachedBalance{value: value, at: started})
+		}
+		return value, err
+	}
+}
+
+// invalidate drops the cached balance of userID. The mark it leaves keeps a
+// read that started before the write from caching the old balance.
+func (c *balanceCache) invalidate(userID string) {
+	if c == nil {
+		return
+	}
+	c.put(userID, cachedBalance{at: time.Now()})
+}
+
+func (c *balanceCache) lookup(userID string) (cachedBalance, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[userID]
+	return e, ok && e.value != nil
+}
+
+// put stores e unless a newer read or write is already there
+func (c *balanceCache) put(userID string, e cachedBalance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[userID]; ok && old.at.After(e.at) {
+		return
+	}
+	if _, known := c.entries[userID]; !known && len(c.entries) >= maxCachedBalances {
+		for id, old := range c.entries {
+			if time.Since(old.at) > c.ttl+c.stale {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= maxCachedBalances {
+			return
+		}
+	}
+	c.entries[userID] = e
+}
+
+// bulkhead returns the bulkhead of the loads, nil for a nil cache
+func (c *balanceCache) bulkhead() *bulkhead {
+	if c == nil {
+		return nil
+	}
+	return c.fills
+}
+
+func (c *balanceCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *balanceCache) record(ctx context.Context, result string) {
+	oteltrace.SpanFromContext(ctx).SetAttributes(attrs.CacheResult(result))
+	cacheRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
+}
+
+// registerCacheGauges reports the cache size and whether it is serving
+func registerCacheGauges(ctx context.Context, c *balanceCache) {
+	if c == nil {
+		return
+	}
+	meter := otel.Meter("core-api-service")
+	_, err := meter.Int64ObservableGauge("api_balance_cache_entries",
+		metric.WithDescription("Users with a cached balance or a write mark in the balance cache"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(c.len()))
+			return nil
+		}))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create balance cache entries gauge", "error", err)
+	}
+	_, err = meter.Int64ObservableGauge("api_balance_cache_enabled",
+		metric.WithDescription("1 while the balance cache answers reads, 0 during a cache_disabled incident"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			var enabled int64
+			if !cacheOutage.Load() {
+				enabled = 1
+			}
+			o.Observe(enabled)
+			return nil
+		}))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create balance cache enabled gauge", "error", err)
+	}
+}
+
+// simulateCacheOutages starts a cache_disabled incident with the given
+// probability every interval, sending all balance reads to the database for
+// 30-90s so the load the cache absorbs shows up in database telemetry
+func simulateCacheOutages(ctx context.Context, probability float64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if cacheOutage.Load() || simrand.Float64() >= probability {
+			continue
+		}
+		length := cacheOutageMin + time.Duration(simrand.Int63n(int64(cacheOutageMax-cacheOutageMin)))
+		cacheOutage.Store(true)
+		audit.Warn(ctx, "incident.started", "🧊 Simulated incident: balance cache disabled", "incident.type", "cache_disabled", "incident.duration_seconds", length.Seconds())
+		time.AfterFunc(length, func() {
+			cacheOutage.Store(false)
+			audit.Record(ctx, "incident.resolved", "🧊 Balance cache restored", "incident.type", "cache_disabled")
+		})
+	}
+}
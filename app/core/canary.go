@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Deploy tracks of the database service versions the core API routes between
+const (
+	trackStable = "stable"
+	trackCanary = "canary"
+)
+
+// dbBackend is one version of the database service
+type dbBackend struct {
+	track string
+	url   string
+
+	success, failure telemetry.Measurement // db_backend_call_duration_seconds attributes
+}
+
+func newDBBackend(track, url string) dbBackend {
+	return dbBackend{
+		track:   track,
+		url:     url,
+		success: telemetry.NewMeasurement(attribute.String("track", track), attribute.String("status", "success")),
+		failure: telemetry.NewMeasurement(attribute.String("track", track), attribute.String("status", "error")),
+	}
+}
+
+// dbRoutes sends DB_CANARY_PERCENT of the database calls to the canary
+// version at DB_CANARY_URL and the rest to DB_SERVICE_URL, so the two
+// versions can be compared on the same traffic. A fail verdict of the
+// analyzer's canary analysis (DB_CANARY_VERDICT_URL) rolls the canary back:
+// it gets no more calls until the service restarts.
+type dbRoutes struct {
+	stable        dbBackend
+	canary        *dbBackend // nil without DB_CANARY_URL
+	canaryPercent float64
+	rolledBack    atomic.Bool
+	hedge         *hedger         // nil unless HEDGE_BALANCE_READS
+	schema        *responseSchema // nil unless DB_RESPONSE_VALIDATION
+	cache         *balanceCache   // nil with BALANCE_CACHE_TTL=0
+	bulkhead      *bulkhead       // nil with BULKHEAD_DB_SIZE=0
+	shadow        *shadowMirror   // nil without DB_SHADOW_URL
+	attempts      int             // DB_CALL_ATTEMPTS
+	backoff       time.Duration   // DB_RETRY_BACKOFF
+	encoding      string          // DB_ENCODING
+	retries       *retryAmplification
+}
+
+// canaryVerdict is the part of the analyzer's verdict the routing acts on
+type canaryVerdict struct {
+	Verdict string   `json:"verdict"`
+	Failed  []string `json:"failed"`
+}
+
+func newDBRoutes(cfg Config) *dbRoutes {
+	r := &dbRoutes{
+		stable:        newDBBackend(trackStable, cfg.DBServiceURL),
+		canaryPercent: cfg.DBCanaryPercent,
+		attempts:      cfg.DBCallAttempts,
+		backoff:       cfg.DBRetryBackoff,
+		encoding:      cfg.DBEncoding,
+		retries:       new(retryAmplification),
+	}
+	if cfg.DBCanaryURL != "" && cfg.DBCanaryPercent > 0 {
+		canary := newDBBackend(trackCanary, cfg.DBCanaryURL)
+		r.canary = &canary
+	}
+	if cfg.HedgeBalanceReads {
+		r.hedge = newHedger(cfg.HedgeDelay)
+	}
+	r.bulkhead = newBulkhead(bulkheadDatabase, cfg.BulkheadDBSize, cfg.BulkheadMaxWait)
+	r.cache = newBalanceCache(cfg.BalanceCacheTTL, cfg.BalanceCacheStale, newBulkhead(bulkheadCache, cfg.BulkheadCacheSize, cfg.BulkheadMaxWait))
+	return r
+}
+
+// pick returns the backend of one database call; its retries stay on it
+func (r *dbRoutes) pick() dbBackend {
+	if r.canary != nil && !r.rolledBack.Load() && simrand.Float64()*100 < r.canaryPercent {
+		return *r.canary
+	}
+	return r.stable
+}
+
+// record adds one call to b to db_backend_call_duration_seconds
+func (b dbBackend) record(ctx context.Context, start time.Time, err error) {
+	m := b.success
+	if err != nil {
+		m = b.failure
+	}
+	dbBackendCallDuration.Record(ctx, time.Since(start).Seconds(), m.Record...)
+}
+
+// watchVerdicts polls the canary verdict every interval until the canary
+// is rolled back
+func (r *dbRoutes) watchVerdicts(client *http.Client, url string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if r.rolledBack.Load() {
+			return
+		}
+		v, err := fetchCanaryVerdict(client, url)
+		if err != nil {
+			logx.Warnw(context.Background(), "Canary verdict not available", "url", url, "error", err)
+			continue
+		}
+		if v.Verdict == "fail" {
+			r.rollback(context.Background(), v)
+		}
+	}
+}
+
+func fetchCanaryVerdict(client *http.Client, url string) (canaryVerdict, error) {
+	var v canaryVerdict
+	resp, err := client.Get(url)
+	if err != nil {
+		return v, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return v, fmt.Errorf("canary verdict returned %d", resp.StatusCode)
+	}
+	err = jsonx.NewDecoder(resp.Body).Decode(&v)
+	return v, err
+}
+
+// rollback takes the canary out of rotation once
+func (r *dbRoutes) rollback(ctx context.Context, v canaryVerdict) {
+	if r.canary == nil || !r.rolledBack.CompareAndSwap(false, true) {
+		return
+	}
+	check := "unknown"
+	if len(v.Failed) > 0 {
+		check = v.Failed[0]
+	}
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Canary Rollback")
+	defer span.End()
+	span.SetAttributes(attrs.DeployTrack(trackCanary), attribute.StringSlice("canary.failed_checks", v.Failed))
+
+	canaryRollbacks.Add(ctx, 1, metric.WithAttributes(attribute.String("check", check)))
+	audit.Warn(ctx, "canary.rollback", "⏪ Database canary rolled back", "db.canary_url", r.canary.url,
+		"canary.failed_checks", strings.Join(v.Failed, ","), "db.canary_percent", r.canaryPercent)
+}
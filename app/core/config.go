@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/dbproto"
+)
+
+// Config is the core API service configuration
+type Config struct {
+	config.Telemetry
+	config.Audit
+	config.Profiling
+	config.Dev
+	config.Simulation
+	config.HTTPClient
+	config.Costing
+	config.Deploy
+
+	ListenAddr           string        `env:"LISTEN_ADDR" flag:"listen" default:":8080" usage:"HTTP listen address"`
+	DBServiceURL         string        `env:"DB_SERVICE_URL" flag:"db-service-url" default:"http://127.0.0.1:8081" usage:"Database service base URL"`
+	DBCanaryURL          string        `env:"DB_CANARY_URL" flag:"db-canary-url" usage:"Base URL of a canary version of the database service (empty routes everything to DB_SERVICE_URL)"`
+	DBCanaryPercent      float64       `env:"DB_CANARY_PERCENT" flag:"db-canary-percent" default:"5" usage:"Share of database calls, in percent, routed to DB_CANARY_URL"`
+	DBCanaryVerdictURL   string        `env:"DB_CANARY_VERDICT_URL" flag:"db-canary-verdict-url" usage:"Canary analysis verdict polled to roll the canary back on a fail, e.g. http://analyzer:8084/api/v1/canary (empty disables)"`
+	DBCanaryVerdictPoll  time.Duration `env:"DB_CANARY_VERDICT_POLL" flag:"db-canary-verdict-poll" default:"30s" usage:"How often DB_CANARY_VERDICT_URL is polled"`
+	DBShadowURL          string        `env:"DB_SHADOW_URL" flag:"db-shadow-url" usage:"Shadow database service that mirrored calls are also sent to, their answers compared and discarded (empty disables)"`
+	DBShadowPercent      float64       `env:"DB_SHADOW_PERCENT" flag:"db-shadow-percent" default:"10" usage:"Share of database calls, in percent, mirrored to DB_SHADOW_URL"`
+	DBShadowMaxInFlight  int           `env:"DB_SHADOW_MAX_IN_FLIGHT" flag:"db-shadow-max-in-flight" default:"20" usage:"Mirrored calls in flight at once; more are dropped (0 is unlimited)"`
+	DBCallAttempts       int           `env:"DB_CALL_ATTEMPTS" flag:"db-call-attempts" default:"2" usage:"Tries of a database call the database turned away before doing any work (1 disables retries)"`
+	DBEncoding           string        `env:"DB_ENCODING" flag:"db-encoding" default:"json" usage:"Encoding of database calls, json or protobuf; the database answers in it when it can"`
+	DBRetryBackoff       time.Duration `env:"DB_RETRY_BACKOFF" flag:"db-retry-backoff" default:"50ms" usage:"Wait before retrying a database call, the same for every caller"`
+	PaymentGatewayURL    string        `env:"PAYMENT_GATEWAY_URL" flag:"payment-gateway-url" default:"http://127.0.0.1:8082" usage:"Payment gateway base URL"`
+	AuthServiceURL       string        `env:"AUTH_SERVICE_URL" flag:"auth-service-url" default:"http://127.0.0.1:8083" usage:"Auth service base URL (JWKS source)"`
+	AuthRequired         bool          `env:"AUTH_REQUIRED" flag:"auth-required" default:"false" usage:"Reject /api/ requests without a bearer token"`
+	TokenIssuer          string        `env:"TOKEN_ISSUER" flag:"token-issuer" default:"auth-service" usage:"Expected iss claim"`
+	TokenAudience        string        `env:"TOKEN_AUDIENCE" flag:"token-audience" default:"core-api" usage:"Expected aud claim"`
+	AuthClockLeeway      time.Duration `env:"AUTH_CLOCK_LEEWAY" flag:"auth-clock-leeway" default:"30s" usage:"Tolerated clock drift on exp and nbf"`
+	RequestTimeout       time.Duration `env:"REQUEST_TIMEOUT" flag:"request-timeout" default:"15s" usage:"Deadline for handling one API request, downstream calls included"`
+	IdempotencyTTL       time.Duration `env:"IDEMPOTENCY_TTL" flag:"idempotency-ttl" default:"10m" usage:"How long Idempotency-Key results are replayed"`
+	BalanceFallbackTTL   time.Duration `env:"BALANCE_FALLBACK_TTL" flag:"balance-fallback-ttl" default:"1m" usage:"How long a user's last balance answers balance reads while the database fails (0 disables)"`
+	BalanceCacheTTL      time.Duration `env:"BALANCE_CACHE_TTL" flag:"balance-cache-ttl" default:"2s" usage:"How long a get_balance read is answered from memory (0 disables the cache)"`
+	BalanceCacheStale    time.Duration `env:"BALANCE_CACHE_STALE" flag:"balance-cache-stale" default:"10s" usage:"How long after BALANCE_CACHE_TTL an expired balance is still served while it is refreshed"`
+	HedgeBalanceReads    bool          `env:"HEDGE_BALANCE_READS" flag:"hedge-balance-reads" default:"false" usage:"Send a second get_balance call when the first is slower than the recent p95 and take whichever answers first"`
+	HedgeDelay           time.Duration `env:"HEDGE_DELAY" flag:"hedge-delay" default:"100ms" usage:"Hedge delay until enough get_balance latencies are known for their p95"`
+	DBResponseValidation bool          `env:"DB_RESPONSE_VALIDATION" flag:"db-response-validation" default:"true" usage:"Check successful database responses against their JSON schema and record violations"`
+	DBResponseSchemaFile string        `env:"DB_RESPONSE_SCHEMA_FILE" flag:"db-response-schema-file" usage:"JSON schema database responses are checked against (empty uses the built-in one)"`
+	OpenAPIValidation    bool          `env:"OPENAPI_VALIDATION" flag:"openapi-validation" default:"false" usage:"Reject API request bodies that do not match the /openapi.json schema with 400"`
+	RecordFile           string        `env:"RECORD_FILE" flag:"record-file" usage:"Append every API request to this JSONL file for cmd/replay"`
+
+	BatchMaxItems    int `env:"BATCH_MAX_ITEMS" flag:"batch-max-items" default:"100" usage:"Most transactions accepted by /api/transactions/batch"`
+	BatchConcurrency int `env:"BATCH_CONCURRENCY" flag:"batch-concurrency" default:"8" usage:"Batch items sent to the database service at once"`
+
+	CacheIncidentProbability float64       `env:"CACHE_INCIDENT_PROBABILITY" flag:"cache-incident-probability" default:"0" usage:"Chance per CACHE_INCIDENT_INTERVAL of a simulated cache_disabled incident that turns the balance cache off for 30-90s"`
+	CacheIncidentInterval    time.Duration `env:"CACHE_INCIDENT_INTERVAL" flag:"cache-incident-interval" default:"60s" usage:"How often a cache_disabled incident may start"`
+
+	BulkheadDBSize      int           `env:"BULKHEAD_DB_SIZE" flag:"bulkhead-db-size" default:"100" usage:"Database service calls in flight at once; more wait up to BULKHEAD_MAX_WAIT and are then rejected (0 disables)"`
+	BulkheadCacheSize   int           `env:"BULKHEAD_CACHE_SIZE" flag:"bulkhead-cache-size" default:"20" usage:"Balance cache loads in flight at once (0 disables)"`
+	BulkheadPaymentSize int           `env:"BULKHEAD_PAYMENT_SIZE" flag:"bulkhead-payment-size" default:"50" usage:"Payment gateway calls in flight at once (0 disables)"`
+	BulkheadMaxWait     time.Duration `env:"BULKHEAD_MAX_WAIT" flag:"bulkhead-max-wait" default:"50ms" usage:"How long a call waits for a slot in a full bulkhead before it is rejected"`
+
+	ShedMaxInFlight int `env:"SHED_MAX_IN_FLIGHT" flag:"shed-max-in-flight" default:"200" usage:"API requests in flight at which critical ones are shed; batch ones are shed from half of it and normal ones from 80% (0 disables)"`
+
+	RateLimitIPRPS          float64 `env:"RATE_LIMIT_IP_RPS" flag:"rate-limit-ip-rps" default:"50" usage:"Per-client-IP refill rate (0 disables)"`
+	RateLimitIPBurst        float64 `env:"RATE_LIMIT_IP_BURST" flag:"rate-limit-ip-burst" default:"100" usage:"Per-client-IP bucket size"`
+	RateLimitUserRPS        float64 `env:"RATE_LIMIT_USER_RPS" flag:"rate-limit-user-rps" default:"5" usage:"Per-user refill rate (0 disables)"`
+	RateLimitUserBurst      float64 `env:"RATE_LIMIT_USER_BURST" flag:"rate-limit-user-burst" default:"10" usage:"Per-user bucket size"`
+	RateLimitTrustedProxies string  `env:"RATE_LIMIT_TRUSTED_PROXIES" flag:"rate-limit-trusted-proxies" usage:"Comma-separated IPs or CIDRs of proxies whose X-Forwarded-For names the client for the per-IP limit (empty trusts none)"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.IdempotencyTTL <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_TTL must be positive"))
+	}
+	if c.DBCanaryPercent < 0 || c.DBCanaryPercent > 100 {
+		errs = append(errs, errors.New("DB_CANARY_PERCENT must be between 0 and 100"))
+	}
+	if c.DBShadowPercent < 0 || c.DBShadowPercent > 100 {
+		errs = append(errs, errors.New("DB_SHADOW_PERCENT must be between 0 and 100"))
+	}
+	if c.DBShadowMaxInFlight < 0 {
+		errs = append(errs, errors.New("DB_SHADOW_MAX_IN_FLIGHT must not be negative"))
+	}
+	if c.DBCallAttempts < 1 || c.DBRetryBackoff < 0 {
+		errs = append(errs, errors.New("DB_CALL_ATTEMPTS must be at least 1 and DB_RETRY_BACKOFF not negative"))
+	}
+	if c.DBEncoding != dbproto.JSON && c.DBEncoding != dbproto.Protobuf {
+		errs = append(errs, errors.New("DB_ENCODING must be json or protobuf"))
+	}
+	if c.DBCanaryVerdictURL != "" && c.DBCanaryVerdictPoll <= 0 {
+		errs = append(errs, errors.New("DB_CANARY_VERDICT_POLL must be positive"))
+	}
+	if c.HedgeBalanceReads && c.HedgeDelay <= 0 {
+		errs = append(errs, errors.New("HEDGE_DELAY must be positive"))
+	}
+	if c.BalanceFallbackTTL < 0 {
+		errs = append(errs, errors.New("BALANCE_FALLBACK_TTL must not be negative"))
+	}
+	if c.BalanceCacheTTL < 0 || c.BalanceCacheStale < 0 {
+		errs = append(errs, errors.New("BALANCE_CACHE_TTL and BALANCE_CACHE_STALE must not be negative"))
+	}
+	if c.CacheIncidentProbability < 0 || c.CacheIncidentProbability > 1 {
+		errs = append(errs, errors.New("CACHE_INCIDENT_PROBABILITY must be between 0 and 1"))
+	}
+	if c.CacheIncidentProbability > 0 && c.CacheIncidentInterval <= 0 {
+		errs = append(errs, errors.New("CACHE_INCIDENT_INTERVAL must be positive"))
+	}
+	if c.RequestTimeout <= 0 {
+		errs = append(errs, errors.New("REQUEST_TIMEOUT must be positive"))
+	}
+	if c.BatchMaxItems < 1 || c.BatchConcurrency < 1 {
+		errs = append(errs, errors.New("BATCH_MAX_ITEMS and BATCH_CONCURRENCY must be at least 1"))
+	}
+	if c.AuthClockLeeway < 0 {
+		errs = append(errs, errors.New("AUTH_CLOCK_LEEWAY must not be negative"))
+	}
+	if c.BulkheadDBSize < 0 || c.BulkheadCacheSize < 0 || c.BulkheadPaymentSize < 0 {
+		errs = append(errs, errors.New("bulkhead sizes must not be negative"))
+	}
+	if c.BulkheadMaxWait < 0 {
+		errs = append(errs, errors.New("BULKHEAD_MAX_WAIT must not be negative"))
+	}
+	if c.ShedMaxInFlight < 0 {
+		errs = append(errs, errors.New("SHED_MAX_IN_FLIGHT must not be negative"))
+	}
+	if c.RateLimitIPRPS < 0 || c.RateLimitUserRPS < 0 {
+		errs = append(errs, errors.New("rate limit RPS must not be negative"))
+	}
+	if c.RateLimitIPRPS > 0 && c.RateLimitIPBurst < 1 {
+		errs = append(errs, errors.New("RATE_LIMIT_IP_BURST must be at least 1"))
+	}
+	if c.RateLimitUserRPS > 0 && c.RateLimitUserBurst < 1 {
+		errs = append(errs, errors.New("RATE_LIMIT_USER_BURST must be at least 1"))
+	}
+	if _, err := parseTrustedProxies(c.RateLimitTrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_TRUSTED_PROXIES: %w", err))
+	}
+	errs = append(errs, c.Batching.Validate(), c.Sampling.Validate(), c.Logging.Validate(), c.HTTPClient.Validate(), c.Costing.Validate(), c.Deploy.Validate())
+	return errors.Join(errs...)
+}
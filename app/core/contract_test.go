@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"incident-simulation/pkg/contracttest"
+)
+
+// contractDir holds the answers the database service recorded in its contract
+// tests
+const contractDir = "../testdata/contracts/database"
+
+// dbExpectation is how the core API must handle one recorded database answer
+type dbExpectation struct {
+	status    int
+	errorType string // api_errors_total error_type, empty on success
+	calls     int32  // database queries the core API request makes
+}
+
+// databaseExpectations covers every recorded interaction; one recorded
+// without an expectation fails the test until the core API decides how to
+// handle it
+var databaseExpectations = map[string]dbExpectation{
+	"deposit_success":             {status: http.StatusOK, calls: 1},
+	"withdrawal_success":          {status: http.StatusOK, calls: 1},
+	"balance_check_success":       {status: http.StatusOK, calls: 1},
+	"get_balance_success":         {status: http.StatusOK, calls: 1},
+	"transfer_debit_success":      {status: http.StatusOK, calls: 2},
+	"transfer_credit_success":     {status: http.StatusOK, calls: 2},
+	"transfer_compensate_success": {status: http.StatusOK, calls: 2},
+	"query_error":                 {status: http.StatusInternalServerError, errorType: "database_error", calls: 1},
+	// The pool turned the query away before it ran, so it is retried once
+	// (DB_CALL_ATTEMPTS defaults to 2)
+	"pool_exhausted": {status: http.StatusInternalServerError, errorType: "database_error", calls: 2},
+	// The database gave up on its own caller; the core API's deadline has not passed
+	"deadline_exceeded": {status: http.StatusInternalServerError, errorType: "database_error", calls: 1},
+	// The query would have outlasted what is left of REQUEST_TIMEOUT, so it is not retried
+	"budget_exceeded": {status: http.StatusInternalServerError, errorType: "database_error", calls: 1},
+	"invalid_request": {status: http.StatusInternalServerError, errorType: "database_error", calls: 1},
+}
+
+// replayServer answers every request with the recorded status and body and
+// counts the database queries
+func replayServer(t *testing.T, status int, body []byte) (string, *atomic.Int32) {
+	t.Helper()
+	calls := new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/query" {
+			calls.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, calls
+}
+
+// coreRequest is the core API request that makes the database operation of
+// the recorded request; transfer steps are reached through a transfer
+func coreRequest(t *testing.T, in contracttest.Interaction) (method, path, body string) {
+	t.Helper()
+	var req TransactionRequest
+	if err := json.Unmarshal(in.Request, &req); err != nil || req.Operation == "" {
+		// A request the database could not decode is still a deposit to the core API
+		req.Operation = "deposit"
+	}
+	switch {
+	case req.Operation == "get_balance":
+		return http.MethodGet, "/api/user/user_1/balance", ""
+	case strings.HasPrefix(req.Operation, "transfer_"):
+		return http.MethodPost, "/api/transaction", `{"user_id":"user_1","to_user_id":"user_2","amount":25,"operation":"transfer"}`
+	}
+	return http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":25,"operation":"` + req.Operation + `"}`
+}
+
+func TestDatabaseContract(t *testing.T) {
+	payments := fakeServer(t, http.StatusOK, `{"payment_id":"pay_1","status":"authorized","network":"visa"}`)
+
+	for _, in := range contracttest.Load(t, contractDir) {
+		t.Run(in.Name, func(t *testing.T) {
+			want, ok := databaseExpectations[in.Name]
+			if !ok {
+				t.Fatalf("no expectation for the recorded %q (%s)", in.Name, in.Description)
+			}
+			db, calls := replayServer(t, in.Status, in.Response)
+			handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+payments, "-auth-service-url="+db)
+
+			method, path, body := coreRequest(t, in)
+			rec := serve(handler, method, path, body)
+			flush()
+
+			if rec.Code != want.status {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, want.status, rec.Body)
+			}
+			if got := calls.Load(); got != want.calls {
+				t.Errorf("database calls = %d, want %d", got, want.calls)
+			}
+			if want.errorType == "" {
+				assertPassedThrough(t, rec.Body.Bytes(), in.Response, path)
+				assertSchemaValid(t, in)
+				return
+			}
+			if !strings.Contains(rec.Body.String(), `"trace_id"`) {
+				t.Errorf("error response %s has no trace_id", rec.Body)
+			}
+			if points := collector.PointsNamed("api_errors_total", map[string]string{"error_type": want.errorType}); len(points) != 1 {
+				t.Errorf("api_errors_total{error_type=%s} points = %+v, want one", want.errorType, points)
+			}
+		})
+	}
+}
+
+// assertSchemaValid fails t when a recorded success breaks the built-in
+// response schema, which must describe what the database service answers
+func assertSchemaValid(t *testing.T, in contracttest.Interaction) {
+	t.Helper()
+	schema, err := loadResponseSchema("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req TransactionRequest
+	var resp interface{}
+	if err := json.Unmarshal(in.Request, &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(in.Response, &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range schema.validate(req, resp) {
+		t.Errorf("recorded %s breaks the response schema: %s", in.Name, v)
+	}
+}
+
+// TestDatabaseMalformedResponse covers a 200 whose body is not JSON, which no
+// database service version should send but a proxy in between might
+func TestDatabaseMalformedResponse(t *testing.T) {
+	db, calls := replayServer(t, http.StatusOK, []byte(`<html>502 Bad Gateway</html>`))
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+db, "-auth-service-url="+db)
+
+	rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":25,"operation":"balance_check"}`)
+	flush()
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("database calls = %d, want 1", got)
+	}
+	call := collector.Span(t, "Database Service Call")
+	if call.StatusCode != "error" || !strings.Contains(call.StatusMessage, "failed to unmarshal response") {
+		t.Errorf("Database Service Call status %s %q, want the unmarshal error", call.StatusCode, call.StatusMessage)
+	}
+	assertCount(t, collector, "api_errors_total", map[string]string{"error_type": "database_error"}, 1)
+}
+
+// assertPassedThrough checks that the database answer reaches the client: as
+// is from the balance endpoint, as data of a transaction
+func assertPassedThrough(t *testing.T, body, recorded []byte, path string) {
+	t.Helper()
+	var got map[string]any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("response %s is not JSON: %v", body, err)
+	}
+	passed := got
+	if path == "/api/transaction" {
+		data, ok := got["data"].(map[string]any)
+		if !ok {
+			t.Fatalf("transaction response %s has no data", body)
+		}
+		passed = data
+	}
+	var want map[string]any
+	if err := json.Unmarshal(recorded, &want); err != nil {
+		t.Fatal(err)
+	}
+	for key := range want {
+		if _, ok := passed[key]; !ok {
+			t.Errorf("database field %s did not reach the client: %s", key, body)
+		}
+	}
+}
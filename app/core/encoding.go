@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"incident-simulation/pkg/dbproto"
+	"incident-simulation/pkg/jsonx"
+)
+
+// queryBody is a database query encoded for the wire in DB_ENCODING
+type queryBody struct {
+	data     []byte
+	encoding string
+}
+
+// encodeQuery encodes req in encoding, json or protobuf
+func encodeQuery(req TransactionRequest, encoding string) (queryBody, error) {
+	if encoding == dbproto.Protobuf {
+		return queryBody{data: dbproto.MarshalRequest(dbproto.Request{
+			UserID:    req.UserID,
+			Amount:    req.Amount,
+			Operation: req.Operation,
+			ToUserID:  req.ToUserID,
+		}), encoding: encoding}, nil
+	}
+	data, err := jsonx.Marshal(req)
+	if err != nil {
+		return queryBody{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return queryBody{data: data, encoding: dbproto.JSON}, nil
+}
+
+// accept is the Accept header of a query sent in encoding: protobuf callers
+// still take JSON, from a database that only speaks that
+func (q queryBody) accept() string {
+	if q.encoding == dbproto.Protobuf {
+		return dbproto.ContentType + ", " + dbproto.JSONContentType + ";q=0.5"
+	}
+	return dbproto.JSONContentType
+}
+
+// decodeQueryResponse reads a database answer in encoding into the same
+// values whichever encoding it came in
+func decodeQueryResponse(body []byte, encoding string) (interface{}, error) {
+	if encoding == dbproto.Protobuf {
+		resp, err := dbproto.UnmarshalResponse(body)
+		if err != nil {
+			return nil, err
+		}
+		return resp.AsMap(), nil
+	}
+	var result interface{}
+	err := jsonx.Unmarshal(body, &result)
+	return result, err
+}
+
+// errorBody returns a failed answer as text for the error message, protobuf
+// answers rendered as JSON
+func errorBody(body []byte, encoding string) string {
+	if encoding != dbproto.Protobuf {
+		return string(body)
+	}
+	resp, err := decodeQueryResponse(body, encoding)
+	if err != nil {
+		return "undecodable protobuf answer"
+	}
+	text, _ := jsonx.Marshal(resp)
+	return string(text)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/logx"
+)
+
+// maxFallbackBalances bounds the users remembered; user IDs come from request
+// paths, so clients could otherwise grow the map without limit
+const maxFallbackBalances = 10000
+
+// lastBalance is the last balance the database returned for a user
+type lastBalance struct {
+	response map[string]interface{}
+	at       time.Time
+}
+
+// balanceFallback keeps the last balance read of each user for ttl, so a
+// balance read can still be answered, marked stale, while the database fails
+type balanceFallback struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	balances map[string]lastBalance
+}
+
+// newBalanceFallback returns nil, which never answers, when ttl is 0
+func newBalanceFallback(ttl time.Duration) *balanceFallback {
+	if ttl <= 0 {
+		return nil
+	}
+	return &balanceFallback{ttl: ttl, balances: make(map[string]lastBalance)}
+}
+
+// Put remembers a successful balance read
+func (f *balanceFallback) Put(userID string, resp interface{}) {
+	balance, ok := resp.(map[string]interface{})
+	if f == nil || !ok {
+		return
+	}
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, known := f.balances[userID]; !known && len(f.balances) >= maxFallbackBalances {
+		for id, b := range f.balances {
+			if now.Sub(b.at) > f.ttl {
+				delete(f.balances, id)
+			}
+		}
+		if len(f.balances) >= maxFallbackBalances {
+			return
+		}
+	}
+	f.balances[userID] = lastBalance{response: balance, at: now}
+}
+
+// Get returns the last balance of userID if it is younger than the ttl
+func (f *balanceFallback) Get(userID string) (lastBalance, bool) {
+	if f == nil {
+		return lastBalance{}, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.balances[userID]
+	if !ok || time.Since(b.at) > f.ttl {
+		return lastBalance{}, false
+	}
+	return b, true
+}
+
+// fallbackReason classifies the database failure a fallback answers for:
+// bulkhead_full, the retry reasons, or database_error for the rest
+func fallbackReason(err error) string {
+	if bulkheadRejected(err) {
+		return "bulkhead_full"
+	}
+	if reason := retryReason(err); reason != "" {
+		return reason
+	}
+	return "database_error"
+}
+
+// serveStaleBalance answers a failed balance read from the fallback. Its
+// span links to the database attempt that failed, with the reason, so the
+// decision to answer stale data shows up in the trace next to its cause.
+func serveStaleBalance(ctx context.Context, fallback *balanceFallback, userID string, dbErr error) (map[string]interface{}, bool) {
+	last, ok := fallback.Get(userID)
+	if !ok {
+		return nil, false
+	}
+	reason := fallbackReason(dbErr)
+	opts := []oteltrace.SpanStartOption{oteltrace.WithAttributes(attrs.FallbackReason(reason))}
+	if failed, ok := failedAttempt(dbErr); ok {
+		opts = append(opts, oteltrace.WithLinks(oteltrace.Link{
+			SpanContext: failed,
+			Attributes:  []attribute.KeyValue{attrs.LinkKind(attrs.LinkKindFallback), attrs.FallbackReason(reason)},
+		}))
+	}
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Balance Fallback", opts...)
+	defer span.End()
+
+	age := time.Since(last.at)
+	fallbackCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("fallback", "last_balance"),
+		attribute.String("reason", reason),
+	))
+	logx.Warnw(ctx, "🪂 Answered balance from the last read", "user.id", userID, "fallback.reason", reason, "fallback.age_seconds", age.Seconds(), "error", dbErr)
+
+	resp := make(map[string]interface{}, len(last.response)+2)
+	for k, v := range last.response {
+		resp[k] = v
+	}
+	resp["stale"] = true
+	resp["stale_age_seconds"] = age.Seconds()
+	return resp, true
+}
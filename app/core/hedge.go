@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+)
+
+// Recent get_balance latencies the hedge delay is the p95 of
+const (
+	hedgeWindow     = 200
+	hedgeMinSamples = 20
+)
+
+// Outcomes of a hedged attempt, in db_hedged_calls_total and app.hedge.outcome
+const (
+	hedgeNotSent = "not_sent"
+	hedgeWon     = "won"
+	hedgeLost    = "lost"
+	hedgeFailed  = "failed"
+)
+
+// hedger sends a second get_balance request when the first has not answered
+// within the p95 of recent ones and takes whichever succeeds first, cancelling
+// the other. Balance reads are idempotent, so the duplicate costs some load
+// but trims the tail a slow query or a busy pool adds.
+type hedger struct {
+	fallback time.Duration // delay until hedgeMinSamples latencies are known
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring of the last hedgeWindow successes
+	next      int
+}
+
+func newHedger(fallback time.Duration) *hedger {
+	return &hedger{fallback: fallback, latencies: make([]time.Duration, 0, hedgeWindow)}
+}
+
+// observe adds the latency of a successful request
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeWindow {
+		h.latencies = append(h.latencies, d)
+		return
+	}
+	h.latencies[h.next] = d
+	h.next = (h.next + 1) % hedgeWindow
+}
+
+// delay returns the p95 of the recent latencies
+func (h *hedger) delay() time.Duration {
+	h.mu.Lock()
+	sorted := slices.Clone(h.latencies)
+	h.mu.Unlock()
+	if len(sorted) < hedgeMinSamples {
+		return h.fallback
+	}
+	slices.Sort(sorted)
+	return sorted[(len(sorted)*95+99)/100-1]
+}
+
+// hedgeResult is the answer of one of the two requests
+type hedgeResult struct {
+	value interface{}
+	err   error
+	hedge bool
+	took  time.Duration
+}
+
+// attempt is databaseAttempt with a hedge. The second request runs under a
+// Database Service Hedge span; the outcome and delay go on the attempt span.
+func (h *hedger) attempt(ctx context.Context, client *http.Client, dbServiceURL string, reqBody queryBody) (interface{}, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	delay := h.delay()
+	span.SetAttributes(attrs.HedgeDelay(float64(delay.Microseconds()) / 1000))
+
+	// Cancels the slower request once the faster one has answered
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	send := func(ctx context.Context, hedge bool) error {
+		start := time.Now()
+		value, err := databaseAttempt(ctx, client, dbServiceURL, reqBody)
+		results <- hedgeResult{value: value, err: err, hedge: hedge, took: time.Since(start)}
+		return err
+	}
+	go send(ctx, false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending, sent := 1, false
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			pending, sent = pending+1, true
+			go func() {
+				hedgeCtx, hedgeSpan := otel.Tracer("core-api-service").Start(ctx, "Database Service Hedge")
+				defer hedgeSpan.End()
+				if err := send(hedgeCtx, true); err != nil {
+					failDatabaseCall(hedgeSpan, err)
+				}
+			}()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				h.observe(r.took)
+				outcome := hedgeNotSent
+				switch {
+				case r.hedge:
+					outcome = hedgeWon
+				case sent:
+					outcome = hedgeLost
+				}
+				h.record(ctx, span, outcome)
+				return r.value, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			// The other request may still succeed
+			if pending > 0 {
+				continue
+			}
+			outcome := hedgeNotSent
+			if sent {
+				outcome = hedgeFailed
+			}
+			h.record(ctx, span, outcome)
+			return nil, firstErr
+		}
+	}
+}
+
+func (h *hedger) record(ctx context.Context, span oteltrace.Span, outcome string) {
+	span.SetAttributes(attrs.HedgeOutcome(outcome))
+	hedgeOutcomes.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+)
+
+// errIdempotencyMismatch is a key reused for a request other than the one it
+// was first sent with
+var errIdempotencyMismatch = errors.New("Idempotency-Key was used with a different request")
+
+// cachedResult is a successful transaction outcome stored under an Idempotency-Key;
+// failures are not cached so clients can retry them with the same key
+type cachedResult struct {
+	statusCode int
+	response   TransactionResponse
+}
+
+// idempotencyEntry is a key's request in flight, or its stored result
+type idempotencyEntry struct {
+	hash      [sha256.Size]byte
+	done      chan struct{} // closed once the request in flight finishes
+	result    *cachedResult // nil while in flight
+	expiresAt time.Time
+}
+
+// idempotencyStore keeps transaction results in memory for a fixed TTL, and
+// reserves a key while its first request runs so duplicates cannot book it twice
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	s := &idempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+	go s.evictLoop()
+	return s
+}
+
+// requestHash identifies a request's method and body, which a key is bound to
+func requestHash(method string, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write(body)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// Claim returns the stored result of key with replay true, or reserves key
+// for the caller, which must then Complete or Release it. A duplicate of a
+// request in flight waits for it and takes over the key when it failed. The
+// error is errIdempotencyMismatch when key belongs to another request, or
+// ctx's error when it ended while waiting.
+func (s *idempotencyStore) Claim(ctx context.Context, key string, hash [sha256.Size]byte) (res cachedResult, replay bool, err error) {
+	for {
+		s.mu.Lock()
+		e, ok := s.entries[key]
+		if ok && e.result != nil && time.Now().After(e.expiresAt) {
+			delete(s.entries, key)
+			ok = false
+		}
+		if !ok {
+			s.entries[key] = &idempotencyEntry{hash: hash, done: make(chan struct{})}
+			s.mu.Unlock()
+			return cachedResult{}, false, nil
+		}
+		result, done := e.result, e.done
+		s.mu.Unlock()
+
+		if e.hash != hash {
+			return cachedResult{}, false, errIdempotencyMismatch
+		}
+		if result != nil {
+			return *result, true, nil
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return cachedResult{}, false, ctx.Err()
+		}
+	}
+}
+
+// Complete stores the result of the request that claimed key
+func (s *idempotencyStore) Complete(key string, statusCode int, resp TransactionResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.result == nil {
+		e.result = &cachedResult{statusCode: statusCode, response: resp}
+		e.expiresAt = time.Now().Add(s.ttl)
+		close(e.done)
+	}
+}
+
+// Release frees key after its request failed, so it can be retried
+func (s *idempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.result == nil {
+		delete(s.entries, key)
+		close(e.done)
+	}
+}
+
+// rejectIdempotent answers a keyed request that cannot run after Claim or
+// reading its body failed with err: 422 for a key reused with another
+// request, 409 for a duplicate that gave up waiting on the first
+func rejectIdempotent(ctx context.Context, w http.ResponseWriter, err error) {
+	status, errorType, message := http.StatusBadRequest, "invalid_request", "invalid request body"
+	switch {
+	case errors.Is(err, errIdempotencyMismatch):
+		status, errorType, message = http.StatusUnprocessableEntity, "idempotency_mismatch", err.Error()
+	case ctx.Err() != nil:
+		status, errorType, message = http.StatusConflict, "idempotency_in_flight", "a request with this Idempotency-Key is still in progress"
+		w.Header().Set("Retry-After", "1")
+	}
+	oteltrace.SpanFromContext(ctx).SetStatus(codes.Error, message)
+	errorCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("error_type", errorType),
+	))
+
+	resp := TransactionResponse{
+		Status:    "error",
+		Error:     message,
+		Timestamp: time.Now().Unix(),
+		ErrorRef:  httpx.NewErrorRef(ctx, w),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	jsonx.NewEncoder(w).Encode(resp)
+}
+
+func (s *idempotencyStore) evictLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mu.Lock()
+		for key, e := range s.entries {
+			if e.result != nil && now.After(e.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	body := requestHash(http.MethodPost, []byte(`{"amount":5}`))
+	other := requestHash(http.MethodPost, []byte(`{"amount":6}`))
+
+	for _, tc := range []struct {
+		name    string
+		prepare func(s *idempotencyStore)
+		hash    [32]byte
+		replay  bool
+		err     error
+	}{
+		{"new key", func(s *idempotencyStore) {}, body, false, nil},
+		{"stored result", func(s *idempotencyStore) {
+			s.Claim(ctx, "k", body)
+			s.Complete("k", http.StatusOK, TransactionResponse{TransactionID: "txn_1"})
+		}, body, true, nil},
+		{"stored result of another body", func(s *idempotencyStore) {
+			s.Claim(ctx, "k", body)
+			s.Complete("k", http.StatusOK, TransactionResponse{TransactionID: "txn_1"})
+		}, other, false, errIdempotencyMismatch},
+		{"in flight with another body", func(s *idempotencyStore) { s.Claim(ctx, "k", body) }, other, false, errIdempotencyMismatch},
+		{"released after a failure", func(s *idempotencyStore) {
+			s.Claim(ctx, "k", body)
+			s.Release("k")
+		}, body, false, nil},
+		{"expired", func(s *idempotencyStore) {
+			s.Claim(ctx, "k", body)
+			s.Complete("k", http.StatusOK, TransactionResponse{})
+			s.entries["k"].expiresAt = time.Now().Add(-time.Second)
+		}, other, false, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newIdempotencyStore(time.Minute)
+			tc.prepare(s)
+			res, replay, err := s.Claim(ctx, "k", tc.hash)
+			if replay != tc.replay || !errors.Is(err, tc.err) {
+				t.Fatalf("Claim = replay %v, %v; want %v, %v", replay, err, tc.replay, tc.err)
+			}
+			if replay && res.response.TransactionID != "txn_1" {
+				t.Errorf("replayed %+v, want txn_1", res.response)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreInFlight(t *testing.T) {
+	s := newIdempotencyStore(time.Minute)
+	hash := requestHash(http.MethodPost, nil)
+	if _, _, err := s.Claim(context.Background(), "k", hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// A duplicate gives up when its context ends first
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.Claim(ctx, "k", hash); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Claim while in flight = %v, want the deadline", err)
+	}
+
+	// After a failure the waiting duplicate takes the key over
+	claimed := make(chan bool)
+	go func() {
+		_, replay, err := s.Claim(context.Background(), "k", hash)
+		claimed <- err == nil && !replay
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.Release("k")
+	if !<-claimed {
+		t.Fatal("the duplicate did not claim the released key")
+	}
+
+	// After a success it replays the result
+	go func() {
+		_, replay, err := s.Claim(context.Background(), "k", hash)
+		claimed <- err == nil && replay
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.Complete("k", http.StatusOK, TransactionResponse{TransactionID: "txn_1"})
+	if !<-claimed {
+		t.Fatal("the duplicate did not replay the stored result")
+	}
+}
@@ -0,0 +1,999 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiclient "incident-simulation/pkg/client"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/dbproto"
+	"incident-simulation/pkg/deploy"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/telemetry"
+	"incident-simulation/pkg/telemetry/telemetrytest"
+)
+
+// newTestService builds the core API with its real telemetry setup exporting
+// to an in-memory collector; flush shuts the providers down so everything
+// emitted so far has arrived
+func newTestService(t *testing.T, args ...string) (http.Handler, *telemetrytest.Collector, func()) {
+	t.Helper()
+	collector := telemetrytest.NewCollector(t)
+
+	var cfg Config
+	args = append([]string{"-telemetry-exporter=otlp", "-otlp-insecure", "-otlp-endpoint=" + collector.Endpoint()}, args...)
+	if err := config.Load(&cfg, args); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	ctx := context.Background()
+	recorder := telemetry.NewRecorder("core-api-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	heatmap := telemetry.NewHeatmap("core-api-service", cfg.LatencyHeatmapMinutes)
+	deploys := deploy.New("core-api-service", cfg.Deploy, http.DefaultClient, logDeployment)
+	shutdown := initOpenTelemetry(ctx, "core-api-service", cfg.Telemetry, recorder, health, heatmap, deploys.SpanProcessor())
+	initMetrics(ctx)
+	handler := newCoreHandler(cfg, recorder, health, heatmap, deploys)
+
+	var once sync.Once
+	flush := func() { once.Do(shutdown) }
+	t.Cleanup(flush)
+	return handler, collector, flush
+}
+
+// fakeServer answers every request with status and body
+func fakeServer(t testing.TB, status int, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTransactionTelemetry(t *testing.T) {
+	db := fakeServer(t, http.StatusOK, `{"status":"success","data":{"result":"success"}}`)
+	payments := fakeServer(t, http.StatusOK, `{"payment_id":"pay_1","status":"authorized","network":"visa"}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+payments, "-auth-service-url="+db)
+
+	rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":50,"operation":"deposit"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	server := collector.Span(t, "core-api-service")
+	if server.Kind != "server" || server.StatusCode != "unset" {
+		t.Errorf("server span kind %s status %s, want server unset", server.Kind, server.StatusCode)
+	}
+	telemetrytest.AssertAttributes(t, "server span", server.Attributes, map[string]string{
+		"http.request.method":       "POST",
+		"http.response.status_code": "200",
+	})
+
+	process := collector.Span(t, "Process Transaction")
+	if process.ParentSpanID != server.SpanID || process.StatusCode != "unset" {
+		t.Errorf("Process Transaction parent %s status %s, want %s unset", process.ParentSpanID, process.StatusCode, server.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "Process Transaction", process.Attributes, map[string]string{
+		"app.transaction.id":        "*",
+		"app.transaction.operation": "deposit",
+		"app.transaction.amount":    "50",
+		"user.id":                   "user_1",
+		"payment.id":                "pay_1",
+	})
+	assertEvents(t, process, "validation.passed", "payment.authorized", "db.call.started", "db.call.finished", "response.serialized")
+
+	for _, name := range []string{"Payment Gateway Call", "Database Service Call"} {
+		span := collector.Span(t, name)
+		if span.ParentSpanID != process.SpanID || span.StatusCode != "unset" {
+			t.Errorf("%s parent %s status %s, want %s unset", name, span.ParentSpanID, span.StatusCode, process.SpanID)
+		}
+	}
+	telemetrytest.AssertAttributes(t, "Database Service Call", collector.Span(t, "Database Service Call").Attributes, map[string]string{
+		"db.system.name":    "postgresql",
+		"db.operation.name": "deposit",
+	})
+
+	assertCount(t, collector, "api_transactions_total", map[string]string{"status": "success", "operation": "deposit"}, 1)
+	assertHistogramCount(t, collector, "api_response_time_seconds", map[string]string{"operation": "transaction", "method": "POST"}, 1)
+	assertHistogramCount(t, collector, "payment_call_duration_seconds", map[string]string{"operation": "deposit"}, 1)
+	assertHistogramCount(t, collector, "db_call_duration_seconds", map[string]string{"db_operation": "deposit"}, 1)
+	if points := collector.PointsNamed("api_errors_total", nil); len(points) != 0 {
+		t.Errorf("api_errors_total recorded on success: %+v", points)
+	}
+
+	logs := collector.LogsWithBody("Transaction successful")
+	if len(logs) != 1 {
+		t.Fatalf("got %d success logs, want 1", len(logs))
+	}
+	if logs[0].TraceID != process.TraceID || logs[0].SpanID != process.SpanID {
+		t.Errorf("success log trace %s span %s, want %s %s", logs[0].TraceID, logs[0].SpanID, process.TraceID, process.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "success log", logs[0].Attributes, map[string]string{
+		"transaction.id":        process.Attributes["app.transaction.id"],
+		"transaction.operation": "deposit",
+		"service":               "core-api-service",
+	})
+}
+
+func TestTransactionValidationTelemetry(t *testing.T) {
+	db := fakeServer(t, http.StatusOK, `{}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+db, "-auth-service-url="+db)
+
+	rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":-5,"operation":"deposit"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	flush()
+
+	// A rejected request is the client's error, not the server's
+	if server := collector.Span(t, "core-api-service"); server.StatusCode != "unset" {
+		t.Errorf("server span status %s, want unset for a 400", server.StatusCode)
+	}
+	process := collector.Span(t, "Process Transaction")
+	if process.StatusCode != "error" || process.StatusMessage != "validation failed" {
+		t.Errorf("Process Transaction status %s %q, want error \"validation failed\"", process.StatusCode, process.StatusMessage)
+	}
+	telemetrytest.AssertAttributes(t, "Process Transaction", process.Attributes, map[string]string{"validation.error_count": "1"})
+	if spans := collector.SpansNamed("Database Service Call"); len(spans) != 0 {
+		t.Errorf("rejected transaction called the database")
+	}
+
+	assertCount(t, collector, "api_errors_total", map[string]string{"error_type": "validation_error"}, 1)
+	assertCount(t, collector, "api_validation_errors_total", map[string]string{"field": "amount"}, 1)
+	if points := collector.PointsNamed("api_transactions_total", nil); len(points) != 0 {
+		t.Errorf("api_transactions_total recorded for a rejected request: %+v", points)
+	}
+	if logs := collector.LogsWithBody("Transaction rejected"); len(logs) != 1 {
+		t.Errorf("got %d rejection logs, want 1", len(logs))
+	}
+}
+
+func TestTransactionDatabaseFailureTelemetry(t *testing.T) {
+	db := fakeServer(t, http.StatusInternalServerError, `{"status":"error","error":"deadlock detected"}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+db, "-auth-service-url="+db)
+
+	rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	flush()
+
+	if server := collector.Span(t, "core-api-service"); server.StatusCode != "error" {
+		t.Errorf("server span status %s, want error for a 500", server.StatusCode)
+	}
+	process := collector.Span(t, "Process Transaction")
+	if process.StatusCode != "error" || process.StatusMessage != "database service call failed" {
+		t.Errorf("Process Transaction status %s %q", process.StatusCode, process.StatusMessage)
+	}
+	call := collector.Span(t, "Database Service Call")
+	if call.StatusCode != "error" || !strings.Contains(call.StatusMessage, "deadlock detected") {
+		t.Errorf("Database Service Call status %s %q, want the database error", call.StatusCode, call.StatusMessage)
+	}
+	assertEvents(t, process, "validation.passed", "db.call.started", "db.call.finished")
+	telemetrytest.AssertAttributes(t, "db.call.finished", process.Events[2].Attributes, map[string]string{"app.db.call.failed": "true"})
+
+	assertCount(t, collector, "api_transactions_total", map[string]string{"status": "failed", "error_type": "database_error"}, 1)
+	assertCount(t, collector, "api_errors_total", map[string]string{"error_type": "database_error"}, 1)
+
+	logs := collector.LogsWithBody("Transaction failed: database error")
+	if len(logs) != 1 {
+		t.Fatalf("got %d failure logs, want 1", len(logs))
+	}
+	if logs[0].Severity != "error" || logs[0].TraceID != process.TraceID {
+		t.Errorf("failure log severity %q trace %s, want error %s", logs[0].Severity, logs[0].TraceID, process.TraceID)
+	}
+}
+
+// sequenceServer answers the database queries with statuses in turn, the
+// last one from then on, and every other request with 200
+func sequenceServer(t *testing.T, body string, statuses ...int) string {
+	t.Helper()
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		if r.URL.Path == "/db/query" {
+			mu.Lock()
+			status = statuses[0]
+			if len(statuses) > 1 {
+				statuses = statuses[1:]
+			}
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestDatabaseRetryLinks(t *testing.T) {
+	db := sequenceServer(t, `{"status":"success","data":{"result":"success"}}`, http.StatusServiceUnavailable, http.StatusOK)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+db, "-auth-service-url="+db)
+
+	if rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	call := collector.Span(t, "Database Service Call")
+	attempts := collector.SpansNamed("Database Service Attempt")
+	if len(attempts) != 2 {
+		t.Fatalf("got %d attempt spans, want 2", len(attempts))
+	}
+	first, retry := attempts[0], attempts[1]
+	if first.Attributes["app.retry.attempt"] == "2" {
+		first, retry = retry, first
+	}
+	for _, span := range attempts {
+		if span.ParentSpanID != call.SpanID {
+			t.Errorf("attempt %s parent %s, want the call %s", span.Attributes["app.retry.attempt"], span.ParentSpanID, call.SpanID)
+		}
+	}
+	if first.StatusCode != "error" || len(first.Links) != 0 {
+		t.Errorf("first attempt status %s links %+v, want error and none", first.StatusCode, first.Links)
+	}
+	telemetrytest.AssertAttributes(t, "retry", retry.Attributes, map[string]string{"app.retry.attempt": "2", "app.retry.reason": "unavailable"})
+	if len(retry.Links) != 1 || retry.Links[0].SpanID != first.SpanID || retry.Links[0].TraceID != first.TraceID {
+		t.Fatalf("retry links %+v, want one to the first attempt %s", retry.Links, first.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "retry link", retry.Links[0].Attributes, map[string]string{"app.link.kind": "retry", "app.retry.reason": "unavailable"})
+}
+
+func TestRetryAmplification(t *testing.T) {
+	for _, tc := range []struct {
+		attempts string
+		calls    int32
+	}{{"1", 1}, {"3", 3}} {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/db/query" {
+				calls.Add(1)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"error","error":"database is rejecting queries"}`))
+		}))
+		handler, collector, flush := newTestService(t, "-db-service-url="+srv.URL, "-payment-gateway-url="+srv.URL, "-auth-service-url="+srv.URL,
+			"-db-call-attempts="+tc.attempts, "-db-retry-backoff=1ms")
+
+		serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`)
+		flush()
+		srv.Close()
+
+		if n := calls.Load(); n != tc.calls {
+			t.Errorf("DB_CALL_ATTEMPTS=%s: the database got %d queries for one call, want %d", tc.attempts, n, tc.calls)
+		}
+		assertCount(t, collector, "db_call_retry_amplification", nil, float64(tc.calls))
+		if retries := collector.PointsNamed("db_call_retries_total", map[string]string{"reason": "unavailable"}); tc.calls > 1 && (len(retries) != 1 || retries[0].Value != float64(tc.calls-1)) {
+			t.Errorf("DB_CALL_ATTEMPTS=%s: db_call_retries_total points %+v, want %d retries", tc.attempts, retries, tc.calls-1)
+		}
+	}
+}
+
+func TestIdempotentTransaction(t *testing.T) {
+	var calls atomic.Int32
+	received, release := make(chan struct{}, 1), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/query" {
+			calls.Add(1)
+			received <- struct{}{}
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"result":"success"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	handler, collector, flush := newTestService(t, "-db-service-url="+srv.URL, "-payment-gateway-url="+srv.URL, "-auth-service-url="+srv.URL)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/transaction", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "key_1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	const body = `{"user_id":"user_1","amount":5,"operation":"balance_check"}`
+
+	// The duplicate arrives while the first request is in flight and waits for it
+	results := make(chan *httptest.ResponseRecorder, 2)
+	go func() { results <- send(body) }()
+	<-received
+	go func() { results <- send(body) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	first, second := <-results, <-results
+	if first.Header().Get("Idempotent-Replayed") == "true" {
+		first, second = second, first
+	}
+	if first.Code != http.StatusOK || second.Code != http.StatusOK || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("statuses %d and %d, replayed %q; want 200 twice, the duplicate replayed", first.Code, second.Code, second.Header().Get("Idempotent-Replayed"))
+	}
+	var a, b TransactionResponse
+	json.Unmarshal(first.Body.Bytes(), &a)
+	json.Unmarshal(second.Body.Bytes(), &b)
+	if a.TransactionID == "" || a.TransactionID != b.TransactionID {
+		t.Errorf("transaction IDs %q and %q, want the same", a.TransactionID, b.TransactionID)
+	}
+
+	if rec := send(`{"user_id":"user_1","amount":6,"operation":"balance_check"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another body: status %d, want 422", rec.Code)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("the database got %d queries, want 1", n)
+	}
+	flush()
+
+	assertCount(t, collector, "api_idempotent_replays_total", map[string]string{"status": "success"}, 1)
+	assertCount(t, collector, "api_errors_total", map[string]string{"error_type": "idempotency_mismatch"}, 1)
+	assertHistogramCount(t, collector, "api_response_time_seconds", map[string]string{"operation": "transaction", "method": "POST"}, 3)
+}
+
+func TestDatabaseProtobufEncoding(t *testing.T) {
+	queries := make(chan dbproto.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/query" {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		q, err := dbproto.UnmarshalRequest(body)
+		if err != nil || r.Header.Get("Content-Type") != dbproto.ContentType || dbproto.Negotiate(r.Header.Get("Accept")) != dbproto.Protobuf {
+			http.Error(w, "not a protobuf query", http.StatusBadRequest)
+			return
+		}
+		queries <- q
+		out, _ := dbproto.MarshalResponse(dbproto.Response{
+			Status: "success",
+			Data:   map[string]interface{}{"user_id": q.UserID, "balance": 120.5, "available_balance": 120.5, "currency": "USD"},
+		})
+		w.Header().Set("Content-Type", dbproto.ContentType)
+		w.Write(out)
+	}))
+	t.Cleanup(srv.Close)
+	handler, collector, flush := newTestService(t, "-db-service-url="+srv.URL, "-payment-gateway-url="+srv.URL, "-auth-service-url="+srv.URL, "-db-encoding=protobuf")
+
+	rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"currency":"USD"`) {
+		t.Fatalf("status = %d, body %s; want 200 with the decoded balance", rec.Code, rec.Body)
+	}
+	if q := <-queries; q.UserID != "user_1" || q.Operation != "balance_check" || q.Amount != 5 {
+		t.Errorf("database got %+v", q)
+	}
+	flush()
+	telemetrytest.AssertAttributes(t, "Database Service Attempt", collector.Span(t, "Database Service Attempt").Attributes, map[string]string{
+		"app.encoding.request":    "protobuf",
+		"app.encoding.response":   "protobuf",
+		"http.request.body.size":  "*",
+		"http.response.body.size": "*",
+	})
+}
+
+func TestDatabaseCallBudget(t *testing.T) {
+	budgets := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/query" {
+			budgets <- r.Header.Get(httpx.HeaderBudget)
+		}
+		w.Write([]byte(`{"status":"success","data":{"result":"success"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	handler, collector, flush := newTestService(t, "-db-service-url="+srv.URL, "-payment-gateway-url="+srv.URL, "-auth-service-url="+srv.URL, "-request-timeout=2s")
+
+	if rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	budget, err := strconv.Atoi(<-budgets)
+	if err != nil || budget <= 0 || budget > 2000 {
+		t.Errorf("%s = %d (%v), want what is left of the 2s request timeout", httpx.HeaderBudget, budget, err)
+	}
+	attempt := collector.Span(t, "Database Service Attempt")
+	telemetrytest.AssertAttributes(t, "Database Service Attempt", attempt.Attributes, map[string]string{"app.budget.remaining_ms": "*"})
+}
+
+func TestCanaryRouting(t *testing.T) {
+	stable := fakeServer(t, http.StatusOK, `{"status":"success","data":{"result":"success"}}`)
+	canary := fakeServer(t, http.StatusInternalServerError, `{"status":"error","error":"canary build failed to plan the query"}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+stable, "-db-canary-url="+canary, "-db-canary-percent=100",
+		"-payment-gateway-url="+stable, "-auth-service-url="+stable)
+
+	if rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 from the broken canary", rec.Code)
+	}
+	flush()
+
+	call := collector.Span(t, "Database Service Call")
+	telemetrytest.AssertAttributes(t, "Database Service Call", call.Attributes, map[string]string{"sim.deploy.track": "canary"})
+	assertHistogramCount(t, collector, "db_backend_call_duration_seconds", map[string]string{"track": "canary", "status": "error"}, 1)
+	if points := collector.PointsNamed("db_backend_call_duration_seconds", map[string]string{"track": "stable"}); len(points) != 0 {
+		t.Errorf("stable calls recorded with every call routed to the canary: %+v", points)
+	}
+}
+
+func TestCanaryRollback(t *testing.T) {
+	stable := fakeServer(t, http.StatusOK, `{"status":"success","data":{"result":"success"}}`)
+	canary := fakeServer(t, http.StatusInternalServerError, `{"status":"error","error":"canary build failed to plan the query"}`)
+	verdict := fakeServer(t, http.StatusOK, `{"verdict":"fail","failed":["error_rate"]}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+stable, "-db-canary-url="+canary, "-db-canary-percent=100",
+		"-db-canary-verdict-url="+verdict, "-db-canary-verdict-poll=10ms", "-payment-gateway-url="+stable, "-auth-service-url="+stable)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"balance_check"}`).Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("calls still routed to the canary after a fail verdict")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	flush()
+
+	rollback := collector.Span(t, "Canary Rollback")
+	telemetrytest.AssertAttributes(t, "Canary Rollback", rollback.Attributes, map[string]string{"sim.deploy.track": "canary"})
+	assertCount(t, collector, "db_canary_rollbacks_total", map[string]string{"check": "error_rate"}, 1)
+}
+
+func TestHedgedBalanceRead(t *testing.T) {
+	// The first request stalls until the test ends, the hedge answers at once
+	var calls atomic.Int32
+	stall := make(chan struct{})
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-stall:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"balance":42}}`))
+	}))
+	defer db.Close()
+	defer close(stall)
+	other := fakeServer(t, http.StatusOK, `{}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db.URL, "-hedge-balance-reads", "-hedge-delay=20ms",
+		"-payment-gateway-url="+other, "-auth-service-url="+other)
+
+	if rec := serve(handler, http.MethodGet, "/api/user/user_1/balance", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	attempt := collector.Span(t, "Database Service Attempt")
+	telemetrytest.AssertAttributes(t, "Database Service Attempt", attempt.Attributes, map[string]string{
+		"app.hedge.delay_ms": "20",
+		"app.hedge.outcome":  "won",
+	})
+	if hedge := collector.Span(t, "Database Service Hedge"); hedge.ParentSpanID != attempt.SpanID || hedge.StatusCode != "unset" {
+		t.Errorf("hedge span parent %s status %s, want %s unset", hedge.ParentSpanID, hedge.StatusCode, attempt.SpanID)
+	}
+	assertCount(t, collector, "db_hedged_calls_total", map[string]string{"outcome": "won"}, 1)
+}
+
+func TestPriorityShedding(t *testing.T) {
+	// With two of four in flight a third is over the batch share only
+	shedder := newLoadShedder(4)
+	for range 2 {
+		shedder.admit(httpx.PriorityCritical)
+	}
+	for priority, admitted := range map[string]bool{httpx.PriorityBatch: false, httpx.PriorityNormal: true, httpx.PriorityCritical: true} {
+		got := shedder.admit(priority)
+		if got {
+			shedder.done()
+		}
+		if got != admitted {
+			t.Errorf("%s admitted = %v with 2 of 4 in flight, want %v", priority, got, admitted)
+		}
+	}
+
+	// With room for one request only critical ones get in
+	db := fakeServer(t, http.StatusOK, `{"status":"success","data":{"balance":42}}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-shed-max-in-flight=1",
+		"-payment-gateway-url="+db, "-auth-service-url="+db)
+	for priority, status := range map[string]int{"Batch": http.StatusServiceUnavailable, "critical": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/user_1/balance", nil)
+		req.Header.Set(httpx.HeaderPriority, priority)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != status {
+			t.Errorf("%s status = %d, want %d", priority, rec.Code, status)
+		}
+	}
+	flush()
+
+	shed := 0
+	for _, span := range collector.SpansNamed("core-api-service") {
+		if span.Attributes["app.request.shed"] == "true" {
+			shed++
+			telemetrytest.AssertAttributes(t, "shed server span", span.Attributes, map[string]string{"app.request.priority": "batch"})
+		}
+	}
+	if shed != 1 {
+		t.Errorf("%d server spans marked shed, want 1", shed)
+	}
+	assertCount(t, collector, "api_priority_requests_total", map[string]string{"priority": "batch", "outcome": "shed"}, 1)
+	assertCount(t, collector, "api_priority_requests_total", map[string]string{"priority": "critical", "outcome": "admitted"}, 1)
+	assertHistogramCount(t, collector, "api_priority_request_duration_seconds", map[string]string{"priority": "critical"}, 1)
+}
+
+func TestResponseSchemaValidation(t *testing.T) {
+	schema, err := loadResponseSchema("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := map[string]interface{}{
+		"status": "success", "query_time_ms": 1.5, "timestamp": 1792040028.0,
+		"data": map[string]interface{}{"user_id": "user_1", "balance": 120.5, "currency": "USD"},
+	}
+	if vs := schema.validate(TransactionRequest{UserID: "user_1", Operation: "get_balance"}, valid); len(vs) != 0 {
+		t.Errorf("valid get_balance response: %v", vs)
+	}
+	write := map[string]interface{}{
+		"status": "success", "query_time_ms": 1.5, "timestamp": 1792040028.0,
+		"data": map[string]interface{}{"user_id": "user_7", "affected_rows": 0.0},
+	}
+	vs := schema.validate(TransactionRequest{UserID: "user_1", Operation: "deposit"}, write)
+	var got []string
+	for _, v := range vs {
+		got = append(got, v.Path+" "+v.Keyword)
+	}
+	if want := []string{"data required", "data.affected_rows minimum", "data.user_id user_id"}; !slices.Equal(got, want) {
+		t.Errorf("deposit violations = %v, want %v", got, want)
+	}
+
+	// A corrupted answer is still served, and its violations are recorded
+	db := fakeServer(t, http.StatusOK, `{"status":"success","query_time_ms":1,"timestamp":1792040028,"data":{"user_id":"user_1","balance":-42,"currency":"EUR"}}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+db, "-auth-service-url="+db)
+	if rec := serve(handler, http.MethodGet, "/api/user/user_1/balance", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	call := collector.Span(t, "Database Service Call")
+	telemetrytest.AssertAttributes(t, "Database Service Call", call.Attributes, map[string]string{"app.response.schema_violations": "2"})
+	assertEvents(t, call, "schema.violation", "schema.violation")
+	telemetrytest.AssertAttributes(t, "schema.violation", call.Events[1].Attributes, map[string]string{
+		"schema.path":    "data.currency",
+		"schema.keyword": "enum",
+		"schema.message": `"EUR" is not one of ["USD"]`,
+	})
+	assertCount(t, collector, "db_response_schema_checks_total", map[string]string{"operation": "get_balance", "result": "invalid"}, 1)
+	assertCount(t, collector, "db_response_schema_violations_total", map[string]string{"path": "data.balance", "keyword": "minimum"}, 1)
+	if logs := collector.LogsWithBody("Database response violates its schema"); len(logs) != 1 || logs[0].Severity != "warn" {
+		t.Errorf("got %d schema violation logs %+v, want one warning", len(logs), logs)
+	}
+}
+
+func TestBalanceCache(t *testing.T) {
+	// Balance reads wait until released, so concurrent ones overlap
+	var reads atomic.Int32
+	release := make(chan struct{})
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TransactionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Operation == "get_balance" {
+			reads.Add(1)
+			<-release
+		}
+		w.Write([]byte(`{"status":"success","data":{"user_id":"user_1","balance":42}}`))
+	}))
+	defer db.Close()
+	payments := fakeServer(t, http.StatusOK, `{"payment_id":"pay_1","status":"authorized","network":"visa"}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db.URL, "-balance-cache-ttl=1m",
+		"-payment-gateway-url="+payments, "-auth-service-url="+payments)
+
+	// Five concurrent misses share one database read
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if rec := serve(handler, http.MethodGet, "/api/user/user_1/balance", ""); rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := reads.Load(); n != 1 {
+		t.Fatalf("%d database reads for 5 concurrent misses, want 1", n)
+	}
+
+	// A fresh entry answers, a write drops it and an outage bypasses the cache
+	serve(handler, http.MethodGet, "/api/user/user_1/balance", "")
+	if rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_1","amount":5,"operation":"deposit"}`); rec.Code != http.StatusOK {
+		t.Fatalf("deposit status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	serve(handler, http.MethodGet, "/api/user/user_1/balance", "")
+	cacheOutage.Store(true)
+	defer cacheOutage.Store(false)
+	serve(handler, http.MethodGet, "/api/user/user_1/balance", "")
+	if n := reads.Load(); n != 3 {
+		t.Errorf("%d database reads, want 3", n)
+	}
+	flush()
+
+	for result, want := range map[string]float64{"miss": 2, "coalesced": 4, "hit": 1, "disabled": 1} {
+		assertCount(t, collector, "api_balance_cache_requests_total", map[string]string{"result": result}, want)
+	}
+	loads := collector.SpansNamed("Balance Cache Load")
+	if len(loads) != 2 {
+		t.Fatalf("%d Balance Cache Load spans, want 2", len(loads))
+	}
+	results := map[string]int{}
+	for _, span := range collector.SpansNamed("Get User Balance") {
+		results[span.Attributes["app.cache.result"]]++
+	}
+	if want := map[string]int{"miss": 2, "coalesced": 4, "hit": 1, "disabled": 1}; !maps.Equal(results, want) {
+		t.Errorf("app.cache.result of the balance spans = %v, want %v", results, want)
+	}
+}
+
+func TestDatabaseBulkhead(t *testing.T) {
+	// The first read holds the only slot until the second has been rejected
+	started, release := make(chan struct{}), make(chan struct{})
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte(`{"status":"success","data":{"user_id":"user_1","balance":42}}`))
+	}))
+	defer db.Close()
+	other := fakeServer(t, http.StatusOK, `{}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db.URL, "-bulkhead-db-size=1", "-bulkhead-max-wait=0",
+		"-balance-cache-ttl=0", "-payment-gateway-url="+other, "-auth-service-url="+other)
+
+	done := make(chan int)
+	go func() { done <- serve(handler, http.MethodGet, "/api/user/user_1/balance", "").Code }()
+	<-started
+	rec := serve(handler, http.MethodGet, "/api/user/user_2/balance", "")
+	close(release)
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("first read status = %d, want 200", status)
+	}
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("second read status = %d Retry-After %q, want 503 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	flush()
+
+	var rejected *telemetrytest.Span
+	for _, span := range collector.SpansNamed("Database Service Call") {
+		if span.Attributes["app.bulkhead.rejected"] == "true" {
+			rejected = &span
+		}
+	}
+	if rejected == nil {
+		t.Fatal("no Database Service Call span marked app.bulkhead.rejected")
+	}
+	telemetrytest.AssertAttributes(t, "rejected call", rejected.Attributes, map[string]string{"app.bulkhead.dependency": "database"})
+	assertEvents(t, *rejected, "bulkhead.rejected")
+	assertCount(t, collector, "api_bulkhead_rejections_total", map[string]string{"dependency": "database"}, 1)
+}
+
+func TestShadowMirroring(t *testing.T) {
+	primary := fakeServer(t, http.StatusOK, `{"status":"success","query_time_ms":3,"data":{"user_id":"user_1","balance":42,"currency":"USD"}}`)
+	mirrored := make(chan struct{}, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","query_time_ms":9,"data":{"user_id":"user_1","balance":40.5}}`))
+		mirrored <- struct{}{}
+	}))
+	defer shadow.Close()
+	handler, collector, flush := newTestService(t, "-db-service-url="+primary, "-db-shadow-url="+shadow.URL, "-db-shadow-percent=100",
+		"-balance-cache-ttl=0", "-payment-gateway-url="+primary, "-auth-service-url="+primary)
+
+	rec := serve(handler, http.MethodGet, "/api/user/user_1/balance", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"balance":42`) {
+		t.Fatalf("status %d body %s, want the primary's balance", rec.Code, rec.Body)
+	}
+	select {
+	case <-mirrored:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the call was not mirrored to the shadow")
+	}
+	// The comparison runs after the shadow has answered
+	time.Sleep(50 * time.Millisecond)
+	flush()
+
+	span := collector.Span(t, "Database Shadow Call")
+	telemetrytest.AssertAttributes(t, "Database Shadow Call", span.Attributes, map[string]string{
+		"app.shadow.result":      "diverged",
+		"app.shadow.divergences": "2",
+	})
+	if call := collector.Span(t, "Database Service Call"); span.ParentSpanID != call.SpanID {
+		t.Errorf("shadow span parent %s, want the database call %s", span.ParentSpanID, call.SpanID)
+	}
+	var fields []string
+	for _, e := range span.Events {
+		fields = append(fields, e.Attributes["shadow.field"])
+	}
+	if want := []string{"data.balance", "data.currency"}; !slices.Equal(fields, want) {
+		t.Errorf("divergence events on %v, want %v", fields, want)
+	}
+	assertCount(t, collector, "db_shadow_calls_total", map[string]string{"operation": "get_balance", "result": "diverged"}, 1)
+	assertCount(t, collector, "db_shadow_divergences_total", map[string]string{"operation": "get_balance", "field": "data.balance"}, 1)
+}
+
+func TestDebugTraceSampling(t *testing.T) {
+	baggage := make(chan string, 10)
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		baggage <- r.Header.Get("baggage")
+		w.Write([]byte(`{"status":"success","data":{"user_id":"user_1","balance":42}}`))
+	}))
+	defer db.Close()
+	payments := fakeServer(t, http.StatusOK, `{"payment_id":"pay_1","status":"authorized","network":"visa"}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db.URL, "-trace-sample-ratio=0", "-debug-trace-users=user_debug",
+		"-balance-cache-ttl=0", "-payment-gateway-url="+payments, "-auth-service-url="+payments)
+
+	// Dropped by the ratio, then forced by the header and by the user, in the
+	// path and in the body
+	serve(handler, http.MethodGet, "/api/user/user_1/balance", "")
+	<-baggage
+	req := httptest.NewRequest(http.MethodGet, "/api/user/user_1/balance", nil)
+	req.Header.Set("X-Debug-Trace", "1")
+	req.Header.Set("Cookie", "session=secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	serve(handler, http.MethodGet, "/api/user/user_debug/balance", "")
+	rec := serve(handler, http.MethodPost, "/api/transaction", `{"user_id":"user_debug","amount":5,"operation":"deposit"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("deposit status = %d, want 200; body %s; the peeked body must reach the handler", rec.Code, rec.Body)
+	}
+	for range 3 {
+		if b := <-baggage; !strings.Contains(b, "debug.trace=1") {
+			t.Errorf("database call baggage %q, want the debug mark", b)
+		}
+	}
+	flush()
+
+	var reasons []string
+	for _, span := range collector.SpansNamed("Database Service Call") {
+		reasons = append(reasons, span.Attributes["app.debug.trace"])
+	}
+	if want := []string{"header", "user", "user"}; !slices.Equal(reasons, want) {
+		t.Errorf("sampled database calls debugged by %v, want %v", reasons, want)
+	}
+	for _, span := range collector.Spans() {
+		if span.Kind != "server" || span.Attributes["app.debug.trace"] != "header" {
+			continue
+		}
+		if _, ok := span.Attributes["http.request.header.cookie"]; ok {
+			t.Errorf("server span recorded the Cookie header")
+		}
+		if span.Attributes["http.request.header.x-debug-trace"] == "" {
+			t.Errorf("server span attributes %v, want the request headers", span.Attributes)
+		}
+	}
+}
+
+func TestLogLevelEndpoint(t *testing.T) {
+	handler, _, _ := newTestService(t)
+	defer logx.SetLevel("info")
+
+	if rec := serve(handler, http.MethodPut, "/debug/loglevel", `{"level":"loud"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown level status = %d, want 400", rec.Code)
+	}
+	rec := serve(handler, http.MethodPut, "/debug/loglevel", `{"level":"debug"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"previous":"info"`) {
+		t.Fatalf("status %d body %s, want the change from info", rec.Code, rec.Body)
+	}
+	if rec := serve(handler, http.MethodGet, "/debug/loglevel", ""); !strings.Contains(rec.Body.String(), `"level":"debug"`) {
+		t.Errorf("GET answered %s, want debug", rec.Body)
+	}
+	if rec := serve(handler, http.MethodGet, "/debug/audit?action=log_level.set", ""); !strings.Contains(rec.Body.String(), `"log.level":"debug"`) {
+		t.Errorf("audit trail %s, want the change", rec.Body)
+	}
+}
+
+func TestBalanceFallbackTelemetry(t *testing.T) {
+	db := sequenceServer(t, `{"user_id":"user_1","balance":120}`, http.StatusOK, http.StatusInternalServerError)
+	// Without the balance cache the second read reaches the failing database
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+db, "-auth-service-url="+db, "-balance-cache-ttl=0")
+
+	if rec := serve(handler, http.MethodGet, "/api/user/user_1/balance", ""); rec.Code != http.StatusOK {
+		t.Fatalf("first read status = %d, want 200", rec.Code)
+	}
+	rec := serve(handler, http.MethodGet, "/api/user/user_1/balance", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"stale":true`) || !strings.Contains(rec.Body.String(), `"balance":120`) {
+		t.Fatalf("fallback read status %d body %s, want the last balance marked stale", rec.Code, rec.Body)
+	}
+	if rec := serve(handler, http.MethodGet, "/api/user/user_2/balance", ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("read without a last balance status = %d, want 500", rec.Code)
+	}
+	flush()
+
+	fallback := collector.Span(t, "Balance Fallback")
+	telemetrytest.AssertAttributes(t, "Balance Fallback", fallback.Attributes, map[string]string{"app.fallback.reason": "database_error"})
+	var failed *telemetrytest.Span
+	for _, span := range collector.SpansNamed("Database Service Attempt") {
+		if span.TraceID == fallback.TraceID {
+			failed = &span
+		}
+	}
+	if failed == nil || failed.StatusCode != "error" {
+		t.Fatalf("no failed attempt in the fallback's trace: %+v", failed)
+	}
+	if len(fallback.Links) != 1 || fallback.Links[0].SpanID != failed.SpanID {
+		t.Fatalf("fallback links %+v, want one to the failed attempt %s", fallback.Links, failed.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "fallback link", fallback.Links[0].Attributes, map[string]string{"app.link.kind": "fallback", "app.fallback.reason": "database_error"})
+	assertCount(t, collector, "api_fallbacks_total", map[string]string{"fallback": "last_balance", "reason": "database_error"}, 1)
+}
+
+func TestHealthTelemetry(t *testing.T) {
+	db := fakeServer(t, http.StatusServiceUnavailable, `{"status":"unhealthy"}`)
+	payments := fakeServer(t, http.StatusOK, `{"status":"healthy"}`)
+	handler, collector, flush := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+payments, "-auth-service-url="+db)
+
+	rec := serve(handler, http.MethodGet, "/api/health", "")
+	if !strings.Contains(rec.Body.String(), `"status":"degraded"`) {
+		t.Errorf("health body %s, want status degraded", rec.Body)
+	}
+	flush()
+
+	span := collector.Span(t, "Health Check")
+	if span.StatusCode != "error" || span.StatusMessage != "database service unhealthy" {
+		t.Errorf("Health Check status %s %q, want error \"database service unhealthy\"", span.StatusCode, span.StatusMessage)
+	}
+}
+
+// The typed client reads every answer of the real handler
+func TestClientContract(t *testing.T) {
+	db := fakeServer(t, http.StatusOK, `{"status":"success","data":{"user_id":"user_1","balance":120.5,"available_balance":120.5,"currency":"USD"}}`)
+	payments := fakeServer(t, http.StatusOK, `{"payment_id":"pay_1","status":"authorized","network":"visa"}`)
+	handler, _, _ := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+payments, "-auth-service-url="+db)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	api := apiclient.New(srv.URL, apiclient.WithRetries(1, 0))
+	ctx := context.Background()
+
+	tx, err := api.CreateTransaction(ctx, apiclient.TransactionRequest{UserID: "user_1", Amount: 50, Operation: apiclient.OperationDeposit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != "success" || tx.TransactionID == "" || tx.Payment == nil || tx.Payment.PaymentID != "pay_1" {
+		t.Errorf("transaction read as %+v", tx)
+	}
+
+	_, err = api.CreateTransaction(ctx, apiclient.TransactionRequest{UserID: "user_1", Amount: -5, Operation: apiclient.OperationDeposit})
+	var apiErr *apiclient.Error
+	if !errors.As(err, &apiErr) || apiErr.Kind != apiclient.KindValidation || len(apiErr.Fields) != 1 || apiErr.ErrorID == "" {
+		t.Errorf("invalid transaction answered %#v", err)
+	}
+
+	batch, err := api.CreateBatch(ctx, []apiclient.TransactionRequest{{UserID: "user_1", Amount: 5, Operation: apiclient.OperationDeposit}})
+	if err != nil || batch.Status != "success" || batch.Succeeded != 1 {
+		t.Errorf("batch read as %+v, %v", batch, err)
+	}
+
+	balance, err := api.GetBalance(ctx, "user_1")
+	if err != nil || balance.Balance != 120.5 || balance.Currency != "USD" || balance.Stale {
+		t.Errorf("balance read as %+v, %v", balance, err)
+	}
+
+	health, err := api.Health(ctx)
+	if err != nil || health.Status != "healthy" || !health.DatabaseHealthy {
+		t.Errorf("health read as %+v, %v", health, err)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	db := fakeServer(t, http.StatusOK, `{}`)
+	handler, _, _ := newTestService(t, "-db-service-url="+db, "-payment-gateway-url="+db, "-auth-service-url="+db)
+
+	rec := serve(handler, http.MethodGet, "/openapi.json", "")
+	var doc struct {
+		Paths      map[string]map[string]struct{ OperationID string }
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string
+				Properties map[string]map[string]any
+			}
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("openapi.json: %v; body %s", err, rec.Body)
+	}
+	for path, method := range map[string]string{
+		"/api/transaction":        "post",
+		"/api/transactions/batch": "post",
+		"/api/user/{id}/balance":  "get",
+		"/api/health":             "get",
+	} {
+		if doc.Paths[path][method].OperationID == "" {
+			t.Errorf("%s %s is not documented", method, path)
+		}
+	}
+	// The schema and validateTransaction agree on what a user ID is
+	request := doc.Components.Schemas["TransactionRequest"]
+	if !slices.Equal(request.Required, []string{"user_id", "amount", "operation"}) || request.Properties["user_id"]["pattern"] != userIDPattern.String() {
+		t.Errorf("TransactionRequest schema %+v", request)
+	}
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	var dbCalls atomic.Int32
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dbCalls.Add(1)
+		w.Write([]byte(`{"status":"success","data":{"result":"success"}}`))
+	}))
+	defer db.Close()
+	payments := fakeServer(t, http.StatusOK, `{"payment_id":"pay_1","status":"authorized","network":"visa"}`)
+	body := `{"user_id":"user_1","amount":50,"operation":"deposit","memo":"rent"}`
+
+	// Fields the API does not know are ignored unless the schema is enforced
+	handler, _, _ := newTestService(t, "-db-service-url="+db.URL, "-payment-gateway-url="+payments, "-auth-service-url="+db.URL)
+	if rec := serve(handler, http.MethodPost, "/api/transaction", body); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d without validation, want 200; body %s", rec.Code, rec.Body)
+	}
+
+	handler, collector, flush := newTestService(t, "-db-service-url="+db.URL, "-payment-gateway-url="+payments, "-auth-service-url="+db.URL, "-openapi-validation")
+	dbCalls.Store(0)
+	rec := serve(handler, http.MethodPost, "/api/transaction", body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"memo"`) {
+		t.Fatalf("status = %d, want 400 naming memo; body %s", rec.Code, rec.Body)
+	}
+	if rec := serve(handler, http.MethodPost, "/api/transactions/batch", `{"transactions":[{"user_id":"user_1","amount":0,"operation":"deposit"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("batch status = %d, want 400; body %s", rec.Code, rec.Body)
+	}
+	if n := dbCalls.Load(); n != 0 {
+		t.Errorf("rejected requests made %d database calls", n)
+	}
+	flush()
+
+	server := collector.SpansNamed("core-api-service")[0]
+	if server.StatusCode != "unset" {
+		t.Errorf("server span status %s, want unset for a 400", server.StatusCode)
+	}
+	telemetrytest.AssertAttributes(t, "server span", server.Attributes, map[string]string{"app.request.schema_violations": "1"})
+	assertEvents(t, server, "openapi.violation")
+	assertCount(t, collector, "api_validation_errors_total", map[string]string{"field": "memo"}, 1)
+	assertCount(t, collector, "api_validation_errors_total", map[string]string{"field": "transactions[].amount"}, 1)
+	assertCount(t, collector, "api_errors_total", map[string]string{"error_type": "schema_violation"}, 2)
+}
+
+func assertEvents(t *testing.T, span telemetrytest.Span, names ...string) {
+	t.Helper()
+	got := make([]string, len(span.Events))
+	for i, e := range span.Events {
+		got[i] = e.Name
+	}
+	if strings.Join(got, ",") != strings.Join(names, ",") {
+		t.Errorf("%s events = %v, want %v", span.Name, got, names)
+	}
+}
+
+func assertCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want float64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Value != want {
+		t.Errorf("%s%v points = %+v, want one of %g", name, attrs, points, want)
+	}
+}
+
+func assertHistogramCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want uint64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Count != want {
+		t.Errorf("%s%v points = %+v, want one with count %d", name, attrs, points, want)
+	}
+}
@@ -3,145 +3,261 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"maps"
+	"net"
 	"net/http"
-	"os"
+	"slices"
 	"time"
 
-	"github.com/joho/godotenv"
-	"github.com/sirupsen/logrus"
-	"go.opentelemetry.io/contrib/bridges/otellogrus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/propagation"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/chaos"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/costing"
+	"incident-simulation/pkg/dbproto"
+	"incident-simulation/pkg/deploy"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/jwt"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/probes"
+	"incident-simulation/pkg/profiling"
+	"incident-simulation/pkg/replay"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
 )
 
 type TransactionRequest struct {
-	UserID    string  `json:"user_id"`
-	Amount    float64 `json:"amount"`
-	Operation string  `json:"operation"`
+	UserID    string  `json:"user_id" pattern:"^user_[A-Za-z0-9_-]{1,64}$"`
+	Amount    float64 `json:"amount" exclusiveMinimum:"0"`
+	Operation string  `json:"operation" enum:"transfer,deposit,withdrawal,balance_check"`
+	// ToUserID is the recipient of a transfer
+	ToUserID string `json:"to_user_id,omitempty" pattern:"^user_[A-Za-z0-9_-]{1,64}$" doc:"Recipient of a transfer, another user"`
 }
 
 type TransactionResponse struct {
-	TransactionID string      `json:"transaction_id"`
-	Status        string      `json:"status"`
-	Timestamp     int64       `json:"timestamp"`
-	Data          interface{} `json:"data,omitempty"`
-	Error         string      `json:"error,omitempty"`
+	TransactionID string           `json:"transaction_id"`
+	Status        string           `json:"status"`
+	Timestamp     int64            `json:"timestamp"`
+	Data          interface{}      `json:"data,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	Fields        []FieldError     `json:"fields,omitempty"`
+	Payment       *paymentResponse `json:"payment,omitempty"`
+	httpx.ErrorRef
+}
+
+type HealthResponse struct {
+	Status          string `json:"status" enum:"healthy,degraded"`
+	DatabaseHealthy bool   `json:"database_healthy"`
+	PaymentHealthy  bool   `json:"payment_healthy"`
+	Timestamp       int64  `json:"timestamp"`
 }
 
 // Metrics
 var (
-	transactionCounter metric.Int64Counter
-	errorCounter       metric.Int64Counter
-	responseTime       metric.Float64Histogram
-	dbCallDuration     metric.Float64Histogram
+	transactionCounter     metric.Int64Counter
+	errorCounter           metric.Int64Counter
+	validationErrorCounter metric.Int64Counter
+	idempotentCounter      metric.Int64Counter
+	fallbackCounter        metric.Int64Counter
+	rateLimitedCounter     metric.Int64Counter
+	priorityRequests       metric.Int64Counter
+	priorityDuration       metric.Float64Histogram
+	responseTime           metric.Float64Histogram
+	dbCallDuration         metric.Float64Histogram
+	dbBackendCallDuration  metric.Float64Histogram
+	dbCallRetries          metric.Int64Counter
+	canaryRollbacks        metric.Int64Counter
+	hedgeOutcomes          metric.Int64Counter
+	schemaChecks           metric.Int64Counter
+	schemaViolations       metric.Int64Counter
+	cacheRequests          metric.Int64Counter
+	bulkheadRejections     metric.Int64Counter
+	shadowCalls            metric.Int64Counter
+	shadowDivergences      metric.Int64Counter
+	shadowCallDuration     metric.Float64Histogram
+	paymentCallDuration    metric.Float64Histogram
+	authFailureCounter     metric.Int64Counter
+	batchSize              metric.Int64Histogram
+	transferOutcomes       metric.Int64Counter
+)
+
+// Attribute sets of every transaction, built once for the allowed operations
+var (
+	transactionOperations = slices.Sorted(maps.Keys(allowedOperations))
+
+	responseTimeAttrs = telemetry.NewMeasurements([]string{http.MethodGet, http.MethodPost}, func(method string) telemetry.Measurement {
+		return telemetry.NewMeasurement(
+			attribute.String("service", "core-api"),
+			attribute.String("operation", "transaction"),
+			attribute.String("method", method),
+		)
+	})
+	paymentCallAttrs = telemetry.NewMeasurements(transactionOperations, func(op string) telemetry.Measurement {
+		return telemetry.NewMeasurement(attribute.String("operation", op))
+	})
+	dbCallAttrs = telemetry.NewMeasurements(transactionOperations, func(op string) telemetry.Measurement {
+		return telemetry.NewMeasurement(attribute.String("db_operation", op))
+	})
+	transactionSuccessAttrs = telemetry.NewMeasurements(transactionOperations, func(op string) telemetry.Measurement {
+		return telemetry.NewMeasurement(attribute.String("status", "success"), attribute.String("operation", op))
+	})
 )
 
 func main() {
 	ctx := context.Background()
 
+	// Load configuration (flags > env > .env > YAML > defaults)
+	var cfg Config
+	config.MustLoad(&cfg)
+	log.Println("⚙️  Core API Service configuration:")
+	config.Print(log.Writer(), &cfg)
+
+	// Seeded runs replay the same simulator decisions
+	if cfg.SimSeed != 0 {
+		simrand.Seed(cfg.SimSeed)
+	}
+
+	// In-memory buffer of recent spans and logs for /debug/telemetry/recent
+	recorder := telemetry.NewRecorder("core-api-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	// Export outcomes for /debug/otel
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	// Per-minute latency histograms and error counts for /debug/latency-heatmap and /debug/export
+	heatmap := telemetry.NewHeatmap("core-api-service", cfg.LatencyHeatmapMinutes)
+
+	// Simulated rollouts of new versions, some of them bad
+	deploys := deploy.New("core-api-service", cfg.Deploy, &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   5 * time.Second,
+	}, logDeployment)
+
 	// Initialize OpenTelemetry
-	shutdown := initOpenTelemetry(ctx, "core-api-service")
+	shutdown := initOpenTelemetry(ctx, "core-api-service", cfg.Telemetry, recorder, health, heatmap, deploys.SpanProcessor())
 	defer shutdown()
 
+	// Optional pprof endpoints and continuous profiling
+	stopProfiling := profiling.Start("core-api-service", cfg.Profiling, "localhost:6060")
+	defer stopProfiling()
+
+	// Audit trail of incidents, deployments and admin actions
+	if err := audit.Setup("core-api-service", cfg.AuditLogFile, cfg.AuditLogKeep); err != nil {
+		log.Fatalf("Invalid audit log: %v", err)
+	}
+	defer audit.Close()
+
 	// Initialize metrics
 	initMetrics(ctx)
-
-	// Get database service URL from environment
-	dbServiceURL := os.Getenv("DB_SERVICE_URL")
-	if dbServiceURL == "" {
-		dbServiceURL = "http://127.0.0.1:8081"
+	if err := buildinfo.RegisterMetric("core-api-service"); err != nil {
+		logx.Errorw(ctx, "Failed to create build info gauge", "error", err)
 	}
+	if cfg.SimLabelSpans {
+		if err := telemetry.LabelIncidents(func() (bool, string) {
+			if _, bad := deploys.Current(); bad {
+				return true, "bad_deploy"
+			}
+			if cacheOutage.Load() {
+				return true, "cache_disabled"
+			}
+			return false, "none"
+		}); err != nil {
+			logx.Errorw(ctx, "Failed to label spans with the active incident", "error", err)
+		}
+	}
+	if err := deploys.RegisterMetrics(); err != nil {
+		logx.Errorw(ctx, "Failed to create deployment metrics", "error", err)
+	}
+	go deploys.Run(ctx)
 
 	// Start API service
-	startCoreService(dbServiceURL)
+	startCoreService(cfg, recorder, health, heatmap, deploys)
 }
 
-func initOpenTelemetry(ctx context.Context, serviceName string) func() {
-	// Resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(serviceName),
-			semconv.ServiceVersionKey.String("1.0.0"),
-			semconv.DeploymentEnvironmentKey.String("development"),
-		))
+func initOpenTelemetry(ctx context.Context, serviceName string, cfg config.Telemetry, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap, versions trace.SpanProcessor) func() {
+	// Resource with service information; OTEL_RESOURCE_ATTRIBUTES overrides it
+	res, err := telemetry.NewResource(ctx, serviceName)
 	if err != nil {
 		log.Fatalf("Failed to create resource: %v", err)
 	}
 
-	// OTLP endpoint from environment or default
-	// Import .env file
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using default OTLP endpoint")
-	}
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		otlpEndpoint = "localhost:4318"
+	// OTLP (endpoint, TLS, headers) or stdout/file exporters
+	exporters, err := telemetry.NewExporters(cfg.OTLP, cfg.Output)
+	if err != nil {
+		log.Fatalf("Invalid telemetry exporter settings: %v", err)
 	}
 
-	// OTLP HTTP trace exporter
-	traceExporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint(otlpEndpoint),
-		otlptracehttp.WithInsecure(),
-	)
+	// Trace exporter
+	traceExporter, err := exporters.Trace(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create trace exporter: %v", err)
 	}
 
+	// Batch span processor whose queue /debug/otel reports
+	spans := telemetry.NewBatchSpanProcessor(health.Spans(traceExporter), cfg.Batching)
+	health.TrackQueue(spans)
+
+	// Personal data is scrubbed before spans and log records are exported or buffered
+	scrubber := telemetry.NewScrubber(cfg.Scrubbing)
+
 	// Trace provider
 	tp := trace.NewTracerProvider(
-		trace.WithBatcher(traceExporter),
+		// Stamps spans first so the exported ones carry the deployed version
+		trace.WithSpanProcessor(versions),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(spans)),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(recorder)),
 		trace.WithResource(res),
-		trace.WithSampler(trace.AlwaysSample()),
+		// Ratio sampling, overridden for debug requests
+		trace.WithSampler(telemetry.NewSampler(cfg.Sampling)),
 	)
 	otel.SetTracerProvider(tp)
 
-	// OTLP HTTP metric exporter
-	metricExporter, err := otlpmetrichttp.New(ctx,
-		otlpmetrichttp.WithEndpoint(otlpEndpoint),
-		otlpmetrichttp.WithInsecure(),
-	)
+	// Metric exporter
+	metricExporter, err := exporters.Metric(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create metric exporter: %v", err)
 	}
 
 	// Metric provider
+	views, err := telemetry.ParseViewConfig(cfg.MetricViewBuckets, cfg.MetricViewDropAttributes)
+	if err != nil {
+		log.Fatalf("Invalid metric views: %v", err)
+	}
 	mp := sdkmetric.NewMeterProvider(
 		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter,
-			sdkmetric.WithInterval(5*time.Second))),
+		sdkmetric.WithView(telemetry.View(views)),
+		sdkmetric.WithReader(telemetry.NewPeriodicReader(heatmap.Metrics(health.Metrics(metricExporter)), cfg.Batching)),
 	)
-	otel.SetMeterProvider(mp)
+	// Caps the attribute sets of every counter and histogram the service creates
+	otel.SetMeterProvider(telemetry.GuardCardinality(mp, cfg.MetricCardinalityLimit, views))
 
 	// Log Provider
-	exporter, err := otlploghttp.New(ctx,
-		otlploghttp.WithEndpoint(otlpEndpoint), // Collector endpoint
-		otlploghttp.WithInsecure(),             // Use HTTP (not HTTPS)
-	)
+	exporter, err := exporters.Log(ctx)
 	if err != nil {
-		log.Fatalf("failed to create OTLP log exporter: %v", err)
+		log.Fatalf("failed to create log exporter: %v", err)
 	}
 
 	// Set up the LoggerProvider with a batch processor
 	provider := sdklog.NewLoggerProvider(
-		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(scrubber.LogProcessor()),
+		sdklog.WithProcessor(telemetry.NewBatchLogProcessor(health.Logs(exporter), cfg.Batching)),
+		sdklog.WithProcessor(recorder),
 	)
 	if provider == nil {
 		log.Fatalf("failed to create LoggerProvider")
@@ -151,24 +267,31 @@ func initOpenTelemetry(ctx context.Context, serviceName string) func() {
 	// Set the global logger provider
 	global.SetLoggerProvider(provider)
 
-	// Set up Logrus and bridge it to OpenTelemetry
-	hook := otellogrus.NewHook("database-service", otellogrus.WithLoggerProvider(provider))
-	logrus.AddHook(hook)
+	// Bridge logrus to OpenTelemetry; logx adds service and trace fields
+	logx.Setup(serviceName, provider)
+	if _, err := logx.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
 
-	// Text map propagator
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// Text map propagators from OTEL_PROPAGATORS
+	propagator, err := telemetry.NewPropagator(cfg.Propagators)
+	if err != nil {
+		log.Fatalf("Invalid propagator settings: %v", err)
+	}
+	otel.SetTextMapPropagator(propagator)
 
 	return func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := tp.Shutdown(ctx); err != nil {
-			logrus.WithContext(ctx).Error("Error shutting down tracer provider: %v", err)
+			logx.Errorw(ctx, "Error shutting down tracer provider", "error", err)
 		}
 		if err := mp.Shutdown(ctx); err != nil {
-			logrus.WithContext(ctx).Error("Error shutting down meter provider: %v", err)
+			logx.Errorw(ctx, "Error shutting down meter provider", "error", err)
 		}
 		// defer provider.Shutdown(ctx) // Uncomment this line if you want to shutdown the provider gracefully
 		provider.Shutdown(ctx)
+		exporters.Close()
 	}
 }
 
@@ -179,150 +302,480 @@ func initMetrics(ctx context.Context) {
 	transactionCounter, err = meter.Int64Counter("api_transactions_total",
 		metric.WithDescription("Total number of API transactions processed"))
 	if err != nil {
-		logrus.WithContext(ctx).Error("Failed to create transaction counter: %v", err)
+		logx.Errorw(ctx, "Failed to create transaction counter", "error", err)
 	}
 
 	errorCounter, err = meter.Int64Counter("api_errors_total",
 		metric.WithDescription("Total number of API errors encountered"))
 	if err != nil {
-		logrus.WithContext(ctx).Error("Failed to create error counter: %v", err)
+		logx.Errorw(ctx, "Failed to create error counter", "error", err)
+	}
+
+	validationErrorCounter, err = meter.Int64Counter("api_validation_errors_total",
+		metric.WithDescription("Total number of request validation errors by field"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create validation error counter", "error", err)
+	}
+
+	idempotentCounter, err = meter.Int64Counter("api_idempotent_replays_total",
+		metric.WithDescription("Total number of transactions answered from the idempotency cache"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create idempotent replay counter", "error", err)
+	}
+
+	fallbackCounter, err = meter.Int64Counter("api_fallbacks_total",
+		metric.WithDescription("Total number of requests answered from a fallback instead of a failing dependency"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create fallback counter", "error", err)
+	}
+
+	rateLimitedCounter, err = meter.Int64Counter("api_rate_limited_total",
+		metric.WithDescription("Total number of requests rejected by the rate limiter"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create rate limited counter", "error", err)
+	}
+
+	authFailureCounter, err = meter.Int64Counter("api_auth_failures_total",
+		metric.WithDescription("Total number of requests rejected by token verification"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create auth failure counter", "error", err)
+	}
+
+	priorityRequests, err = meter.Int64Counter("api_priority_requests_total",
+		metric.WithDescription("API requests by X-Priority class and whether load shedding admitted or shed them"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create priority request counter", "error", err)
+	}
+
+	priorityDuration, err = meter.Float64Histogram("api_priority_request_duration_seconds",
+		metric.WithDescription("Duration of admitted API requests in seconds by X-Priority class"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create priority request duration histogram", "error", err)
 	}
 
 	responseTime, err = meter.Float64Histogram("api_response_time_seconds",
 		metric.WithDescription("API response time in seconds"))
 	if err != nil {
-		logrus.WithContext(ctx).Error("Failed to create response time histogram: %v", err)
+		logx.Errorw(ctx, "Failed to create response time histogram", "error", err)
 	}
 
 	dbCallDuration, err = meter.Float64Histogram("db_call_duration_seconds",
 		metric.WithDescription("Database service call duration in seconds"))
 	if err != nil {
-		logrus.WithContext(ctx).Error("Failed to create db call duration histogram: %v", err)
+		logx.Errorw(ctx, "Failed to create db call duration histogram", "error", err)
+	}
+
+	dbBackendCallDuration, err = meter.Float64Histogram("db_backend_call_duration_seconds",
+		metric.WithDescription("Database service calls in seconds, retries included, by the track of the version they were routed to and status"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create db backend call duration histogram", "error", err)
+	}
+
+	dbCallRetries, err = meter.Int64Counter("db_call_retries_total",
+		metric.WithDescription("Database calls retried after the database turned them away, by operation and reason (unavailable or connect_failed)"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create db call retry counter", "error", err)
+	}
+
+	canaryRollbacks, err = meter.Int64Counter("db_canary_rollbacks_total",
+		metric.WithDescription("Database canaries taken out of rotation on a failed canary analysis, by the first failed check"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create canary rollback counter", "error", err)
+	}
+
+	hedgeOutcomes, err = meter.Int64Counter("db_hedged_calls_total",
+		metric.WithDescription("Hedged get_balance attempts by outcome: not_sent (answered before the hedge delay), won (the hedge answered first), lost (the first request did) or failed"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create hedged call counter", "error", err)
+	}
+
+	schemaChecks, err = meter.Int64Counter("db_response_schema_checks_total",
+		metric.WithDescription("Successful database responses checked against their JSON schema, by operation and result (valid or invalid)"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create schema check counter", "error", err)
+	}
+
+	schemaViolations, err = meter.Int64Counter("db_response_schema_violations_total",
+		metric.WithDescription("Ways database responses broke their JSON schema, by operation, field path and keyword"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create schema violation counter", "error", err)
+	}
+
+	cacheRequests, err = meter.Int64Counter("api_balance_cache_requests_total",
+		metric.WithDescription("Balance reads by how the cache answered them: hit, stale, miss, coalesced (waited for another read's database call) or disabled"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create balance cache request counter", "error", err)
+	}
+
+	bulkheadRejections, err = meter.Int64Counter("api_bulkhead_rejections_total",
+		metric.WithDescription("Dependency calls rejected because the dependency's bulkhead was full, by dependency"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create bulkhead rejection counter", "error", err)
+	}
+
+	shadowCalls, err = meter.Int64Counter("db_shadow_calls_total",
+		metric.WithDescription("Database calls mirrored to the shadow database by operation and result: match, diverged, primary_only, shadow_only, both_failed or dropped"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create shadow call counter", "error", err)
+	}
+
+	shadowDivergences, err = meter.Int64Counter("db_shadow_divergences_total",
+		metric.WithDescription("Response fields the shadow database answered differently from the primary, by operation and field"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create shadow divergence counter", "error", err)
+	}
+
+	shadowCallDuration, err = meter.Float64Histogram("db_shadow_call_duration_seconds",
+		metric.WithDescription("Mirrored shadow database call duration in seconds by operation"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create shadow call duration histogram", "error", err)
+	}
+
+	paymentCallDuration, err = meter.Float64Histogram("payment_call_duration_seconds",
+		metric.WithDescription("Payment gateway call duration in seconds"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create payment call duration histogram", "error", err)
+	}
+
+	transferOutcomes, err = meter.Int64Counter("api_transfer_outcomes_total",
+		metric.WithDescription("Transfer sagas by outcome: completed, debit_failed, compensated or compensation_failed"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create transfer outcome counter", "error", err)
+	}
+
+	batchSize, err = meter.Int64Histogram("api_batch_size",
+		metric.WithDescription("Transactions per batch request"),
+		metric.WithExplicitBucketBoundaries(1, 2, 5, 10, 25, 50, 100, 250, 500))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create batch size histogram", "error", err)
 	}
 }
 
-func startCoreService(dbServiceURL string) {
+// newCoreHandler builds the core API routes with their middleware
+func newCoreHandler(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap, deploys *deploy.Simulator) http.Handler {
+	db := newDBRoutes(cfg)
+	if db.canary != nil && cfg.DBCanaryVerdictURL != "" {
+		go db.watchVerdicts(&http.Client{Timeout: 5 * time.Second}, cfg.DBCanaryVerdictURL, cfg.DBCanaryVerdictPoll)
+	}
+	// Successful database responses are checked against the contract
+	if cfg.DBResponseValidation {
+		schema, err := loadResponseSchema(cfg.DBResponseSchemaFile)
+		if err != nil {
+			log.Fatalf("Invalid database response schema: %v", err)
+		}
+		db.schema = schema
+	}
+	registerCacheGauges(context.Background(), db.cache)
+	registerRetryGauge(context.Background(), db.retries)
+	if db.cache != nil && cfg.CacheIncidentProbability > 0 {
+		go simulateCacheOutages(context.Background(), cfg.CacheIncidentProbability, cfg.CacheIncidentInterval)
+	}
+	paymentGatewayURL := cfg.PaymentGatewayURL
+
 	mux := http.NewServeMux()
+	// Routes document themselves as they are registered, served as /openapi.json
+	api := newAPIDocument()
 
-	// HTTP client with OpenTelemetry instrumentation
+	// HTTP client with OpenTelemetry instrumentation and connection pool metrics
 	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Transport: otelhttp.NewTransport(httpx.NewTransport("core-api-service", cfg.HTTPClient)),
 		Timeout:   30 * time.Second,
 	}
+	db.shadow = newShadowMirror(cfg, client)
+
+	// Calls in flight per dependency are capped, so a slow one cannot hold every handler
+	payments := newBulkhead(bulkheadPayment, cfg.BulkheadPaymentSize, cfg.BulkheadMaxWait)
+	registerBulkheadGauges(context.Background(), db.bulkhead, db.cache.bulkhead(), payments, db.shadow.bulkhead())
+
+	costModel, err := costing.NewModel(cfg.Costing)
+	if err != nil {
+		log.Fatalf("Invalid cost model: %v", err)
+	}
 
-	mux.HandleFunc("/api/transaction", func(w http.ResponseWriter, r *http.Request) {
+	// Transaction results keyed by Idempotency-Key header
+	idempotency := newIdempotencyStore(cfg.IdempotencyTTL)
+	balances := newBalanceFallback(cfg.BalanceFallbackTTL)
+
+	// Token-bucket rate limiters per client IP and per user
+	ipLimiter := newRateLimiter("ip", cfg.RateLimitIPRPS, cfg.RateLimitIPBurst)
+	userLimiter := newRateLimiter("user", cfg.RateLimitUserRPS, cfg.RateLimitUserBurst)
+	registerRateLimitGauges(context.Background(), ipLimiter, userLimiter)
+	// Validated with the config
+	proxies, _ := parseTrustedProxies(cfg.RateLimitTrustedProxies)
+	// Sheds batch, then normal, then critical requests as the in-flight count climbs
+	shedder := newLoadShedder(cfg.ShedMaxInFlight)
+	registerShedGauge(context.Background(), shedder)
+
+	// Bearer tokens are verified against the auth service's published keys
+	jwks := &jwt.RemoteKeySet{
+		URL:        cfg.AuthServiceURL + "/.well-known/jwks.json",
+		Client:     &http.Client{Timeout: 5 * time.Second},
+		MinRefresh: 10 * time.Second,
+	}
+	if err := jwks.Refresh(context.Background()); err != nil {
+		logx.Warnw(context.Background(), "JWKS not available yet, retrying on first token", "url", jwks.URL, "error", err)
+	}
+	verifier := &jwt.Verifier{
+		Key:      jwks.Lookup,
+		Issuer:   cfg.TokenIssuer,
+		Audience: cfg.TokenAudience,
+		Leeway:   cfg.AuthClockLeeway,
+	}
+
+	mux.HandleFunc(api.Route("/api/transaction", opCreateTransaction, opRandomTransaction), func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := otel.Tracer("core-api-service").Start(r.Context(), "Process Transaction")
 		defer span.End()
 
 		start := time.Now()
 		defer func() {
 			duration := time.Since(start).Seconds()
-			responseTime.Record(ctx, duration, metric.WithAttributes(
-				attribute.String("service", "core-api"),
-				attribute.String("operation", "transaction"),
-				attribute.String("method", r.Method),
-			))
+			responseTime.Record(ctx, duration, responseTimeAttrs.Get(r.Method).Record...)
 		}()
 
+		// Replay a previous result for the same Idempotency-Key
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if idempotencyKey != "" {
+			span.SetAttributes(attribute.String("idempotency.key", idempotencyKey))
+			// The key is bound to the body, read here and put back for decoding
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				rejectIdempotent(ctx, w, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			cached, replay, err := idempotency.Claim(ctx, idempotencyKey, requestHash(r.Method, body))
+			if err != nil {
+				rejectIdempotent(ctx, w, err)
+				return
+			}
+			if replay {
+				span.SetAttributes(
+					attribute.Bool("idempotent", true),
+					attrs.TransactionID(cached.response.TransactionID),
+				)
+				idempotentCounter.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("status", cached.response.Status),
+				))
+
+				logx.Infow(ctx, "♻️ Idempotent replay", "transaction.id", cached.response.TransactionID, "idempotency.key", idempotencyKey)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(cached.statusCode)
+				jsonx.NewEncoder(w).Encode(cached.response)
+				return
+			}
+			span.SetAttributes(attribute.Bool("idempotent", false))
+			// A no-op once the result is stored; any failure frees the key for a retry
+			defer idempotency.Release(idempotencyKey)
+		}
+
 		// Parse request
 		var req TransactionRequest
 		if r.Method == "POST" {
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			if err := httpx.DecodeJSON(r.Body, &req); err != nil {
 				span.SetStatus(codes.Error, "invalid request body")
 
 				errorCounter.Add(ctx, 1, metric.WithAttributes(
 					attribute.String("error_type", "invalid_request"),
 				))
 
+				resp := TransactionResponse{
+					Status:   "error",
+					Error:    "invalid request body",
+					ErrorRef: httpx.NewErrorRef(ctx, w),
+				}
 				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(TransactionResponse{
-					Status: "error",
-					Error:  "invalid request body",
-				})
+				jsonx.NewEncoder(w).Encode(resp)
 				return
 			}
 		} else {
 			// Default values for GET requests
 			req = TransactionRequest{
-				UserID:    fmt.Sprintf("user_%d", rand.Intn(1000)),
-				Amount:    rand.Float64() * 1000,
+				UserID:    fmt.Sprintf("user_%d", simrand.Intn(1000)),
+				Amount:    simrand.Float64() * 1000,
 				Operation: "balance_check",
 			}
+			if claims := claimsFromContext(ctx); claims != nil {
+				req.UserID = claims.Subject
+			}
 		}
 
-		transactionID := fmt.Sprintf("txn_%d_%d", time.Now().Unix(), rand.Intn(10000))
+		if failure := checkSubject(ctx, req.UserID); failure != nil {
+			rejectUnauthorized(ctx, w, failure)
+			return
+		}
+
+		transactionID := fmt.Sprintf("txn_%d_%d", time.Now().Unix(), simrand.Intn(10000))
 
 		span.SetAttributes(
-			attribute.String("transaction.id", transactionID),
-			attribute.String("user.id", req.UserID),
-			attribute.Float64("transaction.amount", req.Amount),
-			attribute.String("transaction.operation", req.Operation),
+			attrs.TransactionID(transactionID),
+			semconv.UserID(req.UserID),
+			attrs.TransactionAmount(req.Amount),
+			attrs.TransactionOperation(req.Operation),
 		)
 
-		logrus.WithContext(ctx).Info("🔄 Processing transaction: %s for user: %s", transactionID, req.UserID)
+		logx.Infow(ctx, "🔄 Processing transaction", "transaction.id", transactionID, "user.id", req.UserID, "transaction.operation", req.Operation)
 
 		// Business logic validation
-		span.SetStatus(codes.Error, "invalid amount")
-		errorCounter.Add(ctx, 1, metric.WithAttributes(
-			attribute.String("error_type", "validation_error"),
-		))
+		if fieldErrs := validateTransaction(req); len(fieldErrs) > 0 {
+			span.SetStatus(codes.Error, "validation failed")
+			span.SetAttributes(attribute.Int("validation.error_count", len(fieldErrs)))
+			errorCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("error_type", "validation_error"),
+			))
+			recordValidationErrors(ctx, fieldErrs)
 
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(TransactionResponse{
-			TransactionID: transactionID,
-			Status:        "error",
-			Error:         "amount must be positive",
-			Timestamp:     time.Now().Unix(),
-		})
+			logx.Infow(ctx, "⚠️ Transaction rejected", "transaction.id", transactionID, "validation.error_count", len(fieldErrs))
+			resp := TransactionResponse{
+				TransactionID: transactionID,
+				Status:        "error",
+				Error:         "request validation failed",
+				Fields:        fieldErrs,
+				Timestamp:     time.Now().Unix(),
+				ErrorRef:      httpx.NewErrorRef(ctx, w),
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			jsonx.NewEncoder(w).Encode(resp)
+			return
+		}
+		span.AddEvent("validation.passed")
+		// Only valid requests of an authorized user draw from the user's bucket
+		if ok, retryAfter := userLimiter.Allow(req.UserID); !ok {
+			rejectRateLimited(ctx, w, userLimiter.scope, retryAfter)
+			return
+		}
+		// Validated operations only, so clients cannot add cost metric series
+		costing.SetOperation(ctx, req.Operation, 1)
+
+		// Authorize money-moving operations with the payment provider first
+		var payment *paymentResponse
+		if paymentOperations[req.Operation] {
+			paymentStart := time.Now()
+			var err error
+			payment, err = callPaymentGateway(ctx, client, payments, paymentGatewayURL, transactionID, req)
+			paymentCallDuration.Record(ctx, time.Since(paymentStart).Seconds(), paymentCallAttrs.Get(req.Operation).Record...)
+
+			if err != nil {
+				status, declineCode, errorType := http.StatusBadGateway, "gateway_error", "payment_error"
+				var perr *paymentError
+				if errors.As(err, &perr) {
+					status, declineCode = perr.clientStatus(), perr.DeclineCode
+					if perr.RetryAfter != "" {
+						w.Header().Set("Retry-After", perr.RetryAfter)
+					}
+				}
+				if bulkheadRejected(err) {
+					status, declineCode, errorType = http.StatusServiceUnavailable, "bulkhead_full", "bulkhead_full"
+					w.Header().Set("Retry-After", "1")
+					span.SetStatus(codes.Error, "payment bulkhead full")
+				} else if reason := httpx.CancelReason(err); reason != "" {
+					status, declineCode, errorType = httpx.CancelStatus(reason), reason, reason
+					httpx.RecordCancel(span, reason)
+				} else {
+					span.SetStatus(codes.Error, "payment authorization failed")
+				}
+				span.SetAttributes(attribute.String("payment.decline_code", declineCode))
+
+				transactionCounter.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("status", "failed"),
+					attribute.String("error_type", errorType),
+				))
+				errorCounter.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("error_type", errorType),
+					attribute.String("decline_code", declineCode),
+				))
+
+				logx.Errorw(ctx, "❌ Transaction failed: payment error", "transaction.id", transactionID, "payment.decline_code", declineCode, "error", err)
+				resp := TransactionResponse{
+					TransactionID: transactionID,
+					Status:        "failed",
+					Error:         fmt.Sprintf("payment authorization failed: %s", declineCode),
+					Timestamp:     time.Now().Unix(),
+					ErrorRef:      httpx.NewErrorRef(ctx, w),
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				jsonx.NewEncoder(w).Encode(resp)
+				return
+			}
+			span.SetAttributes(attribute.String("payment.id", payment.PaymentID))
+			span.AddEvent("payment.authorized", oteltrace.WithAttributes(
+				attribute.Float64("payment.duration_ms", float64(time.Since(paymentStart).Microseconds())/1000),
+			))
+		}
 
 		// Call database service
 		dbStart := time.Now()
-		dbResp, err := callDatabaseService(ctx, client, dbServiceURL, req)
+		span.AddEvent("db.call.started", oteltrace.WithAttributes(semconv.DBOperationName(req.Operation)))
+		dbResp, err := storeTransaction(ctx, client, db, transactionID, req)
 		dbDuration := time.Since(dbStart).Seconds()
-
-		dbCallDuration.Record(ctx, dbDuration, metric.WithAttributes(
-			attribute.String("db_operation", req.Operation),
+		span.AddEvent("db.call.finished", oteltrace.WithAttributes(
+			attrs.DBCallDuration(dbDuration*1000),
+			attrs.DBCallFailed(err != nil),
 		))
 
+		dbCallDuration.Record(ctx, dbDuration, dbCallAttrs.Get(req.Operation).Record...)
+
 		if err != nil {
-			span.SetStatus(codes.Error, "database service call failed")
+			// A request that ran out of time or lost its caller is not a database failure
+			status, errorType := http.StatusInternalServerError, "database_error"
+			if transferType, ok := transferErrorType(err); ok {
+				errorType = transferType
+				span.SetStatus(codes.Error, "transfer failed")
+			} else if bulkheadRejected(err) {
+				status, errorType = http.StatusServiceUnavailable, "bulkhead_full"
+				w.Header().Set("Retry-After", "1")
+				span.SetStatus(codes.Error, "database bulkhead full")
+			} else if reason := httpx.CancelReason(err); reason != "" {
+				status, errorType = httpx.CancelStatus(reason), reason
+				httpx.RecordCancel(span, reason)
+			} else {
+				span.SetStatus(codes.Error, "database service call failed")
+			}
 
 			transactionCounter.Add(ctx, 1, metric.WithAttributes(
 				attribute.String("status", "failed"),
-				attribute.String("error_type", "database_error"),
+				attribute.String("error_type", errorType),
 			))
 			errorCounter.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("error_type", "database_error"),
+				attribute.String("error_type", errorType),
 			))
 
-			logrus.WithContext(ctx).Error("❌ Transaction failed: %s - Database error: %v", transactionID, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(TransactionResponse{
+			logx.Errorw(ctx, "❌ Transaction failed: database error", "transaction.id", transactionID, "error", err)
+			resp := TransactionResponse{
 				TransactionID: transactionID,
 				Status:        "failed",
 				Error:         fmt.Sprintf("database service error: %v", err),
 				Timestamp:     time.Now().Unix(),
-			})
+				ErrorRef:      httpx.NewErrorRef(ctx, w),
+			}
+			w.WriteHeader(status)
+			jsonx.NewEncoder(w).Encode(resp)
 			return
 		}
 
 		// Success
-		transactionCounter.Add(ctx, 1, metric.WithAttributes(
-			attribute.String("status", "success"),
-			attribute.String("operation", req.Operation),
-		))
+		transactionCounter.Add(ctx, 1, transactionSuccessAttrs.Get(req.Operation).Add...)
 
-		logrus.WithContext(ctx).Info("✅ Transaction successful: %s", transactionID)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(TransactionResponse{
+		logx.Infow(ctx, "✅ Transaction successful", "transaction.id", transactionID, "transaction.operation", req.Operation)
+		resp := TransactionResponse{
 			TransactionID: transactionID,
 			Status:        "success",
 			Timestamp:     time.Now().Unix(),
 			Data:          dbResp,
-		})
+			Payment:       payment,
+		}
+		if idempotencyKey != "" {
+			idempotency.Complete(idempotencyKey, http.StatusOK, resp)
+		}
+		size, _ := httpx.WriteJSON(w, http.StatusOK, resp)
+		span.AddEvent("response.serialized", oteltrace.WithAttributes(semconv.HTTPResponseBodySize(size)))
 	})
 
-	mux.HandleFunc("/api/user/{id}/balance", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(api.Route("POST /api/transactions/batch", opCreateBatch), batchHandler(client, db, cfg.BatchMaxItems, cfg.BatchConcurrency))
+
+	mux.HandleFunc(api.Route("/api/user/{id}/balance", opGetBalance), func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := otel.Tracer("core-api-service").Start(r.Context(), "Get User Balance")
 		defer span.End()
 
@@ -331,7 +784,13 @@ func startCoreService(dbServiceURL string) {
 			userID = "user_default"
 		}
 
-		span.SetAttributes(attribute.String("user.id", userID))
+		span.SetAttributes(semconv.UserID(userID))
+		costing.SetOperation(ctx, "get_balance", 1)
+
+		if ok, retryAfter := userLimiter.Allow(userID); !ok {
+			rejectRateLimited(ctx, w, userLimiter.scope, retryAfter)
+			return
+		}
 
 		// Call database service for balance
 		req := TransactionRequest{
@@ -339,25 +798,49 @@ func startCoreService(dbServiceURL string) {
 			Operation: "get_balance",
 		}
 
-		dbResp, err := callDatabaseService(ctx, client, dbServiceURL, req)
+		// Served from the balance cache while it is fresh
+		dbResp, err := db.cache.get(ctx, userID, func(ctx context.Context) (interface{}, error) {
+			return callDatabaseService(ctx, client, db, req)
+		})
 		if err != nil {
-			span.SetStatus(codes.Error, "failed to get balance")
+			status := http.StatusInternalServerError
+			if reason := httpx.CancelReason(err); reason != "" {
+				status = httpx.CancelStatus(reason)
+				httpx.RecordCancel(span, reason)
+				errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("error_type", reason)))
+			} else if stale, ok := serveStaleBalance(ctx, balances, userID, err); ok {
+				span.SetAttributes(attrs.FallbackReason(fallbackReason(err)))
+				httpx.WriteJSON(w, http.StatusOK, stale)
+				return
+			} else {
+				if bulkheadRejected(err) {
+					status = http.StatusServiceUnavailable
+					w.Header().Set("Retry-After", "1")
+				}
+				span.SetStatus(codes.Error, "failed to get balance")
+			}
 
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "failed to get balance"})
+			ref := httpx.NewErrorRef(ctx, w)
+			w.WriteHeader(status)
+			jsonx.NewEncoder(w).Encode(map[string]string{
+				"error":    "failed to get balance",
+				"trace_id": ref.TraceID,
+				"error_id": ref.ErrorID,
+			})
 			return
 		}
 
+		balances.Put(userID, dbResp)
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(dbResp)
+		jsonx.NewEncoder(w).Encode(dbResp)
 	})
 
-	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(api.Route("/api/health", opHealth), func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := otel.Tracer("core-api-service").Start(r.Context(), "Health Check")
 		defer span.End()
 
 		// Check database service health
-		healthReq, _ := http.NewRequestWithContext(ctx, "GET", dbServiceURL+"/db/health", nil)
+		healthReq, _ := http.NewRequestWithContext(ctx, "GET", db.stable.url+"/db/health", nil)
 		resp, err := client.Do(healthReq)
 
 		dbHealthy := err == nil && resp != nil && resp.StatusCode == http.StatusOK
@@ -365,45 +848,278 @@ func startCoreService(dbServiceURL string) {
 			resp.Body.Close()
 		}
 
+		// Check payment gateway health
+		paymentReq, _ := http.NewRequestWithContext(ctx, "GET", paymentGatewayURL+"/payments/health", nil)
+		resp, err = client.Do(paymentReq)
+
+		paymentHealthy := err == nil && resp != nil && resp.StatusCode == http.StatusOK
+		if resp != nil {
+			resp.Body.Close()
+		}
+
 		status := "healthy"
 		if !dbHealthy {
+			status = "degraded"
 			span.SetStatus(codes.Error, "database service unhealthy")
 		}
+		if !paymentHealthy {
+			status = "degraded"
+			span.SetStatus(codes.Error, "payment gateway unhealthy")
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":           status,
-			"database_healthy": dbHealthy,
-			"timestamp":        time.Now().Unix(),
+		jsonx.NewEncoder(w).Encode(HealthResponse{
+			Status:          status,
+			DatabaseHealthy: dbHealthy,
+			PaymentHealthy:  paymentHealthy,
+			Timestamp:       time.Now().Unix(),
 		})
 	})
 
-	handler := otelhttp.NewHandler(mux, "core-api-service")
-	log.Println("🚀 Core API Service running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", handler))
+	// Kubernetes probes sit outside tracing and rate limiting
+	prober := probes.New(2 * time.Second)
+	if cfg.TelemetryExporter == telemetry.ExporterOTLP {
+		prober.AddCheck("otlp_collector", probes.TCPCheck(telemetry.CollectorAddr(cfg.OTLP)))
+		// Not ready until telemetry has reached the collector once
+		prober.AddCheck("telemetry_export", health.Ready)
+	}
+	prober.AddCheck("database_service", probes.HTTPCheck(&http.Client{}, db.stable.url+"/healthz"))
+	if db.canary != nil {
+		prober.AddCheck("database_canary", probes.HTTPCheck(&http.Client{}, db.canary.url+"/healthz"))
+	}
+	prober.AddCheck("payment_gateway", probes.HTTPCheck(&http.Client{}, paymentGatewayURL+"/healthz"))
+	if cfg.AuthRequired {
+		prober.AddCheck("auth_service", probes.HTTPCheck(&http.Client{}, cfg.AuthServiceURL+"/healthz"))
+	}
+
+	root := http.NewServeMux()
+	prober.Register(root)
+	if cfg.TelemetryBufferSize > 0 {
+		root.Handle("GET /debug/telemetry/recent", recorder)
+	}
+	root.Handle("GET /debug/otel", health)
+	root.Handle("GET /debug/audit", audit.Handler())
+	root.Handle("/debug/loglevel", logx.LevelHandler(audit.Warn))
+	if heatmap.Enabled() {
+		root.Handle("GET /debug/latency-heatmap", heatmap)
+		root.Handle("GET /debug/export", heatmap.Export())
+	}
+	root.Handle("GET /version", buildinfo.Handler("core-api-service"))
+	root.Handle("GET /openapi.json", api)
+	deploys.Register(root, cfg.DevMode)
+	// Request bodies are checked against /openapi.json with OPENAPI_VALIDATION
+	var routes http.Handler = mux
+	if cfg.OpenAPIValidation {
+		validate, err := api.Validator(rejectSchemaViolations)
+		if err != nil {
+			log.Fatalf("Invalid OpenAPI request schema: %v", err)
+		}
+		routes = validate(mux)
+	}
+	// Downstream calls share the request's REQUEST_TIMEOUT deadline
+	var handler http.Handler = rateLimitMiddleware(authMiddleware(httpx.Deadline(cfg.RequestTimeout, routes), verifier, cfg.AuthRequired), ipLimiter, proxies)
+	handler = shedder.middleware(handler)
+	// A bad deployed version slows down and fails requests
+	handler = deploys.Middleware(handler)
+	// X-Chaos-* fault injection is a development-only feature
+	if cfg.DevMode {
+		handler = chaos.Middleware("core-api-service", handler)
+	}
+	// Scenario recording for cmd/replay sees requests exactly as clients sent them
+	if cfg.RecordFile != "" {
+		recording, err := replay.NewRecorder(cfg.RecordFile)
+		if err != nil {
+			log.Fatalf("Failed to start request recording: %v", err)
+		}
+		handler = recording.Middleware(handler)
+		log.Printf("⏺️  Recording API requests to %s", cfg.RecordFile)
+	}
+	// Synthetic per-tenant request costs
+	handler = costing.Middleware("core-api-service", costModel, handler)
+	handler = httpx.Clients("core-api-service", handler)
+	handler = httpx.Metrics("core-api-service", handler)
+	// X-Debug-Trace and DEBUG_TRACE_USERS requests are sampled whatever TRACE_SAMPLE_RATIO says
+	root.Handle("/", telemetry.DebugTraces(cfg.Sampling, requestUserID, otelhttp.NewHandler(httpx.TraceResponse(handler), "core-api-service")))
+
+	prober.MarkStarted()
+	return root
+}
+
+func startCoreService(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap, deploys *deploy.Simulator) {
+	root := newCoreHandler(cfg, recorder, health, heatmap, deploys)
+	log.Printf("🚀 Core API Service running on %s", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, root))
 }
 
-func callDatabaseService(ctx context.Context, client *http.Client, dbServiceURL string, req TransactionRequest) (interface{}, error) {
-	_, span := otel.Tracer("core-api-service").Start(ctx, "Database Service Call")
+func callDatabaseService(ctx context.Context, client *http.Client, db *dbRoutes, req TransactionRequest) (result interface{}, err error) {
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Database Service Call")
 	defer span.End()
 
+	backend := db.pick()
 	span.SetAttributes(
-		attribute.String("db.operation", req.Operation),
-		attribute.String("db.user_id", req.UserID),
+		semconv.DBSystemNamePostgreSQL,
+		semconv.DBOperationName(req.Operation),
+		semconv.UserID(req.UserID),
+		attrs.DeployTrack(backend.track),
 	)
+	release, err := db.bulkhead.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	// Prepare request body
-	reqBody, err := json.Marshal(req)
+	reqBody, err := encodeQuery(req, db.encoding)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
+	}
+	// The shadow gets the call once the primary has answered it
+	if db.shadow.sample() {
+		defer func() { db.shadow.mirror(ctx, req, reqBody, result, err) }()
 	}
 
+	start := time.Now()
+	var failed oteltrace.SpanContext // the attempt a retry repeats
+	var reason string
+	var attempts int
+	defer func() { db.retries.record(time.Now(), attempts) }()
+	for attempt := 1; ; attempt++ {
+		attempts = attempt
+		attemptCtx, attemptSpan := startDatabaseAttempt(ctx, attempt, failed, reason)
+		var result interface{}
+		var err error
+		if db.hedge != nil && req.Operation == "get_balance" {
+			result, err = db.hedge.attempt(attemptCtx, client, backend.url, reqBody)
+		} else {
+			result, err = databaseAttempt(attemptCtx, client, backend.url, reqBody)
+		}
+		if err == nil {
+			attemptSpan.End()
+			backend.record(ctx, start, nil)
+			if db.schema != nil {
+				db.schema.check(ctx, req, result)
+			}
+			if !readOperations[req.Operation] {
+				db.cache.invalidate(req.UserID)
+			}
+			return result, nil
+		}
+		failDatabaseCall(attemptSpan, err)
+		attemptSpan.End()
+		failed = attemptSpan.SpanContext()
+
+		reason = retryReason(err)
+		if reason == "" || attempt >= db.attempts {
+			failDatabaseCall(span, err)
+			backend.record(ctx, start, err)
+			return result, &dbCallError{err: err, attempt: failed}
+		}
+		span.AddEvent("db.call.retried", oteltrace.WithAttributes(
+			attrs.RetryAttempt(attempt+1),
+			attrs.RetryReason(reason),
+		))
+		dbCallRetries.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("operation", req.Operation),
+			attribute.String("reason", reason),
+		))
+		logx.Warnw(ctx, "🔁 Retrying database call", "db.operation", req.Operation, "attempt", attempt+1, "reason", reason, "error", err)
+
+		timer := time.NewTimer(db.backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			err := fmt.Errorf("database service call failed: %w", ctx.Err())
+			failDatabaseCall(span, err)
+			backend.record(ctx, start, err)
+			return nil, &dbCallError{err: err, attempt: failed}
+		}
+	}
+}
+
+// startDatabaseAttempt starts the span of one try of a database call. A
+// retry links to the attempt it repeats, so trace UIs and the analyzer can
+// follow the chain of tries instead of guessing it from sibling order.
+func startDatabaseAttempt(ctx context.Context, attempt int, retryOf oteltrace.SpanContext, reason string) (context.Context, oteltrace.Span) {
+	opts := []oteltrace.SpanStartOption{oteltrace.WithAttributes(attrs.RetryAttempt(attempt))}
+	if retryOf.IsValid() {
+		opts = append(opts,
+			oteltrace.WithAttributes(attrs.RetryReason(reason)),
+			oteltrace.WithLinks(oteltrace.Link{SpanContext: retryOf, Attributes: []attribute.KeyValue{attrs.LinkKind(attrs.LinkKindRetry), attrs.RetryReason(reason)}}),
+		)
+	}
+	return otel.Tracer("core-api-service").Start(ctx, "Database Service Attempt", opts...)
+}
+
+// dbCallError is a failed database call with the span of its last attempt,
+// so whatever the caller falls back to can link to it
+type dbCallError struct {
+	err     error
+	attempt oteltrace.SpanContext
+}
+
+func (e *dbCallError) Error() string { return e.err.Error() }
+func (e *dbCallError) Unwrap() error { return e.err }
+
+// failedAttempt returns the span of the database attempt err comes from
+func failedAttempt(err error) (oteltrace.SpanContext, bool) {
+	var cerr *dbCallError
+	if errors.As(err, &cerr) && cerr.attempt.IsValid() {
+		return cerr.attempt, true
+	}
+	return oteltrace.SpanContext{}, false
+}
+
+// failDatabaseCall sets the status of a failed database call span; a call
+// abandoned with its request records the cancel reason instead
+func failDatabaseCall(span oteltrace.Span, err error) {
+	if reason := httpx.CancelReason(err); reason != "" {
+		httpx.RecordCancel(span, reason)
+		return
+	}
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// dbStatusError is a non-200 answer from the database service
+type dbStatusError struct {
+	Status int
+	Body   string
+}
+
+func (e *dbStatusError) Error() string {
+	return fmt.Sprintf("database service returned error: %s", e.Body)
+}
+
+// retryReason tells why err is safe to retry, or returns "" when it is not.
+// Only failures that left the database untouched qualify: the connection was
+// never made, or the pool turned the query away with a 503.
+func retryReason(err error) string {
+	var serr *dbStatusError
+	if errors.As(err, &serr) && serr.Status == http.StatusServiceUnavailable {
+		return "unavailable"
+	}
+	var operr *net.OpError
+	if errors.As(err, &operr) && operr.Op == "dial" {
+		return "connect_failed"
+	}
+	return ""
+}
+
+func databaseAttempt(ctx context.Context, client *http.Client, dbServiceURL string, reqBody queryBody) (interface{}, error) {
 	// Make request to database service
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", dbServiceURL+"/db/query", bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", dbServiceURL+"/db/query", bytes.NewBuffer(reqBody.data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Content-Type", dbproto.MediaType(reqBody.encoding))
+	httpReq.Header.Set("Accept", reqBody.accept())
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attrs.RequestEncoding(reqBody.encoding), semconv.HTTPRequestBodySize(len(reqBody.data)))
+	chaos.Forward(ctx, httpReq)
+	// The database drops work that would outlast what is left of REQUEST_TIMEOUT
+	if budget, ok := httpx.ForwardBudget(ctx, httpReq); ok {
+		span.SetAttributes(attrs.BudgetRemaining(float64(budget.Microseconds()) / 1000))
+	}
 
 	resp, err := client.Do(httpReq)
 	if err != nil {
@@ -416,14 +1132,26 @@ func callDatabaseService(ctx context.Context, client *http.Client, dbServiceURL
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	// The answer comes in whichever encoding the database picked
+	encoding := dbproto.Encoding(resp.Header.Get("Content-Type"))
+	span.SetAttributes(attrs.ResponseEncoding(encoding), semconv.HTTPResponseBodySize(len(body)))
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("database service returned error: %s", string(body))
+		return nil, &dbStatusError{Status: resp.StatusCode, Body: errorBody(body, encoding)}
 	}
 
-	var result interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	result, err := decodeQueryResponse(body, encoding)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
-
 	return result, nil
 }
+
+// logDeployment logs every simulated rollout and rollback
+func logDeployment(ctx context.Context, e deploy.Event) {
+	if e.Bad {
+		audit.Warn(ctx, "deployment."+e.Kind, "🚢 Deployed a bad version", "deploy.kind", e.Kind, "deploy.version", e.Version, "deploy.previous_version", e.PreviousVersion, "deploy.bad", e.Bad)
+		return
+	}
+	audit.Record(ctx, "deployment."+e.Kind, "🚢 Deployment rolled out", "deploy.kind", e.Kind, "deploy.version", e.Version, "deploy.previous_version", e.PreviousVersion, "deploy.bad", e.Bad)
+}
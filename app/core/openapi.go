@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonschema"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/openapi"
+)
+
+// ErrorResponse is the body of a request the core API turned away before
+// processing it: unauthenticated, throttled or shed
+type ErrorResponse struct {
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error"`
+	// Class is the auth failure class
+	Class string `json:"class,omitempty"`
+	// Scope and RetryAfter describe a rate limit
+	Scope      string `json:"scope,omitempty" enum:"ip,user"`
+	RetryAfter int    `json:"retry_after,omitempty" doc:"Seconds to wait, as in Retry-After"`
+	// Priority is the class of a shed request
+	Priority string `json:"priority,omitempty"`
+	httpx.ErrorRef
+}
+
+// BalanceResponse is the database service's answer to a balance read, passed
+// through
+type BalanceResponse struct {
+	Status          string      `json:"status"`
+	Data            BalanceData `json:"data"`
+	QueryTime       float64     `json:"query_time_ms"`
+	Timestamp       int64       `json:"timestamp"`
+	Stale           bool        `json:"stale,omitempty" doc:"Answered from the last balance read while the database fails"`
+	StaleAgeSeconds float64     `json:"stale_age_seconds,omitempty"`
+}
+
+type BalanceData struct {
+	UserID           string  `json:"user_id"`
+	Balance          float64 `json:"balance"`
+	AvailableBalance float64 `json:"available_balance"`
+	Currency         string  `json:"currency"`
+}
+
+// Request headers the API reads
+var (
+	headerIdempotencyKey = openapi.Header{Name: "Idempotency-Key", Description: "Replays the first successful result of the same key and body for IDEMPOTENCY_TTL; duplicates wait while the first is in flight"}
+	headerPriority       = openapi.Header{Name: httpx.HeaderPriority, Description: "critical, normal or batch; lower classes are shed first under load"}
+	headerAuthorization  = openapi.Header{Name: "Authorization", Description: "Bearer token from the auth service, required with AUTH_REQUIRED"}
+	headerRetryAfter     = openapi.Header{Name: "Retry-After", Description: "Seconds to wait before retrying"}
+)
+
+// Answers every /api/ route can give before its handler runs
+var (
+	responseUnauthorized = openapi.Response{Status: http.StatusUnauthorized, Description: "Missing or invalid bearer token", Body: ErrorResponse{}}
+	responseRateLimited  = openapi.Response{Status: http.StatusTooManyRequests, Description: "Rate limited per client IP or user", Body: ErrorResponse{}, Headers: []openapi.Header{headerRetryAfter}}
+	responseUnavailable  = openapi.Response{Status: http.StatusServiceUnavailable, Description: "Shed under load, or a dependency's bulkhead is full", Body: ErrorResponse{}, Headers: []openapi.Header{headerRetryAfter}}
+)
+
+// transactionResponses are the answers of /api/transaction
+var transactionResponses = []openapi.Response{
+	{Status: http.StatusOK, Description: "Transaction booked", Body: TransactionResponse{}},
+	{Status: http.StatusBadRequest, Description: "Invalid request; fields lists the invalid fields", Body: TransactionResponse{}},
+	responseUnauthorized,
+	{Status: http.StatusPaymentRequired, Description: "Payment declined", Body: TransactionResponse{}},
+	{Status: http.StatusConflict, Description: "A request with the same Idempotency-Key is still in progress", Body: TransactionResponse{}, Headers: []openapi.Header{headerRetryAfter}},
+	{Status: http.StatusUnprocessableEntity, Description: "The Idempotency-Key was used with a different request", Body: TransactionResponse{}},
+	responseRateLimited,
+	{Status: http.StatusInternalServerError, Description: "Database service error", Body: TransactionResponse{}},
+	{Status: http.StatusBadGateway, Description: "Payment gateway error", Body: TransactionResponse{}},
+	responseUnavailable,
+	{Status: http.StatusGatewayTimeout, Description: "REQUEST_TIMEOUT exceeded", Body: TransactionResponse{}},
+}
+
+// Operations of the API, documented where their routes are registered
+var (
+	opCreateTransaction = openapi.Operation{
+		Method:      http.MethodPost,
+		ID:          "createTransaction",
+		Summary:     "Book a transaction",
+		Description: "Authorizes the payment with the payment gateway and books the transaction in the database service.",
+		Request:     TransactionRequest{},
+		Headers:     []openapi.Header{headerIdempotencyKey, headerPriority, headerAuthorization},
+		Responses:   transactionResponses,
+	}
+	opRandomTransaction = openapi.Operation{
+		Method:      http.MethodGet,
+		ID:          "randomTransaction",
+		Summary:     "Book a balance_check of a random user",
+		Description: "Load testing shortcut for tools that can only send GET requests.",
+		Headers:     []openapi.Header{headerPriority, headerAuthorization},
+		Responses:   transactionResponses,
+	}
+	opCreateBatch = openapi.Operation{
+		ID:          "createTransactionBatch",
+		Summary:     "Book several transactions",
+		Description: "Items are validated and booked independently, without payment authorization; the batch succeeds, partly succeeds or fails as a whole.",
+		Request:     BatchRequest{},
+		Headers:     []openapi.Header{headerPriority, headerAuthorization},
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Description: "Batch processed; results has the outcome of every item", Body: BatchResponse{}},
+			{Status: http.StatusBadRequest, Description: "Invalid or oversized batch", Body: BatchResponse{}},
+			responseUnauthorized,
+			responseRateLimited,
+			responseUnavailable,
+		},
+	}
+	opGetBalance = openapi.Operation{
+		Method:  http.MethodGet,
+		ID:      "getBalance",
+		Summary: "Read a user's balance",
+		Headers: []openapi.Header{headerPriority, headerAuthorization},
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Description: "The balance, possibly stale while the database fails", Body: BalanceResponse{}},
+			responseUnauthorized,
+			{Status: http.StatusForbidden, Description: "The token is for another user", Body: ErrorResponse{}},
+			responseRateLimited,
+			{Status: http.StatusInternalServerError, Description: "Database service error", Body: ErrorResponse{}},
+			responseUnavailable,
+			{Status: http.StatusGatewayTimeout, Description: "REQUEST_TIMEOUT exceeded", Body: ErrorResponse{}},
+		},
+	}
+	opHealth = openapi.Operation{
+		Method:    http.MethodGet,
+		ID:        "getHealth",
+		Summary:   "Check the database service and payment gateway",
+		Responses: []openapi.Response{{Status: http.StatusOK, Description: "Health of the dependencies; degraded still answers 200", Body: HealthResponse{}}},
+	}
+)
+
+func newAPIDocument() *openapi.Document {
+	return openapi.New("Core API", buildinfo.Get("core-api-service").Version,
+		"Transactions and balances of the incident simulation's banking core, in front of the database service and payment gateway.")
+}
+
+// rejectSchemaViolations records a request body rejected by OPENAPI_VALIDATION:
+// an openapi.violation event per violation on the server span, which is not
+// marked as an error since the client sent the bad request, and
+// api_validation_errors_total per invalid field
+func rejectSchemaViolations(r *http.Request, violations []jsonschema.Violation) {
+	ctx := r.Context()
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attrs.RequestSchemaViolations(len(violations)))
+	fields := make([]FieldError, len(violations))
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		span.AddEvent("openapi.violation", oteltrace.WithAttributes(
+			attribute.String("schema.path", v.Path),
+			attribute.String("schema.keyword", v.Keyword),
+			attribute.String("schema.message", v.Message),
+		))
+		fields[i] = FieldError{Field: v.Path, Message: v.Message}
+		messages[i] = v.String()
+	}
+	errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("error_type", "schema_violation")))
+	recordValidationErrors(ctx, fields)
+	logx.Infow(ctx, "⚠️ Request rejected by the API schema", "url.path", r.URL.Path, "violations", messages)
+}
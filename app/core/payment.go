@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/chaos"
+	"incident-simulation/pkg/jsonx"
+)
+
+// Operations that move money and need a payment provider authorization
+var paymentOperations = map[string]bool{
+	"transfer":   true,
+	"deposit":    true,
+	"withdrawal": true,
+}
+
+type paymentRequest struct {
+	TransactionID string  `json:"transaction_id"`
+	UserID        string  `json:"user_id"`
+	Amount        float64 `json:"amount"`
+	Operation     string  `json:"operation"`
+}
+
+type paymentResponse struct {
+	PaymentID   string `json:"payment_id,omitempty"`
+	Status      string `json:"status"`
+	DeclineCode string `json:"decline_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Network     string `json:"network"`
+	ThreeDS     bool   `json:"three_ds"`
+}
+
+// paymentError is a non-authorized answer from the payment gateway
+type paymentError struct {
+	StatusCode  int
+	DeclineCode string
+	RetryAfter  string
+	Message     string
+}
+
+func (e *paymentError) Error() string {
+	return fmt.Sprintf("payment gateway returned %d (%s): %s", e.StatusCode, e.DeclineCode, e.Message)
+}
+
+// clientStatus maps the gateway answer onto the status core returns to its caller
+func (e *paymentError) clientStatus() int {
+	switch e.StatusCode {
+	case http.StatusPaymentRequired, http.StatusTooManyRequests:
+		return e.StatusCode
+	case http.StatusGatewayTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func callPaymentGateway(ctx context.Context, client *http.Client, limit *bulkhead, gatewayURL, transactionID string, req TransactionRequest) (*paymentResponse, error) {
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Payment Gateway Call")
+	defer span.End()
+
+	span.SetAttributes(
+		attrs.TransactionID(transactionID),
+		attribute.String("payment.operation", req.Operation),
+		attribute.Float64("payment.amount", req.Amount),
+	)
+	release, err := limit.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	reqBody, err := jsonx.Marshal(paymentRequest{
+		TransactionID: transactionID,
+		UserID:        req.UserID,
+		Amount:        req.Amount,
+		Operation:     req.Operation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payment request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", gatewayURL+"/payments/authorize", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	chaos.Forward(ctx, httpReq)
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		span.SetStatus(codes.Error, "payment gateway unreachable")
+		return nil, fmt.Errorf("payment gateway call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result paymentResponse
+	if err := jsonx.NewDecoder(resp.Body).Decode(&result); err != nil {
+		span.SetStatus(codes.Error, "invalid payment gateway response")
+		return nil, fmt.Errorf("failed to decode payment response: %w", err)
+	}
+	span.SetAttributes(
+		attribute.String("payment.status", result.Status),
+		attribute.String("payment.network", result.Network),
+	)
+
+	if resp.StatusCode != http.StatusOK {
+		span.SetAttributes(attribute.String("payment.decline_code", result.DeclineCode))
+		span.SetStatus(codes.Error, result.Error)
+		return &result, &paymentError{
+			StatusCode:  resp.StatusCode,
+			DeclineCode: result.DeclineCode,
+			RetryAfter:  resp.Header.Get("Retry-After"),
+			Message:     result.Error,
+		}
+	}
+	return &result, nil
+}
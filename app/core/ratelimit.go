@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// tokenBucket refills at rate tokens/second up to burst
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds one token bucket per key (client IP or user ID)
+type rateLimiter struct {
+	scope string
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(scope string, rate, burst float64) *rateLimiter {
+	l := &rateLimiter{
+		scope:   scope,
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+	go l.evictLoop()
+	return l
+}
+
+// Allow consumes one token for key; when empty it returns how long until a token is available
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// levels returns the number of tracked buckets and the lowest and average fill level
+func (l *rateLimiter) levels() (count int, min, avg float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	min = l.burst
+	sum := 0.0
+	for _, b := range l.buckets {
+		tokens := math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		min = math.Min(min, tokens)
+		sum += tokens
+	}
+	count = len(l.buckets)
+	if count == 0 {
+		return 0, l.burst, l.burst
+	}
+	return count, min, sum / float64(count)
+}
+
+// evictLoop drops buckets that have been idle long enough to be full again
+func (l *rateLimiter) evictLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		l.mu.Lock()
+		for key, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// registerRateLimitGauges exports current bucket levels for each limiter
+func registerRateLimitGauges(ctx context.Context, limiters ...*rateLimiter) {
+	meter := otel.Meter("core-api-service")
+
+	buckets, err := meter.Int64ObservableGauge("api_rate_limit_buckets",
+		metric.WithDescription("Number of token buckets currently tracked by the rate limiter"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create rate limit buckets gauge", "error", err)
+		return
+	}
+
+	level, err := meter.Float64ObservableGauge("api_rate_limit_bucket_tokens",
+		metric.WithDescription("Token bucket fill level (min and avg across tracked buckets)"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create rate limit level gauge", "error", err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, l := range limiters {
+			count, min, avg := l.levels()
+			scope := attribute.String("scope", l.scope)
+			o.ObserveInt64(buckets, int64(count), metric.WithAttributes(scope))
+			o.ObserveFloat64(level, min, metric.WithAttributes(scope, attribute.String("stat", "min")))
+			o.ObserveFloat64(level, avg, metric.WithAttributes(scope, attribute.String("stat", "avg")))
+		}
+		return nil
+	}, buckets, level)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register rate limit gauge callback", "error", err)
+	}
+}
+
+// rateLimitMiddleware applies the per-IP limiter to every /api/ route except health checks
+func rateLimitMiddleware(next http.Handler, limiter *rateLimiter, proxies trustedProxies) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/api/health" {
+			if ok, retryAfter := limiter.Allow(proxies.clientIP(r)); !ok {
+				rejectRateLimited(r.Context(), w, limiter.scope, retryAfter)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectRateLimited writes a 429 response and records the rejection. Throttling is
+// annotated on the span but not marked as an error so it stays distinct from failures.
+func rejectRateLimited(ctx context.Context, w http.ResponseWriter, scope string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Bool("ratelimit.limited", true),
+		attribute.String("ratelimit.scope", scope),
+		attribute.Int("ratelimit.retry_after_seconds", seconds),
+	)
+	span.AddEvent("rate_limited", oteltrace.WithAttributes(attribute.String("ratelimit.scope", scope)))
+
+	rateLimitedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("scope", scope)))
+
+	ref := httpx.NewErrorRef(ctx, w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	jsonx.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "error",
+		"error":       "rate limit exceeded",
+		"scope":       scope,
+		"retry_after": seconds,
+		"trace_id":    ref.TraceID,
+		"error_id":    ref.ErrorID,
+	})
+}
+
+// trustedProxies are the proxies whose X-Forwarded-For is believed
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses RATE_LIMIT_TRUSTED_PROXIES, comma-separated IPs
+// and CIDRs
+func parseTrustedProxies(list string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", s)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", s)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (p trustedProxies) trusts(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the socket address, unless it is a trusted proxy: then it is
+// the right-most X-Forwarded-For hop that is not one, since the hops left of
+// it were written by the client and can be anything
+func (p trustedProxies) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.trusts(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if ip = hop; !p.trusts(hop) {
+			break
+		}
+	}
+	return ip
+}
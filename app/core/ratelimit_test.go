@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/jwt"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.1, 192.168.0.0/16,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		remote string
+		fwd    []string
+		want   string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted caller's header ignored", "203.0.113.7:5000", []string{"198.18.0.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", []string{"198.18.0.1"}, "198.18.0.1"},
+		{"spoofed hop left of the real client", "10.0.0.1:5000", []string{"1.2.3.4, 198.18.0.1"}, "198.18.0.1"},
+		{"chain of trusted proxies", "192.168.1.2:5000", []string{"198.18.0.1, 10.0.0.1", "192.168.4.4"}, "198.18.0.1"},
+		{"only trusted hops", "10.0.0.1:5000", []string{"192.168.1.1"}, "192.168.1.1"},
+		{"trusted proxy without the header", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"IPv6 proxy", "[::1]:5000", []string{"2001:db8::1"}, "2001:db8::1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/transaction", nil)
+			r.RemoteAddr = tc.remote
+			for _, v := range tc.fwd {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := proxies.clientIP(r); got != tc.want {
+				t.Errorf("clientIP = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, list := range []string{"proxy.local", "10.0.0.0/33", "10.0.0.1,"} {
+		_, err := parseTrustedProxies(list)
+		if (err == nil) != (list == "10.0.0.1,") {
+			t.Errorf("parseTrustedProxies(%q) error = %v", list, err)
+		}
+	}
+}
+
+func TestUserRateLimitAfterChecks(t *testing.T) {
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := authServer(t, key)
+	handler, collector, flush := newTestService(t, "-db-service-url="+srv, "-payment-gateway-url="+srv, "-auth-service-url="+srv,
+		"-auth-required", "-rate-limit-user-rps=0.001", "-rate-limit-user-burst=1")
+
+	tokens := make(map[string]string)
+	for _, user := range []string{"user_1", "user_2"} {
+		tokens[user], err = jwt.Sign(jwt.Claims{
+			Issuer:    "auth-service",
+			Subject:   user,
+			Audience:  "core-api",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			Scope:     "transactions:write balance:read",
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each user's bucket holds one request, taken only by a valid request
+	// of that user
+	for _, tc := range []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"invalid request", tokens["user_1"], `{"user_id":"user_1","amount":-5,"operation":"deposit"}`, http.StatusBadRequest},
+		{"another invalid request", tokens["user_1"], `{"user_id":"user_1","amount":5,"operation":"launder"}`, http.StatusBadRequest},
+		{"no token for another user", "", `{"user_id":"user_2","amount":5,"operation":"balance_check"}`, http.StatusUnauthorized},
+		{"token of another user", tokens["user_1"], `{"user_id":"user_2","amount":5,"operation":"balance_check"}`, http.StatusForbidden},
+		{"first valid request", tokens["user_1"], `{"user_id":"user_1","amount":5,"operation":"balance_check"}`, http.StatusOK},
+		{"second valid request", tokens["user_1"], `{"user_id":"user_1","amount":5,"operation":"balance_check"}`, http.StatusTooManyRequests},
+		{"other user's bucket untouched", tokens["user_2"], `{"user_id":"user_2","amount":5,"operation":"balance_check"}`, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/transaction", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+		})
+	}
+	flush()
+
+	assertCount(t, collector, "api_rate_limited_total", map[string]string{"scope": "user"}, 1)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/logx"
+)
+
+// Seconds of database calls db_call_retry_amplification covers
+const retryWindowSeconds = 10
+
+// retryAmplification counts the database calls of the last
+// retryWindowSeconds and the attempts they took. Their ratio is the load the
+// database sees per call the core API makes: 1 without retries, up to
+// DB_CALL_ATTEMPTS while every attempt is turned away. A ratio climbing with
+// the error rate marks a retry storm the callers inflict on the database
+// themselves: every client retries after the same backoff, so the rejected
+// load comes back at once, multiplied.
+type retryAmplification struct {
+	mu      sync.Mutex
+	buckets [retryWindowSeconds]retryBucket
+}
+
+// retryBucket holds the calls that ended in one second
+type retryBucket struct {
+	second   int64
+	calls    int64
+	attempts int64
+}
+
+// record adds a call that ended at now after attempts tries
+func (a *retryAmplification) record(now time.Time, attempts int) {
+	sec := now.Unix()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := &a.buckets[sec%retryWindowSeconds]
+	if b.second != sec {
+		*b = retryBucket{second: sec}
+	}
+	b.calls++
+	b.attempts += int64(attempts)
+}
+
+// factor returns the attempts per call over the window up to now, 1 when no
+// call ended in it
+func (a *retryAmplification) factor(now time.Time) float64 {
+	sec := now.Unix()
+	var calls, attempts int64
+	a.mu.Lock()
+	for _, b := range a.buckets {
+		if sec-b.second < retryWindowSeconds {
+			calls += b.calls
+			attempts += b.attempts
+		}
+	}
+	a.mu.Unlock()
+	if calls == 0 {
+		return 1
+	}
+	return float64(attempts) / float64(calls)
+}
+
+// registerRetryGauge reports the retry amplification factor of a
+func registerRetryGauge(ctx context.Context, a *retryAmplification) {
+	_, err := otel.Meter("core-api-service").Float64ObservableGauge("db_call_retry_amplification",
+		metric.WithDescription("Database attempts per database call over the last 10 seconds; above 1 the core API's retries multiply the load on the database"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			o.Observe(a.factor(time.Now()))
+			return nil
+		}))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create retry amplification gauge", "error", err)
+	}
+}
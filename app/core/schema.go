@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/jsonschema"
+	"incident-simulation/pkg/logx"
+)
+
+// The database service's side of the contract, as a JSON schema
+//
+//go:embed db_response.schema.json
+var defaultDBResponseSchema []byte
+
+// responseSchema checks successful database responses against their JSON
+// schema. It only observes: a response that violates the schema is still
+// used, so contract drift, such as a data_corruption incident, shows up in
+// telemetry instead of as errors.
+type responseSchema struct {
+	root *jsonschema.Schema
+}
+
+// loadResponseSchema reads the schema at path, or the built-in one for an
+// empty path
+func loadResponseSchema(path string) (*responseSchema, error) {
+	data := defaultDBResponseSchema
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("read response schema: %w", err)
+		}
+	}
+	root, err := jsonschema.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("response schema %s: %w", path, err)
+	}
+	if _, ok := root.Def("write"); !ok {
+		return nil, fmt.Errorf("response schema %s: $defs/write is required", path)
+	}
+	return &responseSchema{root: root}, nil
+}
+
+// validate returns the violations of result, the response to req: the
+// document against the root schema, its data against the definition of the
+// operation (or write), and the user the data is about against the one asked
+// for, which no schema can express
+func (s *responseSchema) validate(req TransactionRequest, result interface{}) []jsonschema.Violation {
+	violations := s.root.Validate(result)
+	doc, _ := result.(map[string]interface{})
+	data, ok := doc["data"]
+	if !ok {
+		return violations
+	}
+	def, ok := s.root.Def(req.Operation)
+	if !ok {
+		def, _ = s.root.Def("write")
+	}
+	violations = append(violations, def.ValidateAt(data, "data")...)
+	if fields, ok := data.(map[string]interface{}); ok {
+		if userID, ok := fields["user_id"].(string); ok && userID != req.UserID {
+			violations = append(violations, jsonschema.Violation{
+				Path:    "data.user_id",
+				Keyword: "user_id",
+				Message: fmt.Sprintf("%q is not the requested user %q", userID, req.UserID),
+			})
+		}
+	}
+	return violations
+}
+
+// check validates result and records what it finds on the database call
+// span: a schema.violation event per violation and the count as
+// app.response.schema_violations
+func (s *responseSchema) check(ctx context.Context, req TransactionRequest, result interface{}) {
+	violations := s.validate(req, result)
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attrs.ResponseSchemaViolations(len(violations)))
+
+	outcome := "valid"
+	if len(violations) > 0 {
+		outcome = "invalid"
+	}
+	schemaChecks.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("operation", req.Operation),
+		attribute.String("result", outcome),
+	))
+	if len(violations) == 0 {
+		return
+	}
+
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		span.AddEvent("schema.violation", oteltrace.WithAttributes(
+			attribute.String("schema.path", v.Path),
+			attribute.String("schema.keyword", v.Keyword),
+			attribute.String("schema.message", v.Message),
+		))
+		schemaViolations.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("operation", req.Operation),
+			attribute.String("path", v.Path),
+			attribute.String("keyword", v.Keyword),
+		))
+		messages[i] = v.String()
+	}
+	logx.Warnw(ctx, "📐 Database response violates its schema", "db.operation", req.Operation, "user.id", req.UserID, "violations", messages)
+}
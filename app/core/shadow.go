@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/simrand"
+)
+
+// Results of a mirrored call, in db_shadow_calls_total and app.shadow.result
+const (
+	shadowMatch       = "match"
+	shadowDiverged    = "diverged"
+	shadowPrimaryOnly = "primary_only" // the shadow failed where the primary succeeded
+	shadowShadowOnly  = "shadow_only"  // the shadow succeeded where the primary failed
+	shadowBothFailed  = "both_failed"
+	shadowDropped     = "dropped" // too many mirrored calls in flight
+)
+
+// shadowTimeout bounds a mirrored call, which runs after its request is answered
+const shadowTimeout = 10 * time.Second
+
+// shadowIgnored are the response fields that differ between any two calls
+var shadowIgnored = map[string]bool{"query_time_ms": true, "timestamp": true}
+
+// shadowMirror sends DB_SHADOW_PERCENT of the database calls a second time to
+// a shadow database service at DB_SHADOW_URL, the way a migration to a new
+// database is validated on real traffic. The shadow's answer is never used:
+// it is compared with the primary's after the request has been answered, and
+// each differing field is recorded as a divergence.
+type shadowMirror struct {
+	url      string
+	percent  float64
+	inFlight *bulkhead
+	client   *http.Client
+}
+
+// newShadowMirror returns nil, which mirrors nothing, without a URL
+func newShadowMirror(cfg Config, client *http.Client) *shadowMirror {
+	if cfg.DBShadowURL == "" || cfg.DBShadowPercent <= 0 {
+		return nil
+	}
+	return &shadowMirror{
+		url:      cfg.DBShadowURL,
+		percent:  cfg.DBShadowPercent,
+		inFlight: newBulkhead(bulkheadShadow, cfg.DBShadowMaxInFlight, 0),
+		client:   client,
+	}
+}
+
+// sample tells whether a call is mirrored
+func (m *shadowMirror) sample() bool {
+	return m != nil && simrand.Float64()*100 < m.percent
+}
+
+// bulkhead returns the bulkhead of the mirrored calls, nil for a nil mirror
+func (m *shadowMirror) bulkhead() *bulkhead {
+	if m == nil {
+		return nil
+	}
+	return m.inFlight
+}
+
+// mirror sends reqBody to the shadow in the background and compares its
+// answer with the primary's, under a Database Shadow Call span of the call
+func (m *shadowMirror) mirror(ctx context.Context, req TransactionRequest, reqBody queryBody, primary interface{}, primaryErr error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shadowTimeout)
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Database Shadow Call", oteltrace.WithAttributes(
+		attrs.ShadowURL(m.url),
+	))
+	release, err := m.inFlight.acquire(ctx)
+	if err != nil {
+		m.record(ctx, span, req.Operation, shadowDropped, 0)
+		span.End()
+		cancel()
+		return
+	}
+
+	go func() {
+		defer cancel()
+		defer span.End()
+		defer release()
+
+		start := time.Now()
+		shadow, shadowErr := databaseAttempt(ctx, m.client, m.url, reqBody)
+		took := time.Since(start)
+		shadowCallDuration.Record(ctx, took.Seconds(), metric.WithAttributes(attribute.String("operation", req.Operation)))
+
+		var result string
+		var diffs []shadowDiff
+		switch {
+		case primaryErr != nil && shadowErr != nil:
+			result = shadowBothFailed
+		case primaryErr != nil:
+			result = shadowShadowOnly
+		case shadowErr != nil:
+			result = shadowPrimaryOnly
+			span.AddEvent("shadow.failed", oteltrace.WithAttributes(attribute.String("error", shadowErr.Error())))
+		default:
+			diffs = compareShadow(primary, shadow)
+			result = shadowMatch
+			if len(diffs) > 0 {
+				result = shadowDiverged
+			}
+		}
+
+		for _, d := range diffs {
+			span.AddEvent("shadow.divergence", oteltrace.WithAttributes(
+				attribute.String("shadow.field", d.Field),
+				attribute.String("shadow.primary", d.Primary),
+				attribute.String("shadow.shadow", d.Shadow),
+			))
+			shadowDivergences.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("operation", req.Operation),
+				attribute.String("field", d.Field),
+			))
+		}
+		m.record(ctx, span, req.Operation, result, len(diffs))
+		if result != shadowMatch && result != shadowBothFailed {
+			logx.Warnw(ctx, "🪞 Shadow database diverged from the primary", "db.operation", req.Operation, "user.id", req.UserID,
+				"shadow.result", result, "shadow.divergences", diffs, "shadow.error", shadowErr)
+		}
+	}()
+}
+
+func (m *shadowMirror) record(ctx context.Context, span oteltrace.Span, operation, result string, divergences int) {
+	span.SetAttributes(attrs.ShadowResult(result), attrs.ShadowDivergences(divergences))
+	shadowCalls.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("result", result),
+	))
+}
+
+// shadowDiff is a field the two answers disagree on, with both values as
+// JSON-ish text ("<missing>" for a field only one of them has)
+type shadowDiff struct {
+	Field   string `json:"field"`
+	Primary string `json:"primary"`
+	Shadow  string `json:"shadow"`
+}
+
+// compareShadow returns the leaf fields that differ between two decoded
+// responses, sorted by path, leaving out the ones that always differ. Paths
+// are dotted, as in the response schema's violations.
+func compareShadow(primary, shadow interface{}) []shadowDiff {
+	p, s := map[string]interface{}{}, map[string]interface{}{}
+	flattenShadow(primary, "", p)
+	flattenShadow(shadow, "", s)
+
+	var diffs []shadowDiff
+	for path, pv := range p {
+		sv, ok := s[path]
+		if !ok {
+			diffs = append(diffs, shadowDiff{Field: path, Primary: fmt.Sprint(pv), Shadow: "<missing>"})
+		} else if !reflect.DeepEqual(pv, sv) {
+			diffs = append(diffs, shadowDiff{Field: path, Primary: fmt.Sprint(pv), Shadow: fmt.Sprint(sv)})
+		}
+	}
+	for path, sv := range s {
+		if _, ok := p[path]; !ok {
+			diffs = append(diffs, shadowDiff{Field: path, Primary: "<missing>", Shadow: fmt.Sprint(sv)})
+		}
+	}
+	slices.SortFunc(diffs, func(a, b shadowDiff) int { return strings.Compare(a.Field, b.Field) })
+	return diffs
+}
+
+func flattenShadow(v interface{}, path string, into map[string]interface{}) {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		into[path] = v
+		return
+	}
+	for name, child := range fields {
+		if path == "" && shadowIgnored[name] {
+			continue
+		}
+		childPath := name
+		if path != "" {
+			childPath = path + "." + name
+		}
+		flattenShadow(child, childPath, into)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// shedThresholds is the share of SHED_MAX_IN_FLIGHT at which requests of
+// each priority start being shed, so batch traffic goes first and critical
+// traffic only once the service is full
+var shedThresholds = map[string]float64{
+	httpx.PriorityBatch:    0.5,
+	httpx.PriorityNormal:   0.8,
+	httpx.PriorityCritical: 1,
+}
+
+// loadShedder rejects API requests by priority once too many are in flight
+type loadShedder struct {
+	limit    int64 // 0 never sheds
+	inFlight atomic.Int64
+}
+
+func newLoadShedder(limit int) *loadShedder {
+	return &loadShedder{limit: int64(limit)}
+}
+
+// admit takes an in-flight slot for a request of priority, reporting false
+// when it is shed; admitted requests give the slot back with done
+func (s *loadShedder) admit(priority string) bool {
+	n := s.inFlight.Add(1)
+	if s.limit > 0 && float64(n) > shedThresholds[priority]*float64(s.limit) {
+		s.inFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (s *loadShedder) done() { s.inFlight.Add(-1) }
+
+// priorityOf reads X-Priority; the batch endpoint is batch unless it says otherwise
+func priorityOf(r *http.Request) string {
+	if r.URL.Path == "/api/transactions/batch" {
+		return httpx.PriorityOf(r, httpx.PriorityBatch)
+	}
+	return httpx.PriorityOf(r, httpx.PriorityNormal)
+}
+
+// middleware records the priority of every /api/ request except health
+// checks on its span and metrics and sheds it when the service is too busy
+// for its class
+func (s *loadShedder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		priority := priorityOf(r)
+		oteltrace.SpanFromContext(ctx).SetAttributes(attrs.RequestPriority(priority))
+		if !s.admit(priority) {
+			priorityRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("priority", priority), attribute.String("outcome", "shed")))
+			rejectShed(ctx, w, priority)
+			return
+		}
+		defer s.done()
+		priorityRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("priority", priority), attribute.String("outcome", "admitted")))
+
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		priorityDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("priority", priority)))
+	})
+}
+
+// rejectShed writes a 503 for a shed request. Like rate limiting, shedding is
+// annotated on the span but not marked as an error.
+func rejectShed(ctx context.Context, w http.ResponseWriter, priority string) {
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetAttributes(attrs.RequestShed(true))
+	span.AddEvent("request_shed", oteltrace.WithAttributes(attrs.RequestPriority(priority)))
+
+	ref := httpx.NewErrorRef(ctx, w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	jsonx.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "error",
+		"error":    "service overloaded, request shed",
+		"priority": priority,
+		"trace_id": ref.TraceID,
+		"error_id": ref.ErrorID,
+	})
+}
+
+// registerShedGauge exports the API requests the shedder counts in flight
+func registerShedGauge(ctx context.Context, s *loadShedder) {
+	_, err := otel.Meter("core-api-service").Int64ObservableGauge("api_shed_in_flight_requests",
+		metric.WithDescription("API requests in flight as counted by load shedding; batch requests are shed from half of SHED_MAX_IN_FLIGHT, normal ones from 80%"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(s.inFlight.Load())
+			return nil
+		}))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create load shedding gauge", "error", err)
+	}
+}
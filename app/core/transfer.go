@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/logx"
+)
+
+// Database operations of the transfer saga's steps
+const (
+	opTransferDebit      = "transfer_debit"
+	opTransferCredit     = "transfer_credit"
+	opTransferCompensate = "transfer_compensate"
+)
+
+// Outcomes recorded in api_transfer_outcomes_total and app.transfer.outcome
+const (
+	transferCompleted          = "completed"
+	transferDebitFailed        = "debit_failed"
+	transferCompensated        = "compensated"
+	transferCompensationFailed = "compensation_failed"
+)
+
+// transferError is a failed transfer saga; Outcome tells whether the sender's
+// debit was rolled back
+type transferError struct {
+	Outcome string
+	Err     error
+}
+
+func (e *transferError) Error() string {
+	switch e.Outcome {
+	case transferCompensated:
+		return fmt.Sprintf("transfer credit failed, debit refunded: %v", e.Err)
+	case transferCompensationFailed:
+		return fmt.Sprintf("transfer credit failed and the refund failed too: %v", e.Err)
+	}
+	return fmt.Sprintf("transfer debit failed: %v", e.Err)
+}
+
+func (e *transferError) Unwrap() error { return e.Err }
+
+// storeTransaction writes req to the database service, as a saga for transfers
+func storeTransaction(ctx context.Context, client *http.Client, db *dbRoutes, transactionID string, req TransactionRequest) (interface{}, error) {
+	if req.Operation == "transfer" {
+		return runTransfer(ctx, client, db, transactionID, req)
+	}
+	return callDatabaseService(ctx, client, db, req)
+}
+
+// runTransfer debits the sender and then credits the recipient in two database
+// calls. When the credit fails the debit is compensated with a refund, so a
+// failed transfer leaves a debit, credit-failure, refund chain in its trace.
+func runTransfer(ctx context.Context, client *http.Client, db *dbRoutes, transactionID string, req TransactionRequest) (interface{}, error) {
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Transfer Saga")
+	defer span.End()
+
+	span.SetAttributes(
+		attrs.TransactionID(transactionID),
+		semconv.UserID(req.UserID),
+		attrs.TransferRecipient(req.ToUserID),
+		attrs.TransactionAmount(req.Amount),
+	)
+
+	outcome := transferCompleted
+	defer func() {
+		span.SetAttributes(attrs.TransferOutcome(outcome))
+		transferOutcomes.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+	}()
+
+	if _, err := transferStep(ctx, client, db, opTransferDebit, req.UserID, req.Amount); err != nil {
+		outcome = transferDebitFailed
+		span.SetStatus(codes.Error, "transfer debit failed")
+		return nil, &transferError{Outcome: outcome, Err: err}
+	}
+
+	credit, err := transferStep(ctx, client, db, opTransferCredit, req.ToUserID, req.Amount)
+	if err == nil {
+		return credit, nil
+	}
+	logx.Warnw(ctx, "↩️ Transfer credit failed, refunding the debit", "transaction.id", transactionID, "user.id", req.UserID, "error", err)
+
+	// The refund runs even when the request was canceled; otherwise the sender
+	// keeps the debit
+	compensateCtx := context.WithoutCancel(ctx)
+	if _, cerr := transferStep(compensateCtx, client, db, opTransferCompensate, req.UserID, req.Amount); cerr != nil {
+		outcome = transferCompensationFailed
+		span.SetStatus(codes.Error, "transfer compensation failed")
+		logx.Errorw(ctx, "🚨 Transfer refund failed, sender debited without a credit", "transaction.id", transactionID, "user.id", req.UserID, "amount", req.Amount, "error", cerr)
+		return nil, &transferError{Outcome: outcome, Err: errors.Join(err, cerr)}
+	}
+	outcome = transferCompensated
+	span.SetStatus(codes.Error, "transfer credit failed, debit refunded")
+	return nil, &transferError{Outcome: outcome, Err: err}
+}
+
+// transferStep runs one saga step against userID's account in its own span
+func transferStep(ctx context.Context, client *http.Client, db *dbRoutes, operation, userID string, amount float64) (interface{}, error) {
+	ctx, span := otel.Tracer("core-api-service").Start(ctx, "Transfer Step")
+	defer span.End()
+
+	span.SetAttributes(attrs.TransferStep(operation), semconv.UserID(userID))
+	resp, err := callDatabaseService(ctx, client, db, TransactionRequest{
+		UserID:    userID,
+		Amount:    amount,
+		Operation: operation,
+	})
+	if err != nil {
+		if reason := httpx.CancelReason(err); reason != "" {
+			httpx.RecordCancel(span, reason)
+		} else {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	return resp, err
+}
+
+// transferErrorType is the error_type of a failed transfer in api_errors_total
+func transferErrorType(err error) (string, bool) {
+	var terr *transferError
+	if !errors.As(err, &terr) {
+		return "", false
+	}
+	return "transfer_" + terr.Outcome, true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// FieldError describes a single invalid field in a transaction request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Operations accepted by /api/transaction
+var allowedOperations = map[string]bool{
+	"transfer":      true,
+	"deposit":       true,
+	"withdrawal":    true,
+	"balance_check": true,
+}
+
+var userIDPattern = regexp.MustCompile(`^user_[A-Za-z0-9_-]{1,64}$`)
+
+// validateTransaction checks the request and returns one FieldError per invalid field
+func validateTransaction(req TransactionRequest) []FieldError {
+	var errs []FieldError
+
+	if !userIDPattern.MatchString(req.UserID) {
+		errs = append(errs, FieldError{
+			Field:   "user_id",
+			Message: "user_id must match user_<id> (letters, digits, '_' or '-', max 64)",
+		})
+	}
+
+	if req.Amount <= 0 {
+		errs = append(errs, FieldError{
+			Field:   "amount",
+			Message: "amount must be positive",
+		})
+	}
+
+	if !allowedOperations[req.Operation] {
+		errs = append(errs, FieldError{
+			Field:   "operation",
+			Message: fmt.Sprintf("unsupported operation %q", req.Operation),
+		})
+	}
+
+	if req.Operation == "transfer" && (!userIDPattern.MatchString(req.ToUserID) || req.ToUserID == req.UserID) {
+		errs = append(errs, FieldError{
+			Field:   "to_user_id",
+			Message: "to_user_id must name another user as user_<id>",
+		})
+	}
+
+	return errs
+}
+
+// recordValidationErrors increments api_validation_errors_total once per invalid field
+func recordValidationErrors(ctx context.Context, errs []FieldError) {
+	for _, fe := range errs {
+		validationErrorCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("field", fe.Field),
+		))
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+)
+
+// flagSlowPath routes queries through the path the active incident slows
+// down; turning it off serves them at normal latency, as a fallback replica
+// would, while errors still follow the incident
+const flagSlowPath = "slow_path"
+
+// featureFlags are runtime switches flipped through the admin API
+type featureFlags struct {
+	mu     sync.RWMutex
+	values map[string]bool
+}
+
+var flags = &featureFlags{values: map[string]bool{flagSlowPath: true}}
+
+func (f *featureFlags) enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.values[name]
+}
+
+// set changes a known flag, reporting false for unknown names
+func (f *featureFlags) set(name string, on bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.values[name]; !ok {
+		return false
+	}
+	f.values[name] = on
+	return true
+}
+
+func (f *featureFlags) snapshot() map[string]bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make(map[string]bool, len(f.values))
+	for k, v := range f.values {
+		out[k] = v
+	}
+	return out
+}
+
+type FlagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type PoolRequest struct {
+	MaxConnections int `json:"max_connections"`
+}
+
+type PoolStatus struct {
+	MaxConnections int   `json:"max_connections"`
+	MaxScale       int   `json:"max_scale"`
+	InUse          int64 `json:"in_use"`
+	Leaked         int64 `json:"leaked"`
+	Waiting        int64 `json:"waiting"`
+}
+
+// registerAdmin adds the remediation endpoints the analyzer calls. Every
+// change goes to the audit trail.
+func registerAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("POST /db/admin/incident/clear", adminClearIncident)
+	mux.HandleFunc("GET /db/admin/flags", adminListFlags)
+	mux.HandleFunc("PUT /db/admin/flags/{name}", adminSetFlag)
+	mux.HandleFunc("GET /db/admin/pool", adminPoolStatus)
+	mux.HandleFunc("PUT /db/admin/pool", adminScalePool)
+	mux.HandleFunc("GET /db/admin/ledger", adminLedgerStatus)
+	mux.HandleFunc("POST /db/admin/ledger/reconcile", adminReconcileLedger)
+}
+
+func adminClearIncident(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("database-service").Start(r.Context(), "Admin Clear Incident")
+	defer span.End()
+
+	active := activeIncidentType()
+	select {
+	case clearIncident <- struct{}{}:
+	default:
+		writeAdminError(ctx, w, http.StatusConflict, "no incident is active")
+		return
+	}
+	span.SetAttributes(attrs.IncidentType(active))
+	audit.Warn(ctx, "admin.incident.clear", "🛠️ Incident cleared through the admin API", "incident_type", active)
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"cleared": active})
+}
+
+func adminListFlags(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"flags": flags.snapshot()})
+}
+
+func adminSetFlag(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("database-service").Start(r.Context(), "Admin Set Flag")
+	defer span.End()
+
+	name := r.PathValue("name")
+	var req FlagRequest
+	if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+	span.SetAttributes(
+		attribute.String("feature_flag.key", name),
+		attribute.Bool("feature_flag.enabled", *req.Enabled),
+	)
+	previous := flags.enabled(name)
+	if !flags.set(name, *req.Enabled) {
+		var names []string
+		for k := range flags.snapshot() {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		writeAdminError(ctx, w, http.StatusNotFound, "unknown flag, known flags: "+strings.Join(names, ", "))
+		return
+	}
+	audit.Warn(ctx, "admin.feature_flag.set", "🛠️ Feature flag changed through the admin API",
+		"feature_flag.key", name, "feature_flag.enabled", *req.Enabled, "feature_flag.previous", previous)
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"flags": flags.snapshot()})
+}
+
+func adminPoolStatus(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, poolStatus())
+}
+
+func adminScalePool(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("database-service").Start(r.Context(), "Admin Scale Pool")
+	defer span.End()
+
+	var req PoolRequest
+	if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	previous := pool.size()
+	span.SetAttributes(
+		attrs.DBPoolPreviousSize(previous),
+		attrs.DBPoolSize(req.MaxConnections),
+	)
+	if err := pool.resize(req.MaxConnections); err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	audit.Warn(ctx, "admin.pool.scale", "🛠️ Connection pool scaled through the admin API",
+		"db.pool.previous_size", previous, "db.pool.size", req.MaxConnections)
+	writeAdminJSON(w, http.StatusOK, poolStatus())
+}
+
+func adminLedgerStatus(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, dbLedger.summary())
+}
+
+// adminReconcileLedger resets drifted balances to what their writes add up to
+func adminReconcileLedger(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("database-service").Start(r.Context(), "Admin Reconcile Ledger")
+	defer span.End()
+
+	before := dbLedger.reconcile(ctx)
+	span.SetAttributes(
+		attribute.Int("ledger.drifted_accounts", before.DriftedAccounts),
+		attribute.Float64("ledger.drift", before.Drift),
+	)
+	audit.Warn(ctx, "admin.ledger.reconcile", "🛠️ Ledger reconciled through the admin API",
+		"ledger.drifted_accounts", before.DriftedAccounts, "ledger.drift", before.Drift)
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"reconciled": before.DriftedAccounts,
+		"drift":      before.Drift,
+		"ledger":     dbLedger.summary(),
+	})
+}
+
+func poolStatus() PoolStatus {
+	return PoolStatus{
+		MaxConnections: pool.size(),
+		MaxScale:       cap(pool.slots),
+		InUse:          pool.inUse.Load(),
+		Leaked:         pool.leaked.Load(),
+		Waiting:        pool.waiting.Load(),
+	}
+}
+
+func writeAdminError(ctx context.Context, w http.ResponseWriter, status int, msg string) {
+	trace.SpanFromContext(ctx).SetStatus(codes.Error, msg)
+	writeAdminJSON(w, status, DatabaseResponse{
+		Status:    "error",
+		Error:     msg,
+		Timestamp: time.Now().Unix(),
+		ErrorRef:  httpx.NewErrorRef(ctx, w),
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	jsonx.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/dbproto"
+	"incident-simulation/pkg/telemetry"
+)
+
+// BenchmarkQueryHandler runs deposits through the whole request path: the
+// middleware, decoding, span attributes, metric recording and the encoded
+// response, once per encoding the core API can pick (DB_ENCODING). Spans and
+// metrics are recorded by the SDK but not exported, so the numbers are the
+// request path's own.
+func BenchmarkQueryHandler(b *testing.B) {
+	tp := trace.NewTracerProvider()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewManualReader()))
+	prevTP, prevMP := otel.GetTracerProvider(), otel.GetMeterProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	logrus.SetOutput(io.Discard)
+	b.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetMeterProvider(prevMP)
+		logrus.SetOutput(os.Stderr)
+		tp.Shutdown(context.Background())
+		mp.Shutdown(context.Background())
+	})
+
+	cfg := testConfig(b, "{latency: 0s, error_rate: 0}")
+	recorder := telemetry.NewRecorder("database-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	heatmap := telemetry.NewHeatmap("database-service", cfg.LatencyHeatmapMinutes)
+	handler := buildService(cfg, recorder, health, heatmap)
+	for _, encoding := range []string{dbproto.JSON, dbproto.Protobuf} {
+		b.Run(encoding, func(b *testing.B) {
+			body := strings.NewReader(`{"user_id":"user_1","amount":25,"operation":"deposit"}`)
+			if encoding == dbproto.Protobuf {
+				body = strings.NewReader(string(dbproto.MarshalRequest(dbproto.Request{UserID: "user_1", Amount: 25, Operation: "deposit"})))
+			}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				body.Seek(0, io.SeekStart)
+				req := httptest.NewRequest(http.MethodPost, "/db/query", body)
+				req.Header.Set("Content-Type", dbproto.MediaType(encoding))
+				req.Header.Set("Accept", dbproto.MediaType(encoding))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
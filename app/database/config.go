@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"incident-simulation/pkg/config"
+)
+
+// Config is the database service configuration
+type Config struct {
+	config.Telemetry
+	config.Audit
+	config.Profiling
+	config.Dev
+	config.Simulation
+
+	ListenAddr          string        `env:"LISTEN_ADDR" flag:"listen" default:":8081" usage:"HTTP listen address"`
+	IncidentInterval    time.Duration `env:"INCIDENT_INTERVAL" flag:"incident-interval" default:"45s" usage:"How often the simulator considers starting an incident"`
+	IncidentProbability float64       `env:"INCIDENT_PROBABILITY" flag:"incident-probability" default:"0.25" usage:"Chance of starting an incident at each interval"`
+
+	IncidentScheduleFile string `env:"DB_INCIDENT_SCHEDULE_FILE" flag:"incident-schedule-file" usage:"YAML file of incidents recurring on cron schedules"`
+
+	PartialIncidentProbability float64 `env:"DB_PARTIAL_INCIDENT_PROBABILITY" flag:"partial-incident-probability" default:"0.3" usage:"Chance that a query incident only hits one operation or a user cohort"`
+	IncidentCohortPercent      int     `env:"DB_INCIDENT_COHORT_PERCENT" flag:"incident-cohort-percent" default:"10" usage:"Share of users, hashed by user ID, a cohort-scoped incident hits"`
+
+	StateFile string `env:"DB_STATE_FILE" flag:"state-file" usage:"File the active incident is saved to and restored from after a restart; replicas other than the first add .<index>"`
+
+	IncidentHistoryFile string `env:"DB_INCIDENT_HISTORY_FILE" flag:"incident-history-file" usage:"JSON lines file ended incidents are appended to for GET /db/incidents, in memory when empty; replicas other than the first add .<index>"`
+	IncidentHistoryMax  int    `env:"DB_INCIDENT_HISTORY_MAX" flag:"incident-history-max" default:"1000" usage:"Incidents GET /db/incidents keeps before the oldest are dropped"`
+
+	OperationProfilesFile string `env:"DB_OPERATION_PROFILES_FILE" flag:"operation-profiles-file" usage:"YAML file overriding per-operation latency and error profiles"`
+	LatencyDistribution   string `env:"DB_LATENCY_DISTRIBUTION" flag:"latency-distribution" default:"uniform" usage:"Latency distribution of operations whose profile names none: uniform, lognormal, pareto or bimodal"`
+
+	PoolMaxConnections int           `env:"DB_POOL_MAX_CONNECTIONS" flag:"pool-max-connections" default:"20" usage:"Simulated connection pool size"`
+	PoolMaxScale       int           `env:"DB_POOL_MAX_SCALE" flag:"pool-max-scale" default:"100" usage:"Largest size the admin API may scale the pool to"`
+	PoolMaxWaiting     int           `env:"DB_POOL_MAX_WAITING" flag:"pool-max-waiting" default:"100" usage:"Queries allowed to queue for a connection before being rejected"`
+	PoolAcquireTimeout time.Duration `env:"DB_POOL_ACQUIRE_TIMEOUT" flag:"pool-acquire-timeout" default:"2s" usage:"How long a query waits for a connection"`
+
+	LeakMBPerSecond   int `env:"DB_LEAK_MB_PER_SECOND" flag:"leak-mb-per-second" default:"4" usage:"Memory retained per second during a memory_leak incident"`
+	LeakMaxMB         int `env:"DB_LEAK_MAX_MB" flag:"leak-max-mb" default:"512" usage:"Most memory a memory_leak incident retains"`
+	CPUSpinGoroutines int `env:"DB_CPU_SPIN_GOROUTINES" flag:"cpu-spin-goroutines" default:"2" usage:"Busy goroutines during a cpu_spin incident (0 uses GOMAXPROCS)"`
+
+	GoroutineLeakPerSecond   int           `env:"DB_GOROUTINE_LEAK_PER_SECOND" flag:"goroutine-leak-per-second" default:"5" usage:"Goroutines left blocked per second during a goroutine_leak incident"`
+	GoroutineLeakMax         int           `env:"DB_GOROUTINE_LEAK_MAX" flag:"goroutine-leak-max" default:"20000" usage:"Most goroutines a goroutine_leak incident leaves blocked"`
+	GoroutineWatchWindow     time.Duration `env:"DB_GOROUTINE_WATCH_WINDOW" flag:"goroutine-watch-window" default:"1m" usage:"Window the goroutine growth rate is fitted over"`
+	GoroutineGrowthThreshold float64       `env:"DB_GOROUTINE_GROWTH_THRESHOLD" flag:"goroutine-growth-threshold" default:"100" usage:"Goroutines gained per minute, sustained over a window, at which a leak is suspected"`
+
+	ErrorStormDuration time.Duration `env:"DB_ERROR_STORM_DURATION" flag:"error-storm-duration" default:"10s" usage:"How long an error_storm incident the simulator starts rejects every query"`
+
+	OutboxMaxEvents int `env:"DB_OUTBOX_MAX_EVENTS" flag:"outbox-max-events" default:"10000" usage:"Pending outbox events kept before the oldest are dropped"`
+
+	LedgerFile string `env:"DB_LEDGER_FILE" flag:"ledger-file" usage:"BoltDB file account balances are kept in across restarts, in memory when empty; replicas other than the first add .<index>"`
+
+	Track string `env:"DB_TRACK" flag:"track" default:"stable" usage:"Release track of this version behind the core API's canary routing, stable or canary; only a canary runs bad_canary incidents"`
+
+	Instances        int `env:"DB_INSTANCES" flag:"instances" default:"1" usage:"Replicas to run as child processes behind a round-robin proxy on LISTEN_ADDR"`
+	InstanceBasePort int `env:"DB_INSTANCE_BASE_PORT" flag:"instance-base-port" default:"18081" usage:"Replica i listens on 127.0.0.1 at this port plus i"`
+	InstanceIndex    int `env:"DB_INSTANCE_INDEX" flag:"instance-index" default:"0" usage:"Index of this replica, set by the DB_INSTANCES supervisor"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.IncidentInterval <= 0 {
+		errs = append(errs, errors.New("INCIDENT_INTERVAL must be positive"))
+	}
+	if c.IncidentProbability < 0 || c.IncidentProbability > 1 {
+		errs = append(errs, errors.New("INCIDENT_PROBABILITY must be between 0 and 1"))
+	}
+	if c.PartialIncidentProbability < 0 || c.PartialIncidentProbability > 1 {
+		errs = append(errs, errors.New("DB_PARTIAL_INCIDENT_PROBABILITY must be between 0 and 1"))
+	}
+	if c.IncidentCohortPercent < 1 || c.IncidentCohortPercent > 100 {
+		errs = append(errs, errors.New("DB_INCIDENT_COHORT_PERCENT must be between 1 and 100"))
+	}
+	if c.PoolMaxConnections < 1 {
+		errs = append(errs, errors.New("DB_POOL_MAX_CONNECTIONS must be at least 1"))
+	}
+	if c.PoolMaxScale < c.PoolMaxConnections {
+		errs = append(errs, errors.New("DB_POOL_MAX_SCALE must be at least DB_POOL_MAX_CONNECTIONS"))
+	}
+	if c.PoolMaxWaiting < 0 {
+		errs = append(errs, errors.New("DB_POOL_MAX_WAITING must not be negative"))
+	}
+	if c.PoolAcquireTimeout <= 0 {
+		errs = append(errs, errors.New("DB_POOL_ACQUIRE_TIMEOUT must be positive"))
+	}
+	if c.LeakMBPerSecond < 1 || c.LeakMaxMB < c.LeakMBPerSecond {
+		errs = append(errs, errors.New("DB_LEAK_MB_PER_SECOND must be at least 1 and DB_LEAK_MAX_MB at least that"))
+	}
+	if c.GoroutineLeakPerSecond < 1 || c.GoroutineLeakMax < c.GoroutineLeakPerSecond {
+		errs = append(errs, errors.New("DB_GOROUTINE_LEAK_PER_SECOND must be at least 1 and DB_GOROUTINE_LEAK_MAX at least that"))
+	}
+	if c.GoroutineWatchWindow < time.Second || c.GoroutineGrowthThreshold <= 0 {
+		errs = append(errs, errors.New("DB_GOROUTINE_WATCH_WINDOW must be at least 1s and DB_GOROUTINE_GROWTH_THRESHOLD positive"))
+	}
+	if !slices.Contains([]string{latencyUniform, latencyLognormal, latencyPareto, latencyBimodal}, c.LatencyDistribution) {
+		errs = append(errs, errors.New("DB_LATENCY_DISTRIBUTION must be uniform, lognormal, pareto or bimodal"))
+	}
+	if c.ErrorStormDuration <= 0 {
+		errs = append(errs, errors.New("DB_ERROR_STORM_DURATION must be positive"))
+	}
+	if c.CPUSpinGoroutines < 0 {
+		errs = append(errs, errors.New("DB_CPU_SPIN_GOROUTINES must not be negative"))
+	}
+	if c.IncidentHistoryMax < 1 {
+		errs = append(errs, errors.New("DB_INCIDENT_HISTORY_MAX must be at least 1"))
+	}
+	if c.OutboxMaxEvents < 1 {
+		errs = append(errs, errors.New("DB_OUTBOX_MAX_EVENTS must be at least 1"))
+	}
+	if c.Track != trackStable && c.Track != trackCanary {
+		errs = append(errs, errors.New("DB_TRACK must be stable or canary"))
+	}
+	if c.Instances < 1 || c.InstanceIndex < 0 {
+		errs = append(errs, errors.New("DB_INSTANCES must be at least 1 and DB_INSTANCE_INDEX not negative"))
+	}
+	if c.Instances > 1 && (c.InstanceBasePort < 1 || c.InstanceBasePort+c.Instances > 65536) {
+		errs = append(errs, errors.New("DB_INSTANCE_BASE_PORT must leave room for DB_INSTANCES ports"))
+	}
+	errs = append(errs, c.Batching.Validate(), c.Sampling.Validate(), c.Logging.Validate())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/contracttest"
+	"incident-simulation/pkg/httpx"
+)
+
+var update = flag.Bool("update", false, "record the contract fixtures instead of verifying against them")
+
+// contractDir holds the database service's side of its contract with the core
+// API, which replays these fixtures in its own tests
+const contractDir = "../testdata/contracts/database"
+
+// contractCase is one answer of the database service the core API depends on
+type contractCase struct {
+	name        string
+	description string
+	profile     string
+	args        []string
+	request     string
+	header      http.Header
+	// prepare puts the service in the state the case needs and returns the
+	// request context
+	prepare func(t *testing.T) context.Context
+}
+
+func contractCases() []contractCase {
+	var cases []contractCase
+	for _, op := range []string{"deposit", "withdrawal", "balance_check", "get_balance", "transfer_debit", "transfer_credit", "transfer_compensate"} {
+		cases = append(cases, contractCase{
+			name:        op + "_success",
+			description: op + " succeeds",
+			profile:     okProfile,
+			request:     `{"user_id":"user_1","amount":25,"operation":"` + op + `"}`,
+		})
+	}
+	return append(cases,
+		contractCase{
+			name:        "query_error",
+			description: "the query fails inside the database",
+			profile:     failProfile,
+			request:     `{"user_id":"user_1","amount":25,"operation":"deposit"}`,
+		},
+		contractCase{
+			name:        "pool_exhausted",
+			description: "no pooled connection is free and the wait queue is full",
+			profile:     okProfile,
+			args:        []string{"-pool-max-connections=1", "-pool-max-waiting=0"},
+			request:     `{"user_id":"user_1","amount":25,"operation":"deposit"}`,
+			prepare: func(t *testing.T) context.Context {
+				release, _, err := pool.Acquire(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(release)
+				return context.Background()
+			},
+		},
+		contractCase{
+			name:        "deadline_exceeded",
+			description: "the caller's deadline passes while the query runs",
+			profile:     slowProfile,
+			request:     `{"user_id":"user_1","amount":25,"operation":"deposit"}`,
+			prepare: func(t *testing.T) context.Context {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				t.Cleanup(cancel)
+				return ctx
+			},
+		},
+		contractCase{
+			name:        "budget_exceeded",
+			description: "the query would outlast the time budget the caller sent",
+			profile:     slowProfile,
+			request:     `{"user_id":"user_1","amount":25,"operation":"deposit"}`,
+			header:      http.Header{httpx.HeaderBudget: {"500"}},
+		},
+		contractCase{
+			name:        "invalid_request",
+			description: "the request body does not decode",
+			profile:     okProfile,
+			request:     `{"user_id":"user_1","amount":"25","operation":"deposit"}`,
+		},
+	)
+}
+
+// TestDatabaseContract checks that every recorded answer still comes with
+// the same status and response schema; run with -update to re-record them
+func TestDatabaseContract(t *testing.T) {
+	var recorded []contracttest.Interaction
+	if !*update {
+		recorded = contracttest.Load(t, contractDir)
+	}
+
+	for _, c := range contractCases() {
+		t.Run(c.name, func(t *testing.T) {
+			handler, _, _ := newTestService(t, c.profile, c.args...)
+			ctx := context.Background()
+			if c.prepare != nil {
+				ctx = c.prepare(t)
+			}
+
+			body := c.request
+			var want contracttest.Interaction
+			if !*update {
+				want = contracttest.Get(t, recorded, c.name)
+				body = string(want.Request)
+			}
+
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/db/query", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			for key, values := range c.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if !*update {
+				contracttest.Verify(t, want, rec.Code, rec.Body.Bytes())
+				return
+			}
+			in, err := contracttest.Record(c.name, c.description, http.MethodPost, "/db/query", []byte(c.request), rec.Code, rec.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := contracttest.Write(contractDir, in); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
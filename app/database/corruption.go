@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/simrand"
+)
+
+// Ways a data_corruption incident breaks a response
+const (
+	corruptNegativeBalance = "negative_balance"
+	corruptCurrencyFlip    = "currency_flip"
+	corruptMissingField    = "missing_field"
+	corruptWrongUser       = "wrong_user"
+)
+
+// corruptionRate is the share of successful responses a data_corruption
+// incident corrupts; the rest stay right, as a bad code path would leave them
+const corruptionRate = 0.5
+
+// corruptResponse breaks data, the response of a successful operation, while
+// it still looks like a success: the balance turns negative, the currency
+// changes, a field goes missing or the user is someone else. It returns how,
+// or "" for a response left alone. The ledger is not touched, only the
+// answer.
+func corruptResponse(ctx context.Context, operation string, data map[string]interface{}) string {
+	if simrand.Float64() >= corruptionRate {
+		return ""
+	}
+	kinds := []string{corruptMissingField, corruptWrongUser}
+	if _, ok := data["balance"]; ok {
+		kinds = append(kinds, corruptNegativeBalance, corruptCurrencyFlip)
+	}
+
+	kind := kinds[simrand.Intn(len(kinds))]
+	switch kind {
+	case corruptNegativeBalance:
+		if b, ok := data["balance"].(float64); ok {
+			data["balance"] = -b - 0.01
+		}
+	case corruptCurrencyFlip:
+		currencies := []string{"EUR", "JPY", "GBP"}
+		data["currency"] = currencies[simrand.Intn(len(currencies))]
+	case corruptMissingField:
+		// The field a caller of this operation needs most
+		field := "result"
+		if _, ok := data["balance"]; ok {
+			field = "balance"
+		}
+		delete(data, field)
+	case corruptWrongUser:
+		data["user_id"] = fmt.Sprintf("user_%d", simrand.Intn(10000))
+	}
+	corruptedResponses.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("kind", kind),
+	))
+	return kind
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"incident-simulation/pkg/dbproto"
+	"incident-simulation/pkg/httpx"
+)
+
+// decodeQuery reads the query of r in the encoding its Content-Type names and
+// returns that encoding
+func decodeQuery(r *http.Request, req *DatabaseRequest) (string, error) {
+	encoding := dbproto.Encoding(r.Header.Get("Content-Type"))
+	if encoding == dbproto.JSON {
+		return encoding, httpx.DecodeJSON(r.Body, req)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return encoding, err
+	}
+	q, err := dbproto.UnmarshalRequest(body)
+	if err != nil {
+		return encoding, err
+	}
+	*req = DatabaseRequest{UserID: q.UserID, Amount: q.Amount, Operation: q.Operation}
+	return encoding, nil
+}
+
+// writeQueryResponse writes resp with status in encoding, the one the
+// caller's Accept header asked for. A response protobuf cannot carry goes out
+// as JSON, which callers tell from its Content-Type.
+func writeQueryResponse(w http.ResponseWriter, encoding string, status int, resp DatabaseResponse) {
+	// Every query's outcome passes here, so the incident history counts errors here
+	dbHistory.observe(status)
+	if encoding == dbproto.JSON {
+		httpx.WriteJSON(w, status, resp)
+		return
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	body, err := dbproto.MarshalResponse(dbproto.Response{
+		Status:    resp.Status,
+		Data:      data,
+		Error:     resp.Error,
+		QueryTime: resp.QueryTime,
+		Timestamp: resp.Timestamp,
+		TraceID:   resp.TraceID,
+		ErrorID:   resp.ErrorID,
+	})
+	if err != nil {
+		httpx.WriteJSON(w, status, resp)
+		return
+	}
+	w.Header().Set("Content-Type", dbproto.ContentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// Event is a state change pushed to /db/events subscribers
+type Event struct {
+	Type         string `json:"type"`
+	IncidentType string `json:"incident_type"`
+	Scope        string `json:"scope,omitempty"`
+	Scenario     string `json:"scenario,omitempty"`
+	Healthy      *bool  `json:"healthy,omitempty"`
+	Message      string `json:"message,omitempty"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
+// eventBroker fans out events to every connected SSE client
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	lastHealthy int32 // 1 healthy, 0 unhealthy
+	// restart is the last service_restarted event, replayed to new clients
+	// since it is published before any of them can connect
+	restart *Event
+}
+
+var events = &eventBroker{
+	subscribers: make(map[chan Event]struct{}),
+	lastHealthy: 1,
+}
+
+func (b *eventBroker) subscribe() chan Event {
+	ch := make(chan Event, 16)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+// publish delivers e to all subscribers, dropping it for clients that are not keeping up
+func (b *eventBroker) publish(e Event) {
+	if e.Timestamp == 0 {
+		e.Timestamp = time.Now().Unix()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// announceRestart publishes e and keeps it for clients that connect later
+func (b *eventBroker) announceRestart(e Event) {
+	e.Timestamp = time.Now().Unix()
+	b.mu.Lock()
+	b.restart = &e
+	b.mu.Unlock()
+	b.publish(e)
+}
+
+func (b *eventBroker) lastRestart() *Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.restart
+}
+
+// observeHealth publishes a health_changed event when the simulated health flips
+func (b *eventBroker) observeHealth(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	if atomic.SwapInt32(&b.lastHealthy, v) == v {
+		return
+	}
+
+	msg := "database service degraded"
+	if healthy {
+		msg = "database service recovered"
+	}
+	b.publish(Event{
+		Type:         "health_changed",
+		IncidentType: activeIncidentType(),
+		Healthy:      &healthy,
+		Message:      msg,
+	})
+}
+
+// handleEvents streams events as Server-Sent Events until the client disconnects
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("database-service").Start(r.Context(), "Database Event Stream")
+	defer span.End()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	eventSubscribers.Add(ctx, 1)
+	defer eventSubscribers.Add(ctx, -1)
+
+	// Send the current state first so clients don't wait for the next transition
+	healthy := atomic.LoadInt32(&events.lastHealthy) == 1
+	writeEvent(w, Event{
+		Type:         "snapshot",
+		IncidentType: activeIncidentType(),
+		Healthy:      &healthy,
+		Timestamp:    time.Now().Unix(),
+	})
+	if e := events.lastRestart(); e != nil {
+		writeEvent(w, *e)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	sent := 0
+	for {
+		select {
+		case <-ctx.Done():
+			span.SetAttributes(attribute.Int("events.sent", sent))
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e := <-ch:
+			writeEvent(w, e)
+			flusher.Flush()
+			sent++
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e Event) {
+	payload, err := jsonx.Marshal(e)
+	if err != nil {
+		logx.Errorw(context.Background(), "Failed to marshal event", "event_type", e.Type, "error", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, payload)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/logx"
+)
+
+// resourceExhaustion runs the memory_leak, cpu_spin and goroutine_leak
+// incidents. None changes query behaviour directly: the memory leak shows up
+// as a growing heap and GC pressure, the spin as CPU usage and scheduler
+// delay, the goroutine leak as a goroutine count that only ever climbs, in the
+// Go runtime metrics and in heap, CPU and goroutine profiles under
+// leakMemory, spinCPU and leakGoroutines.
+type resourceExhaustion struct {
+	leakPerSecond       int64
+	leakMax             int64
+	spinners            int
+	goroutinesPerSecond int
+	goroutinesMax       int64
+
+	leaked           atomic.Int64
+	spinning         atomic.Int64
+	leakedGoroutines atomic.Int64
+}
+
+func newResourceExhaustion(leakMBPerSecond, leakMaxMB, spinners, goroutinesPerSecond, goroutinesMax int) *resourceExhaustion {
+	if spinners == 0 {
+		spinners = runtime.GOMAXPROCS(0)
+	}
+	return &resourceExhaustion{
+		leakPerSecond:       int64(leakMBPerSecond) << 20,
+		leakMax:             int64(leakMaxMB) << 20,
+		spinners:            spinners,
+		goroutinesPerSecond: goroutinesPerSecond,
+		goroutinesMax:       int64(goroutinesMax),
+	}
+}
+
+// leakMemory retains leakPerSecond more bytes every second, up to leakMax,
+// until the returned function is called
+func (r *resourceExhaustion) leakMemory() func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		var retained [][]byte
+		for {
+			select {
+			case <-stop:
+				r.leaked.Store(0)
+				return
+			case <-ticker.C:
+				if r.leaked.Load() >= r.leakMax {
+					continue
+				}
+				chunk := make([]byte, r.leakPerSecond)
+				// Touch every page so the leak shows in RSS, not only in the heap
+				for i := 0; i < len(chunk); i += 4096 {
+					chunk[i] = 1
+				}
+				retained = append(retained, chunk)
+				r.leaked.Add(int64(len(chunk)))
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		debug.FreeOSMemory()
+	}
+}
+
+// spinCPU keeps spinners goroutines busy until the returned function is called
+func (r *resourceExhaustion) spinCPU() func() {
+	stop := make(chan struct{})
+	for i := 0; i < r.spinners; i++ {
+		r.spinning.Add(1)
+		go func() {
+			defer r.spinning.Add(-1)
+			x := uint64(i + 1)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for j := 0; j < 100_000; j++ {
+					x ^= x << 13
+					x ^= x >> 7
+					x ^= x << 17
+				}
+			}
+		}()
+	}
+	return func() { close(stop) }
+}
+
+// leakGoroutines starts goroutinesPerSecond more goroutines every second, up
+// to goroutinesMax, each blocked on a channel nobody sends on, the way a
+// handler waiting on a result that never comes leaks. They are let go when
+// the returned function is called.
+func (r *resourceExhaustion) leakGoroutines() func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	never := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			for i := 0; i < r.goroutinesPerSecond && r.leakedGoroutines.Load() < r.goroutinesMax; i++ {
+				r.leakedGoroutines.Add(1)
+				go func() {
+					defer r.leakedGoroutines.Add(-1)
+					select {
+					case <-never:
+					case <-stop:
+					}
+				}()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// registerMetrics exports the simulated leaks and spin; the Go runtime
+// instrumentation reports their effect
+func (r *resourceExhaustion) registerMetrics(ctx context.Context) {
+	meter := otel.Meter("database-service")
+
+	leaked, err := meter.Int64ObservableGauge("db_simulated_leak_bytes",
+		metric.WithDescription("Memory retained by the memory_leak incident"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create leak gauge", "error", err)
+		return
+	}
+
+	spinning, err := meter.Int64ObservableGauge("db_simulated_cpu_spinners",
+		metric.WithDescription("Goroutines kept busy by the cpu_spin incident"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create CPU spin gauge", "error", err)
+		return
+	}
+
+	goroutines, err := meter.Int64ObservableGauge("db_simulated_leaked_goroutines",
+		metric.WithDescription("Goroutines left blocked by the goroutine_leak incident"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create leaked goroutines gauge", "error", err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(leaked, r.leaked.Load())
+		o.ObserveInt64(spinning, r.spinning.Load())
+		o.ObserveInt64(goroutines, r.leakedGoroutines.Load())
+		return nil
+	}, leaked, spinning, goroutines)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register resource exhaustion gauge callback", "error", err)
+	}
+}
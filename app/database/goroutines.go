@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/logx"
+)
+
+// goroutineSamples is how many goroutine counts a window holds
+const goroutineSamples = 12
+
+// goroutineWatch is the service watching its own goroutine count for a leak.
+// A point reading says little, since every request in flight holds
+// goroutines, so it fits a line through the counts of the last window and
+// suspects a leak while the slope stays above threshold. That catches a slow
+// leak long before the count itself looks alarming.
+type goroutineWatch struct {
+	window    time.Duration
+	threshold float64 // goroutines per minute
+
+	mu        sync.Mutex
+	samples   []goroutineSample // oldest first
+	suspected bool
+}
+
+type goroutineSample struct {
+	at    time.Time
+	count int
+}
+
+func newGoroutineWatch(window time.Duration, threshold float64) *goroutineWatch {
+	return &goroutineWatch{window: window, threshold: threshold}
+}
+
+// run samples the goroutine count goroutineSamples times per window until
+// ctx is done, logging when a leak becomes suspected and when it clears
+func (g *goroutineWatch) run(ctx context.Context) {
+	ticker := time.NewTicker(g.window / goroutineSamples)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			g.observe(ctx, now, runtime.NumGoroutine())
+		}
+	}
+}
+
+func (g *goroutineWatch) observe(ctx context.Context, now time.Time, count int) {
+	g.mu.Lock()
+	g.samples = append(g.samples, goroutineSample{at: now, count: count})
+	for len(g.samples) > 0 && now.Sub(g.samples[0].at) > g.window {
+		g.samples = g.samples[1:]
+	}
+	growth, full := g.growthLocked()
+	suspected := full && growth >= g.threshold
+	changed := suspected != g.suspected
+	g.suspected = suspected
+	g.mu.Unlock()
+
+	switch {
+	case changed && suspected:
+		logx.Warnw(ctx, "🧵 Goroutine count keeps growing, possible leak", "goroutines", count,
+			"goroutines.growth_per_minute", growth, "goroutines.window", g.window.String())
+	case changed:
+		logx.Infow(ctx, "🧵 Goroutine count stopped growing", "goroutines", count, "goroutines.growth_per_minute", growth)
+	}
+}
+
+// growth returns the goroutines gained per minute over the window, and
+// whether the samples span most of it yet
+func (g *goroutineWatch) growth() (float64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.growthLocked()
+}
+
+// growthLocked is the least-squares slope of the samples
+func (g *goroutineWatch) growthLocked() (float64, bool) {
+	n := len(g.samples)
+	if n < 2 {
+		return 0, false
+	}
+	first := g.samples[0].at
+	var sumX, sumY float64
+	for _, s := range g.samples {
+		sumX += s.at.Sub(first).Minutes()
+		sumY += float64(s.count)
+	}
+	meanX, meanY := sumX/float64(n), sumY/float64(n)
+	var cov, variance float64
+	for _, s := range g.samples {
+		dx := s.at.Sub(first).Minutes() - meanX
+		cov += dx * (float64(s.count) - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	span := g.samples[n-1].at.Sub(first)
+	return cov / variance, span >= g.window*(goroutineSamples-2)/goroutineSamples
+}
+
+// registerMetrics exports the growth and whether a leak is suspected
+func (g *goroutineWatch) registerMetrics(ctx context.Context) {
+	meter := otel.Meter("database-service")
+
+	growth, err := meter.Float64ObservableGauge("db_goroutine_growth_per_minute",
+		metric.WithDescription("Goroutines gained per minute, the slope of the goroutine count over DB_GOROUTINE_WATCH_WINDOW"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create goroutine growth gauge", "error", err)
+		return
+	}
+	suspected, err := meter.Int64ObservableGauge("db_goroutine_leak_suspected",
+		metric.WithDescription("1 while the goroutine growth stays above DB_GOROUTINE_GROWTH_THRESHOLD for a whole window"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create goroutine leak gauge", "error", err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		perMinute, _ := g.growth()
+		o.ObserveFloat64(growth, perMinute)
+		g.mu.Lock()
+		var leaking int64
+		if g.suspected {
+			leaking = 1
+		}
+		g.mu.Unlock()
+		o.ObserveInt64(suspected, leaking)
+		return nil
+	}, growth, suspected)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register goroutine watch gauge callback", "error", err)
+	}
+}
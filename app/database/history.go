@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// IncidentRecord is one simulated incident of GET /db/incidents, the ground
+// truth the analyzer's detections are scored against. The error rate counts
+// queries answered 5xx; its peak is the worst one-second bucket.
+type IncidentRecord struct {
+	ID            int64      `json:"id"`
+	Type          string     `json:"type"`
+	Scope         string     `json:"scope"`
+	Scenario      string     `json:"scenario,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	EndReason     string     `json:"end_reason,omitempty"`
+	Requests      int64      `json:"requests"`
+	Errors        int64      `json:"errors"`
+	PeakErrorRate float64    `json:"peak_error_rate"`
+}
+
+// Reasons an incident ended
+const (
+	endExpired     = "expired"
+	endCleared     = "cleared"
+	endInterrupted = "interrupted"
+)
+
+// IncidentPage is a page of GET /db/incidents, newest first. NextCursor, when
+// set, is the cursor parameter of the next older page.
+type IncidentPage struct {
+	Incidents  []IncidentRecord `json:"incidents"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	Total      int              `json:"total"`
+}
+
+// Page sizes of GET /db/incidents
+const (
+	defaultIncidentPage = 50
+	maxIncidentPage     = 500
+)
+
+// incidentHistory keeps the last maxRecords incidents, the active one
+// included, and appends every ended one to DB_INCIDENT_HISTORY_FILE so the
+// history survives restarts
+type incidentHistory struct {
+	mu         sync.Mutex
+	records    []IncidentRecord
+	nextID     int64
+	maxRecords int
+	path       string
+
+	// The active incident's current one-second bucket
+	active                 bool
+	second                 int64
+	secRequests, secErrors int64
+}
+
+// openIncidentHistory loads the history kept in path, in memory only when
+// path is empty. IDs are spaced apart per replica as outbox event IDs are.
+func openIncidentHistory(path string, maxRecords, instance int) (*incidentHistory, error) {
+	h := &incidentHistory{maxRecords: maxRecords, nextID: int64(instance)<<instanceIDShift + 1, path: path}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open incident history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var rec IncidentRecord
+		if err := jsonx.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("parse incident history %s line %d: %w", path, line, err)
+		}
+		h.records = append(h.records, rec)
+		h.nextID = max(h.nextID, rec.ID+1)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read incident history: %w", err)
+	}
+	if len(h.records) > maxRecords {
+		// Compacted on open, so the file grows by at most a run's incidents
+		h.records = h.records[len(h.records)-maxRecords:]
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// rewrite replaces the file with the records held
+func (h *incidentHistory) rewrite() error {
+	var data []byte
+	for _, rec := range h.records {
+		line, err := jsonx.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("compact incident history: %w", err)
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// add appends rec, dropping the oldest record past maxRecords
+func (h *incidentHistory) add(rec IncidentRecord) {
+	h.records = append(h.records, rec)
+	if len(h.records) > h.maxRecords {
+		h.records = h.records[len(h.records)-h.maxRecords:]
+	}
+}
+
+// start records st as the active incident
+func (h *incidentHistory) start(st incidentState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add(IncidentRecord{ID: h.nextID, Type: st.Type, Scope: st.scope().String(), Scenario: st.Scenario, StartedAt: st.StartedAt})
+	h.nextID++
+	h.active, h.second, h.secRequests, h.secErrors = true, 0, 0, 0
+}
+
+// observe counts a query answered status toward the active incident
+func (h *incidentHistory) observe(status int) {
+	if atomic.LoadInt64(&incidentActive) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.active {
+		return
+	}
+	rec := &h.records[len(h.records)-1]
+	if now != h.second {
+		h.fold(rec)
+		h.second = now
+	}
+	rec.Requests++
+	h.secRequests++
+	if status >= 500 {
+		rec.Errors++
+		h.secErrors++
+	}
+}
+
+// fold closes the current bucket into the active record's peak
+func (h *incidentHistory) fold(rec *IncidentRecord) {
+	if h.secRequests > 0 {
+		rec.PeakErrorRate = max(rec.PeakErrorRate, float64(h.secErrors)/float64(h.secRequests))
+	}
+	h.secRequests, h.secErrors = 0, 0
+}
+
+// end closes the active incident and returns its record
+func (h *incidentHistory) end(ctx context.Context, reason string) IncidentRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.active || len(h.records) == 0 {
+		return IncidentRecord{}
+	}
+	h.active = false
+	rec := &h.records[len(h.records)-1]
+	h.fold(rec)
+	now := time.Now()
+	rec.EndedAt, rec.EndReason = &now, reason
+	h.persist(ctx, *rec)
+	return *rec
+}
+
+// interrupted records an incident of the state file that is not resumed
+// after a restart, as ended when it was due or at the restart
+func (h *incidentHistory) interrupted(ctx context.Context, st incidentState) {
+	ended := st.EndsAt
+	if now := time.Now(); ended.After(now) {
+		ended = now
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec := IncidentRecord{ID: h.nextID, Type: st.Type, Scope: st.scope().String(), Scenario: st.Scenario,
+		StartedAt: st.StartedAt, EndedAt: &ended, EndReason: endInterrupted}
+	h.nextID++
+	h.add(rec)
+	h.persist(ctx, rec)
+}
+
+// persist appends rec to the history file
+func (h *incidentHistory) persist(ctx context.Context, rec IncidentRecord) {
+	if h.path == "" {
+		return
+	}
+	line, err := jsonx.Marshal(rec)
+	if err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+			_, err = f.Write(append(line, '\n'))
+			err = errors.Join(err, f.Close())
+		}
+	}
+	if err != nil {
+		logx.Errorw(ctx, "Failed to save incident history", "path", h.path, "error", err)
+	}
+}
+
+// incidentFilter selects incidents overlapping [since, until] of a type,
+// older than the cursor
+type incidentFilter struct {
+	incidentType string
+	since, until time.Time
+	before       int64
+	limit        int
+}
+
+// list returns the page of records f selects, newest first, and the number
+// of records it selects in all
+func (h *incidentHistory) list(f incidentFilter) IncidentPage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	page := IncidentPage{Incidents: []IncidentRecord{}}
+	for i := len(h.records) - 1; i >= 0; i-- {
+		rec := h.records[i]
+		if !f.match(rec) {
+			continue
+		}
+		page.Total++
+		if f.before != 0 && rec.ID >= f.before {
+			continue
+		}
+		if len(page.Incidents) == f.limit {
+			page.NextCursor = strconv.FormatInt(page.Incidents[f.limit-1].ID, 10)
+			continue
+		}
+		if i == len(h.records)-1 && h.active {
+			// The active incident's peak so far takes in the current second
+			if h.secRequests > 0 {
+				rec.PeakErrorRate = max(rec.PeakErrorRate, float64(h.secErrors)/float64(h.secRequests))
+			}
+		}
+		page.Incidents = append(page.Incidents, rec)
+	}
+	return page
+}
+
+func (f incidentFilter) match(rec IncidentRecord) bool {
+	if f.incidentType != "" && rec.Type != f.incidentType {
+		return false
+	}
+	if !f.until.IsZero() && rec.StartedAt.After(f.until) {
+		return false
+	}
+	// An active incident overlaps every window reaching the present
+	return f.since.IsZero() || rec.EndedAt == nil || !rec.EndedAt.Before(f.since)
+}
+
+// parseHistoryTime reads an RFC 3339 time or a duration before now
+func parseHistoryTime(v string) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// register adds GET /db/incidents?type=&since=&until=&limit=&cursor=
+func (h *incidentHistory) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /db/incidents", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("database-service").Start(r.Context(), "List Incidents")
+		defer span.End()
+
+		query := r.URL.Query()
+		f := incidentFilter{incidentType: query.Get("type"), limit: defaultIncidentPage}
+		var errs []error
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &f.since}, {"until", &f.until}} {
+			if v := query.Get(p.name); v != "" {
+				t, err := parseHistoryTime(v)
+				if err != nil {
+					errs = append(errs, errors.New(p.name+" must be an RFC 3339 time or a duration ago"))
+				}
+				*p.dst = t
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxIncidentPage {
+				errs = append(errs, fmt.Errorf("limit must be between 1 and %d", maxIncidentPage))
+			}
+			f.limit = n
+		}
+		if v := query.Get("cursor"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id < 1 {
+				errs = append(errs, errors.New("cursor must be the next_cursor of a previous page"))
+			}
+			f.before = id
+		}
+		if err := errors.Join(errs...); err != nil {
+			span.SetStatus(codes.Error, "invalid query")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page := h.list(f)
+		span.SetAttributes(
+			attribute.Int("incidents.returned", len(page.Incidents)),
+			attribute.Int("incidents.total", page.Total),
+		)
+		w.Header().Set("Content-Type", "application/json")
+		jsonx.NewEncoder(w).Encode(page)
+	})
+}
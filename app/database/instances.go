@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// runInstances serves DB_INSTANCES > 1: it starts that many replicas of this
+// binary on 127.0.0.1 from DB_INSTANCE_BASE_PORT, each exporting its own
+// service.instance.id, and balances LISTEN_ADDR across them round-robin. It
+// exports no telemetry itself, so traces show the replicas only.
+func runInstances(cfg Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("❌ Failed to locate the database service binary: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	backends := make([]*url.URL, cfg.Instances)
+	for i := range cfg.Instances {
+		addr := fmt.Sprintf("127.0.0.1:%d", cfg.InstanceBasePort+i)
+		backends[i] = &url.URL{Scheme: "http", Host: addr}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			superviseInstance(ctx, exe, i, addr)
+		}()
+	}
+
+	server := &http.Server{Addr: cfg.ListenAddr, Handler: newInstanceBalancer(backends)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("🗄️  Database Service balancing %d instances on %s", cfg.Instances, cfg.ListenAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("❌ Instance balancer failed: %v", err)
+		stop()
+	}
+	wg.Wait()
+}
+
+// superviseInstance runs replica index on addr, restarting it a second after
+// it exits until ctx is done
+func superviseInstance(ctx context.Context, exe string, index int, addr string) {
+	instanceID := fmt.Sprintf("database-service-%d", index)
+	resourceAttrs := "service.instance.id=" + instanceID
+	if v := os.Getenv("OTEL_RESOURCE_ATTRIBUTES"); v != "" {
+		resourceAttrs = v + "," + resourceAttrs
+	}
+	// Later flags win, so these override anything passed to the supervisor
+	args := append(slices.Clone(os.Args[1:]),
+		"--instances=1",
+		fmt.Sprintf("--instance-index=%d", index),
+		"--listen="+addr,
+		"--pprof=false",
+	)
+
+	for {
+		cmd := exec.CommandContext(ctx, exe, args...)
+		cmd.Env = append(os.Environ(), "OTEL_RESOURCE_ATTRIBUTES="+resourceAttrs)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = 5 * time.Second
+
+		log.Printf("🧬 Starting instance %s on %s", instanceID, addr)
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("⚠️  Instance %s exited (%v), restarting", instanceID, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// instanceBalancer proxies requests to the replicas in turn. Admin changes
+// and outbox acks go to every replica instead, since each holds its own
+// incident state, flags, pool and outbox.
+type instanceBalancer struct {
+	proxies []*httputil.ReverseProxy
+	next    atomic.Uint64
+}
+
+func newInstanceBalancer(backends []*url.URL) *instanceBalancer {
+	b := &instanceBalancer{}
+	for _, u := range backends {
+		b.proxies = append(b.proxies, httputil.NewSingleHostReverseProxy(u))
+	}
+	return b
+}
+
+func (b *instanceBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if broadcastRequest(r) {
+		b.broadcast(w, r)
+		return
+	}
+	i := b.next.Add(1) % uint64(len(b.proxies))
+	b.proxies[i].ServeHTTP(w, r)
+}
+
+// broadcastRequest reports whether r changes state every replica must share
+func broadcastRequest(r *http.Request) bool {
+	if r.Method == http.MethodPost && r.URL.Path == "/db/outbox/ack" {
+		return true
+	}
+	return r.Method != http.MethodGet && strings.HasPrefix(r.URL.Path, "/db/admin/")
+}
+
+// broadcast sends r to every replica and answers with the first successful
+// response, or the last one when none succeeded
+func (b *instanceBalancer) broadcast(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var answer *httptest.ResponseRecorder
+	for _, p := range b.proxies {
+		req := r.Clone(r.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		if answer == nil || answer.Code >= 300 {
+			answer = rec
+		}
+	}
+
+	for k, v := range answer.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(answer.Code)
+	w.Write(answer.Body.Bytes())
+}
@@ -0,0 +1,659 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/dbproto"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/telemetry"
+	"incident-simulation/pkg/telemetry/telemetrytest"
+)
+
+// Operation profiles for the tests
+const (
+	okProfile   = "{latency: 1ms, jitter: 1ms, error_rate: 0}"
+	failProfile = "{latency: 1ms, jitter: 1ms, error_rate: 1}"
+	slowProfile = "{latency: 10s, error_rate: 0}"
+)
+
+// newTestService builds the database service with its real telemetry setup
+// exporting to an in-memory collector and every operation behaving as
+// profile; flush shuts the providers down so everything emitted so far has
+// arrived
+func newTestService(t testing.TB, profile string, args ...string) (http.Handler, *telemetrytest.Collector, func()) {
+	t.Helper()
+	collector := telemetrytest.NewCollector(t)
+	cfg := testConfig(t, profile, append([]string{
+		"-telemetry-exporter=otlp", "-otlp-insecure", "-otlp-endpoint=" + collector.Endpoint(),
+	}, args...)...)
+
+	recorder := telemetry.NewRecorder("database-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	heatmap := telemetry.NewHeatmap("database-service", cfg.LatencyHeatmapMinutes)
+	shutdown := initOpenTelemetry(context.Background(), "database-service", cfg.Telemetry, recorder, health, heatmap)
+	handler := buildService(cfg, recorder, health, heatmap)
+
+	var once sync.Once
+	flush := func() { once.Do(shutdown) }
+	t.Cleanup(flush)
+	return handler, collector, flush
+}
+
+// testConfig loads the configuration from args with every operation behaving
+// as profile
+func testConfig(t testing.TB, profile string, args ...string) Config {
+	t.Helper()
+	var yaml strings.Builder
+	yaml.WriteString("operations:\n")
+	for _, op := range builtinOperations {
+		yaml.WriteString("  " + op + ": " + profile + "\n")
+	}
+	profiles := filepath.Join(t.TempDir(), "profiles.yaml")
+	if err := os.WriteFile(profiles, []byte(yaml.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg Config
+	if err := config.Load(&cfg, append([]string{"-operation-profiles-file=" + profiles}, args...)); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	return cfg
+}
+
+// buildService sets up the service state and metrics the way main does and
+// returns the handler
+func buildService(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) http.Handler {
+	ctx := context.Background()
+	pool = newConnPool(cfg.PoolMaxConnections, cfg.PoolMaxScale, cfg.PoolMaxWaiting, cfg.PoolAcquireTimeout)
+	exhaustion = newResourceExhaustion(cfg.LeakMBPerSecond, cfg.LeakMaxMB, cfg.CPUSpinGoroutines, cfg.GoroutineLeakPerSecond, cfg.GoroutineLeakMax)
+	dbOutbox = newOutbox(cfg.OutboxMaxEvents, cfg.InstanceIndex)
+	deployTrack = cfg.Track
+	dbLedger, _ = openLedger("")
+	dbHistory, _ = openIncidentHistory("", cfg.IncidentHistoryMax, cfg.InstanceIndex)
+	initMetrics(ctx)
+	pool.registerMetrics(ctx)
+	exhaustion.registerMetrics(ctx)
+	dbOutbox.registerMetrics(ctx)
+	dbLedger.registerMetrics(ctx)
+	return newDatabaseHandler(cfg, recorder, health, heatmap)
+}
+
+func postQuery(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/db/query", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestQueryTelemetry(t *testing.T) {
+	handler, collector, flush := newTestService(t, okProfile)
+
+	rec := postQuery(handler, `{"user_id":"user_1","amount":10,"operation":"deposit"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	server := collector.Span(t, "database-service")
+	if server.Kind != "server" || server.StatusCode != "unset" {
+		t.Errorf("server span kind %s status %s, want server unset", server.Kind, server.StatusCode)
+	}
+	span := collector.Span(t, "Database Query")
+	if span.ParentSpanID != server.SpanID || span.StatusCode != "unset" {
+		t.Errorf("Database Query parent %s status %s, want %s unset", span.ParentSpanID, span.StatusCode, server.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "Database Query", span.Attributes, map[string]string{
+		"db.system.name":      "postgresql",
+		"db.operation.name":   "deposit",
+		"db.query.text":       "*",
+		"db.query.summary":    "*",
+		"db.collection.name":  "*",
+		"user.id":             "user_1",
+		"sim.incident.active": "false",
+		"sim.incident.type":   "none",
+		"app.db.pool.wait_ms": "*",
+		"app.outbox.event_id": "*",
+	})
+
+	assertCount(t, collector, "db_queries_total", map[string]string{"status": "success", "operation": "deposit"}, 1)
+	assertHistogramCount(t, collector, "db_query_duration_seconds", map[string]string{"operation": "deposit"}, 1)
+	assertHistogramCount(t, collector, "db_pool_wait_duration_seconds", nil, 1)
+	assertCount(t, collector, "db_outbox_events_total", map[string]string{"operation": "deposit"}, 1)
+	if points := collector.PointsNamed("db_errors_total", nil); len(points) != 0 {
+		t.Errorf("db_errors_total recorded on success: %+v", points)
+	}
+
+	logs := collector.LogsWithBody("Database query successful")
+	if len(logs) != 1 {
+		t.Fatalf("got %d success logs, want 1", len(logs))
+	}
+	if logs[0].Severity != "info" || logs[0].SpanID != span.SpanID {
+		t.Errorf("success log severity %q span %s, want info %s", logs[0].Severity, logs[0].SpanID, span.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "success log", logs[0].Attributes, map[string]string{"db.operation": "deposit", "user.id": "user_1"})
+}
+
+func TestQueryFailureTelemetry(t *testing.T) {
+	handler, collector, flush := newTestService(t, failProfile)
+
+	rec := postQuery(handler, `{"user_id":"user_1","amount":10,"operation":"get_balance"}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	flush()
+
+	if server := collector.Span(t, "database-service"); server.StatusCode != "error" {
+		t.Errorf("server span status %s, want error for a 500", server.StatusCode)
+	}
+	span := collector.Span(t, "Database Query")
+	if span.StatusCode != "error" || span.StatusMessage != "database connection error" {
+		t.Errorf("Database Query status %s %q, want error \"database connection error\"", span.StatusCode, span.StatusMessage)
+	}
+	if len(span.Events) != 1 || span.Events[0].Name != "exception" {
+		t.Errorf("Database Query events = %+v, want one exception", span.Events)
+	}
+
+	assertCount(t, collector, "db_queries_total", map[string]string{"status": "error", "operation": "get_balance"}, 1)
+	assertCount(t, collector, "db_errors_total", map[string]string{"error_type": "none", "operation": "get_balance"}, 1)
+	logs := collector.LogsWithBody("Database query failed")
+	if len(logs) != 1 || logs[0].Severity != "error" {
+		t.Fatalf("failure logs = %+v, want one at error", logs)
+	}
+}
+
+func TestQueryProtobufEncoding(t *testing.T) {
+	handler, collector, flush := newTestService(t, okProfile)
+
+	body := dbproto.MarshalRequest(dbproto.Request{UserID: "user_1", Amount: 10, Operation: "get_balance"})
+	req := httptest.NewRequest(http.MethodPost, "/db/query", bytes.NewReader(body))
+	req.Header.Set("Content-Type", dbproto.ContentType)
+	req.Header.Set("Accept", dbproto.ContentType+", application/json;q=0.5")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != dbproto.ContentType {
+		t.Fatalf("status = %d, Content-Type %q; want 200 in protobuf", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	resp, err := dbproto.UnmarshalResponse(rec.Body.Bytes())
+	if err != nil || resp.Status != "success" || resp.Data["user_id"] != "user_1" || resp.Data["currency"] != "USD" {
+		t.Errorf("answer read as %+v, %v", resp, err)
+	}
+
+	// A caller that asks for nothing in particular still gets JSON
+	if rec := postQuery(handler, `{"user_id":"user_1","amount":10,"operation":"get_balance"}`); rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("JSON query answered in %q", rec.Header().Get("Content-Type"))
+	}
+
+	flush()
+	spans := collector.SpansNamed("Database Query")
+	if len(spans) != 2 {
+		t.Fatalf("got %d query spans, want 2", len(spans))
+	}
+	encodings := map[string]bool{}
+	for _, span := range spans {
+		encodings[span.Attributes["app.encoding.request"]+"/"+span.Attributes["app.encoding.response"]] = true
+	}
+	if !encodings["protobuf/protobuf"] || !encodings["json/json"] {
+		t.Errorf("span encodings %v, want protobuf/protobuf and json/json", encodings)
+	}
+}
+
+func TestQueryInvalidBodyTelemetry(t *testing.T) {
+	handler, collector, flush := newTestService(t, okProfile)
+
+	rec := postQuery(handler, `{not json`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	flush()
+
+	if server := collector.Span(t, "database-service"); server.StatusCode != "unset" {
+		t.Errorf("server span status %s, want unset for a 400", server.StatusCode)
+	}
+	span := collector.Span(t, "Database Query")
+	if span.StatusCode != "error" || span.StatusMessage != "invalid request" {
+		t.Errorf("Database Query status %s %q, want error \"invalid request\"", span.StatusCode, span.StatusMessage)
+	}
+	if points := collector.PointsNamed("db_queries_total", nil); len(points) != 0 {
+		t.Errorf("db_queries_total recorded for an invalid body: %+v", points)
+	}
+}
+
+func TestQueryBudgetExceededTelemetry(t *testing.T) {
+	handler, collector, flush := newTestService(t, slowProfile)
+
+	req := httptest.NewRequest(http.MethodPost, "/db/query", strings.NewReader(`{"user_id":"user_1","amount":10,"operation":"deposit"}`))
+	req.Header.Set(httpx.HeaderBudget, "500")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGatewayTimeout || !strings.Contains(rec.Body.String(), "request budget exceeded") {
+		t.Fatalf("status = %d body %s, want 504 budget exceeded", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("answered after %v, want the query dropped without waiting", elapsed)
+	}
+	flush()
+
+	span := collector.Span(t, "Database Query")
+	if span.StatusCode != "error" || !strings.Contains(span.StatusMessage, "request budget exceeded") {
+		t.Errorf("Database Query status %s %q, want the budget error", span.StatusCode, span.StatusMessage)
+	}
+	telemetrytest.AssertAttributes(t, "Database Query", span.Attributes, map[string]string{
+		"app.budget.remaining_ms": "*",
+		"app.budget.exceeded":     "true",
+	})
+	assertCount(t, collector, "db_budget_exceeded_total", map[string]string{"stage": "query", "operation": "deposit"}, 1)
+	assertCount(t, collector, "db_errors_total", map[string]string{"error_type": "budget_exceeded", "operation": "deposit"}, 1)
+}
+
+func TestCanaryOnlyIncidents(t *testing.T) {
+	t.Cleanup(func() { deployTrack = trackStable })
+	for _, track := range []string{trackStable, trackCanary} {
+		deployTrack = track
+		got := slices.Contains(simulatedIncidents(), "bad_canary")
+		if want := track == trackCanary; got != want {
+			t.Errorf("%s simulates bad_canary = %v, want %v", track, got, want)
+		}
+	}
+
+	handler, collector, flush := newTestService(t, okProfile, "-track=canary")
+	if rec := postQuery(handler, `{"user_id":"user_1","amount":10,"operation":"deposit"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	flush()
+	telemetrytest.AssertAttributes(t, "Database Query", collector.Span(t, "Database Query").Attributes, map[string]string{"sim.deploy.track": "canary"})
+}
+
+func TestIncidentStateRestore(t *testing.T) {
+	_, collector, flush := newTestService(t, okProfile)
+	stateFile = filepath.Join(t.TempDir(), "incident.json")
+	t.Cleanup(func() { stateFile = "" })
+	ctx := context.Background()
+
+	// Ended while the service was down: announced, not resumed
+	saved := incidentState{Type: "deadlock", StartedAt: time.Now().Add(-2 * time.Minute), EndsAt: time.Now().Add(-time.Minute)}
+	saveIncidentState(ctx, &saved)
+	restoreIncident(ctx)
+	if atomic.LoadInt64(&incidentActive) != 0 {
+		t.Fatal("expired incident was resumed")
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("state file of an expired incident kept: %v", err)
+	}
+
+	saved = incidentState{Type: "deadlock", Operation: "deposit", StartedAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Minute)}
+	saveIncidentState(ctx, &saved)
+	restoreIncident(ctx)
+	if atomic.LoadInt64(&incidentActive) != 1 || activeIncidentType() != "deadlock" || currentScope().Operation != "deposit" {
+		t.Fatalf("incident %s scope %s after restore, want deadlock on deposit", activeIncidentType(), currentScope())
+	}
+	if st, err := loadIncidentState(stateFile); err != nil || st == nil || !st.StartedAt.Equal(saved.StartedAt) {
+		t.Errorf("state after restore = %+v, %v; want the original start kept", st, err)
+	}
+	if e := events.lastRestart(); e == nil || e.Type != "service_restarted" || e.IncidentType != "deadlock" {
+		t.Errorf("restart event = %+v, want service_restarted for deadlock", e)
+	}
+
+	clearIncident <- struct{}{}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt64(&incidentActive) == 1 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("state file kept after the incident ended: %v", err)
+	}
+
+	flush()
+	spans := collector.SpansNamed("Restore Incident State")
+	if len(spans) != 2 {
+		t.Fatalf("got %d restore spans, want 2", len(spans))
+	}
+	telemetrytest.AssertAttributes(t, "Restore Incident State", spans[1].Attributes, map[string]string{
+		"sim.incident.type":    "deadlock",
+		"sim.incident.scope":   "operation=deposit",
+		"sim.incident.resumed": "true",
+	})
+}
+
+func TestErrorStorm(t *testing.T) {
+	handler, collector, flush := newTestService(t, okProfile)
+	if !startIncident(context.Background(), "error_storm", incidentScope{}, time.Minute, "", nil) {
+		t.Fatal("error_storm not started")
+	}
+	rec := postQuery(handler, `{"user_id":"user_1","amount":10,"operation":"deposit"}`)
+	clearIncident <- struct{}{}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt64(&incidentActive) == 1 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d during an error storm, want 503 so callers retry", rec.Code)
+	}
+	if rec := postQuery(handler, `{"user_id":"user_1","amount":10,"operation":"deposit"}`); rec.Code != http.StatusOK {
+		t.Errorf("status = %d after the storm, want 200", rec.Code)
+	}
+	flush()
+	assertCount(t, collector, "db_errors_total", map[string]string{"error_type": "error_storm", "operation": "deposit"}, 1)
+}
+
+func TestGoroutineLeak(t *testing.T) {
+	r := newResourceExhaustion(1, 1, 1, 50, 80)
+	restore := r.leakGoroutines()
+	time.Sleep(2200 * time.Millisecond)
+	if n := r.leakedGoroutines.Load(); n != 80 {
+		t.Errorf("%d goroutines leaked, want the 80 cap", n)
+	}
+	restore()
+	for deadline := time.Now().Add(time.Second); r.leakedGoroutines.Load() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := r.leakedGoroutines.Load(); n != 0 {
+		t.Errorf("%d goroutines still blocked after the incident", n)
+	}
+
+	// 12 samples 5s apart over a 1m window: a steady climb is suspected, a
+	// noisy flat count is not
+	ctx := context.Background()
+	start := time.Now()
+	climbing, flat := newGoroutineWatch(time.Minute, 100), newGoroutineWatch(time.Minute, 100)
+	for i := range 12 {
+		at := start.Add(time.Duration(i) * 5 * time.Second)
+		climbing.observe(ctx, at, 200+15*i)
+		flat.observe(ctx, at, 200+40*(i%2))
+	}
+	if growth, full := climbing.growth(); !full || growth < 170 || growth > 190 || !climbing.suspected {
+		t.Errorf("climbing growth %.1f/min (full window %v, suspected %v), want 180 and suspected", growth, full, climbing.suspected)
+	}
+	if growth, _ := flat.growth(); growth > 50 || flat.suspected {
+		t.Errorf("flat growth %.1f/min (suspected %v), want none", growth, flat.suspected)
+	}
+}
+
+// percentiles samples d 20000 times and returns the p50 and p99
+func percentiles(d latencyDistribution, latency, jitter time.Duration) (time.Duration, time.Duration) {
+	samples := make([]time.Duration, 20000)
+	for i := range samples {
+		samples[i] = d.sample(latency, jitter)
+	}
+	slices.Sort(samples)
+	return samples[len(samples)/2], samples[len(samples)*99/100]
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	// Every shape keeps the uniform median of 100ms + 100ms/2
+	for _, tc := range []struct {
+		dist           latencyDistribution
+		minP99, maxP99 time.Duration
+		minP50, maxP50 time.Duration
+	}{
+		{latencyDistribution{}, 195 * time.Millisecond, 200 * time.Millisecond, 140 * time.Millisecond, 160 * time.Millisecond},
+		{latencyDistribution{Kind: latencyLognormal}, 400 * time.Millisecond, 600 * time.Millisecond, 140 * time.Millisecond, 160 * time.Millisecond},
+		{latencyDistribution{Kind: latencyPareto, Alpha: 1.2}, 3 * time.Second, 10 * time.Second, 140 * time.Millisecond, 160 * time.Millisecond},
+	} {
+		p50, p99 := percentiles(tc.dist, 100*time.Millisecond, 100*time.Millisecond)
+		if p50 < tc.minP50 || p50 > tc.maxP50 || p99 < tc.minP99 || p99 > tc.maxP99 {
+			t.Errorf("%q: p50 %v, p99 %v", tc.dist.Kind, p50, p99)
+		}
+	}
+
+	// A fifth of the queries miss the cache and land around 1s, the rest stay
+	// around 10ms
+	bimodal := latencyDistribution{Kind: latencyBimodal, SlowRatio: 0.2, Slow: time.Second, Sigma: 0.1}
+	var slow int
+	for range 10000 {
+		if bimodal.sample(10*time.Millisecond, 0) > 100*time.Millisecond {
+			slow++
+		}
+	}
+	if slow < 1800 || slow > 2200 {
+		t.Errorf("%d of 10000 bimodal samples slow, want about 2000", slow)
+	}
+
+	if got := (latencyDistribution{Kind: latencyPareto, Alpha: 0.5, Max: time.Second}).sample(time.Second, 0); got > time.Second {
+		t.Errorf("pareto sample %v above its 1s max", got)
+	}
+	if err := (latencyDistribution{Kind: "gamma"}).validate(); err == nil {
+		t.Error("unknown distribution kind accepted")
+	}
+
+	// A scenario's distribution replaces the profile's while it runs
+	profiles := operationProfiles{defaultOperation: {Latency: 10 * time.Millisecond}}
+	activeLatency.Store(&latencyDistribution{Kind: latencyBimodal, SlowRatio: 1, Slow: time.Second, Sigma: 0.01})
+	defer activeLatency.Store(nil)
+	if _, latency := profiles.behaviour("get_balance", "none"); latency < 900*time.Millisecond {
+		t.Errorf("latency %v under a scenario answering every query slowly", latency)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	handler, collector, flush := newTestService(t, okProfile, "-dev-mode")
+	balance := func(userID string) float64 {
+		t.Helper()
+		rec := postQuery(handler, `{"user_id":"`+userID+`","operation":"get_balance"}`)
+		var resp struct {
+			Data struct {
+				Balance float64 `json:"balance"`
+			} `json:"data"`
+		}
+		if err := jsonx.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("get_balance %s: status %d, %v", userID, rec.Code, err)
+		}
+		return resp.Data.Balance
+	}
+
+	opening := openingBalance("user_1")
+	if got := balance("user_1"); got != opening || balance("user_1") != opening {
+		t.Fatalf("user_1 balance = %g, want the opening %g on every read", got, opening)
+	}
+	postQuery(handler, `{"user_id":"user_1","amount":100,"operation":"deposit"}`)
+	postQuery(handler, `{"user_id":"user_1","amount":30,"operation":"transfer_debit"}`)
+	postQuery(handler, `{"user_id":"user_2","amount":30,"operation":"transfer_credit"}`)
+	if got, want := balance("user_1"), round2(opening+70); got != want {
+		t.Errorf("user_1 balance = %g, want %g", got, want)
+	}
+	if got, want := balance("user_2"), round2(openingBalance("user_2")+30); got != want {
+		t.Errorf("user_2 balance = %g, want %g", got, want)
+	}
+
+	// A balance_drift write answers as usual but stores the wrong amount
+	dbLedger.apply(context.Background(), DatabaseRequest{UserID: "user_3", Amount: 100, Operation: "deposit"}, true)
+	if s := dbLedger.summary(); s.Accounts != 3 || s.DriftedAccounts != 1 || s.Drift < 1 || s.Drift > 10 {
+		t.Fatalf("summary after a drifted write = %+v, want user_3 off by 1-10", s)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/db/admin/ledger/reconcile", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reconcile status = %d, body %s", rec.Code, rec.Body)
+	}
+	if s := dbLedger.summary(); s.DriftedAccounts != 0 || s.Drift != 0 {
+		t.Errorf("summary after reconcile = %+v, want no drift", s)
+	}
+
+	flush()
+	assertCount(t, collector, "db_ledger_drifted_writes_total", nil, 1)
+	assertCount(t, collector, "db_ledger_accounts", nil, 3)
+	telemetrytest.AssertAttributes(t, "Database Query", collector.SpansNamed("Database Query")[0].Attributes, map[string]string{
+		"app.account.balance": strconv.FormatFloat(opening, 'f', -1, 64),
+	})
+
+	// A ledger file keeps the accounts across a restart
+	path := filepath.Join(t.TempDir(), "ledger.db")
+	l, err := openLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.drifted = dbLedger.drifted
+	want := l.apply(context.Background(), DatabaseRequest{UserID: "user_1", Amount: 12.5, Operation: "withdrawal"}, false)
+	l.close()
+	if l, err = openLedger(path); err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	if got := l.apply(context.Background(), DatabaseRequest{UserID: "user_1", Operation: "get_balance"}, false); got != want || got != round2(opening-12.5) {
+		t.Errorf("balance after reopening = %g, want %g", got, want)
+	}
+}
+
+func TestDataCorruption(t *testing.T) {
+	handler, collector, flush := newTestService(t, okProfile)
+	corruption := "data_corruption"
+	incidentType.Store(&corruption)
+	atomic.StoreInt64(&incidentActive, 1)
+	t.Cleanup(func() {
+		atomic.StoreInt64(&incidentActive, 0)
+		incidentType.Store(nil)
+	})
+
+	opening := openingBalance("user_1")
+	corrupted := 0
+	for range 40 {
+		rec := postQuery(handler, `{"user_id":"user_1","operation":"balance_check"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 while corrupting", rec.Code)
+		}
+		var resp DatabaseResponse
+		if err := jsonx.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Status != "success" {
+			t.Fatalf("response %s: %v, want a success", rec.Body, err)
+		}
+		data := resp.Data.(map[string]interface{})
+		if data["balance"] != opening || data["currency"] != "USD" || data["user_id"] != "user_1" {
+			corrupted++
+		}
+	}
+	if corrupted == 0 || corrupted == 40 {
+		t.Errorf("%d of 40 responses corrupted, want some but not all", corrupted)
+	}
+	if balance := dbLedger.apply(context.Background(), DatabaseRequest{UserID: "user_1", Operation: "get_balance"}, false); balance != opening {
+		t.Errorf("ledger balance = %g, want %g untouched", balance, opening)
+	}
+
+	flush()
+	var counted float64
+	for _, p := range collector.PointsNamed("db_simulated_corrupted_responses_total", map[string]string{"operation": "balance_check"}) {
+		counted += p.Value
+	}
+	var labelled int
+	for _, span := range collector.SpansNamed("Database Query") {
+		if span.Attributes["sim.response.corruption"] != "" {
+			labelled++
+		}
+	}
+	if int(counted) != corrupted || labelled != corrupted {
+		t.Errorf("corruptions counted %g and labelled on %d spans, want %d", counted, labelled, corrupted)
+	}
+}
+
+func TestIncidentHistory(t *testing.T) {
+	handler, _, _ := newTestService(t, okProfile)
+	ctx := context.Background()
+	run := func(incident string, scope incidentScope, queries int) {
+		t.Helper()
+		if !startIncident(ctx, incident, scope, time.Minute, "", nil) {
+			t.Fatalf("%s not started", incident)
+		}
+		for range queries {
+			postQuery(handler, `{"user_id":"user_1","amount":10,"operation":"deposit"}`)
+		}
+		clearIncident <- struct{}{}
+		for deadline := time.Now().Add(time.Second); atomic.LoadInt64(&incidentActive) == 1 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	run("error_storm", incidentScope{}, 3)
+	run("high_latency", incidentScope{Operation: "withdraw"}, 0)
+
+	list := func(query string) (int, IncidentPage) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/incidents?"+query, nil))
+		var page IncidentPage
+		if rec.Code == http.StatusOK {
+			if err := jsonx.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, page
+	}
+
+	// Newest first, a page at a time
+	_, page := list("limit=1")
+	if len(page.Incidents) != 1 || page.Incidents[0].Type != "high_latency" || page.Incidents[0].Scope != "operation=withdraw" || page.Total != 2 || page.NextCursor == "" {
+		t.Fatalf("first page = %+v, want high_latency on withdraw of 2 and a cursor", page)
+	}
+	_, page = list("limit=1&cursor=" + page.NextCursor)
+	if len(page.Incidents) != 1 || page.NextCursor != "" {
+		t.Fatalf("second page = %+v, want the last incident", page)
+	}
+	storm := page.Incidents[0]
+	if storm.Type != "error_storm" || storm.EndedAt == nil || storm.EndReason != endCleared ||
+		storm.Requests != 3 || storm.Errors != 3 || storm.PeakErrorRate != 1 {
+		t.Errorf("error_storm record = %+v, want 3 of 3 queries failed and cleared", storm)
+	}
+
+	for query, want := range map[string]int{
+		"type=error_storm": 1,
+		"since=1m":         2,
+		"until=1h":         0,
+		"since=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)): 0,
+	} {
+		if _, page := list(query); page.Total != want {
+			t.Errorf("%s: %d incidents, want %d", query, page.Total, want)
+		}
+	}
+	for _, query := range []string{"limit=0", "limit=x", "since=yesterday", "cursor=-1"} {
+		if code, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, code)
+		}
+	}
+
+	// Persisted across restarts, keeping the newest
+	historyFile := filepath.Join(t.TempDir(), "incidents.jsonl")
+	history, err := openIncidentHistory(historyFile, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.start(incidentState{Type: "deadlock", StartedAt: time.Now()})
+	history.end(ctx, endExpired)
+	history.interrupted(ctx, incidentState{Type: "disk_full", StartedAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Minute)})
+	reopened, err := openIncidentHistory(historyFile, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page := reopened.list(incidentFilter{limit: 10}); page.Total != 1 || page.Incidents[0].Type != "disk_full" || page.Incidents[0].EndReason != endInterrupted {
+		t.Errorf("reopened history = %+v, want the interrupted disk_full incident", page)
+	}
+	if data, _ := os.ReadFile(historyFile); bytes.Count(data, []byte("\n")) != 1 {
+		t.Errorf("history file has %d records after reopening, want it compacted to 1", bytes.Count(data, []byte("\n")))
+	}
+}
+
+func assertCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want float64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Value != want {
+		t.Errorf("%s%v points = %+v, want one of %g", name, attrs, points, want)
+	}
+}
+
+func assertHistogramCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want uint64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Count != want {
+		t.Errorf("%s%v points = %+v, want one with count %d", name, attrs, points, want)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"incident-simulation/pkg/simrand"
+)
+
+// Kinds of latency distribution
+const (
+	latencyUniform   = "uniform"
+	latencyLognormal = "lognormal"
+	latencyPareto    = "pareto"
+	latencyBimodal   = "bimodal"
+)
+
+// maxSampledLatency caps a sampled latency without its own max, so a heavy
+// tail cannot hang a query
+const maxSampledLatency = 30 * time.Second
+
+// latencyDistribution is the shape of the latency a profile or incident adds
+// to a query. Uniform adds latency plus up to jitter, as the simulator always
+// has. The others are centred on latency + jitter/2, the uniform median, so
+// that switching shape keeps typical queries about as fast:
+//   - lognormal spreads around it by sigma (default 0.5), the right-skewed
+//     shape of real service latency
+//   - pareto puts a power-law tail behind it, heavier for a lower alpha
+//     (default 1.5), so p99 sits far from the median
+//   - bimodal answers slow_ratio (default 0.2) of the queries around slow
+//     (default 10x the median) and the rest around the median, like cache
+//     misses next to hits
+type latencyDistribution struct {
+	Kind      string        `yaml:"kind" json:"kind"`
+	Sigma     float64       `yaml:"sigma" json:"sigma,omitempty"`
+	Alpha     float64       `yaml:"alpha" json:"alpha,omitempty"`
+	SlowRatio float64       `yaml:"slow_ratio" json:"slow_ratio,omitempty"`
+	Slow      time.Duration `yaml:"slow" json:"slow,omitempty"`
+	Max       time.Duration `yaml:"max" json:"max,omitempty"`
+}
+
+// activeLatency overrides the distribution of every operation while a
+// scheduled scenario with its own latency runs
+var activeLatency atomic.Pointer[latencyDistribution]
+
+func (d latencyDistribution) validate() error {
+	switch d.Kind {
+	case "", latencyUniform, latencyLognormal, latencyPareto, latencyBimodal:
+	default:
+		return fmt.Errorf("unknown latency distribution %q: want uniform, lognormal, pareto or bimodal", d.Kind)
+	}
+	if d.Sigma < 0 || d.Alpha < 0 || d.Slow < 0 || d.Max < 0 {
+		return fmt.Errorf("latency distribution parameters must not be negative")
+	}
+	if d.SlowRatio < 0 || d.SlowRatio > 1 {
+		return fmt.Errorf("latency distribution slow_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// sample returns a latency for a profile or incident of latency and jitter
+func (d latencyDistribution) sample(latency, jitter time.Duration) time.Duration {
+	if d.Kind == "" || d.Kind == latencyUniform {
+		return latency + randDuration(jitter)
+	}
+	median := float64(latency + jitter/2)
+	if median <= 0 {
+		return 0
+	}
+
+	var v float64
+	switch d.Kind {
+	case latencyLognormal:
+		v = lognormal(median, d.sigma())
+	case latencyPareto:
+		alpha := d.Alpha
+		if alpha == 0 {
+			alpha = 1.5
+		}
+		// The scale whose distribution has the median wanted
+		scale := median / math.Pow(2, 1/alpha)
+		v = scale / math.Pow(1-simrand.Float64(), 1/alpha)
+	case latencyBimodal:
+		ratio, slow := d.SlowRatio, float64(d.Slow)
+		if ratio == 0 {
+			ratio = 0.2
+		}
+		if slow == 0 {
+			slow = 10 * median
+		}
+		if simrand.Float64() < ratio {
+			median = slow
+		}
+		v = lognormal(median, d.sigma())
+	}
+
+	limit := d.Max
+	if limit == 0 {
+		limit = maxSampledLatency
+	}
+	return min(time.Duration(v), limit)
+}
+
+func (d latencyDistribution) sigma() float64 {
+	if d.Sigma == 0 {
+		return 0.5
+	}
+	return d.Sigma
+}
+
+func lognormal(median, sigma float64) float64 {
+	return median * math.Exp(sigma*simrand.NormFloat64())
+}
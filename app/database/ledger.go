@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/simrand"
+)
+
+// How each write moves the balance of its account; other operations only read
+var ledgerDirections = map[string]float64{
+	"deposit":             1,
+	"transfer_credit":     1,
+	"transfer_compensate": 1,
+	"withdrawal":          -1,
+	"transfer_debit":      -1,
+}
+
+// account is one user's row of the ledger. Expected is the balance the writes
+// applied to it add up to; only a balance_drift incident makes Balance
+// differ from it.
+type account struct {
+	Balance  float64 `json:"balance"`
+	Expected float64 `json:"expected"`
+}
+
+// drift is how far the stored balance is off the one its writes add up to
+func (a account) drift() float64 { return a.Balance - a.Expected }
+
+// LedgerSummary is the reconciliation of every account against its writes
+type LedgerSummary struct {
+	Accounts        int     `json:"accounts"`
+	TotalBalance    float64 `json:"total_balance"`
+	Drift           float64 `json:"drift"`
+	DriftedAccounts int     `json:"drifted_accounts"`
+	Persistent      bool    `json:"persistent"`
+}
+
+// ledger keeps account balances, so repeated reads of a user agree, writes
+// show up in later reads and transfers move money from one account to
+// another. Accounts open on first use with a balance derived from the user
+// ID. With DB_LEDGER_FILE the accounts are written through to a BoltDB file
+// and survive restarts; otherwise they live in memory.
+type ledger struct {
+	mu       sync.Mutex
+	accounts map[string]*account
+	db       *bolt.DB
+
+	drifted metric.Int64Counter
+}
+
+var ledgerBucket = []byte("accounts")
+
+// openLedger returns an in-memory ledger for an empty path, or one loaded
+// from and written through to the BoltDB file at path
+func openLedger(path string) (*ledger, error) {
+	l := &ledger{accounts: make(map[string]*account)}
+	if path == "" {
+		return l, nil
+	}
+
+	// A simulated ledger need not survive a power cut, so writes skip fsync
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 5 * time.Second, NoSync: true})
+	if err != nil {
+		return nil, fmt.Errorf("open ledger %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(ledgerBucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var a account
+			if err := jsonx.Unmarshal(v, &a); err != nil {
+				return fmt.Errorf("account %s: %w", k, err)
+			}
+			l.accounts[string(k)] = &a
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load ledger %s: %w", path, err)
+	}
+	l.db = db
+	return l, nil
+}
+
+func (l *ledger) close() error {
+	if l.db == nil {
+		return nil
+	}
+	return l.db.Close()
+}
+
+// openingBalance is the balance an account opens with, the same for a user
+// on every replica and after every restart
+func openingBalance(userID string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return 1000 + float64(h.Sum32()%900000)/100
+}
+
+// apply runs req against the account of its user and returns the balance
+// after it. A drifting write stores an amount off by 1-10% while the
+// expected balance gets the right one, the silent corruption of a
+// balance_drift incident.
+func (l *ledger) apply(ctx context.Context, req DatabaseRequest, drift bool) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.accounts[req.UserID]
+	if !ok {
+		opening := openingBalance(req.UserID)
+		a = &account{Balance: opening, Expected: opening}
+		l.accounts[req.UserID] = a
+	}
+	direction, write := ledgerDirections[req.Operation]
+	if !write {
+		if !ok {
+			l.persist(ctx, req.UserID, *a)
+		}
+		return a.Balance
+	}
+
+	amount := direction * req.Amount
+	a.Expected = round2(a.Expected + amount)
+	if drift {
+		off := 0.01 + simrand.Float64()*0.09
+		if simrand.Intn(2) == 0 {
+			off = -off
+		}
+		amount *= 1 + off
+		l.drifted.Add(ctx, 1)
+	}
+	a.Balance = round2(a.Balance + amount)
+	l.persist(ctx, req.UserID, *a)
+	return a.Balance
+}
+
+// persist writes a through to the ledger file; a failed write keeps the
+// change in memory and is only logged
+func (l *ledger) persist(ctx context.Context, userID string, a account) {
+	if l.db == nil {
+		return
+	}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		v, err := jsonx.Marshal(a)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(ledgerBucket).Put([]byte(userID), v)
+	})
+	if err != nil {
+		logx.Errorw(ctx, "Failed to write ledger account", "user.id", userID, "error", err)
+	}
+}
+
+// summary reconciles every account against its writes
+func (l *ledger) summary() LedgerSummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := LedgerSummary{Accounts: len(l.accounts), Persistent: l.db != nil}
+	for _, a := range l.accounts {
+		s.TotalBalance += a.Balance
+		if d := a.drift(); d != 0 {
+			s.Drift += math.Abs(d)
+			s.DriftedAccounts++
+		}
+	}
+	s.TotalBalance, s.Drift = round2(s.TotalBalance), round2(s.Drift)
+	return s
+}
+
+// reconcile resets every drifted account to its expected balance and
+// returns the summary from before
+func (l *ledger) reconcile(ctx context.Context) LedgerSummary {
+	before := l.summary()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for userID, a := range l.accounts {
+		if a.drift() != 0 {
+			a.Balance = a.Expected
+			l.persist(ctx, userID, *a)
+		}
+	}
+	return before
+}
+
+// round2 rounds to cents, so float error does not show up as drift
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
+
+// registerMetrics exports the reconciliation a correctness check would alert on
+func (l *ledger) registerMetrics(ctx context.Context) {
+	meter := otel.Meter("database-service")
+
+	var err error
+	l.drifted, err = meter.Int64Counter("db_ledger_drifted_writes_total",
+		metric.WithDescription("Ledger writes stored with a wrong amount during a balance_drift incident"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create ledger drift counter", "error", err)
+	}
+
+	accounts, err := meter.Int64ObservableGauge("db_ledger_accounts",
+		metric.WithDescription("Accounts in the ledger"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create ledger accounts gauge", "error", err)
+		return
+	}
+
+	drift, err := meter.Float64ObservableGauge("db_ledger_drift",
+		metric.WithDescription("Sum over accounts of how far the stored balance is off the one its writes add up to"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create ledger drift gauge", "error", err)
+		return
+	}
+
+	drifted, err := meter.Int64ObservableGauge("db_ledger_drifted_accounts",
+		metric.WithDescription("Accounts whose stored balance is off the one their writes add up to"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create ledger drifted accounts gauge", "error", err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		s := l.summary()
+		o.ObserveInt64(accounts, int64(s.Accounts))
+		o.ObserveFloat64(drift, s.Drift)
+		o.ObserveInt64(drifted, int64(s.DriftedAccounts))
+		return nil
+	}, accounts, drift, drifted)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register ledger gauge callback", "error", err)
+	}
+}
@@ -2,43 +2,59 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
-	"os"
-	"strconv"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"go.opentelemetry.io/contrib/bridges/otellogrus"
-
-	"github.com/joho/godotenv"
-	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/propagation"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/chaos"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/dbproto"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/probes"
+	"incident-simulation/pkg/profiling"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
 )
 
 // Global incident state
 var (
-	incidentActive int64  = 0
-	incidentType   string = "none"
+	incidentActive int64 = 0
+	// incidentType is the active incident's type, nil between incidents
+	incidentType atomic.Pointer[string]
+	// clearIncident ends the active incident early; sends only succeed while one is active
+	clearIncident = make(chan struct{})
 )
 
+// activeIncidentType is the active incident's type, "none" between incidents
+func activeIncidentType() string {
+	if t := incidentType.Load(); t != nil {
+		return *t
+	}
+	return "none"
+}
+
 type DatabaseRequest struct {
 	UserID    string  `json:"user_id"`
 	Amount    float64 `json:"amount"`
@@ -51,126 +67,257 @@ type DatabaseResponse struct {
 	Error     string      `json:"error,omitempty"`
 	QueryTime float64     `json:"query_time_ms"`
 	Timestamp int64       `json:"timestamp"`
+	httpx.ErrorRef
 }
 
 // Metrics
 var (
-	queryCounter  metric.Int64Counter
-	errorCounter  metric.Int64Counter
-	queryDuration metric.Float64Histogram
-	dbConnections metric.Int64UpDownCounter
-	incidentGauge metric.Int64ObservableGauge
+	queryCounter     metric.Int64Counter
+	errorCounter     metric.Int64Counter
+	queryDuration    metric.Float64Histogram
+	poolWaitDuration metric.Float64Histogram
+	poolExhausted    metric.Int64Counter
+	budgetExceeded   metric.Int64Counter
+	incidentGauge    metric.Int64ObservableGauge
+	// Ground truth of data_corruption incidents, like the sim.* span attributes
+	corruptedResponses metric.Int64Counter
+
+	eventSubscribers metric.Int64UpDownCounter
+)
+
+// Attribute sets of every query, built once for the built-in operations
+var (
+	queryDurationAttrs = telemetry.NewMeasurements(builtinOperations, func(op string) telemetry.Measurement {
+		return telemetry.NewMeasurement(attribute.String("service", "database"), attribute.String("operation", op))
+	})
+	querySuccessAttrs = telemetry.NewMeasurements(builtinOperations, func(op string) telemetry.Measurement {
+		return telemetry.NewMeasurement(attribute.String("status", "success"), attribute.String("operation", op))
+	})
 )
 
+// Simulated connection pool shared by queries and the pool_exhaustion incident
+var pool *connPool
+
+// Memory, CPU and goroutine consumers of the memory_leak, cpu_spin and
+// goroutine_leak incidents
+var exhaustion *resourceExhaustion
+
+// Synthetic SQL run by queries; high_latency incidents slow some of it down
+var sqlStatements statements
+
+// Outbox table written by committed writes and drained by the worker service
+var dbOutbox *outbox
+
+// Account balances read and moved by queries
+var dbLedger *ledger
+
+// Incidents this instance ran, for GET /db/incidents
+var dbHistory *incidentHistory
+
+// Release track of this version, DB_TRACK; only a canary runs bad_canary incidents
+var deployTrack = trackStable
+
 func main() {
 	ctx := context.Background()
 
+	// Load configuration (flags > env > .env > YAML > defaults)
+	var cfg Config
+	config.MustLoad(&cfg)
+	log.Println("⚙️  Database Service configuration:")
+	config.Print(log.Writer(), &cfg)
+
+	// Seeded runs replay the same simulator decisions; replicas get their own sequence
+	if cfg.SimSeed != 0 {
+		simrand.Seed(cfg.SimSeed + int64(cfg.InstanceIndex))
+	}
+
+	// With DB_INSTANCES > 1 this process only supervises and balances replicas
+	if cfg.Instances > 1 {
+		runInstances(cfg)
+		return
+	}
+
+	// In-memory buffer of recent spans and logs for /debug/telemetry/recent
+	recorder := telemetry.NewRecorder("database-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	// Export outcomes for /debug/otel
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	// Per-minute latency histograms and error counts for /debug/latency-heatmap and /debug/export
+	heatmap := telemetry.NewHeatmap("database-service", cfg.LatencyHeatmapMinutes)
+
 	// Initialize OpenTelemetry
-	shutdown := initOpenTelemetry(ctx, "database-service")
+	shutdown := initOpenTelemetry(ctx, "database-service", cfg.Telemetry, recorder, health, heatmap)
 	defer shutdown()
 
+	// Optional pprof endpoints and continuous profiling
+	stopProfiling := profiling.Start("database-service", cfg.Profiling, "localhost:6061")
+	defer stopProfiling()
+
+	// Audit trail of incidents, deployments and admin actions
+	if err := audit.Setup("database-service", instanceStateFile(cfg.AuditLogFile, cfg.InstanceIndex), cfg.AuditLogKeep); err != nil {
+		log.Fatalf("Invalid audit log: %v", err)
+	}
+	defer audit.Close()
+
+	// Bounded connection pool
+	pool = newConnPool(cfg.PoolMaxConnections, cfg.PoolMaxScale, cfg.PoolMaxWaiting, cfg.PoolAcquireTimeout)
+	exhaustion = newResourceExhaustion(cfg.LeakMBPerSecond, cfg.LeakMaxMB, cfg.CPUSpinGoroutines, cfg.GoroutineLeakPerSecond, cfg.GoroutineLeakMax)
+	dbOutbox = newOutbox(cfg.OutboxMaxEvents, cfg.InstanceIndex)
+	deployTrack = cfg.Track
+	// Every replica keeps its own ledger, in its own file when persisted
+	var err error
+	dbLedger, err = openLedger(instanceStateFile(cfg.LedgerFile, cfg.InstanceIndex))
+	if err != nil {
+		log.Fatalf("Invalid ledger: %v", err)
+	}
+	defer dbLedger.close()
+	dbHistory, err = openIncidentHistory(instanceStateFile(cfg.IncidentHistoryFile, cfg.InstanceIndex), cfg.IncidentHistoryMax, cfg.InstanceIndex)
+	if err != nil {
+		log.Fatalf("Invalid incident history: %v", err)
+	}
+
 	// Initialize metrics
 	initMetrics(ctx)
+	if err := buildinfo.RegisterMetric("database-service"); err != nil {
+		logx.Errorw(ctx, "Failed to create build info gauge", "error", err)
+	}
+	if cfg.SimLabelSpans {
+		if err := telemetry.LabelIncidents(func() (bool, string) {
+			return atomic.LoadInt64(&incidentActive) == 1, activeIncidentType()
+		}); err != nil {
+			logx.Errorw(ctx, "Failed to label spans with the active incident", "error", err)
+		}
+	}
+	pool.registerMetrics(ctx)
+	exhaustion.registerMetrics(ctx)
+	dbOutbox.registerMetrics(ctx)
+	dbLedger.registerMetrics(ctx)
+
+	// Go runtime metrics (heap, GC, goroutines, scheduler) show the resource incidents
+	if err := runtime.Start(runtime.WithMinimumReadMemStatsInterval(5 * time.Second)); err != nil {
+		logx.Errorw(ctx, "Failed to start runtime metrics", "error", err)
+	}
+	// The goroutine trend catches a slow leak the count alone does not
+	goroutines := newGoroutineWatch(cfg.GoroutineWatchWindow, cfg.GoroutineGrowthThreshold)
+	goroutines.registerMetrics(ctx)
+	go goroutines.run(ctx)
+
+	// Recurring incidents from DB_INCIDENT_SCHEDULE_FILE
+	scenarios, err := loadSchedule(cfg.IncidentScheduleFile)
+	if err != nil {
+		log.Fatalf("Invalid incident schedule: %v", err)
+	}
+	runSchedule(ctx, scenarios)
+
+	// An incident that was active when the service last stopped picks up where it left off
+	stateFile = instanceStateFile(cfg.StateFile, cfg.InstanceIndex)
+	restoreIncident(ctx)
 
 	// Start background incident simulator
-	go incidentSimulator(ctx)
+	go incidentSimulator(ctx, cfg.IncidentInterval, cfg.IncidentProbability, cfg.ErrorStormDuration, partialIncidents{
+		probability:   cfg.PartialIncidentProbability,
+		cohortPercent: cfg.IncidentCohortPercent,
+	})
 
 	// Start database service
-	startDatabaseService()
+	startDatabaseService(cfg, recorder, health, heatmap)
 }
 
-func initOpenTelemetry(ctx context.Context, serviceName string) func() {
-	// Resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(serviceName),
-			semconv.ServiceVersionKey.String("1.0.0"),
-			semconv.DeploymentEnvironmentKey.String("development"),
-		))
+func initOpenTelemetry(ctx context.Context, serviceName string, cfg config.Telemetry, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) func() {
+	// Resource with service information; OTEL_RESOURCE_ATTRIBUTES overrides it
+	res, err := telemetry.NewResource(ctx, serviceName)
 	if err != nil {
 		log.Fatalf("Failed to create resource: %v", err)
 	}
 
-	// OTLP endpoint from environment or default
-	// Import .env file
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using default OTLP endpoint")
-	}
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	fmt.Println("OTLP Endpoint:", otlpEndpoint)
-	if otlpEndpoint == "" {
-		otlpEndpoint = "localhost:4318"
+	// OTLP (endpoint, TLS, headers) or stdout/file exporters
+	exporters, err := telemetry.NewExporters(cfg.OTLP, cfg.Output)
+	if err != nil {
+		log.Fatalf("Invalid telemetry exporter settings: %v", err)
 	}
 
-	// OTLP HTTP trace exporter
-	traceExporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint(otlpEndpoint),
-		otlptracehttp.WithInsecure(),
-	)
+	// Trace exporter
+	traceExporter, err := exporters.Trace(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create trace exporter: %v", err)
 	}
 
+	// Batch span processor whose queue /debug/otel reports
+	spans := telemetry.NewBatchSpanProcessor(health.Spans(traceExporter), cfg.Batching)
+	health.TrackQueue(spans)
+
+	// Personal data is scrubbed before spans and log records are exported or buffered
+	scrubber := telemetry.NewScrubber(cfg.Scrubbing)
+
 	// Trace provider
 	tp := trace.NewTracerProvider(
-		trace.WithBatcher(traceExporter),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(spans)),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(recorder)),
 		trace.WithResource(res),
-		trace.WithSampler(trace.AlwaysSample()),
+		// Ratio sampling, overridden for debug requests
+		trace.WithSampler(telemetry.NewSampler(cfg.Sampling)),
 	)
 	otel.SetTracerProvider(tp)
 
-	// OTLP HTTP metric exporter
-	metricExporter, err := otlpmetrichttp.New(ctx,
-		otlpmetrichttp.WithEndpoint(otlpEndpoint),
-		otlpmetrichttp.WithInsecure(),
-	)
+	// Metric exporter
+	metricExporter, err := exporters.Metric(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create metric exporter: %v", err)
 	}
 
+	views, err := telemetry.ParseViewConfig(cfg.MetricViewBuckets, cfg.MetricViewDropAttributes)
+	if err != nil {
+		log.Fatalf("Invalid metric views: %v", err)
+	}
 	mp := sdkmetric.NewMeterProvider(
 		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter,
-			sdkmetric.WithInterval(5*time.Second))),
+		sdkmetric.WithView(telemetry.View(views)),
+		sdkmetric.WithReader(telemetry.NewPeriodicReader(heatmap.Metrics(health.Metrics(metricExporter)), cfg.Batching)),
 	)
-	otel.SetMeterProvider(mp)
-	otel.SetMeterProvider(mp)
+	// Caps the attribute sets of every counter and histogram the service creates
+	otel.SetMeterProvider(telemetry.GuardCardinality(mp, cfg.MetricCardinalityLimit, views))
 
 	// Log Provider
-	exporter, err := otlploghttp.New(ctx,
-		otlploghttp.WithEndpoint(otlpEndpoint), // Collector endpoint
-		otlploghttp.WithInsecure(),             // Use HTTP (not HTTPS)
-	)
+	exporter, err := exporters.Log(ctx)
 	if err != nil {
-		log.Fatalf("failed to create OTLP log exporter: %v", err)
+		log.Fatalf("failed to create log exporter: %v", err)
 	}
 
 	// Set up the LoggerProvider with a batch processor
 	provider := sdklog.NewLoggerProvider(
-		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(scrubber.LogProcessor()),
+		sdklog.WithProcessor(telemetry.NewBatchLogProcessor(health.Logs(exporter), cfg.Batching)),
+		sdklog.WithProcessor(recorder),
 	)
-	// defer provider.Shutdown(ctx) // Uncomment this line if you want to shutdown the provider gracefully 
+	// defer provider.Shutdown(ctx) // Uncomment this line if you want to shutdown the provider gracefully
 
 	// Set the global logger provider
 	global.SetLoggerProvider(provider)
 
-	// Set up Logrus and bridge it to OpenTelemetry
-	hook := otellogrus.NewHook("database-service", otellogrus.WithLoggerProvider(provider))
-	logrus.AddHook(hook)
-	// Text map propagator
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// Bridge logrus to OpenTelemetry; logx adds service and trace fields
+	logx.Setup(serviceName, provider)
+	if _, err := logx.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+	// Text map propagators from OTEL_PROPAGATORS
+	propagator, err := telemetry.NewPropagator(cfg.Propagators)
+	if err != nil {
+		log.Fatalf("Invalid propagator settings: %v", err)
+	}
+	otel.SetTextMapPropagator(propagator)
 
 	return func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := tp.Shutdown(ctx); err != nil {
-			logrus.WithContext(ctx).Error(err, "error", "shutting down trace provider")
+			logx.Errorw(ctx, "Error shutting down tracer provider", "error", err)
 		}
 		if err := mp.Shutdown(ctx); err != nil {
-			logrus.WithContext(ctx).Error(err, "shutting down meter provider")
+			logx.Errorw(ctx, "shutting down meter provider", "error", err)
 		}
 		// defer provider.Shutdown(ctx) // Uncomment this line if you want to shutdown the provider gracefully
 		provider.Shutdown(ctx)
+		exporters.Close()
 	}
 }
 
@@ -181,150 +328,428 @@ func initMetrics(ctx context.Context) {
 	queryCounter, err = meter.Int64Counter("db_queries_total",
 		metric.WithDescription("Total number of database queries processed"))
 	if err != nil {
-		logrus.WithContext(ctx).Error(err, "Failed to create query counter")
+		logx.Errorw(ctx, "Failed to create query counter", "error", err)
 	}
 
 	errorCounter, err = meter.Int64Counter("db_errors_total",
 		metric.WithDescription("Total number of database errors encountered"))
 	if err != nil {
-		logrus.WithContext(ctx).Error(err, "Failed to create error counter")
+		logx.Errorw(ctx, "Failed to create error counter", "error", err)
 	}
 
 	queryDuration, err = meter.Float64Histogram("db_query_duration_seconds",
 		metric.WithDescription("Database query duration in seconds"))
 	if err != nil {
-		logrus.WithContext(ctx).Error(err, "Failed to create query duration histogram")
+		logx.Errorw(ctx, "Failed to create query duration histogram", "error", err)
+	}
+
+	poolWaitDuration, err = meter.Float64Histogram("db_pool_wait_duration_seconds",
+		metric.WithDescription("Time spent waiting for a pool connection in seconds"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create pool wait duration histogram", "error", err)
+	}
+
+	poolExhausted, err = meter.Int64Counter("db_pool_exhausted_total",
+		metric.WithDescription("Total number of queries rejected because no pool connection became available"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create pool exhausted counter", "error", err)
 	}
 
-	dbConnections, err = meter.Int64UpDownCounter("db_connections_active",
-		metric.WithDescription("Number of active database connections"))
+	budgetExceeded, err = meter.Int64Counter("db_budget_exceeded_total",
+		metric.WithDescription("Total number of queries dropped because they would outlast the caller's time budget, by stage"))
 	if err != nil {
-		logrus.WithContext(ctx).Error(err, "Failed to create db connections counter")
+		logx.Errorw(ctx, "Failed to create budget exceeded counter", "error", err)
+	}
+
+	corruptedResponses, err = meter.Int64Counter("db_simulated_corrupted_responses_total",
+		metric.WithDescription("Successful responses a data_corruption incident answered with wrong fields, by operation and kind"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create corrupted response counter", "error", err)
+	}
+
+	eventSubscribers, err = meter.Int64UpDownCounter("db_event_subscribers",
+		metric.WithDescription("Number of clients connected to the /db/events stream"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create event subscribers counter", "error", err)
 	}
 
 	incidentGauge, err = meter.Int64ObservableGauge("db_incident_active",
 		metric.WithDescription("Whether a database incident is currently active"))
 	if err != nil {
-		logrus.WithContext(ctx).Error(err, "Failed to create incident gauge")
+		logx.Errorw(ctx, "Failed to create incident gauge", "error", err)
 	}
 
 	// Register callback for incident gauge
 	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
 		o.ObserveInt64(incidentGauge, atomic.LoadInt64(&incidentActive),
-			metric.WithAttributes(attribute.String("incident_type", incidentType)))
+			metric.WithAttributes(
+				attribute.String("incident_type", activeIncidentType()),
+				attribute.String("incident_scope", currentScope().String()),
+			))
 		return nil
 	}, incidentGauge)
 	if err != nil {
-		logrus.WithContext(ctx).Error(err, "Failed to register incident gauge callback")
+		logx.Errorw(ctx, "Failed to register incident gauge callback", "error", err)
 	}
 }
 
-func incidentSimulator(ctx context.Context) {
-	ticker := time.NewTicker(45 * time.Second)
-	defer ticker.Stop()
+// incidentTypes are the incidents the simulator and schedule can start
+var incidentTypes = []string{"connection_timeout", "high_latency", "connection_refused", "deadlock", "disk_full", "pool_exhaustion",
+	"memory_leak", "cpu_spin", "connection_churn", "bad_instance", "bad_canary", "balance_drift",
+	"data_corruption", "goroutine_leak", "error_storm"}
+
+// Release tracks of DB_TRACK
+const (
+	trackStable = "stable"
+	trackCanary = "canary"
+)
+
+// canaryOnly reports whether incident only breaks canary versions, so the
+// stable version stays healthy next to it
+func canaryOnly(incident string) bool { return incident == "bad_canary" }
+
+// simulatedIncidents are the incidents this instance's simulator picks from
+func simulatedIncidents() []string {
+	if deployTrack == trackCanary {
+		return incidentTypes
+	}
+	return slices.DeleteFunc(slices.Clone(incidentTypes), canaryOnly)
+}
+
+// incidentStartMu keeps the simulator and the schedule from starting incidents at once
+var incidentStartMu sync.Mutex
 
-	incidents := []string{"connection_timeout", "high_latency", "connection_refused", "deadlock", "disk_full"}
+func incidentSimulator(ctx context.Context, interval time.Duration, probability float64, stormDuration time.Duration, partial partialIncidents) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			if atomic.LoadInt64(&incidentActive) == 0 {
-				// Start incident (25% chance)
-				if rand.Float64() < 0.25 {
-					incident := incidents[rand.Intn(len(incidents))]
-					atomic.StoreInt64(&incidentActive, 1)
-					incidentType = incident
-					logrus.WithContext(ctx).Info(1, fmt.Sprintf("🚨 DATABASE INCIDENT DETECTED: %s", incident))
-
+				// Start incident (INCIDENT_PROBABILITY chance, 25% by default)
+				if simrand.Float64() < probability {
+					incidents := simulatedIncidents()
+					incident := incidents[simrand.Intn(len(incidents))]
 					// Incident duration: 15-90 seconds
-					duration := time.Duration(15+rand.Intn(75)) * time.Second
-					go func() {
-						time.Sleep(duration)
-						atomic.StoreInt64(&incidentActive, 0)
-						incidentType = "none"
-						logrus.WithContext(ctx).Info(1, fmt.Sprintf("✅ DATABASE INCIDENT RESOLVED: %s", incident))
-					}()
+					duration := time.Duration(15+simrand.Intn(75)) * time.Second
+					// A storm is short and sharp; the retries it sets off are the incident
+					if incident == "error_storm" {
+						duration = stormDuration
+					}
+					startIncident(ctx, incident, partial.choose(incident), duration, "", nil)
 				}
 			}
 		}
 	}
 }
 
-func startDatabaseService() {
+// startIncident runs incident for duration or until cleared through the admin
+// API; scenario names the scheduled scenario that started it, if any, and
+// latency the distribution that scenario gives query latency. It reports
+// false when another incident is already active.
+func startIncident(ctx context.Context, incident string, scope incidentScope, duration time.Duration, scenario string, latency *latencyDistribution) bool {
+	now := time.Now()
+	return runIncident(ctx, incidentState{
+		Type:          incident,
+		Operation:     scope.Operation,
+		CohortPercent: scope.CohortPercent,
+		Scenario:      scenario,
+		Latency:       latency,
+		StartedAt:     now,
+		EndsAt:        now.Add(duration),
+	})
+}
+
+// runIncident runs st until it ends, which for an incident restored after a
+// restart is sooner than its full duration
+func runIncident(ctx context.Context, st incidentState) bool {
+	incident, scope, scenario := st.Type, st.scope(), st.Scenario
+	duration := time.Until(st.EndsAt)
+
+	incidentStartMu.Lock()
+	if atomic.LoadInt64(&incidentActive) == 1 {
+		incidentStartMu.Unlock()
+		return false
+	}
+	activeScope.Store(&scope)
+	activeLatency.Store(st.Latency)
+	incidentType.Store(&incident)
+	atomic.StoreInt64(&incidentActive, 1)
+	saveIncidentState(ctx, &st)
+	dbHistory.start(st)
+	incidentStartMu.Unlock()
+
+	audit.Warn(ctx, "incident.started", "🚨 DATABASE INCIDENT DETECTED", "incident_type", incident, "incident_scope", scope.String(), "scenario", scenario, "duration", duration.String())
+	events.publish(Event{Type: "incident_started", IncidentType: incident, Scope: scope.String(), Scenario: scenario})
+
+	restore := func() {}
+	switch incident {
+	case "pool_exhaustion":
+		// Leaked connections leave a trickle of capacity, so queries queue and time out
+		restore = pool.leak(pool.size() * 9 / 10)
+	case "high_latency":
+		// Only the picked statements slow down, the rest of the traffic stays fast
+		restore = sqlStatements.slowDown(ctx)
+	case "memory_leak":
+		restore = exhaustion.leakMemory()
+	case "cpu_spin":
+		restore = exhaustion.spinCPU()
+	case "goroutine_leak":
+		restore = exhaustion.leakGoroutines()
+	}
+
+	go func() {
+		reason, message := endExpired, ""
+		select {
+		case <-time.After(duration):
+		case <-clearIncident:
+			reason, message = endCleared, "cleared through the admin API"
+		}
+		restore()
+		// Reset under the start lock and inactive last, so an incident
+		// starting now never sees this one's type or scope
+		incidentStartMu.Lock()
+		// Removed before the incident ends so the next one's state is not lost
+		saveIncidentState(ctx, nil)
+		rec := dbHistory.end(ctx, reason)
+		incidentType.Store(nil)
+		activeScope.Store(nil)
+		activeLatency.Store(nil)
+		atomic.StoreInt64(&incidentActive, 0)
+		incidentStartMu.Unlock()
+		audit.Record(ctx, "incident.resolved", "✅ DATABASE INCIDENT RESOLVED", "incident_type", incident, "scenario", scenario, "reason", reason,
+			"peak_error_rate", rec.PeakErrorRate)
+		events.publish(Event{Type: "incident_resolved", IncidentType: incident, Scenario: scenario, Message: message})
+	}()
+	return true
+}
+
+// newDatabaseHandler builds the database service routes with their middleware
+func newDatabaseHandler(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) http.Handler {
+	profiles, err := loadOperationProfiles(cfg.OperationProfilesFile, cfg.LatencyDistribution)
+	if err != nil {
+		log.Fatalf("Invalid operation profiles: %v", err)
+	}
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/db/query", func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := otel.Tracer("database-service").Start(r.Context(), "Database Query")
 		defer span.End()
 
+		var req DatabaseRequest
 		start := time.Now()
 		defer func() {
 			duration := time.Since(start).Seconds()
-			queryDuration.Record(ctx, duration, metric.WithAttributes(
-				attribute.String("service", "database"),
-			))
+			queryDuration.Record(ctx, duration, queryDurationAttrs.Get(req.Operation).Record...)
 		}()
 
-		// Parse request
-		var req DatabaseRequest
-		span.SetStatus(codes.Error, "invalid request")
+		// Parse request, JSON or protobuf, and answer in the encoding asked for
+		encoding := dbproto.Negotiate(r.Header.Get("Accept"))
+		requestEncoding, err := decodeQuery(r, &req)
+		span.SetAttributes(attrs.RequestEncoding(requestEncoding), attrs.ResponseEncoding(encoding))
+		if err != nil {
+			span.SetStatus(codes.Error, "invalid request")
 
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(DatabaseResponse{
-			Status: "error",
-			Error:  "invalid request body",
-		})
+			resp := DatabaseResponse{
+				Status:    "error",
+				Error:     "invalid request body",
+				Timestamp: time.Now().Unix(),
+				ErrorRef:  httpx.NewErrorRef(ctx, w),
+			}
+			writeQueryResponse(w, encoding, http.StatusBadRequest, resp)
+			return
+		}
 
-		// Simulate active connection
-		dbConnections.Add(ctx, 1)
-		defer dbConnections.Add(ctx, -1)
+		// connection_churn closes every connection after its response, so callers
+		// dial a new one per query instead of reusing their pool
+		if atomic.LoadInt64(&incidentActive) == 1 && activeIncidentType() == "connection_churn" {
+			w.Header().Set("Connection", "close")
+		}
 
 		// Add span attributes
+		stmt := sqlStatements.pick(req)
 		span.SetAttributes(
-			attribute.String("db.system", "postgresql"),
-			attribute.String("db.operation", req.Operation),
-			attribute.String("db.user_id", req.UserID),
-			attribute.String("incident.active", strconv.FormatBool(atomic.LoadInt64(&incidentActive) == 1)),
-			attribute.String("incident.type", incidentType),
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(req.Operation),
+			semconv.DBQueryText(stmt.text),
+			semconv.DBQuerySummary(stmt.summary),
+			semconv.DBCollectionName(stmt.table),
+			semconv.UserID(req.UserID),
+			attrs.IncidentActive(atomic.LoadInt64(&incidentActive) == 1),
+			attrs.IncidentType(activeIncidentType()),
+			attrs.UserCohort(userCohort(req.UserID)),
+			attrs.DeployTrack(deployTrack),
 		)
 
-		// Simulate different scenarios based on incident type
-		isIncident := atomic.LoadInt64(&incidentActive) == 1
-		var errorRate float64 = 0.02 // Base 2% error rate
-		var baseLatency time.Duration = 50 * time.Millisecond
+		if left, ok := httpx.BudgetLeft(ctx); ok {
+			span.SetAttributes(attrs.BudgetRemaining(float64(left.Microseconds()) / 1000))
+		}
 
-		if isIncident {
-			switch incidentType {
-			case "connection_timeout":
-				errorRate = 0.85
-				baseLatency = 5 * time.Second
-				time.Sleep(baseLatency + time.Duration(rand.Intn(3000))*time.Millisecond)
-			case "high_latency":
-				errorRate = 0.15
-				baseLatency = 2 * time.Second
-				time.Sleep(baseLatency + time.Duration(rand.Intn(1000))*time.Millisecond)
-			case "connection_refused":
-				errorRate = 0.95
-				baseLatency = 100 * time.Millisecond
-			case "deadlock":
-				errorRate = 0.40
-				baseLatency = 1 * time.Second
-				time.Sleep(baseLatency + time.Duration(rand.Intn(2000))*time.Millisecond)
-			case "disk_full":
-				errorRate = 0.70
-				baseLatency = 3 * time.Second
-				time.Sleep(baseLatency)
+		// An error_storm turns every query away before it takes a connection,
+		// with the 503 callers take as safe to retry
+		if atomic.LoadInt64(&incidentActive) == 1 && activeIncidentType() == "error_storm" && currentScope().covers(req) {
+			span.SetStatus(codes.Error, "rejected in an error storm")
+			queryCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("status", "error"),
+				attribute.String("operation", req.Operation),
+			))
+			errorCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("error_type", "error_storm"),
+				attribute.String("operation", req.Operation),
+			))
+
+			logx.Errorw(ctx, "⛈️ Query rejected in an error storm", "db.operation", req.Operation)
+			resp := DatabaseResponse{
+				Status:    "error",
+				Error:     "database is rejecting queries",
+				QueryTime: time.Since(start).Seconds() * 1000,
+				Timestamp: time.Now().Unix(),
+				ErrorRef:  httpx.NewErrorRef(ctx, w),
 			}
-		} else {
-			// Normal operation latency
-			time.Sleep(baseLatency + time.Duration(rand.Intn(100))*time.Millisecond)
+			writeQueryResponse(w, encoding, http.StatusServiceUnavailable, resp)
+			return
+		}
+
+		// Check out a pooled connection for the whole query
+		release, waited, err := pool.Acquire(ctx)
+		poolWaitDuration.Record(ctx, waited.Seconds())
+		span.SetAttributes(attrs.DBPoolWait(float64(waited.Microseconds()) / 1000))
+		if err != nil {
+			reason := "timeout"
+			switch {
+			case errors.Is(err, errPoolQueueFull):
+				reason = "queue_full"
+			case ctx.Err() != nil:
+				reason = "canceled"
+			}
+			// The caller's budget ran out in the queue
+			if _, ok := httpx.BudgetLeft(ctx); ok && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				span.SetAttributes(attrs.BudgetExceeded(true))
+				budgetExceeded.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("stage", "pool_wait"),
+					attribute.String("operation", req.Operation),
+				))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.SetAttributes(attrs.DBPoolExhaustedReason(reason))
+
+			poolExhausted.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+			queryCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("status", "error"),
+				attribute.String("operation", req.Operation),
+			))
+			errorCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("error_type", "pool_exhausted"),
+				attribute.String("operation", req.Operation),
+			))
+
+			logx.Errorw(ctx, "❌ No pool connection available", "db.operation", req.Operation, "reason", reason, "wait_ms", waited.Milliseconds(), "error", err)
+			resp := DatabaseResponse{
+				Status:    "error",
+				Error:     err.Error(),
+				QueryTime: time.Since(start).Seconds() * 1000,
+				Timestamp: time.Now().Unix(),
+				ErrorRef:  httpx.NewErrorRef(ctx, w),
+			}
+			writeQueryResponse(w, encoding, http.StatusServiceUnavailable, resp)
+			return
+		}
+		defer release()
+
+		// Latency and error rate depend on the operation and the active incident
+		activeIncident := "none"
+		if atomic.LoadInt64(&incidentActive) == 1 {
+			scope := currentScope()
+			span.SetAttributes(attrs.IncidentScope(scope.String()))
+			// Queries outside a partial incident's scope behave normally
+			if scope.covers(req) {
+				activeIncident = activeIncidentType()
+			}
+		}
+		errorRate, latency := profiles.behaviour(req.Operation, activeIncident)
+		if activeIncident != "none" && !flags.enabled(flagSlowPath) {
+			_, latency = profiles.behaviour(req.Operation, "none")
+			span.SetAttributes(attribute.Bool("feature_flag.slow_path", false))
+		} else if activeIncident == "high_latency" && !stmt.slow {
+			_, latency = profiles.behaviour(req.Operation, "none")
+		}
+		// The slow_path flag turns incident latency off, picked statements included
+		slow := stmt.slow && flags.enabled(flagSlowPath)
+		if slow {
+			span.SetAttributes(attrs.DBQuerySlow(true))
+		}
+		// Work that would outlast the caller's budget is not started at all
+		if left, ok := httpx.BudgetLeft(ctx); ok && latency > left {
+			msg := fmt.Sprintf("request budget exceeded: query needs %dms, %dms left", latency.Milliseconds(), left.Milliseconds())
+			span.SetAttributes(attrs.BudgetExceeded(true))
+			span.SetStatus(codes.Error, msg)
+
+			budgetExceeded.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("stage", "query"),
+				attribute.String("operation", req.Operation),
+			))
+			queryCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("status", "error"),
+				attribute.String("operation", req.Operation),
+			))
+			errorCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("error_type", "budget_exceeded"),
+				attribute.String("operation", req.Operation),
+			))
+
+			logx.Warnw(ctx, "⏳ Query dropped over budget", "db.operation", req.Operation, "planned_ms", latency.Milliseconds(), "budget_left_ms", left.Milliseconds())
+			resp := DatabaseResponse{
+				Status:    "error",
+				Error:     msg,
+				QueryTime: time.Since(start).Seconds() * 1000,
+				Timestamp: time.Now().Unix(),
+				ErrorRef:  httpx.NewErrorRef(ctx, w),
+			}
+			writeQueryResponse(w, encoding, http.StatusGatewayTimeout, resp)
+			return
+		}
+
+		// Simulated work stops as soon as the caller gives up on it
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			reason := httpx.CancelReason(ctx.Err())
+			httpx.RecordCancel(span, reason)
+
+			queryCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("status", "canceled"),
+				attribute.String("operation", req.Operation),
+			))
+			errorCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("error_type", reason),
+				attribute.String("operation", req.Operation),
+			))
+
+			logx.Warnw(ctx, "🚫 Query abandoned", "db.operation", req.Operation, "reason", reason, "query_time_ms", time.Since(start).Seconds()*1000, "planned_ms", latency.Milliseconds())
+			resp := DatabaseResponse{
+				Status:    "canceled",
+				Error:     ctx.Err().Error(),
+				QueryTime: time.Since(start).Seconds() * 1000,
+				Timestamp: time.Now().Unix(),
+				ErrorRef:  httpx.NewErrorRef(ctx, w),
+			}
+			writeQueryResponse(w, encoding, httpx.CancelStatus(reason), resp)
+			return
 		}
 
 		queryTime := time.Since(start).Seconds() * 1000 // Convert to milliseconds
+		if slow {
+			logx.Warnw(ctx, "🐢 Slow query", "db.operation", req.Operation, "db.query.summary", stmt.summary, "db.query.text", stmt.text, "query_time_ms", queryTime)
+		}
 
-		if rand.Float64() < errorRate {
+		if simrand.Float64() < errorRate {
 			var errorMsg string
-			switch incidentType {
+			switch activeIncident {
 			case "connection_timeout":
 				errorMsg = "connection timeout after 30 seconds"
 			case "connection_refused":
@@ -333,10 +758,14 @@ func startDatabaseService() {
 				errorMsg = "deadlock detected in database transaction"
 			case "disk_full":
 				errorMsg = "insufficient disk space for database operation"
+			case "bad_instance":
+				errorMsg = "replica storage I/O error"
+			case "bad_canary":
+				errorMsg = "canary build failed to plan the query"
 			default:
 				errorMsg = "database connection error"
 			}
-			span.RecordError(fmt.Errorf(errorMsg))
+			span.RecordError(errors.New(errorMsg))
 			span.SetStatus(codes.Error, errorMsg)
 
 			queryCounter.Add(ctx, 1, metric.WithAttributes(
@@ -344,53 +773,61 @@ func startDatabaseService() {
 				attribute.String("operation", req.Operation),
 			))
 			errorCounter.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("error_type", incidentType),
+				attribute.String("error_type", activeIncident),
 				attribute.String("operation", req.Operation),
 			))
 
-			logrus.WithContext(ctx).Error(fmt.Errorf("❌ Database query failed: %s - %s", req.Operation, errorMsg))
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(DatabaseResponse{
+			logx.Errorw(ctx, "❌ Database query failed", "db.operation", req.Operation, "user.id", req.UserID, "incident_type", activeIncident, "error", errorMsg, "query_time_ms", queryTime)
+			resp := DatabaseResponse{
 				Status:    "error",
 				Error:     errorMsg,
 				QueryTime: queryTime,
 				Timestamp: time.Now().Unix(),
-			})
+				ErrorRef:  httpx.NewErrorRef(ctx, w),
+			}
+			writeQueryResponse(w, encoding, http.StatusInternalServerError, resp)
 			return
 		}
 
-		// Successful response
-		queryCounter.Add(ctx, 1, metric.WithAttributes(
-			attribute.String("status", "success"),
-			attribute.String("operation", req.Operation),
-		))
+		// Successful response; writes leave an event for the worker service
+		dbOutbox.append(ctx, req)
+		queryCounter.Add(ctx, 1, querySuccessAttrs.Get(req.Operation).Add...)
+		// balance_drift stores writes with the wrong amount while answering as usual
+		balance := dbLedger.apply(ctx, req, activeIncident == "balance_drift")
+		span.SetAttributes(attrs.AccountBalance(balance))
 
-		var responseData interface{}
+		var responseData map[string]interface{}
 		switch req.Operation {
 		case "get_balance":
 			responseData = map[string]interface{}{
 				"user_id":  req.UserID,
-				"balance":  rand.Float64() * 10000,
+				"balance":  balance,
 				"currency": "USD",
 			}
 		case "balance_check":
 			responseData = map[string]interface{}{
 				"user_id":           req.UserID,
-				"balance":           rand.Float64() * 10000,
-				"available_balance": rand.Float64() * 8000,
+				"balance":           balance,
+				"available_balance": max(balance, 0),
 				"currency":          "USD",
 			}
 		default:
 			responseData = map[string]interface{}{
 				"user_id":       req.UserID,
 				"result":        "success",
-				"affected_rows": rand.Intn(5) + 1,
+				"affected_rows": simrand.Intn(5) + 1,
 			}
 		}
 
-		logrus.WithContext(ctx).Info(1, fmt.Sprintf("✅ Database query successful: %s - %s", req.Operation, responseData))
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(DatabaseResponse{
+		// data_corruption answers with wrong fields and still reports success
+		if activeIncident == "data_corruption" {
+			if kind := corruptResponse(ctx, req.Operation, responseData); kind != "" {
+				span.SetAttributes(attrs.ResponseCorruption(kind))
+			}
+		}
+
+		logx.Infow(ctx, "✅ Database query successful", "db.operation", req.Operation, "user.id", req.UserID, "query_time_ms", queryTime, "db.response", responseData)
+		writeQueryResponse(w, encoding, http.StatusOK, DatabaseResponse{
 			Status:    "success",
 			Data:      responseData,
 			QueryTime: queryTime,
@@ -402,41 +839,93 @@ func startDatabaseService() {
 		_, span := otel.Tracer("database-service").Start(r.Context(), "Database Health Check")
 		defer span.End()
 
-		isHealthy := atomic.LoadInt64(&incidentActive) == 0 || rand.Float64() > 0.7
+		isHealthy := atomic.LoadInt64(&incidentActive) == 0 || simrand.Float64() > 0.7
 
 		span.SetAttributes(
-			attribute.Bool("db.healthy", isHealthy),
-			attribute.String("incident.type", incidentType),
+			attrs.DBHealthy(isHealthy),
+			attrs.IncidentType(activeIncidentType()),
 		)
+		events.observeHealth(isHealthy)
 
 		if isHealthy {
 			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
+			jsonx.NewEncoder(w).Encode(map[string]interface{}{
 				"status":      "healthy",
-				"connections": rand.Intn(10) + 1,
+				"connections": simrand.Intn(10) + 1,
 				"uptime":      time.Now().Unix() - 1000,
 			})
+		} else {
 			span.SetStatus(codes.Error, "database unhealthy")
 			w.WriteHeader(http.StatusServiceUnavailable)
-			json.NewEncoder(w).Encode(map[string]interface{}{
+			jsonx.NewEncoder(w).Encode(map[string]interface{}{
 				"status":        "unhealthy",
-				"incident_type": incidentType,
+				"incident_type": activeIncidentType(),
 				"error":         "database service degraded",
 			})
 		}
 	})
 
+	mux.HandleFunc("GET /db/events", handleEvents)
+	dbOutbox.register(mux)
+	dbHistory.register(mux)
+
+	// Remediation endpoints for the analyzer are development-only, like X-Chaos-*
+	if cfg.DevMode {
+		registerAdmin(mux)
+	}
+
 	mux.HandleFunc("/db/metrics", func(w http.ResponseWriter, r *http.Request) {
+		pending, lag := dbOutbox.lag()
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		jsonx.NewEncoder(w).Encode(map[string]interface{}{
 			"incident_active":    atomic.LoadInt64(&incidentActive) == 1,
-			"incident_type":      incidentType,
-			"active_connections": rand.Intn(20) + 1,
+			"incident_type":      activeIncidentType(),
+			"incident_scope":     currentScope().String(),
+			"active_connections": simrand.Intn(20) + 1,
+			"outbox_pending":     pending,
+			"outbox_lag_seconds": lag.Seconds(),
+			"ledger":             dbLedger.summary(),
 			"timestamp":          time.Now().Unix(),
 		})
 	})
 
-	handler := otelhttp.NewHandler(mux, "database-service")
-	log.Println("🗄️  Database Service running on :8081")
-	log.Fatal(http.ListenAndServe(":8081", handler))
+	// Kubernetes probes sit outside tracing and incident simulation
+	prober := probes.New(2 * time.Second)
+	if cfg.TelemetryExporter == telemetry.ExporterOTLP {
+		prober.AddCheck("otlp_collector", probes.TCPCheck(telemetry.CollectorAddr(cfg.OTLP)))
+		// Not ready until telemetry has reached the collector once
+		prober.AddCheck("telemetry_export", health.Ready)
+	}
+
+	root := http.NewServeMux()
+	prober.Register(root)
+	if cfg.TelemetryBufferSize > 0 {
+		root.Handle("GET /debug/telemetry/recent", recorder)
+	}
+	root.Handle("GET /debug/otel", health)
+	root.Handle("GET /debug/audit", audit.Handler())
+	root.Handle("/debug/loglevel", logx.LevelHandler(audit.Warn))
+	if heatmap.Enabled() {
+		root.Handle("GET /debug/latency-heatmap", heatmap)
+		root.Handle("GET /debug/export", heatmap.Export())
+	}
+	root.Handle("GET /version", buildinfo.Handler("database-service"))
+	// X-Chaos-* fault injection is a development-only feature
+	var handler http.Handler = mux
+	if cfg.DevMode {
+		handler = chaos.Middleware("database-service", handler)
+	}
+	// Callers that send a time budget bound the work done for them
+	handler = httpx.Metrics("database-service", httpx.Budget(handler))
+	// X-Debug-Trace and DEBUG_TRACE_USERS requests are sampled whatever TRACE_SAMPLE_RATIO says
+	root.Handle("/", telemetry.DebugTraces(cfg.Sampling, nil, otelhttp.NewHandler(httpx.TraceResponse(handler), "database-service")))
+
+	prober.MarkStarted()
+	return root
+}
+
+func startDatabaseService(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) {
+	root := newDatabaseHandler(cfg, recorder, health, heatmap)
+	log.Printf("🗄️  Database Service running on %s", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, root))
 }
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Operations that only read and so write no outbox event
+var readOperations = map[string]bool{"get_balance": true, "balance_check": true}
+
+// OutboxEvent is a row of the simulated outbox table, written in the same
+// transaction as the query it records. The writing span's IDs let a consumer
+// link its processing span back to the trace that produced the event.
+type OutboxEvent struct {
+	ID        int64     `json:"id"`
+	Operation string    `json:"operation"`
+	UserID    string    `json:"user_id"`
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	SpanID    string    `json:"span_id,omitempty"`
+}
+
+type OutboxAckRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// outbox is the simulated outbox table. Committed writes append an event; the
+// worker service reads the oldest pending events and acknowledges them once
+// published. Nothing but the consumer drains it, so the age of the oldest
+// pending event is how far downstream views lag behind the database. Past
+// maxEvents the oldest events are dropped, as a retention job would.
+type outbox struct {
+	mu        sync.Mutex
+	pending   []OutboxEvent
+	nextID    int64
+	maxEvents int
+
+	appended metric.Int64Counter
+	acked    metric.Int64Counter
+	dropped  metric.Int64Counter
+}
+
+// instanceIDShift spaces the event IDs of replicas apart, so an ack sent to
+// every replica only removes events from the one that wrote them
+const instanceIDShift = 40
+
+func newOutbox(maxEvents, instance int) *outbox {
+	return &outbox{maxEvents: maxEvents, nextID: int64(instance)<<instanceIDShift + 1}
+}
+
+// Attribute sets of db_outbox_events_total per built-in operation
+var outboxEventAttrs = telemetry.NewMeasurements(builtinOperations, func(op string) telemetry.Measurement {
+	return telemetry.NewMeasurement(attribute.String("operation", op))
+})
+
+// append records a committed write of req
+func (o *outbox) append(ctx context.Context, req DatabaseRequest) {
+	if readOperations[req.Operation] {
+		return
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	event := OutboxEvent{
+		Operation: req.Operation,
+		UserID:    req.UserID,
+		Amount:    req.Amount,
+		CreatedAt: time.Now(),
+	}
+	if sc.IsValid() {
+		event.TraceID, event.SpanID = sc.TraceID().String(), sc.SpanID().String()
+	}
+
+	o.mu.Lock()
+	event.ID = o.nextID
+	o.nextID++
+	o.pending = append(o.pending, event)
+	var dropped int
+	if len(o.pending) > o.maxEvents {
+		// Reslicing rather than copying keeps a full outbox, the usual state
+		// while the worker is down, from copying every pending event per
+		// write; append moves the events to a new array once the old one runs
+		// out of room
+		dropped = len(o.pending) - o.maxEvents
+		o.pending = o.pending[dropped:]
+	}
+	o.mu.Unlock()
+
+	trace.SpanFromContext(ctx).SetAttributes(attrs.OutboxEventID(event.ID))
+	o.appended.Add(ctx, 1, outboxEventAttrs.Get(req.Operation).Add...)
+	if dropped > 0 {
+		o.dropped.Add(ctx, int64(dropped))
+	}
+}
+
+// read returns up to limit of the oldest pending events without removing them
+func (o *outbox) read(limit int) []OutboxEvent {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := min(limit, len(o.pending))
+	return append([]OutboxEvent(nil), o.pending[:n]...)
+}
+
+// ack removes the given events, returning how many were still pending
+func (o *outbox) ack(ids []int64) int {
+	done := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		done[id] = true
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	kept := o.pending[:0]
+	for _, e := range o.pending {
+		if !done[e.ID] {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(o.pending) - len(kept)
+	clear(o.pending[len(kept):])
+	o.pending = kept
+	return removed
+}
+
+// lag is the number of pending events and the age of the oldest one
+func (o *outbox) lag() (int, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.pending) == 0 {
+		return 0, 0
+	}
+	return len(o.pending), time.Since(o.pending[0].CreatedAt)
+}
+
+// register adds GET /db/outbox?limit=N and POST /db/outbox/ack
+func (o *outbox) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /db/outbox", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("database-service").Start(r.Context(), "Read Outbox")
+		defer span.End()
+
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				span.SetStatus(codes.Error, "invalid limit")
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		events := o.read(limit)
+		pending, age := o.lag()
+		span.SetAttributes(
+			attribute.Int("outbox.batch_size", len(events)),
+			attribute.Int("outbox.pending", pending),
+			attribute.Float64("outbox.oldest_age_ms", float64(age.Milliseconds())),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		jsonx.NewEncoder(w).Encode(map[string]interface{}{
+			"events":  events,
+			"pending": pending,
+		})
+	})
+
+	mux.HandleFunc("POST /db/outbox/ack", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer("database-service").Start(r.Context(), "Acknowledge Outbox Events")
+		defer span.End()
+
+		var req OutboxAckRequest
+		if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil {
+			span.SetStatus(codes.Error, "invalid request body")
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		removed := o.ack(req.IDs)
+		span.SetAttributes(attribute.Int("outbox.acked", removed))
+		o.acked.Add(ctx, int64(removed))
+
+		w.Header().Set("Content-Type", "application/json")
+		jsonx.NewEncoder(w).Encode(map[string]interface{}{"acked": removed})
+	})
+}
+
+// registerMetrics exports the outbox size and the age of its oldest event,
+// the replication lag of everything fed from it
+func (o *outbox) registerMetrics(ctx context.Context) {
+	meter := otel.Meter("database-service")
+
+	var err error
+	o.appended, err = meter.Int64Counter("db_outbox_events_total",
+		metric.WithDescription("Outbox events written by committed queries"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create outbox event counter", "error", err)
+	}
+
+	o.acked, err = meter.Int64Counter("db_outbox_acked_total",
+		metric.WithDescription("Outbox events acknowledged by the consumer"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create outbox ack counter", "error", err)
+	}
+
+	o.dropped, err = meter.Int64Counter("db_outbox_dropped_total",
+		metric.WithDescription("Pending outbox events dropped to stay within DB_OUTBOX_MAX_EVENTS"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create outbox drop counter", "error", err)
+	}
+
+	pending, err := meter.Int64ObservableGauge("db_outbox_pending_events",
+		metric.WithDescription("Outbox events not yet acknowledged by the consumer"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create outbox pending gauge", "error", err)
+		return
+	}
+
+	oldest, err := meter.Float64ObservableGauge("db_outbox_oldest_event_age_seconds",
+		metric.WithDescription("Age of the oldest pending outbox event, the consumer's replication lag"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create outbox age gauge", "error", err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, ob metric.Observer) error {
+		n, age := o.lag()
+		ob.ObserveInt64(pending, int64(n))
+		ob.ObserveFloat64(oldest, age.Seconds())
+		return nil
+	}, pending, oldest)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register outbox gauge callback", "error", err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/logx"
+)
+
+var (
+	errPoolTimeout   = errors.New("connection pool exhausted: timed out waiting for a connection")
+	errPoolQueueFull = errors.New("connection pool exhausted: wait queue is full")
+)
+
+// connPool simulates a bounded connection pool. A query holds a connection for
+// its whole duration; when all are in use callers queue (FIFO) for up to the
+// acquisition timeout, and are rejected outright once the queue is full.
+//
+// The slots channel is sized for the largest pool the admin API may scale to;
+// slots beyond the current size are held as reserved. Shrinking below the
+// connections in use leaves a debt that releases pay off before freeing slots.
+type connPool struct {
+	slots      chan struct{}
+	maxWaiting int64
+	timeout    time.Duration
+
+	inUse   atomic.Int64
+	waiting atomic.Int64
+	leaked  atomic.Int64
+
+	resizeMu sync.Mutex
+	reserved atomic.Int64
+	debt     atomic.Int64
+}
+
+func newConnPool(maxConns, maxScale, maxWaiting int, timeout time.Duration) *connPool {
+	p := &connPool{
+		slots:      make(chan struct{}, maxScale),
+		maxWaiting: int64(maxWaiting),
+		timeout:    timeout,
+	}
+	for i := maxConns; i < maxScale; i++ {
+		p.slots <- struct{}{}
+	}
+	p.reserved.Store(int64(maxScale - maxConns))
+	return p
+}
+
+// size is the number of connections the pool currently allows
+func (p *connPool) size() int {
+	return cap(p.slots) - int(p.reserved.Load()+p.debt.Load())
+}
+
+// resize changes the pool size. Growing frees reserved slots at once;
+// shrinking takes free slots now and the rest as busy connections are released.
+func (p *connPool) resize(n int) error {
+	if n < 1 || n > cap(p.slots) {
+		return fmt.Errorf("pool size must be between 1 and %d", cap(p.slots))
+	}
+	p.resizeMu.Lock()
+	defer p.resizeMu.Unlock()
+
+	delta := n - p.size()
+	for ; delta > 0; delta-- {
+		if !p.payDebt() {
+			<-p.slots
+			p.reserved.Add(-1)
+		}
+	}
+	for ; delta < 0; delta++ {
+		select {
+		case p.slots <- struct{}{}:
+			p.reserved.Add(1)
+		default:
+			p.debt.Add(1)
+		}
+	}
+	return nil
+}
+
+// Acquire takes a connection and returns its release function and how long the caller waited
+func (p *connPool) Acquire(ctx context.Context) (func(), time.Duration, error) {
+	start := time.Now()
+
+	// Fast path: a free connection
+	select {
+	case p.slots <- struct{}{}:
+		p.inUse.Add(1)
+		return p.release, 0, nil
+	default:
+	}
+
+	if p.waiting.Add(1) > p.maxWaiting {
+		p.waiting.Add(-1)
+		return nil, 0, errPoolQueueFull
+	}
+	defer p.waiting.Add(-1)
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+		p.inUse.Add(1)
+		return p.release, time.Since(start), nil
+	case <-timer.C:
+		return nil, time.Since(start), errPoolTimeout
+	case <-ctx.Done():
+		return nil, time.Since(start), ctx.Err()
+	}
+}
+
+func (p *connPool) release() {
+	p.inUse.Add(-1)
+	p.free()
+}
+
+// free returns one slot, keeping it reserved while the pool is above its new size
+func (p *connPool) free() {
+	if p.payDebt() {
+		p.reserved.Add(1)
+		return
+	}
+	<-p.slots
+}
+
+// payDebt takes one slot off the shrink debt, reporting false if there is none
+func (p *connPool) payDebt() bool {
+	for d := p.debt.Load(); d > 0; d = p.debt.Load() {
+		if p.debt.CompareAndSwap(d, d-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// leak holds n connections until the returned function is called, simulating
+// code paths that never return their connection
+func (p *connPool) leak(n int) func() {
+	var held int64
+	for i := 0; i < n; i++ {
+		select {
+		case p.slots <- struct{}{}:
+			held++
+		default:
+		}
+	}
+	p.inUse.Add(held)
+	p.leaked.Add(held)
+	return func() {
+		for i := int64(0); i < held; i++ {
+			p.free()
+		}
+		p.inUse.Add(-held)
+		p.leaked.Add(-held)
+	}
+}
+
+// registerMetrics exports pool saturation; acquisition outcomes are recorded by the caller
+func (p *connPool) registerMetrics(ctx context.Context) {
+	meter := otel.Meter("database-service")
+
+	inUse, err := meter.Int64ObservableGauge("db_pool_connections_in_use",
+		metric.WithDescription("Connections currently checked out of the pool (including leaked ones)"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create pool in-use gauge", "error", err)
+		return
+	}
+
+	maxConns, err := meter.Int64ObservableGauge("db_pool_connections_max",
+		metric.WithDescription("Current pool size, as configured or scaled through the admin API"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create pool size gauge", "error", err)
+		return
+	}
+
+	waiting, err := meter.Int64ObservableGauge("db_pool_wait_queue_length",
+		metric.WithDescription("Callers waiting for a pool connection"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create pool wait queue gauge", "error", err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(inUse, p.inUse.Load()-p.leaked.Load(), metric.WithAttributes(attribute.String("state", "active")))
+		o.ObserveInt64(inUse, p.leaked.Load(), metric.WithAttributes(attribute.String("state", "leaked")))
+		o.ObserveInt64(maxConns, int64(p.size()))
+		o.ObserveInt64(waiting, p.waiting.Load())
+		return nil
+	}, inUse, maxConns, waiting)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register pool gauge callback", "error", err)
+	}
+}
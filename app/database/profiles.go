@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"incident-simulation/pkg/simrand"
+)
+
+// defaultOperation is the profile of operations without their own entry
+const defaultOperation = "default"
+
+// incidentEffect is how an incident shapes every query before per-operation scaling
+type incidentEffect struct {
+	errorRate float64
+	latency   time.Duration
+	jitter    time.Duration
+}
+
+var incidentEffects = map[string]incidentEffect{
+	"connection_timeout": {errorRate: 0.85, latency: 5 * time.Second, jitter: 3 * time.Second},
+	"high_latency":       {errorRate: 0.15, latency: 2 * time.Second, jitter: time.Second},
+	"connection_refused": {errorRate: 0.95},
+	"deadlock":           {errorRate: 0.40, latency: time.Second, jitter: 2 * time.Second},
+	"disk_full":          {errorRate: 0.70, latency: 3 * time.Second},
+	// A sick host (noisy neighbour, failing disk) that only its replica runs on
+	"bad_instance": {errorRate: 0.35, latency: 1500 * time.Millisecond, jitter: time.Second},
+	// A release regression that only the canary version ships
+	"bad_canary": {errorRate: 0.5, latency: 800 * time.Millisecond, jitter: 400 * time.Millisecond},
+}
+
+// operationProfile is the latency and error behaviour of one operation. Incident
+// factors scale the incident's error rate and latency for this operation; a
+// missing incident or a zero factor leaves it unchanged. The distribution
+// shapes both its own latency and an incident's.
+type operationProfile struct {
+	Latency      time.Duration             `yaml:"latency"`
+	Jitter       time.Duration             `yaml:"jitter"`
+	ErrorRate    float64                   `yaml:"error_rate"`
+	Distribution latencyDistribution       `yaml:"distribution"`
+	Incidents    map[string]incidentFactor `yaml:"incidents"`
+}
+
+type incidentFactor struct {
+	Error   float64 `yaml:"error"`
+	Latency float64 `yaml:"latency"`
+}
+
+// Reads are fast and untouched by write-path incidents; writes are slower and
+// take the brunt of deadlocks and a full disk
+var defaultProfiles = map[string]operationProfile{
+	defaultOperation: {Latency: 50 * time.Millisecond, Jitter: 100 * time.Millisecond, ErrorRate: 0.02},
+	"get_balance": {
+		Latency: 15 * time.Millisecond, Jitter: 30 * time.Millisecond, ErrorRate: 0.005,
+		Incidents: map[string]incidentFactor{
+			"deadlock":     {Error: 0.1, Latency: 0.2},
+			"disk_full":    {Error: 0.05, Latency: 0.1},
+			"high_latency": {Latency: 0.6},
+		},
+	},
+	"balance_check": {
+		Latency: 25 * time.Millisecond, Jitter: 50 * time.Millisecond, ErrorRate: 0.01,
+		Incidents: map[string]incidentFactor{
+			"deadlock":  {Error: 0.2, Latency: 0.3},
+			"disk_full": {Error: 0.05, Latency: 0.1},
+		},
+	},
+	"transfer": {
+		Latency: 90 * time.Millisecond, Jitter: 150 * time.Millisecond, ErrorRate: 0.03,
+		Incidents: map[string]incidentFactor{
+			"deadlock":  {Error: 2, Latency: 1.5},
+			"disk_full": {Error: 1.3},
+		},
+	},
+	// Steps of the core API's transfer saga. The credit locks the recipient's
+	// row and deadlocks most, which is what triggers the compensating refund.
+	"transfer_debit": {
+		Latency: 50 * time.Millisecond, Jitter: 80 * time.Millisecond, ErrorRate: 0.01,
+		Incidents: map[string]incidentFactor{
+			"deadlock":  {Error: 1.2, Latency: 1.2},
+			"disk_full": {Error: 1.3},
+		},
+	},
+	"transfer_credit": {
+		Latency: 50 * time.Millisecond, Jitter: 80 * time.Millisecond, ErrorRate: 0.02,
+		Incidents: map[string]incidentFactor{
+			"deadlock":  {Error: 2, Latency: 1.5},
+			"disk_full": {Error: 1.3},
+		},
+	},
+	"transfer_compensate": {
+		Latency: 40 * time.Millisecond, Jitter: 60 * time.Millisecond, ErrorRate: 0.005,
+		Incidents: map[string]incidentFactor{
+			"deadlock":  {Error: 0.5},
+			"disk_full": {Error: 1.3},
+		},
+	},
+	"deposit": {
+		Latency: 70 * time.Millisecond, Jitter: 120 * time.Millisecond, ErrorRate: 0.02,
+		Incidents: map[string]incidentFactor{
+			"deadlock":  {Error: 1.5, Latency: 1.2},
+			"disk_full": {Error: 1.3},
+		},
+	},
+	"withdrawal": {
+		Latency: 70 * time.Millisecond, Jitter: 120 * time.Millisecond, ErrorRate: 0.02,
+		Incidents: map[string]incidentFactor{
+			"deadlock":  {Error: 1.5, Latency: 1.2},
+			"disk_full": {Error: 1.3},
+		},
+	},
+}
+
+// builtinOperations are the operations with a built-in profile
+var builtinOperations = slices.Sorted(maps.Keys(defaultProfiles))
+
+// operationProfiles resolves the profile of each operation
+type operationProfiles map[string]operationProfile
+
+// loadOperationProfiles returns the built-in profiles with the operations of the
+// YAML file at path (if any) replacing or adding entries. Profiles without a
+// distribution of their own get one of kind distribution (DB_LATENCY_DISTRIBUTION).
+func loadOperationProfiles(path, distribution string) (operationProfiles, error) {
+	fallback := latencyDistribution{Kind: distribution}
+	if err := fallback.validate(); err != nil {
+		return nil, err
+	}
+	profiles := make(operationProfiles, len(defaultProfiles))
+	for op, p := range defaultProfiles {
+		profiles[op] = p
+	}
+	defer func() {
+		for op, p := range profiles {
+			if p.Distribution.Kind == "" {
+				p.Distribution = fallback
+				profiles[op] = p
+			}
+		}
+	}()
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read operation profiles: %w", err)
+	}
+	var file struct {
+		Operations map[string]operationProfile `yaml:"operations"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse operation profiles %s: %w", path, err)
+	}
+	for op, p := range file.Operations {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("operation profile %q: %w", op, err)
+		}
+		profiles[op] = p
+	}
+	return profiles, nil
+}
+
+func (p operationProfile) validate() error {
+	if p.Latency < 0 || p.Jitter < 0 {
+		return fmt.Errorf("latency and jitter must not be negative")
+	}
+	if p.ErrorRate < 0 || p.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	if err := p.Distribution.validate(); err != nil {
+		return err
+	}
+	for incident, f := range p.Incidents {
+		if _, ok := incidentEffects[incident]; !ok {
+			return fmt.Errorf("unknown incident %q", incident)
+		}
+		if f.Error < 0 || f.Latency < 0 {
+			return fmt.Errorf("incident %q: factors must not be negative", incident)
+		}
+	}
+	return nil
+}
+
+// behaviour returns the error rate and a sampled latency for operation while
+// incident is active; incidents without an effect (none, pool_exhaustion) use
+// the operation's normal behaviour. A scenario's latency distribution, when
+// one runs, replaces the operation's.
+func (ps operationProfiles) behaviour(operation, incident string) (float64, time.Duration) {
+	p, ok := ps[operation]
+	if !ok {
+		p = ps[defaultOperation]
+	}
+	dist := p.Distribution
+	if d := activeLatency.Load(); d != nil {
+		dist = *d
+	}
+
+	effect, ok := incidentEffects[incident]
+	if !ok {
+		return p.ErrorRate, dist.sample(p.Latency, p.Jitter)
+	}
+
+	f := p.Incidents[incident]
+	errorRate, latency := effect.errorRate, dist.sample(effect.latency, effect.jitter)
+	if f.Error > 0 {
+		errorRate = min(errorRate*f.Error, 1)
+	}
+	if f.Latency > 0 {
+		latency = time.Duration(float64(latency) * f.Latency)
+	}
+	return errorRate, latency
+}
+
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(simrand.Int63n(int64(max)))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"incident-simulation/pkg/cron"
+	"incident-simulation/pkg/logx"
+)
+
+// scenario is an incident that recurs on a cron schedule, such as a nightly
+// backup slowing queries down at 02:00. Recurring incidents give the detector
+// seasonal patterns to learn instead of only random outages. Latency, when
+// set, replaces the latency distribution of every operation while it runs.
+type scenario struct {
+	Name          string               `yaml:"name"`
+	Cron          string               `yaml:"cron"`
+	Incident      string               `yaml:"incident"`
+	Duration      time.Duration        `yaml:"duration"`
+	Operation     string               `yaml:"operation"`
+	CohortPercent int                  `yaml:"cohort_percent"`
+	Latency       *latencyDistribution `yaml:"latency"`
+
+	schedule *cron.Schedule
+}
+
+// loadSchedule reads the scenarios of the YAML file at path; no path means no
+// scheduled incidents
+func loadSchedule(path string) ([]scenario, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read incident schedule: %w", err)
+	}
+	var file struct {
+		Scenarios []scenario `yaml:"scenarios"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse incident schedule %s: %w", path, err)
+	}
+	for i := range file.Scenarios {
+		sc := &file.Scenarios[i]
+		if err := sc.validate(); err != nil {
+			return nil, fmt.Errorf("scenario %d (%s): %w", i+1, sc.Name, err)
+		}
+	}
+	return file.Scenarios, nil
+}
+
+func (sc *scenario) validate() error {
+	if sc.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !slices.Contains(incidentTypes, sc.Incident) {
+		return fmt.Errorf("unknown incident %q", sc.Incident)
+	}
+	if sc.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if sc.Operation != "" && sc.CohortPercent != 0 {
+		return fmt.Errorf("operation and cohort_percent are exclusive")
+	}
+	if sc.CohortPercent < 0 || sc.CohortPercent > 100 {
+		return fmt.Errorf("cohort_percent must be between 0 and 100")
+	}
+	if sc.Latency != nil {
+		if err := sc.Latency.validate(); err != nil {
+			return err
+		}
+	}
+	schedule, err := cron.Parse(sc.Cron)
+	if err != nil {
+		return err
+	}
+	sc.schedule = schedule
+	return nil
+}
+
+// runSchedule starts each scenario's incident whenever its schedule fires,
+// in the service's local time (TZ). A scenario due while another incident is
+// active is skipped until its next run.
+func runSchedule(ctx context.Context, scenarios []scenario) {
+	for _, sc := range scenarios {
+		// The same schedule file can serve both tracks of a canary rollout
+		if canaryOnly(sc.Incident) && deployTrack != trackCanary {
+			logx.Infow(ctx, "⏭️ Scheduled scenario not armed, it only breaks canaries", "scenario", sc.Name, "incident_type", sc.Incident, "track", deployTrack)
+			continue
+		}
+		go func() {
+			for {
+				next := sc.schedule.Next(time.Now())
+				if next.IsZero() {
+					logx.Warnw(ctx, "⚠️ Scheduled scenario never runs", "scenario", sc.Name, "cron", sc.Cron)
+					return
+				}
+				logx.Infow(ctx, "📅 Scheduled scenario armed", "scenario", sc.Name, "incident_type", sc.Incident, "next_run", next.Format(time.RFC3339))
+
+				timer := time.NewTimer(time.Until(next))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+
+				scope := incidentScope{Operation: sc.Operation, CohortPercent: sc.CohortPercent}
+				if !startIncident(ctx, sc.Incident, scope, sc.Duration, sc.Name, sc.Latency) {
+					logx.Warnw(ctx, "⏭️ Scheduled scenario skipped, another incident is active", "scenario", sc.Name, "incident_type", sc.Incident)
+				}
+			}
+		}()
+	}
+}
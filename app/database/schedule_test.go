@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSchedule(t *testing.T) {
+	scenarios, err := loadSchedule("schedule.example.yaml")
+	if err != nil {
+		t.Fatalf("example schedule: %v", err)
+	}
+	for _, sc := range scenarios {
+		if sc.schedule == nil {
+			t.Errorf("scenario %s has no parsed schedule", sc.Name)
+		}
+	}
+
+	if scenarios, err := loadSchedule(""); scenarios != nil || err != nil {
+		t.Errorf("loadSchedule(\"\") = %v, %v, want no scenarios", scenarios, err)
+	}
+}
+
+func TestLoadScheduleErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		scenario string
+		want     string
+	}{
+		{"no name", "{cron: '@hourly', incident: deadlock, duration: 1m}", "name is required"},
+		{"unknown incident", "{name: s, cron: '@hourly', incident: meteor, duration: 1m}", `unknown incident "meteor"`},
+		{"no duration", "{name: s, cron: '@hourly', incident: deadlock}", "duration must be positive"},
+		{"operation and cohort", "{name: s, cron: '@hourly', incident: deadlock, duration: 1m, operation: transfer, cohort_percent: 10}", "exclusive"},
+		{"cohort over 100", "{name: s, cron: '@hourly', incident: deadlock, duration: 1m, cohort_percent: 150}", "cohort_percent"},
+		{"bad latency", "{name: s, cron: '@hourly', incident: high_latency, duration: 1m, latency: {kind: gaussian}}", "unknown latency distribution"},
+		{"bad cron", "{name: s, cron: '0 25 * * *', incident: deadlock, duration: 1m}", "hour"},
+		{"missing cron", "{name: s, incident: deadlock, duration: 1m}", "want 5 fields"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schedule.yaml")
+			if err := os.WriteFile(path, []byte("scenarios:\n  - "+tc.scenario+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadSchedule(path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("loadSchedule = %v, want an error mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
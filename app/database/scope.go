@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+
+	"incident-simulation/pkg/simrand"
+)
+
+// incidentScope limits an incident to part of the traffic, so the breaking
+// dimension (one operation, one cohort of users) has to be found rather than
+// every query failing alike. The zero value covers all traffic.
+type incidentScope struct {
+	Operation string
+	// CohortPercent is the share of users, hashed by user ID, the incident hits
+	CohortPercent int
+}
+
+// Scope of the active incident
+var activeScope atomic.Pointer[incidentScope]
+
+func currentScope() incidentScope {
+	if s := activeScope.Load(); s != nil {
+		return *s
+	}
+	return incidentScope{}
+}
+
+// covers reports whether req is affected by an incident with this scope
+func (s incidentScope) covers(req DatabaseRequest) bool {
+	if s.Operation != "" && req.Operation != s.Operation {
+		return false
+	}
+	if s.CohortPercent > 0 && userCohort(req.UserID) >= s.CohortPercent {
+		return false
+	}
+	return true
+}
+
+func (s incidentScope) String() string {
+	switch {
+	case s.Operation != "":
+		return "operation=" + s.Operation
+	case s.CohortPercent > 0:
+		return fmt.Sprintf("cohort=%d%%", s.CohortPercent)
+	default:
+		return "all"
+	}
+}
+
+// userCohort buckets a user ID into 0-99; the same user always lands in the
+// same bucket
+func userCohort(userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return int(h.Sum32() % 100)
+}
+
+// partialIncidents decides which incidents are scoped and to what
+type partialIncidents struct {
+	probability   float64
+	cohortPercent int
+}
+
+// choose returns the scope of a new incident. Only incidents that shape query
+// behaviour can be partial; pool, memory, CPU and goroutine exhaustion hit every query.
+func (p partialIncidents) choose(incident string) incidentScope {
+	// A bad instance or canary is sick as a whole, not for some of its traffic
+	if _, ok := incidentEffects[incident]; !ok || incident == "bad_instance" || canaryOnly(incident) || simrand.Float64() >= p.probability {
+		return incidentScope{}
+	}
+	if simrand.Intn(2) == 0 {
+		return incidentScope{CohortPercent: p.cohortPercent}
+	}
+
+	var operations []string
+	for op := range defaultProfiles {
+		if op != defaultOperation {
+			operations = append(operations, op)
+		}
+	}
+	sort.Strings(operations)
+	return incidentScope{Operation: operations[simrand.Intn(len(operations))]}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// incidentState is the active incident as saved to DB_STATE_FILE, so a
+// restart mid-incident resumes it instead of silently resetting the
+// simulation under a long-running detector training run
+type incidentState struct {
+	Type          string               `json:"type"`
+	Operation     string               `json:"operation,omitempty"`
+	CohortPercent int                  `json:"cohort_percent,omitempty"`
+	Scenario      string               `json:"scenario,omitempty"`
+	Latency       *latencyDistribution `json:"latency,omitempty"`
+	StartedAt     time.Time            `json:"started_at"`
+	EndsAt        time.Time            `json:"ends_at"`
+}
+
+func (st incidentState) scope() incidentScope {
+	return incidentScope{Operation: st.Operation, CohortPercent: st.CohortPercent}
+}
+
+// State file of this instance, empty when state is not persisted
+var stateFile string
+
+// instanceStateFile gives every replica but the first its own state file,
+// since each runs its own incidents
+func instanceStateFile(path string, index int) string {
+	if path == "" || index == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+// saveIncidentState writes st to the state file, or removes the file for nil
+// once no incident is active
+func saveIncidentState(ctx context.Context, st *incidentState) {
+	if stateFile == "" {
+		return
+	}
+	if st == nil {
+		if err := os.Remove(stateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logx.Errorw(ctx, "Failed to remove incident state", "path", stateFile, "error", err)
+		}
+		return
+	}
+
+	data, err := jsonx.Marshal(st)
+	if err == nil {
+		// Written aside and renamed so a crash never leaves half a file
+		tmp := stateFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, stateFile)
+		}
+	}
+	if err != nil {
+		logx.Errorw(ctx, "Failed to save incident state", "path", stateFile, "error", err)
+	}
+}
+
+// loadIncidentState reads the state file; nil means no incident was active
+func loadIncidentState(path string) (*incidentState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read incident state: %w", err)
+	}
+	var st incidentState
+	if err := jsonx.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse incident state %s: %w", path, err)
+	}
+	if !slices.Contains(incidentTypes, st.Type) {
+		return nil, fmt.Errorf("incident state %s: unknown incident %q", path, st.Type)
+	}
+	return &st, nil
+}
+
+// restoreIncident resumes the incident the state file holds for the rest of
+// its duration and announces the restart with a service_restarted event. An
+// incident that ended while the service was down is only announced.
+func restoreIncident(ctx context.Context) {
+	if stateFile == "" {
+		return
+	}
+	ctx, span := otel.Tracer("database-service").Start(ctx, "Restore Incident State")
+	defer span.End()
+
+	st, err := loadIncidentState(stateFile)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid incident state")
+		logx.Errorw(ctx, "Failed to restore incident state, starting without an incident", "path", stateFile, "error", err)
+		saveIncidentState(ctx, nil)
+		return
+	}
+	if st == nil {
+		return
+	}
+
+	remaining := time.Until(st.EndsAt).Round(time.Second)
+	resume := remaining > 0
+	message := fmt.Sprintf("restarted mid-incident, resuming it with %s left", remaining)
+	switch {
+	case canaryOnly(st.Type) && deployTrack != trackCanary:
+		resume = false
+		message = "restarted as a " + deployTrack + " version, the canary incident is not resumed"
+	case !resume:
+		message = "restarted after the incident would have ended"
+	}
+	span.SetAttributes(
+		attrs.IncidentType(st.Type),
+		attrs.IncidentScope(st.scope().String()),
+		attrs.IncidentStartedAt(st.StartedAt),
+		attrs.IncidentRemaining(max(remaining, 0)),
+		attrs.IncidentResumed(resume),
+	)
+
+	logx.Warnw(ctx, "🔁 Database service "+message, "incident_type", st.Type, "incident_scope", st.scope().String(),
+		"scenario", st.Scenario, "started_at", st.StartedAt.Format(time.RFC3339), "remaining", remaining.String())
+	events.announceRestart(Event{Type: "service_restarted", IncidentType: st.Type, Scope: st.scope().String(), Scenario: st.Scenario, Message: message})
+
+	if !resume {
+		dbHistory.interrupted(ctx, *st)
+		saveIncidentState(ctx, nil)
+		return
+	}
+	runIncident(ctx, *st)
+}
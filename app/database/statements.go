@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/simrand"
+)
+
+// statement is one synthetic SQL statement an operation runs. The template's
+// {user} and {amount} are filled with the request's literal values, which
+// sanitizeSQL strips again before the text reaches a span.
+type statement struct {
+	summary  string
+	table    string
+	template string
+}
+
+// Every query runs one statement of its operation, so slow-query analysis has
+// a handful of distinct texts per operation to group by
+var statementCatalog = map[string][]statement{
+	defaultOperation: {
+		{"SELECT audit_log", "audit_log", "SELECT id, action, created_at FROM audit_log WHERE user_id = '{user}' ORDER BY created_at DESC LIMIT 50"},
+	},
+	"get_balance": {
+		{"SELECT accounts", "accounts", "SELECT balance, currency FROM accounts WHERE user_id = '{user}'"},
+		{"SELECT currencies", "currencies", "SELECT code, precision FROM currencies WHERE code = 'USD'"},
+	},
+	"balance_check": {
+		{"SELECT accounts", "accounts", "SELECT balance, available_balance FROM accounts WHERE user_id = '{user}' FOR SHARE"},
+		{"SELECT holds", "holds", "SELECT SUM(amount) FROM holds WHERE user_id = '{user}' AND released_at IS NULL"},
+	},
+	"transfer": {
+		{"SELECT accounts", "accounts", "SELECT balance FROM accounts WHERE user_id = '{user}' FOR UPDATE"},
+		{"UPDATE accounts", "accounts", "UPDATE accounts SET balance = balance - {amount}, updated_at = now() WHERE user_id = '{user}'"},
+		{"INSERT transactions", "transactions", "INSERT INTO transactions (user_id, amount, kind) VALUES ('{user}', {amount}, 'transfer')"},
+	},
+	"transfer_debit": {
+		{"UPDATE accounts", "accounts", "UPDATE accounts SET balance = balance - {amount} WHERE user_id = '{user}' AND balance >= {amount}"},
+	},
+	"transfer_credit": {
+		{"UPDATE accounts", "accounts", "UPDATE accounts SET balance = balance + {amount} WHERE user_id = '{user}'"},
+	},
+	"transfer_compensate": {
+		{"UPDATE accounts", "accounts", "UPDATE accounts SET balance = balance + {amount} WHERE user_id = '{user}'"},
+		{"INSERT transactions", "transactions", "INSERT INTO transactions (user_id, amount, kind) VALUES ('{user}', {amount}, 'transfer_refund')"},
+	},
+	"deposit": {
+		{"UPDATE accounts", "accounts", "UPDATE accounts SET balance = balance + {amount}, updated_at = now() WHERE user_id = '{user}'"},
+		{"INSERT transactions", "transactions", "INSERT INTO transactions (user_id, amount, kind) VALUES ('{user}', {amount}, 'deposit')"},
+	},
+	"withdrawal": {
+		{"UPDATE accounts", "accounts", "UPDATE accounts SET balance = balance - {amount} WHERE user_id = '{user}' AND balance >= {amount}"},
+		{"INSERT transactions", "transactions", "INSERT INTO transactions (user_id, amount, kind) VALUES ('{user}', {amount}, 'withdrawal')"},
+	},
+}
+
+// query is the statement a request runs, with its sanitized text
+type query struct {
+	summary string
+	table   string
+	text    string
+	// slow is set while a high_latency incident has picked this statement
+	slow bool
+}
+
+// statements picks the statement of each query and, during high_latency
+// incidents, which statements are the slow ones
+type statements struct {
+	mu   sync.RWMutex
+	slow map[string]bool
+}
+
+// pick returns a random statement of req's operation, rendered and sanitized
+func (s *statements) pick(req DatabaseRequest) query {
+	candidates, ok := statementCatalog[req.Operation]
+	if !ok {
+		candidates = statementCatalog[defaultOperation]
+	}
+	st := candidates[simrand.Intn(len(candidates))]
+
+	s.mu.RLock()
+	slow := s.slow[st.template]
+	s.mu.RUnlock()
+	return query{summary: st.summary, table: st.table, text: st.render(req), slow: slow}
+}
+
+// render fills in req's values and sanitizes the result
+func (st statement) render(req DatabaseRequest) string {
+	raw := strings.NewReplacer(
+		"{user}", strings.ReplaceAll(req.UserID, "'", "''"),
+		"{amount}", strconv.FormatFloat(req.Amount, 'f', 2, 64),
+	).Replace(st.template)
+	return sanitizeSQL(raw)
+}
+
+// slowDown marks one statement per operation as slow until the returned
+// function is called
+func (s *statements) slowDown(ctx context.Context) func() {
+	slow := make(map[string]bool, len(statementCatalog))
+	var picked []string
+	for _, candidates := range statementCatalog {
+		st := candidates[simrand.Intn(len(candidates))]
+		slow[st.template] = true
+		picked = append(picked, st.render(DatabaseRequest{}))
+	}
+	logx.Warnw(ctx, "🐢 Slow queries selected", "queries", strings.Join(picked, "; "))
+
+	s.mu.Lock()
+	s.slow = slow
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		s.slow = nil
+		s.mu.Unlock()
+	}
+}
+
+var (
+	sqlStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// sanitizeSQL replaces string and numeric literals with ? so user IDs and
+// amounts never reach telemetry
+func sanitizeSQL(sql string) string {
+	sql = sqlStringLiteral.ReplaceAllString(sql, "?")
+	return sqlNumericLiteral.ReplaceAllString(sql, "?")
+}
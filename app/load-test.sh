@@ -10,7 +10,7 @@ make_requests() {
     for i in $(seq 1 $count); do
         curl -s -X POST $endpoint \
             -H "Content-Type: application/json" \
-            -d '{"user_id":"user_'$((RANDOM % 100))'","amount":'$((RANDOM % 1000))'.50,"operation":"transfer"}' || true
+            -d '{"user_id":"user_'$((RANDOM % 100))'","amount":'$((RANDOM % 1000))'.50,"operation":"transfer","to_user_id":"user_'$((RANDOM % 100 + 100))'"}' || true
         sleep $delay
     done
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+
+	"incident-simulation/pkg/httpx"
+)
+
+// client is the device and location a user's journeys come from
+type client struct {
+	Device    string
+	UserAgent string
+	Country   string
+	IP        string
+}
+
+// device is a kind of client with its share of users and the User-Agents
+// it sends; the core API derives the device back from the User-Agent
+type device struct {
+	name       string
+	weight     int
+	userAgents []string
+}
+
+// country is a client location with its share of users
+type country struct {
+	code   string
+	weight int
+}
+
+// Devices users are spread over
+var devices = []device{
+	{"ios", 35, []string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+		"PayApp/4.12.0 (iPhone15,2; iOS 17.5.1) CFNetwork/1496.0.7 Darwin/23.5.0",
+		"Mozilla/5.0 (iPad; CPU OS 16_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+	}},
+	{"android", 35, []string{
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+		"PayApp/4.12.0 (Android 13; SM-S911B) okhttp/4.12.0",
+	}},
+	{"desktop", 30, []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	}},
+}
+
+// Countries users are spread over, by weight. Each gets its own /20 of the
+// 198.18.0.0/15 benchmarking range for synthetic client addresses, which
+// enrichment.example.yaml maps back to the country.
+var countries = []country{
+	{"US", 40}, {"DE", 15}, {"GB", 15}, {"IN", 15}, {"BR", 10}, {"SG", 5},
+}
+
+// clientOf returns the client of user; a user keeps one client across
+// journeys, so a failure on one device shows up as failing users
+func clientOf(user int) client {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "user_%d", user)
+	sum := h.Sum32()
+
+	d := devices[pickWeighted(int(sum%100), len(devices), func(i int) int { return devices[i].weight })]
+	c := pickWeighted(int(sum/100%100), len(countries), func(i int) int { return countries[i].weight })
+	return client{
+		Device:    d.name,
+		UserAgent: d.userAgents[int(sum/10000)%len(d.userAgents)],
+		Country:   countries[c].code,
+		IP:        fmt.Sprintf("198.18.%d.%d", c*16+user/256%16, user%256),
+	}
+}
+
+// pickWeighted returns the index whose share of the weights n (0-99) falls in
+func pickWeighted(n, count int, weight func(int) int) int {
+	total := 0
+	for i := 0; i < count; i++ {
+		total += weight(i)
+	}
+	n = n * total / 100
+	for i := 0; i < count; i++ {
+		if n < weight(i) {
+			return i
+		}
+		n -= weight(i)
+	}
+	return count - 1
+}
+
+// setHeaders sends the client's identity the way a browser or app behind an
+// edge proxy would: its User-Agent, its address in X-Forwarded-For and the
+// country the edge geolocated it to
+func (c client) setHeaders(header http.Header) {
+	header.Set("User-Agent", c.UserAgent)
+	header.Set("X-Forwarded-For", c.IP)
+	header.Set(httpx.HeaderGeoCountry, c.Country)
+}
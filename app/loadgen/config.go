@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"incident-simulation/pkg/chaos"
+	"incident-simulation/pkg/config"
+)
+
+// Config is the load generator configuration
+type Config struct {
+	config.OTLP
+	config.Output
+	config.Propagation
+	config.Scrubbing
+
+	CoreServiceURL     string        `env:"CORE_SERVICE_URL" flag:"core-service-url" default:"http://127.0.0.1:8080" usage:"Core API base URL"`
+	AuthServiceURL     string        `env:"AUTH_SERVICE_URL" flag:"auth-service-url" default:"http://127.0.0.1:8083" usage:"Auth service base URL for the login step (empty skips login)"`
+	JourneyConcurrency int           `env:"JOURNEY_CONCURRENCY" flag:"concurrency" default:"2" usage:"Number of concurrent journey workers"`
+	JourneyIterations  int           `env:"JOURNEY_ITERATIONS" flag:"iterations" default:"0" usage:"Journeys per worker (0 runs until interrupted)"`
+	JourneyInterval    time.Duration `env:"JOURNEY_INTERVAL" flag:"interval" default:"1s" usage:"Pause between journeys per worker"`
+	CoreAPIAttempts    int           `env:"CORE_API_ATTEMPTS" flag:"core-api-attempts" default:"1" usage:"Tries per core API call; above 1, throttled and shed calls and failed reads are retried with backoff"`
+	CoreAPIBackoff     time.Duration `env:"CORE_API_BACKOFF" flag:"core-api-backoff" default:"100ms" usage:"Wait before the first core API retry, doubling after each one"`
+	SimSeed            int64         `env:"SIM_SEED" flag:"seed" usage:"Seed journey choices, users and amounts for a repeatable run (0 seeds from the clock)"`
+
+	FreezeURL  string        `env:"FREEZE_URL" flag:"freeze-url" usage:"Analyzer error budget polled to pause chaos and aggressive journeys while it is exhausted, e.g. http://127.0.0.1:8084/api/v1/error-budget (empty disables)"`
+	FreezePoll time.Duration `env:"FREEZE_POLL" flag:"freeze-poll" default:"15s" usage:"How often FREEZE_URL is polled"`
+
+	ChaosProbability float64       `env:"CHAOS_PROBABILITY" flag:"chaos-probability" default:"0" usage:"Share of journeys sent with X-Chaos-* headers (services need DEV_MODE)"`
+	ChaosDelay       time.Duration `env:"CHAOS_DELAY" flag:"chaos-delay" usage:"X-Chaos-Delay for chaos journeys"`
+	ChaosFail        int           `env:"CHAOS_FAIL" flag:"chaos-fail" usage:"X-Chaos-Fail status for chaos journeys"`
+	ChaosTarget      string        `env:"CHAOS_TARGET" flag:"chaos-target" usage:"X-Chaos-Target service for chaos journeys (empty targets the core API)"`
+	ChaosDevice      string        `env:"CHAOS_DEVICE" flag:"chaos-device" usage:"Only users on this device (ios, android or desktop) get chaos journeys (empty allows all)"`
+	ChaosCountry     string        `env:"CHAOS_COUNTRY" flag:"chaos-country" usage:"Only users in this country (US, DE, GB, IN, BR or SG) get chaos journeys (empty allows all)"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.JourneyConcurrency < 1 {
+		errs = append(errs, errors.New("JOURNEY_CONCURRENCY must be at least 1"))
+	}
+	if c.JourneyIterations < 0 {
+		errs = append(errs, errors.New("JOURNEY_ITERATIONS must not be negative"))
+	}
+	if c.CoreAPIAttempts < 1 {
+		errs = append(errs, errors.New("CORE_API_ATTEMPTS must be at least 1"))
+	}
+	if c.CoreAPIBackoff < 0 {
+		errs = append(errs, errors.New("CORE_API_BACKOFF must not be negative"))
+	}
+	if c.FreezeURL != "" && c.FreezePoll <= 0 {
+		errs = append(errs, errors.New("FREEZE_POLL must be positive"))
+	}
+	if c.ChaosProbability < 0 || c.ChaosProbability > 1 {
+		errs = append(errs, errors.New("CHAOS_PROBABILITY must be between 0 and 1"))
+	}
+	if c.ChaosFail != 0 && (c.ChaosFail < 400 || c.ChaosFail > 599) {
+		errs = append(errs, errors.New("CHAOS_FAIL must be an HTTP status between 400 and 599"))
+	}
+	if c.ChaosDelay < 0 || c.ChaosDelay > chaos.MaxDelay {
+		errs = append(errs, fmt.Errorf("CHAOS_DELAY must be between 0 and %s", chaos.MaxDelay))
+	}
+	if c.ChaosDevice != "" && !slices.ContainsFunc(devices, func(d device) bool { return d.name == c.ChaosDevice }) {
+		errs = append(errs, errors.New("CHAOS_DEVICE must be ios, android or desktop"))
+	}
+	if c.ChaosCountry != "" && !slices.ContainsFunc(countries, func(k country) bool { return k.code == c.ChaosCountry }) {
+		errs = append(errs, errors.New("CHAOS_COUNTRY must be US, DE, GB, IN, BR or SG"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// errorBudget is the part of the analyzer's error budget status the load
+// generator acts on
+type errorBudget struct {
+	Service         string  `json:"service"`
+	Freeze          bool    `json:"freeze"`
+	BudgetRemaining float64 `json:"budget_remaining"`
+}
+
+// watchFreeze polls the analyzer's error budget every poll until ctx is done
+// and freezes the runner while the budget is exhausted. An unreachable
+// analyzer keeps the last state.
+func (r *journeyRunner) watchFreeze(ctx context.Context, url string, poll time.Duration) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		budget, err := fetchErrorBudget(ctx, client, url)
+		switch {
+		case err != nil:
+			if err.Error() != lastErr {
+				log.Printf("⚠️  Error budget not available: %v", err)
+				lastErr = err.Error()
+			}
+		case r.frozen.Swap(budget.Freeze) != budget.Freeze:
+			lastErr = ""
+			if budget.Freeze {
+				log.Printf("🧊 Error budget of %s exhausted (%.0f%% left): pausing chaos and aggressive journeys", budget.Service, budget.BudgetRemaining*100)
+			} else {
+				log.Printf("🌤️ Error budget of %s recovered (%.0f%% left): resuming all journeys", budget.Service, budget.BudgetRemaining*100)
+			}
+		default:
+			lastErr = ""
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func fetchErrorBudget(ctx context.Context, client *http.Client, url string) (errorBudget, error) {
+	var budget errorBudget
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return budget, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return budget, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return budget, fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	err = jsonx.NewDecoder(resp.Body).Decode(&budget)
+	return budget, err
+}
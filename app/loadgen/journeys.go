@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/chaos"
+	apiclient "incident-simulation/pkg/client"
+	"incident-simulation/pkg/costing"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/simrand"
+)
+
+// journeyState is shared between the steps of a single journey run
+type journeyState struct {
+	UserID string
+	// Tenant is the customer the user belongs to, billed by the core API's cost metrics
+	Tenant string
+	// Client is the device and location the user's requests come from
+	Client client
+	// Token is the bearer token obtained by the login step, if any
+	Token string
+	// Chaos is the fault injected into this journey's core API calls, if any
+	Chaos *chaos.Fault
+	// Priority is sent as X-Priority on the journey's core API calls
+	Priority string
+}
+
+// step is one business action inside a journey
+type step struct {
+	Name string
+	Run  func(ctx context.Context, r *journeyRunner, st *journeyState) error
+}
+
+// journey is a named multi-step business flow
+type journey struct {
+	Name   string
+	Weight int
+	Steps  []step
+	// Aggressive journeys are held back while the error budget is frozen
+	Aggressive bool
+	// Priority is the class the core API sheds the journey's requests by
+	Priority string
+}
+
+var (
+	stepLogin = step{Name: "login", Run: func(ctx context.Context, r *journeyRunner, st *journeyState) error {
+		// Client-side think time before submitting credentials
+		time.Sleep(time.Duration(20+simrand.Intn(80)) * time.Millisecond)
+		if r.authURL == "" {
+			return nil
+		}
+
+		var token struct {
+			AccessToken string `json:"access_token"`
+		}
+		header := http.Header{}
+		st.Client.setHeaders(header)
+		if err := r.call(ctx, http.MethodPost, r.authURL+"/auth/token", header, map[string]interface{}{
+			"user_id": st.UserID,
+		}, &token); err != nil {
+			return err
+		}
+		st.Token = token.AccessToken
+		return nil
+	}}
+
+	stepBalanceCheck = step{Name: "balance_check", Run: func(ctx context.Context, r *journeyRunner, st *journeyState) error {
+		_, err := r.api.GetBalance(ctx, st.UserID, r.callOptions(st)...)
+		return err
+	}}
+
+	stepTransaction = step{Name: "transaction", Run: func(ctx context.Context, r *journeyRunner, st *journeyState) error {
+		recipient := st.UserID
+		for recipient == st.UserID {
+			recipient = fmt.Sprintf("user_%d", simrand.Intn(1000))
+		}
+		_, err := r.api.CreateTransaction(ctx, apiclient.TransactionRequest{
+			UserID:    st.UserID,
+			Amount:    float64(simrand.Intn(100000)+1) / 100,
+			Operation: apiclient.OperationTransfer,
+			ToUserID:  recipient,
+		}, r.callOptions(st)...)
+		return err
+	}}
+
+	// stepBatch submits several deposits at once; the core API fans them out
+	stepBatch = step{Name: "batch", Run: func(ctx context.Context, r *journeyRunner, st *journeyState) error {
+		items := make([]apiclient.TransactionRequest, 2+simrand.Intn(9))
+		for i := range items {
+			items[i] = apiclient.TransactionRequest{
+				UserID:    st.UserID,
+				Amount:    float64(simrand.Intn(50000)+1) / 100,
+				Operation: apiclient.OperationDeposit,
+			}
+		}
+		_, err := r.api.CreateBatch(ctx, items, r.callOptions(st)...)
+		return err
+	}}
+)
+
+// Tenants users are spread over, by user number
+var tenants = []string{"acme", "globex", "initech", "umbrella"}
+
+// Journeys executed by the generator, picked by weight
+var journeys = []journey{
+	{Name: "checkout", Weight: 6, Steps: []step{stepLogin, stepBalanceCheck, stepTransaction, stepBalanceCheck}, Priority: httpx.PriorityCritical},
+	{Name: "balance_inquiry", Weight: 3, Steps: []step{stepLogin, stepBalanceCheck}, Priority: httpx.PriorityNormal},
+	{Name: "quick_pay", Weight: 1, Steps: []step{stepLogin, stepTransaction}, Priority: httpx.PriorityCritical},
+	{Name: "bulk_deposit", Weight: 1, Steps: []step{stepLogin, stepBatch, stepBalanceCheck}, Aggressive: true, Priority: httpx.PriorityBatch},
+}
+
+type journeyRunner struct {
+	api     *apiclient.Client
+	authURL string
+	// client calls the auth service
+	client *http.Client
+
+	// chaos is injected into a chaosProbability share of journeys, only of
+	// users on chaosDevice and in chaosCountry when those are set
+	chaos            chaos.Fault
+	chaosProbability float64
+	chaosDevice      string
+	chaosCountry     string
+
+	// frozen is set while the analyzer reports the error budget exhausted;
+	// chaos and aggressive journeys pause until it recovers
+	frozen atomic.Bool
+}
+
+func newJourneyRunner(api *apiclient.Client, authURL string, fault chaos.Fault, probability float64, device, country string) *journeyRunner {
+	return &journeyRunner{
+		api:              api,
+		authURL:          authURL,
+		chaos:            fault,
+		chaosProbability: probability,
+		chaosDevice:      device,
+		chaosCountry:     country,
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   30 * time.Second,
+		},
+	}
+}
+
+func (r *journeyRunner) loop(ctx context.Context, iterations int, interval time.Duration) {
+	for i := 0; iterations == 0 || i < iterations; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		r.run(ctx, pickJourney(r.frozen.Load()))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// run executes every step of j under a single root span
+func (r *journeyRunner) run(ctx context.Context, j journey) {
+	user := simrand.Intn(1000)
+	st := &journeyState{UserID: fmt.Sprintf("user_%d", user), Tenant: tenants[user%len(tenants)], Client: clientOf(user), Priority: j.Priority}
+	journeyID := fmt.Sprintf("jrn_%d_%d", time.Now().Unix(), simrand.Intn(10000))
+	frozen := r.frozen.Load()
+	if !frozen && !r.chaos.IsZero() && r.chaosTargets(st.Client) && simrand.Float64() < r.chaosProbability {
+		st.Chaos = &r.chaos
+	}
+
+	ctx, span := otel.Tracer("loadgen").Start(ctx, "Journey "+j.Name,
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("journey.name", j.Name),
+		attribute.String("journey.id", journeyID),
+		semconv.UserID(st.UserID),
+		attrs.TenantID(st.Tenant),
+		attrs.ClientDevice(st.Client.Device),
+		semconv.UserAgentOriginal(st.Client.UserAgent),
+		semconv.GeoCountryISOCode(st.Client.Country),
+		attrs.RequestPriority(j.Priority),
+		attribute.Int("journey.steps", len(j.Steps)),
+		attribute.Bool("chaos.injected", st.Chaos != nil),
+		attribute.Bool("loadgen.frozen", frozen),
+	)
+
+	for i, s := range j.Steps {
+		stepCtx, stepSpan := otel.Tracer("loadgen").Start(ctx, "Step "+s.Name)
+		stepSpan.SetAttributes(
+			attribute.String("journey.name", j.Name),
+			attribute.String("journey.step", s.Name),
+			attribute.Int("journey.step_index", i),
+		)
+
+		err := s.Run(stepCtx, r, st)
+		if err != nil {
+			var apiErr *apiclient.Error
+			if errors.As(err, &apiErr) {
+				stepSpan.SetAttributes(semconv.ErrorTypeKey.String(string(apiErr.Kind)))
+			}
+			stepSpan.RecordError(err)
+			stepSpan.SetStatus(codes.Error, err.Error())
+			stepSpan.End()
+
+			span.SetAttributes(attribute.String("journey.failed_step", s.Name))
+			span.SetStatus(codes.Error, fmt.Sprintf("step %s failed", s.Name))
+			log.Printf("❌ Journey %s (%s) failed at step %s: %v", j.Name, journeyID, s.Name, err)
+			return
+		}
+		stepSpan.End()
+	}
+
+	log.Printf("✅ Journey %s (%s) completed", j.Name, journeyID)
+}
+
+// chaosTargets reports whether chaos may hit journeys of c
+func (r *journeyRunner) chaosTargets(c client) bool {
+	return (r.chaosDevice == "" || r.chaosDevice == c.Device) && (r.chaosCountry == "" || r.chaosCountry == c.Country)
+}
+
+// callOptions sends the journey's tenant, priority, client, token and chaos
+// headers with a core API call
+func (r *journeyRunner) callOptions(st *journeyState) []apiclient.CallOption {
+	header := http.Header{}
+	header.Set(costing.HeaderTenant, st.Tenant)
+	header.Set(httpx.HeaderPriority, st.Priority)
+	st.Client.setHeaders(header)
+	opts := []apiclient.CallOption{apiclient.WithHeaders(header)}
+	if st.Token != "" {
+		opts = append(opts, apiclient.WithBearerToken(st.Token))
+	}
+	if f := st.Chaos; f != nil {
+		if f.Delay > 0 {
+			header.Set(chaos.HeaderDelay, f.Delay.String())
+		}
+		if f.FailStatus > 0 {
+			header.Set(chaos.HeaderFail, strconv.Itoa(f.FailStatus))
+		}
+		if f.Target != "" {
+			header.Set(chaos.HeaderTarget, f.Target)
+		}
+	}
+	return opts
+}
+
+// call performs a request, fails on non-2xx responses and decodes the body into out when set
+func (r *journeyRunner) call(ctx context.Context, method, url string, header http.Header, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := jsonx.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("%s %s returned %d", method, req.URL.Path, resp.StatusCode)
+	}
+	if out != nil {
+		return jsonx.NewDecoder(resp.Body).Decode(out)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// pickJourney picks a journey by weight, skipping aggressive ones while frozen
+func pickJourney(frozen bool) journey {
+	total := 0
+	for _, j := range journeys {
+		if !frozen || !j.Aggressive {
+			total += j.Weight
+		}
+	}
+	n := simrand.Intn(total)
+	for _, j := range journeys {
+		if frozen && j.Aggressive {
+			continue
+		}
+		if n < j.Weight {
+			return j
+		}
+		n -= j.Weight
+	}
+	return journeys[0]
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/chaos"
+	apiclient "incident-simulation/pkg/client"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Load configuration (flags > env > .env > YAML > defaults)
+	var cfg Config
+	config.MustLoad(&cfg)
+	log.Println("⚙️  Load generator configuration:")
+	config.Print(log.Writer(), &cfg)
+
+	// Seeded runs replay the same journeys, users and amounts
+	if cfg.SimSeed != 0 {
+		simrand.Seed(cfg.SimSeed)
+	}
+
+	// Initialize OpenTelemetry
+	shutdown := initOpenTelemetry(ctx, "loadgen", cfg)
+	defer shutdown()
+
+	api := apiclient.New(cfg.CoreServiceURL, apiclient.WithRetries(cfg.CoreAPIAttempts, cfg.CoreAPIBackoff))
+	runner := newJourneyRunner(api, cfg.AuthServiceURL, chaos.Fault{
+		Delay:      cfg.ChaosDelay,
+		FailStatus: cfg.ChaosFail,
+		Target:     cfg.ChaosTarget,
+	}, cfg.ChaosProbability, cfg.ChaosDevice, cfg.ChaosCountry)
+
+	// Closed loop with the analyzer's error budget
+	if cfg.FreezeURL != "" {
+		go runner.watchFreeze(ctx, cfg.FreezeURL, cfg.FreezePoll)
+	}
+
+	log.Printf("🚦 Load generator running %d worker(s) against %s", cfg.JourneyConcurrency, cfg.CoreServiceURL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.JourneyConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runner.loop(ctx, cfg.JourneyIterations, cfg.JourneyInterval)
+		}()
+	}
+	wg.Wait()
+
+	log.Println("✅ Load generator finished")
+}
+
+func initOpenTelemetry(ctx context.Context, serviceName string, cfg Config) func() {
+	// Resource with service information; OTEL_RESOURCE_ATTRIBUTES overrides it
+	res, err := telemetry.NewResource(ctx, serviceName)
+	if err != nil {
+		log.Fatalf("Failed to create resource: %v", err)
+	}
+
+	// OTLP (endpoint, TLS, headers) or stdout/file exporter
+	exporters, err := telemetry.NewExporters(cfg.OTLP, cfg.Output)
+	if err != nil {
+		log.Fatalf("Invalid telemetry exporter settings: %v", err)
+	}
+
+	// Trace exporter
+	traceExporter, err := exporters.Trace(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create trace exporter: %v", err)
+	}
+
+	// Trace provider; personal data is scrubbed before spans are exported
+	scrubber := telemetry.NewScrubber(cfg.Scrubbing)
+	tp := trace.NewTracerProvider(
+		trace.WithSpanProcessor(scrubber.SpanProcessor(trace.NewBatchSpanProcessor(traceExporter))),
+		trace.WithResource(res),
+		trace.WithSampler(trace.AlwaysSample()),
+	)
+	otel.SetTracerProvider(tp)
+
+	// Text map propagators from OTEL_PROPAGATORS
+	propagator, err := telemetry.NewPropagator(cfg.Propagators)
+	if err != nil {
+		log.Fatalf("Invalid propagator settings: %v", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down tracer provider: %v", err)
+		}
+		exporters.Close()
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"incident-simulation/pkg/config"
+)
+
+// Config is the payment gateway simulator configuration
+type Config struct {
+	config.Telemetry
+	config.Audit
+	config.Profiling
+	config.Dev
+	config.Simulation
+	config.Deploy
+
+	ListenAddr          string        `env:"LISTEN_ADDR" flag:"listen" default:":8082" usage:"HTTP listen address"`
+	IncidentInterval    time.Duration `env:"INCIDENT_INTERVAL" flag:"incident-interval" default:"60s" usage:"How often the simulator considers starting an incident"`
+	IncidentProbability float64       `env:"INCIDENT_PROBABILITY" flag:"incident-probability" default:"0.2" usage:"Chance of starting an incident at each interval"`
+	ThreeDSThreshold    float64       `env:"THREE_DS_THRESHOLD" flag:"three-ds-threshold" default:"500" usage:"Payments at or above this amount require a 3DS challenge"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.IncidentInterval <= 0 {
+		errs = append(errs, errors.New("INCIDENT_INTERVAL must be positive"))
+	}
+	if c.IncidentProbability < 0 || c.IncidentProbability > 1 {
+		errs = append(errs, errors.New("INCIDENT_PROBABILITY must be between 0 and 1"))
+	}
+	errs = append(errs, c.Batching.Validate(), c.Sampling.Validate(), c.Logging.Validate(), c.Deploy.Validate())
+	return errors.Join(errs...)
+}
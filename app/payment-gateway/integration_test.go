@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/deploy"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
+	"incident-simulation/pkg/telemetry/telemetrytest"
+)
+
+// newTestService builds the payment gateway with its real telemetry setup
+// exporting to an in-memory collector and the provider incident set to
+// kind on network; flush shuts the providers down so everything emitted so
+// far has arrived
+func newTestService(t *testing.T, kind, network string) (http.Handler, *telemetrytest.Collector, func()) {
+	t.Helper()
+	collector := telemetrytest.NewCollector(t)
+
+	var cfg Config
+	if err := config.Load(&cfg, []string{
+		"-telemetry-exporter=otlp", "-otlp-insecure", "-otlp-endpoint=" + collector.Endpoint(),
+	}); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	// A fixed seed keeps the 1% random decline out of the way
+	simrand.Seed(1)
+	incident.mu.Lock()
+	incident.active, incident.kind, incident.network = kind != "none", kind, network
+	incident.mu.Unlock()
+	t.Cleanup(func() {
+		incident.mu.Lock()
+		incident.active, incident.kind, incident.network = false, "none", ""
+		incident.mu.Unlock()
+	})
+
+	ctx := context.Background()
+	recorder := telemetry.NewRecorder("payment-gateway", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	heatmap := telemetry.NewHeatmap("payment-gateway", cfg.LatencyHeatmapMinutes)
+	deploys := deploy.New("payment-gateway", cfg.Deploy, http.DefaultClient, logDeployment)
+	shutdown := initOpenTelemetry(ctx, "payment-gateway", cfg.Telemetry, recorder, health, heatmap, deploys.SpanProcessor())
+	initMetrics(ctx)
+	handler := newPaymentHandler(cfg, recorder, health, heatmap, deploys)
+
+	var once sync.Once
+	flush := func() { once.Do(shutdown) }
+	t.Cleanup(flush)
+	return handler, collector, flush
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthorizeTelemetry(t *testing.T) {
+	handler, collector, flush := newTestService(t, "none", "")
+
+	rec := serve(handler, http.MethodPost, "/payments/authorize", `{"transaction_id":"txn_1","user_id":"user_1","amount":20}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	flush()
+
+	server := collector.Span(t, "payment-gateway")
+	if server.Kind != "server" || server.StatusCode != "unset" {
+		t.Errorf("server span kind %s status %s, want server unset", server.Kind, server.StatusCode)
+	}
+	span := collector.Span(t, "Authorize Payment")
+	if span.ParentSpanID != server.SpanID || span.StatusCode != "unset" {
+		t.Errorf("Authorize Payment parent %s status %s, want %s unset", span.ParentSpanID, span.StatusCode, server.SpanID)
+	}
+	network := networkFor("user_1")
+	telemetrytest.AssertAttributes(t, "Authorize Payment", span.Attributes, map[string]string{
+		"app.transaction.id": "txn_1",
+		"user.id":            "user_1",
+		"payment.amount":     "20",
+		"payment.currency":   "USD",
+		"payment.network":    network,
+		"payment.three_ds":   "false",
+		"payment.status":     "authorized",
+		"sim.incident.type":  "none",
+	})
+
+	assertCount(t, collector, "payment_requests_total", map[string]string{"status": "authorized", "network": network}, 1)
+	assertHistogramCount(t, collector, "payment_duration_seconds", map[string]string{"network": network}, 1)
+	if points := collector.PointsNamed("payment_errors_total", nil); len(points) != 0 {
+		t.Errorf("payment_errors_total recorded on success: %+v", points)
+	}
+
+	logs := collector.LogsWithBody("Payment authorized")
+	if len(logs) != 1 {
+		t.Fatalf("got %d authorized logs, want 1", len(logs))
+	}
+	if logs[0].Severity != "info" || logs[0].SpanID != span.SpanID {
+		t.Errorf("authorized log severity %q span %s, want info %s", logs[0].Severity, logs[0].SpanID, span.SpanID)
+	}
+	telemetrytest.AssertAttributes(t, "authorized log", logs[0].Attributes, map[string]string{
+		"transaction.id":  "txn_1",
+		"payment.id":      "*",
+		"payment.network": network,
+	})
+}
+
+func TestAuthorizeOutageTelemetry(t *testing.T) {
+	network := networkFor("user_1")
+	handler, collector, flush := newTestService(t, "partial_outage", network)
+
+	rec := serve(handler, http.MethodPost, "/payments/authorize", `{"transaction_id":"txn_1","user_id":"user_1","amount":20}`)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	flush()
+
+	if server := collector.Span(t, "payment-gateway"); server.StatusCode != "error" {
+		t.Errorf("server span status %s, want error for a 503", server.StatusCode)
+	}
+	span := collector.Span(t, "Authorize Payment")
+	if span.StatusCode != "error" || span.StatusMessage != network+" network unavailable" {
+		t.Errorf("Authorize Payment status %s %q, want error \"%s network unavailable\"", span.StatusCode, span.StatusMessage, network)
+	}
+	telemetrytest.AssertAttributes(t, "Authorize Payment", span.Attributes, map[string]string{
+		"payment.status":       "error",
+		"payment.decline_code": "network_unavailable",
+		"sim.incident.type":    "partial_outage",
+	})
+
+	assertCount(t, collector, "payment_errors_total", map[string]string{"error_type": "network_unavailable", "network": network}, 1)
+	logs := collector.LogsWithBody("Payment failed")
+	if len(logs) != 1 || logs[0].Severity != "error" {
+		t.Fatalf("failure logs = %+v, want one at error", logs)
+	}
+}
+
+func TestAuthorizeInvalidBodyTelemetry(t *testing.T) {
+	handler, collector, flush := newTestService(t, "none", "")
+
+	rec := serve(handler, http.MethodPost, "/payments/authorize", `{not json`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	flush()
+
+	if server := collector.Span(t, "payment-gateway"); server.StatusCode != "unset" {
+		t.Errorf("server span status %s, want unset for a 400", server.StatusCode)
+	}
+	span := collector.Span(t, "Authorize Payment")
+	if span.StatusCode != "error" || span.StatusMessage != "invalid request body" {
+		t.Errorf("Authorize Payment status %s %q, want error \"invalid request body\"", span.StatusCode, span.StatusMessage)
+	}
+	if points := collector.PointsNamed("payment_requests_total", nil); len(points) != 0 {
+		t.Errorf("payment_requests_total recorded for an invalid body: %+v", points)
+	}
+}
+
+func TestHealthTelemetry(t *testing.T) {
+	handler, collector, flush := newTestService(t, "partial_outage", "amex")
+
+	rec := serve(handler, http.MethodGet, "/payments/health", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	flush()
+
+	span := collector.Span(t, "Payment Gateway Health Check")
+	if span.StatusCode != "error" || span.StatusMessage != "payment provider degraded" {
+		t.Errorf("health span status %s %q, want error \"payment provider degraded\"", span.StatusCode, span.StatusMessage)
+	}
+	telemetrytest.AssertAttributes(t, "health span", span.Attributes, map[string]string{
+		"payment.degraded":  "true",
+		"sim.incident.type": "partial_outage",
+	})
+}
+
+func assertCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want float64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Value != want {
+		t.Errorf("%s%v points = %+v, want one of %g", name, attrs, points, want)
+	}
+}
+
+func assertHistogramCount(t *testing.T, c *telemetrytest.Collector, name string, attrs map[string]string, want uint64) {
+	t.Helper()
+	points := c.PointsNamed(name, attrs)
+	if len(points) != 1 || points[0].Count != want {
+		t.Errorf("%s%v points = %+v, want one with count %d", name, attrs, points, want)
+	}
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/chaos"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/deploy"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/probes"
+	"incident-simulation/pkg/profiling"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Incident catalogue of the simulated payment provider
+var incidentTypes = []string{"three_ds_timeout", "fraud_hold", "partial_outage", "throttling"}
+
+// Card networks; partial_outage takes down one of them
+var networks = []string{"visa", "mastercard", "amex"}
+
+// incidentState is the active provider incident, if any
+type incidentState struct {
+	mu      sync.RWMutex
+	active  bool
+	kind    string
+	network string
+}
+
+var incident = &incidentState{kind: "none"}
+
+func (s *incidentState) snapshot() (active bool, kind, network string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active, s.kind, s.network
+}
+
+type PaymentRequest struct {
+	TransactionID string  `json:"transaction_id"`
+	UserID        string  `json:"user_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	Operation     string  `json:"operation"`
+}
+
+type PaymentResponse struct {
+	PaymentID        string  `json:"payment_id,omitempty"`
+	Status           string  `json:"status"`
+	DeclineCode      string  `json:"decline_code,omitempty"`
+	Error            string  `json:"error,omitempty"`
+	Network          string  `json:"network"`
+	ThreeDS          bool    `json:"three_ds"`
+	ProcessingTimeMs float64 `json:"processing_time_ms"`
+	Timestamp        int64   `json:"timestamp"`
+}
+
+// Metrics
+var (
+	paymentCounter   metric.Int64Counter
+	errorCounter     metric.Int64Counter
+	threeDSCounter   metric.Int64Counter
+	paymentDuration  metric.Float64Histogram
+	incidentGauge    metric.Int64ObservableGauge
+	inflightPayments metric.Int64UpDownCounter
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Load configuration (flags > env > .env > YAML > defaults)
+	var cfg Config
+	config.MustLoad(&cfg)
+	log.Println("⚙️  Payment Gateway configuration:")
+	config.Print(log.Writer(), &cfg)
+
+	// Seeded runs replay the same simulator decisions
+	if cfg.SimSeed != 0 {
+		simrand.Seed(cfg.SimSeed)
+	}
+
+	// In-memory buffer of recent spans and logs for /debug/telemetry/recent
+	recorder := telemetry.NewRecorder("payment-gateway", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	// Export outcomes for /debug/otel
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	// Per-minute latency histograms and error counts for /debug/latency-heatmap and /debug/export
+	heatmap := telemetry.NewHeatmap("payment-gateway", cfg.LatencyHeatmapMinutes)
+
+	// Simulated rollouts of new versions, some of them bad
+	deploys := deploy.New("payment-gateway", cfg.Deploy, &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   5 * time.Second,
+	}, logDeployment)
+
+	// Initialize OpenTelemetry
+	shutdown := initOpenTelemetry(ctx, "payment-gateway", cfg.Telemetry, recorder, health, heatmap, deploys.SpanProcessor())
+	defer shutdown()
+
+	// Optional pprof endpoints and continuous profiling
+	stopProfiling := profiling.Start("payment-gateway", cfg.Profiling, "localhost:6062")
+	defer stopProfiling()
+
+	// Audit trail of incidents, deployments and admin actions
+	if err := audit.Setup("payment-gateway", cfg.AuditLogFile, cfg.AuditLogKeep); err != nil {
+		log.Fatalf("Invalid audit log: %v", err)
+	}
+	defer audit.Close()
+
+	// Initialize metrics
+	initMetrics(ctx)
+	if err := buildinfo.RegisterMetric("payment-gateway"); err != nil {
+		logx.Errorw(ctx, "Failed to create build info gauge", "error", err)
+	}
+	if cfg.SimLabelSpans {
+		if err := telemetry.LabelIncidents(func() (bool, string) {
+			active, kind, _ := incident.snapshot()
+			if _, bad := deploys.Current(); bad && !active {
+				return true, "bad_deploy"
+			}
+			return active, kind
+		}); err != nil {
+			logx.Errorw(ctx, "Failed to label spans with the active incident", "error", err)
+		}
+	}
+	if err := deploys.RegisterMetrics(); err != nil {
+		logx.Errorw(ctx, "Failed to create deployment metrics", "error", err)
+	}
+	go deploys.Run(ctx)
+
+	// Start background incident simulator
+	go incidentSimulator(ctx, cfg.IncidentInterval, cfg.IncidentProbability)
+
+	// Start payment gateway
+	startPaymentGateway(cfg, recorder, health, heatmap, deploys)
+}
+
+func initOpenTelemetry(ctx context.Context, serviceName string, cfg config.Telemetry, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap, versions trace.SpanProcessor) func() {
+	// Resource with service information; OTEL_RESOURCE_ATTRIBUTES overrides it
+	res, err := telemetry.NewResource(ctx, serviceName)
+	if err != nil {
+		log.Fatalf("Failed to create resource: %v", err)
+	}
+
+	// OTLP (endpoint, TLS, headers) or stdout/file exporters
+	exporters, err := telemetry.NewExporters(cfg.OTLP, cfg.Output)
+	if err != nil {
+		log.Fatalf("Invalid telemetry exporter settings: %v", err)
+	}
+
+	// Trace exporter
+	traceExporter, err := exporters.Trace(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create trace exporter: %v", err)
+	}
+
+	// Batch span processor whose queue /debug/otel reports
+	spans := telemetry.NewBatchSpanProcessor(health.Spans(traceExporter), cfg.Batching)
+	health.TrackQueue(spans)
+
+	// Personal data is scrubbed before spans and log records are exported or buffered
+	scrubber := telemetry.NewScrubber(cfg.Scrubbing)
+
+	// Trace provider
+	tp := trace.NewTracerProvider(
+		// Stamps spans first so the exported ones carry the deployed version
+		trace.WithSpanProcessor(versions),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(spans)),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(recorder)),
+		trace.WithResource(res),
+		// Ratio sampling, overridden for debug requests
+		trace.WithSampler(telemetry.NewSampler(cfg.Sampling)),
+	)
+	otel.SetTracerProvider(tp)
+
+	// Metric exporter
+	metricExporter, err := exporters.Metric(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create metric exporter: %v", err)
+	}
+
+	views, err := telemetry.ParseViewConfig(cfg.MetricViewBuckets, cfg.MetricViewDropAttributes)
+	if err != nil {
+		log.Fatalf("Invalid metric views: %v", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(telemetry.View(views)),
+		sdkmetric.WithReader(telemetry.NewPeriodicReader(heatmap.Metrics(health.Metrics(metricExporter)), cfg.Batching)),
+	)
+	// Caps the attribute sets of every counter and histogram the service creates
+	otel.SetMeterProvider(telemetry.GuardCardinality(mp, cfg.MetricCardinalityLimit, views))
+
+	// Log Provider
+	exporter, err := exporters.Log(ctx)
+	if err != nil {
+		log.Fatalf("failed to create log exporter: %v", err)
+	}
+
+	// Set up the LoggerProvider with a batch processor
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(scrubber.LogProcessor()),
+		sdklog.WithProcessor(telemetry.NewBatchLogProcessor(health.Logs(exporter), cfg.Batching)),
+		sdklog.WithProcessor(recorder),
+	)
+
+	// Set the global logger provider
+	global.SetLoggerProvider(provider)
+
+	// Bridge logrus to OpenTelemetry; logx adds service and trace fields
+	logx.Setup(serviceName, provider)
+	if _, err := logx.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	// Text map propagators from OTEL_PROPAGATORS
+	propagator, err := telemetry.NewPropagator(cfg.Propagators)
+	if err != nil {
+		log.Fatalf("Invalid propagator settings: %v", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down tracer provider", "error", err)
+		}
+		if err := mp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down meter provider", "error", err)
+		}
+		provider.Shutdown(ctx)
+		exporters.Close()
+	}
+}
+
+func initMetrics(ctx context.Context) {
+	meter := otel.Meter("payment-gateway")
+
+	var err error
+	paymentCounter, err = meter.Int64Counter("payment_requests_total",
+		metric.WithDescription("Total number of payment authorizations by outcome"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create payment counter", "error", err)
+	}
+
+	errorCounter, err = meter.Int64Counter("payment_errors_total",
+		metric.WithDescription("Total number of payment provider errors"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create payment error counter", "error", err)
+	}
+
+	threeDSCounter, err = meter.Int64Counter("payment_three_ds_challenges_total",
+		metric.WithDescription("Total number of 3DS challenges by outcome"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create 3DS counter", "error", err)
+	}
+
+	paymentDuration, err = meter.Float64Histogram("payment_duration_seconds",
+		metric.WithDescription("Payment authorization duration in seconds"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create payment duration histogram", "error", err)
+	}
+
+	inflightPayments, err = meter.Int64UpDownCounter("payment_inflight_requests",
+		metric.WithDescription("Number of payment authorizations in progress"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create in-flight payments counter", "error", err)
+	}
+
+	incidentGauge, err = meter.Int64ObservableGauge("payment_incident_active",
+		metric.WithDescription("Whether a payment provider incident is currently active"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create incident gauge", "error", err)
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		active, kind, network := incident.snapshot()
+		var v int64
+		if active {
+			v = 1
+		}
+		o.ObserveInt64(incidentGauge, v, metric.WithAttributes(
+			attribute.String("incident_type", kind),
+			attribute.String("network", network),
+		))
+		return nil
+	}, incidentGauge)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register incident gauge callback", "error", err)
+	}
+}
+
+func incidentSimulator(ctx context.Context, interval time.Duration, probability float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if active, _, _ := incident.snapshot(); active || simrand.Float64() >= probability {
+			continue
+		}
+
+		kind := incidentTypes[simrand.Intn(len(incidentTypes))]
+		network := ""
+		if kind == "partial_outage" {
+			network = networks[simrand.Intn(len(networks))]
+		}
+
+		incident.mu.Lock()
+		incident.active, incident.kind, incident.network = true, kind, network
+		incident.mu.Unlock()
+
+		// Incident duration: 20-90 seconds
+		duration := time.Duration(20+simrand.Intn(70)) * time.Second
+		audit.Warn(ctx, "incident.started", "🚨 PAYMENT PROVIDER INCIDENT", "incident_type", kind, "network", network, "duration", duration.String())
+		go func() {
+			time.Sleep(duration)
+			incident.mu.Lock()
+			incident.active, incident.kind, incident.network = false, "none", ""
+			incident.mu.Unlock()
+			audit.Record(ctx, "incident.resolved", "✅ PAYMENT PROVIDER INCIDENT RESOLVED", "incident_type", kind)
+		}()
+	}
+}
+
+// networkFor deterministically assigns a card network to a user
+func networkFor(userID string) string {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return networks[h.Sum32()%uint32(len(networks))]
+}
+
+// newPaymentHandler builds the payment gateway routes with their middleware
+func newPaymentHandler(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap, deploys *deploy.Simulator) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /payments/authorize", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer("payment-gateway").Start(r.Context(), "Authorize Payment")
+		defer span.End()
+
+		inflightPayments.Add(ctx, 1)
+		defer inflightPayments.Add(ctx, -1)
+
+		start := time.Now()
+
+		var req PaymentRequest
+		if err := jsonx.NewDecoder(r.Body).Decode(&req); err != nil {
+			span.SetStatus(codes.Error, "invalid request body")
+			writePayment(w, http.StatusBadRequest, PaymentResponse{Status: "error", Error: "invalid request body"})
+			return
+		}
+		if req.Currency == "" {
+			req.Currency = "USD"
+		}
+
+		network := networkFor(req.UserID)
+		needs3DS := req.Amount >= cfg.ThreeDSThreshold
+		active, kind, affected := incident.snapshot()
+
+		span.SetAttributes(
+			attrs.TransactionID(req.TransactionID),
+			semconv.UserID(req.UserID),
+			attribute.Float64("payment.amount", req.Amount),
+			attribute.String("payment.currency", req.Currency),
+			attribute.String("payment.network", network),
+			attribute.Bool("payment.three_ds", needs3DS),
+			attrs.IncidentType(kind),
+		)
+
+		resp := PaymentResponse{Network: network, ThreeDS: needs3DS}
+		status := http.StatusOK
+
+		// Provider processing time
+		time.Sleep(time.Duration(80+simrand.Intn(120)) * time.Millisecond)
+
+		switch {
+		case active && kind == "throttling" && simrand.Float64() < 0.6:
+			retryAfter := 1 + simrand.Intn(5)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			status, resp.Status, resp.DeclineCode = http.StatusTooManyRequests, "error", "rate_limited"
+			resp.Error = "payment provider rate limit exceeded"
+
+		case active && kind == "partial_outage" && network == affected:
+			time.Sleep(time.Duration(200+simrand.Intn(800)) * time.Millisecond)
+			status, resp.Status, resp.DeclineCode = http.StatusServiceUnavailable, "error", "network_unavailable"
+			resp.Error = fmt.Sprintf("%s network unavailable", network)
+
+		case needs3DS && active && kind == "three_ds_timeout" && simrand.Float64() < 0.8:
+			time.Sleep(time.Duration(4000+simrand.Intn(4000)) * time.Millisecond)
+			threeDSCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "timeout")))
+			status, resp.Status, resp.DeclineCode = http.StatusGatewayTimeout, "error", "three_ds_timeout"
+			resp.Error = "3DS challenge timed out"
+
+		case active && kind == "fraud_hold" && simrand.Float64() < 0.35:
+			status, resp.Status, resp.DeclineCode = http.StatusPaymentRequired, "held", "fraud_hold"
+			resp.Error = "payment held for fraud review"
+
+		case simrand.Float64() < 0.01:
+			status, resp.Status, resp.DeclineCode = http.StatusPaymentRequired, "declined", "insufficient_funds"
+			resp.Error = "card declined"
+
+		default:
+			if needs3DS {
+				time.Sleep(time.Duration(300+simrand.Intn(500)) * time.Millisecond)
+				threeDSCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "success")))
+			}
+			resp.Status = "authorized"
+			resp.PaymentID = fmt.Sprintf("pay_%d_%d", time.Now().Unix(), simrand.Intn(100000))
+		}
+
+		resp.ProcessingTimeMs = time.Since(start).Seconds() * 1000
+		resp.Timestamp = time.Now().Unix()
+
+		paymentDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("network", network),
+		))
+		paymentCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("status", resp.Status),
+			attribute.String("network", network),
+			attribute.String("decline_code", resp.DeclineCode),
+		))
+		span.SetAttributes(attribute.String("payment.status", resp.Status))
+
+		if status != http.StatusOK {
+			span.SetAttributes(attribute.String("payment.decline_code", resp.DeclineCode))
+			if status >= 500 || status == http.StatusTooManyRequests {
+				span.SetStatus(codes.Error, resp.Error)
+				errorCounter.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("error_type", resp.DeclineCode),
+					attribute.String("network", network),
+				))
+				logx.Errorw(ctx, "❌ Payment failed", "transaction.id", req.TransactionID, "payment.network", network, "payment.decline_code", resp.DeclineCode, "error", resp.Error)
+			} else {
+				logx.Warnw(ctx, "⚠️ Payment not authorized", "transaction.id", req.TransactionID, "payment.status", resp.Status, "payment.decline_code", resp.DeclineCode)
+			}
+		} else {
+			logx.Infow(ctx, "✅ Payment authorized", "transaction.id", req.TransactionID, "payment.id", resp.PaymentID, "payment.network", network)
+		}
+
+		writePayment(w, status, resp)
+	})
+
+	mux.HandleFunc("GET /payments/health", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("payment-gateway").Start(r.Context(), "Payment Gateway Health Check")
+		defer span.End()
+
+		active, kind, network := incident.snapshot()
+		degraded := active && kind == "partial_outage"
+		span.SetAttributes(
+			attribute.Bool("payment.degraded", degraded),
+			attrs.IncidentType(kind),
+		)
+
+		body := map[string]interface{}{
+			"status":        "healthy",
+			"incident_type": kind,
+			"timestamp":     time.Now().Unix(),
+		}
+		status := http.StatusOK
+		if degraded {
+			span.SetStatus(codes.Error, "payment provider degraded")
+			body["status"] = "degraded"
+			body["unavailable_network"] = network
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		jsonx.NewEncoder(w).Encode(body)
+	})
+
+	// Kubernetes probes sit outside tracing and incident simulation
+	prober := probes.New(2 * time.Second)
+	if cfg.TelemetryExporter == telemetry.ExporterOTLP {
+		prober.AddCheck("otlp_collector", probes.TCPCheck(telemetry.CollectorAddr(cfg.OTLP)))
+		// Not ready until telemetry has reached the collector once
+		prober.AddCheck("telemetry_export", health.Ready)
+	}
+
+	root := http.NewServeMux()
+	prober.Register(root)
+	if cfg.TelemetryBufferSize > 0 {
+		root.Handle("GET /debug/telemetry/recent", recorder)
+	}
+	root.Handle("GET /debug/otel", health)
+	root.Handle("GET /debug/audit", audit.Handler())
+	root.Handle("/debug/loglevel", logx.LevelHandler(audit.Warn))
+	if heatmap.Enabled() {
+		root.Handle("GET /debug/latency-heatmap", heatmap)
+		root.Handle("GET /debug/export", heatmap.Export())
+	}
+	root.Handle("GET /version", buildinfo.Handler("payment-gateway"))
+	deploys.Register(root, cfg.DevMode)
+	// A bad deployed version slows down and fails requests
+	var handler http.Handler = deploys.Middleware(mux)
+	// X-Chaos-* fault injection is a development-only feature
+	if cfg.DevMode {
+		handler = chaos.Middleware("payment-gateway", handler)
+	}
+	handler = httpx.Metrics("payment-gateway", handler)
+	// X-Debug-Trace and DEBUG_TRACE_USERS requests are sampled whatever TRACE_SAMPLE_RATIO says
+	root.Handle("/", telemetry.DebugTraces(cfg.Sampling, nil, otelhttp.NewHandler(httpx.TraceResponse(handler), "payment-gateway")))
+
+	prober.MarkStarted()
+	return root
+}
+
+func startPaymentGateway(cfg Config, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap, deploys *deploy.Simulator) {
+	root := newPaymentHandler(cfg, recorder, health, heatmap, deploys)
+	log.Printf("💳 Payment Gateway running on %s", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, root))
+}
+
+func writePayment(w http.ResponseWriter, status int, resp PaymentResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	jsonx.NewEncoder(w).Encode(resp)
+}
+
+// logDeployment logs every simulated rollout and rollback
+func logDeployment(ctx context.Context, e deploy.Event) {
+	if e.Bad {
+		audit.Warn(ctx, "deployment."+e.Kind, "🚢 Deployed a bad version", "deploy.kind", e.Kind, "deploy.version", e.Version, "deploy.previous_version", e.PreviousVersion, "deploy.bad", e.Bad)
+		return
+	}
+	audit.Record(ctx, "deployment."+e.Kind, "🚢 Deployment rolled out", "deploy.kind", e.Kind, "deploy.version", e.Version, "deploy.previous_version", e.PreviousVersion, "deploy.bad", e.Bad)
+}
@@ -0,0 +1,317 @@
+// Package alerting evaluates threshold and burn-rate rules over metric samples
+// and delivers firing and resolved notifications to webhook, Slack and PagerDuty.
+//
+// The caller (normally the anomaly detector) feeds samples with Observe and calls
+// Evaluate on its own schedule. Each alert is identified by rule name plus series
+// labels; it is sent once when it starts firing, repeated only after
+// the repeat interval, and followed by a single resolve notification.
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Alert states carried in notifications
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Sample is one observation of a series at a point in time
+type Sample struct {
+	Series string
+	Labels map[string]string
+	Value  float64
+	Time   time.Time
+}
+
+// Notification is what sinks deliver for a state change
+type Notification struct {
+	Fingerprint string            `json:"fingerprint"`
+	Rule        string            `json:"rule"`
+	State       string            `json:"state"`
+	Severity    string            `json:"severity"`
+	Summary     string            `json:"summary"`
+	Series      string            `json:"series"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Value       float64           `json:"value"`
+	Runbook     string            `json:"runbook,omitempty"`
+	StartsAt    time.Time         `json:"starts_at"`
+	EndsAt      time.Time         `json:"ends_at,omitempty"`
+}
+
+// Sink delivers notifications to an external system
+type Sink interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// alertState tracks one rule/series combination between evaluations
+type alertState struct {
+	pendingSince time.Time
+	firing       bool
+	startsAt     time.Time
+	lastSent     time.Time
+	lastValue    float64
+	labels       map[string]string
+	series       string
+}
+
+// Engine holds rules, recent samples and alert state
+type Engine struct {
+	rules          []Rule
+	sinks          []Sink
+	repeatInterval time.Duration
+	retention      time.Duration
+
+	mu      sync.Mutex
+	samples map[string][]Sample // keyed by series fingerprint
+	alerts  map[string]*alertState
+
+	notifications metric.Int64Counter
+	firing        metric.Int64UpDownCounter
+}
+
+// NewEngine returns an Engine that keeps enough history for the longest rule window
+func NewEngine(rules []Rule, sinks []Sink, repeatInterval time.Duration) *Engine {
+	retention := time.Minute
+	for _, r := range rules {
+		if w := r.window(); w > retention {
+			retention = w
+		}
+	}
+
+	e := &Engine{
+		rules:          rules,
+		sinks:          sinks,
+		repeatInterval: repeatInterval,
+		retention:      retention,
+		samples:        make(map[string][]Sample),
+		alerts:         make(map[string]*alertState),
+	}
+
+	meter := otel.Meter("alerting")
+	var err error
+	e.notifications, err = meter.Int64Counter("alerting_notifications_total",
+		metric.WithDescription("Notifications delivered by sink, state and outcome"))
+	if err != nil {
+		log.Printf("Failed to create alerting notifications counter: %v", err)
+	}
+	e.firing, err = meter.Int64UpDownCounter("alerting_alerts_firing",
+		metric.WithDescription("Number of alerts currently firing"))
+	if err != nil {
+		log.Printf("Failed to create alerting firing counter: %v", err)
+	}
+	return e
+}
+
+// Observe records a sample for later evaluation
+func (e *Engine) Observe(s Sample) {
+	if s.Time.IsZero() {
+		s.Time = time.Now()
+	}
+	key := seriesKey(s.Series, s.Labels)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.samples[key] = append(e.samples[key], s)
+}
+
+// Evaluate checks every rule against every matching series at now and notifies sinks
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) {
+	var out []Notification
+
+	e.mu.Lock()
+	e.prune(now)
+	seen := make(map[string]bool)
+	for _, rule := range e.rules {
+		for key, samples := range e.samples {
+			if len(samples) == 0 || samples[0].Series != rule.Series {
+				continue
+			}
+			active, value := rule.evaluate(samples, now)
+			fp := rule.Name + "|" + key
+			seen[fp] = true
+			if n, ok := e.transition(fp, rule, samples[0], active, value, now); ok {
+				out = append(out, n)
+			}
+		}
+	}
+	// Series that stopped reporting resolve their alerts
+	for _, rule := range e.rules {
+		for fp, st := range e.alerts {
+			if seen[fp] || !strings.HasPrefix(fp, rule.Name+"|") {
+				continue
+			}
+			sample := Sample{Series: st.series, Labels: st.labels}
+			if n, ok := e.transition(fp, rule, sample, false, st.lastValue, now); ok {
+				out = append(out, n)
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	for _, n := range out {
+		e.notify(ctx, n)
+	}
+}
+
+// Run evaluates every interval until ctx is cancelled
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Evaluate(ctx, now)
+		}
+	}
+}
+
+// Firing returns the currently firing alerts
+func (e *Engine) Firing() []Notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []Notification
+	for fp, st := range e.alerts {
+		if !st.firing {
+			continue
+		}
+		rule := strings.SplitN(fp, "|", 2)[0]
+		out = append(out, Notification{
+			Fingerprint: fp,
+			Rule:        rule,
+			State:       StateFiring,
+			Series:      st.series,
+			Labels:      st.labels,
+			Value:       st.lastValue,
+			StartsAt:    st.startsAt,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Fingerprint < out[j].Fingerprint })
+	return out
+}
+
+// transition updates the alert state and returns a notification when one is due
+func (e *Engine) transition(fp string, rule Rule, sample Sample, active bool, value float64, now time.Time) (Notification, bool) {
+	st, ok := e.alerts[fp]
+	if !ok {
+		st = &alertState{labels: sample.Labels, series: sample.Series}
+		e.alerts[fp] = st
+	}
+	st.lastValue = value
+
+	n := Notification{
+		Fingerprint: fp,
+		Rule:        rule.Name,
+		Severity:    rule.Severity,
+		Summary:     rule.summary(value),
+		Series:      sample.Series,
+		Labels:      sample.Labels,
+		Value:       value,
+		Runbook:     rule.Runbook,
+	}
+
+	if !active {
+		st.pendingSince = time.Time{}
+		if !st.firing {
+			delete(e.alerts, fp)
+			return n, false
+		}
+		st.firing = false
+		delete(e.alerts, fp)
+		e.firing.Add(context.Background(), -1, metric.WithAttributes(attribute.String("rule", rule.Name)))
+		n.State, n.StartsAt, n.EndsAt = StateResolved, st.startsAt, now
+		return n, true
+	}
+
+	if st.pendingSince.IsZero() {
+		st.pendingSince = now
+	}
+	if now.Sub(st.pendingSince) < rule.For {
+		return n, false
+	}
+
+	n.State = StateFiring
+	if !st.firing {
+		st.firing, st.startsAt, st.lastSent = true, now, now
+		e.firing.Add(context.Background(), 1, metric.WithAttributes(attribute.String("rule", rule.Name)))
+		n.StartsAt = now
+		return n, true
+	}
+
+	// Deduplicate: repeat a firing alert only after repeatInterval
+	n.StartsAt = st.startsAt
+	if e.repeatInterval > 0 && now.Sub(st.lastSent) >= e.repeatInterval {
+		st.lastSent = now
+		return n, true
+	}
+	return n, false
+}
+
+func (e *Engine) notify(ctx context.Context, n Notification) {
+	deliver(ctx, e.sinks, e.notifications, n)
+}
+
+// deliver sends n to every sink, counting the outcomes in notifications, and
+// returns them as sink=outcome
+func deliver(ctx context.Context, sinks []Sink, notifications metric.Int64Counter, n Notification) []string {
+	outcomes := make([]string, 0, len(sinks))
+	for _, sink := range sinks {
+		outcome := "success"
+		if err := sink.Notify(ctx, n); err != nil {
+			outcome = "failure"
+			log.Printf("Alert notification to %s failed: %v", sink.Name(), err)
+		}
+		outcomes = append(outcomes, sink.Name()+"="+outcome)
+		notifications.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("sink", sink.Name()),
+			attribute.String("state", n.State),
+			attribute.String("outcome", outcome),
+		))
+	}
+	return outcomes
+}
+
+// prune drops samples older than the longest rule window
+func (e *Engine) prune(now time.Time) {
+	cutoff := now.Add(-e.retention)
+	for key, samples := range e.samples {
+		i := sort.Search(len(samples), func(i int) bool { return !samples[i].Time.Before(cutoff) })
+		if i == len(samples) {
+			delete(e.samples, key)
+			continue
+		}
+		e.samples[key] = samples[i:]
+	}
+}
+
+// seriesKey identifies a series by name and sorted labels
+func seriesKey(series string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(series)
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%s=%s", k, labels[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,201 @@
+package alerting
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// recordingSink keeps every notification it is sent
+type recordingSink struct {
+	sent []Notification
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Notify(_ context.Context, n Notification) error {
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+func TestRuleValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{"threshold", Rule{Name: "r", Series: "s", Kind: KindThreshold, Op: ">="}, ""},
+		{"burn rate", Rule{Name: "r", Series: "s", Kind: KindBurnRate, Objective: 0.99, BurnRate: 14.4, LongWindow: time.Hour, ShortWindow: 5 * time.Minute}, ""},
+		{"missing series", Rule{Name: "r", Kind: KindThreshold, Op: ">"}, "name and series"},
+		{"bad op", Rule{Name: "r", Series: "s", Kind: KindThreshold, Op: "=="}, "op must be"},
+		{"objective out of range", Rule{Name: "r", Series: "s", Kind: KindBurnRate, Objective: 1, BurnRate: 1, LongWindow: time.Hour, ShortWindow: time.Minute}, "objective"},
+		{"short window over long", Rule{Name: "r", Series: "s", Kind: KindBurnRate, Objective: 0.99, BurnRate: 1, LongWindow: time.Minute, ShortWindow: time.Hour}, "short_window <= long_window"},
+		{"unknown kind", Rule{Name: "r", Series: "s", Kind: "ratio"}, "kind must be"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.validate()
+			switch {
+			case tc.want == "" && err != nil:
+				t.Errorf("validate() = %v, want nil", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Errorf("validate() = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRuleValidateDefaultsSeverity(t *testing.T) {
+	r := Rule{Name: "r", Series: "s", Kind: KindThreshold, Op: ">"}
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Severity != "warning" {
+		t.Errorf("severity = %q, want warning", r.Severity)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	data := "rules:\n  - name: high_latency\n    kind: threshold\n    series: latency_p99\n    op: \">\"\n    threshold: 0.5\n    for: 1m\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Name != "high_latency" || rules[0].For != time.Minute || rules[0].Severity != "warning" {
+		t.Errorf("LoadRules = %+v", rules)
+	}
+
+	if err := os.WriteFile(path, []byte("rules:\n  - name: broken\n    kind: threshold\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules(path); err == nil || !strings.Contains(err.Error(), `"broken"`) {
+		t.Errorf("LoadRules with an invalid rule = %v, want an error naming it", err)
+	}
+}
+
+// series returns samples ending at testNow, one per minute
+func series(values ...float64) []Sample {
+	out := make([]Sample, len(values))
+	for i, v := range values {
+		out[i] = Sample{Series: "s", Value: v, Time: testNow.Add(time.Duration(i-len(values)+1) * time.Minute)}
+	}
+	return out
+}
+
+func TestRuleEvaluate(t *testing.T) {
+	burn := Rule{Kind: KindBurnRate, Objective: 0.99, BurnRate: 10, LongWindow: 10 * time.Minute, ShortWindow: 2 * time.Minute}
+
+	for _, tc := range []struct {
+		name      string
+		rule      Rule
+		samples   []Sample
+		active    bool
+		wantValue float64
+	}{
+		{"above threshold", Rule{Op: ">", Threshold: 1}, series(0, 2), true, 2},
+		{"at threshold is not above", Rule{Op: ">", Threshold: 2}, series(2), false, 2},
+		{"at threshold is at least", Rule{Op: ">=", Threshold: 2}, series(2), true, 2},
+		{"only the latest sample counts", Rule{Op: "<", Threshold: 1}, series(0, 0, 5), false, 5},
+		{"below threshold", Rule{Op: "<=", Threshold: 1}, series(5, 1), true, 1},
+		{"both windows burning", burn, series(0.2, 0.2, 0.2), true, 20},
+		{"long window only", burn, series(0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0, 0, 0), false, 35},
+		{"short window only", burn, series(0, 0, 0, 0, 0, 0, 0, 0, 0.3, 0.3), false, 6},
+		{"samples before the long window are ignored", burn, append([]Sample{{Value: 1, Time: testNow.Add(-time.Hour)}}, series(0)...), false, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			active, value := tc.rule.evaluate(tc.samples, testNow)
+			if active != tc.active || !approxEqual(value, tc.wantValue) {
+				t.Errorf("evaluate() = %v, %g, want %v, %g", active, value, tc.active, tc.wantValue)
+			}
+		})
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	rule := Rule{Name: "high_errors", Kind: KindThreshold, Series: "errors", Severity: "critical", Op: ">", Threshold: 1, For: 2 * time.Minute}
+	sink := &recordingSink{}
+	e := NewEngine([]Rule{rule}, []Sink{sink}, 5*time.Minute)
+	labels := map[string]string{"service": "core"}
+
+	// Each step observes a value at minute offset and evaluates, then checks
+	// which notification state was sent, if any
+	for _, step := range []struct {
+		minute int
+		value  float64
+		want   string
+	}{
+		{0, 5, ""},            // pending
+		{1, 5, ""},            // still pending
+		{2, 5, StateFiring},   // held for For
+		{3, 5, ""},            // deduplicated
+		{7, 5, StateFiring},   // repeat interval elapsed
+		{8, 0, StateResolved}, // condition cleared
+		{9, 0, ""},            // stays resolved
+		{10, 5, ""},           // pending again
+		{11, 0, ""},           // cleared before For, never fired
+	} {
+		now := testNow.Add(time.Duration(step.minute) * time.Minute)
+		e.Observe(Sample{Series: "errors", Labels: labels, Value: step.value, Time: now})
+		before := len(sink.sent)
+		e.Evaluate(context.Background(), now)
+
+		got := ""
+		if len(sink.sent) > before {
+			got = sink.sent[len(sink.sent)-1].State
+		}
+		if len(sink.sent)-before > 1 || got != step.want {
+			t.Fatalf("minute %d: sent %v, want state %q", step.minute, sink.sent[before:], step.want)
+		}
+	}
+
+	first := sink.sent[0]
+	if first.Fingerprint != "high_errors|errors,service=core" || first.Severity != "critical" || first.Labels["service"] != "core" {
+		t.Errorf("firing notification = %+v", first)
+	}
+	resolved := sink.sent[2]
+	if !resolved.StartsAt.Equal(first.StartsAt) || !resolved.EndsAt.Equal(testNow.Add(8*time.Minute)) {
+		t.Errorf("resolved notification = %+v, want it to span from %v", resolved, first.StartsAt)
+	}
+}
+
+func TestEngineResolvesStoppedSeries(t *testing.T) {
+	rule := Rule{Name: "high_errors", Kind: KindThreshold, Series: "errors", Op: ">", Threshold: 1}
+	sink := &recordingSink{}
+	e := NewEngine([]Rule{rule}, []Sink{sink}, 0)
+
+	e.Observe(Sample{Series: "errors", Value: 5, Time: testNow})
+	e.Evaluate(context.Background(), testNow)
+	if len(e.Firing()) != 1 {
+		t.Fatalf("firing = %+v, want one alert", e.Firing())
+	}
+
+	// Past the retention the samples are pruned and the alert resolves
+	e.Evaluate(context.Background(), testNow.Add(time.Hour))
+	if len(sink.sent) != 2 || sink.sent[1].State != StateResolved {
+		t.Errorf("sent %+v, want firing then resolved", sink.sent)
+	}
+	if len(e.Firing()) != 0 {
+		t.Errorf("firing = %+v, want none", e.Firing())
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	a := seriesKey("errors", map[string]string{"service": "core", "region": "eu"})
+	b := seriesKey("errors", map[string]string{"region": "eu", "service": "core"})
+	if a != b || a != "errors,region=eu,service=core" {
+		t.Errorf("seriesKey = %q and %q, want both errors,region=eu,service=core", a, b)
+	}
+}
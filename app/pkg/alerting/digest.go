@@ -0,0 +1,302 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Topology tells the digest which services call which
+type Topology interface {
+	// Dependencies returns the services service calls
+	Dependencies(service string) []string
+}
+
+// Digest is a Sink that collapses related alerts into one notification per
+// incident. A firing alert joins an open group when it starts within the
+// window of the group's latest member and its service is one of the group's
+// or a direct caller or callee of one; otherwise it opens a new group. A group
+// is sent one window after it opens, summarising its members, again one
+// window after new members join, and resolved once all of them resolve. A
+// group whose alerts all resolve before it is first sent is never sent.
+// Resolves of alerts the digest does not hold pass straight through.
+type Digest struct {
+	sinks    []Sink
+	window   time.Duration
+	topology Topology
+
+	mu     sync.Mutex
+	groups []*alertGroup
+	seq    int
+
+	notifications metric.Int64Counter
+}
+
+// alertGroup is one digest in the making
+type alertGroup struct {
+	id       string
+	startsAt time.Time
+	last     time.Time // start of the newest member
+	due      time.Time // when the next digest is sent, zero when none is pending
+	sent     bool
+	root     string                  // service of the first member, usually where a cascade began
+	severity string                  // most severe member so far
+	members  map[string]Notification // firing members by fingerprint
+	order    []string                // every fingerprint that joined, in order
+	services map[string]bool
+}
+
+// NewDigest groups the alerts it is sent over window before delivering them
+// to sinks; topology may be nil, in which case only alerts of the same
+// service are grouped. Call Run (or Flush) so digests go out.
+func NewDigest(sinks []Sink, window time.Duration, topology Topology) *Digest {
+	d := &Digest{sinks: sinks, window: window, topology: topology}
+	var err error
+	d.notifications, err = otel.Meter("alerting").Int64Counter("alerting_notifications_total",
+		metric.WithDescription("Notifications delivered by sink, state and outcome"))
+	if err != nil {
+		log.Printf("Failed to create alerting notifications counter: %v", err)
+	}
+	return d
+}
+
+func (d *Digest) Name() string { return "digest" }
+
+// Notify adds a firing alert to its group or resolves it there
+func (d *Digest) Notify(ctx context.Context, n Notification) error {
+	now := time.Now()
+	d.mu.Lock()
+	if n.State == StateResolved {
+		g := d.groupOf(n.Fingerprint)
+		if g == nil {
+			d.mu.Unlock()
+			deliver(ctx, d.sinks, d.notifications, n)
+			return nil
+		}
+		delete(g.members, n.Fingerprint)
+		if len(g.members) == 0 {
+			if !g.sent {
+				d.remove(g)
+			} else {
+				g.due = now
+			}
+		}
+		d.mu.Unlock()
+		return nil
+	}
+	defer d.mu.Unlock()
+
+	startsAt := n.StartsAt
+	if startsAt.IsZero() {
+		startsAt = now
+	}
+	if g := d.groupOf(n.Fingerprint); g != nil {
+		g.members[n.Fingerprint] = n // a repeat only refreshes the member
+		return nil
+	}
+	service := notificationService(n)
+	g := d.related(service, startsAt)
+	if g == nil {
+		d.seq++
+		g = &alertGroup{
+			id:       fmt.Sprintf("digest|%d|%s", d.seq, n.Fingerprint),
+			startsAt: startsAt,
+			root:     service,
+			members:  make(map[string]Notification),
+			services: make(map[string]bool),
+		}
+		d.groups = append(d.groups, g)
+	}
+	g.members[n.Fingerprint] = n
+	if !slices.Contains(g.order, n.Fingerprint) {
+		g.order = append(g.order, n.Fingerprint)
+	}
+	g.services[service] = true
+	if severityRank(n.Severity) > severityRank(g.severity) {
+		g.severity = n.Severity
+	}
+	if startsAt.After(g.last) {
+		g.last = startsAt
+	}
+	if g.due.IsZero() {
+		g.due = now.Add(d.window)
+	}
+	return nil
+}
+
+// Flush delivers the digests due at now
+func (d *Digest) Flush(ctx context.Context, now time.Time) {
+	var out []Notification
+	d.mu.Lock()
+	for _, g := range append([]*alertGroup(nil), d.groups...) {
+		if g.due.IsZero() || g.due.After(now) {
+			continue
+		}
+		g.due = time.Time{}
+		n := g.notification()
+		if len(g.members) == 0 {
+			n.State, n.EndsAt = StateResolved, now
+			d.remove(g)
+		} else {
+			g.sent = true
+		}
+		out = append(out, n)
+	}
+	d.mu.Unlock()
+
+	for _, n := range out {
+		deliver(ctx, d.sinks, d.notifications, n)
+	}
+}
+
+// Run flushes every interval until ctx is cancelled
+func (d *Digest) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.Flush(ctx, now)
+		}
+	}
+}
+
+func (d *Digest) groupOf(fingerprint string) *alertGroup {
+	for _, g := range d.groups {
+		if _, ok := g.members[fingerprint]; ok {
+			return g
+		}
+	}
+	return nil
+}
+
+// related finds the open group an alert of service starting at startsAt joins
+func (d *Digest) related(service string, startsAt time.Time) *alertGroup {
+	for _, g := range d.groups {
+		if len(g.members) == 0 || startsAt.Sub(g.last) > d.window {
+			continue
+		}
+		for s := range g.services {
+			if sameService(service, s) || d.adjacent(service, s) {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// adjacent reports whether a calls b or b calls a, matching names with and
+// without the -service suffix, since alert labels and traces differ there
+func (d *Digest) adjacent(a, b string) bool {
+	if d.topology == nil {
+		return false
+	}
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		base := strings.TrimSuffix(pair[0], "-service")
+		for _, name := range []string{base, base + "-service"} {
+			for _, dep := range d.topology.Dependencies(name) {
+				if sameService(dep, pair[1]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (d *Digest) remove(g *alertGroup) {
+	for i, other := range d.groups {
+		if other == g {
+			d.groups = append(d.groups[:i], d.groups[i+1:]...)
+			return
+		}
+	}
+}
+
+// notification summarises the group, its most severe firing member first;
+// the service label is the group's root so incidents land on it
+func (g *alertGroup) notification() Notification {
+	members := make([]Notification, 0, len(g.members))
+	for _, fp := range g.order {
+		if m, ok := g.members[fp]; ok {
+			members = append(members, m)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return severityRank(members[i].Severity) > severityRank(members[j].Severity)
+	})
+
+	services := make([]string, 0, len(g.services))
+	for s := range g.services {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+
+	n := Notification{
+		Fingerprint: g.id,
+		Rule:        "digest",
+		State:       StateFiring,
+		Severity:    g.severity,
+		Series:      "digest",
+		Labels: map[string]string{
+			"service":  g.root,
+			"services": strings.Join(services, ","),
+			"alerts":   strconv.Itoa(len(g.order)),
+			"firing":   strconv.Itoa(len(members)),
+		},
+		StartsAt: g.startsAt,
+	}
+	if len(members) == 0 {
+		n.Summary = fmt.Sprintf("%d related alerts on %s resolved", len(g.order), strings.Join(services, ", "))
+		return n
+	}
+
+	lead := members[0]
+	n.Value, n.Runbook = lead.Value, lead.Runbook
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d related alerts firing on %s:", len(members), strings.Join(services, ", "))
+	for _, m := range members {
+		fmt.Fprintf(&b, "\n- [%s] %s (%s): %s", m.Severity, m.Rule, notificationService(m), m.Summary)
+	}
+	n.Summary = b.String()
+	return n
+}
+
+// severityRank orders the usual severities, unknown ones lowest
+func severityRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case "critical", "page":
+		return 3
+	case "warning", "ticket":
+		return 2
+	case "info":
+		return 1
+	}
+	return 0
+}
+
+// notificationService takes the service from the alert labels
+func notificationService(n Notification) string {
+	for _, key := range []string{"service", "service.name", "job"} {
+		if v := n.Labels[key]; v != "" {
+			return v
+		}
+	}
+	return "unknown"
+}
+
+func sameService(a, b string) bool {
+	return strings.TrimSuffix(a, "-service") == strings.TrimSuffix(b, "-service")
+}
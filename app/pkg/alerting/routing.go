@@ -0,0 +1,267 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gopkg.in/yaml.v3"
+)
+
+// Routing is the ALERT_ROUTING_FILE format: routes pick a team by the alert's
+// service and severity, and a team's on-call overrides hand its alerts to
+// another team during a weekly time window
+type Routing struct {
+	Teams  map[string]Team `yaml:"teams"`
+	Routes []Route         `yaml:"routes"`
+	// Default receives alerts no route matches; when empty they are dropped
+	Default string `yaml:"default"`
+}
+
+// Team is where one team's notifications go
+type Team struct {
+	Webhook             string     `yaml:"webhook"`
+	Slack               string     `yaml:"slack"`
+	PagerDutyRoutingKey string     `yaml:"pagerduty_routing_key"`
+	Overrides           []Override `yaml:"overrides"`
+}
+
+// Route sends alerts of Services (any when empty) with one of Severities (any
+// when empty) to Team
+type Route struct {
+	Services   []string `yaml:"services"`
+	Severities []string `yaml:"severities"`
+	Team       string   `yaml:"team"`
+}
+
+// Override hands a team's alerts to Team from Start to End ("15:04", an End
+// at or before Start runs past midnight, equal ones the whole day) on Days
+// (mon..sun, every day when empty) in TimeZone (UTC when empty)
+type Override struct {
+	Days     []string `yaml:"days"`
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	TimeZone string   `yaml:"timezone"`
+	Team     string   `yaml:"team"`
+
+	loc        *time.Location
+	start, end int // minutes after midnight
+	days       map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// LoadRouting reads and checks a routing file
+func LoadRouting(path string) (Routing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Routing{}, fmt.Errorf("read alert routing: %w", err)
+	}
+	var r Routing
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return Routing{}, fmt.Errorf("parse alert routing %s: %w", path, err)
+	}
+	if err := r.validate(); err != nil {
+		return Routing{}, fmt.Errorf("alert routing %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *Routing) validate() error {
+	known := func(team string) bool { _, ok := r.Teams[team]; return ok }
+	if r.Default != "" && !known(r.Default) {
+		return fmt.Errorf("default team %q is not defined", r.Default)
+	}
+	for i, route := range r.Routes {
+		if !known(route.Team) {
+			return fmt.Errorf("route %d: team %q is not defined", i+1, route.Team)
+		}
+	}
+	for name, team := range r.Teams {
+		if team.Webhook == "" && team.Slack == "" && team.PagerDutyRoutingKey == "" && len(team.Overrides) == 0 {
+			return fmt.Errorf("team %q has no webhook, slack or pagerduty_routing_key", name)
+		}
+		for i := range team.Overrides {
+			o := &team.Overrides[i]
+			if !known(o.Team) || o.Team == name {
+				return fmt.Errorf("team %q override %d: team %q is not another defined team", name, i+1, o.Team)
+			}
+			if err := o.parse(); err != nil {
+				return fmt.Errorf("team %q override %d: %w", name, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *Override) parse() error {
+	var err error
+	if o.loc, err = time.LoadLocation(o.TimeZone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	for _, field := range []struct {
+		value string
+		into  *int
+	}{{o.Start, &o.start}, {o.End, &o.end}} {
+		t, err := time.Parse("15:04", field.value)
+		if err != nil {
+			return fmt.Errorf("start and end must be HH:MM, got %q", field.value)
+		}
+		*field.into = t.Hour()*60 + t.Minute()
+	}
+	for _, d := range o.Days {
+		day, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+		if !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+		if o.days == nil {
+			o.days = make(map[time.Weekday]bool)
+		}
+		o.days[day] = true
+	}
+	return nil
+}
+
+// active reports whether the override applies at t; a window running past
+// midnight belongs to the day it starts on
+func (o Override) active(t time.Time) bool {
+	t = t.In(o.loc)
+	minute, day := t.Hour()*60+t.Minute(), t.Weekday()
+	onDay := func(d time.Weekday) bool { return o.days == nil || o.days[d] }
+	switch {
+	case o.start == o.end:
+		return onDay(day)
+	case o.start < o.end:
+		return minute >= o.start && minute < o.end && onDay(day)
+	case minute >= o.start:
+		return onDay(day)
+	case minute < o.end:
+		return onDay((day + 6) % 7)
+	}
+	return false
+}
+
+// Router is a Sink that delivers each alert to the sinks of the team its
+// route and the on-call overrides pick. Every decision is logged as an audit
+// line with the alert, route, team and per-sink outcome. A resolve goes to the
+// team that received the alert firing, even if an override changed since.
+type Router struct {
+	routing Routing
+	teams   map[string][]Sink
+
+	mu       sync.Mutex
+	assigned map[string]string // firing fingerprint -> team
+
+	notifications metric.Int64Counter
+	routed        metric.Int64Counter
+}
+
+// NewRouter builds the team sinks of r, which LoadRouting has checked
+func NewRouter(r Routing) *Router {
+	client := &http.Client{Timeout: 10 * time.Second}
+	rt := &Router{
+		routing:  r,
+		teams:    make(map[string][]Sink, len(r.Teams)),
+		assigned: make(map[string]string),
+	}
+	for name, team := range r.Teams {
+		rt.teams[name] = sinksFor(client, team.Webhook, team.Slack, team.PagerDutyRoutingKey)
+	}
+
+	meter := otel.Meter("alerting")
+	var err error
+	rt.notifications, err = meter.Int64Counter("alerting_notifications_total",
+		metric.WithDescription("Notifications delivered by sink, state and outcome"))
+	if err != nil {
+		log.Printf("Failed to create alerting notifications counter: %v", err)
+	}
+	rt.routed, err = meter.Int64Counter("alerting_routed_total",
+		metric.WithDescription("Notifications routed by team and state; team is empty for unrouted ones"))
+	if err != nil {
+		log.Printf("Failed to create alerting routed counter: %v", err)
+	}
+	return rt
+}
+
+func (rt *Router) Name() string { return "router" }
+
+func (rt *Router) Notify(ctx context.Context, n Notification) error {
+	team, reason := rt.route(n, time.Now())
+	rt.routed.Add(ctx, 1, metric.WithAttributes(attribute.String("team", team), attribute.String("state", n.State)))
+	if team == "" {
+		log.Printf("🧭 Alert routing: fingerprint=%q rule=%s state=%s service=%s team=none reason=%q",
+			n.Fingerprint, n.Rule, n.State, notificationService(n), reason)
+		return nil
+	}
+
+	outcomes := deliver(ctx, rt.teams[team], rt.notifications, n)
+	log.Printf("🧭 Alert routing: fingerprint=%q rule=%s state=%s service=%s severity=%s team=%s reason=%q sinks=[%s]",
+		n.Fingerprint, n.Rule, n.State, notificationService(n), n.Severity, team, reason, strings.Join(outcomes, ", "))
+	return nil
+}
+
+// route picks the team for n at now and says why
+func (rt *Router) route(n Notification, now time.Time) (string, string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if team, ok := rt.assigned[n.Fingerprint]; ok {
+		if n.State == StateResolved {
+			delete(rt.assigned, n.Fingerprint)
+		}
+		return team, "assigned when firing"
+	}
+
+	team, reason := rt.routing.Default, "default"
+	service := notificationService(n)
+	for i, route := range rt.routing.Routes {
+		if route.matches(service, n.Severity) {
+			team, reason = route.Team, fmt.Sprintf("route %d", i+1)
+			break
+		}
+	}
+	if team == "" {
+		return "", "no route matches"
+	}
+
+	// Follow overrides, at most once per team so a cycle cannot loop
+	seen := map[string]bool{team: true}
+	for {
+		next := ""
+		for i, o := range rt.routing.Teams[team].Overrides {
+			if o.active(now) {
+				next = o.Team
+				reason += fmt.Sprintf(", %s override %d to %s", team, i+1, o.Team)
+				break
+			}
+		}
+		if next == "" || seen[next] {
+			break
+		}
+		team, seen[next] = next, true
+	}
+
+	if n.State == StateFiring {
+		rt.assigned[n.Fingerprint] = team
+	}
+	return team, reason
+}
+
+func (r Route) matches(service, severity string) bool {
+	if len(r.Services) > 0 && !slices.ContainsFunc(r.Services, func(s string) bool { return s == "*" || sameService(s, service) }) {
+		return false
+	}
+	return len(r.Severities) == 0 || slices.Contains(r.Severities, severity)
+}
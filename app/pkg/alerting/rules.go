@@ -0,0 +1,144 @@
+package alerting
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule kinds
+const (
+	KindThreshold = "threshold"
+	KindBurnRate  = "burn_rate"
+)
+
+// Rule is a threshold or multi-window burn-rate rule on one series.
+//
+// Threshold rules compare the latest sample with Threshold using Op and fire
+// once the condition has held for For. Burn-rate rules expect the series value
+// to be an error ratio (0..1) and fire when the average ratio over both
+// LongWindow and ShortWindow exceeds BurnRate times the error budget (1-Objective).
+type Rule struct {
+	Name     string        `yaml:"name"`
+	Kind     string        `yaml:"kind"`
+	Series   string        `yaml:"series"`
+	Severity string        `yaml:"severity"`
+	For      time.Duration `yaml:"for"`
+	// Runbook is a link sent with every notification, e.g. the analyzer's
+	// /api/v1/runbooks/{name}
+	Runbook string `yaml:"runbook"`
+
+	Op        string  `yaml:"op"`
+	Threshold float64 `yaml:"threshold"`
+
+	Objective   float64       `yaml:"objective"`
+	BurnRate    float64       `yaml:"burn_rate"`
+	LongWindow  time.Duration `yaml:"long_window"`
+	ShortWindow time.Duration `yaml:"short_window"`
+}
+
+// LoadRules reads a YAML file with a top-level "rules" list
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read alert rules: %w", err)
+	}
+
+	var file struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse alert rules %s: %w", path, err)
+	}
+	for i := range file.Rules {
+		if err := file.Rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("alert rule %q: %w", file.Rules[i].Name, err)
+		}
+	}
+	return file.Rules, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" || r.Series == "" {
+		return fmt.Errorf("name and series are required")
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+
+	switch r.Kind {
+	case KindThreshold:
+		switch r.Op {
+		case ">", ">=", "<", "<=":
+		default:
+			return fmt.Errorf("op must be one of > >= < <=, got %q", r.Op)
+		}
+	case KindBurnRate:
+		if r.Objective <= 0 || r.Objective >= 1 {
+			return fmt.Errorf("objective must be between 0 and 1")
+		}
+		if r.BurnRate <= 0 || r.LongWindow <= 0 || r.ShortWindow <= 0 || r.ShortWindow > r.LongWindow {
+			return fmt.Errorf("burn_rate, long_window and short_window must be positive with short_window <= long_window")
+		}
+	default:
+		return fmt.Errorf("kind must be %q or %q", KindThreshold, KindBurnRate)
+	}
+	return nil
+}
+
+// window is how much history the rule needs
+func (r Rule) window() time.Duration {
+	if r.Kind == KindBurnRate {
+		return r.LongWindow
+	}
+	return r.For + time.Minute
+}
+
+// evaluate reports whether the rule condition holds and the value it is based on
+func (r Rule) evaluate(samples []Sample, now time.Time) (bool, float64) {
+	switch r.Kind {
+	case KindBurnRate:
+		budget := 1 - r.Objective
+		long := average(samples, now.Add(-r.LongWindow)) / budget
+		short := average(samples, now.Add(-r.ShortWindow)) / budget
+		return long > r.BurnRate && short > r.BurnRate, long
+	default:
+		v := samples[len(samples)-1].Value
+		switch r.Op {
+		case ">":
+			return v > r.Threshold, v
+		case ">=":
+			return v >= r.Threshold, v
+		case "<":
+			return v < r.Threshold, v
+		case "<=":
+			return v <= r.Threshold, v
+		}
+		return false, v
+	}
+}
+
+func (r Rule) summary(value float64) string {
+	if r.Kind == KindBurnRate {
+		return fmt.Sprintf("%s is burning its %.2f%% error budget %.1fx too fast", r.Series, r.Objective*100, value)
+	}
+	return fmt.Sprintf("%s is %.4g (%s %.4g)", r.Series, value, r.Op, r.Threshold)
+}
+
+// average returns the mean of samples at or after since
+func average(samples []Sample, since time.Time) float64 {
+	sum, n := 0.0, 0
+	for _, s := range samples {
+		if s.Time.Before(since) {
+			continue
+		}
+		sum += s.Value
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
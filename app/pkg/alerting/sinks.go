@@ -0,0 +1,176 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"incident-simulation/pkg/config"
+)
+
+// SinksFromConfig builds a sink for every destination that is configured,
+// plus a Router when ALERT_ROUTING_FILE is set
+func SinksFromConfig(cfg config.Alerting) ([]Sink, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	sinks := sinksFor(client, cfg.AlertWebhookURL, cfg.AlertSlackWebhookURL, cfg.AlertPagerDutyRoutingKey)
+	if cfg.AlertRoutingFile != "" {
+		routing, err := LoadRouting(cfg.AlertRoutingFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, NewRouter(routing))
+	}
+	return sinks, nil
+}
+
+func sinksFor(client *http.Client, webhook, slack, pagerDutyRoutingKey string) []Sink {
+	var sinks []Sink
+	if webhook != "" {
+		sinks = append(sinks, &WebhookSink{URL: webhook, Client: client})
+	}
+	if slack != "" {
+		sinks = append(sinks, &SlackSink{WebhookURL: slack, Client: client})
+	}
+	if pagerDutyRoutingKey != "" {
+		sinks = append(sinks, &PagerDutySink{RoutingKey: pagerDutyRoutingKey, Client: client})
+	}
+	return sinks
+}
+
+// WebhookSink POSTs the notification as JSON
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, s.Client, s.URL, n)
+}
+
+// SlackSink posts a formatted message to a Slack incoming webhook
+type SlackSink struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *SlackSink) Name() string { return "slack" }
+
+func (s *SlackSink) Notify(ctx context.Context, n Notification) error {
+	color, icon := "danger", "🚨"
+	if n.State == StateResolved {
+		color, icon = "good", "✅"
+	}
+
+	fields := []map[string]interface{}{
+		{"title": "Severity", "value": n.Severity, "short": true},
+		{"title": "Value", "value": fmt.Sprintf("%.4g", n.Value), "short": true},
+	}
+	if labels := formatLabels(n.Labels); labels != "" {
+		fields = append(fields, map[string]interface{}{"title": "Labels", "value": labels})
+	}
+	if n.Runbook != "" {
+		fields = append(fields, map[string]interface{}{"title": "Runbook", "value": n.Runbook})
+	}
+
+	return postJSON(ctx, s.Client, s.WebhookURL, map[string]interface{}{
+		"text": fmt.Sprintf("%s [%s] %s", icon, strings.ToUpper(n.State), n.Rule),
+		"attachments": []map[string]interface{}{{
+			"color":  color,
+			"text":   n.Summary,
+			"fields": fields,
+			"ts":     n.StartsAt.Unix(),
+		}},
+	})
+}
+
+// PagerDutySink sends trigger and resolve events to the PagerDuty Events API v2,
+// using the alert fingerprint as dedup_key so PagerDuty groups them
+type PagerDutySink struct {
+	RoutingKey string
+	Client     *http.Client
+	// URL defaults to the public Events API endpoint
+	URL string
+}
+
+func (s *PagerDutySink) Name() string { return "pagerduty" }
+
+func (s *PagerDutySink) Notify(ctx context.Context, n Notification) error {
+	url := s.URL
+	if url == "" {
+		url = "https://events.pagerduty.com/v2/enqueue"
+	}
+
+	event := map[string]interface{}{
+		"routing_key":  s.RoutingKey,
+		"dedup_key":    n.Fingerprint,
+		"event_action": "trigger",
+	}
+	if n.State == StateResolved {
+		event["event_action"] = "resolve"
+	} else {
+		event["payload"] = map[string]interface{}{
+			"summary":        n.Summary,
+			"source":         n.Series,
+			"severity":       pagerDutySeverity(n.Severity),
+			"timestamp":      n.StartsAt.Format(time.RFC3339),
+			"custom_details": n,
+		}
+		if n.Runbook != "" {
+			event["links"] = []map[string]string{{"href": n.Runbook, "text": "Runbook"}}
+		}
+	}
+	return postJSON(ctx, s.Client, url, event)
+}
+
+// pagerDutySeverity maps rule severities onto critical, error, warning or info
+func pagerDutySeverity(severity string) string {
+	switch severity {
+	case "critical", "error", "warning", "info":
+		return severity
+	case "page":
+		return "critical"
+	}
+	return "warning"
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func formatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,331 @@
+// Package anomaly scores metric samples against learned per-series baselines so
+// that expected variation, such as the daily traffic cycle, is not mistaken for
+// an incident. A series is modelled either by an EWMA of its mean and variance
+// or by additive Holt-Winters (level, trend and a time-of-period seasonal
+// component). Model state can be persisted to disk so baselines survive
+// restarts instead of relearning a full season.
+//
+// Each score is a signed z-score of the sample against the model prediction and
+// is forwarded as a <series>_anomaly_score sample, so plain alerting threshold
+// rules (e.g. "> 4" for spikes, "< -4" for drops) fire on it. With a Tuner the
+// forwarded score is scaled by the sensitivity learned from operator feedback,
+// so the same rule becomes stricter for noisy series and looser for reliable ones.
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"incident-simulation/pkg/alerting"
+)
+
+// Baseline models
+const (
+	ModelEWMA        = "ewma"
+	ModelHoltWinters = "holt_winters"
+)
+
+// ScoreSuffix is appended to the series name of forwarded scores
+const ScoreSuffix = "_anomaly_score"
+
+// Deviations below this fraction of the prediction never score high, so a
+// series that has been flat does not alert on the first tiny wobble
+const relativeFloor = 0.01
+
+// The residual variance is smoothed over roughly the last 50 samples, much
+// slower than the level, so one noisy sample does not shrink the band
+const varianceAlpha = 0.02
+
+// Config selects the model and its smoothing factors
+type Config struct {
+	Model string
+	// Alpha smooths the level, Beta the trend and
+	// Gamma the seasonal component; all in (0, 1]
+	Alpha, Beta, Gamma float64
+	// Season is the Holt-Winters period and SeasonStep the width of one
+	// seasonal slot, e.g. 24h in 5m slots
+	Season, SeasonStep time.Duration
+	// Warmup is how many samples a series needs before it is scored
+	Warmup int
+	// StateFile persists model state between restarts (empty keeps it in memory)
+	StateFile string
+}
+
+func (c Config) validate() error {
+	switch c.Model {
+	case ModelEWMA:
+	case ModelHoltWinters:
+		if c.Season <= 0 || c.SeasonStep <= 0 || c.Season%c.SeasonStep != 0 {
+			return fmt.Errorf("season and season step must be positive and the season a multiple of the step")
+		}
+		if !inUnit(c.Beta) || !inUnit(c.Gamma) {
+			return fmt.Errorf("beta and gamma must be in (0, 1]")
+		}
+	default:
+		return fmt.Errorf("model must be %q or %q, got %q", ModelEWMA, ModelHoltWinters, c.Model)
+	}
+	if !inUnit(c.Alpha) {
+		return fmt.Errorf("alpha must be in (0, 1]")
+	}
+	if c.Warmup < 1 {
+		return fmt.Errorf("warmup must be at least 1")
+	}
+	return nil
+}
+
+func inUnit(v float64) bool { return v > 0 && v <= 1 }
+
+// slots is the number of seasonal slots (0 for EWMA)
+func (c Config) slots() int {
+	if c.Model != ModelHoltWinters {
+		return 0
+	}
+	return int(c.Season / c.SeasonStep)
+}
+
+// Score is the outcome of one observed sample
+type Score struct {
+	Series   string
+	Labels   map[string]string
+	Time     time.Time
+	Value    float64
+	Expected float64
+	StdDev   float64
+	// Z is (Value-Expected)/StdDev; only meaningful when Ready
+	Z float64
+	// Sensitivity is the tuned multiplier of the series (1 without a Tuner)
+	Sensitivity float64
+	// Ready is false during the warmup and, for Holt-Winters, the first season
+	Ready bool
+}
+
+// Detector keeps one model per series
+type Detector struct {
+	cfg     Config
+	forward func(alerting.Sample)
+
+	mu     sync.Mutex
+	series map[string]*model
+	tuner  *Tuner
+}
+
+// NewDetector returns a Detector that passes every ready score to forward
+// (normally an alerting.Engine's Observe) and restores cfg.StateFile if present
+func NewDetector(cfg Config, forward func(alerting.Sample)) (*Detector, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("anomaly detector: %w", err)
+	}
+	d := &Detector{cfg: cfg, forward: forward, series: make(map[string]*model)}
+	if cfg.StateFile != "" {
+		if err := d.load(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// SetTuner scales forwarded scores by the sensitivity t learned for each series
+func (d *Detector) SetTuner(t *Tuner) {
+	d.mu.Lock()
+	d.tuner = t
+	d.mu.Unlock()
+}
+
+// Adjusted is the z-score scaled by the series sensitivity
+func (s Score) Adjusted() float64 { return s.Z * s.Sensitivity }
+
+// Observe scores s against its series baseline, then updates the baseline
+func (d *Detector) Observe(s alerting.Sample) Score {
+	if s.Time.IsZero() {
+		s.Time = time.Now()
+	}
+	key := seriesKey(s.Series, s.Labels)
+
+	d.mu.Lock()
+	m, ok := d.series[key]
+	if !ok {
+		m = &model{Series: s.Series, Labels: s.Labels}
+		d.series[key] = m
+	}
+	score := m.observe(d.cfg, s.Value, s.Time)
+	tuner := d.tuner
+	d.mu.Unlock()
+
+	score.Series, score.Labels, score.Sensitivity = s.Series, s.Labels, 1
+	if tuner != nil {
+		score.Sensitivity = tuner.Sensitivity(s.Series, s.Labels)
+	}
+	if score.Ready && d.forward != nil {
+		d.forward(alerting.Sample{
+			Series: s.Series + ScoreSuffix,
+			Labels: s.Labels,
+			Value:  score.Adjusted(),
+			Time:   s.Time,
+		})
+	}
+	return score
+}
+
+// Run saves the model state every interval and once more when ctx is cancelled
+func (d *Detector) Run(ctx context.Context, interval time.Duration) {
+	if d.cfg.StateFile == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := d.Save(); err != nil {
+				log.Printf("Failed to save anomaly model state: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := d.Save(); err != nil {
+				log.Printf("Failed to save anomaly model state: %v", err)
+			}
+		}
+	}
+}
+
+// model is the baseline of one series. Level is the EWMA mean or the
+// Holt-Winters level; Season holds one additive offset per slot, or the raw
+// slot means while the first season is still being learned.
+type model struct {
+	Series   string            `json:"series"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	N        int               `json:"n"`
+	Level    float64           `json:"level"`
+	Trend    float64           `json:"trend,omitempty"`
+	Variance float64           `json:"variance"`
+	Season   []float64         `json:"season,omitempty"`
+	Counts   []int             `json:"counts,omitempty"`
+	Seasonal bool              `json:"seasonal,omitempty"`
+	Start    time.Time         `json:"start"`
+	LastSeen time.Time         `json:"last_seen"`
+}
+
+func (m *model) observe(cfg Config, x float64, t time.Time) Score {
+	score := Score{Time: t, Value: x, Expected: x}
+	if m.N == 0 {
+		m.Start = t
+	}
+	m.LastSeen = t
+
+	if cfg.Model == ModelHoltWinters {
+		m.observeSeasonal(cfg, x, t, &score)
+	} else {
+		m.observeEWMA(cfg, x, &score)
+	}
+	m.N++
+	return score
+}
+
+func (m *model) observeEWMA(cfg Config, x float64, score *Score) {
+	if m.N == 0 {
+		m.Level = x
+		return
+	}
+	score.Expected, score.StdDev = m.Level, m.stdDev(m.Level)
+	score.Z = (x - m.Level) / score.StdDev
+	score.Ready = m.N >= cfg.Warmup
+
+	diff := x - m.Level
+	m.Level += cfg.Alpha * diff
+	m.Variance = (1-varianceAlpha)*m.Variance + varianceAlpha*diff*diff
+}
+
+// observeSeasonal learns slot means for one full season before it predicts,
+// so the level does not simply chase the first day's curve
+func (m *model) observeSeasonal(cfg Config, x float64, t time.Time, score *Score) {
+	slot := m.slot(cfg, t)
+	if m.Season == nil {
+		m.Season, m.Counts = make([]float64, cfg.slots()), make([]int, cfg.slots())
+	}
+
+	if !m.Seasonal {
+		if m.Counts[slot] > 0 {
+			d := x - m.Season[slot]
+			m.Variance = (1-varianceAlpha)*m.Variance + varianceAlpha*d*d
+		}
+		m.Counts[slot]++
+		m.Season[slot] += (x - m.Season[slot]) / float64(m.Counts[slot])
+		if t.Sub(m.Start) >= cfg.Season {
+			m.Seasonal = true
+			m.normalise()
+		}
+		return
+	}
+
+	base := m.Level + m.Trend
+	if m.Counts[slot] == 0 {
+		// A slot missed during the first season takes the first sample's offset
+		m.Season[slot], m.Counts[slot] = x-base, 1
+		m.Level = base
+		return
+	}
+
+	expected := base + m.Season[slot]
+	score.Expected, score.StdDev = expected, m.stdDev(expected)
+	score.Z = (x - expected) / score.StdDev
+	score.Ready = m.N >= cfg.Warmup
+
+	err := x - expected
+	level := cfg.Alpha*(x-m.Season[slot]) + (1-cfg.Alpha)*base
+	m.Trend = cfg.Beta*(level-m.Level) + (1-cfg.Beta)*m.Trend
+	m.Level = level
+	m.Season[slot] = cfg.Gamma*(x-level) + (1-cfg.Gamma)*m.Season[slot]
+	m.Variance = (1-varianceAlpha)*m.Variance + varianceAlpha*err*err
+	m.normalise()
+}
+
+// normalise keeps the learned seasonal offsets centred on zero by moving their
+// mean into the level; otherwise level and season drift in opposite directions
+func (m *model) normalise() {
+	sum, n := 0.0, 0
+	for i, c := range m.Counts {
+		if c > 0 {
+			sum += m.Season[i]
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	for i, c := range m.Counts {
+		if c > 0 {
+			m.Season[i] -= mean
+		}
+	}
+	m.Level += mean
+}
+
+// slot is the seasonal slot t falls into, counted from the Unix epoch
+func (m *model) slot(cfg Config, t time.Time) int {
+	return int((t.UnixNano() / int64(cfg.SeasonStep)) % int64(cfg.slots()))
+}
+
+func (m *model) stdDev(expected float64) float64 {
+	return math.Max(math.Sqrt(m.Variance), math.Max(relativeFloor*math.Abs(expected), 1e-9))
+}
+
+// seriesKey identifies a series by name and sorted labels
+func seriesKey(series string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(series)
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%s=%s", k, labels[k])
+	}
+	return b.String()
+}
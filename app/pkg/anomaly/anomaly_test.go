@@ -0,0 +1,206 @@
+package anomaly
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/alerting"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	testEWMA        = Config{Model: ModelEWMA, Alpha: 0.3, Warmup: 5}
+	testHoltWinters = Config{Model: ModelHoltWinters, Alpha: 0.3, Beta: 0.1, Gamma: 0.3, Season: time.Hour, SeasonStep: 5 * time.Minute, Warmup: 5}
+)
+
+func TestConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"ewma", testEWMA, ""},
+		{"holt-winters", testHoltWinters, ""},
+		{"unknown model", Config{Model: "arima", Alpha: 0.3, Warmup: 1}, "model must be"},
+		{"alpha out of range", Config{Model: ModelEWMA, Alpha: 1.5, Warmup: 1}, "alpha"},
+		{"no warmup", Config{Model: ModelEWMA, Alpha: 0.3}, "warmup"},
+		{"season not a multiple of the step", Config{Model: ModelHoltWinters, Alpha: 0.3, Beta: 0.1, Gamma: 0.1, Season: time.Hour, SeasonStep: 7 * time.Minute, Warmup: 1}, "multiple of the step"},
+		{"no gamma", Config{Model: ModelHoltWinters, Alpha: 0.3, Beta: 0.1, Season: time.Hour, SeasonStep: 5 * time.Minute, Warmup: 1}, "beta and gamma"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.validate()
+			switch {
+			case tc.want == "" && err != nil:
+				t.Errorf("validate() = %v, want nil", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Errorf("validate() = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// feed observes values step apart from start and returns the last score
+func feed(d *Detector, step time.Duration, start time.Time, values ...float64) Score {
+	var score Score
+	for i, v := range values {
+		score = d.Observe(alerting.Sample{Series: "latency", Value: v, Time: start.Add(time.Duration(i) * step)})
+	}
+	return score
+}
+
+// noisy returns n samples alternating around mean by ±delta
+func noisy(n int, mean, delta float64) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = mean + delta*float64(1-2*(i%2))
+	}
+	return out
+}
+
+func TestEWMA(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		history   []float64
+		value     float64
+		wantReady bool
+		minZ      float64
+		maxZ      float64
+	}{
+		{"first sample is not scored", nil, 100, false, 0, 0},
+		{"within warmup", noisy(3, 100, 1), 200, false, math.Inf(-1), math.Inf(1)},
+		{"usual noise", noisy(100, 100, 5), 105, true, -2, 2},
+		{"spike", noisy(100, 100, 5), 200, true, 4, math.Inf(1)},
+		{"drop", noisy(100, 100, 5), 0, true, math.Inf(-1), -4},
+		{"flat series does not alert on a tiny wobble", noisy(100, 100, 0), 100.5, true, -1, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := NewDetector(testEWMA, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			feed(d, time.Minute, testStart, tc.history...)
+			score := d.Observe(alerting.Sample{Series: "latency", Value: tc.value, Time: testStart.Add(time.Hour * 24)})
+			if score.Ready != tc.wantReady || score.Z < tc.minZ || score.Z > tc.maxZ {
+				t.Errorf("score = %+v, want ready %v and z in [%g, %g]", score, tc.wantReady, tc.minZ, tc.maxZ)
+			}
+		})
+	}
+}
+
+// cycle returns seasons of a sine wave with one sample per 5m slot of an hour
+func cycle(seasons int) []float64 {
+	out := make([]float64, seasons*12)
+	for i := range out {
+		out[i] = 100 + 50*math.Sin(2*math.Pi*float64(i%12)/12)
+	}
+	return out
+}
+
+func TestHoltWinters(t *testing.T) {
+	step := testHoltWinters.SeasonStep
+
+	for _, tc := range []struct {
+		name      string
+		history   []float64
+		value     float64
+		wantReady bool
+		minZ      float64
+		maxZ      float64
+	}{
+		{"first season is learned, not scored", cycle(1)[:6], 150, false, 0, 0},
+		{"expected value", cycle(3), 100, true, -1, 1},
+		{"spike", cycle(3), 200, true, 4, math.Inf(1)},
+		{"drop", cycle(3), 0, true, math.Inf(-1), -4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := NewDetector(testHoltWinters, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			feed(d, step, testStart, tc.history...)
+			score := d.Observe(alerting.Sample{Series: "latency", Value: tc.value, Time: testStart.Add(time.Duration(len(tc.history)) * step)})
+			if score.Ready != tc.wantReady || score.Z < tc.minZ || score.Z > tc.maxZ {
+				t.Errorf("score = %+v, want ready %v and z in [%g, %g]", score, tc.wantReady, tc.minZ, tc.maxZ)
+			}
+		})
+	}
+}
+
+// The same daily cycle that Holt-Winters expects looks anomalous to an EWMA
+func TestHoltWintersFollowsSeason(t *testing.T) {
+	step := testHoltWinters.SeasonStep
+	peak := cycle(1)[3]
+
+	hw, _ := NewDetector(testHoltWinters, nil)
+	ewma, _ := NewDetector(testEWMA, nil)
+	history := cycle(4)[:39]
+	next := testStart.Add(time.Duration(len(history)) * step)
+	feed(hw, step, testStart, history...)
+	feed(ewma, step, testStart, history...)
+
+	hwScore := hw.Observe(alerting.Sample{Series: "latency", Value: peak, Time: next})
+	ewmaScore := ewma.Observe(alerting.Sample{Series: "latency", Value: peak, Time: next})
+	if math.Abs(hwScore.Z) >= 1 {
+		t.Errorf("holt-winters z at the expected peak = %g, want below 1", hwScore.Z)
+	}
+	if math.Abs(ewmaScore.Z) <= math.Abs(hwScore.Z) {
+		t.Errorf("ewma z = %g, want it further off than holt-winters z = %g", ewmaScore.Z, hwScore.Z)
+	}
+}
+
+func TestDetectorForwardsReadyScores(t *testing.T) {
+	var forwarded []alerting.Sample
+	d, err := NewDetector(testEWMA, func(s alerting.Sample) { forwarded = append(forwarded, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"service": "core"}
+	for i, v := range noisy(10, 100, 5) {
+		d.Observe(alerting.Sample{Series: "latency", Labels: labels, Value: v, Time: testStart.Add(time.Duration(i) * time.Minute)})
+	}
+
+	// Samples 0..4 are warming up
+	if len(forwarded) != 5 {
+		t.Fatalf("forwarded %d samples, want 5", len(forwarded))
+	}
+	if s := forwarded[0]; s.Series != "latency"+ScoreSuffix || s.Labels["service"] != "core" {
+		t.Errorf("forwarded %+v", s)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	cfg := testEWMA
+	cfg.StateFile = filepath.Join(t.TempDir(), "anomaly.json")
+
+	d, err := NewDetector(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed(d, time.Minute, testStart, noisy(50, 100, 5)...)
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewDetector(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score := restored.Observe(alerting.Sample{Series: "latency", Value: 200, Time: testStart.Add(time.Hour)}); !score.Ready || score.Z < 4 {
+		t.Errorf("restored score = %+v, want a ready spike", score)
+	}
+
+	// A state learned with another model is discarded
+	hw := testHoltWinters
+	hw.StateFile = cfg.StateFile
+	other, err := NewDetector(hw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.series) != 0 {
+		t.Errorf("restored %d series learned with %s", len(other.series), cfg.Model)
+	}
+}
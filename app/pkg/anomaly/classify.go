@@ -0,0 +1,246 @@
+package anomaly
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"incident-simulation/pkg/alerting"
+)
+
+// Incident classes inferred from joint signals
+const (
+	ClassDownstreamSaturation = "downstream_saturation"
+	ClassValidationStorm      = "upstream_validation_storm"
+	ClassDatabaseSlowdown     = "database_slowdown"
+	ClassUnclassified         = "unclassified_errors"
+)
+
+// Signal roles the classifier reasons about
+const (
+	SignalErrorRate      = "error_rate"
+	SignalValidationRate = "validation_error_rate"
+	SignalDBLatency      = "db_latency"
+	SignalPoolSaturation = "pool_saturation"
+)
+
+// ClassificationSeries is the series the active class is forwarded under,
+// labelled class=<class>; events also carry signals=<elevated roles>
+const ClassificationSeries = "incident_classification"
+
+const (
+	classificationLabel   = "class"
+	classificationSignals = "signals"
+)
+
+// DefaultSignals maps each role to the service-level series fed by default
+var DefaultSignals = map[string]string{
+	SignalErrorRate:      "api_error_ratio",
+	SignalValidationRate: "api_validation_error_ratio",
+	SignalDBLatency:      "db_query_duration_seconds_p95",
+	SignalPoolSaturation: "db_pool_saturation",
+}
+
+// ClassifierConfig says which series play which role and when they count as elevated
+type ClassifierConfig struct {
+	// Signals maps a role to its series name (DefaultSignals when nil)
+	Signals map[string]string
+	// Threshold is the z-score from which a signal is elevated
+	Threshold float64
+	// Limits are raw values from which a role is elevated whatever its z-score,
+	// e.g. a pool saturation of 0.9
+	Limits map[string]float64
+	// MaxAge ignores signals that have not been observed for this long
+	MaxAge time.Duration
+}
+
+// Event is emitted when the classification changes. Labels carry the class and
+// the elevated signal roles so sinks can route on them.
+type Event struct {
+	Class   string             `json:"class"`
+	State   string             `json:"state"`
+	Time    time.Time          `json:"time"`
+	Labels  map[string]string  `json:"labels"`
+	Signals map[string]float64 `json:"signals"`
+}
+
+// Classifier combines the latest scores of several series into one incident class
+type Classifier struct {
+	cfg     ClassifierConfig
+	roles   map[string]string // series -> role
+	forward func(alerting.Sample)
+	onEvent func(Event)
+
+	mu     sync.Mutex
+	latest map[string]Score // by role
+	active Event
+
+	events metric.Int64Counter
+}
+
+// NewClassifier returns a Classifier that forwards the active class as a
+// ClassificationSeries sample (1 while active, 0 once it clears) and passes
+// every change to onEvent; both callbacks may be nil
+func NewClassifier(cfg ClassifierConfig, forward func(alerting.Sample), onEvent func(Event)) *Classifier {
+	if cfg.Signals == nil {
+		cfg.Signals = DefaultSignals
+	}
+	c := &Classifier{
+		cfg:     cfg,
+		roles:   make(map[string]string, len(cfg.Signals)),
+		forward: forward,
+		onEvent: onEvent,
+		latest:  make(map[string]Score),
+	}
+	for role, series := range cfg.Signals {
+		c.roles[series] = role
+	}
+
+	var err error
+	c.events, err = otel.Meter("anomaly").Int64Counter("anomaly_classifications_total",
+		metric.WithDescription("Incident classifications by class"))
+	if err != nil {
+		log.Printf("Failed to create anomaly classifications counter: %v", err)
+	}
+	return c
+}
+
+// Observe keeps s if its series plays a role; feed it every Detector score
+func (c *Classifier) Observe(s Score) {
+	role, ok := c.roles[s.Series]
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	c.latest[role] = s
+	c.mu.Unlock()
+}
+
+// Classify evaluates the joint signals at now and returns the active event and
+// whether it just started; a change of class resolves the previous one first
+func (c *Classifier) Classify(now time.Time) (Event, bool) {
+	c.mu.Lock()
+	elevated := make(map[string]float64)
+	for role, s := range c.latest {
+		if c.cfg.MaxAge > 0 && now.Sub(s.Time) > c.cfg.MaxAge {
+			continue
+		}
+		limit, hasLimit := c.cfg.Limits[role]
+		if (s.Ready && s.Adjusted() >= c.cfg.Threshold) || (hasLimit && s.Value >= limit) {
+			elevated[role] = s.Adjusted()
+		}
+	}
+
+	class := classify(elevated)
+	previous := c.active
+	changed := class != previous.Class
+	if changed {
+		c.active = Event{}
+		if class != "" {
+			c.active = newEvent(class, alerting.StateFiring, now, elevated)
+		}
+	}
+	current := c.active
+	c.mu.Unlock()
+
+	if !changed {
+		if current.Class != "" {
+			c.emit(current, 1, now)
+		}
+		return current, false
+	}
+	if previous.Class != "" {
+		resolved := newEvent(previous.Class, alerting.StateResolved, now, previous.Signals)
+		c.emit(resolved, 0, now)
+		c.notify(resolved)
+	}
+	if current.Class == "" {
+		return Event{}, false
+	}
+	c.emit(current, 1, now)
+	c.notify(current)
+	c.events.Add(context.Background(), 1, metric.WithAttributes(attribute.String("class", current.Class)))
+	return current, true
+}
+
+// Run classifies every interval until ctx is cancelled
+func (c *Classifier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.Classify(now)
+		}
+	}
+}
+
+func (c *Classifier) emit(e Event, value float64, now time.Time) {
+	if c.forward == nil {
+		return
+	}
+	c.forward(alerting.Sample{
+		Series: ClassificationSeries,
+		Labels: map[string]string{classificationLabel: e.Class},
+		Value:  value,
+		Time:   now,
+	})
+}
+
+func (c *Classifier) notify(e Event) {
+	log.Printf("Incident classification %s: %s (%s)", e.State, e.Class, e.Labels[classificationSignals])
+	if c.onEvent != nil {
+		c.onEvent(e)
+	}
+}
+
+// classify names the incident from the elevated roles. Errors together with a
+// slow or saturated database point downstream; errors that are mostly
+// validation failures while the database is healthy point at the callers.
+func classify(elevated map[string]float64) string {
+	_, errs := elevated[SignalErrorRate]
+	_, validation := elevated[SignalValidationRate]
+	_, latency := elevated[SignalDBLatency]
+	_, pool := elevated[SignalPoolSaturation]
+
+	switch {
+	case errs && (latency || pool):
+		return ClassDownstreamSaturation
+	case errs && validation:
+		return ClassValidationStorm
+	case latency || pool:
+		return ClassDatabaseSlowdown
+	case errs:
+		return ClassUnclassified
+	default:
+		return ""
+	}
+}
+
+func newEvent(class, state string, now time.Time, signals map[string]float64) Event {
+	roles := make([]string, 0, len(signals))
+	for role := range signals {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return Event{
+		Class: class,
+		State: state,
+		Time:  now,
+		Labels: map[string]string{
+			classificationLabel:   class,
+			classificationSignals: strings.Join(roles, ","),
+		},
+		Signals: signals,
+	}
+}
@@ -0,0 +1,133 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/alerting"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		elevated []string
+		want     string
+	}{
+		{"nothing elevated", nil, ""},
+		{"errors with slow database", []string{SignalErrorRate, SignalDBLatency}, ClassDownstreamSaturation},
+		{"errors with saturated pool", []string{SignalErrorRate, SignalPoolSaturation}, ClassDownstreamSaturation},
+		{"database wins over validation", []string{SignalErrorRate, SignalValidationRate, SignalDBLatency}, ClassDownstreamSaturation},
+		{"errors with validation failures", []string{SignalErrorRate, SignalValidationRate}, ClassValidationStorm},
+		{"slow database alone", []string{SignalDBLatency}, ClassDatabaseSlowdown},
+		{"saturated pool alone", []string{SignalPoolSaturation}, ClassDatabaseSlowdown},
+		{"errors alone", []string{SignalErrorRate}, ClassUnclassified},
+		{"validation alone", []string{SignalValidationRate}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			elevated := make(map[string]float64)
+			for _, role := range tc.elevated {
+				elevated[role] = 5
+			}
+			if got := classify(elevated); got != tc.want {
+				t.Errorf("classify(%v) = %q, want %q", tc.elevated, got, tc.want)
+			}
+		})
+	}
+}
+
+// signal returns a ready score of the default series for role
+func signal(role string, z, value float64, at time.Time) Score {
+	return Score{Series: DefaultSignals[role], Time: at, Value: value, Z: z, Sensitivity: 1, Ready: true}
+}
+
+func TestClassifierElevation(t *testing.T) {
+	now := testStart.Add(time.Hour)
+	cfg := ClassifierConfig{
+		Threshold: 4,
+		Limits:    map[string]float64{SignalPoolSaturation: 0.9},
+		MaxAge:    time.Minute,
+	}
+
+	for _, tc := range []struct {
+		name   string
+		scores []Score
+		want   string
+	}{
+		{"below threshold", []Score{signal(SignalErrorRate, 3, 0.01, now)}, ""},
+		{"at threshold", []Score{signal(SignalErrorRate, 4, 0.01, now)}, ClassUnclassified},
+		{"not ready", []Score{{Series: DefaultSignals[SignalErrorRate], Time: now, Z: 10, Sensitivity: 1}}, ""},
+		{"tuned below threshold", []Score{{Series: DefaultSignals[SignalErrorRate], Time: now, Z: 5, Sensitivity: 0.5, Ready: true}}, ""},
+		{"raw limit", []Score{signal(SignalPoolSaturation, 0, 0.95, now)}, ClassDatabaseSlowdown},
+		{"stale signal", []Score{signal(SignalErrorRate, 10, 0.5, now.Add(-2*time.Minute))}, ""},
+		{"unknown series", []Score{{Series: "cpu", Time: now, Z: 10, Sensitivity: 1, Ready: true}}, ""},
+		{"joint signals", []Score{signal(SignalErrorRate, 6, 0.2, now), signal(SignalDBLatency, 8, 2, now)}, ClassDownstreamSaturation},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewClassifier(cfg, nil, nil)
+			for _, s := range tc.scores {
+				c.Observe(s)
+			}
+			event, _ := c.Classify(now)
+			if event.Class != tc.want {
+				t.Errorf("class = %q, want %q", event.Class, tc.want)
+			}
+		})
+	}
+}
+
+func TestClassifierTransitions(t *testing.T) {
+	var events []Event
+	var forwarded []alerting.Sample
+	c := NewClassifier(ClassifierConfig{Threshold: 4},
+		func(s alerting.Sample) { forwarded = append(forwarded, s) },
+		func(e Event) { events = append(events, e) })
+
+	now := testStart
+	c.Observe(signal(SignalErrorRate, 6, 0.2, now))
+	if event, started := c.Classify(now); !started || event.Class != ClassUnclassified {
+		t.Fatalf("Classify = %+v, %v, want a started %s", event, started, ClassUnclassified)
+	}
+	if _, started := c.Classify(now.Add(time.Minute)); started {
+		t.Errorf("unchanged class started again")
+	}
+
+	// The database joins in: the unclassified event resolves and a
+	// downstream saturation starts
+	c.Observe(signal(SignalDBLatency, 8, 2, now))
+	event, started := c.Classify(now.Add(2 * time.Minute))
+	if !started || event.Class != ClassDownstreamSaturation || event.Labels["signals"] != "db_latency,error_rate" {
+		t.Errorf("Classify = %+v, %v, want a started %s on db_latency,error_rate", event, started, ClassDownstreamSaturation)
+	}
+
+	c.Observe(signal(SignalErrorRate, 0, 0, now))
+	c.Observe(signal(SignalDBLatency, 0, 0.1, now))
+	if event, _ := c.Classify(now.Add(3 * time.Minute)); event.Class != "" {
+		t.Errorf("Classify after recovery = %+v, want no class", event)
+	}
+
+	want := []struct{ class, state string }{
+		{ClassUnclassified, alerting.StateFiring},
+		{ClassUnclassified, alerting.StateResolved},
+		{ClassDownstreamSaturation, alerting.StateFiring},
+		{ClassDownstreamSaturation, alerting.StateResolved},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Class != w.class || events[i].State != w.state {
+			t.Errorf("event %d = %s %s, want %s %s", i, events[i].Class, events[i].State, w.class, w.state)
+		}
+	}
+
+	// 1 while a class is active, including the unchanged evaluation, 0 once it clears
+	wantValues := []float64{1, 1, 0, 1, 0}
+	if len(forwarded) != len(wantValues) {
+		t.Fatalf("forwarded %d samples, want %d: %+v", len(forwarded), len(wantValues), forwarded)
+	}
+	for i, v := range wantValues {
+		if forwarded[i].Series != ClassificationSeries || forwarded[i].Value != v {
+			t.Errorf("forwarded[%d] = %+v, want %s = %g", i, forwarded[i], ClassificationSeries, v)
+		}
+	}
+}
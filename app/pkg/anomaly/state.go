@@ -0,0 +1,72 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// stateFile is the on-disk model state; models are only restored when they
+// were learned with the same model and seasonal layout
+type stateFile struct {
+	Model  string            `json:"model"`
+	Slots  int               `json:"slots,omitempty"`
+	Series map[string]*model `json:"series"`
+}
+
+// Save writes the model state to the state file atomically
+func (d *Detector) Save() error {
+	if d.cfg.StateFile == "" {
+		return nil
+	}
+	d.mu.Lock()
+	data, err := json.Marshal(stateFile{Model: d.cfg.Model, Slots: d.cfg.slots(), Series: d.series})
+	d.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode anomaly state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.cfg.StateFile), filepath.Base(d.cfg.StateFile)+".*")
+	if err != nil {
+		return fmt.Errorf("save anomaly state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save anomaly state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save anomaly state: %w", err)
+	}
+	return os.Rename(tmp.Name(), d.cfg.StateFile)
+}
+
+// load restores the state file; a missing file starts with empty baselines
+func (d *Detector) load() error {
+	data, err := os.ReadFile(d.cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read anomaly state: %w", err)
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("parse anomaly state %s: %w", d.cfg.StateFile, err)
+	}
+	if state.Model != d.cfg.Model || state.Slots != d.cfg.slots() {
+		log.Printf("Discarding anomaly state in %s: learned with %s/%d slots, now %s/%d slots",
+			d.cfg.StateFile, state.Model, state.Slots, d.cfg.Model, d.cfg.slots())
+		return nil
+	}
+	for key, m := range state.Series {
+		if m != nil {
+			d.series[key] = m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Weight of the prior, in feedback counts, that keeps a series with little
+// feedback close to its default sensitivity
+const tuningPriorWeight = 2.0
+
+// TunerConfig bounds the sensitivity learned from operator feedback
+type TunerConfig struct {
+	// TargetPrecision is the share of true positives a series is tuned towards
+	TargetPrecision float64
+	// MinSensitivity and MaxSensitivity clamp the learned multiplier
+	MinSensitivity, MaxSensitivity float64
+	// StateFile persists the feedback counts (empty keeps them in memory)
+	StateFile string
+}
+
+// Tuning is the feedback accumulated for one series and the sensitivity
+// derived from it
+type Tuning struct {
+	Series         string            `json:"series"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	TruePositives  int               `json:"true_positives"`
+	FalsePositives int               `json:"false_positives"`
+	Sensitivity    float64           `json:"sensitivity"`
+	// Threshold is the factor rule thresholds on the series are effectively
+	// multiplied by (1/Sensitivity)
+	Threshold float64   `json:"threshold"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tuner learns a per-series sensitivity from true/false positive feedback.
+// The smoothed precision (TP + target·k) / (TP + FP + k) is compared with the
+// target: a series that keeps producing false positives gets less sensitive,
+// one whose alerts are confirmed gets more sensitive, and a series without
+// feedback stays at 1.
+type Tuner struct {
+	cfg TunerConfig
+
+	mu     sync.Mutex
+	series map[string]*Tuning
+	// saveMu orders writers so the last rename carries the newest counts
+	saveMu sync.Mutex
+}
+
+// NewTuner returns a Tuner and restores cfg.StateFile if present
+func NewTuner(cfg TunerConfig) (*Tuner, error) {
+	if cfg.TargetPrecision <= 0 || cfg.TargetPrecision >= 1 {
+		return nil, fmt.Errorf("anomaly tuner: target precision must be between 0 and 1")
+	}
+	if cfg.MinSensitivity <= 0 || cfg.MinSensitivity > 1 || cfg.MaxSensitivity < 1 {
+		return nil, fmt.Errorf("anomaly tuner: sensitivity bounds must satisfy 0 < min <= 1 <= max")
+	}
+	t := &Tuner{cfg: cfg, series: make(map[string]*Tuning)}
+	if cfg.StateFile == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read anomaly tuning: %w", err)
+	}
+	var saved []*Tuning
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse anomaly tuning %s: %w", cfg.StateFile, err)
+	}
+	for _, tu := range saved {
+		t.update(tu)
+		t.series[seriesKey(tu.Series, tu.Labels)] = tu
+	}
+	return t, nil
+}
+
+// Sensitivity is the multiplier applied to the scores of a series
+func (t *Tuner) Sensitivity(series string, labels map[string]string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tu, ok := t.series[seriesKey(series, labels)]; ok {
+		return tu.Sensitivity
+	}
+	return 1
+}
+
+// Feedback counts one verdict for the series, or takes a previous verdict back
+// when retract is set, and persists the result
+func (t *Tuner) Feedback(series string, labels map[string]string, truePositive, retract bool) (Tuning, error) {
+	delta := 1
+	if retract {
+		delta = -1
+	}
+
+	t.mu.Lock()
+	key := seriesKey(series, labels)
+	tu, ok := t.series[key]
+	if !ok {
+		tu = &Tuning{Series: series, Labels: labels}
+		t.series[key] = tu
+	}
+	if truePositive {
+		tu.TruePositives = max(tu.TruePositives+delta, 0)
+	} else {
+		tu.FalsePositives = max(tu.FalsePositives+delta, 0)
+	}
+	tu.UpdatedAt = time.Now().UTC()
+	t.update(tu)
+	result := *tu
+	t.mu.Unlock()
+
+	return result, t.save()
+}
+
+// Tunings returns every tuned series, least sensitive first
+func (t *Tuner) Tunings() []Tuning {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]Tuning, 0, len(t.series))
+	for _, tu := range t.series {
+		out = append(out, *tu)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Sensitivity != out[j].Sensitivity {
+			return out[i].Sensitivity < out[j].Sensitivity
+		}
+		return seriesKey(out[i].Series, out[i].Labels) < seriesKey(out[j].Series, out[j].Labels)
+	})
+	return out
+}
+
+// update derives the sensitivity from the accumulated counts
+func (t *Tuner) update(tu *Tuning) {
+	tp, fp := float64(tu.TruePositives), float64(tu.FalsePositives)
+	precision := (tp + t.cfg.TargetPrecision*tuningPriorWeight) / (tp + fp + tuningPriorWeight)
+	tu.Sensitivity = math.Min(math.Max(precision/t.cfg.TargetPrecision, t.cfg.MinSensitivity), t.cfg.MaxSensitivity)
+	tu.Threshold = 1 / tu.Sensitivity
+}
+
+func (t *Tuner) save() error {
+	if t.cfg.StateFile == "" {
+		return nil
+	}
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	data, err := json.MarshalIndent(t.Tunings(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode anomaly tuning: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.cfg.StateFile), filepath.Base(t.cfg.StateFile)+".*")
+	if err != nil {
+		return fmt.Errorf("save anomaly tuning: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save anomaly tuning: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save anomaly tuning: %w", err)
+	}
+	return os.Rename(tmp.Name(), t.cfg.StateFile)
+}
@@ -0,0 +1,292 @@
+// Package attrs defines the span attributes of this project that the
+// OpenTelemetry semantic conventions do not cover.
+//
+// Simulator state lives under sim.* and business data under app.*, so neither
+// can collide with an attribute a later semconv release adds. Anything the
+// conventions do define (user.id, db.operation.name, http.request.method, ...)
+// is set with the helpers of the semconv version in Semconv instead.
+package attrs
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Semconv is the semantic conventions version used across the services
+const Semconv = "v1.34.0"
+
+const (
+	// IncidentTypeKey is the simulated incident active while the span ran
+	IncidentTypeKey = attribute.Key("sim.incident.type")
+	// IncidentActiveKey is whether a simulated incident was running at all
+	IncidentActiveKey = attribute.Key("sim.incident.active")
+	// IncidentScopeKey is the traffic a partial incident is limited to, e.g.
+	// operation=transfer or cohort=10%
+	IncidentScopeKey = attribute.Key("sim.incident.scope")
+	// IncidentStartedAtKey is when the incident a restarted service found in
+	// its state file started, RFC 3339
+	IncidentStartedAtKey = attribute.Key("sim.incident.started_at")
+	// IncidentRemainingKey is how long that incident had left to run, in seconds
+	IncidentRemainingKey = attribute.Key("sim.incident.remaining_seconds")
+	// IncidentResumedKey is whether the restarted service resumed it
+	IncidentResumedKey = attribute.Key("sim.incident.resumed")
+	// ResponseCorruptionKey is how a data_corruption incident broke the
+	// response of a successful query, e.g. currency_flip
+	ResponseCorruptionKey = attribute.Key("sim.response.corruption")
+
+	TransactionIDKey        = attribute.Key("app.transaction.id")
+	TransactionAmountKey    = attribute.Key("app.transaction.amount")
+	TransactionOperationKey = attribute.Key("app.transaction.operation")
+
+	// TransferRecipientKey is the user a transfer credits
+	TransferRecipientKey = attribute.Key("app.transfer.recipient")
+	// TransferStepKey is the saga step: transfer_debit, transfer_credit or transfer_compensate
+	TransferStepKey    = attribute.Key("app.transfer.step")
+	TransferOutcomeKey = attribute.Key("app.transfer.outcome")
+
+	// AccountBalanceKey is the ledger balance of the queried account after the query
+	AccountBalanceKey = attribute.Key("app.account.balance")
+
+	// BatchIDKey groups the item spans of one /api/transactions/batch request
+	BatchIDKey    = attribute.Key("app.batch.id")
+	BatchSizeKey  = attribute.Key("app.batch.size")
+	BatchIndexKey = attribute.Key("app.batch.index")
+
+	// TenantIDKey is the tenant a request is billed to, from X-Tenant-ID
+	TenantIDKey = attribute.Key("app.tenant.id")
+	// RequestCostKey is the synthetic cost pkg/costing assigned to a request
+	RequestCostKey = attribute.Key("app.request.cost")
+
+	// RequestPriorityKey is the priority class of a request, critical, normal
+	// or batch, from X-Priority
+	RequestPriorityKey = attribute.Key("app.request.priority")
+	// RequestShedKey marks a request rejected by load shedding
+	RequestShedKey = attribute.Key("app.request.shed")
+
+	// ClientDeviceKey is the kind of device a request came from, ios, android
+	// or desktop, derived from its User-Agent
+	ClientDeviceKey = attribute.Key("app.client.device")
+
+	// UserScopeKey is the scope claim of the caller's token
+	UserScopeKey = attribute.Key("app.user.scope")
+	// UserCohortKey is the user's 0-99 hash bucket that cohort incidents select on
+	UserCohortKey = attribute.Key("app.user.cohort")
+
+	// HTTPConnectionReusedKey is whether an outgoing request went over a pooled connection
+	HTTPConnectionReusedKey = attribute.Key("app.http.connection.reused")
+
+	// DBHealthyKey is the database health check result
+	DBHealthyKey = attribute.Key("app.db.healthy")
+	// DBPoolWaitKey is how long a query waited for a pool connection, in ms
+	DBPoolWaitKey            = attribute.Key("app.db.pool.wait_ms")
+	DBPoolExhaustedReasonKey = attribute.Key("app.db.pool.exhausted_reason")
+	DBPoolSizeKey            = attribute.Key("app.db.pool.size")
+	DBPoolPreviousSizeKey    = attribute.Key("app.db.pool.previous_size")
+	// DBCallDurationKey is how long a call to the database service took, in ms
+	DBCallDurationKey = attribute.Key("app.db.call.duration_ms")
+	// DBCallFailedKey is whether the call failed
+	DBCallFailedKey = attribute.Key("app.db.call.failed")
+	// DBQuerySlowKey marks statements a high_latency incident picked as slow
+	DBQuerySlowKey = attribute.Key("app.db.query.slow")
+
+	// DeployVersionKey is the version a simulated deployment rolled out
+	DeployVersionKey         = attribute.Key("sim.deploy.version")
+	DeployPreviousVersionKey = attribute.Key("sim.deploy.previous_version")
+	// DeployBadKey marks a deployment that ships a latency and error regression
+	DeployBadKey = attribute.Key("sim.deploy.bad")
+	// DeployKindKey is deploy or rollback
+	DeployKindKey = attribute.Key("sim.deploy.kind")
+	// DeployTrackKey is the release track of a service version, stable or
+	// canary: the one a database call was routed to, or the one serving it
+	DeployTrackKey = attribute.Key("sim.deploy.track")
+
+	// BuildTimeKey is when the running binary was built, a resource attribute
+	BuildTimeKey = attribute.Key("app.build.time")
+
+	// OutboxEventIDKey is the outbox row a database write produced or a worker published
+	OutboxEventIDKey = attribute.Key("app.outbox.event_id")
+	// OutboxLagKey is how long an outbox event waited before it was published, in ms
+	OutboxLagKey = attribute.Key("app.outbox.lag_ms")
+
+	// RetryAttemptKey is which try of a downstream call a span is, from 1
+	RetryAttemptKey = attribute.Key("app.retry.attempt")
+	// RetryReasonKey is why a failed try was repeated, e.g. unavailable
+	RetryReasonKey = attribute.Key("app.retry.reason")
+	// FallbackReasonKey is why a request was answered from a fallback instead
+	// of its dependency, e.g. database_error
+	FallbackReasonKey = attribute.Key("app.fallback.reason")
+	// BudgetRemainingKey is how much of the caller's time budget was left
+	// when a downstream call was sent or received, in ms
+	BudgetRemainingKey = attribute.Key("app.budget.remaining_ms")
+	// BudgetExceededKey marks work dropped because it would outlast the budget
+	BudgetExceededKey = attribute.Key("app.budget.exceeded")
+	// HedgeDelayKey is how long a hedged call waited before sending its
+	// second request, in ms
+	HedgeDelayKey = attribute.Key("app.hedge.delay_ms")
+	// HedgeOutcomeKey is how a hedged call ended: not_sent, won, lost or failed
+	HedgeOutcomeKey = attribute.Key("app.hedge.outcome")
+	// ResponseSchemaViolationsKey is how many ways a downstream response
+	// broke its JSON schema, 0 for a valid one
+	ResponseSchemaViolationsKey = attribute.Key("app.response.schema_violations")
+	// RequestSchemaViolationsKey is how many ways a request body broke the
+	// API's OpenAPI schema
+	RequestSchemaViolationsKey = attribute.Key("app.request.schema_violations")
+	// CacheResultKey is how a cached read was answered: hit, stale, miss,
+	// coalesced (a miss that waited for another request's load) or disabled
+	CacheResultKey = attribute.Key("app.cache.result")
+	// BulkheadDependencyKey is the dependency whose bulkhead turned a call away
+	BulkheadDependencyKey = attribute.Key("app.bulkhead.dependency")
+	// BulkheadRejectedKey marks a call rejected because its bulkhead was full
+	BulkheadRejectedKey = attribute.Key("app.bulkhead.rejected")
+	// ShadowResultKey is how a mirrored call's shadow answer compared with the
+	// primary's: match, diverged, primary_only, shadow_only, both_failed or
+	// dropped
+	ShadowResultKey = attribute.Key("app.shadow.result")
+	// ShadowURLKey is the shadow service a call is mirrored to
+	ShadowURLKey = attribute.Key("app.shadow.url")
+	// ShadowDivergencesKey is how many fields the two answers disagree on
+	ShadowDivergencesKey = attribute.Key("app.shadow.divergences")
+	// DebugTraceKey marks the spans of a request sampled for debugging
+	// whatever the sampling ratio, with why: header, user or upstream
+	DebugTraceKey = attribute.Key("app.debug.trace")
+	// RequestEncodingKey is how the body of a call to another service was
+	// encoded, json or protobuf
+	RequestEncodingKey = attribute.Key("app.encoding.request")
+	// ResponseEncodingKey is how the answer to it was encoded
+	ResponseEncodingKey = attribute.Key("app.encoding.response")
+
+	// LinkKindKey is set on span links to the failed attempt a span repeats
+	// or replaces: LinkKindRetry or LinkKindFallback
+	LinkKindKey = attribute.Key("app.link.kind")
+)
+
+// Values of LinkKindKey
+const (
+	LinkKindRetry    = "retry"
+	LinkKindFallback = "fallback"
+)
+
+func IncidentType(v string) attribute.KeyValue { return IncidentTypeKey.String(v) }
+
+func IncidentActive(v bool) attribute.KeyValue { return IncidentActiveKey.Bool(v) }
+
+func IncidentScope(v string) attribute.KeyValue { return IncidentScopeKey.String(v) }
+
+func IncidentStartedAt(v time.Time) attribute.KeyValue {
+	return IncidentStartedAtKey.String(v.Format(time.RFC3339))
+}
+
+func IncidentRemaining(v time.Duration) attribute.KeyValue {
+	return IncidentRemainingKey.Float64(v.Seconds())
+}
+
+func IncidentResumed(v bool) attribute.KeyValue { return IncidentResumedKey.Bool(v) }
+
+func ResponseCorruption(v string) attribute.KeyValue { return ResponseCorruptionKey.String(v) }
+
+func TransactionID(v string) attribute.KeyValue { return TransactionIDKey.String(v) }
+
+func TransactionAmount(v float64) attribute.KeyValue { return TransactionAmountKey.Float64(v) }
+
+func TransactionOperation(v string) attribute.KeyValue { return TransactionOperationKey.String(v) }
+
+func TransferRecipient(v string) attribute.KeyValue { return TransferRecipientKey.String(v) }
+
+func TransferStep(v string) attribute.KeyValue { return TransferStepKey.String(v) }
+
+func TransferOutcome(v string) attribute.KeyValue { return TransferOutcomeKey.String(v) }
+
+func AccountBalance(v float64) attribute.KeyValue { return AccountBalanceKey.Float64(v) }
+
+func BatchID(v string) attribute.KeyValue { return BatchIDKey.String(v) }
+
+func BatchSize(v int) attribute.KeyValue { return BatchSizeKey.Int(v) }
+
+func BatchIndex(v int) attribute.KeyValue { return BatchIndexKey.Int(v) }
+
+func TenantID(v string) attribute.KeyValue { return TenantIDKey.String(v) }
+
+func RequestCost(v float64) attribute.KeyValue { return RequestCostKey.Float64(v) }
+
+func RequestPriority(v string) attribute.KeyValue { return RequestPriorityKey.String(v) }
+
+func RequestShed(v bool) attribute.KeyValue { return RequestShedKey.Bool(v) }
+
+func ClientDevice(v string) attribute.KeyValue { return ClientDeviceKey.String(v) }
+
+func UserScope(v string) attribute.KeyValue { return UserScopeKey.String(v) }
+
+func UserCohort(v int) attribute.KeyValue { return UserCohortKey.Int(v) }
+
+func HTTPConnectionReused(v bool) attribute.KeyValue { return HTTPConnectionReusedKey.Bool(v) }
+
+func DBHealthy(v bool) attribute.KeyValue { return DBHealthyKey.Bool(v) }
+
+func DBPoolWait(ms float64) attribute.KeyValue { return DBPoolWaitKey.Float64(ms) }
+
+func DBPoolExhaustedReason(v string) attribute.KeyValue { return DBPoolExhaustedReasonKey.String(v) }
+
+func DBPoolSize(v int) attribute.KeyValue { return DBPoolSizeKey.Int(v) }
+
+func DBPoolPreviousSize(v int) attribute.KeyValue { return DBPoolPreviousSizeKey.Int(v) }
+
+func DBCallDuration(ms float64) attribute.KeyValue { return DBCallDurationKey.Float64(ms) }
+
+func DBCallFailed(v bool) attribute.KeyValue { return DBCallFailedKey.Bool(v) }
+
+func DBQuerySlow(v bool) attribute.KeyValue { return DBQuerySlowKey.Bool(v) }
+
+func OutboxEventID(v int64) attribute.KeyValue { return OutboxEventIDKey.Int64(v) }
+
+func OutboxLag(ms float64) attribute.KeyValue { return OutboxLagKey.Float64(ms) }
+
+func DeployVersion(v string) attribute.KeyValue { return DeployVersionKey.String(v) }
+
+func DeployPreviousVersion(v string) attribute.KeyValue { return DeployPreviousVersionKey.String(v) }
+
+func DeployBad(v bool) attribute.KeyValue { return DeployBadKey.Bool(v) }
+
+func DeployKind(v string) attribute.KeyValue { return DeployKindKey.String(v) }
+
+func DeployTrack(v string) attribute.KeyValue { return DeployTrackKey.String(v) }
+
+func BuildTime(v string) attribute.KeyValue { return BuildTimeKey.String(v) }
+
+func RetryAttempt(v int) attribute.KeyValue { return RetryAttemptKey.Int(v) }
+
+func RetryReason(v string) attribute.KeyValue { return RetryReasonKey.String(v) }
+
+func FallbackReason(v string) attribute.KeyValue { return FallbackReasonKey.String(v) }
+
+func BudgetRemaining(ms float64) attribute.KeyValue { return BudgetRemainingKey.Float64(ms) }
+
+func BudgetExceeded(v bool) attribute.KeyValue { return BudgetExceededKey.Bool(v) }
+
+func HedgeDelay(ms float64) attribute.KeyValue { return HedgeDelayKey.Float64(ms) }
+
+func HedgeOutcome(v string) attribute.KeyValue { return HedgeOutcomeKey.String(v) }
+
+func ResponseSchemaViolations(n int) attribute.KeyValue { return ResponseSchemaViolationsKey.Int(n) }
+
+func RequestSchemaViolations(n int) attribute.KeyValue { return RequestSchemaViolationsKey.Int(n) }
+
+func CacheResult(v string) attribute.KeyValue { return CacheResultKey.String(v) }
+
+func BulkheadDependency(v string) attribute.KeyValue { return BulkheadDependencyKey.String(v) }
+
+func BulkheadRejected(v bool) attribute.KeyValue { return BulkheadRejectedKey.Bool(v) }
+
+func ShadowResult(v string) attribute.KeyValue { return ShadowResultKey.String(v) }
+
+func ShadowURL(v string) attribute.KeyValue { return ShadowURLKey.String(v) }
+
+func ShadowDivergences(n int) attribute.KeyValue { return ShadowDivergencesKey.Int(n) }
+
+func DebugTrace(reason string) attribute.KeyValue { return DebugTraceKey.String(reason) }
+
+func RequestEncoding(v string) attribute.KeyValue { return RequestEncodingKey.String(v) }
+
+func ResponseEncoding(v string) attribute.KeyValue { return ResponseEncodingKey.String(v) }
+
+func LinkKind(v string) attribute.KeyValue { return LinkKindKey.String(v) }
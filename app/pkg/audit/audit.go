@@ -0,0 +1,279 @@
+// Package audit keeps an append-only trail of the actions that change a
+// running service: simulated incidents starting and ending, deployments,
+// feature flag flips, admin calls and remediations. It is what answers "what
+// changed" while an incident is analyzed.
+//
+// Record and Warn append one JSON line per action to the trail's file, keep
+// the latest entries in memory for Handler, and log the action through logx
+// at info or warning level with audit=true, so the record reaches OTLP with
+// the trace it happened in.
+// A trail without a file lives in memory only. Entries are never rewritten;
+// an existing file is read back on Setup so a restart keeps the history.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// DefaultKeep is how many entries a trail keeps in memory by default
+const DefaultKeep = 1000
+
+// Entry is one audited action
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Service string                 `json:"service"`
+	Action  string                 `json:"action"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	TraceID string                 `json:"trace_id,omitempty"`
+	SpanID  string                 `json:"span_id,omitempty"`
+}
+
+// Trail is the audit trail of one service
+type Trail struct {
+	service string
+	keep    int
+
+	mu      sync.Mutex
+	file    *os.File // nil for a trail in memory only
+	entries []Entry  // the latest keep, oldest first
+}
+
+// Open starts the trail of service, appending to path ("" keeps it in
+// memory) and keeping its latest keep entries, those already in the file
+// included, for queries
+func Open(service, path string, keep int) (*Trail, error) {
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	t := &Trail{service: service, keep: keep}
+	if path == "" {
+		return t, nil
+	}
+	if err := t.load(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	t.file = f
+	return t, nil
+}
+
+// load reads back the entries of an existing file; lines that do not parse
+// are skipped, as a crash can leave the last one cut short
+func (t *Trail) load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read audit log: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if jsonx.Unmarshal(scanner.Bytes(), &e) == nil {
+			t.remember(e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read audit log: %w", err)
+	}
+	return nil
+}
+
+// Record audits action with the message and key/value fields of a logx
+// call, logged at info level. The entry carries the trace and span of ctx.
+func (t *Trail) Record(ctx context.Context, action, msg string, keysAndValues ...interface{}) {
+	t.record(ctx, logx.Infow, action, msg, keysAndValues)
+}
+
+// Warn is Record for actions logged at warning level, such as an incident
+// starting
+func (t *Trail) Warn(ctx context.Context, action, msg string, keysAndValues ...interface{}) {
+	t.record(ctx, logx.Warnw, action, msg, keysAndValues)
+}
+
+func (t *Trail) record(ctx context.Context, log func(context.Context, string, ...interface{}), action, msg string, keysAndValues []interface{}) {
+	e := Entry{
+		Time:    time.Now().UTC(),
+		Service: t.service,
+		Action:  action,
+		Message: msg,
+		Fields:  logx.Fields(keysAndValues...),
+	}
+	if len(e.Fields) == 0 {
+		e.Fields = nil
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		e.TraceID, e.SpanID = sc.TraceID().String(), sc.SpanID().String()
+	}
+	log(ctx, msg, append([]interface{}{"audit", true, "audit.action", action}, keysAndValues...)...)
+
+	line, err := jsonx.Marshal(e)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remember(e)
+	if t.file == nil {
+		return
+	}
+	if err == nil {
+		_, err = t.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logx.Errorw(ctx, "Failed to append to the audit log", "audit.action", action, "path", t.file.Name(), "error", err)
+	}
+}
+
+func (t *Trail) remember(e Entry) {
+	t.entries = append(t.entries, e)
+	if len(t.entries) > t.keep {
+		t.entries = t.entries[len(t.entries)-t.keep:]
+	}
+}
+
+// Filter selects entries; zero values match everything
+type Filter struct {
+	// Action matches the action itself or, ending in ".", every action
+	// under it, e.g. "incident." for incident.started and incident.resolved
+	Action string
+	Since  time.Time
+	// Limit keeps the latest entries only
+	Limit int
+}
+
+func (f Filter) match(e Entry) bool {
+	if f.Action != "" && e.Action != f.Action && !(strings.HasSuffix(f.Action, ".") && strings.HasPrefix(e.Action, f.Action)) {
+		return false
+	}
+	return f.Since.IsZero() || !e.Time.Before(f.Since)
+}
+
+// Entries returns the kept entries f selects, oldest first
+func (t *Trail) Entries(f Filter) []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []Entry{}
+	for _, e := range t.entries {
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[len(out)-f.Limit:]
+	}
+	return out
+}
+
+// Close closes the file of the trail
+func (t *Trail) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// ServeHTTP answers GET with the entries selected by the action, since
+// (RFC 3339 time, or a duration back from now such as 15m) and limit
+// (default 100) query parameters
+func (t *Trail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		jsonx.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	entries := t.Entries(f)
+	w.Header().Set("Content-Type", "application/json")
+	jsonx.NewEncoder(w).Encode(map[string]interface{}{
+		"service": t.service,
+		"count":   len(entries),
+		"entries": entries,
+	})
+}
+
+func parseFilter(r *http.Request) (Filter, error) {
+	q := r.URL.Query()
+	f := Filter{Action: q.Get("action"), Limit: 100}
+	if v := q.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			f.Since = time.Now().Add(-d)
+		} else if at, err := time.Parse(time.RFC3339, v); err == nil {
+			f.Since = at
+		} else {
+			return f, fmt.Errorf("since must be an RFC 3339 time or a duration, got %q", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("limit must be a positive number, got %q", v)
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+// The trail of the process, in memory only until Setup
+var std atomic.Pointer[Trail]
+
+func init() {
+	std.Store(&Trail{keep: DefaultKeep})
+}
+
+// Setup opens the trail of the process that Record and Handler use
+func Setup(service, path string, keep int) error {
+	t, err := Open(service, path, keep)
+	if err != nil {
+		return err
+	}
+	if old := std.Swap(t); old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Record audits action on the trail of the process, logged at info level
+func Record(ctx context.Context, action, msg string, keysAndValues ...interface{}) {
+	std.Load().Record(ctx, action, msg, keysAndValues...)
+}
+
+// Warn audits action on the trail of the process, logged at warning level
+func Warn(ctx context.Context, action, msg string, keysAndValues ...interface{}) {
+	std.Load().Warn(ctx, action, msg, keysAndValues...)
+}
+
+// Handler serves the trail of the process, see Trail.ServeHTTP
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		std.Load().ServeHTTP(w, r)
+	})
+}
+
+// Close closes the trail of the process
+func Close() error {
+	return std.Load().Close()
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func actions(entries []Entry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Action)
+	}
+	return out
+}
+
+func TestTrail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	trail, err := Open("database-service", path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail.Warn(ctx, "incident.started", "started", "incident_type", "high_latency")
+	trail.Record(ctx, "incident.resolved", "resolved", "incident_type", "high_latency")
+	trail.Warn(ctx, "admin.pool.scale", "scaled", "pool.max_connections", 40)
+	trail.Warn(ctx, "admin.incident.clear", "cleared")
+	if err := trail.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopened, the trail keeps the latest 3 from the file
+	trail, err = Open("database-service", path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trail.Close()
+	trail.Record(ctx, "incident.started", "started again")
+
+	for name, tc := range map[string]struct {
+		filter Filter
+		want   []string
+	}{
+		"all":    {Filter{}, []string{"admin.pool.scale", "admin.incident.clear", "incident.started"}},
+		"exact":  {Filter{Action: "admin.pool.scale"}, []string{"admin.pool.scale"}},
+		"prefix": {Filter{Action: "admin."}, []string{"admin.pool.scale", "admin.incident.clear"}},
+		"limit":  {Filter{Limit: 1}, []string{"incident.started"}},
+		"since":  {Filter{Since: time.Now().Add(time.Hour)}, nil},
+	} {
+		if got := actions(trail.Entries(tc.filter)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: actions %v, want %v", name, got, tc.want)
+		}
+	}
+	if e := trail.Entries(Filter{Action: "admin.pool.scale"})[0]; e.Service != "database-service" || e.Fields["pool.max_connections"] != float64(40) {
+		t.Errorf("entry read back as %+v", e)
+	}
+
+	rec := httptest.NewRecorder()
+	trail.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/audit?action=incident.&since=1h&limit=5", nil))
+	var body struct {
+		Count   int     `json:"count"`
+		Entries []Entry `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 1 || body.Entries[0].Message != "started again" {
+		t.Errorf("handler answered %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	trail.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/audit?since=yesterday", nil))
+	if rec.Code != 400 {
+		t.Errorf("bad since answered %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+// Package buildinfo reports which build of a service is running.
+//
+// Version, Commit and BuildTime are stamped in at build time:
+//
+//	go build -ldflags "-X incident-simulation/pkg/buildinfo.Version=1.4.0 \
+//	  -X incident-simulation/pkg/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X incident-simulation/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them the commit and time fall back to the VCS stamp the go tool
+// embeds when building inside a git checkout. The same values go on the OTel
+// resource, the service_build_info gauge and GET /version, so a regression
+// can be lined up with the deploy that introduced it.
+package buildinfo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Set with -ldflags -X
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+// DefaultVersion is the version of builds without a stamped one
+const DefaultVersion = "1.0.0"
+
+// Info describes the running build
+type Info struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info of service
+func Get(service string) Info {
+	info := Info{
+		Service:   service,
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if info.Version == "" {
+		info.Version = DefaultVersion
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
+
+// Handler serves the build info of service as JSON, for GET /version
+func Handler(service string) http.Handler {
+	info := Get(service)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+}
+
+// RegisterMetric exports service_build_info, always 1, with the build as
+// attributes; join it on job to split any other metric by version
+func RegisterMetric(service string) error {
+	info := Get(service)
+	meter := otel.Meter(service)
+	gauge, err := meter.Int64ObservableGauge("service_build_info",
+		metric.WithDescription("Build of the running service; always 1"))
+	if err != nil {
+		return err
+	}
+	set := metric.WithAttributes(
+		attribute.String("version", info.Version),
+		attribute.String("commit", info.Commit),
+		attribute.String("build_time", info.BuildTime),
+		attribute.String("go_version", info.GoVersion),
+	)
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(gauge, 1, set)
+		return nil
+	}, gauge)
+	return err
+}
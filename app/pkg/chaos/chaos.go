@@ -0,0 +1,161 @@
+// Package chaos injects faults into individual requests on demand.
+//
+// A caller sets X-Chaos-Delay (a Go duration such as 2s) and/or X-Chaos-Fail
+// (an HTTP status between 400 and 599) on a request. X-Chaos-Target names the
+// service that should apply the fault; services it passes through forward the
+// headers on their outgoing calls instead of applying them. Every injected
+// fault is recorded on the server span so it can be told apart from a real
+// incident. Services install the middleware only in dev mode.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Request headers understood by the middleware
+const (
+	HeaderDelay  = "X-Chaos-Delay"
+	HeaderFail   = "X-Chaos-Fail"
+	HeaderTarget = "X-Chaos-Target"
+)
+
+// MaxDelay caps X-Chaos-Delay so a typo cannot hang a worker
+const MaxDelay = 60 * time.Second
+
+// Fault is the fault requested by one set of X-Chaos-* headers
+type Fault struct {
+	Delay      time.Duration
+	FailStatus int
+	Target     string
+}
+
+// IsZero reports whether no fault was requested
+func (f Fault) IsZero() bool {
+	return f.Delay == 0 && f.FailStatus == 0
+}
+
+// Parse reads the X-Chaos-* headers
+func Parse(h http.Header) (Fault, error) {
+	f := Fault{Target: strings.TrimSpace(h.Get(HeaderTarget))}
+
+	if v := h.Get(HeaderDelay); v != "" {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil || d < 0 {
+			return Fault{}, fmt.Errorf("invalid %s %q", HeaderDelay, v)
+		}
+		f.Delay = min(d, MaxDelay)
+	}
+	if v := h.Get(HeaderFail); v != "" {
+		status, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || status < 400 || status > 599 {
+			return Fault{}, fmt.Errorf("invalid %s %q: want a status between 400 and 599", HeaderFail, v)
+		}
+		f.FailStatus = status
+	}
+	return f, nil
+}
+
+type contextKey struct{}
+
+// Forward copies a fault aimed at another service onto an outgoing request
+func Forward(ctx context.Context, req *http.Request) {
+	f, ok := ctx.Value(contextKey{}).(Fault)
+	if !ok {
+		return
+	}
+	if f.Delay > 0 {
+		req.Header.Set(HeaderDelay, f.Delay.String())
+	}
+	if f.FailStatus > 0 {
+		req.Header.Set(HeaderFail, strconv.Itoa(f.FailStatus))
+	}
+	req.Header.Set(HeaderTarget, f.Target)
+}
+
+// Middleware applies faults addressed to service (or to no service in particular)
+// and remembers faults addressed to other services for Forward
+func Middleware(service string, next http.Handler) http.Handler {
+	injections, _ := otel.Meter("chaos").Int64Counter("chaos_injections_total",
+		metric.WithDescription("Total number of faults injected through X-Chaos-* headers"))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		span := oteltrace.SpanFromContext(ctx)
+
+		f, err := Parse(r.Header)
+		if err != nil {
+			span.SetAttributes(attribute.String("chaos.error", err.Error()))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"status": "error", "error": err.Error()})
+			return
+		}
+		if f.IsZero() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Addressed to a downstream service: pass it along untouched
+		if f.Target != "" && f.Target != service {
+			span.SetAttributes(attribute.String("chaos.forwarded_to", f.Target))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, contextKey{}, f)))
+			return
+		}
+
+		span.SetAttributes(
+			attribute.Bool("chaos.injected", true),
+			attribute.Int64("chaos.delay_ms", f.Delay.Milliseconds()),
+			attribute.Int("chaos.fail_status", f.FailStatus),
+		)
+		span.AddEvent("chaos_injected", oteltrace.WithAttributes(
+			attribute.String("chaos.service", service),
+			attribute.String("chaos.delay", f.Delay.String()),
+			attribute.Int("chaos.fail_status", f.FailStatus),
+		))
+
+		if f.Delay > 0 {
+			if injections != nil {
+				injections.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("service", service),
+					attribute.String("fault", "delay"),
+				))
+			}
+			select {
+			case <-time.After(f.Delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if f.FailStatus > 0 {
+			if injections != nil {
+				injections.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("service", service),
+					attribute.String("fault", "fail"),
+				))
+			}
+			span.SetStatus(codes.Error, "chaos: injected failure")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(f.FailStatus)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status": "error",
+				"error":  fmt.Sprintf("chaos: injected %d", f.FailStatus),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,319 @@
+// Package client is a typed Go client for the core API: transactions, batches,
+// balances and health. Calls go through otelhttp, so each attempt is a client
+// span the core API's server span joins, and failures come back as an *Error
+// whose Kind says what went wrong, mapped from the status the core API
+// answered with.
+//
+// Failed calls are retried with exponential backoff, honouring Retry-After.
+// Reads are retried after any failure that might pass; transactions only when
+// they carry an Idempotency-Key or the core API turned them away throttled or
+// shed, so a retry never books a payment twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// Client calls the core API at one base URL; it is safe for concurrent use
+type Client struct {
+	baseURL  string
+	http     *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends calls through c instead of the default client, an
+// otelhttp transport with a 30s timeout. Wrap c's transport with otelhttp to
+// keep the client spans.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) { cl.http = c }
+}
+
+// WithRetries makes a call up to attempts times, waiting backoff before the
+// first retry and twice as long before each one after it. One attempt turns
+// retries off.
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(cl *Client) {
+		cl.attempts = max(attempts, 1)
+		cl.backoff = backoff
+	}
+}
+
+// New returns a client of the core API at baseURL, e.g. http://127.0.0.1:8080.
+// By default a call is tried 3 times, 100ms apart at first.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		attempts: 3,
+		backoff:  100 * time.Millisecond,
+		http: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   30 * time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CallOption sets something on the request of one call, typically a header
+type CallOption func(*http.Request)
+
+// WithHeader sets header key to value
+func WithHeader(key, value string) CallOption {
+	return func(r *http.Request) { r.Header.Set(key, value) }
+}
+
+// WithHeaders sets every header of h
+func WithHeaders(h http.Header) CallOption {
+	return func(r *http.Request) {
+		for k, v := range h {
+			r.Header[k] = v
+		}
+	}
+}
+
+// WithBearerToken authenticates the call with an access token from the auth service
+func WithBearerToken(token string) CallOption {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+// WithIdempotencyKey sends an Idempotency-Key, under which the core API
+// replays the first result of a transaction; it also makes the transaction
+// safe to retry after any failure
+func WithIdempotencyKey(key string) CallOption {
+	return WithHeader("Idempotency-Key", key)
+}
+
+// TransactionRequest is a transaction to book
+type TransactionRequest struct {
+	UserID    string  `json:"user_id"`
+	Amount    float64 `json:"amount"`
+	Operation string  `json:"operation"`
+	// ToUserID is the recipient of a transfer
+	ToUserID string `json:"to_user_id,omitempty"`
+}
+
+// Operations of a TransactionRequest
+const (
+	OperationDeposit    = "deposit"
+	OperationWithdrawal = "withdrawal"
+	OperationTransfer   = "transfer"
+	// OperationBalanceCheck books nothing, it reads the balance through the
+	// transaction path
+	OperationBalanceCheck = "balance_check"
+)
+
+// Transaction is a booked transaction
+type Transaction struct {
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+	Timestamp     int64  `json:"timestamp"`
+	// Data is the database service's result
+	Data    map[string]interface{} `json:"data"`
+	Payment *Payment               `json:"payment"`
+}
+
+// Payment is the payment gateway's authorization of a transaction
+type Payment struct {
+	PaymentID string `json:"payment_id"`
+	Status    string `json:"status"`
+	Network   string `json:"network"`
+	ThreeDS   bool   `json:"three_ds"`
+}
+
+// Batch is the outcome of a transaction batch. It succeeds as a call even
+// when items fail; Status is success, partial or failed.
+type Batch struct {
+	BatchID   string      `json:"batch_id"`
+	Status    string      `json:"status"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Results   []BatchItem `json:"results"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+// BatchItem is the outcome of one transaction of a batch
+type BatchItem struct {
+	Index         int                    `json:"index"`
+	TransactionID string                 `json:"transaction_id"`
+	Status        string                 `json:"status"`
+	Data          map[string]interface{} `json:"data"`
+	Error         string                 `json:"error"`
+	Fields        []FieldError           `json:"fields"`
+}
+
+// Balance is a user's balance
+type Balance struct {
+	UserID           string  `json:"user_id"`
+	Balance          float64 `json:"balance"`
+	AvailableBalance float64 `json:"available_balance"`
+	Currency         string  `json:"currency"`
+	// Stale is set when the database was unavailable and the core API
+	// answered with the last balance it read, StaleAge ago
+	Stale    bool          `json:"-"`
+	StaleAge time.Duration `json:"-"`
+}
+
+// Health is the core API's view of its dependencies
+type Health struct {
+	// Status is healthy, or degraded when a dependency is down
+	Status          string `json:"status"`
+	DatabaseHealthy bool   `json:"database_healthy"`
+	PaymentHealthy  bool   `json:"payment_healthy"`
+	Timestamp       int64  `json:"timestamp"`
+}
+
+// CreateTransaction books req through POST /api/transaction
+func (c *Client) CreateTransaction(ctx context.Context, req TransactionRequest, opts ...CallOption) (*Transaction, error) {
+	var tx Transaction
+	if err := c.call(ctx, http.MethodPost, "/api/transaction", req, &tx, opts); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// CreateBatch books reqs through POST /api/transactions/batch
+func (c *Client) CreateBatch(ctx context.Context, reqs []TransactionRequest, opts ...CallOption) (*Batch, error) {
+	var batch Batch
+	body := struct {
+		Transactions []TransactionRequest `json:"transactions"`
+	}{reqs}
+	if err := c.call(ctx, http.MethodPost, "/api/transactions/batch", body, &batch, opts); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetBalance reads the balance of userID through GET /api/user/{id}/balance
+func (c *Client) GetBalance(ctx context.Context, userID string, opts ...CallOption) (*Balance, error) {
+	var resp struct {
+		Data            Balance `json:"data"`
+		Stale           bool    `json:"stale"`
+		StaleAgeSeconds float64 `json:"stale_age_seconds"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/api/user/"+url.PathEscape(userID)+"/balance", nil, &resp, opts); err != nil {
+		return nil, err
+	}
+	balance := resp.Data
+	balance.Stale = resp.Stale
+	balance.StaleAge = time.Duration(resp.StaleAgeSeconds * float64(time.Second))
+	return &balance, nil
+}
+
+// Health reads GET /api/health. A degraded core API still answers, so check
+// Status; only an unreachable one fails.
+func (c *Client) Health(ctx context.Context, opts ...CallOption) (*Health, error) {
+	var health Health
+	if err := c.call(ctx, http.MethodGet, "/api/health", nil, &health, opts); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// call sends body as JSON and decodes a 2xx answer into out, retrying a
+// failure while the request and the error allow
+func (c *Client) call(ctx context.Context, method, path string, body, out interface{}, opts []CallOption) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = jsonx.Marshal(body); err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	wait := c.backoff
+	for attempt := 1; ; attempt++ {
+		req, err := c.newRequest(ctx, method, path, payload, opts)
+		if err != nil {
+			return err
+		}
+		err = c.do(req, out)
+		var apiErr *Error
+		if err == nil || !errors.As(err, &apiErr) || attempt >= c.attempts || !retry(req, apiErr) {
+			return err
+		}
+
+		// Jitter keeps callers that failed together from retrying together
+		delay := max(wait/2+rand.N(wait/2+1), apiErr.RetryAfter)
+		wait *= 2
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retry reports whether req may be sent again after err
+func retry(req *http.Request, err *Error) bool {
+	if err.Temporary() {
+		return true
+	}
+	idempotent := req.Method == http.MethodGet || req.Header.Get("Idempotency-Key") != ""
+	return idempotent && err.retryable()
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, payload []byte, opts []CallOption) (*http.Request, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return req, nil
+}
+
+// do sends req once and maps its failure to an *Error; a canceled ctx is
+// returned as is
+func (c *Client) do(req *http.Request, out interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return &Error{Kind: KindNetwork, err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var body errorBody
+		data, _ := io.ReadAll(resp.Body)
+		if jsonx.Unmarshal(data, &body) != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(data))
+		}
+		return newError(resp, body)
+	}
+	if err := jsonx.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s answer: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
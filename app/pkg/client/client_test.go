@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// coreAPI answers every call with status and body, counting the calls
+func coreAPI(t *testing.T, status int, header http.Header, body string) (*Client, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return New(srv.URL, WithRetries(3, time.Millisecond)), &calls
+}
+
+func TestErrorTaxonomy(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		body   string
+		kind   Kind
+	}{
+		{http.StatusBadRequest, `{"status":"error","error":"validation failed","fields":[{"field":"amount","message":"must be positive"}]}`, KindValidation},
+		{http.StatusUnauthorized, `{"error":"missing bearer token"}`, KindUnauthorized},
+		{http.StatusPaymentRequired, `{"status":"declined","error":"insufficient funds"}`, KindPaymentDeclined},
+		{http.StatusBadGateway, `{"status":"error","error":"payment gateway error"}`, KindUpstream},
+		{http.StatusGatewayTimeout, `{"status":"error","error":"request deadline exceeded"}`, KindTimeout},
+		{499, `{"status":"error","error":"client canceled"}`, KindCanceled},
+		{http.StatusInternalServerError, `{"status":"error","error":"database error","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","error_id":"err_1"}`, KindServer},
+		{http.StatusTeapot, `short and stout`, KindRejected},
+	} {
+		c, calls := coreAPI(t, tc.status, nil, tc.body)
+		_, err := c.CreateTransaction(context.Background(), TransactionRequest{UserID: "user_1", Amount: 10, Operation: OperationDeposit})
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.Kind != tc.kind || apiErr.StatusCode != tc.status {
+			t.Errorf("%d answered %v, want a %s error", tc.status, err, tc.kind)
+			continue
+		}
+		if !IsKind(err, tc.kind) {
+			t.Errorf("IsKind(%v, %s) = false", err, tc.kind)
+		}
+		// A transaction without an Idempotency-Key is only retried when turned away
+		if n := calls.Load(); n != 1 {
+			t.Errorf("%d answer made %d calls, want 1", tc.status, n)
+		}
+		if tc.kind == KindValidation && (len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "amount") {
+			t.Errorf("validation error fields = %+v", apiErr.Fields)
+		}
+		if tc.kind == KindServer && apiErr.ErrorID != "err_1" {
+			t.Errorf("server error lost its error reference: %+v", apiErr)
+		}
+		if tc.kind == KindRejected && apiErr.Message != "short and stout" {
+			t.Errorf("plain text answer read as %q", apiErr.Message)
+		}
+	}
+
+	c := New("http://127.0.0.1:1", WithRetries(1, 0))
+	if _, err := c.Health(context.Background()); !IsKind(err, KindNetwork) {
+		t.Errorf("unreachable core API answered %v, want a network error", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	deposit := TransactionRequest{UserID: "user_1", Amount: 10, Operation: OperationDeposit}
+
+	// Throttled and shed calls did no work, so even transactions are retried
+	c, calls := coreAPI(t, http.StatusTooManyRequests, nil, `{"status":"error","error":"rate limit exceeded","retry_after":1}`)
+	start := time.Now()
+	_, err := c.CreateTransaction(ctx, deposit)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Kind != KindRateLimited || apiErr.RetryAfter != time.Second {
+		t.Fatalf("throttled call answered %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("throttled transaction made %d calls, want 3", n)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("retries waited %s, less than Retry-After asked", elapsed)
+	}
+
+	c, calls = coreAPI(t, http.StatusServiceUnavailable, http.Header{"Retry-After": {"0"}}, `{"error":"service overloaded, request shed"}`)
+	if _, err := c.CreateBatch(ctx, []TransactionRequest{deposit}); !IsKind(err, KindUnavailable) || calls.Load() != 3 {
+		t.Errorf("shed batch answered %v after %d calls", err, calls.Load())
+	}
+
+	// A failed read or keyed transaction might pass on retry; an unkeyed one might book twice
+	c, calls = coreAPI(t, http.StatusBadGateway, nil, `{"error":"payment gateway error"}`)
+	c.CreateTransaction(ctx, deposit)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("unkeyed transaction made %d calls, want 1", n)
+	}
+	c.CreateTransaction(ctx, deposit, WithIdempotencyKey("key_1"))
+	if n := calls.Load(); n != 4 {
+		t.Errorf("keyed transaction made %d calls, want 3", n-1)
+	}
+	c, calls = coreAPI(t, http.StatusInternalServerError, nil, `{"error":"failed to get balance"}`)
+	c.GetBalance(ctx, "user_1")
+	if n := calls.Load(); n != 3 {
+		t.Errorf("balance read made %d calls, want 3", n)
+	}
+
+	// Validation errors never pass
+	c, calls = coreAPI(t, http.StatusBadRequest, nil, `{"error":"validation failed"}`)
+	c.CreateTransaction(ctx, deposit, WithIdempotencyKey("key_2"))
+	if n := calls.Load(); n != 1 {
+		t.Errorf("invalid transaction made %d calls, want 1", n)
+	}
+}
+
+func TestCalls(t *testing.T) {
+	var got struct {
+		path, auth, key, tenant string
+		req                     TransactionRequest
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path = r.Method + " " + r.URL.Path
+		got.auth = r.Header.Get("Authorization")
+		got.key = r.Header.Get("Idempotency-Key")
+		got.tenant = r.Header.Get("X-Tenant-ID")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/transaction":
+			jsonx.NewDecoder(r.Body).Decode(&got.req)
+			w.Write([]byte(`{"transaction_id":"txn_1","status":"success","timestamp":1760486400,"data":{"affected_rows":2},"payment":{"payment_id":"pay_1","status":"authorized","network":"visa"}}`))
+		case "/api/user/user_1/balance":
+			w.Write([]byte(`{"status":"success","data":{"user_id":"user_1","balance":-20.5,"available_balance":0,"currency":"USD"},"stale":true,"stale_age_seconds":1.5}`))
+		case "/api/health":
+			w.Write([]byte(`{"status":"degraded","database_healthy":false,"payment_healthy":true,"timestamp":1760486400}`))
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL + "/")
+	ctx := context.Background()
+
+	req := TransactionRequest{UserID: "user_1", Amount: 25.5, Operation: OperationTransfer, ToUserID: "user_2"}
+	tx, err := c.CreateTransaction(ctx, req, WithBearerToken("tok"), WithIdempotencyKey("key_1"), WithHeader("X-Tenant-ID", "acme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.path != "POST /api/transaction" || got.req != req || got.auth != "Bearer tok" || got.key != "key_1" || got.tenant != "acme" {
+		t.Errorf("transaction sent as %+v", got)
+	}
+	if tx.TransactionID != "txn_1" || tx.Payment == nil || tx.Payment.PaymentID != "pay_1" || tx.Data["affected_rows"] != 2.0 {
+		t.Errorf("transaction read as %+v", tx)
+	}
+
+	balance, err := c.GetBalance(ctx, "user_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *balance != (Balance{UserID: "user_1", Balance: -20.5, Currency: "USD", Stale: true, StaleAge: 1500 * time.Millisecond}) {
+		t.Errorf("balance read as %+v", balance)
+	}
+
+	health, err := c.Health(ctx)
+	if err != nil || health.Status != "degraded" || health.DatabaseHealthy || !health.PaymentHealthy {
+		t.Errorf("health read as %+v, %v", health, err)
+	}
+}
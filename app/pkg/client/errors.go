@@ -0,0 +1,156 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Kind classifies a failed call by what the caller can do about it
+type Kind string
+
+const (
+	// KindValidation is a request the core API rejected as invalid; Fields says why
+	KindValidation Kind = "validation"
+	// KindUnauthorized is a missing, invalid or insufficient bearer token
+	KindUnauthorized Kind = "unauthorized"
+	// KindPaymentDeclined is a payment the gateway declined
+	KindPaymentDeclined Kind = "payment_declined"
+	// KindRateLimited is a request throttled by the core API; RetryAfter says for how long
+	KindRateLimited Kind = "rate_limited"
+	// KindUnavailable is a request shed or turned away by a full bulkhead
+	// before any work was done
+	KindUnavailable Kind = "unavailable"
+	// KindUpstream is a failure of the payment gateway behind the core API
+	KindUpstream Kind = "upstream"
+	// KindTimeout is a request that ran past its deadline on the server
+	KindTimeout Kind = "timeout"
+	// KindCanceled is a request the server saw its caller give up on
+	KindCanceled Kind = "canceled"
+	// KindServer is any other server failure, such as a database error
+	KindServer Kind = "server"
+	// KindRejected is any other request the core API refused
+	KindRejected Kind = "rejected"
+	// KindNetwork is a request that got no answer at all
+	KindNetwork Kind = "network"
+)
+
+// statusClientClosedRequest is the core API's status for a canceled request
+const statusClientClosedRequest = 499
+
+// Error is a failed call to the core API. Calls that got an answer carry its
+// status and error reference, which finds the failure in the core API's
+// traces and logs.
+type Error struct {
+	Kind       Kind
+	StatusCode int
+	Message    string
+	// Fields are the invalid fields of a validation error
+	Fields []FieldError
+	// RetryAfter is how long the server asked the caller to wait, if it did
+	RetryAfter time.Duration
+	TraceID    string
+	ErrorID    string
+
+	err error
+}
+
+// FieldError is one invalid field of a rejected request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("core API %s error: %v", e.Kind, e.err)
+	}
+	msg := fmt.Sprintf("core API %s error: %d", e.Kind, e.StatusCode)
+	if e.Message != "" {
+		msg += " " + e.Message
+	}
+	if e.ErrorID != "" {
+		msg += " (error_id " + e.ErrorID + ")"
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error { return e.err }
+
+// Temporary reports whether the core API turned the call away, throttled or
+// shed, rather than failed it, so it may be retried even when it is not
+// idempotent
+func (e *Error) Temporary() bool {
+	return e.Kind == KindRateLimited || e.Kind == KindUnavailable
+}
+
+// retryable reports whether a call of an idempotent request may be retried
+// after e: any failure that might pass, not one the request itself caused
+func (e *Error) retryable() bool {
+	switch e.Kind {
+	case KindRateLimited, KindUnavailable, KindUpstream, KindTimeout, KindServer, KindNetwork:
+		return true
+	}
+	return false
+}
+
+// IsKind reports whether err is an *Error of kind
+func IsKind(err error, kind Kind) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Kind == kind
+}
+
+// kindOf maps a core API response status to its kind
+func kindOf(status int) Kind {
+	switch status {
+	case http.StatusBadRequest:
+		return KindValidation
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return KindUnauthorized
+	case http.StatusPaymentRequired:
+		return KindPaymentDeclined
+	case http.StatusTooManyRequests:
+		return KindRateLimited
+	case http.StatusServiceUnavailable:
+		return KindUnavailable
+	case http.StatusBadGateway:
+		return KindUpstream
+	case http.StatusGatewayTimeout:
+		return KindTimeout
+	case statusClientClosedRequest:
+		return KindCanceled
+	}
+	if status >= 500 {
+		return KindServer
+	}
+	return KindRejected
+}
+
+// errorBody is the part of a core API error answer the client reads
+type errorBody struct {
+	Error      string       `json:"error"`
+	Fields     []FieldError `json:"fields"`
+	RetryAfter int          `json:"retry_after"`
+	TraceID    string       `json:"trace_id"`
+	ErrorID    string       `json:"error_id"`
+}
+
+// newError builds the error of a non-2xx answer
+func newError(resp *http.Response, body errorBody) *Error {
+	e := &Error{
+		Kind:       kindOf(resp.StatusCode),
+		StatusCode: resp.StatusCode,
+		Message:    body.Error,
+		Fields:     body.Fields,
+		TraceID:    body.TraceID,
+		ErrorID:    body.ErrorID,
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	} else if body.RetryAfter > 0 {
+		e.RetryAfter = time.Duration(body.RetryAfter) * time.Second
+	}
+	return e
+}
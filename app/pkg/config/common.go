@@ -0,0 +1,264 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OTLP holds the connection settings for the OTLP/HTTP exporters
+type OTLP struct {
+	OTLPEndpoint   string `env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"otlp-endpoint" default:"localhost:4318" usage:"OTLP/HTTP collector host:port, or a URL whose scheme decides TLS and whose path prefixes /v1/traces, /v1/metrics and /v1/logs"`
+	OTLPInsecure   bool   `env:"OTEL_EXPORTER_OTLP_INSECURE" flag:"otlp-insecure" default:"true" usage:"Send OTLP to a host:port endpoint over plain HTTP instead of TLS"`
+	OTLPHeaders    string `env:"OTEL_EXPORTER_OTLP_HEADERS" flag:"otlp-headers" secret:"true" usage:"Extra OTLP request headers, e.g. Authorization=Bearer%20token,x-api-key=abc"`
+	OTLPCACert     string `env:"OTEL_EXPORTER_OTLP_CERTIFICATE" flag:"otlp-ca-cert" usage:"PEM CA bundle used to verify the collector"`
+	OTLPClientCert string `env:"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE" flag:"otlp-client-cert" usage:"PEM client certificate for mTLS"`
+	OTLPClientKey  string `env:"OTEL_EXPORTER_OTLP_CLIENT_KEY" flag:"otlp-client-key" usage:"PEM client key for mTLS"`
+
+	OTLPStartupWait time.Duration `env:"OTEL_EXPORTER_OTLP_STARTUP_WAIT" flag:"otlp-startup-wait" default:"30s" usage:"How long creating an OTLP exporter is retried, with backoff, before the service gives up"`
+	OTLPRetryBuffer int           `env:"OTEL_EXPORTER_OTLP_RETRY_BUFFER" flag:"otlp-retry-buffer" default:"8192" usage:"Spans and log records of failed exports kept per signal and resent with the next export (0 disables)"`
+}
+
+// Output selects the telemetry exporter; stdout and file skip the collector entirely
+type Output struct {
+	TelemetryExporter    string `env:"TELEMETRY_EXPORTER" flag:"telemetry-exporter" default:"otlp" usage:"Telemetry destination: otlp, stdout or file"`
+	TelemetryFormat      string `env:"TELEMETRY_FORMAT" flag:"telemetry-format" default:"jsonl" usage:"stdout/file encoding: jsonl or pretty"`
+	TelemetryFile        string `env:"TELEMETRY_FILE" flag:"telemetry-file" default:"telemetry.jsonl" usage:"Output path for the file exporter"`
+	TelemetryFileMaxMB   int    `env:"TELEMETRY_FILE_MAX_MB" flag:"telemetry-file-max-mb" default:"100" usage:"Rotate the telemetry file after this many megabytes"`
+	TelemetryFileBackups int    `env:"TELEMETRY_FILE_BACKUPS" flag:"telemetry-file-backups" default:"3" usage:"Rotated telemetry files to keep"`
+}
+
+// Propagation selects the trace context formats read from and written to requests
+type Propagation struct {
+	Propagators string `env:"OTEL_PROPAGATORS" flag:"propagators" default:"tracecontext,baggage" usage:"Comma-separated context propagation formats: tracecontext, baggage, b3, b3multi or none"`
+}
+
+// Batching tunes how spans, log records and metrics are buffered before export
+type Batching struct {
+	SpanQueueSize        int           `env:"SPAN_QUEUE_SIZE" flag:"span-queue-size" default:"2048" usage:"Spans waiting for export; more are dropped and counted in telemetry_spans_dropped_total"`
+	SpanBatchSize        int           `env:"SPAN_BATCH_SIZE" flag:"span-batch-size" default:"512" usage:"Spans per export request"`
+	SpanBatchDelay       time.Duration `env:"SPAN_BATCH_DELAY" flag:"span-batch-delay" default:"5s" usage:"Longest wait before a partial span batch is exported"`
+	SpanExportTimeout    time.Duration `env:"SPAN_EXPORT_TIMEOUT" flag:"span-export-timeout" default:"30s" usage:"Time limit for one span export"`
+	LogQueueSize         int           `env:"LOG_QUEUE_SIZE" flag:"log-queue-size" default:"2048" usage:"Log records waiting for export; more are dropped"`
+	LogBatchSize         int           `env:"LOG_BATCH_SIZE" flag:"log-batch-size" default:"512" usage:"Log records per export request"`
+	LogBatchDelay        time.Duration `env:"LOG_BATCH_DELAY" flag:"log-batch-delay" default:"1s" usage:"Longest wait before a partial log batch is exported"`
+	LogExportTimeout     time.Duration `env:"LOG_EXPORT_TIMEOUT" flag:"log-export-timeout" default:"30s" usage:"Time limit for one log export"`
+	MetricExportInterval time.Duration `env:"METRIC_EXPORT_INTERVAL" flag:"metric-export-interval" default:"5s" usage:"How often metrics are collected and exported"`
+	MetricExportTimeout  time.Duration `env:"METRIC_EXPORT_TIMEOUT" flag:"metric-export-timeout" default:"30s" usage:"Time limit for one metric export"`
+}
+
+// Validate checks the batching limits; services call it from their own Validate
+func (b Batching) Validate() error {
+	var errs []error
+	if b.SpanQueueSize <= 0 || b.SpanBatchSize <= 0 || b.LogQueueSize <= 0 || b.LogBatchSize <= 0 {
+		errs = append(errs, errors.New("SPAN_QUEUE_SIZE, SPAN_BATCH_SIZE, LOG_QUEUE_SIZE and LOG_BATCH_SIZE must be positive"))
+	}
+	if b.SpanBatchSize > b.SpanQueueSize || b.LogBatchSize > b.LogQueueSize {
+		errs = append(errs, errors.New("SPAN_BATCH_SIZE and LOG_BATCH_SIZE must not exceed their queue size"))
+	}
+	if b.SpanBatchDelay <= 0 || b.SpanExportTimeout <= 0 || b.LogBatchDelay <= 0 || b.LogExportTimeout <= 0 ||
+		b.MetricExportInterval <= 0 || b.MetricExportTimeout <= 0 {
+		errs = append(errs, errors.New("batch delays, export intervals and export timeouts must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// HTTPClient tunes the transport of a service's outgoing HTTP calls
+type HTTPClient struct {
+	ClientMaxIdleConns        int           `env:"HTTP_CLIENT_MAX_IDLE_CONNS" flag:"http-client-max-idle-conns" default:"100" usage:"Idle connections kept across all hosts"`
+	ClientMaxIdleConnsPerHost int           `env:"HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST" flag:"http-client-max-idle-conns-per-host" default:"10" usage:"Idle connections kept per host"`
+	ClientMaxConnsPerHost     int           `env:"HTTP_CLIENT_MAX_CONNS_PER_HOST" flag:"http-client-max-conns-per-host" default:"0" usage:"Connections per host, idle or in use (0 is unlimited)"`
+	ClientIdleConnTimeout     time.Duration `env:"HTTP_CLIENT_IDLE_CONN_TIMEOUT" flag:"http-client-idle-conn-timeout" default:"90s" usage:"How long an idle connection is kept"`
+	ClientKeepAlives          bool          `env:"HTTP_CLIENT_KEEP_ALIVES" flag:"http-client-keep-alives" default:"true" usage:"Reuse connections between requests"`
+	ClientHTTP2               bool          `env:"HTTP_CLIENT_HTTP2" flag:"http-client-http2" default:"true" usage:"Negotiate HTTP/2 with TLS servers"`
+	ClientDialTimeout         time.Duration `env:"HTTP_CLIENT_DIAL_TIMEOUT" flag:"http-client-dial-timeout" default:"5s" usage:"Time limit for opening a TCP connection"`
+	ClientTLSHandshakeTimeout time.Duration `env:"HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT" flag:"http-client-tls-handshake-timeout" default:"5s" usage:"Time limit for the TLS handshake"`
+}
+
+// Validate checks the client limits; services call it from their own Validate
+func (c HTTPClient) Validate() error {
+	var errs []error
+	if c.ClientMaxIdleConns < 0 || c.ClientMaxIdleConnsPerHost < 0 || c.ClientMaxConnsPerHost < 0 {
+		errs = append(errs, errors.New("HTTP_CLIENT_MAX_IDLE_CONNS, HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST and HTTP_CLIENT_MAX_CONNS_PER_HOST must not be negative"))
+	}
+	if c.ClientIdleConnTimeout < 0 {
+		errs = append(errs, errors.New("HTTP_CLIENT_IDLE_CONN_TIMEOUT must not be negative"))
+	}
+	if c.ClientDialTimeout <= 0 || c.ClientTLSHandshakeTimeout <= 0 {
+		errs = append(errs, errors.New("HTTP_CLIENT_DIAL_TIMEOUT and HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Costing holds the synthetic request cost model of pkg/costing
+type Costing struct {
+	CostOperationRates string  `env:"COST_OPERATION_RATES" flag:"cost-operation-rates" default:"transfer=5,deposit=2,withdrawal=2,transaction_batch=1,balance_check=0.5,get_balance=0.5" usage:"Base cost units per operation, e.g. transfer=5,deposit=2"`
+	CostDefaultRate    float64 `env:"COST_DEFAULT_RATE" flag:"cost-default-rate" default:"0.1" usage:"Base cost units of operations without a rate"`
+	CostPerKB          float64 `env:"COST_PER_KB" flag:"cost-per-kb" default:"0.5" usage:"Cost units per KiB of request and response body"`
+}
+
+// Validate checks the rates; COST_OPERATION_RATES is parsed by pkg/costing
+func (c Costing) Validate() error {
+	if c.CostDefaultRate < 0 || c.CostPerKB < 0 {
+		return errors.New("COST_DEFAULT_RATE and COST_PER_KB must not be negative")
+	}
+	return nil
+}
+
+// Deploy holds the simulated deployments of pkg/deploy
+type Deploy struct {
+	DeployInterval       time.Duration `env:"DEPLOY_INTERVAL" flag:"deploy-interval" usage:"How often a simulated deployment rolls out a new version (0 disables)"`
+	DeployBadProbability float64       `env:"DEPLOY_BAD_PROBABILITY" flag:"deploy-bad-probability" default:"0.3" usage:"Chance that a deployment ships a latency and error regression"`
+	DeployBadLatency     time.Duration `env:"DEPLOY_BAD_LATENCY" flag:"deploy-bad-latency" default:"400ms" usage:"Latency a bad version adds to every request"`
+	DeployBadErrorRate   float64       `env:"DEPLOY_BAD_ERROR_RATE" flag:"deploy-bad-error-rate" default:"0.2" usage:"Fraction of requests a bad version fails with 500"`
+	DeployRollbackAfter  time.Duration `env:"DEPLOY_ROLLBACK_AFTER" flag:"deploy-rollback-after" default:"5m" usage:"Roll a bad version back after this long (0 keeps it until the next deployment)"`
+	DeployEventsURL      string        `env:"DEPLOY_EVENTS_URL" flag:"deploy-events-url" usage:"Endpoint announced deployments are POSTed to, e.g. the analyzer's /api/v1/deployments"`
+}
+
+// Validate checks the deployment profile; services call it from their own Validate
+func (d Deploy) Validate() error {
+	var errs []error
+	if d.DeployInterval < 0 || d.DeployBadLatency < 0 || d.DeployRollbackAfter < 0 {
+		errs = append(errs, errors.New("DEPLOY_INTERVAL, DEPLOY_BAD_LATENCY and DEPLOY_ROLLBACK_AFTER must not be negative"))
+	}
+	if d.DeployBadProbability < 0 || d.DeployBadProbability > 1 || d.DeployBadErrorRate < 0 || d.DeployBadErrorRate > 1 {
+		errs = append(errs, errors.New("DEPLOY_BAD_PROBABILITY and DEPLOY_BAD_ERROR_RATE must be between 0 and 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// Telemetry holds the OTLP export settings shared by every instrumented service
+type Telemetry struct {
+	OTLP
+	Output
+	Propagation
+	Batching
+	Scrubbing
+	Sampling
+	Logging
+
+	MetricViewBuckets        string `env:"METRIC_VIEW_BUCKETS" flag:"metric-view-buckets" usage:"Histogram buckets per instrument, e.g. name=0.01,0.1;other=1,5"`
+	MetricViewDropAttributes string `env:"METRIC_VIEW_DROP_ATTRIBUTES" flag:"metric-view-drop-attributes" usage:"Attributes to drop per instrument, e.g. *=user.id;name=key"`
+	MetricCardinalityLimit   int    `env:"METRIC_CARDINALITY_LIMIT" flag:"metric-cardinality-limit" default:"1000" usage:"Attribute sets per counter or histogram before new ones are recorded as otel.metric.overflow (0 disables)"`
+
+	TelemetryBufferSize       int     `env:"TELEMETRY_BUFFER_SIZE" flag:"telemetry-buffer-size" default:"1000" usage:"Spans and log records kept in memory for /debug/telemetry/recent (0 disables)"`
+	TelemetryBufferSampleRate float64 `env:"TELEMETRY_BUFFER_SAMPLE_RATE" flag:"telemetry-buffer-sample-rate" default:"1" usage:"Fraction of non-error spans and logs kept in the buffer"`
+
+	LatencyHeatmapMinutes int `env:"LATENCY_HEATMAP_MINUTES" flag:"latency-heatmap-minutes" default:"60" usage:"Minutes of per-minute latency histograms and error counts kept for /debug/latency-heatmap and /debug/export (0 disables)"`
+}
+
+// Logging sets how much the services log
+type Logging struct {
+	LogLevel string `env:"LOG_LEVEL" flag:"log-level" default:"info" usage:"Lowest level logged: trace, debug, info, warn or error; PUT /debug/loglevel changes it at runtime"`
+}
+
+// Validate checks the log level; services call it from their own Validate
+func (l Logging) Validate() error {
+	switch strings.ToLower(l.LogLevel) {
+	case "trace", "debug", "info", "warn", "warning", "error":
+		return nil
+	}
+	return fmt.Errorf("LOG_LEVEL must be trace, debug, info, warn or error, got %q", l.LogLevel)
+}
+
+// Sampling selects the traces that are recorded
+type Sampling struct {
+	TraceSampleRatio float64 `env:"TRACE_SAMPLE_RATIO" flag:"trace-sample-ratio" default:"1" usage:"Share of new traces sampled, by trace ID; traces continuing a caller's follow its decision"`
+	DebugTraceUsers  string  `env:"DEBUG_TRACE_USERS" flag:"debug-trace-users" usage:"Comma-separated user IDs whose requests are always sampled with debug detail, like X-Debug-Trace: 1"`
+}
+
+// Validate checks the sampling ratio; services call it from their own Validate
+func (s Sampling) Validate() error {
+	if s.TraceSampleRatio < 0 || s.TraceSampleRatio > 1 {
+		return errors.New("TRACE_SAMPLE_RATIO must be between 0 and 1")
+	}
+	return nil
+}
+
+// Scrubbing removes personal data from span and log attributes before export
+type Scrubbing struct {
+	ScrubHashAttributes   string  `env:"TELEMETRY_SCRUB_HASH" flag:"telemetry-scrub-hash" usage:"Comma-separated span and log attributes whose values are replaced by a keyed hash, e.g. user.id,user_id"`
+	ScrubDropAttributes   string  `env:"TELEMETRY_SCRUB_DROP" flag:"telemetry-scrub-drop" usage:"Comma-separated span and log attributes removed before export"`
+	ScrubAmountAttributes string  `env:"TELEMETRY_SCRUB_AMOUNT_ATTRIBUTES" flag:"telemetry-scrub-amount-attributes" default:"app.transaction.amount,payment.amount,amount" usage:"Numeric attributes removed when above TELEMETRY_SCRUB_AMOUNT_THRESHOLD"`
+	ScrubAmountThreshold  float64 `env:"TELEMETRY_SCRUB_AMOUNT_THRESHOLD" flag:"telemetry-scrub-amount-threshold" usage:"Remove amount attributes above this value (0 disables)"`
+	ScrubKey              string  `env:"TELEMETRY_SCRUB_KEY" flag:"telemetry-scrub-key" secret:"true" usage:"HMAC key of the scrubbing hash; without one a known value can be hashed and matched"`
+}
+
+// Dev holds switches for development-only features
+type Dev struct {
+	DevMode bool `env:"DEV_MODE" flag:"dev-mode" usage:"Enable development-only features such as X-Chaos-* fault injection and admin endpoints"`
+}
+
+// Simulation holds the switches that make simulator runs usable as training data
+type Simulation struct {
+	SimSeed       int64 `env:"SIM_SEED" flag:"seed" usage:"Seed the simulator's random decisions for a repeatable run (0 seeds from the clock)"`
+	SimLabelSpans bool  `env:"SIM_LABEL_SPANS" flag:"label-spans" usage:"Stamp every span with the simulated incident active when it started, as a ground-truth label"`
+}
+
+// Audit holds where the trail of simulator and admin actions is kept
+type Audit struct {
+	AuditLogFile string `env:"AUDIT_LOG_FILE" flag:"audit-log-file" usage:"Append audited actions (incidents, deployments, flag flips, admin calls, remediations) to this JSONL file (empty keeps them in memory only)"`
+	AuditLogKeep int    `env:"AUDIT_LOG_KEEP" flag:"audit-log-keep" default:"1000" usage:"Latest audited actions served by the audit endpoint"`
+}
+
+// Profiling holds the pprof and Pyroscope settings
+type Profiling struct {
+	PprofEnabled               bool   `env:"PPROF_ENABLED" flag:"pprof" usage:"Serve net/http/pprof on PPROF_ADDR"`
+	PprofAddr                  string `env:"PPROF_ADDR" flag:"pprof-addr" usage:"Listen address for pprof"`
+	PyroscopeServerAddress     string `env:"PYROSCOPE_SERVER_ADDRESS" flag:"pyroscope-server-address" usage:"Push continuous profiles to this Pyroscope server"`
+	PyroscopeBasicAuthUser     string `env:"PYROSCOPE_BASIC_AUTH_USER" flag:"pyroscope-basic-auth-user" usage:"Pyroscope basic auth user"`
+	PyroscopeBasicAuthPassword string `env:"PYROSCOPE_BASIC_AUTH_PASSWORD" flag:"pyroscope-basic-auth-password" secret:"true" usage:"Pyroscope basic auth password"`
+}
+
+// GRPC holds the debug settings of the gRPC servers built with pkg/grpcx
+type GRPC struct {
+	GRPCReflection bool `env:"GRPC_REFLECTION" flag:"grpc-reflection" default:"true" usage:"Serve the gRPC reflection API, so grpcurl can list and call the services without their .proto files"`
+	GRPCDebug      bool `env:"GRPC_DEBUG" flag:"grpc-debug" default:"false" usage:"Log every gRPC call with its full method, status code and duration"`
+}
+
+// Alerting holds the rule file and notification sinks for pkg/alerting
+type Alerting struct {
+	AlertRulesFile           string        `env:"ALERT_RULES_FILE" flag:"alert-rules-file" usage:"YAML file with threshold and burn-rate alert rules"`
+	AlertEvaluationInterval  time.Duration `env:"ALERT_EVALUATION_INTERVAL" flag:"alert-evaluation-interval" default:"15s" usage:"How often alert rules are evaluated"`
+	AlertRepeatInterval      time.Duration `env:"ALERT_REPEAT_INTERVAL" flag:"alert-repeat-interval" default:"1h" usage:"Re-send a still-firing alert after this long (0 sends once)"`
+	AlertRoutingFile         string        `env:"ALERT_ROUTING_FILE" flag:"alert-routing-file" usage:"YAML file routing alerts by service and severity to team sinks, with on-call overrides"`
+	AlertGroupWindow         time.Duration `env:"ALERT_GROUP_WINDOW" flag:"alert-group-window" usage:"Collapse related alerts starting within this long of each other into one digest (0 sends each alert)"`
+	AlertWebhookURL          string        `env:"ALERT_WEBHOOK_URL" flag:"alert-webhook-url" secret:"true" usage:"Generic webhook receiving alert JSON"`
+	AlertSlackWebhookURL     string        `env:"ALERT_SLACK_WEBHOOK_URL" flag:"alert-slack-webhook-url" secret:"true" usage:"Slack incoming webhook URL"`
+	AlertPagerDutyRoutingKey string        `env:"ALERT_PAGERDUTY_ROUTING_KEY" flag:"alert-pagerduty-routing-key" secret:"true" usage:"PagerDuty Events API v2 routing key"`
+}
+
+// Anomaly holds the baseline models of pkg/anomaly
+type Anomaly struct {
+	AnomalyModel        string        `env:"ANOMALY_MODEL" flag:"anomaly-model" default:"holt_winters" usage:"Baseline model: ewma or holt_winters"`
+	AnomalyAlpha        float64       `env:"ANOMALY_ALPHA" flag:"anomaly-alpha" default:"0.3" usage:"Level smoothing factor"`
+	AnomalyBeta         float64       `env:"ANOMALY_BETA" flag:"anomaly-beta" default:"0.01" usage:"Trend smoothing factor (holt_winters)"`
+	AnomalyGamma        float64       `env:"ANOMALY_GAMMA" flag:"anomaly-gamma" default:"0.3" usage:"Seasonal smoothing factor (holt_winters)"`
+	AnomalySeason       time.Duration `env:"ANOMALY_SEASON" flag:"anomaly-season" default:"24h" usage:"Seasonal period (holt_winters)"`
+	AnomalySeasonStep   time.Duration `env:"ANOMALY_SEASON_STEP" flag:"anomaly-season-step" default:"5m" usage:"Width of one seasonal slot (holt_winters)"`
+	AnomalyWarmup       int           `env:"ANOMALY_WARMUP" flag:"anomaly-warmup" default:"30" usage:"Samples a series needs before it is scored"`
+	AnomalyStateFile    string        `env:"ANOMALY_STATE_FILE" flag:"anomaly-state-file" usage:"Persist per-series model state here between restarts"`
+	AnomalySaveInterval time.Duration `env:"ANOMALY_SAVE_INTERVAL" flag:"anomaly-save-interval" default:"1m" usage:"How often the model state is written"`
+
+	AnomalyClassifyThreshold   float64       `env:"ANOMALY_CLASSIFY_THRESHOLD" flag:"anomaly-classify-threshold" default:"3" usage:"Z-score from which a signal counts as elevated when classifying incidents"`
+	AnomalyPoolSaturationLimit float64       `env:"ANOMALY_POOL_SATURATION_LIMIT" flag:"anomaly-pool-saturation-limit" default:"0.9" usage:"Pool saturation that counts as elevated whatever its z-score"`
+	AnomalySignalMaxAge        time.Duration `env:"ANOMALY_SIGNAL_MAX_AGE" flag:"anomaly-signal-max-age" default:"2m" usage:"Signals older than this are ignored when classifying"`
+	AnomalyClassifyInterval    time.Duration `env:"ANOMALY_CLASSIFY_INTERVAL" flag:"anomaly-classify-interval" default:"15s" usage:"How often joint signals are classified"`
+}
+
+// AnomalyTuning holds the feedback-driven sensitivity tuning of pkg/anomaly
+type AnomalyTuning struct {
+	AnomalyTuningFile      string  `env:"ANOMALY_TUNING_FILE" flag:"anomaly-tuning-file" default:"anomaly-tuning.json" usage:"Persist learned per-series sensitivities here"`
+	AnomalyTargetPrecision float64 `env:"ANOMALY_TARGET_PRECISION" flag:"anomaly-target-precision" default:"0.8" usage:"Share of true positives each series is tuned towards"`
+	AnomalyMinSensitivity  float64 `env:"ANOMALY_MIN_SENSITIVITY" flag:"anomaly-min-sensitivity" default:"0.5" usage:"Lowest learned sensitivity (rule thresholds at most doubled)"`
+	AnomalyMaxSensitivity  float64 `env:"ANOMALY_MAX_SENSITIVITY" flag:"anomaly-max-sensitivity" default:"1.5" usage:"Highest learned sensitivity"`
+}
+
+// Correlation holds the backends queried by pkg/correlation
+type Correlation struct {
+	TempoURL            string        `env:"TEMPO_URL" flag:"tempo-url" default:"http://localhost:3200" usage:"Tempo HTTP API used to find error traces"`
+	LokiURL             string        `env:"LOKI_URL" flag:"loki-url" default:"http://localhost:3100" usage:"Loki HTTP API used to find error logs"`
+	TelemetryBufferURLs []string      `env:"TELEMETRY_BUFFER_URLS" flag:"telemetry-buffer-urls" usage:"Service base URLs whose /debug/telemetry/recent is used when Tempo/Loki are not deployed"`
+	CorrelationLookback time.Duration `env:"CORRELATION_LOOKBACK" flag:"correlation-lookback" default:"5m" usage:"Evidence window opened before an anomaly starts"`
+}
@@ -0,0 +1,331 @@
+// Package config loads service configuration from struct tags.
+//
+// Each field declares where its value comes from:
+//
+//	OTLPEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"otlp-endpoint" default:"localhost:4318" usage:"OTLP collector host:port"`
+//
+// Precedence is flags > environment > .env file > YAML file > preset > defaults.
+// The YAML file is named by --config or CONFIG_FILE and uses the flag names with
+// '-' replaced by '_' as keys. The preset is named by --preset or SIM_PRESET (see
+// Presets). Fields tagged secret:"true" are redacted by Print.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Validator is implemented by config structs that check cross-field rules
+type Validator interface {
+	Validate() error
+}
+
+// field is one leaf of a config struct together with its tags
+type field struct {
+	value    reflect.Value
+	env      string
+	flag     string
+	def      string
+	usage    string
+	secret   bool
+	required bool
+}
+
+// Load fills cfg (a pointer to struct) from defaults, YAML, .env, environment and
+// args, then validates it. args is normally os.Args[1:].
+func Load(cfg interface{}, args []string) error {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Load requires a pointer to a struct")
+	}
+
+	fields := collect(rv.Elem())
+
+	// Defaults
+	for _, f := range fields {
+		if f.def == "" {
+			continue
+		}
+		if err := setValue(f.value, f.def); err != nil {
+			return fmt.Errorf("config: default for %s: %w", f.name(), err)
+		}
+	}
+
+	// Flags are parsed first so --config can name the YAML file, but applied last
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "Path to a YAML config file")
+	preset := fs.String("preset", "", "Settings preset: "+strings.Join(PresetNames(), ", "))
+	flagValues := make(map[string]*flagValue)
+	for _, f := range fields {
+		if f.flag != "" {
+			fv := &flagValue{s: f.def, isBool: f.value.Kind() == reflect.Bool}
+			flagValues[f.flag] = fv
+			fs.Var(fv, f.flag, f.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	// .env only fills variables that are not already set, so real env wins. It is
+	// read this early so it can name the preset; its values still apply after YAML.
+	_ = godotenv.Load()
+
+	// Preset
+	if *preset == "" {
+		*preset = os.Getenv("SIM_PRESET")
+	}
+	if *preset != "" {
+		if err := applyPreset(*preset, fields); err != nil {
+			return err
+		}
+	}
+
+	// YAML file
+	if *configFile != "" {
+		if err := loadYAML(*configFile, fields); err != nil {
+			return err
+		}
+	}
+
+	// Environment
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		if v, ok := os.LookupEnv(f.env); ok && v != "" {
+			if err := setValue(f.value, v); err != nil {
+				return fmt.Errorf("config: %s: %w", f.env, err)
+			}
+		}
+	}
+
+	// Explicitly set flags
+	var flagErr error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flag == fl.Name {
+				if err := setValue(f.value, flagValues[fl.Name].s); err != nil && flagErr == nil {
+					flagErr = fmt.Errorf("config: --%s: %w", fl.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return flagErr
+	}
+
+	return validate(cfg, fields)
+}
+
+// MustLoad is Load that exits the process on error
+func MustLoad(cfg interface{}) {
+	if err := Load(cfg, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// Print writes every field as name=value, redacting secrets
+func Print(w io.Writer, cfg interface{}) {
+	fields := collect(reflect.ValueOf(cfg).Elem())
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name() < fields[j].name() })
+
+	for _, f := range fields {
+		value := formatValue(f.value)
+		if f.secret && value != "" {
+			value = "[REDACTED]"
+		}
+		fmt.Fprintf(w, "  %s=%s\n", f.name(), value)
+	}
+}
+
+func validate(cfg interface{}, fields []*field) error {
+	var errs []error
+	for _, f := range fields {
+		if f.required && f.value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required", f.name()))
+		}
+	}
+	if v, ok := cfg.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config: invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func loadYAML(path string, fields []*field) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		raw, ok := values[strings.ReplaceAll(f.flag, "-", "_")]
+		if !ok {
+			continue
+		}
+		s := fmt.Sprint(raw)
+		if list, ok := raw.([]interface{}); ok {
+			parts := make([]string, len(list))
+			for i, item := range list {
+				parts[i] = fmt.Sprint(item)
+			}
+			s = strings.Join(parts, ",")
+		}
+		if err := setValue(f.value, s); err != nil {
+			return fmt.Errorf("config: %s in %s: %w", f.flag, path, err)
+		}
+	}
+	return nil
+}
+
+// collect walks v (including embedded and nested structs) and returns tagged leaves
+func collect(v reflect.Value) []*field {
+	var out []*field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) &&
+			sf.Tag.Get("env") == "" && sf.Tag.Get("flag") == "" {
+			out = append(out, collect(fv)...)
+			continue
+		}
+
+		if sf.Tag.Get("env") == "" && sf.Tag.Get("flag") == "" {
+			continue
+		}
+		out = append(out, &field{
+			value:    fv,
+			env:      sf.Tag.Get("env"),
+			flag:     sf.Tag.Get("flag"),
+			def:      sf.Tag.Get("default"),
+			usage:    sf.Tag.Get("usage"),
+			secret:   sf.Tag.Get("secret") == "true",
+			required: sf.Tag.Get("required") == "true",
+		})
+	}
+	return out
+}
+
+// flagValue records the raw flag string; bool fields accept a bare --flag
+type flagValue struct {
+	s      string
+	isBool bool
+}
+
+func (v *flagValue) String() string     { return v.s }
+func (v *flagValue) Set(s string) error { v.s = s; return nil }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
+
+func (f *field) name() string {
+	if f.env != "" {
+		return f.env
+	}
+	return f.flag
+}
+
+func setValue(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case []string:
+		var parts []string
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+		v.Set(reflect.ValueOf(parts))
+		return nil
+	case []float64:
+		var parts []float64
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, f)
+		}
+		v.Set(reflect.ValueOf(parts))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	switch x := v.Interface().(type) {
+	case time.Duration:
+		return x.String()
+	case []string:
+		return strings.Join(x, ",")
+	case []float64:
+		parts := make([]string, len(x))
+		for i, f := range x {
+			parts[i] = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
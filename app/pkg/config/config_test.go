@@ -0,0 +1,159 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Seed     int64         `env:"SIM_SEED" flag:"seed"`
+	Name     string        `env:"TEST_NAME" flag:"name" default:"service"`
+	Interval time.Duration `env:"TEST_INTERVAL" flag:"interval" default:"1s"`
+	Verbose  bool          `env:"TEST_VERBOSE" flag:"verbose"`
+	Hosts    []string      `env:"TEST_HOSTS" flag:"hosts"`
+	Token    string        `env:"TEST_TOKEN" flag:"token" secret:"true"`
+	Nested   struct {
+		Rate float64 `env:"TEST_RATE" flag:"rate" default:"0.5"`
+	}
+}
+
+func (c *testConfig) Validate() error {
+	if c.Interval <= 0 {
+		return errors.New("TEST_INTERVAL must be positive")
+	}
+	return nil
+}
+
+// inTempDir runs the test in an empty directory with only files, so no
+// real .env is read
+func inTempDir(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		preset string
+		yaml   string
+		dotenv string
+		env    string
+		flag   string
+		want   int64
+	}{
+		{name: "default", want: 0},
+		{name: "preset", preset: "training-data", want: 42},
+		{name: "yaml over preset", preset: "training-data", yaml: "seed: 7", want: 7},
+		{name: ".env over yaml", preset: "training-data", yaml: "seed: 7", dotenv: "SIM_SEED=8", want: 8},
+		{name: "environment over .env", preset: "training-data", yaml: "seed: 7", dotenv: "SIM_SEED=8", env: "9", want: 9},
+		{name: "flag over everything", preset: "training-data", yaml: "seed: 7", dotenv: "SIM_SEED=8", env: "9", flag: "10", want: 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{}
+			if tc.yaml != "" {
+				files["config.yaml"] = tc.yaml
+				t.Setenv("CONFIG_FILE", "config.yaml")
+			}
+			if tc.dotenv != "" {
+				files[".env"] = tc.dotenv
+			}
+			inTempDir(t, files)
+			t.Setenv("SIM_PRESET", tc.preset)
+			// .env sets variables for the whole process
+			seed, had := os.LookupEnv("SIM_SEED")
+			os.Unsetenv("SIM_SEED")
+			t.Cleanup(func() {
+				if os.Unsetenv("SIM_SEED"); had {
+					os.Setenv("SIM_SEED", seed)
+				}
+			})
+			if tc.env != "" {
+				os.Setenv("SIM_SEED", tc.env)
+			}
+			var args []string
+			if tc.flag != "" {
+				args = append(args, "--seed="+tc.flag)
+			}
+
+			var cfg testConfig
+			if err := Load(&cfg, args); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Seed != tc.want {
+				t.Errorf("seed = %d, want %d", cfg.Seed, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	inTempDir(t, map[string]string{"config.yaml": "hosts: [a, b]\nrate: 0.25\n"})
+	t.Setenv("TEST_INTERVAL", "250ms")
+
+	var cfg testConfig
+	if err := Load(&cfg, []string{"--config", "config.yaml", "--verbose", "--name", "core"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "core" || cfg.Interval != 250*time.Millisecond || !cfg.Verbose || cfg.Nested.Rate != 0.25 || !reflect.DeepEqual(cfg.Hosts, []string{"a", "b"}) {
+		t.Errorf("loaded %+v", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	inTempDir(t, nil)
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"bad environment value", map[string]string{"TEST_INTERVAL": "soon"}, nil, "TEST_INTERVAL"},
+		{"bad flag value", nil, []string{"--rate=high"}, "--rate"},
+		{"unknown flag", nil, []string{"--nope"}, "nope"},
+		{"unknown preset", map[string]string{"SIM_PRESET": "nope"}, nil, "unknown preset"},
+		{"missing config file", map[string]string{"CONFIG_FILE": "missing.yaml"}, nil, "missing.yaml"},
+		{"validation", nil, []string{"--interval=0s"}, "TEST_INTERVAL must be positive"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			var cfg testConfig
+			err := Load(&cfg, tc.args)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadRequired(t *testing.T) {
+	inTempDir(t, nil)
+	var cfg struct {
+		File string `env:"TEST_FILE" flag:"file" required:"true"`
+	}
+	if err := Load(&cfg, nil); err == nil || !strings.Contains(err.Error(), "TEST_FILE is required") {
+		t.Errorf("error = %v, want TEST_FILE is required", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := testConfig{Name: "core", Token: "hunter2"}
+	var b strings.Builder
+	Print(&b, &cfg)
+	out := b.String()
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, "TEST_TOKEN=[REDACTED]") || !strings.Contains(out, "TEST_NAME=core") {
+		t.Errorf("Print wrote\n%s", out)
+	}
+}
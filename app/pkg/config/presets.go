@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Presets bundle the settings of a kind of run so every service can be
+// switched at once with SIM_PRESET. Values are keyed by environment variable
+// and a service takes the ones it has fields for. They replace the defaults
+// only, so anything set in YAML, .env, the environment or flags still wins.
+var Presets = map[string]map[string]string{
+	// The defaults: occasional incidents of every kind
+	"demo": {},
+
+	// Repeatable runs for training and evaluating models: seeded simulators,
+	// spans labeled with the incident they ran under, the same incident cadence
+	// in every service and steady load without chaos headers
+	"training-data": {
+		"SIM_SEED":             "42",
+		"SIM_LABEL_SPANS":      "true",
+		"INCIDENT_INTERVAL":    "60s",
+		"INCIDENT_PROBABILITY": "0.3",
+		"DEPLOY_INTERVAL":      "10m",
+		"JOURNEY_CONCURRENCY":  "4",
+		"JOURNEY_INTERVAL":     "500ms",
+		"CHAOS_PROBABILITY":    "0",
+	},
+
+	// Frequent, overlapping incidents across services, bad deploys and chaos
+	// headers on a share of the load, so failures cascade through the call graph
+	"chaos": {
+		"DEV_MODE":                        "true",
+		"INCIDENT_INTERVAL":               "15s",
+		"INCIDENT_PROBABILITY":            "0.6",
+		"DB_PARTIAL_INCIDENT_PROBABILITY": "0.5",
+		"DEPLOY_INTERVAL":                 "3m",
+		"DEPLOY_BAD_PROBABILITY":          "0.6",
+		"CHAOS_PROBABILITY":               "0.1",
+		"CHAOS_FAIL":                      "503",
+	},
+
+	// Healthy baseline traffic: no incidents, deploys or chaos
+	"quiet": {
+		"INCIDENT_PROBABILITY": "0",
+		"DEPLOY_INTERVAL":      "0s",
+		"CHAOS_PROBABILITY":    "0",
+	},
+}
+
+// PresetNames returns the preset names, sorted
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func applyPreset(name string, fields []*field) error {
+	values, ok := Presets[name]
+	if !ok {
+		return fmt.Errorf("config: unknown preset %q, known presets: %s", name, strings.Join(PresetNames(), ", "))
+	}
+	for _, f := range fields {
+		v, ok := values[f.env]
+		if f.env == "" || !ok {
+			continue
+		}
+		if err := setValue(f.value, v); err != nil {
+			return fmt.Errorf("config: %s in preset %s: %w", f.env, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package contracttest keeps a provider service and its consumers in step
+// through recorded interactions. The provider's tests record, per request its
+// consumers depend on, the status and body it answers with and the schema of
+// that body (every field path and its JSON type), and later verify that fresh
+// answers still have that status and schema. The consumers' tests replay the
+// recorded answers against their own handlers, so a change on either side
+// that breaks the other fails a test instead of a deployment.
+package contracttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Interaction is one recorded request and the provider's answer to it
+type Interaction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	Status      int             `json:"status"`
+	// Schema maps every field path of the response body to its JSON type;
+	// array elements share the path of their array with [] appended
+	Schema map[string]string `json:"schema"`
+	// Response is the body as recorded, for consumers to replay
+	Response json.RawMessage `json:"response"`
+}
+
+// Record builds the interaction for the provider answering req at method
+// and path with status and body
+func Record(name, description, method, path string, req []byte, status int, body []byte) (Interaction, error) {
+	schema, err := Schema(body)
+	if err != nil {
+		return Interaction{}, fmt.Errorf("%s: %w", name, err)
+	}
+	in := Interaction{
+		Name:        name,
+		Description: description,
+		Method:      method,
+		Path:        path,
+		Status:      status,
+		Schema:      schema,
+		Response:    json.RawMessage(bytes.TrimSpace(body)),
+	}
+	if len(req) > 0 {
+		in.Request = json.RawMessage(req)
+	}
+	return in, nil
+}
+
+// Write stores in as <dir>/<name>.json
+func Write(dir string, in Interaction) error {
+	data, err := json.MarshalIndent(in, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, in.Name+".json"), append(data, '\n'), 0o644)
+}
+
+// Load reads every interaction in dir, ordered by name
+func Load(t testing.TB, dir string) []Interaction {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no recorded interactions in %s", dir)
+	}
+	sort.Strings(paths)
+
+	interactions := make([]Interaction, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var in Interaction
+		if err := json.Unmarshal(data, &in); err != nil {
+			t.Fatalf("parse %s: %v", path, err)
+		}
+		interactions = append(interactions, in)
+	}
+	return interactions
+}
+
+// Get returns the interaction called name
+func Get(t testing.TB, interactions []Interaction, name string) Interaction {
+	t.Helper()
+	for _, in := range interactions {
+		if in.Name == name {
+			return in
+		}
+	}
+	t.Fatalf("no recorded interaction %q; record it with -update", name)
+	return Interaction{}
+}
+
+// Verify fails t when status or the schema of body differ from the recording
+func Verify(t testing.TB, want Interaction, status int, body []byte) {
+	t.Helper()
+	if status != want.Status {
+		t.Errorf("%s: status = %d, recorded %d", want.Name, status, want.Status)
+	}
+	got, err := Schema(body)
+	if err != nil {
+		t.Errorf("%s: %v", want.Name, err)
+		return
+	}
+	for _, diff := range diffSchema(want.Schema, got) {
+		t.Errorf("%s: %s", want.Name, diff)
+	}
+}
+
+// Schema maps every field path of the JSON document body, "." for the
+// document itself, to its type: object, array, string, number, bool or null
+func Schema(body []byte) (map[string]string, error) {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("response is not JSON: %w", err)
+	}
+	schema := make(map[string]string)
+	walk(schema, "", doc)
+	return schema, nil
+}
+
+func walk(schema map[string]string, path string, v any) {
+	name := path
+	if name == "" {
+		name = "."
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		schema[name] = "object"
+		for key, child := range v {
+			walk(schema, strings.TrimPrefix(path+"."+key, "."), child)
+		}
+	case []any:
+		schema[name] = "array"
+		for _, child := range v {
+			walk(schema, path+"[]", child)
+		}
+	case string:
+		schema[name] = "string"
+	case float64:
+		schema[name] = "number"
+	case bool:
+		schema[name] = "bool"
+	default:
+		schema[name] = "null"
+	}
+}
+
+// diffSchema lists the fields missing from got, added to it, or of another type
+func diffSchema(want, got map[string]string) []string {
+	var diffs []string
+	for path, typ := range want {
+		switch g, ok := got[path]; {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("field %s (%s) is missing", path, typ))
+		case g != typ:
+			diffs = append(diffs, fmt.Sprintf("field %s is %s, recorded %s", path, g, typ))
+		}
+	}
+	for path, typ := range got {
+		if _, ok := want[path]; !ok {
+			diffs = append(diffs, fmt.Sprintf("field %s (%s) is new", path, typ))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
@@ -0,0 +1,41 @@
+package correlation
+
+import (
+	"context"
+	"time"
+
+	"incident-simulation/pkg/alerting"
+)
+
+// AlertSink runs a correlation whenever an alert starts firing, so it can be
+// registered next to the notification sinks of an alerting.Engine
+type AlertSink struct {
+	Correlator *Correlator
+	// Lookback is how far before the alert start the evidence window opens
+	Lookback time.Duration
+	// OnReport receives every finished report
+	OnReport func(ctx context.Context, n alerting.Notification, r Report)
+}
+
+func (s *AlertSink) Name() string { return "correlation" }
+
+func (s *AlertSink) Notify(ctx context.Context, n alerting.Notification) error {
+	if n.State != alerting.StateFiring {
+		return nil
+	}
+
+	end := time.Now()
+	report, err := s.Correlator.Correlate(ctx, Anomaly{
+		Series:     n.Series,
+		Start:      n.StartsAt.Add(-s.Lookback),
+		End:        end,
+		Attributes: n.Labels,
+	})
+	if err != nil {
+		return err
+	}
+	if s.OnReport != nil {
+		s.OnReport(ctx, n, report)
+	}
+	return nil
+}
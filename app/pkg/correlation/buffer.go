@@ -0,0 +1,104 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"incident-simulation/pkg/telemetry"
+)
+
+// BufferSource reads the in-memory telemetry buffers that each service exposes at
+// /debug/telemetry/recent, for setups without Tempo or Loki
+type BufferSource struct {
+	BaseURLs []string
+	Client   *http.Client
+}
+
+type recentResponse struct {
+	Service string                 `json:"service"`
+	Spans   []telemetry.RecentSpan `json:"spans"`
+	Logs    []telemetry.RecentLog  `json:"logs"`
+}
+
+func (b *BufferSource) fetch(ctx context.Context, start time.Time, errorsOnly bool) ([]recentResponse, error) {
+	params := url.Values{}
+	params.Set("since", start.UTC().Format(time.RFC3339))
+	if errorsOnly {
+		params.Set("errors_only", "true")
+	}
+
+	var out []recentResponse
+	var lastErr error
+	for _, base := range b.BaseURLs {
+		var resp recentResponse
+		if err := getJSON(ctx, b.Client, strings.TrimRight(base, "/")+"/debug/telemetry/recent?"+params.Encode(), &resp); err != nil {
+			lastErr = err
+			continue
+		}
+		out = append(out, resp)
+	}
+	if len(out) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return out, nil
+}
+
+// ErrorSpans returns buffered error spans whose attributes match attrs
+func (b *BufferSource) ErrorSpans(ctx context.Context, start, end time.Time, attrs map[string]string) ([]Span, error) {
+	results, err := b.fetch(ctx, start, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var spans []Span
+	for _, res := range results {
+	next:
+		for _, s := range res.Spans {
+			if s.Time.After(end) {
+				continue
+			}
+			for k, v := range attrs {
+				if s.Attributes[k] != v {
+					continue next
+				}
+			}
+			spans = append(spans, Span{
+				TraceID:    s.TraceID,
+				SpanID:     s.SpanID,
+				Service:    res.Service,
+				Operation:  s.Name,
+				Duration:   time.Duration(s.DurationMs * float64(time.Millisecond)),
+				Start:      s.Time,
+				Attributes: s.Attributes,
+			})
+		}
+	}
+	return spans, nil
+}
+
+// ErrorLogs returns buffered log records at ERROR severity or above
+func (b *BufferSource) ErrorLogs(ctx context.Context, start, end time.Time) ([]LogLine, error) {
+	results, err := b.fetch(ctx, start, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []LogLine
+	for _, res := range results {
+		for _, l := range res.Logs {
+			if l.Time.After(end) || !isErrorSeverity(l.Severity) {
+				continue
+			}
+			lines = append(lines, LogLine{Time: l.Time, Service: res.Service, Message: l.Body, TraceID: l.TraceID})
+		}
+	}
+	return lines, nil
+}
+
+func isErrorSeverity(s string) bool {
+	s = strings.ToUpper(s)
+	return strings.HasPrefix(s, "ERROR") || strings.HasPrefix(s, "FATAL") || strings.HasPrefix(s, "PANIC")
+}
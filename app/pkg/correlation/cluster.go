@@ -0,0 +1,68 @@
+package correlation
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LogCluster groups log lines that share a message template
+type LogCluster struct {
+	Template string   `json:"template"`
+	Count    int      `json:"count"`
+	Example  string   `json:"example"`
+	TraceIDs []string `json:"trace_ids,omitempty"`
+}
+
+// Variable parts of a message, most specific first
+var templatePatterns = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{16,}\b`), "<hex>"},
+	{regexp.MustCompile(`\b(txn|user)_[A-Za-z0-9_-]+`), "<$1>"},
+	{regexp.MustCompile(`"[^"]*"`), "<str>"},
+	{regexp.MustCompile(`\b\d+(\.\d+)?(ms|s|%)?\b`), "<num>"},
+}
+
+// Template reduces a message to its constant parts so similar errors group together
+func Template(msg string) string {
+	t := strings.TrimSpace(msg)
+	for _, p := range templatePatterns {
+		t = p.re.ReplaceAllString(t, p.placeholder)
+	}
+	return strings.Join(strings.Fields(t), " ")
+}
+
+// ClusterMessages groups lines by template and returns the largest n clusters
+func ClusterMessages(lines []LogLine, n int) []LogCluster {
+	byTemplate := make(map[string]*LogCluster)
+	for _, l := range lines {
+		t := Template(l.Message)
+		c, ok := byTemplate[t]
+		if !ok {
+			c = &LogCluster{Template: t, Example: l.Message}
+			byTemplate[t] = c
+		}
+		c.Count++
+		if l.TraceID != "" && len(c.TraceIDs) < 3 {
+			c.TraceIDs = append(c.TraceIDs, l.TraceID)
+		}
+	}
+
+	clusters := make([]LogCluster, 0, len(byTemplate))
+	for _, c := range byTemplate {
+		clusters = append(clusters, *c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Count != clusters[j].Count {
+			return clusters[i].Count > clusters[j].Count
+		}
+		return clusters[i].Template < clusters[j].Template
+	})
+	if n > 0 && len(clusters) > n {
+		clusters = clusters[:n]
+	}
+	return clusters
+}
@@ -0,0 +1,232 @@
+// Package correlation links a metric anomaly to the traces and logs recorded in
+// the same time window and ranks the components most likely to be the cause.
+//
+// Error spans are grouped by service and operation, error log lines are
+// clustered into message templates, and each component is scored by its share
+// of error spans plus its share of error logs. Every suspect carries exemplar
+// trace IDs and log clusters as supporting evidence. Given a Topology, a
+// component whose dependencies fail too has its score halved, since its
+// errors are more likely propagated from downstream than its own.
+package correlation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Anomaly is the metric signal that triggered correlation
+type Anomaly struct {
+	Series     string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+}
+
+// Span is an error span returned by a TraceSource
+type Span struct {
+	TraceID    string
+	SpanID     string
+	Service    string
+	Operation  string
+	Duration   time.Duration
+	Start      time.Time
+	Attributes map[string]string
+}
+
+// LogLine is an error log record returned by a LogSource
+type LogLine struct {
+	Time    time.Time
+	Service string
+	Message string
+	TraceID string
+}
+
+// TraceSource finds error spans in a time window, optionally filtered by attributes
+type TraceSource interface {
+	ErrorSpans(ctx context.Context, start, end time.Time, attrs map[string]string) ([]Span, error)
+}
+
+// LogSource finds error log lines in a time window
+type LogSource interface {
+	ErrorLogs(ctx context.Context, start, end time.Time) ([]LogLine, error)
+}
+
+// Topology tells the ranking which components call which
+type Topology interface {
+	// Dependencies returns the components that component calls
+	Dependencies(component string) []string
+}
+
+// Suspect is a component ranked by how much error evidence points at it
+type Suspect struct {
+	Component       string       `json:"component"`
+	Score           float64      `json:"score"`
+	ErrorSpans      int          `json:"error_spans"`
+	ErrorLogs       int          `json:"error_logs"`
+	Operations      []string     `json:"operations,omitempty"`
+	ExemplarTraces  []string     `json:"exemplar_traces,omitempty"`
+	LogClusters     []LogCluster `json:"log_clusters,omitempty"`
+	AvgSpanDuration float64      `json:"avg_span_duration_ms"`
+	// FailingDependencies are called components that are suspects themselves
+	FailingDependencies []string `json:"failing_dependencies,omitempty"`
+}
+
+// Report is the output of one correlation run
+type Report struct {
+	Anomaly    Anomaly   `json:"anomaly"`
+	Suspects   []Suspect `json:"suspects"`
+	TotalSpans int       `json:"total_error_spans"`
+	TotalLogs  int       `json:"total_error_logs"`
+	Warnings   []string  `json:"warnings,omitempty"`
+}
+
+// Correlator queries the configured sources; either may be nil
+type Correlator struct {
+	Traces TraceSource
+	Logs   LogSource
+	// MaxExemplars caps the trace IDs attached to each suspect
+	MaxExemplars int
+	// Topology, when set, discounts components whose dependencies fail too
+	Topology Topology
+}
+
+// Correlate gathers evidence for the anomaly window and ranks suspects
+func (c *Correlator) Correlate(ctx context.Context, a Anomaly) (Report, error) {
+	report := Report{Anomaly: a}
+	if c.Traces == nil && c.Logs == nil {
+		return report, errors.New("correlation: no trace or log source configured")
+	}
+
+	var spans []Span
+	if c.Traces != nil {
+		var err error
+		spans, err = c.Traces.ErrorSpans(ctx, a.Start, a.End, a.Attributes)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("trace query failed: %v", err))
+		}
+	}
+
+	var logs []LogLine
+	if c.Logs != nil {
+		var err error
+		logs, err = c.Logs.ErrorLogs(ctx, a.Start, a.End)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("log query failed: %v", err))
+		}
+	}
+
+	report.TotalSpans, report.TotalLogs = len(spans), len(logs)
+	report.Suspects = c.rank(spans, logs)
+	return report, nil
+}
+
+// rank scores each component by its share of error spans and error logs
+func (c *Correlator) rank(spans []Span, logs []LogLine) []Suspect {
+	maxExemplars := c.MaxExemplars
+	if maxExemplars <= 0 {
+		maxExemplars = 5
+	}
+
+	type acc struct {
+		suspect    Suspect
+		operations map[string]int
+		duration   time.Duration
+		traces     map[string]bool
+	}
+	byComponent := make(map[string]*acc)
+	get := func(name string) *acc {
+		if name == "" {
+			name = "unknown"
+		}
+		a, ok := byComponent[name]
+		if !ok {
+			a = &acc{
+				suspect:    Suspect{Component: name},
+				operations: make(map[string]int),
+				traces:     make(map[string]bool),
+			}
+			byComponent[name] = a
+		}
+		return a
+	}
+
+	for _, s := range spans {
+		a := get(s.Service)
+		a.suspect.ErrorSpans++
+		a.operations[s.Operation]++
+		a.duration += s.Duration
+		if len(a.suspect.ExemplarTraces) < maxExemplars && !a.traces[s.TraceID] {
+			a.traces[s.TraceID] = true
+			a.suspect.ExemplarTraces = append(a.suspect.ExemplarTraces, s.TraceID)
+		}
+	}
+
+	logsByComponent := make(map[string][]LogLine)
+	for _, l := range logs {
+		name := get(l.Service).suspect.Component
+		logsByComponent[name] = append(logsByComponent[name], l)
+	}
+
+	suspects := make([]Suspect, 0, len(byComponent))
+	for name, a := range byComponent {
+		s := a.suspect
+		s.ErrorLogs = len(logsByComponent[name])
+		s.LogClusters = ClusterMessages(logsByComponent[name], 3)
+		if s.ErrorSpans > 0 {
+			s.AvgSpanDuration = float64(a.duration.Milliseconds()) / float64(s.ErrorSpans)
+		}
+		s.Operations = topKeys(a.operations, 3)
+
+		if len(spans) > 0 {
+			s.Score += float64(s.ErrorSpans) / float64(len(spans))
+		}
+		if len(logs) > 0 {
+			s.Score += float64(s.ErrorLogs) / float64(len(logs))
+		}
+		suspects = append(suspects, s)
+	}
+
+	if c.Topology != nil {
+		for i := range suspects {
+			for _, dep := range c.Topology.Dependencies(suspects[i].Component) {
+				if _, failing := byComponent[dep]; failing && dep != suspects[i].Component {
+					suspects[i].FailingDependencies = append(suspects[i].FailingDependencies, dep)
+				}
+			}
+			if len(suspects[i].FailingDependencies) > 0 {
+				suspects[i].Score /= 2
+			}
+		}
+	}
+
+	sort.Slice(suspects, func(i, j int) bool {
+		if suspects[i].Score != suspects[j].Score {
+			return suspects[i].Score > suspects[j].Score
+		}
+		return suspects[i].Component < suspects[j].Component
+	})
+	return suspects
+}
+
+// topKeys returns up to n keys with the highest counts
+func topKeys(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
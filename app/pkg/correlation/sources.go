@@ -0,0 +1,197 @@
+package correlation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"incident-simulation/pkg/config"
+)
+
+// FromConfig returns a Correlator backed by the configured Tempo and Loki, or by
+// the services' in-memory buffers when TELEMETRY_BUFFER_URLS is set
+func FromConfig(cfg config.Correlation) *Correlator {
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	c := &Correlator{}
+	if len(cfg.TelemetryBufferURLs) > 0 {
+		buffer := &BufferSource{BaseURLs: cfg.TelemetryBufferURLs, Client: client}
+		c.Traces, c.Logs = buffer, buffer
+		return c
+	}
+	if cfg.TempoURL != "" {
+		c.Traces = &TempoSource{BaseURL: cfg.TempoURL, Client: client}
+	}
+	if cfg.LokiURL != "" {
+		c.Logs = &LokiSource{BaseURL: cfg.LokiURL, Client: client}
+	}
+	return c
+}
+
+// TempoSource searches Grafana Tempo with TraceQL for error spans
+type TempoSource struct {
+	BaseURL string
+	Client  *http.Client
+	Limit   int
+}
+
+type tempoSearchResponse struct {
+	Traces []struct {
+		TraceID         string `json:"traceID"`
+		RootServiceName string `json:"rootServiceName"`
+		SpanSets        []struct {
+			Spans []struct {
+				SpanID            string `json:"spanID"`
+				Name              string `json:"name"`
+				StartTimeUnixNano string `json:"startTimeUnixNano"`
+				DurationNanos     string `json:"durationNanos"`
+				Attributes        []struct {
+					Key   string `json:"key"`
+					Value struct {
+						StringValue string `json:"stringValue"`
+					} `json:"value"`
+				} `json:"attributes"`
+			} `json:"spans"`
+		} `json:"spanSets"`
+	} `json:"traces"`
+}
+
+// ErrorSpans runs { status = error && span.<k> = "<v>" ... } over the window
+func (t *TempoSource) ErrorSpans(ctx context.Context, start, end time.Time, attrs map[string]string) ([]Span, error) {
+	conds := []string{"status = error"}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		conds = append(conds, fmt.Sprintf("span.%s = %q", k, attrs[k]))
+	}
+	query := "{ " + strings.Join(conds, " && ") + " } | select(resource.service.name)"
+
+	limit := t.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(end.Unix()+1, 10))
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("spss", "10")
+
+	var resp tempoSearchResponse
+	if err := getJSON(ctx, t.Client, strings.TrimRight(t.BaseURL, "/")+"/api/search?"+params.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	var spans []Span
+	for _, tr := range resp.Traces {
+		for _, set := range tr.SpanSets {
+			for _, s := range set.Spans {
+				span := Span{
+					TraceID:    tr.TraceID,
+					SpanID:     s.SpanID,
+					Service:    tr.RootServiceName,
+					Operation:  s.Name,
+					Attributes: make(map[string]string),
+				}
+				if ns, err := strconv.ParseInt(s.DurationNanos, 10, 64); err == nil {
+					span.Duration = time.Duration(ns)
+				}
+				if ns, err := strconv.ParseInt(s.StartTimeUnixNano, 10, 64); err == nil {
+					span.Start = time.Unix(0, ns)
+				}
+				for _, a := range s.Attributes {
+					span.Attributes[a.Key] = a.Value.StringValue
+					if a.Key == "service.name" {
+						span.Service = a.Value.StringValue
+					}
+				}
+				spans = append(spans, span)
+			}
+		}
+	}
+	return spans, nil
+}
+
+// LokiSource queries Grafana Loki for log lines that look like errors
+type LokiSource struct {
+	BaseURL string
+	Client  *http.Client
+	Limit   int
+	// Query defaults to every service_name stream filtered for error/fail
+	Query string
+}
+
+type lokiQueryResponse struct {
+	Data struct {
+		Result []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// ErrorLogs runs the LogQL query over the window
+func (l *LokiSource) ErrorLogs(ctx context.Context, start, end time.Time) ([]LogLine, error) {
+	query := l.Query
+	if query == "" {
+		query = `{service_name=~".+"} |~ "(?i)(error|fail|timeout|refused|deadlock)"`
+	}
+	limit := l.Limit
+	if limit <= 0 {
+		limit = 500
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("direction", "backward")
+
+	var resp lokiQueryResponse
+	if err := getJSON(ctx, l.Client, strings.TrimRight(l.BaseURL, "/")+"/loki/api/v1/query_range?"+params.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	var lines []LogLine
+	for _, stream := range resp.Data.Result {
+		service := stream.Stream["service_name"]
+		for _, v := range stream.Values {
+			line := LogLine{Service: service, Message: v[1], TraceID: stream.Stream["trace_id"]}
+			if ns, err := strconv.ParseInt(v[0], 10, 64); err == nil {
+				line.Time = time.Unix(0, ns)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", req.URL.Path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,184 @@
+// Package costing gives every request a synthetic cost, the way an LLM API
+// bills usage: a base rate for the request's operation plus a charge per KiB
+// of request and response body.
+//
+// Costs are exported per tenant, taken from the X-Tenant-ID header, as the
+// request_cost_units histogram and the request_cost_units_total sum. A tenant
+// whose spend jumps, from more requests, pricier operations or bigger
+// payloads, shows up there even when the overall request rate looks normal.
+package costing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/config"
+)
+
+// HeaderTenant names the tenant a request is billed to
+const HeaderTenant = "X-Tenant-ID"
+
+// Tenants recorded for requests without a usable X-Tenant-ID
+const (
+	DefaultTenant = "default"
+	InvalidTenant = "invalid"
+)
+
+// OtherOperation is the operation of requests whose handler did not name one
+const OtherOperation = "other"
+
+// Tenant IDs are metric attributes, so anything but short slugs is refused
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Model prices requests
+type Model struct {
+	rates       map[string]float64
+	defaultRate float64
+	perKB       float64
+}
+
+// NewModel builds the model of cfg, failing on a malformed COST_OPERATION_RATES
+func NewModel(cfg config.Costing) (*Model, error) {
+	rates, err := parseRates(cfg.CostOperationRates)
+	if err != nil {
+		return nil, fmt.Errorf("COST_OPERATION_RATES: %w", err)
+	}
+	return &Model{rates: rates, defaultRate: cfg.CostDefaultRate, perKB: cfg.CostPerKB}, nil
+}
+
+// parseRates reads "op=rate,op=rate"
+func parseRates(s string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		op, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(op) == "" {
+			return nil, fmt.Errorf("%q is not operation=rate", entry)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("rate of %s must be a non-negative number", op)
+		}
+		rates[strings.TrimSpace(op)] = rate
+	}
+	return rates, nil
+}
+
+// Cost is the price of units of an operation moving bytes of request and
+// response body
+func (m *Model) Cost(operation string, units float64, bytes int64) float64 {
+	rate, ok := m.rates[operation]
+	if !ok {
+		rate = m.defaultRate
+	}
+	return rate*units + m.perKB*float64(bytes)/1024
+}
+
+type usageKey struct{}
+
+// usage is filled in by the handler while the middleware waits for it
+type usage struct {
+	operation string
+	units     float64
+}
+
+// SetOperation names the operation the current request is billed as.
+// units scale its base rate, e.g. the item count of a batch; pass 1 otherwise.
+func SetOperation(ctx context.Context, operation string, units float64) {
+	if u, ok := ctx.Value(usageKey{}).(*usage); ok {
+		u.operation, u.units = operation, units
+	}
+}
+
+// TenantOf returns the tenant r is billed to
+func TenantOf(r *http.Request) string {
+	tenant := r.Header.Get(HeaderTenant)
+	switch {
+	case tenant == "":
+		return DefaultTenant
+	case !tenantPattern.MatchString(tenant):
+		return InvalidTenant
+	}
+	return tenant
+}
+
+// Middleware prices every request once it has been served and records the
+// cost on the server span and in the per-tenant metrics. Handlers name their
+// operation with SetOperation; the others are billed as OtherOperation.
+func Middleware(service string, m *Model, next http.Handler) http.Handler {
+	meter := otel.Meter(service)
+	costs, _ := meter.Float64Histogram("request_cost_units",
+		metric.WithDescription("Synthetic cost of each request by tenant and operation"))
+	total, _ := meter.Float64Counter("request_cost_units_total",
+		metric.WithDescription("Synthetic cost of all requests by tenant and operation"))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := TenantOf(r)
+		u := &usage{operation: OtherOperation, units: 1}
+		ctx := context.WithValue(r.Context(), usageKey{}, u)
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+
+		cost := m.Cost(u.operation, u.units, body.n+cw.n)
+		trace.SpanFromContext(ctx).SetAttributes(
+			attrs.TenantID(tenant),
+			attrs.RequestCost(cost),
+		)
+		set := metric.WithAttributes(
+			attribute.String("tenant", tenant),
+			attribute.String("operation", u.operation),
+		)
+		costs.Record(ctx, cost, set)
+		total.Add(ctx, cost, set)
+	})
+}
+
+// countingReader counts the request body bytes the handler reads
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the response body bytes
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses working
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,165 @@
+// Package cron parses standard five-field cron expressions.
+//
+// A schedule is "minute hour day-of-month month day-of-week", each field a
+// "*", a value, a range ("1-5"), a step ("*/15", "0-30/10") or a comma list of
+// those. Day-of-week runs 0-6 from Sunday (7 is accepted as Sunday too). As in
+// Vixie cron, when both day fields are restricted a time matches if either
+// does. The macros @hourly, @daily (@midnight), @weekly, @monthly and @yearly
+// (@annually) are accepted as well.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64
+	// Whether the day fields were restricted, for the either-day rule
+	domStar, dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses a five-field expression or a macro
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if m, ok := macros[spec]; ok {
+		spec = m
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields, got %d", expr, len(parts))
+	}
+
+	s := &Schedule{expr: expr}
+	sets := [5]*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, part := range parts {
+		bits, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		*sets[i] = bits
+	}
+	// Sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(parts[2], "*")
+	s.dowStar = strings.HasPrefix(parts[4], "*")
+	return s, nil
+}
+
+func parseField(spec string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(spec, ",") {
+		rng, stepSpec, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepSpec)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loSpec, hiSpec, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(loSpec, f); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseValue(hiSpec, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to the end of the field every 15
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("%s: range %q runs backwards", f.name, rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(spec string, f field) (int, error) {
+	v, err := strconv.Atoi(spec)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %q is not between %d and %d", f.name, spec, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression as given to Parse
+func (s *Schedule) String() string { return s.expr }
+
+// Next returns the first matching minute after t, in t's location. It returns
+// the zero time for schedules that never match, such as "0 0 30 2 *".
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Five years covers every leap-day schedule
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,94 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{"* * * *", "want 5 fields, got 4"},
+		{"@often", "want 5 fields, got 1"},
+		{"60 * * * *", `minute: "60" is not between 0 and 59`},
+		{"* 24 * * *", "hour"},
+		{"* * 0 * *", "day of month"},
+		{"* * * 13 *", "month"},
+		{"* * * * 8", "day of week"},
+		{"*/0 * * * *", `invalid step "0"`},
+		{"*/x * * * *", `invalid step "x"`},
+		{"30-10 * * * *", `range "30-10" runs backwards`},
+		{"a * * * *", `"a" is not between`},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Parse(%q) = %v, want an error mentioning %q", tc.expr, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 1, 10, 10, 17, 30, 0, time.UTC)
+
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 10, 10, 25, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 1, 11, 2, 0, 0, 0, time.UTC)},
+		{"15 */6 * * *", time.Date(2024, 1, 10, 12, 15, 0, 0, time.UTC)},
+		{"0,45 9-17 * * *", time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{"30 6 * * 1", time.Date(2024, 1, 15, 6, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted: the 13th or a Friday
+		{"0 0 13 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			s, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(from); !got.Equal(tc.want) {
+				t.Errorf("Next(%v) = %v, want %v", from, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNextOnTheMinute(t *testing.T) {
+	s, err := Parse("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 10, 10, 0, 0, 0, time.UTC)
+	if got, want := s.Next(at), at.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v, strictly after", at, got, want)
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := Parse("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 1, 10, 1, 0, 0, 0, loc)
+	if got, want := s.Next(from), time.Date(2024, 1, 10, 2, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next(%v) = %v, want %v", from, got, want)
+	}
+}
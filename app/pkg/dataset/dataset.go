@@ -0,0 +1,201 @@
+// Package dataset turns the services' per-minute telemetry summaries (GET
+// /debug/export) into a feature matrix for offline model training, one row
+// per minute, labelled with the simulated incident active in that minute
+// according to the database service's incident history (GET /db/incidents).
+//
+// Every service contributes the columns <service>.requests,
+// <service>.error_rate (5xx responses over requests), one
+// <service>.errors.<counter> column per error counter it reported and the
+// mean, p50, p95 and p99 of each of its latency histograms as
+// <service>.<histogram>.<stat>. A service without data in a minute reads 0
+// there. The label columns come first: minute, incident_active,
+// incident_type ("none" outside incidents), incident_scope and incident_id.
+package dataset
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/telemetry"
+)
+
+// NoIncident is the incident_type of minutes outside incidents
+const NoIncident = "none"
+
+// Label columns, ahead of the features
+var labelColumns = []string{"minute", "incident_active", "incident_type", "incident_scope", "incident_id"}
+
+// errors5xx is the error breakdown key of 5xx responses
+const errors5xx = "http_server_responses_total{status_class=5xx}"
+
+// Incident is a record of the database service's incident history, as GET
+// /db/incidents and DB_INCIDENT_HISTORY_FILE hold it. EndedAt is nil while
+// the incident is active.
+type Incident struct {
+	ID        int64      `json:"id"`
+	Type      string     `json:"type"`
+	Scope     string     `json:"scope"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// Label is the ground truth of a minute
+type Label struct {
+	Active bool
+	Type   string
+	Scope  string
+	ID     int64
+}
+
+// Frame is the feature matrix: Values[i][j] is feature Features[j] in minute
+// Minutes[i]
+type Frame struct {
+	Minutes  []time.Time
+	Labels   []Label
+	Features []string
+	Values   [][]float64
+}
+
+// ReadSummaries reads the NDJSON of GET /debug/export
+func ReadSummaries(r io.Reader) ([]telemetry.MinuteSummary, error) {
+	var out []telemetry.MinuteSummary
+	dec := jsonx.NewDecoder(bufio.NewReader(r))
+	for {
+		var s telemetry.MinuteSummary
+		if err := dec.Decode(&s); errors.Is(err, io.EOF) {
+			return out, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("minute %d: %w", len(out)+1, err)
+		}
+		out = append(out, s)
+	}
+}
+
+// ReadIncidents reads a DB_INCIDENT_HISTORY_FILE, one JSON record per line
+func ReadIncidents(r io.Reader) ([]Incident, error) {
+	var out []Incident
+	dec := jsonx.NewDecoder(bufio.NewReader(r))
+	for {
+		var inc Incident
+		if err := dec.Decode(&inc); errors.Is(err, io.EOF) {
+			return out, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("incident %d: %w", len(out)+1, err)
+		}
+		out = append(out, inc)
+	}
+}
+
+// Build lays summaries out as a frame labelled from incidents. Partial
+// minutes are left out, and of a minute of a service read more than once the
+// last reading counts, so summaries of overlapping exports can simply be
+// concatenated.
+func Build(summaries []telemetry.MinuteSummary, incidents []Incident) *Frame {
+	type key struct {
+		service string
+		minute  time.Time
+	}
+	latest := map[key]telemetry.MinuteSummary{}
+	for _, s := range summaries {
+		if !s.Partial {
+			latest[key{s.Service, s.Minute.UTC()}] = s
+		}
+	}
+
+	minutes := map[time.Time]map[string]float64{}
+	features := map[string]bool{}
+	for k, s := range latest {
+		row := minutes[k.minute]
+		if row == nil {
+			row = map[string]float64{}
+			minutes[k.minute] = row
+		}
+		for name, v := range serviceFeatures(s) {
+			row[name] = v
+			features[name] = true
+		}
+	}
+
+	f := &Frame{Features: slices.Sorted(maps.Keys(features))}
+	for _, m := range slices.SortedFunc(maps.Keys(minutes), time.Time.Compare) {
+		values := make([]float64, len(f.Features))
+		for j, name := range f.Features {
+			values[j] = minutes[m][name]
+		}
+		f.Minutes = append(f.Minutes, m)
+		f.Labels = append(f.Labels, label(m, incidents))
+		f.Values = append(f.Values, values)
+	}
+	return f
+}
+
+// serviceFeatures are the columns of one service's minute
+func serviceFeatures(s telemetry.MinuteSummary) map[string]float64 {
+	out := map[string]float64{s.Service + ".requests": float64(s.Requests), s.Service + ".error_rate": 0}
+	if s.Requests > 0 {
+		out[s.Service+".error_rate"] = float64(s.Errors[errors5xx]) / float64(s.Requests)
+	}
+	for name, n := range s.Errors {
+		out[s.Service+".errors."+name] = float64(n)
+	}
+	for name, l := range s.Latency {
+		if l.Count == 0 {
+			continue
+		}
+		prefix := s.Service + "." + name
+		out[prefix+".mean"], out[prefix+".p50"], out[prefix+".p95"], out[prefix+".p99"] = l.Mean, l.P50, l.P95, l.P99
+	}
+	return out
+}
+
+// label is the incident active during minute m, the latest started when
+// several overlap it
+func label(m time.Time, incidents []Incident) Label {
+	var found *Incident
+	for i, inc := range incidents {
+		if !inc.StartedAt.Before(m.Add(time.Minute)) || (inc.EndedAt != nil && !inc.EndedAt.After(m)) {
+			continue
+		}
+		if found == nil || inc.StartedAt.After(found.StartedAt) {
+			found = &incidents[i]
+		}
+	}
+	if found == nil {
+		return Label{Type: NoIncident}
+	}
+	return Label{Active: true, Type: found.Type, Scope: found.Scope, ID: found.ID}
+}
+
+// Columns are the frame's column names, labels first
+func (f *Frame) Columns() []string {
+	return append(slices.Clone(labelColumns), f.Features...)
+}
+
+// WriteCSV writes the frame with a header row; minutes are RFC 3339
+func (f *Frame) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(f.Columns()); err != nil {
+		return err
+	}
+	record := make([]string, 0, len(labelColumns)+len(f.Features))
+	for i, m := range f.Minutes {
+		l := f.Labels[i]
+		record = append(record[:0], m.Format(time.RFC3339), strconv.FormatBool(l.Active), l.Type, l.Scope, strconv.FormatInt(l.ID, 10))
+		for _, v := range f.Values[i] {
+			record = append(record, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
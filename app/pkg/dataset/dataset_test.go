@@ -0,0 +1,118 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+func minute(i int) time.Time { return t0.Add(time.Duration(i) * time.Minute) }
+
+func testFrame(t *testing.T) *Frame {
+	t.Helper()
+	export := `{"service":"database-service","minute":"2026-10-15T12:00:00Z","requests":100,"errors":{},"latency":{"db_query_duration_seconds":{"count":100,"mean":0.01,"p50":0.008,"p95":0.02,"p99":0.03}}}
+{"service":"database-service","minute":"2026-10-15T12:01:00Z","requests":90,"errors":{"http_server_responses_total{status_class=5xx}":9},"latency":{}}
+{"service":"database-service","minute":"2026-10-15T12:01:00Z","requests":100,"errors":{"http_server_responses_total{status_class=5xx}":50,"db_errors_total{error_type=deadlock}":50},"latency":{}}
+{"service":"core-api-service","minute":"2026-10-15T12:01:00Z","requests":80,"errors":{},"latency":{}}
+{"service":"database-service","minute":"2026-10-15T12:02:00Z","partial":true,"requests":5,"errors":{},"latency":{}}
+`
+	summaries, err := ReadSummaries(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended := minute(1).Add(30 * time.Second)
+	history := `{"id":1,"type":"deadlock","scope":"all","started_at":"2026-10-15T12:01:10Z","ended_at":"` + ended.Format(time.RFC3339) + `","peak_error_rate":1}
+{"id":2,"type":"disk_full","scope":"operation=deposit","started_at":"2026-10-15T12:05:00Z"}
+`
+	incidents, err := ReadIncidents(strings.NewReader(history))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Build(summaries, incidents)
+}
+
+func TestBuild(t *testing.T) {
+	f := testFrame(t)
+	if !reflect.DeepEqual(f.Minutes, []time.Time{minute(0), minute(1)}) {
+		t.Fatalf("minutes %v, want the two complete ones", f.Minutes)
+	}
+	wantLabels := []Label{{Type: NoIncident}, {Active: true, Type: "deadlock", Scope: "all", ID: 1}}
+	if !reflect.DeepEqual(f.Labels, wantLabels) {
+		t.Errorf("labels %+v, want %+v", f.Labels, wantLabels)
+	}
+
+	value := func(i int, feature string) float64 {
+		for j, name := range f.Features {
+			if name == feature {
+				return f.Values[i][j]
+			}
+		}
+		t.Fatalf("no feature %s in %v", feature, f.Features)
+		return 0
+	}
+	for _, tc := range []struct {
+		minute  int
+		feature string
+		want    float64
+	}{
+		{0, "database-service.requests", 100},
+		{0, "database-service.db_query_duration_seconds.p95", 0.02},
+		{0, "core-api-service.requests", 0},
+		// The last reading of a minute counts
+		{1, "database-service.requests", 100},
+		{1, "database-service.error_rate", 0.5},
+		{1, "database-service.errors.db_errors_total{error_type=deadlock}", 50},
+		{1, "database-service.db_query_duration_seconds.p95", 0},
+		{1, "core-api-service.requests", 80},
+	} {
+		if v := value(tc.minute, tc.feature); v != tc.want {
+			t.Errorf("minute %d %s = %g, want %g", tc.minute, tc.feature, v, tc.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	f := testFrame(t)
+	var buf bytes.Buffer
+	if err := f.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || !reflect.DeepEqual(records[0], f.Columns()) {
+		t.Fatalf("csv %v, want a header and 2 rows", records)
+	}
+	if got := records[2][:5]; !reflect.DeepEqual(got, []string{"2026-10-15T12:01:00Z", "true", "deadlock", "all", "1"}) {
+		t.Errorf("labels of the second row %v", got)
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	f := testFrame(t)
+	var buf bytes.Buffer
+	if err := f.WriteParquet(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte(parquetMagic)) || !bytes.HasSuffix(data, []byte(parquetMagic)) {
+		t.Fatal("no PAR1 magic around the file")
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footer <= 0 || footer > len(data)-12 {
+		t.Fatalf("footer length %d of a %d byte file", footer, len(data))
+	}
+	meta := data[len(data)-8-footer : len(data)-8]
+	for _, name := range f.Columns() {
+		if !bytes.Contains(meta, []byte(name)) {
+			t.Errorf("column %s not in the footer", name)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// The frame is written as the simplest Parquet file readers take: one row
+// group, one uncompressed PLAIN data page per column, every column
+// required. The metadata is Thrift's compact protocol, written by hand like
+// dbproto writes protobuf, so no Parquet library is needed.
+
+// parquetMagic opens and closes a Parquet file
+const parquetMagic = "PAR1"
+
+// Parquet physical types
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+)
+
+// Parquet converted types, for readers older than logical types
+const (
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+)
+
+// Parquet enum values the writer uses
+const (
+	repetitionRequired = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+	pageData           = 0
+)
+
+// parquetColumn is one column, PLAIN encoded
+type parquetColumn struct {
+	name      string
+	physical  int32
+	converted int32 // -1 for none
+	data      bytes.Buffer
+}
+
+// WriteParquet writes the frame as a Parquet file: minute is a UTC
+// millisecond timestamp, incident_active a boolean, incident_id an int64,
+// the other labels strings and the features doubles
+func (f *Frame) WriteParquet(w io.Writer) error {
+	minute := &parquetColumn{name: labelColumns[0], physical: typeInt64, converted: convertedTimestampMillis}
+	active := &parquetColumn{name: labelColumns[1], physical: typeBoolean, converted: -1}
+	incidentType := &parquetColumn{name: labelColumns[2], physical: typeByteArray, converted: convertedUTF8}
+	scope := &parquetColumn{name: labelColumns[3], physical: typeByteArray, converted: convertedUTF8}
+	id := &parquetColumn{name: labelColumns[4], physical: typeInt64, converted: -1}
+	cols := []*parquetColumn{minute, active, incidentType, scope, id}
+	for _, name := range f.Features {
+		cols = append(cols, &parquetColumn{name: name, physical: typeDouble, converted: -1})
+	}
+
+	var bits []byte
+	for i, m := range f.Minutes {
+		l := f.Labels[i]
+		binary.Write(&minute.data, binary.LittleEndian, m.UnixMilli())
+		if i%8 == 0 {
+			bits = append(bits, 0)
+		}
+		if l.Active {
+			bits[i/8] |= 1 << (i % 8)
+		}
+		writeByteArray(&incidentType.data, l.Type)
+		writeByteArray(&scope.data, l.Scope)
+		binary.Write(&id.data, binary.LittleEndian, l.ID)
+		for j, v := range f.Values[i] {
+			binary.Write(&cols[len(labelColumns)+j].data, binary.LittleEndian, math.Float64bits(v))
+		}
+	}
+	active.data.Write(bits)
+	return writeParquet(w, cols, len(f.Minutes))
+}
+
+func writeByteArray(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.LittleEndian, uint32(len(s)))
+	b.WriteString(s)
+}
+
+// writeParquet writes cols of rows values each as one row group
+func writeParquet(w io.Writer, cols []*parquetColumn, rows int) error {
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+
+	// Column chunks: a page header and the page
+	type chunk struct{ offset, size int64 }
+	chunks := make([]chunk, len(cols))
+	var total int64
+	for i, col := range cols {
+		var header compactWriter
+		header.i32(1, pageData)
+		header.i32(2, int32(col.data.Len()))
+		header.i32(3, int32(col.data.Len()))
+		header.beginStruct(5)
+		header.i32(1, int32(rows))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.endStruct()
+		header.stop()
+
+		chunks[i] = chunk{offset: int64(file.Len()), size: int64(header.buf.Len() + col.data.Len())}
+		total += chunks[i].size
+		file.Write(header.buf.Bytes())
+		file.Write(col.data.Bytes())
+	}
+
+	// FileMetaData
+	var meta compactWriter
+	meta.i32(1, 1)
+	meta.beginList(2, compactStruct, len(cols)+1)
+	meta.beginElement()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(cols)))
+	meta.endElement()
+	for _, col := range cols {
+		meta.beginElement()
+		meta.i32(1, col.physical)
+		meta.i32(3, repetitionRequired)
+		meta.binary(4, col.name)
+		if col.converted >= 0 {
+			meta.i32(6, col.converted)
+		}
+		// The logical type, a union
+		switch col.converted {
+		case convertedUTF8:
+			meta.beginStruct(10)
+			meta.beginStruct(1) // STRING
+			meta.endStruct()
+			meta.endStruct()
+		case convertedTimestampMillis:
+			meta.beginStruct(10)
+			meta.beginStruct(8) // TIMESTAMP
+			meta.boolean(1, true)
+			meta.beginStruct(2)
+			meta.beginStruct(1) // MILLIS
+			meta.endStruct()
+			meta.endStruct()
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.endElement()
+	}
+	meta.i64(3, int64(rows))
+	meta.beginList(4, compactStruct, 1)
+	meta.beginElement()
+	meta.beginList(1, compactStruct, len(cols))
+	for i, col := range cols {
+		meta.beginElement()
+		meta.i64(2, chunks[i].offset)
+		meta.beginStruct(3)
+		meta.i32(1, col.physical)
+		meta.beginList(2, compactI32, 2)
+		meta.varint(encodingPlain)
+		meta.varint(encodingRLE)
+		meta.beginList(3, compactBinary, 1)
+		meta.bytes(col.name)
+		meta.i32(4, codecUncompressed)
+		meta.i64(5, int64(rows))
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.endStruct()
+		meta.endElement()
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(rows))
+	meta.endElement()
+	meta.binary(6, "incident-simulation datasetgen")
+	meta.stop()
+
+	file.Write(meta.buf.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(meta.buf.Len()))
+	file.WriteString(parquetMagic)
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// Thrift compact protocol field types
+const (
+	compactTrue   = 1
+	compactFalse  = 2
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter writes Thrift compact protocol structs. Field IDs are
+// deltas from the previous field of the same struct, so every nested struct
+// keeps its own last ID.
+type compactWriter struct {
+	buf  bytes.Buffer
+	last []int16
+	id   int16
+}
+
+func (c *compactWriter) field(id int16, typ byte) {
+	if delta := id - c.id; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		c.buf.WriteByte(typ)
+		c.varint(int64(id))
+	}
+	c.id = id
+}
+
+// varint writes v zigzag encoded, as i16, i32 and i64 are
+func (c *compactWriter) varint(v int64) {
+	c.buf.Write(binary.AppendUvarint(nil, uint64(v<<1^v>>63)))
+}
+
+func (c *compactWriter) bytes(s string) {
+	c.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	c.buf.WriteString(s)
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.field(id, compactI32)
+	c.varint(int64(v))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.field(id, compactI64)
+	c.varint(v)
+}
+
+func (c *compactWriter) binary(id int16, s string) {
+	c.field(id, compactBinary)
+	c.bytes(s)
+}
+
+// boolean fields carry their value in the type
+func (c *compactWriter) boolean(id int16, v bool) {
+	if v {
+		c.field(id, compactTrue)
+	} else {
+		c.field(id, compactFalse)
+	}
+}
+
+func (c *compactWriter) beginList(id int16, elem byte, n int) {
+	c.field(id, compactList)
+	if n < 15 {
+		c.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	c.buf.WriteByte(0xf0 | elem)
+	c.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (c *compactWriter) beginStruct(id int16) {
+	c.field(id, compactStruct)
+	c.beginElement()
+}
+
+func (c *compactWriter) endStruct() { c.endElement() }
+
+// beginElement starts a struct in a list, which has no field header
+func (c *compactWriter) beginElement() {
+	c.last = append(c.last, c.id)
+	c.id = 0
+}
+
+func (c *compactWriter) endElement() {
+	c.stop()
+	c.id = c.last[len(c.last)-1]
+	c.last = c.last[:len(c.last)-1]
+}
+
+// stop ends a struct
+func (c *compactWriter) stop() { c.buf.WriteByte(0) }
@@ -0,0 +1,267 @@
+// Package dbproto is the protobuf encoding of the database service's query
+// API, which the core API can use instead of JSON (DB_ENCODING). The messages
+// of query.proto are written and read with protowire, so no generated code is
+// needed, and decode to the same values as their JSON counterparts: the data
+// object travels as a google.protobuf.Struct, whose numbers are float64 just
+// like decoded JSON.
+//
+// Which encoding a call uses is negotiated over HTTP: the request body's
+// Content-Type says how it is encoded and its Accept header how the answer
+// should be. A service that only speaks JSON keeps answering JSON, so callers
+// must go by the response's Content-Type.
+package dbproto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Encodings, the values of the app.encoding.* span attributes
+const (
+	JSON     = "json"
+	Protobuf = "protobuf"
+)
+
+// Media types of the encodings
+const (
+	ContentType     = "application/x-protobuf"
+	JSONContentType = "application/json"
+)
+
+// Request is a QueryRequest
+type Request struct {
+	UserID    string
+	Amount    float64
+	Operation string
+	ToUserID  string
+}
+
+// Response is a QueryResponse
+type Response struct {
+	Status    string
+	Data      map[string]interface{}
+	Error     string
+	QueryTime float64
+	Timestamp int64
+	TraceID   string
+	ErrorID   string
+}
+
+// Encoding returns the encoding of a body of contentType, JSON unless it is
+// application/x-protobuf
+func Encoding(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == ContentType {
+		return Protobuf
+	}
+	return JSON
+}
+
+// MediaType returns the Content-Type of encoding
+func MediaType(encoding string) string {
+	if encoding == Protobuf {
+		return ContentType
+	}
+	return JSONContentType
+}
+
+// Negotiate returns the encoding an answer should use for an Accept header:
+// protobuf when application/x-protobuf is preferred over application/json,
+// JSON otherwise, and also when no header is sent
+func Negotiate(accept string) string {
+	protobufQ, jsonQ := -1.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case ContentType:
+			protobufQ = max(protobufQ, q)
+		case JSONContentType, "*/*", "application/*":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	if protobufQ > 0 && protobufQ >= jsonQ {
+		return Protobuf
+	}
+	return JSON
+}
+
+// MarshalRequest encodes r as a QueryRequest
+func MarshalRequest(r Request) []byte {
+	var b []byte
+	b = appendString(b, 1, r.UserID)
+	b = appendDouble(b, 2, r.Amount)
+	b = appendString(b, 3, r.Operation)
+	b = appendString(b, 4, r.ToUserID)
+	return b
+}
+
+// UnmarshalRequest decodes a QueryRequest
+func UnmarshalRequest(b []byte) (Request, error) {
+	var r Request
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeString(v, &r.UserID)
+		case num == 2 && typ == protowire.Fixed64Type:
+			return consumeDouble(v, &r.Amount)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(v, &r.Operation)
+		case num == 4 && typ == protowire.BytesType:
+			return consumeString(v, &r.ToUserID)
+		}
+		return protowire.ConsumeFieldValue(num, typ, v), nil
+	})
+	return r, err
+}
+
+// MarshalResponse encodes r as a QueryResponse; it fails when Data holds a
+// value JSON could not hold either
+func MarshalResponse(r Response) ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, r.Status)
+	if r.Data != nil {
+		data, err := structpb.NewStruct(r.Data)
+		if err != nil {
+			return nil, fmt.Errorf("encode data: %w", err)
+		}
+		encoded, err := proto.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("encode data: %w", err)
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, encoded)
+	}
+	b = appendString(b, 3, r.Error)
+	b = appendDouble(b, 4, r.QueryTime)
+	if r.Timestamp != 0 {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Timestamp))
+	}
+	b = appendString(b, 6, r.TraceID)
+	b = appendString(b, 7, r.ErrorID)
+	return b, nil
+}
+
+// UnmarshalResponse decodes a QueryResponse
+func UnmarshalResponse(b []byte) (Response, error) {
+	var r Response
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeString(v, &r.Status)
+		case num == 2 && typ == protowire.BytesType:
+			encoded, n := protowire.ConsumeBytes(v)
+			if n < 0 {
+				return n, nil
+			}
+			var data structpb.Struct
+			if err := proto.Unmarshal(encoded, &data); err != nil {
+				return 0, fmt.Errorf("decode data: %w", err)
+			}
+			r.Data = data.AsMap()
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(v, &r.Error)
+		case num == 4 && typ == protowire.Fixed64Type:
+			return consumeDouble(v, &r.QueryTime)
+		case num == 5 && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			r.Timestamp = int64(x)
+			return n, nil
+		case num == 6 && typ == protowire.BytesType:
+			return consumeString(v, &r.TraceID)
+		case num == 7 && typ == protowire.BytesType:
+			return consumeString(v, &r.ErrorID)
+		}
+		return protowire.ConsumeFieldValue(num, typ, v), nil
+	})
+	return r, err
+}
+
+// AsMap returns r as the map its JSON encoding decodes to, empty fields left
+// out where the JSON leaves them out
+func (r Response) AsMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"status":        r.Status,
+		"query_time_ms": r.QueryTime,
+		"timestamp":     float64(r.Timestamp),
+	}
+	if r.Data != nil {
+		m["data"] = r.Data
+	}
+	for key, v := range map[string]string{"error": r.Error, "trace_id": r.TraceID, "error_id": r.ErrorID} {
+		if v != "" {
+			m[key] = v
+		}
+	}
+	return m
+}
+
+// consumeFields calls field with the value bytes of every field in b, which
+// returns how many bytes the value took
+func consumeFields(b []byte, field func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if n > len(b) {
+			return errors.New("field runs past the end of the message")
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// Proto3 leaves out fields holding their zero value
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func consumeString(b []byte, v *string) (int, error) {
+	s, n := protowire.ConsumeString(b)
+	*v = s
+	return n, nil
+}
+
+func consumeDouble(b []byte, v *float64) (int, error) {
+	x, n := protowire.ConsumeFixed64(b)
+	*v = math.Float64frombits(x)
+	return n, nil
+}
@@ -0,0 +1,114 @@
+package dbproto
+
+import (
+	"reflect"
+	"testing"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+var (
+	request  = Request{UserID: "user_1", Amount: 25.5, Operation: "transfer", ToUserID: "user_2"}
+	response = Response{
+		Status:    "success",
+		Data:      map[string]interface{}{"user_id": "user_1", "balance": 1024.5, "affected_rows": 3, "currency": "USD"},
+		QueryTime: 12.75,
+		Timestamp: 1760486400,
+	}
+	// response as the database service's JSON answer
+	jsonResponse = struct {
+		Status    string      `json:"status"`
+		Data      interface{} `json:"data,omitempty"`
+		Error     string      `json:"error,omitempty"`
+		QueryTime float64     `json:"query_time_ms"`
+		Timestamp int64       `json:"timestamp"`
+	}{response.Status, response.Data, response.Error, response.QueryTime, response.Timestamp}
+	responseJSON = `{"status":"success","data":{"user_id":"user_1","balance":1024.5,"affected_rows":3,"currency":"USD"},"query_time_ms":12.75,"timestamp":1760486400}`
+)
+
+func TestRoundTrip(t *testing.T) {
+	if got, err := UnmarshalRequest(MarshalRequest(request)); err != nil || got != request {
+		t.Errorf("request read back as %+v, %v; want %+v", got, err, request)
+	}
+
+	encoded, err := MarshalResponse(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalResponse(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The core API sees the same answer whichever encoding it came in
+	var want map[string]interface{}
+	if err := jsonx.Unmarshal([]byte(responseJSON), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.AsMap(), want) {
+		t.Errorf("protobuf answer reads as %v, JSON as %v", got.AsMap(), want)
+	}
+
+	failed := Response{Status: "error", Error: "deadlock detected", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ErrorID: "err_1"}
+	encoded, _ = MarshalResponse(failed)
+	if got, err := UnmarshalResponse(encoded); err != nil || got.AsMap()["error_id"] != "err_1" || got.Data != nil {
+		t.Errorf("error answer read back as %+v, %v", got, err)
+	}
+
+	if _, err := UnmarshalRequest([]byte{0x0a, 0x10, 'u'}); err == nil {
+		t.Error("truncated request decoded")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                       JSON,
+		"application/json":       JSON,
+		"*/*":                    JSON,
+		"application/x-protobuf": Protobuf,
+		"application/x-protobuf, application/json;q=0.5": Protobuf,
+		"application/json, application/x-protobuf;q=0.5": JSON,
+		"application/x-protobuf;q=0":                     JSON,
+	} {
+		if got := Negotiate(accept); got != want {
+			t.Errorf("Negotiate(%q) = %s, want %s", accept, got, want)
+		}
+	}
+	if Encoding("application/x-protobuf; proto=QueryRequest") != Protobuf || Encoding("application/json; charset=utf-8") != JSON {
+		t.Error("Content-Type parameters changed the encoding")
+	}
+}
+
+// The encodings compared on the answer the core API reads most, a balance
+func BenchmarkEncoding(b *testing.B) {
+	b.Run("json/marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		var body []byte
+		for b.Loop() {
+			body, _ = jsonx.Marshal(jsonResponse)
+		}
+		b.ReportMetric(float64(len(body)), "body_bytes")
+	})
+	b.Run("protobuf/marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		var body []byte
+		for b.Loop() {
+			body, _ = MarshalResponse(response)
+		}
+		b.ReportMetric(float64(len(body)), "body_bytes")
+	})
+	encoded, _ := MarshalResponse(response)
+	b.Run("json/unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var v interface{}
+			jsonx.Unmarshal([]byte(responseJSON), &v)
+		}
+	})
+	b.Run("protobuf/unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			r, _ := UnmarshalResponse(encoded)
+			r.AsMap()
+		}
+	})
+}
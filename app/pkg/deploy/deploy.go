@@ -0,0 +1,368 @@
+// Package deploy simulates deployments of a service, so incidents can be
+// correlated with the release that caused them.
+//
+// Every DEPLOY_INTERVAL the running version is bumped. With
+// DEPLOY_BAD_PROBABILITY the new version is bad: it adds DEPLOY_BAD_LATENCY to
+// every request and fails DEPLOY_BAD_ERROR_RATE of them, until the next
+// deployment or a rollback DEPLOY_ROLLBACK_AFTER later. Each rollout and
+// rollback is announced as a Deploy span, the deployments_total counter and a
+// JSON Event POSTed to DEPLOY_EVENTS_URL.
+//
+// The OTel resource is fixed when the SDK starts, so the version a deployment
+// rolls out goes on every span as service.version through SpanProcessor and
+// on the service_deployment_info gauge instead; service.version on the
+// resource stays the version the process started with.
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/simrand"
+)
+
+// Kinds of Event
+const (
+	KindDeploy   = "deploy"
+	KindRollback = "rollback"
+)
+
+// Event announces one rollout or rollback
+type Event struct {
+	Service         string    `json:"service"`
+	Kind            string    `json:"kind"`
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previous_version"`
+	Bad             bool      `json:"bad"`
+	Time            time.Time `json:"time"`
+}
+
+// Simulator rolls out versions of one service and applies the profile of the
+// running one to its requests
+type Simulator struct {
+	service string
+	cfg     config.Deploy
+	client  *http.Client
+	// announced is called after every rollout and rollback, e.g. to log it
+	announced func(context.Context, Event)
+
+	mu       sync.RWMutex
+	version  string
+	bad      bool
+	previous string
+	// rollback cancels the pending rollback of a bad version
+	rollback *time.Timer
+
+	deployments metric.Int64Counter
+	regressions metric.Int64Counter
+}
+
+// New starts service at the version of pkg/buildinfo; announced may be nil
+func New(service string, cfg config.Deploy, client *http.Client, announced func(context.Context, Event)) *Simulator {
+	return &Simulator{
+		service:   service,
+		cfg:       cfg,
+		client:    client,
+		announced: announced,
+		version:   buildinfo.Get(service).Version,
+	}
+}
+
+// Current returns the running version and whether it is bad
+func (s *Simulator) Current() (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version, s.bad
+}
+
+// RegisterMetrics exports deployments_total, deploy_regression_requests_total
+// and service_deployment_info, 1 for the running version
+func (s *Simulator) RegisterMetrics() error {
+	meter := otel.Meter(s.service)
+
+	var err error
+	s.deployments, err = meter.Int64Counter("deployments_total",
+		metric.WithDescription("Simulated rollouts and rollbacks, by kind and whether the version is bad"))
+	if err != nil {
+		return err
+	}
+	s.regressions, err = meter.Int64Counter("deploy_regression_requests_total",
+		metric.WithDescription("Requests slowed or failed by a bad version, by outcome"))
+	if err != nil {
+		return err
+	}
+	info, err := meter.Int64ObservableGauge("service_deployment_info",
+		metric.WithDescription("Version the simulated deployments are running; always 1"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		version, bad := s.Current()
+		o.ObserveInt64(info, 1, metric.WithAttributes(
+			attribute.String("version", version),
+			attribute.Bool("bad", bad),
+		))
+		return nil
+	}, info)
+	return err
+}
+
+// Run deploys a new version every DEPLOY_INTERVAL until ctx is done
+func (s *Simulator) Run(ctx context.Context) {
+	if s.cfg.DeployInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.DeployInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Deploy(ctx, simrand.Float64() < s.cfg.DeployBadProbability)
+		}
+	}
+}
+
+// Deploy rolls out the next version, bad or not, and announces it. A bad
+// version is rolled back after DEPLOY_ROLLBACK_AFTER unless another deployment
+// replaces it first.
+func (s *Simulator) Deploy(ctx context.Context, bad bool) Event {
+	s.mu.Lock()
+	if s.rollback != nil {
+		s.rollback.Stop()
+		s.rollback = nil
+	}
+	e := Event{
+		Service:         s.service,
+		Kind:            KindDeploy,
+		Version:         nextVersion(s.version),
+		PreviousVersion: s.version,
+		Bad:             bad,
+		Time:            time.Now().UTC(),
+	}
+	s.previous, s.version, s.bad = s.version, e.Version, bad
+	if bad && s.cfg.DeployRollbackAfter > 0 {
+		s.rollback = time.AfterFunc(s.cfg.DeployRollbackAfter, func() { s.Rollback(context.Background()) })
+	}
+	s.mu.Unlock()
+
+	s.announce(ctx, e)
+	return e
+}
+
+// Rollback returns to the version before the running one. It reports false
+// when there is nothing to roll back to.
+func (s *Simulator) Rollback(ctx context.Context) (Event, bool) {
+	s.mu.Lock()
+	if s.previous == "" {
+		s.mu.Unlock()
+		return Event{}, false
+	}
+	if s.rollback != nil {
+		s.rollback.Stop()
+		s.rollback = nil
+	}
+	e := Event{
+		Service:         s.service,
+		Kind:            KindRollback,
+		Version:         s.previous,
+		PreviousVersion: s.version,
+		Time:            time.Now().UTC(),
+	}
+	s.version, s.bad, s.previous = s.previous, false, ""
+	s.mu.Unlock()
+
+	s.announce(ctx, e)
+	return e, true
+}
+
+// announce records e as its own Deploy trace and sends it to DEPLOY_EVENTS_URL
+func (s *Simulator) announce(ctx context.Context, e Event) {
+	ctx, span := otel.Tracer(s.service).Start(ctx, "Deploy", trace.WithNewRoot())
+	defer span.End()
+
+	set := []attribute.KeyValue{
+		attrs.DeployKind(e.Kind),
+		attrs.DeployVersion(e.Version),
+		attrs.DeployPreviousVersion(e.PreviousVersion),
+		attrs.DeployBad(e.Bad),
+	}
+	span.SetAttributes(set...)
+	span.AddEvent("deployment."+e.Kind, trace.WithAttributes(set...))
+	if s.deployments != nil {
+		s.deployments.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("kind", e.Kind),
+			attribute.Bool("bad", e.Bad),
+		))
+	}
+	if s.announced != nil {
+		s.announced(ctx, e)
+	}
+
+	if s.cfg.DeployEventsURL == "" {
+		return
+	}
+	if err := s.post(ctx, e); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "deployment event not delivered")
+		log.Printf("Failed to send deployment event to %s: %v", s.cfg.DeployEventsURL, err)
+	}
+}
+
+func (s *Simulator) post(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.DeployEventsURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// nextVersion bumps the patch of a major.minor.patch version and appends a
+// deploy counter to anything else
+func nextVersion(v string) string {
+	parts := strings.Split(v, ".")
+	if len(parts) == 3 {
+		if patch, err := strconv.Atoi(parts[2]); err == nil {
+			parts[2] = strconv.Itoa(patch + 1)
+			return strings.Join(parts, ".")
+		}
+	}
+	base, n, _ := strings.Cut(v, "+deploy.")
+	count, _ := strconv.Atoi(n)
+	return fmt.Sprintf("%s+deploy.%d", base, count+1)
+}
+
+// Middleware applies the profile of the running version: a bad one delays
+// every request by DEPLOY_BAD_LATENCY and fails DEPLOY_BAD_ERROR_RATE of them
+// with 500.
+func (s *Simulator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, bad := s.Current()
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attrs.DeployBad(bad))
+		if !bad {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.cfg.DeployBadLatency > 0 {
+			select {
+			case <-time.After(s.cfg.DeployBadLatency):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if simrand.Float64() < s.cfg.DeployBadErrorRate {
+			s.countRegression(ctx, version, "failed")
+			span.SetStatus(codes.Error, "regression in version "+version)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status": "error",
+				"error":  fmt.Sprintf("internal error in %s %s", s.service, version),
+			})
+			return
+		}
+		s.countRegression(ctx, version, "slowed")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Simulator) countRegression(ctx context.Context, version, outcome string) {
+	if s.regressions != nil {
+		s.regressions.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("version", version),
+			attribute.String("outcome", outcome),
+		))
+	}
+}
+
+// Register adds GET /deploy, the running version, and in dev mode
+// POST /deploy ({"bad": true} ships a regression) and POST /deploy/rollback
+func (s *Simulator) Register(mux *http.ServeMux, dev bool) {
+	mux.HandleFunc("GET /deploy", func(w http.ResponseWriter, r *http.Request) {
+		version, bad := s.Current()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"service": s.service, "version": version, "bad": bad})
+	})
+	if !dev {
+		return
+	}
+	mux.HandleFunc("POST /deploy", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Bad bool `json:"bad"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "error": "invalid request body"})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, s.Deploy(r.Context(), req.Bad))
+	})
+	mux.HandleFunc("POST /deploy/rollback", func(w http.ResponseWriter, r *http.Request) {
+		e, ok := s.Rollback(r.Context())
+		if !ok {
+			writeJSON(w, http.StatusConflict, map[string]string{"status": "error", "error": "no previous version to roll back to"})
+			return
+		}
+		writeJSON(w, http.StatusOK, e)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// SpanProcessor stamps every span with the running version as service.version
+func (s *Simulator) SpanProcessor() sdktrace.SpanProcessor {
+	return versionStamper{s}
+}
+
+type versionStamper struct{ s *Simulator }
+
+func (v versionStamper) OnStart(_ context.Context, span sdktrace.ReadWriteSpan) {
+	version, _ := v.s.Current()
+	span.SetAttributes(semconv.ServiceVersion(version))
+}
+
+func (versionStamper) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (versionStamper) Shutdown(context.Context) error   { return nil }
+func (versionStamper) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,64 @@
+// Package grpcx builds the gRPC servers of the services so they can be poked
+// with grpcurl: each serves the reflection API, and with GRPC_DEBUG logs every
+// call it answers.
+package grpcx
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/logx"
+)
+
+// NewServer returns a gRPC server with opts that serves the reflection API
+// when cfg.GRPCReflection is set and logs each call when cfg.GRPCDebug is.
+// Reflection lists whatever services are registered by the time it is asked,
+// so they may be registered after NewServer.
+func NewServer(cfg config.GRPC, opts ...grpc.ServerOption) *grpc.Server {
+	if cfg.GRPCDebug {
+		opts = append(opts, grpc.ChainUnaryInterceptor(debugUnary), grpc.ChainStreamInterceptor(debugStream))
+	}
+	server := grpc.NewServer(opts...)
+	if cfg.GRPCReflection {
+		reflection.Register(server)
+	}
+	return server
+}
+
+func debugUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func debugStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+// logCall logs a finished call with the attribute names of the OpenTelemetry
+// RPC conventions
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	kv := []interface{}{
+		"rpc.method", method,
+		"rpc.grpc.status_code", status.Code(err).String(),
+		"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		kv = append(kv, "client.address", p.Addr.String())
+	}
+	if err != nil {
+		logx.Warnw(ctx, "🔌 gRPC call failed", append(kv, "error", err)...)
+		return
+	}
+	logx.Infow(ctx, "🔌 gRPC call", kv...)
+}
@@ -0,0 +1,66 @@
+package grpcx
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"incident-simulation/pkg/config"
+)
+
+// listServices asks a server built from cfg for its services the way
+// grpcurl list does
+func listServices(t *testing.T, cfg config.GRPC) ([]string, error) {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	server := NewServer(cfg)
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_ListServices{}}); err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		names = append(names, s.GetName())
+	}
+	return names, nil
+}
+
+func TestReflection(t *testing.T) {
+	names, err := listServices(t, config.GRPC{GRPCReflection: true, GRPCDebug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(names, "grpc.reflection.v1.ServerReflection") {
+		t.Errorf("services %v, want the reflection API listed", names)
+	}
+
+	if _, err := listServices(t, config.GRPC{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("without GRPC_REFLECTION listing answered %v, want Unimplemented", err)
+	}
+}
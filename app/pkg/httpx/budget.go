@@ -0,0 +1,54 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderBudget carries the milliseconds a caller still waits for the answer,
+// so a service can drop work its caller would give up on anyway
+const HeaderBudget = "X-Request-Budget-Ms"
+
+// budgetKey holds the deadline a caller's budget sets
+type budgetKey struct{}
+
+// ForwardBudget sets HeaderBudget on an outgoing request from the deadline of
+// ctx and returns the budget sent; without a deadline it sends nothing
+func ForwardBudget(ctx context.Context, req *http.Request) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	remaining := max(time.Until(deadline), 0)
+	req.Header.Set(HeaderBudget, strconv.FormatInt(remaining.Milliseconds(), 10))
+	return remaining, true
+}
+
+// Budget bounds a request to the budget its caller sent in HeaderBudget, so
+// waits made with the request context stop when the caller stops waiting.
+// Requests without a valid header run as before.
+func Budget(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms, err := strconv.ParseInt(r.Header.Get(HeaderBudget), 10, 64)
+		if err != nil || ms < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		deadline := time.Now().Add(time.Duration(ms) * time.Millisecond)
+		ctx, cancel := context.WithDeadline(context.WithValue(r.Context(), budgetKey{}, deadline), deadline)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// BudgetLeft returns how much of the caller's budget is left, when the
+// caller sent one
+func BudgetLeft(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Value(budgetKey{}).(time.Time)
+	if !ok {
+		return 0, false
+	}
+	return max(time.Until(deadline), 0), true
+}
@@ -0,0 +1,65 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StatusClientClosedRequest is nginx's non-standard status for a request the
+// caller gave up on before the response was ready
+const StatusClientClosedRequest = 499
+
+// Why a request's context ended, as recorded in error_type metric attributes
+// and the span's error.type
+const (
+	CancelReasonCanceled = "context_canceled"
+	CancelReasonDeadline = "deadline_exceeded"
+)
+
+// CancelReason tells a caller that went away (CancelReasonCanceled) from a
+// deadline that passed (CancelReasonDeadline); it returns "" for errors that
+// are neither
+func CancelReason(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CancelReasonDeadline
+	case errors.Is(err, context.Canceled):
+		return CancelReasonCanceled
+	}
+	return ""
+}
+
+// CancelStatus is the response status for a cancel reason: 499 when the
+// caller went away, 504 when the deadline passed
+func CancelStatus(reason string) int {
+	if reason == CancelReasonDeadline {
+		return http.StatusGatewayTimeout
+	}
+	return StatusClientClosedRequest
+}
+
+// RecordCancel marks span as ended by reason
+func RecordCancel(span trace.Span, reason string) {
+	span.SetAttributes(semconv.ErrorTypeKey.String(reason))
+	if reason == CancelReasonDeadline {
+		span.SetStatus(codes.Error, "request deadline exceeded")
+	} else {
+		span.SetStatus(codes.Error, "request canceled by the caller")
+	}
+}
+
+// Deadline bounds every request to timeout, so downstream calls made with the
+// request context are abandoned once the caller's answer is overdue
+func Deadline(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
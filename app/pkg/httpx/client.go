@@ -0,0 +1,99 @@
+package httpx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/config"
+)
+
+// NewTransport builds the transport for a service's outgoing calls from cfg
+// and reports its connection pool: http_client_open_connections per host,
+// http_client_connections_total by whether the request reused a pooled
+// connection, and http_client_dial_duration_seconds for new ones. Connection
+// churn (keep-alives off, a server closing every connection) shows up as
+// reused=false climbing with dial time. Wrap it with otelhttp.NewTransport so
+// the client span records the reuse too.
+func NewTransport(service string, cfg config.HTTPClient) http.RoundTripper {
+	meter := otel.Meter(service)
+	open, _ := meter.Int64UpDownCounter("http_client_open_connections",
+		metric.WithDescription("Connections the HTTP client holds open, idle or in use"))
+	conns, _ := meter.Int64Counter("http_client_connections_total",
+		metric.WithDescription("Outgoing requests by whether they reused a pooled connection"))
+	dial, _ := meter.Float64Histogram("http_client_dial_duration_seconds",
+		metric.WithDescription("Time to open a new connection in seconds"))
+
+	dialer := &net.Dialer{Timeout: cfg.ClientDialTimeout, KeepAlive: 30 * time.Second}
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.ClientHTTP2)
+
+	base := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host := metric.WithAttributes(attribute.String("host", addr))
+			start := time.Now()
+			conn, err := dialer.DialContext(ctx, network, addr)
+			dial.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+				attribute.String("host", addr),
+				attribute.Bool("error", err != nil),
+			))
+			if err != nil {
+				return nil, err
+			}
+			open.Add(ctx, 1, host)
+			return &trackedConn{Conn: conn, closed: func() { open.Add(context.Background(), -1, host) }}, nil
+		},
+		Protocols:             protocols,
+		MaxIdleConns:          cfg.ClientMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.ClientMaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.ClientMaxConnsPerHost,
+		IdleConnTimeout:       cfg.ClientIdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.ClientTLSHandshakeTimeout,
+		DisableKeepAlives:     !cfg.ClientKeepAlives,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &clientTransport{base: base, conns: conns}
+}
+
+// clientTransport records, per request, whether a pooled connection was reused
+type clientTransport struct {
+	base  http.RoundTripper
+	conns metric.Int64Counter
+}
+
+func (t *clientTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	hooks := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace.SpanFromContext(ctx).SetAttributes(attrs.HTTPConnectionReused(info.Reused))
+			t.conns.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("host", r.URL.Host),
+				attribute.Bool("reused", info.Reused),
+			))
+		},
+	}
+	return t.base.RoundTrip(r.WithContext(httptrace.WithClientTrace(ctx, hooks)))
+}
+
+// trackedConn reports its close once, however often Close is called
+type trackedConn struct {
+	net.Conn
+	once   sync.Once
+	closed func()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.closed)
+	return c.Conn.Close()
+}
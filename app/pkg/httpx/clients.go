@@ -0,0 +1,79 @@
+package httpx
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+)
+
+// HeaderGeoCountry carries the ISO 3166-1 alpha-2 country of the client, as
+// an edge proxy or CDN in front of the services would set it
+const HeaderGeoCountry = "X-Geo-Country"
+
+// Devices and countries of requests that do not name a known one
+const (
+	DeviceOther    = "other"
+	UnknownCountry = "unknown"
+)
+
+// DeviceOf classifies a User-Agent as ios, android, desktop or other
+func DeviceOf(userAgent string) string {
+	switch ua := strings.ToLower(userAgent); {
+	case strings.Contains(ua, "android"):
+		return "android"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ios"):
+		return "ios"
+	case strings.Contains(ua, "windows"), strings.Contains(ua, "macintosh"), strings.Contains(ua, "x11"):
+		return "desktop"
+	}
+	return DeviceOther
+}
+
+// CountryOf returns the client country from HeaderGeoCountry, or
+// UnknownCountry when it is missing or not a two-letter code
+func CountryOf(r *http.Request) string {
+	c := strings.ToUpper(r.Header.Get(HeaderGeoCountry))
+	if len(c) != 2 || c[0] < 'A' || c[0] > 'Z' || c[1] < 'A' || c[1] > 'Z' {
+		return UnknownCountry
+	}
+	return c
+}
+
+// Clients records the client device and country of every request on the
+// server span and counts responses by them, so a failure that only hits one
+// kind of client (only iOS users, only one country) stands out from the
+// service-wide error rate.
+func Clients(service string, next http.Handler) http.Handler {
+	responses, _ := otel.Meter(service).Int64Counter("http_server_client_responses_total",
+		metric.WithDescription("HTTP responses by client device, client country and status class"))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		device, country := DeviceOf(r.UserAgent()), CountryOf(r)
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attrs.ClientDevice(device))
+		if country != UnknownCountry {
+			span.SetAttributes(semconv.GeoCountryISOCode(country))
+		}
+
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+
+		status := cw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		responses.Add(r.Context(), 1, metric.WithAttributes(
+			attribute.String("device", device),
+			attribute.String("country", country),
+			attribute.String("status_class", strconv.Itoa(status/100)+"xx"),
+		))
+	})
+}
@@ -0,0 +1,69 @@
+// Package httpx holds HTTP middleware shared by the instrumented services.
+//
+// Every response carries the W3C traceparent of the server span plus a plain
+// X-Trace-Id header, and error bodies carry the trace ID and a short error ID.
+// A user reporting an error can paste either value into Jaeger, Grafana or the
+// AI analyzer: the trace ID opens the trace directly, and the error ID is
+// recorded on the span as error.id so a tag search finds it.
+//
+// Metrics adds the server metrics otelhttp leaves out in this setup: requests
+// in flight, request and response body sizes, and responses by status class.
+// Clients breaks responses down by client device and country.
+package httpx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceIDHeader carries the bare trace ID for clients that do not parse traceparent
+	TraceIDHeader = "X-Trace-Id"
+	// ErrorIDHeader carries the error ID of a failed request
+	ErrorIDHeader = "X-Error-Id"
+)
+
+// TraceResponse sets traceparent and X-Trace-Id on every response. It must be
+// wrapped by otelhttp so the server span is already in the request context.
+func TraceResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			propagation.TraceContext{}.Inject(r.Context(), propagation.HeaderCarrier(w.Header()))
+			w.Header().Set(TraceIDHeader, sc.TraceID().String())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ErrorRef identifies a failed request in error bodies
+type ErrorRef struct {
+	TraceID string `json:"trace_id,omitempty"`
+	ErrorID string `json:"error_id,omitempty"`
+}
+
+// NewErrorRef assigns a new error ID to the failed request. The ID is recorded
+// on the span in ctx and set as the X-Error-Id header of w, so it must be
+// called before the status is written.
+func NewErrorRef(ctx context.Context, w http.ResponseWriter) ErrorRef {
+	ref := ErrorRef{ErrorID: newErrorID()}
+	span := trace.SpanFromContext(ctx)
+	if sc := span.SpanContext(); sc.IsValid() {
+		ref.TraceID = sc.TraceID().String()
+	}
+	span.SetAttributes(attribute.String("error.id", ref.ErrorID))
+	w.Header().Set(ErrorIDHeader, ref.ErrorID)
+	return ref
+}
+
+// newErrorID returns eight hex characters, short enough to read over the phone
+func newErrorID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,60 @@
+package httpx
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// jsonBuffer is a buffer with an encoder writing into it. Both are pooled so
+// decoding request bodies and encoding responses reuse memory across requests
+// instead of allocating a decoder, an encoder and their buffers each time.
+type jsonBuffer struct {
+	buf bytes.Buffer
+	enc jsonx.Encoder
+}
+
+var jsonBuffers = sync.Pool{New: func() any {
+	b := new(jsonBuffer)
+	b.enc = jsonx.NewEncoder(&b.buf)
+	return b
+}}
+
+// maxPooledBuffer keeps the occasional large body from pinning its buffer in the pool
+const maxPooledBuffer = 64 << 10
+
+func (b *jsonBuffer) release() {
+	if b.buf.Cap() > maxPooledBuffer {
+		return
+	}
+	b.buf.Reset()
+	jsonBuffers.Put(b)
+}
+
+// DecodeJSON reads all of body and decodes it into v. Unlike a jsonx.Decoder
+// it rejects data after the JSON value.
+func DecodeJSON(body io.Reader, v any) error {
+	b := jsonBuffers.Get().(*jsonBuffer)
+	defer b.release()
+	if _, err := b.buf.ReadFrom(body); err != nil {
+		return err
+	}
+	return jsonx.Unmarshal(b.buf.Bytes(), v)
+}
+
+// WriteJSON writes v as a JSON response with status and returns the body
+// size. v is encoded before anything is written, so when encoding fails the
+// caller can still send an error status.
+func WriteJSON(w http.ResponseWriter, status int, v any) (int, error) {
+	b := jsonBuffers.Get().(*jsonBuffer)
+	defer b.release()
+	if err := b.enc.Encode(v); err != nil {
+		return 0, err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return w.Write(b.buf.Bytes())
+}
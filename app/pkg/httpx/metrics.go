@@ -0,0 +1,166 @@
+package httpx
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Body sizes from empty up to 4 MiB
+var sizeBuckets = []float64{0, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+
+// Metrics counts in-flight requests, body sizes and responses by status class.
+// otelhttp does not report body sizes here, and a sudden shift in them is a
+// useful anomaly signal on its own.
+func Metrics(service string, next http.Handler) http.Handler {
+	meter := otel.Meter(service)
+	active, _ := meter.Int64UpDownCounter("http_server_active_requests",
+		metric.WithDescription("Number of HTTP requests currently being served"))
+	requestSize, _ := meter.Int64Histogram("http_server_request_body_size_bytes",
+		metric.WithDescription("Size of HTTP request bodies read by the handler"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(sizeBuckets...))
+	responseSize, _ := meter.Int64Histogram("http_server_response_body_size_bytes",
+		metric.WithDescription("Size of HTTP response bodies written by the handler"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(sizeBuckets...))
+	responses, _ := meter.Int64Counter("http_server_responses_total",
+		metric.WithDescription("Total number of HTTP responses by status class"))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		method, known := methodOptions[r.Method]
+		if !known {
+			method = newMethodOptions(r.Method)
+		}
+
+		active.Add(ctx, 1, method.add...)
+		defer active.Add(ctx, -1, method.add...)
+
+		c := countersPool.Get().(*counters)
+		defer c.release()
+		body := r.Body
+		if body != nil {
+			c.body.ReadCloser = body
+			r.Body = &c.body
+		}
+		c.w.ResponseWriter = w
+		next.ServeHTTP(&c.w, r)
+		r.Body = body
+
+		status := c.w.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		var attrs options
+		if class := status / 100; class >= 1 && class <= 5 {
+			attrs = method.classes[class]
+		} else {
+			attrs = newOptions(attribute.String("method", r.Method), attribute.String("status_class", strconv.Itoa(class)+"xx"))
+		}
+		requestSize.Record(ctx, c.body.n, attrs.record...)
+		responseSize.Record(ctx, c.w.n, attrs.record...)
+		responses.Add(ctx, 1, attrs.add...)
+	})
+}
+
+// options are the measurement options of one attribute set, built once and
+// passed as ready slices so that recording with them allocates nothing
+type options struct {
+	add    []metric.AddOption
+	record []metric.RecordOption
+}
+
+func newOptions(kvs ...attribute.KeyValue) options {
+	set := metric.WithAttributeSet(attribute.NewSet(kvs...))
+	return options{add: []metric.AddOption{set}, record: []metric.RecordOption{set}}
+}
+
+// methodOption holds the options of a method alone and, indexed by
+// status/100, with each status class from 1xx to 5xx
+type methodOption struct {
+	options
+	classes [6]options
+}
+
+func newMethodOptions(method string) methodOption {
+	o := methodOption{options: newOptions(attribute.String("method", method))}
+	for class := 1; class <= 5; class++ {
+		o.classes[class] = newOptions(attribute.String("method", method), attribute.String("status_class", strconv.Itoa(class)+"xx"))
+	}
+	return o
+}
+
+// methodOptions are built up front for the usual methods; requests with any
+// other method build theirs per request
+var methodOptions = func() map[string]methodOption {
+	opts := make(map[string]methodOption)
+	for _, m := range []string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodHead, http.MethodOptions,
+	} {
+		opts[m] = newMethodOptions(m)
+	}
+	return opts
+}()
+
+// counters are the body and response wrappers of one request, pooled since
+// every request needs a pair
+type counters struct {
+	body countingReader
+	w    countingWriter
+}
+
+var countersPool = sync.Pool{New: func() any { return new(counters) }}
+
+func (c *counters) release() {
+	*c = counters{}
+	countersPool.Put(c)
+}
+
+// countingReader counts the request body bytes the handler reads
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter records the status and counts the response body bytes
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (w *countingWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses such as /db/events working
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
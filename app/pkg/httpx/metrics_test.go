@@ -0,0 +1,193 @@
+package httpx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// withMeterProvider installs an SDK meter provider with a manual reader for
+// the test
+func withMeterProvider(tb testing.TB) *sdkmetric.ManualReader {
+	tb.Helper()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(provider)
+	tb.Cleanup(func() {
+		otel.SetMeterProvider(prev)
+		provider.Shutdown(context.Background())
+	})
+	return reader
+}
+
+func TestMetrics(t *testing.T) {
+	reader := withMeterProvider(t)
+	handler := Metrics("test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	for _, method := range []string{http.MethodPost, http.MethodGet, http.MethodGet, "PURGE"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/", strings.NewReader("abc")))
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	var requestBytes int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				if m.Name != "http_server_responses_total" {
+					continue
+				}
+				for _, dp := range data.DataPoints {
+					method, _ := dp.Attributes.Value("method")
+					class, _ := dp.Attributes.Value("status_class")
+					got[method.AsString()+" "+class.AsString()] += dp.Value
+				}
+			case metricdata.Histogram[int64]:
+				if m.Name == "http_server_request_body_size_bytes" {
+					for _, dp := range data.DataPoints {
+						requestBytes += dp.Sum
+					}
+				}
+			}
+		}
+	}
+	want := map[string]int64{"POST 2xx": 1, "GET 2xx": 2, "PURGE 2xx": 1}
+	for key, n := range want {
+		if got[key] != n {
+			t.Errorf("responses %s = %d, want %d (all: %v)", key, got[key], n, got)
+		}
+	}
+	if requestBytes != 12 {
+		t.Errorf("request bytes = %d, want 12", requestBytes)
+	}
+}
+
+// TestMetricsAllocations keeps the middleware free of allocations for the
+// usual methods, which every request of every service pays for
+func TestMetricsAllocations(t *testing.T) {
+	withMeterProvider(t)
+	handler, w, r, body := benchRequest()
+	allocs := testing.AllocsPerRun(100, func() {
+		body.Seek(0, io.SeekStart)
+		r.Body = body
+		handler.ServeHTTP(w, r)
+	})
+	if allocs != 0 {
+		t.Errorf("Metrics allocates %.1f times per request, want 0", allocs)
+	}
+}
+
+func BenchmarkMetrics(b *testing.B) {
+	withMeterProvider(b)
+	handler, w, r, body := benchRequest()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		body.Seek(0, io.SeekStart)
+		r.Body = body
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// benchRequest builds a middleware-wrapped handler that reads the body and
+// writes a small response, and a request whose body can be rewound between runs
+func benchRequest() (http.Handler, http.ResponseWriter, *http.Request, *rewindBody) {
+	response := []byte(`{"status":"success"}`)
+	buf := make([]byte, 512)
+	handler := Metrics("bench", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for {
+			if _, err := r.Body.Read(buf); err != nil {
+				break
+			}
+		}
+		w.Write(response)
+	}))
+	w := &discardWriter{header: http.Header{}}
+	body := &rewindBody{strings.NewReader(`{"user_id":"user_1","amount":25,"operation":"deposit"}`)}
+	r := httptest.NewRequest(http.MethodPost, "/api/transaction", body)
+	return handler, w, r, body
+}
+
+// rewindBody is a request body the benchmark reuses
+type rewindBody struct {
+	*strings.Reader
+}
+
+func (rewindBody) Close() error { return nil }
+
+// discardWriter is a ResponseWriter that allocates nothing per request
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func TestClients(t *testing.T) {
+	reader := withMeterProvider(t)
+	handler := Clients("test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if DeviceOf(r.UserAgent()) == "ios" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	for _, c := range []struct{ userAgent, country string }{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15", "de"},
+		{"PayApp/4.12.0 (iPhone15,2; iOS 17.5.1) CFNetwork/1496.0.7", "DE"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36", "US"},
+		{"curl/8.5.0", "Germany"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", c.userAgent)
+		req.Header.Set(HeaderGeoCountry, c.country)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			data, ok := m.Data.(metricdata.Sum[int64])
+			if !ok || m.Name != "http_server_client_responses_total" {
+				continue
+			}
+			for _, dp := range data.DataPoints {
+				device, _ := dp.Attributes.Value("device")
+				country, _ := dp.Attributes.Value("country")
+				class, _ := dp.Attributes.Value("status_class")
+				got[device.AsString()+" "+country.AsString()+" "+class.AsString()] = dp.Value
+			}
+		}
+	}
+	want := map[string]int64{"ios DE 5xx": 2, "android US 2xx": 1, "other unknown 2xx": 1}
+	if len(got) != len(want) {
+		t.Fatalf("responses = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("responses[%s] = %d, want %d", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package httpx
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderPriority carries the priority class of a request; load shedding
+// drops batch requests first and critical ones last
+const HeaderPriority = "X-Priority"
+
+// Priority classes of HeaderPriority
+const (
+	PriorityCritical = "critical"
+	PriorityNormal   = "normal"
+	PriorityBatch    = "batch"
+)
+
+// PriorityOf returns the priority class of r, or def when HeaderPriority is
+// missing or names no known class
+func PriorityOf(r *http.Request, def string) string {
+	switch p := strings.ToLower(strings.TrimSpace(r.Header.Get(HeaderPriority))); p {
+	case PriorityCritical, PriorityNormal, PriorityBatch:
+		return p
+	}
+	return def
+}
@@ -0,0 +1,258 @@
+// Package jsonschema validates decoded JSON documents against a subset of
+// JSON Schema (draft 2020-12): type, enum, properties, required,
+// additionalProperties (true or false), items, minimum, exclusiveMinimum,
+// maximum, minLength, pattern and local references to "#/$defs/<name>". Other keywords are
+// ignored, so a schema written for a full validator still loads; it is just
+// checked less strictly.
+//
+// Violations name the failing field with the same paths as contracttest:
+// "." for the document, dotted field names below it and [] for the elements
+// of an array, so they stay few enough to be metric attributes.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a parsed JSON schema, or one of its subschemas
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Defs                 map[string]*Schema `json:"$defs"`
+	Type                 types              `json:"type"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	Pattern              string             `json:"pattern"`
+
+	root    *Schema
+	pattern *regexp.Regexp
+}
+
+// types is the type keyword, one type name or a list of them
+type types []string
+
+func (t *types) UnmarshalJSON(data []byte) error {
+	var one string
+	if json.Unmarshal(data, &one) == nil {
+		*t = types{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = many
+	return nil
+}
+
+// Violation is one way a document fails its schema
+type Violation struct {
+	Path    string
+	Keyword string
+	Message string
+}
+
+func (v Violation) String() string { return v.Path + ": " + v.Message }
+
+// Parse reads a schema and checks that its patterns compile and its
+// references resolve
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	if err := s.compile(&s, "#"); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) compile(root *Schema, at string) error {
+	s.root = root
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: pattern: %w", at, err)
+		}
+		s.pattern = re
+	}
+	if s.Ref != "" {
+		if _, err := root.resolve(s.Ref); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+	}
+	for name, d := range s.Defs {
+		if err := d.compile(root, at+"/$defs/"+name); err != nil {
+			return err
+		}
+	}
+	for name, p := range s.Properties {
+		if err := p.compile(root, at+"/properties/"+name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(root, at+"/items")
+	}
+	return nil
+}
+
+func (s *Schema) resolve(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("$ref %q: only #/$defs/<name> references are supported", ref)
+	}
+	d, ok := s.root.Defs[name]
+	if !ok {
+		return nil, fmt.Errorf("$ref %q: no such definition", ref)
+	}
+	return d, nil
+}
+
+// Def returns the definition called name under $defs
+func (s *Schema) Def(name string) (*Schema, bool) {
+	d, ok := s.root.Defs[name]
+	return d, ok
+}
+
+// Validate returns every violation of doc, a document decoded into any,
+// sorted by path
+func (s *Schema) Validate(doc any) []Violation {
+	return s.ValidateAt(doc, ".")
+}
+
+// ValidateAt validates doc as the field at path of a larger document, so its
+// violations carry the full path
+func (s *Schema) ValidateAt(doc any, path string) []Violation {
+	var vs []Violation
+	s.validate(doc, path, &vs)
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].Path < vs[j].Path })
+	return vs
+}
+
+func (s *Schema) validate(v any, path string, vs *[]Violation) {
+	if s.Ref != "" {
+		ref, _ := s.resolve(s.Ref) // checked by Parse
+		ref.validate(v, path, vs)
+	}
+	add := func(keyword, format string, args ...any) {
+		*vs = append(*vs, Violation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !matchesType(v, s.Type) {
+		add("type", "is %s, want %s", typeOf(v), strings.Join(s.Type, " or "))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		add("enum", "%s is not one of %s", jsonString(v), jsonString(s.Enum))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				add("required", "field %s is missing", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "." + name
+			if path == "." {
+				child = name
+			}
+			if p, ok := s.Properties[name]; ok {
+				p.validate(v[name], child, vs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*vs = append(*vs, Violation{Path: child, Keyword: "additionalProperties", Message: "field is not allowed"})
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for _, item := range v {
+				s.Items.validate(item, path+"[]", vs)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			add("minimum", "%g is below the minimum %g", v, *s.Minimum)
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			add("exclusiveMinimum", "%g is not above %g", v, *s.ExclusiveMinimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			add("maximum", "%g is above the maximum %g", v, *s.Maximum)
+		}
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			add("minLength", "is shorter than %d characters", *s.MinLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			add("pattern", "%q does not match %s", v, s.Pattern)
+		}
+	}
+}
+
+func matchesType(v any, want types) bool {
+	got := typeOf(v)
+	for _, t := range want {
+		if t == got || (t == "number" && got == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf is the JSON type of v, integer for whole numbers
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func inEnum(v any, enum []any) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
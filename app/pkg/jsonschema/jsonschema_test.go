@@ -0,0 +1,59 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["id", "tags"],
+  "additionalProperties": false,
+  "properties": {
+    "id": {"type": "string", "pattern": "^item_", "minLength": 6},
+    "count": {"type": "integer", "minimum": 1, "maximum": 10},
+    "price": {"type": "number", "exclusiveMinimum": 0},
+    "kind": {"enum": ["a", "b"]},
+    "tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}}
+  },
+  "$defs": {"tag": {"type": ["string", "null"]}}
+}`
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		doc  string
+		want []string
+	}{
+		"valid":      {`{"id":"item_1","count":3,"price":0.5,"kind":"a","tags":["x",null]}`, nil},
+		"not object": {`[1]`, []string{". type"}},
+		"fields": {`{"id":"item","count":2.5,"kind":"c","extra":true,"tags":["x",1]}`, []string{
+			"count type", "extra additionalProperties", "id minLength", "id pattern", "kind enum", "tags[] type",
+		}},
+		"range":   {`{"id":"item_12","count":11,"price":0,"tags":[]}`, []string{"count maximum", "price exclusiveMinimum"}},
+		"missing": {`{"count":0}`, []string{". required", ". required", "count minimum"}},
+	} {
+		var doc any
+		if err := json.Unmarshal([]byte(tc.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, v := range schema.Validate(doc) {
+			got = append(got, v.Path+" "+v.Keyword)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: violations %v, want %v", name, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{`{"$ref": "#/$defs/nope"}`, `{"$ref": "other.json"}`, `{"pattern": "("}`, `{"type": 1}`} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", bad)
+		}
+	}
+}
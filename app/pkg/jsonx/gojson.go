@@ -0,0 +1,20 @@
+//go:build jsonx_gojson
+
+package jsonx
+
+import (
+	"io"
+
+	gojson "github.com/goccy/go-json"
+)
+
+const name = "go-json"
+
+var codec Codec = gojsonCodec{}
+
+type gojsonCodec struct{}
+
+func (gojsonCodec) Marshal(v any) ([]byte, error)      { return gojson.Marshal(v) }
+func (gojsonCodec) Unmarshal(data []byte, v any) error { return gojson.Unmarshal(data, v) }
+func (gojsonCodec) NewEncoder(w io.Writer) Encoder     { return gojson.NewEncoder(w) }
+func (gojsonCodec) NewDecoder(r io.Reader) Decoder     { return gojson.NewDecoder(r) }
@@ -0,0 +1,22 @@
+//go:build jsonx_jsoniter
+
+package jsonx
+
+import (
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const name = "jsoniter"
+
+var codec Codec = jsoniterCodec{jsoniter.ConfigCompatibleWithStandardLibrary}
+
+type jsoniterCodec struct {
+	api jsoniter.API
+}
+
+func (c jsoniterCodec) Marshal(v any) ([]byte, error)      { return c.api.Marshal(v) }
+func (c jsoniterCodec) Unmarshal(data []byte, v any) error { return c.api.Unmarshal(data, v) }
+func (c jsoniterCodec) NewEncoder(w io.Writer) Encoder     { return c.api.NewEncoder(w) }
+func (c jsoniterCodec) NewDecoder(r io.Reader) Decoder     { return c.api.NewDecoder(r) }
@@ -0,0 +1,49 @@
+// Package jsonx is the JSON codec of the services. At high simulated traffic
+// rates encoding and decoding request and response bodies is a large share of
+// their CPU, so the implementation is picked at build time:
+//
+//	go build ./core                       # encoding/json
+//	go build -tags jsonx_sonic ./core     # github.com/bytedance/sonic
+//	go build -tags jsonx_jsoniter ./core  # github.com/json-iterator/go
+//	go build -tags jsonx_gojson ./core    # github.com/goccy/go-json
+//
+// Every backend is configured to match encoding/json: the same output, HTML
+// escaping included, and the same handling of struct tags. The third-party
+// ones are not required by default; add the module with go get before
+// building with its tag.
+package jsonx
+
+import "io"
+
+// Codec is one JSON implementation
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Encoder writes JSON values to a stream, each followed by a newline
+type Encoder interface {
+	Encode(v any) error
+}
+
+// Decoder reads JSON values from a stream
+type Decoder interface {
+	Decode(v any) error
+}
+
+// Name is the backend compiled in
+func Name() string { return name }
+
+// Marshal returns the JSON encoding of v
+func Marshal(v any) ([]byte, error) { return codec.Marshal(v) }
+
+// Unmarshal decodes the JSON in data into v
+func Unmarshal(data []byte, v any) error { return codec.Unmarshal(data, v) }
+
+// NewEncoder returns an encoder writing to w
+func NewEncoder(w io.Writer) Encoder { return codec.NewEncoder(w) }
+
+// NewDecoder returns a decoder reading from r
+func NewDecoder(r io.Reader) Decoder { return codec.NewDecoder(r) }
@@ -0,0 +1,129 @@
+package jsonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// transactionRequest and transactionResponse have the shape of the core API
+// transaction, the hottest JSON on the request path
+type transactionRequest struct {
+	UserID    string  `json:"user_id"`
+	ToUserID  string  `json:"to_user_id,omitempty"`
+	Amount    float64 `json:"amount"`
+	Operation string  `json:"operation"`
+}
+
+type transactionResponse struct {
+	Status    string         `json:"status"`
+	Message   string         `json:"message"`
+	Data      map[string]any `json:"data,omitempty"`
+	TraceID   string         `json:"trace_id"`
+	Timestamp string         `json:"timestamp"`
+}
+
+var (
+	request  = transactionRequest{UserID: "user_42", ToUserID: "user_7", Amount: 125.5, Operation: "transfer"}
+	response = transactionResponse{
+		Status:  "success",
+		Message: "Transaction processed successfully",
+		Data: map[string]any{
+			"operation":      "transfer",
+			"user_id":        "user_42",
+			"new_balance":    874.5,
+			"transaction_id": "txn_1739291001_42",
+			"payment":        map[string]any{"payment_id": "pay_9f3a", "status": "authorized", "network": "visa"},
+			"note":           "<script>&</script>",
+		},
+		TraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		Timestamp: "2026-10-15T09:30:00Z",
+	}
+)
+
+// TestMatchesStandardLibrary keeps every backend byte for byte compatible with
+// encoding/json, so switching the build tag never changes what clients see
+func TestMatchesStandardLibrary(t *testing.T) {
+	for _, v := range []any{request, response, map[string]int{"b": 2, "a": 1}, []any{nil, true, 1.5e300, "é"}} {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", Name(), err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: Marshal = %s, want %s", Name(), got, want)
+		}
+
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(v); err != nil {
+			t.Fatalf("%s: Encode: %v", Name(), err)
+		}
+		if got := buf.Bytes(); !bytes.Equal(got, append(want, '\n')) {
+			t.Errorf("%s: Encode = %s, want %s followed by a newline", Name(), got, want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data, _ := json.Marshal(request)
+	var got transactionRequest
+	if err := Unmarshal(data, &got); err != nil || got != request {
+		t.Errorf("%s: Unmarshal = %+v, %v, want %+v", Name(), got, err, request)
+	}
+
+	got = transactionRequest{}
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&got); err != nil || got != request {
+		t.Errorf("%s: Decode = %+v, %v, want %+v", Name(), got, err, request)
+	}
+
+	if err := Unmarshal([]byte(`{"amount":"25"}`), &got); err == nil {
+		t.Errorf("%s: Unmarshal accepted a string amount", Name())
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Marshal(response); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data, _ := json.Marshal(request)
+	b.ReportAllocs()
+	for b.Loop() {
+		var req transactionRequest
+		if err := Unmarshal(data, &req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	enc := NewEncoder(io.Discard)
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := enc.Encode(response); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	data, _ := json.Marshal(request)
+	r := bytes.NewReader(data)
+	b.ReportAllocs()
+	for b.Loop() {
+		r.Reset(data)
+		var req transactionRequest
+		if err := NewDecoder(r).Decode(&req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build jsonx_sonic
+
+package jsonx
+
+import (
+	"io"
+
+	"github.com/bytedance/sonic"
+)
+
+const name = "sonic"
+
+// ConfigStd escapes HTML and sorts map keys like encoding/json
+var codec Codec = sonicCodec{sonic.ConfigStd}
+
+type sonicCodec struct {
+	api sonic.API
+}
+
+func (c sonicCodec) Marshal(v any) ([]byte, error)      { return c.api.Marshal(v) }
+func (c sonicCodec) Unmarshal(data []byte, v any) error { return c.api.Unmarshal(data, v) }
+func (c sonicCodec) NewEncoder(w io.Writer) Encoder     { return c.api.NewEncoder(w) }
+func (c sonicCodec) NewDecoder(r io.Reader) Decoder     { return c.api.NewDecoder(r) }
@@ -0,0 +1,19 @@
+//go:build !jsonx_sonic && !jsonx_jsoniter && !jsonx_gojson
+
+package jsonx
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const name = "encoding/json"
+
+var codec Codec = stdCodec{}
+
+type stdCodec struct{}
+
+func (stdCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (stdCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (stdCodec) NewEncoder(w io.Writer) Encoder     { return json.NewEncoder(w) }
+func (stdCodec) NewDecoder(r io.Reader) Decoder     { return json.NewDecoder(r) }
@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWK is the public half of an Ed25519 key (RFC 8037)
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+}
+
+// KeySet is a JWKS document
+type KeySet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key in JWKS form
+func (k Key) JWK() JWK {
+	return JWK{Kty: "OKP", Crv: "Ed25519", X: b64.EncodeToString(k.Public), Kid: k.ID, Use: "sig", Alg: algorithm}
+}
+
+// Lookup returns the Ed25519 public key for kid
+func (s KeySet) Lookup(kid string) (ed25519.PublicKey, bool) {
+	for _, k := range s.Keys {
+		if k.Kid != kid || k.Kty != "OKP" || k.Crv != "Ed25519" {
+			continue
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, false
+		}
+		return ed25519.PublicKey(x), true
+	}
+	return nil, false
+}
+
+// RemoteKeySet caches a JWKS document fetched over HTTP. An unknown kid
+// triggers a refetch, at most once per MinRefresh.
+type RemoteKeySet struct {
+	URL        string
+	Client     *http.Client
+	MinRefresh time.Duration
+
+	mu      sync.Mutex
+	keys    KeySet
+	fetched time.Time
+}
+
+// Lookup implements Verifier.Key
+func (r *RemoteKeySet) Lookup(kid string) (ed25519.PublicKey, bool) {
+	r.mu.Lock()
+	keys, fetched := r.keys, r.fetched
+	r.mu.Unlock()
+
+	if k, ok := keys.Lookup(kid); ok {
+		return k, true
+	}
+	if time.Since(fetched) < r.MinRefresh {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Refresh(ctx); err != nil {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys.Lookup(kid)
+}
+
+// Refresh fetches the JWKS document now
+func (r *RemoteKeySet) Refresh(ctx context.Context) error {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	r.mu.Lock()
+	r.fetched = time.Now()
+	r.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks: %s returned %d", r.URL, resp.StatusCode)
+	}
+
+	var keys KeySet
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return fmt.Errorf("decode jwks: %w", err)
+	}
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,114 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeySetLookup(t *testing.T) {
+	key := mustKey(t)
+	bad := key.JWK()
+	bad.Kid, bad.X = "short", "AAAA"
+	rsa := key.JWK()
+	rsa.Kid, rsa.Kty = "rsa", "RSA"
+	set := KeySet{Keys: []JWK{key.JWK(), bad, rsa}}
+
+	for _, tc := range []struct {
+		kid  string
+		want bool
+	}{
+		{key.ID, true},
+		{"short", false},
+		{"rsa", false},
+		{"missing", false},
+	} {
+		t.Run(tc.kid, func(t *testing.T) {
+			pub, ok := set.Lookup(tc.kid)
+			if ok != tc.want || (ok && !pub.Equal(key.Public)) {
+				t.Errorf("Lookup(%q) = %v, %v; want ok %v", tc.kid, pub, ok, tc.want)
+			}
+		})
+	}
+}
+
+// jwksServer serves the keys in *published and counts the fetches
+func jwksServer(t *testing.T, mu *sync.Mutex, published *[]Key) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		var set KeySet
+		for _, k := range *published {
+			set.Keys = append(set.Keys, k.JWK())
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+func TestRemoteKeySetRefetchesUnknownKid(t *testing.T) {
+	first, rotated := mustKey(t), mustKey(t)
+	var mu sync.Mutex
+	published := []Key{first}
+	srv, fetches := jwksServer(t, &mu, &published)
+
+	keys := &RemoteKeySet{URL: srv.URL, MinRefresh: time.Hour}
+	if _, ok := keys.Lookup(first.ID); !ok || fetches.Load() != 1 {
+		t.Fatalf("first lookup: ok %v after %d fetches, want the key after 1", ok, fetches.Load())
+	}
+	if _, ok := keys.Lookup(first.ID); !ok || fetches.Load() != 1 {
+		t.Errorf("cached lookup: ok %v after %d fetches, want no refetch", ok, fetches.Load())
+	}
+
+	// A key published after the last fetch is not looked up again within MinRefresh,
+	// so a flood of unknown kids cannot hammer the auth service
+	mu.Lock()
+	published = append(published, rotated)
+	mu.Unlock()
+	for range 5 {
+		if _, ok := keys.Lookup("unknown"); ok {
+			t.Fatal("unknown kid found")
+		}
+	}
+	if _, ok := keys.Lookup(rotated.ID); ok || fetches.Load() != 1 {
+		t.Errorf("lookups within MinRefresh: ok %v after %d fetches, want no refetch", ok, fetches.Load())
+	}
+
+	// Once MinRefresh has passed an unknown kid refetches, once
+	keys.mu.Lock()
+	keys.fetched = time.Now().Add(-2 * time.Hour)
+	keys.mu.Unlock()
+	if _, ok := keys.Lookup(rotated.ID); !ok || fetches.Load() != 2 {
+		t.Errorf("rotated key: ok %v after %d fetches, want it after 2", ok, fetches.Load())
+	}
+	keys.Lookup("unknown")
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("%d fetches after another unknown kid, want 2", n)
+	}
+}
+
+func TestRemoteKeySetFetchFailure(t *testing.T) {
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	keys := &RemoteKeySet{URL: srv.URL, MinRefresh: time.Hour}
+	if err := keys.Refresh(t.Context()); err == nil {
+		t.Error("Refresh against a failing server succeeded")
+	}
+	// The failed fetch counts against MinRefresh too
+	if _, ok := keys.Lookup("any"); ok || fetches.Load() != 1 {
+		t.Errorf("lookup after a failed fetch: ok %v after %d fetches, want none after 1", ok, fetches.Load())
+	}
+}
@@ -0,0 +1,151 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func mustKey(t *testing.T) Key {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func mustSign(t *testing.T, claims Claims, key Key) string {
+	t.Helper()
+	token, err := Sign(claims, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// validClaims expire an hour after testNow
+func validClaims() Claims {
+	return Claims{
+		Issuer:    "auth-service",
+		Subject:   "user_1",
+		Audience:  "core-api",
+		IssuedAt:  testNow.Unix(),
+		ExpiresAt: testNow.Add(time.Hour).Unix(),
+		Scope:     "transactions:write balance:read",
+	}
+}
+
+// withHeader replaces the header segment of token, keeping its payload and signature
+func withHeader(token, header string) string {
+	parts := strings.Split(token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(header))
+	return strings.Join(parts, ".")
+}
+
+func TestVerify(t *testing.T) {
+	key, other := mustKey(t), mustKey(t)
+	at := func(d time.Duration) int64 { return testNow.Add(d).Unix() }
+
+	for _, tc := range []struct {
+		name   string
+		token  func() string
+		leeway time.Duration
+		want   error
+	}{
+		{"valid", func() string { return mustSign(t, validClaims(), key) }, 0, nil},
+		{"expired", func() string {
+			c := validClaims()
+			c.ExpiresAt = at(-time.Minute)
+			return mustSign(t, c, key)
+		}, 0, ErrExpired},
+		{"expired within leeway", func() string {
+			c := validClaims()
+			c.ExpiresAt = at(-10 * time.Second)
+			return mustSign(t, c, key)
+		}, 30 * time.Second, nil},
+		{"no exp", func() string {
+			c := validClaims()
+			c.ExpiresAt = 0
+			return mustSign(t, c, key)
+		}, 0, ErrNoExpiry},
+		{"not yet valid", func() string {
+			c := validClaims()
+			c.NotBefore = at(time.Minute)
+			return mustSign(t, c, key)
+		}, 0, ErrNotYetValid},
+		{"not yet valid within leeway", func() string {
+			c := validClaims()
+			c.NotBefore = at(10 * time.Second)
+			return mustSign(t, c, key)
+		}, 30 * time.Second, nil},
+		{"wrong alg", func() string {
+			return withHeader(mustSign(t, validClaims(), key), `{"alg":"HS256","typ":"JWT","kid":"`+key.ID+`"}`)
+		}, 0, ErrAlgorithm},
+		{"alg none", func() string {
+			token := withHeader(mustSign(t, validClaims(), key), `{"alg":"none","kid":"`+key.ID+`"}`)
+			return token[:strings.LastIndex(token, ".")+1]
+		}, 0, ErrAlgorithm},
+		{"unknown kid", func() string {
+			return mustSign(t, validClaims(), Key{ID: "nope", Private: key.Private, Public: key.Public})
+		}, 0, ErrUnknownKey},
+		{"signed by another key", func() string {
+			return mustSign(t, validClaims(), Key{ID: key.ID, Private: other.Private, Public: other.Public})
+		}, 0, ErrSignature},
+		{"tampered payload", func() string {
+			parts := strings.Split(mustSign(t, validClaims(), key), ".")
+			c := validClaims()
+			c.Subject = "user_2"
+			parts[1] = strings.Split(mustSign(t, c, key), ".")[1]
+			return strings.Join(parts, ".")
+		}, 0, ErrSignature},
+		{"wrong issuer", func() string {
+			c := validClaims()
+			c.Issuer = "someone-else"
+			return mustSign(t, c, key)
+		}, 0, ErrIssuer},
+		{"wrong audience", func() string {
+			c := validClaims()
+			c.Audience = "payment-gateway"
+			return mustSign(t, c, key)
+		}, 0, ErrAudience},
+		{"two segments", func() string { return "a.b" }, 0, ErrMalformed},
+		{"bad base64", func() string { return "!!.!!.!!" }, 0, ErrMalformed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &Verifier{
+				Key: func(kid string) (ed25519.PublicKey, bool) {
+					if kid == key.ID {
+						return key.Public, true
+					}
+					return nil, false
+				},
+				Issuer:   "auth-service",
+				Audience: "core-api",
+				Leeway:   tc.leeway,
+				Now:      func() time.Time { return testNow },
+			}
+			claims, err := v.Verify(tc.token())
+			if !errors.Is(err, tc.want) || (tc.want == nil) != (err == nil) {
+				t.Fatalf("Verify() error = %v, want %v", err, tc.want)
+			}
+			if err == nil && (claims.Subject != "user_1" || !claims.HasScope("balance:read")) {
+				t.Errorf("Verify() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	c := Claims{Scope: "transactions:write  balance:read"}
+	for scope, want := range map[string]bool{"transactions:write": true, "balance:read": true, "balance": false, "": false} {
+		if got := c.HasScope(scope); got != want {
+			t.Errorf("HasScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package logx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetLevel sets the lowest level logged, to stderr and to OTLP alike, and
+// returns the previous one
+func SetLevel(name string) (string, error) {
+	level, err := parseLevel(name)
+	if err != nil {
+		return "", err
+	}
+	previous := Level()
+	logrus.SetLevel(level)
+	return previous, nil
+}
+
+// Level returns the lowest level logged
+func Level() string {
+	if level := logrus.GetLevel(); level != logrus.WarnLevel {
+		return level.String()
+	}
+	return "warn"
+}
+
+func parseLevel(name string) (logrus.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "trace":
+		return logrus.TraceLevel, nil
+	case "debug":
+		return logrus.DebugLevel, nil
+	case "info":
+		return logrus.InfoLevel, nil
+	case "warn", "warning":
+		return logrus.WarnLevel, nil
+	case "error":
+		return logrus.ErrorLevel, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q: want trace, debug, info, warn or error", name)
+}
+
+// LevelHandler serves the log level: GET reports it and PUT with
+// {"level": "debug"} changes it until the next change or restart. A change
+// is passed to audit, which has the signature of audit.Warn, as
+// log_level.set.
+func LevelHandler(audit func(ctx context.Context, action, msg string, keysAndValues ...interface{})) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]string{"level": Level()})
+		case http.MethodPut:
+			var req struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid request body"})
+				return
+			}
+			previous, err := SetLevel(req.Level)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			audit(r.Context(), "log_level.set", "🔧 Log level changed", "log.level", Level(), "log.level.previous", previous)
+			json.NewEncoder(w).Encode(map[string]string{"level": Level(), "previous": previous})
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		}
+	})
+}
@@ -0,0 +1,83 @@
+// Package logx is the structured logging front end for the instrumented services.
+//
+// Messages are constant strings and everything variable goes into key/value
+// fields, so log records can be grouped by message and queried by field in
+// Loki. Every record carries the service name and, when ctx holds a recording
+// span, its trace_id and span_id. Records reach OTLP through the otellogrus
+// bridge installed by Setup.
+package logx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/bridges/otellogrus"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var service string
+
+// Setup names the service attached to every record and bridges logrus to provider
+func Setup(serviceName string, provider otellog.LoggerProvider) {
+	service = serviceName
+	logrus.AddHook(otellogrus.NewHook(serviceName, otellogrus.WithLoggerProvider(provider)))
+}
+
+// Entry returns a logrus entry for ctx with the service and trace correlation fields
+func Entry(ctx context.Context) *logrus.Entry {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	fields := logrus.Fields{}
+	if service != "" {
+		fields["service"] = service
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+		fields["span_id"] = sc.SpanID().String()
+	}
+	return logrus.WithContext(ctx).WithFields(fields)
+}
+
+// Debugw logs msg at debug level with alternating key/value fields
+func Debugw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	Entry(ctx).WithFields(Fields(keysAndValues...)).Debug(msg)
+}
+
+// Infow logs msg at info level with alternating key/value fields
+func Infow(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	Entry(ctx).WithFields(Fields(keysAndValues...)).Info(msg)
+}
+
+// Warnw logs msg at warning level with alternating key/value fields
+func Warnw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	Entry(ctx).WithFields(Fields(keysAndValues...)).Warn(msg)
+}
+
+// Errorw logs msg at error level with alternating key/value fields
+func Errorw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	Entry(ctx).WithFields(Fields(keysAndValues...)).Error(msg)
+}
+
+// Fields turns alternating key/value pairs into logrus fields. Errors are stored
+// as their message; a key without a value or a non-string key is kept under
+// !BADKEY rather than dropped.
+func Fields(keysAndValues ...interface{}) logrus.Fields {
+	fields := make(logrus.Fields, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok || i+1 == len(keysAndValues) {
+			fields["!BADKEY"] = fmt.Sprint(keysAndValues[i])
+			i--
+			continue
+		}
+		value := keysAndValues[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+	return fields
+}
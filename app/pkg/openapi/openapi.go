@@ -0,0 +1,175 @@
+// Package openapi describes a service's HTTP API as an OpenAPI 3.1 document
+// generated from its Go code. Routes are annotated where they are registered,
+// mux.HandleFunc(doc.Route(pattern, ops...), handler), and request and
+// response bodies are described by their Go types: JSON field names and
+// omitempty (optional) from the json tag, and doc, enum, pattern, minimum,
+// exclusiveMinimum and maximum tags for the rest. The document is served as
+// JSON by the Document itself and can check request bodies at runtime
+// (Validator).
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"incident-simulation/pkg/jsonx"
+)
+
+// Version is the OpenAPI version of the documents
+const Version = "3.1.0"
+
+// componentsPrefix is where schemas of named types live in a document
+const componentsPrefix = "#/components/schemas/"
+
+// Operation is one method of a route
+type Operation struct {
+	// Method defaults to the method of the route pattern
+	Method      string
+	ID          string
+	Summary     string
+	Description string
+	// Request is a value of the JSON request body's type, nil for none
+	Request any
+	// Headers are request headers the operation reads
+	Headers   []Header
+	Responses []Response
+}
+
+// Header is an HTTP header of a request or response
+type Header struct {
+	Name        string
+	Description string
+}
+
+// Response is one answer of an operation
+type Response struct {
+	Status      int
+	Description string
+	// Body is a value of the JSON body's type, nil for none
+	Body    any
+	Headers []Header
+}
+
+// Document is an OpenAPI document under construction. Register every route
+// before serving it.
+type Document struct {
+	info    map[string]any
+	paths   map[string]map[string]any
+	schemas map[string]any
+	// requests are the request body types by ServeMux pattern, METHOD path
+	requests map[string]any
+
+	once sync.Once
+	json []byte
+}
+
+// New returns an empty document of an API
+func New(title, version, description string) *Document {
+	return &Document{
+		info:     map[string]any{"title": title, "version": version, "description": description},
+		paths:    map[string]map[string]any{},
+		schemas:  map[string]any{},
+		requests: map[string]any{},
+	}
+}
+
+var pathParam = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// Route documents ops as the operations of a ServeMux pattern and returns the
+// pattern, to register the handler with
+func (d *Document) Route(pattern string, ops ...Operation) string {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	}
+	var params []any
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+	}
+	docPath := pathParam.ReplaceAllString(path, "{$1}")
+
+	for _, op := range ops {
+		if op.Method == "" {
+			op.Method = method
+		}
+		item := map[string]any{"responses": d.responses(op.Responses)}
+		for key, v := range map[string]string{"operationId": op.ID, "summary": op.Summary, "description": op.Description} {
+			if v != "" {
+				item[key] = v
+			}
+		}
+		parameters := append([]any(nil), params...)
+		for _, h := range op.Headers {
+			parameters = append(parameters, map[string]any{"name": h.Name, "in": "header", "description": h.Description, "schema": map[string]any{"type": "string"}})
+		}
+		if len(parameters) > 0 {
+			item["parameters"] = parameters
+		}
+		if op.Request != nil {
+			item["requestBody"] = map[string]any{"required": true, "content": d.content(op.Request)}
+			d.requests[op.Method+" "+path] = op.Request
+		}
+		if d.paths[docPath] == nil {
+			d.paths[docPath] = map[string]any{}
+		}
+		d.paths[docPath][strings.ToLower(op.Method)] = item
+	}
+	return pattern
+}
+
+func (d *Document) responses(rs []Response) map[string]any {
+	out := map[string]any{}
+	for _, r := range rs {
+		resp := map[string]any{"description": r.Description}
+		if r.Description == "" {
+			resp["description"] = http.StatusText(r.Status)
+		}
+		if r.Body != nil {
+			resp["content"] = d.content(r.Body)
+		}
+		if len(r.Headers) > 0 {
+			headers := map[string]any{}
+			for _, h := range r.Headers {
+				headers[h.Name] = map[string]any{"description": h.Description, "schema": map[string]any{"type": "string"}}
+			}
+			resp["headers"] = headers
+		}
+		out[strconv.Itoa(r.Status)] = resp
+	}
+	return out
+}
+
+func (d *Document) content(body any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": d.schemaOf(body)}}
+}
+
+// Paths returns the documented paths, sorted
+func (d *Document) Paths() []string {
+	paths := make([]string, 0, len(d.paths))
+	for p := range d.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// MarshalJSON encodes the document
+func (d *Document) MarshalJSON() ([]byte, error) {
+	return jsonx.Marshal(map[string]any{
+		"openapi":    Version,
+		"info":       d.info,
+		"paths":      d.paths,
+		"components": map[string]any{"schemas": d.schemas},
+	})
+}
+
+// ServeHTTP serves the document, typically as GET /openapi.json
+func (d *Document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.once.Do(func() { d.json, _ = d.MarshalJSON() })
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(d.json)
+}
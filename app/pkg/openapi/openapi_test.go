@@ -0,0 +1,155 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonschema"
+	"incident-simulation/pkg/jsonx"
+)
+
+type order struct {
+	ID       string  `json:"id" doc:"Order ID" pattern:"^ord_"`
+	Quantity int     `json:"quantity" minimum:"1" maximum:"10"`
+	Price    float64 `json:"price" exclusiveMinimum:"0"`
+	Kind     string  `json:"kind,omitempty" enum:"standard,express"`
+	Items    []item  `json:"items,omitempty"`
+	Note     *string `json:"note,omitempty"`
+	internal string
+}
+
+type item struct {
+	SKU string `json:"sku"`
+}
+
+type orderResponse struct {
+	Status string `json:"status"`
+	Order  *order `json:"order,omitempty"`
+	Data   any    `json:"data,omitempty"`
+	httpx.ErrorRef
+}
+
+func newTestDocument() (*Document, *http.ServeMux) {
+	doc := New("Orders", "1.0.0", "Test API")
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) { io.Copy(w, r.Body) }
+	mux.HandleFunc(doc.Route("/orders", Operation{
+		Method:  http.MethodPost,
+		ID:      "createOrder",
+		Summary: "Place an order",
+		Request: order{},
+		Headers: []Header{{Name: "Idempotency-Key", Description: "Replays the first result"}},
+		Responses: []Response{
+			{Status: http.StatusOK, Body: orderResponse{}},
+			{Status: http.StatusTooManyRequests, Body: orderResponse{}, Headers: []Header{{Name: "Retry-After", Description: "Seconds to wait"}}},
+		},
+	}), ok)
+	mux.HandleFunc(doc.Route("GET /orders/{id}", Operation{ID: "getOrder", Responses: []Response{{Status: http.StatusOK, Body: orderResponse{}}}}), ok)
+	return doc, mux
+}
+
+func TestDocument(t *testing.T) {
+	doc, _ := newTestDocument()
+	rec := httptest.NewRecorder()
+	doc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var got map[string]any
+	if err := jsonx.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["openapi"] != Version {
+		t.Errorf("openapi = %v, want %s", got["openapi"], Version)
+	}
+	if paths := doc.Paths(); !reflect.DeepEqual(paths, []string{"/orders", "/orders/{id}"}) {
+		t.Errorf("paths %v", paths)
+	}
+
+	at := func(v any, path ...string) any {
+		for _, key := range path {
+			m, _ := v.(map[string]any)
+			v = m[key]
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		path []string
+		want any
+	}{
+		{[]string{"paths", "/orders", "post", "operationId"}, "createOrder"},
+		{[]string{"paths", "/orders", "post", "requestBody", "content", "application/json", "schema", "$ref"}, "#/components/schemas/order"},
+		{[]string{"paths", "/orders", "post", "responses", "429", "description"}, "Too Many Requests"},
+		{[]string{"paths", "/orders", "post", "responses", "429", "headers", "Retry-After", "description"}, "Seconds to wait"},
+		{[]string{"paths", "/orders/{id}", "get", "operationId"}, "getOrder"},
+		{[]string{"components", "schemas", "order", "required"}, []any{"id", "quantity", "price"}},
+		{[]string{"components", "schemas", "order", "additionalProperties"}, false},
+		{[]string{"components", "schemas", "order", "properties", "id"}, map[string]any{"type": "string", "description": "Order ID", "pattern": "^ord_"}},
+		{[]string{"components", "schemas", "order", "properties", "quantity"}, map[string]any{"type": "integer", "minimum": 1.0, "maximum": 10.0}},
+		{[]string{"components", "schemas", "order", "properties", "kind", "enum"}, []any{"standard", "express"}},
+		{[]string{"components", "schemas", "order", "properties", "items", "items", "$ref"}, "#/components/schemas/item"},
+		{[]string{"components", "schemas", "order", "properties", "note"}, map[string]any{"type": "string"}},
+		{[]string{"components", "schemas", "order", "properties", "internal"}, nil},
+		// Embedded structs are flattened
+		{[]string{"components", "schemas", "orderResponse", "properties", "error_id"}, map[string]any{"type": "string"}},
+		{[]string{"components", "schemas", "orderResponse", "properties", "data"}, map[string]any{}},
+	} {
+		if v := at(got, tc.path...); !reflect.DeepEqual(v, tc.want) {
+			t.Errorf("%s = %v, want %v", strings.Join(tc.path, "."), v, tc.want)
+		}
+	}
+	params, _ := at(got, "paths", "/orders/{id}", "get", "parameters").([]any)
+	if len(params) != 1 || at(params[0], "in") != "path" || at(params[0], "name") != "id" {
+		t.Errorf("getOrder parameters %v, want the id path parameter", params)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	doc, mux := newTestDocument()
+	var rejected []jsonschema.Violation
+	validate, err := doc.Validator(func(r *http.Request, violations []jsonschema.Violation) { rejected = violations })
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := validate(mux)
+
+	for name, tc := range map[string]struct {
+		method, path, body string
+		status             int
+		fields             []string
+	}{
+		"valid":        {http.MethodPost, "/orders", `{"id":"ord_1","quantity":2,"price":9.5,"items":[{"sku":"a"}]}`, http.StatusOK, nil},
+		"violations":   {http.MethodPost, "/orders", `{"id":"1","quantity":0,"price":0,"kind":"slow","items":[{}],"extra":1}`, http.StatusBadRequest, []string{"extra", "id", "items[]", "kind", "price", "quantity"}},
+		"not json":     {http.MethodPost, "/orders", `id=ord_1`, http.StatusOK, nil},
+		"no schema":    {http.MethodGet, "/orders/ord_1", ``, http.StatusOK, nil},
+		"undocumented": {http.MethodPost, "/other", `{}`, http.StatusNotFound, nil},
+	} {
+		rejected = nil
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d; body %s", name, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if tc.status == http.StatusOK && rec.Body.String() != tc.body {
+			t.Errorf("%s: handler read %q, want the whole body", name, rec.Body)
+		}
+		if tc.fields == nil {
+			if rejected != nil {
+				t.Errorf("%s: rejected with %v", name, rejected)
+			}
+			continue
+		}
+		var resp Rejection
+		jsonx.Unmarshal(rec.Body.Bytes(), &resp)
+		var fields []string
+		for _, f := range resp.Fields {
+			fields = append(fields, f.Field)
+		}
+		if !reflect.DeepEqual(fields, tc.fields) || len(rejected) != len(tc.fields) {
+			t.Errorf("%s: rejected fields %v (reported %d), want %v", name, fields, len(rejected), tc.fields)
+		}
+	}
+}
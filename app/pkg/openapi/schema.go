@@ -0,0 +1,109 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// schemaOf returns the schema of v's type, a reference for a named struct
+// whose schema is added to the components
+func (d *Document) schemaOf(v any) map[string]any {
+	return d.schema(reflect.TypeOf(v))
+}
+
+func (d *Document) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": d.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object"}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		if _, ok := d.schemas[t.Name()]; !ok {
+			// Placeholder first, so a type that refers to itself terminates
+			d.schemas[t.Name()] = map[string]any{}
+			d.schemas[t.Name()] = d.object(t)
+		}
+		return map[string]any{"$ref": componentsPrefix + t.Name()}
+	}
+	// interface{} holds any JSON value
+	return map[string]any{}
+}
+
+// object is the schema of struct type t. Fields without omitempty are
+// required, and fields that are not in the struct are not allowed: the Go
+// types are the whole contract.
+func (d *Document) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	d.fields(t, properties, &required)
+	s := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (d *Document) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		// Embedded structs without a name are flattened, as encoding/json does
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			d.fields(f.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		// Keywords next to a $ref apply on top of the referenced schema
+		s := d.schema(f.Type)
+		annotate(s, f.Tag)
+		properties[name] = s
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// annotate adds the keywords of a field's tags to its schema s
+func annotate(s map[string]any, tag reflect.StructTag) {
+	if doc := tag.Get("doc"); doc != "" {
+		s["description"] = doc
+	}
+	if enum := tag.Get("enum"); enum != "" {
+		var values []any
+		for _, v := range strings.Split(enum, ",") {
+			values = append(values, v)
+		}
+		s["enum"] = values
+	}
+	if pattern := tag.Get("pattern"); pattern != "" {
+		s["pattern"] = pattern
+	}
+	for _, key := range []string{"minimum", "exclusiveMinimum", "maximum"} {
+		if v, err := strconv.ParseFloat(tag.Get(key), 64); err == nil {
+			s[key] = v
+		}
+	}
+}
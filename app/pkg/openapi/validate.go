@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonschema"
+	"incident-simulation/pkg/jsonx"
+)
+
+// Rejection is the 400 answer to a request body that violates its schema,
+// in the shape of the core API's validation errors
+type Rejection struct {
+	Status string       `json:"status"`
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+	httpx.ErrorRef
+}
+
+// FieldError is one violation of a rejected request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validator returns middleware checking the JSON body of every documented
+// operation with a Request type against its schema. A body that violates it
+// is answered 400 with a Rejection, after reject, when set, has recorded the
+// violations; a body that is not JSON at all is left to the handler. Register
+// every route first.
+func (d *Document) Validator(reject func(r *http.Request, violations []jsonschema.Violation)) (func(http.Handler) http.Handler, error) {
+	routes := http.NewServeMux()
+	schemas := map[string]*jsonschema.Schema{}
+	for pattern, body := range d.requests {
+		// A JSON schema of its own, the components as its $defs
+		doc := d.schemaOf(body)
+		doc["$defs"] = d.schemas
+		data, err := jsonx.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := jsonschema.Parse(bytes.ReplaceAll(data, []byte(componentsPrefix), []byte("#/$defs/")))
+		if err != nil {
+			return nil, fmt.Errorf("request schema of %s: %w", pattern, err)
+		}
+		schemas[pattern] = schema
+		routes.Handle(pattern, http.NotFoundHandler())
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := routes.Handler(r)
+			schema, ok := schemas[pattern]
+			if !ok || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			var doc any
+			if err != nil || jsonx.Unmarshal(body, &doc) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			violations := schema.Validate(doc)
+			if len(violations) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if reject != nil {
+				reject(r, violations)
+			}
+			resp := Rejection{Status: "error", Error: "request does not match the API schema", ErrorRef: httpx.NewErrorRef(r.Context(), w)}
+			for _, v := range violations {
+				resp.Fields = append(resp.Fields, FieldError{Field: v.Path, Message: v.Message})
+			}
+			httpx.WriteJSON(w, http.StatusBadRequest, resp)
+		})
+	}, nil
+}
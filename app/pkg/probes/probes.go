@@ -0,0 +1,160 @@
+// Package probes serves Kubernetes liveness, readiness and startup endpoints.
+//
+// The probes report process health only: they are not traced, not rate limited
+// and never affected by incident simulation, unlike /api/health and /db/health.
+package probes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is reachable
+type Check func(ctx context.Context) error
+
+// Prober holds the startup flag and the named readiness checks
+type Prober struct {
+	started atomic.Bool
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// New returns a Prober whose readiness checks each get timeout to complete
+func New(timeout time.Duration) *Prober {
+	return &Prober{
+		timeout: timeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// AddCheck registers a readiness check under name
+func (p *Prober) AddCheck(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks[name] = check
+}
+
+// MarkStarted flips /startupz (and allows /readyz) to succeed
+func (p *Prober) MarkStarted() {
+	p.started.Store(true)
+}
+
+// Register mounts /healthz, /readyz and /startupz on mux
+func (p *Prober) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", p.handleLiveness)
+	mux.HandleFunc("GET /readyz", p.handleReadiness)
+	mux.HandleFunc("GET /startupz", p.handleStartup)
+}
+
+// handleLiveness succeeds as long as the process can serve HTTP
+func (p *Prober) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+func (p *Prober) handleStartup(w http.ResponseWriter, r *http.Request) {
+	if !p.started.Load() {
+		writeStatus(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "starting"})
+		return
+	}
+	writeStatus(w, http.StatusOK, map[string]interface{}{"status": "started"})
+}
+
+// handleReadiness runs every check concurrently and fails if any of them fails
+func (p *Prober) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if !p.started.Load() {
+		writeStatus(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "starting"})
+		return
+	}
+
+	p.mu.RLock()
+	names := make([]string, 0, len(p.checks))
+	checks := make(map[string]Check, len(p.checks))
+	for name, check := range p.checks {
+		names = append(names, name)
+		checks[name] = check
+	}
+	p.mu.RUnlock()
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.timeout)
+	defer cancel()
+
+	results := make([]string, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		check := checks[name]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := check(ctx); err != nil {
+				results[i] = err.Error()
+				return
+			}
+			results[i] = "ok"
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	report := make(map[string]string, len(names))
+	for i, name := range names {
+		report[name] = results[i]
+		if results[i] != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	body := map[string]interface{}{"status": "ready", "checks": report}
+	if status != http.StatusOK {
+		body["status"] = "not_ready"
+	}
+	writeStatus(w, status, body)
+}
+
+// TCPCheck succeeds when a TCP connection to host:port can be opened
+func TCPCheck(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPCheck succeeds when GET url answers with a 2xx status. client should not be
+// instrumented so probes do not produce spans.
+func HTTPCheck(client *http.Client, url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+func writeStatus(w http.ResponseWriter, status int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,81 @@
+// Package profiling exposes pprof and optional Pyroscope continuous profiling.
+package profiling
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/grafana/pyroscope-go"
+
+	"incident-simulation/pkg/config"
+)
+
+// Start exposes net/http/pprof on cfg.PprofAddr when cfg.PprofEnabled is set and
+// pushes continuous profiles to Pyroscope when cfg.PyroscopeServerAddress is set.
+// The returned function stops the Pyroscope profiler.
+func Start(serviceName string, cfg config.Profiling, defaultPprofAddr string) func() {
+	if cfg.PprofEnabled {
+		addr := cfg.PprofAddr
+		if addr == "" {
+			addr = defaultPprofAddr
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+		go func() {
+			log.Printf("🔬 pprof listening on %s", addr)
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Printf("pprof server stopped: %v", err)
+			}
+		}()
+	}
+
+	serverAddress := cfg.PyroscopeServerAddress
+	if serverAddress == "" {
+		return func() {}
+	}
+
+	// Needed for the mutex and block profile types
+	runtime.SetMutexProfileFraction(5)
+	runtime.SetBlockProfileRate(5)
+
+	profiler, err := pyroscope.Start(pyroscope.Config{
+		ApplicationName:   serviceName,
+		ServerAddress:     serverAddress,
+		BasicAuthUser:     cfg.PyroscopeBasicAuthUser,
+		BasicAuthPassword: cfg.PyroscopeBasicAuthPassword,
+		Tags: map[string]string{
+			"service_name": serviceName,
+		},
+		ProfileTypes: []pyroscope.ProfileType{
+			pyroscope.ProfileCPU,
+			pyroscope.ProfileAllocObjects,
+			pyroscope.ProfileAllocSpace,
+			pyroscope.ProfileInuseObjects,
+			pyroscope.ProfileInuseSpace,
+			pyroscope.ProfileGoroutines,
+			pyroscope.ProfileMutexCount,
+			pyroscope.ProfileMutexDuration,
+			pyroscope.ProfileBlockCount,
+			pyroscope.ProfileBlockDuration,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to start pyroscope profiler: %v", err)
+		return func() {}
+	}
+
+	log.Printf("🔥 Continuous profiling enabled, pushing to %s", serverAddress)
+	return func() {
+		if err := profiler.Stop(); err != nil {
+			log.Printf("Error stopping pyroscope profiler: %v", err)
+		}
+	}
+}
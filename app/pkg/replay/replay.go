@@ -0,0 +1,251 @@
+// Package replay records the requests hitting a service and plays them back.
+//
+// A Recorder is HTTP middleware that appends one JSON line per request to a
+// file: when it arrived, method, path with query, the headers that shape
+// behaviour, the body, and the status and duration it got. Credentials
+// (Authorization, Cookie) are never written. Play sends the recorded requests
+// to another base URL keeping their original spacing, optionally compressed by
+// a speed factor, so a telemetry pattern can be reproduced exactly while
+// detection rules are tuned.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxBody caps how much of a request body is recorded
+const MaxBody = 1 << 20
+
+// Headers that are kept in recordings; anything else is dropped
+var recordedHeaders = []string{
+	"Content-Type",
+	"Idempotency-Key",
+	"User-Agent",
+	"X-Forwarded-For",
+	"X-Chaos-Delay",
+	"X-Chaos-Fail",
+	"X-Chaos-Target",
+}
+
+// Entry is one recorded request
+type Entry struct {
+	Time       time.Time         `json:"time"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	Status     int               `json:"status"`
+	DurationMS float64           `json:"duration_ms"`
+	TraceID    string            `json:"trace_id,omitempty"`
+}
+
+// Recorder appends entries to a JSONL file
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+// NewRecorder opens path for appending, creating it if needed
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+	return &Recorder{file: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Middleware records every request served by next. Wrap it in otelhttp so the
+// trace ID of the original request is kept for comparison with the replay.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := Entry{
+			Time:   time.Now(),
+			Method: r.Method,
+			Path:   r.URL.RequestURI(),
+		}
+		for _, h := range recordedHeaders {
+			if v := r.Header.Get(h); v != "" {
+				if e.Header == nil {
+					e.Header = make(map[string]string)
+				}
+				e.Header[h] = v
+			}
+		}
+		if r.Body != nil {
+			body, _ := io.ReadAll(io.LimitReader(r.Body, MaxBody))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			e.Body = string(body)
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			e.TraceID = sc.TraceID().String()
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		e.Status = sw.status
+		e.DurationMS = float64(time.Since(e.Time).Microseconds()) / 1000
+		rec.write(e)
+	})
+}
+
+func (rec *Recorder) write(e Entry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.w.Write(append(line, '\n'))
+	rec.w.Flush()
+}
+
+// Close flushes and closes the recording
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if err := rec.w.Flush(); err != nil {
+		rec.file.Close()
+		return err
+	}
+	return rec.file.Close()
+}
+
+// statusWriter remembers the status code written by the handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Read loads a recording and sorts it by arrival time. Entries are written
+// when requests finish, so the file itself is in completion order.
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 2*MaxBody)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// Request builds the HTTP request replaying e against baseURL
+func (e Entry) Request(baseURL string) (*http.Request, error) {
+	var body io.Reader
+	if e.Body != "" {
+		body = strings.NewReader(e.Body)
+	}
+	req, err := http.NewRequest(e.Method, strings.TrimSuffix(baseURL, "/")+e.Path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.Header {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// Result is the outcome of one replayed request
+type Result struct {
+	Entry    Entry
+	Status   int
+	Duration time.Duration
+	Err      error
+}
+
+// Play sends entries to baseURL and calls done for each as it completes.
+// Requests start at their recorded offset from the first entry divided by
+// speed, so 1 keeps the original timing, 10 is ten times faster and 0 sends
+// them as fast as maxInFlight allows. Play returns when all requests finished
+// or ctx is canceled.
+func Play(ctx context.Context, client *http.Client, baseURL string, entries []Entry, speed float64, maxInFlight int, done func(Result)) {
+	if len(entries) == 0 {
+		return
+	}
+	sem := make(chan struct{}, maxInFlight)
+	var wg sync.WaitGroup
+	first := entries[0].Time
+	start := time.Now()
+
+	for _, e := range entries {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(e.Time.Sub(first)) / speed))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(e Entry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			done(send(ctx, client, baseURL, e))
+		}(e)
+	}
+	wg.Wait()
+}
+
+func send(ctx context.Context, client *http.Client, baseURL string, e Entry) Result {
+	res := Result{Entry: e}
+	req, err := e.Request(baseURL)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	res.Duration = time.Since(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res.Status = resp.StatusCode
+	return res
+}
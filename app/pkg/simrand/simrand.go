@@ -0,0 +1,52 @@
+// Package simrand is the random source behind the simulators' decisions:
+// which incident starts and for how long, injected errors and latency,
+// generated balances and amounts. Seeding it (SIM_SEED) replays the same
+// sequence of decisions; request timing and goroutine scheduling still vary,
+// so two seeded runs match in shape rather than span for span.
+package simrand
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	mu  sync.Mutex
+	rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Seed restarts the sequence from seed
+func Seed(seed int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	rng = rand.New(rand.NewSource(seed))
+}
+
+// Float64 returns a number in [0.0,1.0)
+func Float64() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Float64()
+}
+
+// Intn returns a number in [0,n); it panics if n <= 0
+func Intn(n int) int {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Intn(n)
+}
+
+// Int63n returns a number in [0,n); it panics if n <= 0
+func Int63n(n int64) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Int63n(n)
+}
+
+// NormFloat64 returns a standard normally distributed number
+func NormFloat64() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.NormFloat64()
+}
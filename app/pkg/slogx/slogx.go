@@ -0,0 +1,168 @@
+// Package slogx builds the slog logger used by the auto-instrumented services.
+//
+// Records always go to stderr as text. When OTEL_LOGS_EXPORTER is otlp they are
+// also exported through the otelslog bridge to the OTLP/HTTP endpoint from the
+// standard OTEL_EXPORTER_OTLP_* variables; console prints the OTel records to
+// stdout instead. Levels and attributes are kept, and records logged with a
+// context carry its trace and span IDs. LOG_LEVEL sets the minimum level, and
+// LevelHandler changes it at runtime.
+package slogx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// level is the minimum level of every logger New returns
+var level slog.LevelVar
+
+// New returns a logger for serviceName and a shutdown function that flushes
+// pending OTel records. OTEL_SERVICE_NAME overrides serviceName.
+func New(ctx context.Context, serviceName string) (*slog.Logger, func(context.Context) error, error) {
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return nil, nil, fmt.Errorf("invalid LOG_LEVEL %q: %w", v, err)
+		}
+	}
+	text := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &level})
+	noop := func(context.Context) error { return nil }
+
+	var exporter sdklog.Exporter
+	var err error
+	switch strings.ToLower(os.Getenv("OTEL_LOGS_EXPORTER")) {
+	case "", "none":
+		return slog.New(text), noop, nil
+	case "otlp":
+		exporter, err = otlploghttp.New(ctx)
+	case "console":
+		exporter, err = stdoutlog.New()
+	default:
+		return nil, nil, fmt.Errorf("unsupported OTEL_LOGS_EXPORTER %q: want otlp, console or none", os.Getenv("OTEL_LOGS_EXPORTER"))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("create log exporter: %w", err)
+	}
+
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(serviceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create resource: %w", err)
+	}
+
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+	)
+	bridge := otelslog.NewHandler(serviceName, otelslog.WithLoggerProvider(provider))
+
+	return slog.New(&fanout{handlers: []slog.Handler{text, &leveled{bridge, &level}}}), provider.Shutdown, nil
+}
+
+// leveled applies the minimum level to a handler that has no level option
+type leveled struct {
+	slog.Handler
+	min slog.Leveler
+}
+
+func (h *leveled) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= h.min.Level() && h.Handler.Enabled(ctx, l)
+}
+
+func (h *leveled) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &leveled{h.Handler.WithAttrs(attrs), h.min}
+}
+
+func (h *leveled) WithGroup(name string) slog.Handler {
+	return &leveled{h.Handler.WithGroup(name), h.min}
+}
+
+// LevelHandler serves the minimum level: GET reports it and PUT with
+// {"level": "debug"} changes it. A change is logged with audit=true.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]string{"level": level.Level().String()})
+		case http.MethodPut:
+			var req struct {
+				Level string `json:"level"`
+			}
+			var next slog.Level
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid request body"})
+				return
+			}
+			if err := next.UnmarshalText([]byte(req.Level)); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			previous := level.Level()
+			level.Set(next)
+			slog.WarnContext(r.Context(), "🔧 Log level changed", "audit", true, "audit.action", "log_level.set",
+				"log.level", next.String(), "log.level.previous", previous.String())
+			json.NewEncoder(w).Encode(map[string]string{"level": next.String(), "previous": previous.String()})
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		}
+	})
+}
+
+// fanout hands every record to each handler that accepts its level
+type fanout struct {
+	handlers []slog.Handler
+}
+
+func (f *fanout) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range f.handlers {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f.handlers {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(f.handlers))
+	for i, h := range f.handlers {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return &fanout{handlers: handlers}
+}
+
+func (f *fanout) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(f.handlers))
+	for i, h := range f.handlers {
+		handlers[i] = h.WithGroup(name)
+	}
+	return &fanout{handlers: handlers}
+}
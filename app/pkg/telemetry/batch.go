@@ -0,0 +1,97 @@
+package telemetry
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/config"
+)
+
+// SpanProcessor is the SDK batch span processor with a visible queue. The
+// SDK drops spans silently once its queue is full, so SpanProcessor keeps the
+// count of spans waiting for export itself, drops beyond SpanQueueSize before
+// the SDK has to, and counts those drops in telemetry_spans_dropped_total.
+type SpanProcessor struct {
+	sdktrace.SpanProcessor
+
+	limit   int64
+	pending atomic.Int64
+	dropped atomic.Int64
+	counter metric.Int64Counter
+}
+
+// NewBatchSpanProcessor exports through exporter with the configured limits
+func NewBatchSpanProcessor(exporter sdktrace.SpanExporter, cfg config.Batching) *SpanProcessor {
+	p := &SpanProcessor{limit: int64(cfg.SpanQueueSize)}
+	p.SpanProcessor = sdktrace.NewBatchSpanProcessor(&pendingExporter{SpanExporter: exporter, pending: &p.pending},
+		sdktrace.WithMaxQueueSize(cfg.SpanQueueSize),
+		sdktrace.WithMaxExportBatchSize(cfg.SpanBatchSize),
+		sdktrace.WithBatchTimeout(cfg.SpanBatchDelay),
+		sdktrace.WithExportTimeout(cfg.SpanExportTimeout),
+	)
+
+	// The global meter binds once the service sets its meter provider
+	counter, err := otel.Meter("incident-simulation/pkg/telemetry").Int64Counter("telemetry_spans_dropped_total",
+		metric.WithDescription("Spans dropped because the export queue was full"))
+	if err == nil {
+		p.counter = counter
+	}
+	return p
+}
+
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// The SDK only queues sampled spans
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if p.pending.Add(1) > p.limit {
+		p.pending.Add(-1)
+		p.dropped.Add(1)
+		if p.counter != nil {
+			p.counter.Add(context.Background(), 1)
+		}
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// Pending returns the spans queued or being exported
+func (p *SpanProcessor) Pending() int64 { return p.pending.Load() }
+
+// Dropped returns the spans dropped since start
+func (p *SpanProcessor) Dropped() int64 { return p.dropped.Load() }
+
+// pendingExporter releases queue slots once a batch has been exported or failed
+type pendingExporter struct {
+	sdktrace.SpanExporter
+	pending *atomic.Int64
+}
+
+func (e *pendingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	defer e.pending.Add(-int64(len(spans)))
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+// NewBatchLogProcessor exports log records through exporter with the configured limits
+func NewBatchLogProcessor(exporter sdklog.Exporter, cfg config.Batching) *sdklog.BatchProcessor {
+	return sdklog.NewBatchProcessor(exporter,
+		sdklog.WithMaxQueueSize(cfg.LogQueueSize),
+		sdklog.WithExportMaxBatchSize(cfg.LogBatchSize),
+		sdklog.WithExportInterval(cfg.LogBatchDelay),
+		sdklog.WithExportTimeout(cfg.LogExportTimeout),
+	)
+}
+
+// NewPeriodicReader collects and exports metrics at the configured interval
+func NewPeriodicReader(exporter sdkmetric.Exporter, cfg config.Batching) *sdkmetric.PeriodicReader {
+	return sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(cfg.MetricExportInterval),
+		sdkmetric.WithTimeout(cfg.MetricExportTimeout),
+	)
+}
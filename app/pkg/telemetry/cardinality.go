@@ -0,0 +1,252 @@
+package telemetry
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+)
+
+// OverflowKey marks the measurements a cardinality guard collapsed, the
+// attribute the SDK's own cardinality limit uses
+const OverflowKey = attribute.Key("otel.metric.overflow")
+
+var overflowSet = attribute.NewSet(OverflowKey.Bool(true))
+
+// GuardCardinality wraps mp so every counter, up-down counter and histogram
+// keeps at most limit attribute sets. A measurement with a new set past the
+// limit is recorded with only otel.metric.overflow=true, counted in
+// telemetry_cardinality_overflow_total and logged once per instrument, so a
+// stray user ID in a metric cannot flood the backend. Attributes views drop
+// are not counted, as they add no series. Each instrument of each meter has
+// its own budget and lock. limit <= 0 returns mp.
+func GuardCardinality(mp metric.MeterProvider, limit int, views ViewConfig) metric.MeterProvider {
+	if limit <= 0 {
+		return mp
+	}
+	g := &cardinalityGuard{limit: limit, views: views}
+	// Created on mp itself so the guard's own metric is not guarded
+	overflows, err := mp.Meter("incident-simulation/pkg/telemetry").Int64Counter("telemetry_cardinality_overflow_total",
+		metric.WithDescription("Measurements recorded as otel.metric.overflow because their instrument reached METRIC_CARDINALITY_LIMIT attribute sets"))
+	if err != nil {
+		log.Printf("Failed to create cardinality overflow counter: %v", err)
+	}
+	g.overflows = overflows
+	return guardedProvider{mp: mp, g: g}
+}
+
+type cardinalityGuard struct {
+	limit     int
+	views     ViewConfig
+	overflows metric.Int64Counter
+
+	instruments sync.Map // instrumentKey -> *instrumentGuard
+}
+
+// instrumentKey identifies an instrument; the SDK returns the same instrument
+// when a meter asks for a name twice, so both share one guard
+type instrumentKey struct {
+	scope, name string
+}
+
+// instrumentGuard counts the attribute sets of one instrument
+type instrumentGuard struct {
+	g       *cardinalityGuard
+	name    string
+	dropped map[attribute.Key]bool
+
+	mu sync.RWMutex
+	// known caches whether a recorded set was admitted, keyed by the set as
+	// recorded, so repeated sets skip filtering and take only the read lock.
+	// It holds at most 2*limit sets, so sets that differ only in dropped or
+	// overflowing attributes cannot grow it without bound.
+	known  map[attribute.Distinct]bool
+	sets   map[attribute.Distinct]struct{} // admitted sets without dropped attributes
+	warned bool
+}
+
+func (g *cardinalityGuard) instrument(scope, name string) *instrumentGuard {
+	key := instrumentKey{scope: scope, name: name}
+	if i, ok := g.instruments.Load(key); ok {
+		return i.(*instrumentGuard)
+	}
+	i, _ := g.instruments.LoadOrStore(key, &instrumentGuard{
+		g:       g,
+		name:    name,
+		dropped: g.views.droppedAttributes(name),
+		known:   make(map[attribute.Distinct]bool),
+		sets:    make(map[attribute.Distinct]struct{}),
+	})
+	return i.(*instrumentGuard)
+}
+
+// admit returns the attributes to record a measurement with. Admitted sets are
+// recorded as given, the SDK view drops the same attributes.
+func (i *instrumentGuard) admit(ctx context.Context, set attribute.Set) metric.MeasurementOption {
+	key := set.Equivalent()
+	i.mu.RLock()
+	admitted, ok := i.known[key]
+	i.mu.RUnlock()
+	if !ok {
+		admitted = i.count(key, set)
+	}
+	if admitted {
+		return metric.WithAttributeSet(set)
+	}
+	if i.g.overflows != nil {
+		i.g.overflows.Add(ctx, 1, metric.WithAttributes(attribute.String("instrument", i.name)))
+	}
+	return metric.WithAttributeSet(overflowSet)
+}
+
+// count admits set if it adds no series or the instrument is under its limit
+func (i *instrumentGuard) count(key attribute.Distinct, set attribute.Set) bool {
+	filtered := set
+	if len(i.dropped) > 0 {
+		filtered, _ = set.Filter(func(kv attribute.KeyValue) bool { return !i.dropped[kv.Key] })
+	}
+	series := filtered.Equivalent()
+
+	i.mu.Lock()
+	_, admitted := i.sets[series]
+	if !admitted && len(i.sets) < i.g.limit {
+		i.sets[series] = struct{}{}
+		admitted = true
+	}
+	if len(i.known) < 2*i.g.limit {
+		i.known[key] = admitted
+	}
+	first := !admitted && !i.warned
+	if first {
+		i.warned = true
+	}
+	i.mu.Unlock()
+
+	if first {
+		log.Printf("⚠️ Metric %s reached %d attribute sets; new ones are recorded as %s", i.name, i.g.limit, OverflowKey)
+	}
+	return admitted
+}
+
+type guardedProvider struct {
+	embedded.MeterProvider
+	mp metric.MeterProvider
+	g  *cardinalityGuard
+}
+
+func (p guardedProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	return guardedMeter{Meter: p.mp.Meter(name, opts...), scope: name, g: p.g}
+}
+
+// guardedMeter guards the synchronous counters and histograms; gauges and
+// observable instruments pass through
+type guardedMeter struct {
+	metric.Meter
+	scope string
+	g     *cardinalityGuard
+}
+
+func (m guardedMeter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	c, err := m.Meter.Int64Counter(name, opts...)
+	if err != nil {
+		return c, err
+	}
+	return guardedInt64Counter{c, m.g.instrument(m.scope, name)}, nil
+}
+
+func (m guardedMeter) Float64Counter(name string, opts ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	c, err := m.Meter.Float64Counter(name, opts...)
+	if err != nil {
+		return c, err
+	}
+	return guardedFloat64Counter{c, m.g.instrument(m.scope, name)}, nil
+}
+
+func (m guardedMeter) Int64UpDownCounter(name string, opts ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	c, err := m.Meter.Int64UpDownCounter(name, opts...)
+	if err != nil {
+		return c, err
+	}
+	return guardedInt64UpDownCounter{c, m.g.instrument(m.scope, name)}, nil
+}
+
+func (m guardedMeter) Float64UpDownCounter(name string, opts ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	c, err := m.Meter.Float64UpDownCounter(name, opts...)
+	if err != nil {
+		return c, err
+	}
+	return guardedFloat64UpDownCounter{c, m.g.instrument(m.scope, name)}, nil
+}
+
+func (m guardedMeter) Int64Histogram(name string, opts ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	h, err := m.Meter.Int64Histogram(name, opts...)
+	if err != nil {
+		return h, err
+	}
+	return guardedInt64Histogram{h, m.g.instrument(m.scope, name)}, nil
+}
+
+func (m guardedMeter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	h, err := m.Meter.Float64Histogram(name, opts...)
+	if err != nil {
+		return h, err
+	}
+	return guardedFloat64Histogram{h, m.g.instrument(m.scope, name)}, nil
+}
+
+type guardedInt64Counter struct {
+	metric.Int64Counter
+	g *instrumentGuard
+}
+
+func (c guardedInt64Counter) Add(ctx context.Context, incr int64, opts ...metric.AddOption) {
+	c.Int64Counter.Add(ctx, incr, c.g.admit(ctx, metric.NewAddConfig(opts).Attributes()))
+}
+
+type guardedFloat64Counter struct {
+	metric.Float64Counter
+	g *instrumentGuard
+}
+
+func (c guardedFloat64Counter) Add(ctx context.Context, incr float64, opts ...metric.AddOption) {
+	c.Float64Counter.Add(ctx, incr, c.g.admit(ctx, metric.NewAddConfig(opts).Attributes()))
+}
+
+type guardedInt64UpDownCounter struct {
+	metric.Int64UpDownCounter
+	g *instrumentGuard
+}
+
+func (c guardedInt64UpDownCounter) Add(ctx context.Context, incr int64, opts ...metric.AddOption) {
+	c.Int64UpDownCounter.Add(ctx, incr, c.g.admit(ctx, metric.NewAddConfig(opts).Attributes()))
+}
+
+type guardedFloat64UpDownCounter struct {
+	metric.Float64UpDownCounter
+	g *instrumentGuard
+}
+
+func (c guardedFloat64UpDownCounter) Add(ctx context.Context, incr float64, opts ...metric.AddOption) {
+	c.Float64UpDownCounter.Add(ctx, incr, c.g.admit(ctx, metric.NewAddConfig(opts).Attributes()))
+}
+
+type guardedInt64Histogram struct {
+	metric.Int64Histogram
+	g *instrumentGuard
+}
+
+func (h guardedInt64Histogram) Record(ctx context.Context, v int64, opts ...metric.RecordOption) {
+	h.Int64Histogram.Record(ctx, v, h.g.admit(ctx, metric.NewRecordConfig(opts).Attributes()))
+}
+
+type guardedFloat64Histogram struct {
+	metric.Float64Histogram
+	g *instrumentGuard
+}
+
+func (h guardedFloat64Histogram) Record(ctx context.Context, v float64, opts ...metric.RecordOption) {
+	h.Float64Histogram.Record(ctx, v, h.g.admit(ctx, metric.NewRecordConfig(opts).Attributes()))
+}
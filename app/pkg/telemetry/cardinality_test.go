@@ -0,0 +1,180 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// guardedTestProvider returns a guarded provider on a manual reader with the
+// default views
+func guardedTestProvider(limit int) (metric.MeterProvider, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	views := DefaultViewConfig()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(View(views)))
+	return GuardCardinality(mp, limit, views), reader
+}
+
+// counterSums returns the points of every Int64 sum named name, keyed by
+// their attributes
+func counterSums(t *testing.T, reader *sdkmetric.ManualReader, name string) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				out[sm.Scope.Name+"{"+dp.Attributes.Encoded(attribute.DefaultEncoder())+"}"] += dp.Value
+			}
+		}
+	}
+	return out
+}
+
+func TestGuardCardinality(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		attrs [][]attribute.KeyValue
+		want  map[string]int64
+	}{
+		{
+			name:  "under the limit",
+			attrs: [][]attribute.KeyValue{{attribute.String("route", "a")}, {attribute.String("route", "b")}, {attribute.String("route", "a")}},
+			want:  map[string]int64{"svc{route=a}": 2, "svc{route=b}": 1},
+		},
+		{
+			name:  "past the limit",
+			attrs: [][]attribute.KeyValue{{attribute.String("route", "a")}, {attribute.String("route", "b")}, {attribute.String("route", "c")}, {attribute.String("route", "d")}, {attribute.String("route", "a")}},
+			want:  map[string]int64{"svc{route=a}": 2, "svc{route=b}": 1, "svc{otel.metric.overflow=true}": 2},
+		},
+		{
+			name: "dropped attributes add no series",
+			attrs: [][]attribute.KeyValue{
+				{attribute.String("route", "a"), attribute.String("user_id", "1")},
+				{attribute.String("route", "a"), attribute.String("user_id", "2")},
+				{attribute.String("route", "a"), attribute.String("user_id", "3")},
+				{attribute.String("route", "b")},
+			},
+			want: map[string]int64{"svc{route=a}": 3, "svc{route=b}": 1},
+		},
+		{
+			name:  "no attributes",
+			attrs: [][]attribute.KeyValue{nil, nil},
+			want:  map[string]int64{"svc{}": 2},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mp, reader := guardedTestProvider(2)
+			counter, err := mp.Meter("svc").Int64Counter("requests_total")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, kvs := range tc.attrs {
+				counter.Add(context.Background(), 1, metric.WithAttributes(kvs...))
+			}
+			assertSums(t, counterSums(t, reader, "requests_total"), tc.want)
+		})
+	}
+}
+
+func TestGuardCardinalityBudgets(t *testing.T) {
+	mp, reader := guardedTestProvider(1)
+	ctx := context.Background()
+
+	// The same name asked for twice in one meter shares a budget
+	first, _ := mp.Meter("core").Int64Counter("requests_total")
+	again, _ := mp.Meter("core").Int64Counter("requests_total")
+	first.Add(ctx, 1, metric.WithAttributes(attribute.String("route", "a")))
+	again.Add(ctx, 1, metric.WithAttributes(attribute.String("route", "b")))
+
+	// Another meter with the same instrument name has its own
+	other, _ := mp.Meter("shadow").Int64Counter("requests_total")
+	other.Add(ctx, 1, metric.WithAttributes(attribute.String("route", "b")))
+
+	// So does another instrument of the same meter
+	histogram, _ := mp.Meter("core").Int64Histogram("sizes")
+	histogram.Record(ctx, 1, metric.WithAttributes(attribute.String("route", "b")))
+
+	assertSums(t, counterSums(t, reader, "requests_total"), map[string]int64{
+		"core{route=a}":                   1,
+		"core{otel.metric.overflow=true}": 1,
+		"shadow{route=b}":                 1,
+	})
+	overflows := counterSums(t, reader, "telemetry_cardinality_overflow_total")
+	assertSums(t, overflows, map[string]int64{"incident-simulation/pkg/telemetry{instrument=requests_total}": 1})
+}
+
+func TestGuardCardinalityConcurrent(t *testing.T) {
+	mp, reader := guardedTestProvider(10)
+	counter, _ := mp.Meter("svc").Int64Counter("requests_total")
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				counter.Add(context.Background(), 1, metric.WithAttributes(
+					attribute.String("route", fmt.Sprint(i%20)),
+					attribute.Int("user_id", w*100+i),
+				))
+			}
+		}()
+	}
+	wg.Wait()
+
+	sums := counterSums(t, reader, "requests_total")
+	var total int64
+	for _, v := range sums {
+		total += v
+	}
+	if len(sums) != 11 || total != 800 || sums["svc{otel.metric.overflow=true}"] != 400 {
+		t.Errorf("got %d series totalling %d: %v, want 10 routes and an overflow of 400 out of 800", len(sums), total, sums)
+	}
+}
+
+func BenchmarkGuardCardinality(b *testing.B) {
+	mp, _ := guardedTestProvider(1000)
+	counter, _ := mp.Meter("svc").Int64Counter("requests_total")
+	opt := metric.WithAttributeSet(attribute.NewSet(attribute.String("route", "/api/transactions"), attribute.String("user_id", "user_1")))
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.Add(ctx, 1, opt)
+		}
+	})
+}
+
+func TestGuardCardinalityDisabled(t *testing.T) {
+	mp := sdkmetric.NewMeterProvider()
+	if got := GuardCardinality(mp, 0, DefaultViewConfig()); got != metric.MeterProvider(mp) {
+		t.Errorf("GuardCardinality with limit 0 wrapped the provider")
+	}
+}
+
+func assertSums(t *testing.T, got, want map[string]int64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+		return
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %d, want %d (all: %v)", k, got[k], v, got)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// responsesMetric is the httpx middleware's response counter, the request
+// count of every service
+const responsesMetric = "http_server_responses_total"
+
+// isCounted picks the counters of the export: the responses and the
+// *errors_total ones, such as api_errors_total
+func isCounted(m metricdata.Metrics) bool {
+	return m.Name == responsesMetric || strings.HasSuffix(m.Name, "errors_total")
+}
+
+// counterKey is one attribute set of a counter
+type counterKey struct {
+	name  string
+	attrs attribute.Distinct
+}
+
+// countMinute is one minute of requests and errors, errors by errorKey
+type countMinute struct {
+	start    time.Time
+	requests int64
+	errors   map[string]int64
+}
+
+// errorKey names what dp counted in the error breakdown: the counter with its
+// error_type, or the 4xx and 5xx responses. Empty for responses that are not
+// errors.
+func errorKey(name string, attrs attribute.Set) string {
+	if name == responsesMetric {
+		class, _ := attrs.Value("status_class")
+		if c := class.AsString(); c == "4xx" || c == "5xx" {
+			return name + "{status_class=" + c + "}"
+		}
+		return ""
+	}
+	if errorType, ok := attrs.Value("error_type"); ok {
+		return name + "{error_type=" + errorType.Emit() + "}"
+	}
+	return name
+}
+
+func (h *Heatmap) count(m metricdata.Metrics, dp metricdata.DataPoint[int64], cumulative bool, minute time.Time) {
+	value := dp.Value
+	if cumulative {
+		key := counterKey{name: m.Name, attrs: dp.Attributes.Equivalent()}
+		prev, seen := h.last[key]
+		h.last[key] = metricdata.DataPoint[int64]{StartTime: dp.StartTime, Value: dp.Value}
+		// A point seen for the first time or restarted counts in full
+		if seen && prev.StartTime.Equal(dp.StartTime) && prev.Value <= dp.Value {
+			value -= prev.Value
+		}
+	}
+	if value == 0 {
+		return
+	}
+
+	if n := len(h.counts); n == 0 || h.counts[n-1].start.Before(minute) {
+		h.counts = append(h.counts, countMinute{start: minute, errors: make(map[string]int64)})
+		if over := len(h.counts) - h.minutes; over > 0 {
+			h.counts = slices.Delete(h.counts, 0, over)
+		}
+	}
+	cur := &h.counts[len(h.counts)-1]
+	if m.Name == responsesMetric {
+		cur.requests += value
+	}
+	if key := errorKey(m.Name, dp.Attributes); key != "" {
+		cur.errors[key] += value
+	}
+}
+
+// LatencySummary is one minute of a latency histogram. Quantiles are
+// interpolated within their bucket, as Prometheus' histogram_quantile does.
+type LatencySummary struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+// MinuteSummary is one line of GET /debug/export: a minute of the service's
+// requests, errors and latency histograms, by name
+type MinuteSummary struct {
+	Service  string                    `json:"service"`
+	Minute   time.Time                 `json:"minute"`
+	Partial  bool                      `json:"partial,omitempty"` // the current minute
+	Requests int64                     `json:"requests"`
+	Errors   map[string]int64          `json:"errors"`
+	Latency  map[string]LatencySummary `json:"latency"`
+}
+
+// Summaries returns the minutes since since, oldest first
+func (h *Heatmap) Summaries(since, now time.Time) []MinuteSummary {
+	since, current := since.Truncate(time.Minute), now.Truncate(time.Minute)
+	byMinute := make(map[time.Time]*MinuteSummary)
+	minute := func(start time.Time) *MinuteSummary {
+		s := byMinute[start]
+		if s == nil {
+			s = &MinuteSummary{
+				Service: h.service,
+				Minute:  start,
+				Partial: start.Equal(current),
+				Errors:  map[string]int64{},
+				Latency: map[string]LatencySummary{},
+			}
+			byMinute[start] = s
+		}
+		return s
+	}
+
+	h.mu.Lock()
+	for _, c := range h.counts {
+		if !c.start.Before(since) {
+			s := minute(c.start)
+			s.Requests = c.requests
+			maps.Copy(s.Errors, c.errors)
+		}
+	}
+	for _, series := range h.series {
+		for _, m := range series.Minutes {
+			if !m.Start.Before(since) {
+				minute(m.Start).Latency[series.Name] = summarize(series.Bounds, m)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	out := make([]MinuteSummary, 0, len(byMinute))
+	for _, start := range slices.SortedFunc(maps.Keys(byMinute), time.Time.Compare) {
+		out = append(out, *byMinute[start])
+	}
+	return out
+}
+
+func summarize(bounds []float64, m HeatmapMinute) LatencySummary {
+	return LatencySummary{
+		Count: m.Count,
+		Mean:  m.Sum / float64(m.Count),
+		P50:   quantile(0.5, bounds, m.Counts, m.Count),
+		P95:   quantile(0.95, bounds, m.Counts, m.Count),
+		P99:   quantile(0.99, bounds, m.Counts, m.Count),
+	}
+}
+
+// quantile estimates the q quantile of a histogram, assuming observations
+// spread evenly within a bucket. The first bucket starts at 0 and the one
+// above every bound has no upper end, so quantiles there are its lower bound.
+func quantile(q float64, bounds []float64, counts []uint64, total uint64) float64 {
+	if total == 0 || len(bounds) == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen float64
+	for i, c := range counts {
+		if c == 0 || seen+float64(c) < rank {
+			seen += float64(c)
+			continue
+		}
+		if i == len(bounds) {
+			return bounds[i-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		}
+		return lower + (bounds[i]-lower)*(rank-seen)/float64(c)
+	}
+	return bounds[len(bounds)-1]
+}
+
+// Export answers GET /debug/export?window=5m with one JSON line per minute
+// of the window, oldest first, for pulling features into offline analysis.
+// The window defaults to all minutes kept.
+func (h *Heatmap) Export() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		now := time.Now()
+		var since time.Time
+		if window := req.URL.Query().Get("window"); window != "" {
+			d, err := time.ParseDuration(window)
+			if err != nil || d <= 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid window: want a positive duration such as 5m"})
+				return
+			}
+			since = now.Add(-d)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for _, s := range h.Summaries(since, now) {
+			if err := enc.Encode(s); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	})
+}
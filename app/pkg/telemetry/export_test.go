@@ -0,0 +1,112 @@
+package telemetry
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestQuantile(t *testing.T) {
+	bounds := []float64{0.1, 0.5, 1}
+	counts := []uint64{50, 40, 9, 1} // 100 observations, one above every bound
+	for _, tc := range []struct {
+		q, want float64
+	}{
+		{0.5, 0.1},
+		{0.7, 0.3},
+		{0.95, 0.5 + 0.5*5/9.0},
+		{0.995, 1},
+	} {
+		if got := quantile(tc.q, bounds, counts, 100); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("quantile(%v) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+	if got := quantile(0.5, bounds, make([]uint64, 4), 0); got != 0 {
+		t.Errorf("quantile of an empty histogram = %v, want 0", got)
+	}
+}
+
+// exportMetrics is one cumulative export: responses, api_errors_total and a
+// latency histogram, each scaled by n
+func exportMetrics(start time.Time, n int64) *metricdata.ResourceMetrics {
+	cumulative := metricdata.CumulativeTemporality
+	class := func(c string) attribute.Set { return attribute.NewSet(attribute.String("status_class", c)) }
+	return &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: []metricdata.Metrics{
+		{Name: "http_server_responses_total", Data: metricdata.Sum[int64]{Temporality: cumulative, DataPoints: []metricdata.DataPoint[int64]{
+			{Attributes: class("2xx"), StartTime: start, Value: 8 * n},
+			{Attributes: class("5xx"), StartTime: start, Value: 2 * n},
+		}}},
+		{Name: "api_errors_total", Data: metricdata.Sum[int64]{Temporality: cumulative, DataPoints: []metricdata.DataPoint[int64]{
+			{Attributes: attribute.NewSet(attribute.String("error_type", "database_error")), StartTime: start, Value: 2 * n},
+		}}},
+		{Name: "api_transactions_total", Data: metricdata.Sum[int64]{Temporality: cumulative, DataPoints: []metricdata.DataPoint[int64]{
+			{StartTime: start, Value: 10 * n},
+		}}},
+		{Name: "api_response_time_seconds", Data: metricdata.Histogram[float64]{Temporality: cumulative, DataPoints: []metricdata.HistogramDataPoint[float64]{
+			{StartTime: start, Bounds: []float64{0.1, 1}, BucketCounts: []uint64{uint64(9 * n), uint64(n), 0}, Count: uint64(10 * n), Sum: float64(n)},
+		}}},
+	}}}}
+}
+
+func TestExport(t *testing.T) {
+	h := NewHeatmap("test-service", 5)
+	start := time.Now().Add(-10 * time.Minute)
+	first := time.Now().Truncate(time.Minute).Add(-2 * time.Minute)
+	h.observe(exportMetrics(start, 1), first)
+	h.observe(exportMetrics(start, 3), first.Add(time.Minute)) // twice as much again
+
+	rec := httptest.NewRecorder()
+	h.Export().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/export?window=5m", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var lines []MinuteSummary
+	for scanner := bufio.NewScanner(rec.Body); scanner.Scan(); {
+		var s MinuteSummary
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, s)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %+v", len(lines), lines)
+	}
+	for i, scale := range []int64{1, 2} {
+		s := lines[i]
+		if !s.Minute.Equal(first.Add(time.Duration(i)*time.Minute)) || s.Service != "test-service" || s.Partial {
+			t.Errorf("line %d is minute %v of %s (partial %v)", i, s.Minute, s.Service, s.Partial)
+		}
+		if s.Requests != 10*scale {
+			t.Errorf("line %d requests = %d, want %d", i, s.Requests, 10*scale)
+		}
+		want := map[string]int64{
+			"http_server_responses_total{status_class=5xx}": 2 * scale,
+			"api_errors_total{error_type=database_error}":   2 * scale,
+		}
+		if len(s.Errors) != len(want) {
+			t.Errorf("line %d errors = %v, want %v", i, s.Errors, want)
+		}
+		for key, n := range want {
+			if s.Errors[key] != n {
+				t.Errorf("line %d errors[%s] = %d, want %d", i, key, s.Errors[key], n)
+			}
+		}
+		latency := s.Latency["api_response_time_seconds"]
+		if latency.Count != uint64(10*scale) || latency.P50 <= 0 || latency.P50 > 0.1 || latency.P99 <= 0.1 {
+			t.Errorf("line %d latency = %+v", i, latency)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.Export().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/export?window=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid window status = %d, want 400", rec.Code)
+	}
+}
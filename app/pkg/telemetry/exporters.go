@@ -0,0 +1,128 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/config"
+)
+
+// Exporter kinds accepted by TELEMETRY_EXPORTER
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Exporters builds the trace, metric and log exporters for the configured
+// destination. In stdout and file mode all three signals share one writer.
+type Exporters struct {
+	kind   string
+	pretty bool
+	otlp   OTLPOptions
+	wait   time.Duration
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewExporters resolves the OTLP connection or opens the stdout/file writer
+func NewExporters(otlp config.OTLP, out config.Output) (*Exporters, error) {
+	e := &Exporters{kind: out.TelemetryExporter}
+
+	switch out.TelemetryFormat {
+	case "jsonl":
+	case "pretty":
+		e.pretty = true
+	default:
+		return nil, fmt.Errorf("unknown telemetry format %q, want jsonl or pretty", out.TelemetryFormat)
+	}
+
+	switch out.TelemetryExporter {
+	case ExporterOTLP:
+		opts, err := NewOTLPOptions(otlp)
+		if err != nil {
+			return nil, err
+		}
+		e.otlp = opts
+		e.wait = otlp.OTLPStartupWait
+	case ExporterStdout:
+		e.w = os.Stdout
+	case ExporterFile:
+		f, err := newRotatingFile(out.TelemetryFile, int64(out.TelemetryFileMaxMB)<<20, out.TelemetryFileBackups)
+		if err != nil {
+			return nil, err
+		}
+		e.w, e.closer = f, f
+	default:
+		return nil, fmt.Errorf("unknown telemetry exporter %q, want otlp, stdout or file", out.TelemetryExporter)
+	}
+	return e, nil
+}
+
+// UsesCollector reports whether telemetry is sent to an OTLP collector
+func (e *Exporters) UsesCollector() bool {
+	return e.kind == ExporterOTLP
+}
+
+// Trace returns the span exporter
+func (e *Exporters) Trace(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if e.kind == ExporterOTLP {
+		return withRetry(ctx, "trace", e.wait, func() (sdktrace.SpanExporter, error) {
+			return otlptracehttp.New(ctx, e.otlp.TraceOptions()...)
+		})
+	}
+	opts := []stdouttrace.Option{stdouttrace.WithWriter(e.w)}
+	if e.pretty {
+		opts = append(opts, stdouttrace.WithPrettyPrint())
+	}
+	return stdouttrace.New(opts...)
+}
+
+// Metric returns the metric exporter
+func (e *Exporters) Metric(ctx context.Context) (sdkmetric.Exporter, error) {
+	if e.kind == ExporterOTLP {
+		return withRetry(ctx, "metric", e.wait, func() (sdkmetric.Exporter, error) {
+			return otlpmetrichttp.New(ctx, e.otlp.MetricOptions()...)
+		})
+	}
+	opts := []stdoutmetric.Option{stdoutmetric.WithWriter(e.w)}
+	if e.pretty {
+		opts = append(opts, stdoutmetric.WithPrettyPrint())
+	}
+	return stdoutmetric.New(opts...)
+}
+
+// Log returns the log record exporter
+func (e *Exporters) Log(ctx context.Context) (sdklog.Exporter, error) {
+	if e.kind == ExporterOTLP {
+		return withRetry(ctx, "log", e.wait, func() (sdklog.Exporter, error) {
+			return otlploghttp.New(ctx, e.otlp.LogOptions()...)
+		})
+	}
+	opts := []stdoutlog.Option{stdoutlog.WithWriter(e.w)}
+	if e.pretty {
+		opts = append(opts, stdoutlog.WithPrettyPrint())
+	}
+	return stdoutlog.New(opts...)
+}
+
+// Close releases the output file; call it after the providers are shut down
+func (e *Exporters) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
@@ -0,0 +1,307 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/config"
+)
+
+// Signals tracked by ExportHealth
+const (
+	SignalTraces  = "traces"
+	SignalMetrics = "metrics"
+	SignalLogs    = "logs"
+)
+
+// SignalHealth is the export record of one signal
+type SignalHealth struct {
+	Exports             int64      `json:"exports"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastDurationMs      float64    `json:"last_duration_ms"`
+	Buffered            int64      `json:"buffered"`
+	BufferDropped       int64      `json:"buffer_dropped"`
+}
+
+// ExportHealth records the outcome of every export, so a wrong endpoint or a
+// collector that is down shows up in /debug/otel, in the telemetry_exports_total
+// and telemetry_export_consecutive_failures metrics and in the service log
+// instead of telemetry disappearing silently. Wrap each exporter with it before
+// handing the exporter to its provider. With OTLP the wrapped span and log
+// exporters also keep what failed to export for the next attempt, up to
+// OTEL_EXPORTER_OTLP_RETRY_BUFFER.
+type ExportHealth struct {
+	exporter string
+	endpoint string
+
+	mu      sync.Mutex
+	signals map[string]*SignalHealth
+	queue   *SpanProcessor
+	// ready is set by the first successful export
+	ready atomic.Bool
+
+	spanBuffer *retryBuffer[sdktrace.ReadOnlySpan]
+	logBuffer  *retryBuffer[sdklog.Record]
+
+	exports metric.Int64Counter
+}
+
+func NewExportHealth(otlp config.OTLP, out config.Output) *ExportHealth {
+	h := &ExportHealth{
+		exporter: out.TelemetryExporter,
+		signals: map[string]*SignalHealth{
+			SignalTraces:  {},
+			SignalMetrics: {},
+			SignalLogs:    {},
+		},
+	}
+	switch out.TelemetryExporter {
+	case ExporterOTLP:
+		h.endpoint = otlp.OTLPEndpoint
+		if otlp.OTLPRetryBuffer > 0 {
+			h.spanBuffer = &retryBuffer[sdktrace.ReadOnlySpan]{signal: "spans", limit: otlp.OTLPRetryBuffer}
+			h.logBuffer = &retryBuffer[sdklog.Record]{signal: "log records", limit: otlp.OTLPRetryBuffer, clone: func(r sdklog.Record) sdklog.Record { return r.Clone() }}
+		}
+	case ExporterFile:
+		h.endpoint = out.TelemetryFile
+	}
+	h.initMetrics()
+	return h
+}
+
+// initMetrics registers the self-metrics on the global meter, which binds
+// once the service sets its meter provider
+func (h *ExportHealth) initMetrics() {
+	meter := otel.Meter("incident-simulation/pkg/telemetry")
+	var err error
+	h.exports, err = meter.Int64Counter("telemetry_exports_total",
+		metric.WithDescription("Telemetry export requests by signal and outcome"))
+	if err != nil {
+		log.Printf("Failed to create telemetry export counter: %v", err)
+	}
+
+	failing, err := meter.Int64ObservableGauge("telemetry_export_consecutive_failures",
+		metric.WithDescription("Exports failed in a row per signal; 0 when the last export succeeded"))
+	if err != nil {
+		log.Printf("Failed to create telemetry failure gauge: %v", err)
+		return
+	}
+	depth, err := meter.Int64ObservableGauge("telemetry_span_queue_depth",
+		metric.WithDescription("Spans waiting for export"))
+	if err != nil {
+		log.Printf("Failed to create span queue gauge: %v", err)
+		return
+	}
+	buffered, err := meter.Int64ObservableGauge("telemetry_export_buffered",
+		metric.WithDescription("Spans and log records of failed exports waiting to be resent"))
+	if err != nil {
+		log.Printf("Failed to create telemetry retry buffer gauge: %v", err)
+		return
+	}
+	bufferDropped, err := meter.Int64ObservableCounter("telemetry_export_buffer_dropped_total",
+		metric.WithDescription("Spans and log records of failed exports dropped because the retry buffer was full"))
+	if err != nil {
+		log.Printf("Failed to create telemetry retry buffer drop counter: %v", err)
+		return
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for signal, s := range h.signals {
+			o.ObserveInt64(failing, s.ConsecutiveFailures, metric.WithAttributes(attribute.String("signal", signal)))
+		}
+		if h.queue != nil {
+			o.ObserveInt64(depth, h.queue.Pending())
+		}
+		if h.spanBuffer != nil {
+			traces := metric.WithAttributes(attribute.String("signal", SignalTraces))
+			logs := metric.WithAttributes(attribute.String("signal", SignalLogs))
+			o.ObserveInt64(buffered, h.spanBuffer.buffered(), traces)
+			o.ObserveInt64(buffered, h.logBuffer.buffered(), logs)
+			o.ObserveInt64(bufferDropped, h.spanBuffer.dropped.Load(), traces)
+			o.ObserveInt64(bufferDropped, h.logBuffer.dropped.Load(), logs)
+		}
+		return nil
+	}, failing, depth, buffered, bufferDropped)
+	if err != nil {
+		log.Printf("Failed to register telemetry health callback: %v", err)
+	}
+}
+
+// record notes one export and logs when a signal starts failing or recovers
+func (h *ExportHealth) record(signal string, start time.Time, err error) {
+	now := time.Now()
+	outcome := "success"
+
+	h.mu.Lock()
+	s := h.signals[signal]
+	s.Exports++
+	s.LastDurationMs = float64(now.Sub(start).Microseconds()) / 1000
+	if err != nil {
+		outcome = "failure"
+		s.Failures++
+		s.ConsecutiveFailures++
+		s.LastFailure = &now
+		s.LastError = err.Error()
+		if s.ConsecutiveFailures == 1 {
+			log.Printf("⚠️ Telemetry %s export to %s failing: %v", signal, h.endpoint, err)
+		}
+	} else {
+		if h.ready.CompareAndSwap(false, true) {
+			log.Printf("✅ Telemetry export to %s succeeded, ready", h.endpoint)
+		}
+		if s.ConsecutiveFailures > 0 {
+			log.Printf("✅ Telemetry %s export recovered after %d failed exports", signal, s.ConsecutiveFailures)
+		}
+		s.ConsecutiveFailures = 0
+		s.LastSuccess = &now
+	}
+	h.mu.Unlock()
+
+	if h.exports != nil {
+		h.exports.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("signal", signal),
+			attribute.String("outcome", outcome),
+		))
+	}
+}
+
+// TrackQueue reports the pending and dropped spans of p
+func (h *ExportHealth) TrackQueue(p *SpanProcessor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.queue = p
+}
+
+// Ready is a readiness check that fails until the first export succeeds, so
+// a service is not sent traffic while its telemetry cannot reach the
+// collector. It stays ready through later failures, which /debug/otel
+// reports instead.
+func (h *ExportHealth) Ready(context.Context) error {
+	if !h.ready.Load() {
+		return errors.New("no telemetry export has succeeded yet")
+	}
+	return nil
+}
+
+// Spans wraps a span exporter
+func (h *ExportHealth) Spans(e sdktrace.SpanExporter) sdktrace.SpanExporter {
+	exporter := &healthSpanExporter{SpanExporter: e, health: h}
+	if h.spanBuffer != nil {
+		return &retrySpanExporter{SpanExporter: exporter, buffer: h.spanBuffer}
+	}
+	return exporter
+}
+
+// Metrics wraps a metric exporter
+func (h *ExportHealth) Metrics(e sdkmetric.Exporter) sdkmetric.Exporter {
+	return &healthMetricExporter{Exporter: e, health: h}
+}
+
+// Logs wraps a log record exporter
+func (h *ExportHealth) Logs(e sdklog.Exporter) sdklog.Exporter {
+	exporter := &healthLogExporter{Exporter: e, health: h}
+	if h.logBuffer != nil {
+		return &retryLogExporter{Exporter: exporter, buffer: h.logBuffer}
+	}
+	return exporter
+}
+
+type healthSpanExporter struct {
+	sdktrace.SpanExporter
+	health *ExportHealth
+}
+
+func (e *healthSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.health.record(SignalTraces, start, err)
+	return err
+}
+
+type healthMetricExporter struct {
+	sdkmetric.Exporter
+	health *ExportHealth
+}
+
+func (e *healthMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	start := time.Now()
+	err := e.Exporter.Export(ctx, rm)
+	e.health.record(SignalMetrics, start, err)
+	return err
+}
+
+type healthLogExporter struct {
+	sdklog.Exporter
+	health *ExportHealth
+}
+
+func (e *healthLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	start := time.Now()
+	err := e.Exporter.Export(ctx, records)
+	e.health.record(SignalLogs, start, err)
+	return err
+}
+
+type queueStatus struct {
+	Pending  int64 `json:"pending"`
+	Capacity int64 `json:"capacity"`
+	Dropped  int64 `json:"dropped"`
+}
+
+type healthResponse struct {
+	Healthy   bool                    `json:"healthy"`
+	Ready     bool                    `json:"ready"`
+	Exporter  string                  `json:"exporter"`
+	Endpoint  string                  `json:"endpoint,omitempty"`
+	SpanQueue *queueStatus            `json:"span_queue,omitempty"`
+	Signals   map[string]SignalHealth `json:"signals"`
+}
+
+// ServeHTTP reports exporter health for GET /debug/otel; 503 while any signal's
+// last export failed
+func (h *ExportHealth) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	resp := healthResponse{Healthy: true, Ready: h.ready.Load(), Exporter: h.exporter, Endpoint: h.endpoint, Signals: make(map[string]SignalHealth)}
+
+	h.mu.Lock()
+	for signal, s := range h.signals {
+		resp.Signals[signal] = *s
+		if s.ConsecutiveFailures > 0 {
+			resp.Healthy = false
+		}
+	}
+	if h.spanBuffer != nil {
+		traces, logs := resp.Signals[SignalTraces], resp.Signals[SignalLogs]
+		traces.Buffered, traces.BufferDropped = h.spanBuffer.buffered(), h.spanBuffer.dropped.Load()
+		logs.Buffered, logs.BufferDropped = h.logBuffer.buffered(), h.logBuffer.dropped.Load()
+		resp.Signals[SignalTraces], resp.Signals[SignalLogs] = traces, logs
+	}
+	if h.queue != nil {
+		resp.SpanQueue = &queueStatus{Pending: h.queue.Pending(), Capacity: h.queue.limit, Dropped: h.queue.Dropped()}
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
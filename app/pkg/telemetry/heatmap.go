@@ -0,0 +1,207 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Heatmap keeps the latency histograms of the last few minutes, one bucket
+// count per minute, for GET /debug/latency-heatmap, and the request and error
+// counts of the same minutes for GET /debug/export. It reads them off the
+// service's own metric exports, so a UI or the analyzer can draw heatmaps
+// without Prometheus.
+type Heatmap struct {
+	service string
+	minutes int
+
+	mu     sync.Mutex
+	series map[string]*heatmapSeries
+	counts []countMinute
+	last   map[counterKey]metricdata.DataPoint[int64] // cumulative counter points last seen
+}
+
+// HeatmapMinute is one minute of a histogram: Counts[i] observations fell
+// at or below Bounds[i] and above the bound before it, the last one above
+// every bound
+type HeatmapMinute struct {
+	Start  time.Time `json:"start"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// HeatmapSeries is the per-minute history of one latency histogram, summed
+// over its attribute sets, oldest minute first
+type HeatmapSeries struct {
+	Name    string          `json:"name"`
+	Unit    string          `json:"unit,omitempty"`
+	Bounds  []float64       `json:"bounds"`
+	Minutes []HeatmapMinute `json:"minutes"`
+}
+
+type heatmapSeries struct {
+	HeatmapSeries
+	last map[attribute.Distinct]metricdata.HistogramDataPoint[float64] // cumulative points last seen
+}
+
+// NewHeatmap keeps minutes minutes of history; minutes <= 0 disables it
+func NewHeatmap(service string, minutes int) *Heatmap {
+	return &Heatmap{
+		service: service,
+		minutes: minutes,
+		series:  make(map[string]*heatmapSeries),
+		last:    make(map[counterKey]metricdata.DataPoint[int64]),
+	}
+}
+
+// Enabled reports whether the heatmap keeps anything
+func (h *Heatmap) Enabled() bool { return h.minutes > 0 }
+
+// Metrics wraps a metric exporter so every export also feeds the heatmap
+func (h *Heatmap) Metrics(e sdkmetric.Exporter) sdkmetric.Exporter {
+	if !h.Enabled() {
+		return e
+	}
+	return &heatmapExporter{Exporter: e, heatmap: h}
+}
+
+type heatmapExporter struct {
+	sdkmetric.Exporter
+	heatmap *Heatmap
+}
+
+func (e *heatmapExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.heatmap.observe(rm, time.Now())
+	return e.Exporter.Export(ctx, rm)
+}
+
+// isLatency picks the histograms to keep: the *_seconds ones and those in
+// seconds, such as otelhttp's http.server.request.duration
+func isLatency(m metricdata.Metrics) bool {
+	return strings.HasSuffix(m.Name, "_seconds") || m.Unit == "s"
+}
+
+// observe adds what each latency histogram and error counter recorded since
+// the last export to the minute of now
+func (h *Heatmap) observe(rm *metricdata.ResourceMetrics, now time.Time) {
+	minute := now.Truncate(time.Minute)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				if !isLatency(m) {
+					continue
+				}
+				for _, dp := range data.DataPoints {
+					h.add(m, dp, data.Temporality == metricdata.CumulativeTemporality, minute)
+				}
+			case metricdata.Sum[int64]:
+				if !isCounted(m) {
+					continue
+				}
+				for _, dp := range data.DataPoints {
+					h.count(m, dp, data.Temporality == metricdata.CumulativeTemporality, minute)
+				}
+			}
+		}
+	}
+}
+
+func (h *Heatmap) add(m metricdata.Metrics, dp metricdata.HistogramDataPoint[float64], cumulative bool, minute time.Time) {
+	s := h.series[m.Name]
+	if s == nil || !slices.Equal(s.Bounds, dp.Bounds) {
+		s = &heatmapSeries{
+			HeatmapSeries: HeatmapSeries{Name: m.Name, Unit: m.Unit, Bounds: slices.Clone(dp.Bounds)},
+			last:          make(map[attribute.Distinct]metricdata.HistogramDataPoint[float64]),
+		}
+		h.series[m.Name] = s
+	}
+
+	counts, count, sum := dp.BucketCounts, dp.Count, dp.Sum
+	if cumulative {
+		key := dp.Attributes.Equivalent()
+		prev, seen := s.last[key]
+		s.last[key] = metricdata.HistogramDataPoint[float64]{
+			StartTime: dp.StartTime, BucketCounts: slices.Clone(dp.BucketCounts), Count: dp.Count, Sum: dp.Sum,
+		}
+		// A point seen for the first time or restarted counts in full
+		if seen && prev.StartTime.Equal(dp.StartTime) && prev.Count <= dp.Count {
+			counts = make([]uint64, len(dp.BucketCounts))
+			for i := range counts {
+				counts[i] = dp.BucketCounts[i] - prev.BucketCounts[i]
+			}
+			count, sum = dp.Count-prev.Count, dp.Sum-prev.Sum
+		}
+	}
+	if count == 0 {
+		return
+	}
+
+	if n := len(s.Minutes); n == 0 || s.Minutes[n-1].Start.Before(minute) {
+		s.Minutes = append(s.Minutes, HeatmapMinute{Start: minute, Counts: make([]uint64, len(dp.Bounds)+1)})
+		if over := len(s.Minutes) - h.minutes; over > 0 {
+			s.Minutes = slices.Delete(s.Minutes, 0, over)
+		}
+	}
+	cur := &s.Minutes[len(s.Minutes)-1]
+	for i, c := range counts {
+		cur.Counts[i] += c
+	}
+	cur.Count += count
+	cur.Sum += sum
+}
+
+// Series returns the histograms, by name, with their minutes since since;
+// an empty name returns them all
+func (h *Heatmap) Series(name string, since time.Time) []HeatmapSeries {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]HeatmapSeries, 0, len(h.series))
+	for _, s := range h.series {
+		if name != "" && s.Name != name {
+			continue
+		}
+		series := HeatmapSeries{Name: s.Name, Unit: s.Unit, Bounds: s.Bounds, Minutes: []HeatmapMinute{}}
+		for _, m := range s.Minutes {
+			if !m.Start.Before(since.Truncate(time.Minute)) {
+				m.Counts = slices.Clone(m.Counts)
+				series.Minutes = append(series.Minutes, m)
+			}
+		}
+		out = append(out, series)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// ServeHTTP answers GET /debug/latency-heatmap?metric=...&since=15m. since
+// accepts RFC 3339, unix seconds or a duration and defaults to all minutes
+// kept; the current minute is partial.
+func (h *Heatmap) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	since, err := parseSince(req.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid since: " + err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service":    h.service,
+		"minutes":    h.minutes,
+		"histograms": h.Series(req.URL.Query().Get("metric"), since),
+	})
+}
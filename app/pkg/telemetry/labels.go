@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/attrs"
+)
+
+// IncidentState reports the simulated incident active right now; kind is
+// "none" when there is none
+type IncidentState func() (active bool, kind string)
+
+// LabelIncidents stamps every span started from now on with the incident
+// state at its start as sim.incident.active and sim.incident.type, so spans
+// the simulator does not touch are labeled too (SIM_LABEL_SPANS). Call it
+// after the global tracer provider is set.
+func LabelIncidents(state IncidentState) error {
+	tp, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	if !ok {
+		return errors.New("telemetry: the global tracer provider is not an SDK provider")
+	}
+	tp.RegisterSpanProcessor(incidentLabeler{state})
+	return nil
+}
+
+type incidentLabeler struct{ state IncidentState }
+
+func (l incidentLabeler) OnStart(_ context.Context, span sdktrace.ReadWriteSpan) {
+	active, kind := l.state()
+	span.SetAttributes(attrs.IncidentActive(active), attrs.IncidentType(kind))
+}
+
+func (incidentLabeler) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (incidentLabeler) Shutdown(context.Context) error   { return nil }
+func (incidentLabeler) ForceFlush(context.Context) error { return nil }
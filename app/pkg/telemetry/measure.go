@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Measurement is a metric attribute set built once, with its options ready to
+// pass to Add and Record. metric.WithAttributes sorts the attributes into a
+// new set and the variadic option escapes on every call, which adds up on a
+// request path recording several metrics per request.
+type Measurement struct {
+	Add    []metric.AddOption
+	Record []metric.RecordOption
+}
+
+// NewMeasurement builds the Measurement of kvs
+func NewMeasurement(kvs ...attribute.KeyValue) Measurement {
+	set := metric.WithAttributeSet(attribute.NewSet(kvs...))
+	return Measurement{Add: []metric.AddOption{set}, Record: []metric.RecordOption{set}}
+}
+
+// Measurements holds the Measurement of every known key, such as the
+// operations a service knows. Keys often come from requests, so unknown ones
+// are built per call rather than kept, which would let clients grow the map.
+type Measurements[K comparable] struct {
+	known map[K]Measurement
+	build func(K) Measurement
+}
+
+// NewMeasurements builds the Measurement of each of keys with build
+func NewMeasurements[K comparable](keys []K, build func(K) Measurement) *Measurements[K] {
+	m := &Measurements[K]{known: make(map[K]Measurement, len(keys)), build: build}
+	for _, k := range keys {
+		m.known[k] = build(k)
+	}
+	return m
+}
+
+// Get returns the Measurement of k
+func (m *Measurements[K]) Get(k K) Measurement {
+	if ms, ok := m.known[k]; ok {
+		return ms
+	}
+	return m.build(k)
+}
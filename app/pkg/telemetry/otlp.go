@@ -0,0 +1,184 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+
+	"incident-simulation/pkg/config"
+)
+
+// OTLPOptions is the resolved connection setup shared by the trace, metric and log exporters
+type OTLPOptions struct {
+	// Endpoint is the collector's host:port
+	Endpoint string
+	// BaseURL is the collector URL the signal paths /v1/traces, /v1/metrics
+	// and /v1/logs are appended to
+	BaseURL  string
+	Insecure bool
+	TLS      *tls.Config
+	Headers  map[string]string
+}
+
+// NewOTLPOptions parses the endpoint, loads the CA bundle and client
+// certificate and parses the headers
+func NewOTLPOptions(cfg config.OTLP) (OTLPOptions, error) {
+	var opts OTLPOptions
+	u, err := endpointURL(cfg)
+	if err != nil {
+		return opts, err
+	}
+	opts.Endpoint, opts.BaseURL, opts.Insecure = hostPort(u), u.String(), u.Scheme == "http"
+
+	headers, err := ParseHeaders(cfg.OTLPHeaders)
+	if err != nil {
+		return opts, err
+	}
+	opts.Headers = headers
+
+	if opts.Insecure {
+		if cfg.OTLPCACert != "" || cfg.OTLPClientCert != "" || cfg.OTLPClientKey != "" {
+			return opts, errors.New("OTLP certificates are set but the OTLP endpoint is plain HTTP")
+		}
+		return opts, nil
+	}
+
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.OTLPCACert != "" {
+		pem, err := os.ReadFile(cfg.OTLPCACert)
+		if err != nil {
+			return opts, fmt.Errorf("read OTLP CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return opts, fmt.Errorf("no certificates found in %s", cfg.OTLPCACert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.OTLPClientCert != "" || cfg.OTLPClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.OTLPClientCert, cfg.OTLPClientKey)
+		if err != nil {
+			return opts, fmt.Errorf("load OTLP client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	opts.TLS = tlsCfg
+	return opts, nil
+}
+
+// endpointURL parses OTEL_EXPORTER_OTLP_ENDPOINT: either a URL, whose
+// scheme decides TLS and whose path prefixes the signal paths (Grafana
+// Cloud's https://otlp-gateway-<zone>.grafana.net/otlp), or a bare host:port
+// that uses TLS unless OTEL_EXPORTER_OTLP_INSECURE is set
+func endpointURL(cfg config.OTLP) (*url.URL, error) {
+	if !strings.Contains(cfg.OTLPEndpoint, "://") {
+		scheme := "https"
+		if cfg.OTLPInsecure {
+			scheme = "http"
+		}
+		return &url.URL{Scheme: scheme, Host: cfg.OTLPEndpoint}, nil
+	}
+	u, err := url.Parse(cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q, want host:port or an http(s) URL", cfg.OTLPEndpoint)
+	}
+	u.Path, u.RawPath = strings.TrimSuffix(u.Path, "/"), ""
+	u.RawQuery, u.Fragment = "", ""
+	return u, nil
+}
+
+// hostPort is u's host with the scheme's default port when it has none
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "http" {
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return net.JoinHostPort(u.Hostname(), "443")
+}
+
+// CollectorAddr is the collector's host:port, for the readiness probes
+func CollectorAddr(cfg config.OTLP) string {
+	u, err := endpointURL(cfg)
+	if err != nil {
+		return cfg.OTLPEndpoint
+	}
+	return hostPort(u)
+}
+
+// ParseHeaders parses the OTEL_EXPORTER_OTLP_HEADERS format: comma separated
+// key=value pairs with URL-encoded values
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q, want key=value", pair)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header value for %s: %w", key, err)
+		}
+		headers[key] = decoded
+	}
+	return headers, nil
+}
+
+// TraceOptions returns the otlptracehttp options for o
+func (o OTLPOptions) TraceOptions() []otlptracehttp.Option {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(o.BaseURL + "/v1/traces")}
+	if o.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(o.TLS))
+	}
+	if len(o.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(o.Headers))
+	}
+	return opts
+}
+
+// MetricOptions returns the otlpmetrichttp options for o
+func (o OTLPOptions) MetricOptions() []otlpmetrichttp.Option {
+	opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(o.BaseURL + "/v1/metrics")}
+	if o.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	} else {
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(o.TLS))
+	}
+	if len(o.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(o.Headers))
+	}
+	return opts
+}
+
+// LogOptions returns the otlploghttp options for o
+func (o OTLPOptions) LogOptions() []otlploghttp.Option {
+	opts := []otlploghttp.Option{otlploghttp.WithEndpointURL(o.BaseURL + "/v1/logs")}
+	if o.Insecure {
+		opts = append(opts, otlploghttp.WithInsecure())
+	} else {
+		opts = append(opts, otlploghttp.WithTLSClientConfig(o.TLS))
+	}
+	if len(o.Headers) > 0 {
+		opts = append(opts, otlploghttp.WithHeaders(o.Headers))
+	}
+	return opts
+}
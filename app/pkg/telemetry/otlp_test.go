@@ -0,0 +1,83 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/config"
+)
+
+func TestNewOTLPOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      config.OTLP
+		endpoint string
+		baseURL  string
+		insecure bool
+		err      string
+	}{
+		{"host:port insecure", config.OTLP{OTLPEndpoint: "localhost:4318", OTLPInsecure: true}, "localhost:4318", "http://localhost:4318", true, ""},
+		{"host:port over TLS", config.OTLP{OTLPEndpoint: "collector:4318"}, "collector:4318", "https://collector:4318", false, ""},
+		{"URL with a base path", config.OTLP{OTLPEndpoint: "https://otlp-gateway-prod-eu-west-2.grafana.net/otlp/", OTLPInsecure: true},
+			"otlp-gateway-prod-eu-west-2.grafana.net:443", "https://otlp-gateway-prod-eu-west-2.grafana.net/otlp", false, ""},
+		{"http URL", config.OTLP{OTLPEndpoint: "http://collector:4318"}, "collector:4318", "http://collector:4318", true, ""},
+		{"http URL without a port", config.OTLP{OTLPEndpoint: "http://collector"}, "collector:80", "http://collector", true, ""},
+		{"unknown scheme", config.OTLP{OTLPEndpoint: "grpc://collector:4317"}, "", "", false, "want host:port or an http(s) URL"},
+		{"CA over plain HTTP", config.OTLP{OTLPEndpoint: "collector:4318", OTLPInsecure: true, OTLPCACert: "ca.pem"}, "", "", false, "plain HTTP"},
+		{"client key over plain HTTP", config.OTLP{OTLPEndpoint: "http://collector:4318", OTLPClientKey: "client.key"}, "", "", false, "plain HTTP"},
+		{"invalid header", config.OTLP{OTLPEndpoint: "collector:4318", OTLPHeaders: "no-value"}, "", "", false, "invalid OTLP header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewOTLPOptions(tc.cfg)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Endpoint != tc.endpoint || opts.BaseURL != tc.baseURL || opts.Insecure != tc.insecure {
+				t.Errorf("got %s %s insecure=%v, want %s %s insecure=%v", opts.Endpoint, opts.BaseURL, opts.Insecure, tc.endpoint, tc.baseURL, tc.insecure)
+			}
+			if addr := CollectorAddr(tc.cfg); addr != tc.endpoint {
+				t.Errorf("CollectorAddr = %s, want %s", addr, tc.endpoint)
+			}
+		})
+	}
+}
+
+func TestOTLPBasePath(t *testing.T) {
+	paths := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case paths <- r.URL.Path:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	opts, err := NewOTLPOptions(config.OTLP{OTLPEndpoint: srv.URL + "/otlp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts.TraceOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := tp.Tracer("test").Start(context.Background(), "span")
+	span.End()
+	tp.Shutdown(context.Background())
+
+	if got := <-paths; got != "/otlp/v1/traces" {
+		t.Errorf("spans posted to %s, want /otlp/v1/traces", got)
+	}
+}
@@ -0,0 +1,35 @@
+package telemetry
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// NewPropagator builds the composite propagator named by OTEL_PROPAGATORS, a
+// comma-separated list of tracecontext, baggage, b3 (single header), b3multi
+// and none. Every listed format is extracted and injected, so a service can
+// take B3 from Zipkin-era callers while passing W3C headers downstream.
+func NewPropagator(names string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "none":
+			return propagation.NewCompositeTextMapPropagator(), nil
+		default:
+			return nil, fmt.Errorf("unsupported propagator %q: want tracecontext, baggage, b3, b3multi or none", strings.TrimSpace(name))
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
@@ -0,0 +1,234 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// RecentSpan is the buffered summary of a finished span
+type RecentSpan struct {
+	Time          time.Time         `json:"time"`
+	TraceID       string            `json:"trace_id"`
+	SpanID        string            `json:"span_id"`
+	ParentSpanID  string            `json:"parent_span_id,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind"`
+	Status        string            `json:"status"`
+	StatusMessage string            `json:"status_message,omitempty"`
+	DurationMs    float64           `json:"duration_ms"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
+
+// RecentLog is the buffered summary of an emitted log record
+type RecentLog struct {
+	Time       time.Time         `json:"time"`
+	Severity   string            `json:"severity"`
+	Body       string            `json:"body"`
+	TraceID    string            `json:"trace_id,omitempty"`
+	SpanID     string            `json:"span_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ring is a fixed-size buffer that overwrites its oldest entry
+type ring[T any] struct {
+	items []T
+	next  int
+	full  bool
+}
+
+func (r *ring[T]) add(v T) {
+	if len(r.items) == 0 {
+		return
+	}
+	r.items[r.next] = v
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// ordered returns the entries oldest first
+func (r *ring[T]) ordered() []T {
+	if !r.full {
+		return append([]T(nil), r.items[:r.next]...)
+	}
+	return append(append([]T(nil), r.items[r.next:]...), r.items[:r.next]...)
+}
+
+// Recorder keeps the last spans and log records in memory. It is both a span
+// processor and a log processor; errors are always kept, everything else is
+// kept with probability sampleRate.
+type Recorder struct {
+	service    string
+	sampleRate float64
+
+	mu    sync.Mutex
+	spans ring[RecentSpan]
+	logs  ring[RecentLog]
+}
+
+// NewRecorder returns a Recorder holding up to size spans and size log records
+func NewRecorder(service string, size int, sampleRate float64) *Recorder {
+	if size < 0 {
+		size = 0
+	}
+	return &Recorder{
+		service:    service,
+		sampleRate: sampleRate,
+		spans:      ring[RecentSpan]{items: make([]RecentSpan, size)},
+		logs:       ring[RecentLog]{items: make([]RecentLog, size)},
+	}
+}
+
+func (r *Recorder) keep(isError bool) bool {
+	return isError || r.sampleRate >= 1 || rand.Float64() < r.sampleRate
+}
+
+// OnStart implements sdktrace.SpanProcessor
+func (r *Recorder) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd implements sdktrace.SpanProcessor
+func (r *Recorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	status := s.Status()
+	if !r.keep(status.Code == codes.Error) {
+		return
+	}
+
+	attrs := make(map[string]string, len(s.Attributes()))
+	for _, kv := range s.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	span := RecentSpan{
+		Time:          s.EndTime(),
+		TraceID:       s.SpanContext().TraceID().String(),
+		SpanID:        s.SpanContext().SpanID().String(),
+		Name:          s.Name(),
+		Kind:          s.SpanKind().String(),
+		Status:        status.Code.String(),
+		StatusMessage: status.Description,
+		DurationMs:    float64(s.EndTime().Sub(s.StartTime()).Microseconds()) / 1000,
+		Attributes:    attrs,
+	}
+	if s.Parent().IsValid() {
+		span.ParentSpanID = s.Parent().SpanID().String()
+	}
+
+	r.mu.Lock()
+	r.spans.add(span)
+	r.mu.Unlock()
+}
+
+// OnEmit implements sdklog.Processor
+func (r *Recorder) OnEmit(_ context.Context, rec *sdklog.Record) error {
+	if !r.keep(rec.Severity() >= log.SeverityError) {
+		return nil
+	}
+
+	attrs := make(map[string]string, rec.AttributesLen())
+	rec.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.String()
+		return true
+	})
+	entry := RecentLog{
+		Time:       rec.Timestamp(),
+		Severity:   rec.SeverityText(),
+		Body:       rec.Body().String(),
+		Attributes: attrs,
+	}
+	if entry.Severity == "" {
+		entry.Severity = rec.Severity().String()
+	}
+	if entry.Time.IsZero() {
+		entry.Time = rec.ObservedTimestamp()
+	}
+	if rec.TraceID().IsValid() {
+		entry.TraceID = rec.TraceID().String()
+		entry.SpanID = rec.SpanID().String()
+	}
+
+	r.mu.Lock()
+	r.logs.add(entry)
+	r.mu.Unlock()
+	return nil
+}
+
+// Shutdown implements sdktrace.SpanProcessor and sdklog.Processor
+func (r *Recorder) Shutdown(context.Context) error { return nil }
+
+// ForceFlush implements sdktrace.SpanProcessor and sdklog.Processor
+func (r *Recorder) ForceFlush(context.Context) error { return nil }
+
+// Recent returns buffered spans and logs at or after since, newest last
+func (r *Recorder) Recent(since time.Time) ([]RecentSpan, []RecentLog) {
+	r.mu.Lock()
+	spans, logs := r.spans.ordered(), r.logs.ordered()
+	r.mu.Unlock()
+
+	outSpans := spans[:0]
+	for _, s := range spans {
+		if !s.Time.Before(since) {
+			outSpans = append(outSpans, s)
+		}
+	}
+	outLogs := logs[:0]
+	for _, l := range logs {
+		if !l.Time.Before(since) {
+			outLogs = append(outLogs, l)
+		}
+	}
+	return outSpans, outLogs
+}
+
+// ServeHTTP answers GET /debug/telemetry/recent?since=...&errors_only=true.
+// since accepts RFC 3339, unix seconds or a duration such as 5m (relative to now).
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	since, err := parseSince(req.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid since: " + err.Error()})
+		return
+	}
+
+	spans, logs := r.Recent(since)
+	if req.URL.Query().Get("errors_only") == "true" {
+		filtered := spans[:0]
+		for _, s := range spans {
+			if s.Status == codes.Error.String() {
+				filtered = append(filtered, s)
+			}
+		}
+		spans = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service": r.service,
+		"since":   since,
+		"spans":   spans,
+		"logs":    logs,
+	})
+}
+
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
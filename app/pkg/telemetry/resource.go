@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/buildinfo"
+)
+
+// DefaultEnvironment is the deployment environment unless
+// OTEL_RESOURCE_ATTRIBUTES sets one
+const DefaultEnvironment = "development"
+
+// NewResource describes the service for traces, metrics and logs, with the
+// version, commit and build time of pkg/buildinfo and a random
+// service.instance.id. The process, host and container detectors add where it
+// runs, and OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME are applied last so
+// they override the name, version, instance and environment set here. Attributes that a
+// detector cannot read are skipped with a log line rather than failing.
+func NewResource(ctx context.Context, serviceName string) (*resource.Resource, error) {
+	build := buildinfo.Get(serviceName)
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(build.Version),
+			semconv.ServiceInstanceID(newInstanceID()),
+			semconv.VCSRefHeadRevision(build.Commit),
+			attrs.BuildTime(build.BuildTime),
+			semconv.DeploymentEnvironmentName(DefaultEnvironment),
+		),
+		resource.WithTelemetrySDK(),
+		// WithProcess without the command line, whose flags may carry OTLP headers
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessExecutablePath(),
+		resource.WithProcessOwner(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithProcessRuntimeDescription(),
+		resource.WithHost(),
+		resource.WithContainer(),
+		resource.WithFromEnv(),
+	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		log.Printf("Some resource attributes were not detected: %v", err)
+		return res, nil
+	}
+	return res, err
+}
+
+// newInstanceID returns a random UUID, as the conventions recommend for
+// service.instance.id when nothing names the instance
+func newInstanceID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,128 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Backoff between attempts to create an exporter
+const (
+	retryInitialBackoff = 500 * time.Millisecond
+	retryMaxBackoff     = 10 * time.Second
+)
+
+// Largest batch a retry buffer resends in one export
+const resendBatchSize = 512
+
+// withRetry calls create until it succeeds or wait has passed, backing off
+// exponentially in between, so a collector that is not up yet does not stop
+// the service
+func withRetry[T any](ctx context.Context, signal string, wait time.Duration, create func() (T, error)) (T, error) {
+	deadline := time.Now().Add(wait)
+	backoff := retryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		v, err := create()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("✅ Telemetry %s exporter created after %d attempts", signal, attempt)
+			}
+			return v, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return v, fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+		log.Printf("⚠️ Creating the telemetry %s exporter failed (attempt %d), retrying in %s: %v", signal, attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return v, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, retryMaxBackoff)
+	}
+}
+
+// retryBuffer keeps the spans or log records of failed exports, dropping
+// the oldest beyond limit, and resends them ahead of the next batch. While
+// the collector is unreachable the service runs degraded rather than losing
+// everything it emits; once an export succeeds the backlog follows.
+// Metrics are not buffered: their cumulative totals are re-exported anyway.
+type retryBuffer[T any] struct {
+	signal string
+	limit  int
+	clone  func(T) T
+
+	mu    sync.Mutex
+	items []T
+	// count mirrors len(items) for readers that must not wait on an export
+	count   atomic.Int64
+	dropped atomic.Int64
+}
+
+// export sends the buffered items and then batch through send, buffering
+// whatever could not be sent. Exports of one signal run one at a time.
+func (b *retryBuffer[T]) export(ctx context.Context, batch []T, send func(context.Context, []T) error) error {
+	b.mu.Lock()
+	defer func() {
+		b.count.Store(int64(len(b.items)))
+		b.mu.Unlock()
+	}()
+
+	if n := len(b.items); n > 0 {
+		for len(b.items) > 0 {
+			chunk := b.items[:min(len(b.items), resendBatchSize)]
+			if err := send(ctx, chunk); err != nil {
+				b.add(batch)
+				return err
+			}
+			b.items = b.items[len(chunk):]
+		}
+		b.items = nil
+		log.Printf("✅ Resent %d buffered telemetry %s after the collector came back", n, b.signal)
+	}
+	if err := send(ctx, batch); err != nil {
+		b.add(batch)
+		return err
+	}
+	return nil
+}
+
+// add buffers batch, dropping the oldest items beyond the limit
+func (b *retryBuffer[T]) add(batch []T) {
+	for _, item := range batch {
+		if b.clone != nil {
+			item = b.clone(item)
+		}
+		b.items = append(b.items, item)
+	}
+	if over := len(b.items) - b.limit; over > 0 {
+		b.items = append(b.items[:0:0], b.items[over:]...)
+		b.dropped.Add(int64(over))
+	}
+}
+
+func (b *retryBuffer[T]) buffered() int64 { return b.count.Load() }
+
+type retrySpanExporter struct {
+	sdktrace.SpanExporter
+	buffer *retryBuffer[sdktrace.ReadOnlySpan]
+}
+
+func (e *retrySpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return e.buffer.export(ctx, spans, e.SpanExporter.ExportSpans)
+}
+
+type retryLogExporter struct {
+	sdklog.Exporter
+	buffer *retryBuffer[sdklog.Record]
+}
+
+func (e *retryLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	return e.buffer.export(ctx, records, e.Exporter.Export)
+}
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"incident-simulation/pkg/config"
+)
+
+// flakySpanExporter fails while down and records the names it exported
+type flakySpanExporter struct {
+	sdktrace.SpanExporter
+	down     bool
+	exported []string
+}
+
+func (e *flakySpanExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if e.down {
+		return errors.New("connection refused")
+	}
+	for _, s := range spans {
+		e.exported = append(e.exported, s.Name())
+	}
+	return nil
+}
+
+func spans(names ...string) []sdktrace.ReadOnlySpan {
+	stubs := make(tracetest.SpanStubs, len(names))
+	for i, name := range names {
+		stubs[i].Name = name
+	}
+	return stubs.Snapshots()
+}
+
+func TestRetryBuffer(t *testing.T) {
+	h := NewExportHealth(config.OTLP{OTLPEndpoint: "collector:4318", OTLPRetryBuffer: 3}, config.Output{TelemetryExporter: ExporterOTLP})
+	flaky := &flakySpanExporter{down: true}
+	exporter := h.Spans(flaky)
+	ctx := context.Background()
+
+	if err := exporter.ExportSpans(ctx, spans("a", "b")); err == nil {
+		t.Fatal("export to a down collector succeeded")
+	}
+	exporter.ExportSpans(ctx, spans("c", "d"))
+	if h.Ready(ctx) == nil {
+		t.Error("ready before any export succeeded")
+	}
+	if got, dropped := h.spanBuffer.buffered(), h.spanBuffer.dropped.Load(); got != 3 || dropped != 1 {
+		t.Errorf("buffered %d dropped %d, want 3 and the oldest dropped", got, dropped)
+	}
+
+	flaky.down = false
+	if err := exporter.ExportSpans(ctx, spans("e")); err != nil {
+		t.Fatal(err)
+	}
+	if got := flaky.exported; len(got) != 4 || got[0] != "b" || got[3] != "e" {
+		t.Errorf("exported %v, want the buffered b c d ahead of e", got)
+	}
+	if h.spanBuffer.buffered() != 0 || h.Ready(ctx) != nil {
+		t.Errorf("buffered %d ready %v after the collector came back", h.spanBuffer.buffered(), h.Ready(ctx))
+	}
+	if s := h.signals[SignalTraces]; s.Exports != 4 || s.Failures != 2 {
+		t.Errorf("traces health %+v, want every attempt recorded", *s)
+	}
+}
@@ -0,0 +1,131 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/config"
+)
+
+// DebugTraceHeader set to 1 or true forces the trace of a request to be
+// sampled, with debug detail on its spans
+const DebugTraceHeader = "X-Debug-Trace"
+
+// debugBaggageKey carries the debug mark to the services a debug request
+// calls, through the baggage propagator
+const debugBaggageKey = "debug.trace"
+
+// Why a request is debugged, the value of app.debug.trace
+const (
+	debugByHeader   = "header"
+	debugByUser     = "user"
+	debugByUpstream = "upstream"
+)
+
+// sensitiveHeaders are left out of the header attributes of a debug request
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+type debugKey struct{}
+
+// debugRequest is a request whose trace is sampled whatever the ratio
+type debugRequest struct {
+	reason string
+	header http.Header
+}
+
+// NewSampler samples TRACE_SAMPLE_RATIO of the new traces by trace ID and
+// follows the caller's decision for the others, except for debug requests
+// (see DebugTraces): those are always sampled and every span they start gets
+// app.debug.trace, their server span also the request headers as
+// http.request.header.* attributes.
+func NewSampler(cfg config.Sampling) sdktrace.Sampler {
+	return debugSampler{next: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio))}
+}
+
+type debugSampler struct {
+	next sdktrace.Sampler
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	d, ok := p.ParentContext.Value(debugKey{}).(*debugRequest)
+	if !ok {
+		return s.next.ShouldSample(p)
+	}
+	result := sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Attributes: []attribute.KeyValue{attrs.DebugTrace(d.reason)},
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+	if p.Kind == trace.SpanKindServer {
+		for name, values := range d.header {
+			if !sensitiveHeaders[name] {
+				result.Attributes = append(result.Attributes, attribute.StringSlice("http.request.header."+strings.ToLower(name), values))
+			}
+		}
+	}
+	return result
+}
+
+func (s debugSampler) Description() string {
+	return "DebugOverride{" + s.next.Description() + "}"
+}
+
+// IsDebug tells whether ctx belongs to a debug request, for code that adds
+// detail only then
+func IsDebug(ctx context.Context) bool {
+	_, ok := ctx.Value(debugKey{}).(*debugRequest)
+	return ok
+}
+
+// DebugTraces marks a request as a debug request when it carries
+// X-Debug-Trace: 1, comes from one of the DEBUG_TRACE_USERS or continues a
+// debug request of a caller, so NewSampler samples it. It must wrap otelhttp,
+// which starts the server span. userID tells the user of a request and may be
+// nil. The mark goes on to the services the request calls as baggage, so it
+// needs the baggage propagator on both sides.
+func DebugTraces(cfg config.Sampling, userID func(*http.Request) string, next http.Handler) http.Handler {
+	users := keySet(cfg.DebugTraceUsers)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason := debugReason(r, users, userID)
+		if reason == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), debugKey{}, &debugRequest{reason: reason, header: r.Header.Clone()})
+		// Added to the incoming baggage, which otelhttp puts in the context
+		// that outgoing calls inject from
+		bag, _ := baggage.Parse(r.Header.Get("baggage"))
+		if m, err := baggage.NewMemberRaw(debugBaggageKey, "1"); err == nil {
+			if bag, err = bag.SetMember(m); err == nil {
+				r.Header.Set("baggage", bag.String())
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func debugReason(r *http.Request, users map[string]bool, userID func(*http.Request) string) string {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(DebugTraceHeader))) {
+	case "1", "true":
+		return debugByHeader
+	}
+	if bag, err := baggage.Parse(r.Header.Get("baggage")); err == nil && bag.Member(debugBaggageKey).Value() != "" {
+		return debugByUpstream
+	}
+	if len(users) > 0 && userID != nil && users[userID(r)] {
+		return debugByUser
+	}
+	return ""
+}
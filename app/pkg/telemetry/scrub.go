@@ -0,0 +1,186 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/config"
+)
+
+// Scrubber removes personal data from span and log attributes before export:
+// hashed keys keep a keyed hash of their value, so one user's requests still
+// group together, dropped keys are removed, and amount keys are removed when
+// their value is above the threshold
+type Scrubber struct {
+	hash      map[string]bool
+	drop      map[string]bool
+	amounts   map[string]bool
+	threshold float64
+	key       []byte
+}
+
+// NewScrubber returns the scrubber cfg describes, nil when it scrubs nothing;
+// the methods of a nil Scrubber pass everything through
+func NewScrubber(cfg config.Scrubbing) *Scrubber {
+	s := &Scrubber{
+		hash:      keySet(cfg.ScrubHashAttributes),
+		drop:      keySet(cfg.ScrubDropAttributes),
+		threshold: cfg.ScrubAmountThreshold,
+		key:       []byte(cfg.ScrubKey),
+	}
+	if cfg.ScrubAmountThreshold > 0 {
+		s.amounts = keySet(cfg.ScrubAmountAttributes)
+	}
+	if len(s.hash) == 0 && len(s.drop) == 0 && len(s.amounts) == 0 {
+		return nil
+	}
+	return s
+}
+
+func keySet(list string) map[string]bool {
+	var set map[string]bool
+	for _, k := range strings.Split(list, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			if set == nil {
+				set = make(map[string]bool)
+			}
+			set[k] = true
+		}
+	}
+	return set
+}
+
+// digest returns the value hashed attributes are replaced with
+func (s *Scrubber) digest(value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(value))
+	return "redacted:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// SpanProcessor wraps next so the spans it receives at their end carry
+// scrubbed attributes and event attributes. Spans are read-only by then, so
+// the scrubber sits in front of each processor that exports or keeps spans
+// rather than beside them.
+func (s *Scrubber) SpanProcessor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	if s == nil {
+		return next
+	}
+	return spanScrubber{SpanProcessor: next, s: s}
+}
+
+type spanScrubber struct {
+	sdktrace.SpanProcessor
+	s *Scrubber
+}
+
+func (p spanScrubber) OnEnd(span sdktrace.ReadOnlySpan) {
+	attrs, changed := p.s.attributes(span.Attributes())
+	events := span.Events()
+	var scrubbedEvents []sdktrace.Event
+	for i, e := range events {
+		if eventAttrs, ok := p.s.attributes(e.Attributes); ok {
+			if scrubbedEvents == nil {
+				scrubbedEvents = append([]sdktrace.Event(nil), events...)
+			}
+			scrubbedEvents[i].Attributes = eventAttrs
+		}
+	}
+	if !changed && scrubbedEvents == nil {
+		p.SpanProcessor.OnEnd(span)
+		return
+	}
+	if scrubbedEvents == nil {
+		scrubbedEvents = events
+	}
+	p.SpanProcessor.OnEnd(scrubbedSpan{ReadOnlySpan: span, attrs: attrs, events: scrubbedEvents})
+}
+
+type scrubbedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []sdktrace.Event
+}
+
+func (s scrubbedSpan) Attributes() []attribute.KeyValue { return s.attrs }
+func (s scrubbedSpan) Events() []sdktrace.Event         { return s.events }
+
+// attributes returns kvs scrubbed and whether anything changed; kvs itself
+// is left alone as it belongs to the span
+func (s *Scrubber) attributes(kvs []attribute.KeyValue) ([]attribute.KeyValue, bool) {
+	out := make([]attribute.KeyValue, 0, len(kvs))
+	changed := false
+	for _, kv := range kvs {
+		key := string(kv.Key)
+		switch {
+		case s.drop[key], s.amounts[key] && s.overThreshold(kv.Value):
+			changed = true
+			continue
+		case s.hash[key]:
+			kv, changed = kv.Key.String(s.digest(kv.Value.Emit())), true
+		}
+		out = append(out, kv)
+	}
+	return out, changed
+}
+
+func (s *Scrubber) overThreshold(v attribute.Value) bool {
+	switch v.Type() {
+	case attribute.FLOAT64:
+		return v.AsFloat64() > s.threshold
+	case attribute.INT64:
+		return float64(v.AsInt64()) > s.threshold
+	}
+	return false
+}
+
+// LogProcessor scrubs log record attributes in place; register it before the
+// processors that export or keep records, as they see its changes
+func (s *Scrubber) LogProcessor() sdklog.Processor {
+	return logScrubber{s}
+}
+
+type logScrubber struct{ s *Scrubber }
+
+func (p logScrubber) OnEmit(_ context.Context, rec *sdklog.Record) error {
+	if p.s == nil {
+		return nil
+	}
+	changed := false
+	kvs := make([]log.KeyValue, 0, rec.AttributesLen())
+	rec.WalkAttributes(func(kv log.KeyValue) bool {
+		switch {
+		case p.s.drop[kv.Key], p.s.amounts[kv.Key] && p.s.logOverThreshold(kv.Value):
+			changed = true
+			return true
+		case p.s.hash[kv.Key]:
+			kv, changed = log.String(kv.Key, p.s.digest(kv.Value.String())), true
+		}
+		kvs = append(kvs, kv)
+		return true
+	})
+	if changed {
+		rec.SetAttributes(kvs...)
+	}
+	return nil
+}
+
+func (logScrubber) Shutdown(context.Context) error   { return nil }
+func (logScrubber) ForceFlush(context.Context) error { return nil }
+
+func (s *Scrubber) logOverThreshold(v log.Value) bool {
+	switch v.Kind() {
+	case log.KindFloat64:
+		return v.AsFloat64() > s.threshold
+	case log.KindInt64:
+		return float64(v.AsInt64()) > s.threshold
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/config"
+)
+
+var testScrubbing = config.Scrubbing{
+	ScrubHashAttributes:   "user.id,user_id",
+	ScrubDropAttributes:   "app.transfer.recipient",
+	ScrubAmountAttributes: "app.transaction.amount,amount",
+	ScrubAmountThreshold:  1000,
+	ScrubKey:              "test-key",
+}
+
+func TestNewScrubberDisabled(t *testing.T) {
+	if s := NewScrubber(config.Scrubbing{ScrubAmountAttributes: "amount"}); s != nil {
+		t.Fatalf("NewScrubber without hash, drop or threshold = %+v, want nil", s)
+	}
+	var s *Scrubber
+	next := tracetest.NewSpanRecorder()
+	if p := s.SpanProcessor(next); p != sdktrace.SpanProcessor(next) {
+		t.Errorf("nil Scrubber wrapped the span processor")
+	}
+}
+
+func TestScrubberSpans(t *testing.T) {
+	s := NewScrubber(testScrubbing)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.SpanProcessor(recorder)))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "transfer")
+	span.SetAttributes(
+		attribute.String("user.id", "user_1"),
+		attribute.String("app.transfer.recipient", "user_2"),
+		attribute.Float64("app.transaction.amount", 5000),
+		attribute.String("operation", "transfer"),
+	)
+	span.AddEvent("debit", trace.WithAttributes(attribute.String("user_id", "user_1"), attribute.Int("amount", 10)))
+	span.End()
+
+	ended := recorder.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("got %d spans, want 1", len(ended))
+	}
+	got := attributeMap(ended[0].Attributes())
+	want := map[string]string{"user.id": s.digest("user_1"), "operation": "transfer"}
+	assertAttributes(t, "span", got, want)
+
+	events := ended[0].Events()
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	assertAttributes(t, "event", attributeMap(events[0].Attributes), map[string]string{
+		"user_id": s.digest("user_1"),
+		"amount":  "10",
+	})
+}
+
+func TestScrubberSpanUntouched(t *testing.T) {
+	s := NewScrubber(testScrubbing)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.SpanProcessor(recorder)))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "health")
+	span.SetAttributes(attribute.Float64("app.transaction.amount", 999))
+	span.End()
+
+	ended := recorder.Ended()[0]
+	if _, scrubbed := ended.(scrubbedSpan); scrubbed {
+		t.Errorf("span without scrubbed attributes was copied")
+	}
+	assertAttributes(t, "span", attributeMap(ended.Attributes()), map[string]string{"app.transaction.amount": "999"})
+}
+
+func TestScrubberHash(t *testing.T) {
+	s := NewScrubber(testScrubbing)
+	if s.digest("user_1") != s.digest("user_1") {
+		t.Errorf("digest is not stable")
+	}
+	if s.digest("user_1") == s.digest("user_2") {
+		t.Errorf("different values share a digest")
+	}
+	other := testScrubbing
+	other.ScrubKey = "other-key"
+	if NewScrubber(other).digest("user_1") == s.digest("user_1") {
+		t.Errorf("digest does not depend on the key")
+	}
+}
+
+func TestScrubberLogs(t *testing.T) {
+	s := NewScrubber(testScrubbing)
+	records := &logCollector{}
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(s.LogProcessor()),
+		sdklog.WithProcessor(records),
+	)
+
+	var rec log.Record
+	rec.SetBody(log.StringValue("transfer failed"))
+	rec.AddAttributes(
+		log.String("user_id", "user_1"),
+		log.String("app.transfer.recipient", "user_2"),
+		log.Float64("amount", 1500.5),
+		log.Int64("app.transaction.amount", 20),
+		log.String("error", "insufficient funds"),
+	)
+	lp.Logger("test").Emit(context.Background(), rec)
+
+	if len(records.attrs) != 1 {
+		t.Fatalf("got %d records, want 1", len(records.attrs))
+	}
+	assertAttributes(t, "log", records.attrs[0], map[string]string{
+		"user_id":                s.digest("user_1"),
+		"app.transaction.amount": "20",
+		"error":                  "insufficient funds",
+	})
+}
+
+func TestNilScrubberLogs(t *testing.T) {
+	var s *Scrubber
+	records := &logCollector{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(s.LogProcessor()), sdklog.WithProcessor(records))
+
+	var rec log.Record
+	rec.AddAttributes(log.String("user_id", "user_1"))
+	lp.Logger("test").Emit(context.Background(), rec)
+
+	assertAttributes(t, "log", records.attrs[0], map[string]string{"user_id": "user_1"})
+}
+
+// logCollector keeps the attributes of every record it sees
+type logCollector struct {
+	attrs []map[string]string
+}
+
+func (c *logCollector) OnEmit(_ context.Context, rec *sdklog.Record) error {
+	attrs := make(map[string]string)
+	rec.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.String()
+		return true
+	})
+	c.attrs = append(c.attrs, attrs)
+	return nil
+}
+
+func (*logCollector) Shutdown(context.Context) error   { return nil }
+func (*logCollector) ForceFlush(context.Context) error { return nil }
+
+func attributeMap(kvs []attribute.KeyValue) map[string]string {
+	out := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		out[string(kv.Key)] = kv.Value.Emit()
+	}
+	return out
+}
+
+func assertAttributes(t *testing.T, what string, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s attributes = %v, want %v", what, got, want)
+		return
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s attribute %s = %q, want %q", what, k, got[k], v)
+		}
+	}
+}
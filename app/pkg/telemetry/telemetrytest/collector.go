@@ -0,0 +1,403 @@
+// Package telemetrytest is an in-memory OTLP/HTTP collector for tests. Point
+// a service's exporters at Collector.Endpoint, exercise it, shut its providers
+// down so everything is flushed, and assert on the spans, metric points and
+// log records received, flattened into plain structs.
+package telemetrytest
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Collector accepts OTLP/HTTP protobuf exports on /v1/traces, /v1/metrics
+// and /v1/logs and keeps everything it receives
+type Collector struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	spans   []Span
+	points  []Point
+	records []LogRecord
+}
+
+// Span is one received span; attribute values are rendered as strings
+type Span struct {
+	Service       string
+	Scope         string
+	Name          string
+	Kind          string // server, client, internal, producer or consumer
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	StatusCode    string // unset, ok or error
+	StatusMessage string
+	Attributes    map[string]string
+	Events        []Event
+	Links         []Link
+}
+
+// Event is a span event
+type Event struct {
+	Name       string
+	Attributes map[string]string
+}
+
+// Link is a span link to the span SpanID of trace TraceID
+type Link struct {
+	TraceID    string
+	SpanID     string
+	Attributes map[string]string
+}
+
+// Point is one metric data point: Value holds sums and gauges, Count and Sum
+// histograms
+type Point struct {
+	Service    string
+	Scope      string
+	Name       string
+	Unit       string
+	Attributes map[string]string
+	Value      float64
+	Count      uint64
+	Sum        float64
+}
+
+// LogRecord is one received log record
+type LogRecord struct {
+	Service    string
+	Scope      string
+	Body       string
+	Severity   string // the severity text, else trace, debug, info, warn, error or fatal from its number
+	Attributes map[string]string
+	TraceID    string
+	SpanID     string
+}
+
+// NewCollector starts a collector that is closed when the test ends
+func NewCollector(t testing.TB) *Collector {
+	c := &Collector{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", c.handle(&coltracepb.ExportTraceServiceRequest{}, c.addTraces))
+	mux.HandleFunc("POST /v1/metrics", c.handle(&colmetricpb.ExportMetricsServiceRequest{}, c.addMetrics))
+	mux.HandleFunc("POST /v1/logs", c.handle(&collogspb.ExportLogsServiceRequest{}, c.addLogs))
+	c.server = httptest.NewServer(mux)
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+// Endpoint is the host:port for OTEL_EXPORTER_OTLP_ENDPOINT (plain HTTP)
+func (c *Collector) Endpoint() string {
+	return strings.TrimPrefix(c.server.URL, "http://")
+}
+
+func (c *Collector) handle(msg proto.Message, add func(proto.Message)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req := proto.Clone(msg)
+		proto.Reset(req)
+		if err := proto.Unmarshal(data, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		add(req)
+		c.mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (c *Collector) addTraces(msg proto.Message) {
+	for _, rs := range msg.(*coltracepb.ExportTraceServiceRequest).ResourceSpans {
+		service := serviceName(rs.Resource)
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				span := Span{
+					Service:       service,
+					Scope:         ss.GetScope().GetName(),
+					Name:          s.Name,
+					Kind:          spanKind(s.Kind),
+					TraceID:       hex.EncodeToString(s.TraceId),
+					SpanID:        hex.EncodeToString(s.SpanId),
+					ParentSpanID:  hex.EncodeToString(s.ParentSpanId),
+					StatusCode:    statusCode(s.GetStatus().GetCode()),
+					StatusMessage: s.GetStatus().GetMessage(),
+					Attributes:    attributes(s.Attributes),
+				}
+				for _, e := range s.Events {
+					span.Events = append(span.Events, Event{Name: e.Name, Attributes: attributes(e.Attributes)})
+				}
+				for _, l := range s.Links {
+					span.Links = append(span.Links, Link{
+						TraceID:    hex.EncodeToString(l.TraceId),
+						SpanID:     hex.EncodeToString(l.SpanId),
+						Attributes: attributes(l.Attributes),
+					})
+				}
+				c.spans = append(c.spans, span)
+			}
+		}
+	}
+}
+
+func (c *Collector) addMetrics(msg proto.Message) {
+	for _, rm := range msg.(*colmetricpb.ExportMetricsServiceRequest).ResourceMetrics {
+		service := serviceName(rm.Resource)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				point := Point{Service: service, Scope: sm.GetScope().GetName(), Name: m.Name, Unit: m.Unit}
+				switch data := m.Data.(type) {
+				case *metricpb.Metric_Sum:
+					for _, dp := range data.Sum.DataPoints {
+						c.points = append(c.points, numberPoint(point, dp))
+					}
+				case *metricpb.Metric_Gauge:
+					for _, dp := range data.Gauge.DataPoints {
+						c.points = append(c.points, numberPoint(point, dp))
+					}
+				case *metricpb.Metric_Histogram:
+					for _, dp := range data.Histogram.DataPoints {
+						p := point
+						p.Attributes, p.Count, p.Sum = attributes(dp.Attributes), dp.Count, dp.GetSum()
+						c.points = append(c.points, p)
+					}
+				}
+			}
+		}
+	}
+}
+
+func numberPoint(p Point, dp *metricpb.NumberDataPoint) Point {
+	p.Attributes = attributes(dp.Attributes)
+	switch v := dp.Value.(type) {
+	case *metricpb.NumberDataPoint_AsInt:
+		p.Value = float64(v.AsInt)
+	case *metricpb.NumberDataPoint_AsDouble:
+		p.Value = v.AsDouble
+	}
+	return p
+}
+
+func (c *Collector) addLogs(msg proto.Message) {
+	for _, rl := range msg.(*collogspb.ExportLogsServiceRequest).ResourceLogs {
+		service := serviceName(rl.Resource)
+		for _, sl := range rl.ScopeLogs {
+			for _, r := range sl.LogRecords {
+				c.records = append(c.records, LogRecord{
+					Service:    service,
+					Scope:      sl.GetScope().GetName(),
+					Body:       value(r.Body),
+					Severity:   severity(r),
+					Attributes: attributes(r.Attributes),
+					TraceID:    hex.EncodeToString(r.TraceId),
+					SpanID:     hex.EncodeToString(r.SpanId),
+				})
+			}
+		}
+	}
+}
+
+// Spans returns the spans received so far, in arrival order
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// SpansNamed returns the received spans called name
+func (c *Collector) SpansNamed(name string) []Span {
+	var out []Span
+	for _, s := range c.Spans() {
+		if s.Name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Span returns the only span called name and fails the test when there is
+// not exactly one
+func (c *Collector) Span(t testing.TB, name string) Span {
+	t.Helper()
+	spans := c.SpansNamed(name)
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans named %q, want 1; received %v", len(spans), name, spanNames(c.Spans()))
+	}
+	return spans[0]
+}
+
+// Points returns the metric points received so far
+func (c *Collector) Points() []Point {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Point(nil), c.points...)
+}
+
+// PointsNamed returns the points of metric name whose attributes include
+// every pair in match
+func (c *Collector) PointsNamed(name string, match map[string]string) []Point {
+	var out []Point
+	for _, p := range c.Points() {
+		if p.Name == name && hasAttributes(p.Attributes, match) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Logs returns the log records received so far, in arrival order
+func (c *Collector) Logs() []LogRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]LogRecord(nil), c.records...)
+}
+
+// LogsWithBody returns the received records whose body contains text
+func (c *Collector) LogsWithBody(text string) []LogRecord {
+	var out []LogRecord
+	for _, r := range c.Logs() {
+		if strings.Contains(r.Body, text) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// AssertAttributes fails the test unless got holds every pair of want; a
+// want value of "*" only requires the key
+func AssertAttributes(t testing.TB, what string, got, want map[string]string) {
+	t.Helper()
+	for k, v := range want {
+		g, ok := got[k]
+		switch {
+		case !ok:
+			t.Errorf("%s: attribute %s missing; got %v", what, k, got)
+		case v != "*" && g != v:
+			t.Errorf("%s: attribute %s = %q, want %q", what, k, g, v)
+		}
+	}
+}
+
+func hasAttributes(got, want map[string]string) bool {
+	for k, v := range want {
+		if got[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func spanNames(spans []Span) []string {
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func serviceName(r *resourcepb.Resource) string {
+	return attributes(r.GetAttributes())["service.name"]
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	out := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		out[kv.Key] = value(kv.Value)
+	}
+	return out
+}
+
+// value renders v the way attribute.Value.Emit does
+func value(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		parts := make([]string, len(v.ArrayValue.Values))
+		for i, e := range v.ArrayValue.Values {
+			parts[i] = value(e)
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case *commonpb.AnyValue_KvlistValue:
+		parts := make([]string, len(v.KvlistValue.Values))
+		for i, kv := range v.KvlistValue.Values {
+			parts[i] = kv.Key + "=" + value(kv.Value)
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	}
+	return ""
+}
+
+func severity(r *logspb.LogRecord) string {
+	if r.SeverityText != "" {
+		return r.SeverityText
+	}
+	names := []string{"trace", "debug", "info", "warn", "error", "fatal"}
+	if n := int(r.SeverityNumber); n >= 1 && n <= 24 {
+		return names[(n-1)/4]
+	}
+	return ""
+}
+
+func spanKind(k tracepb.Span_SpanKind) string {
+	switch k {
+	case tracepb.Span_SPAN_KIND_SERVER:
+		return "server"
+	case tracepb.Span_SPAN_KIND_CLIENT:
+		return "client"
+	case tracepb.Span_SPAN_KIND_PRODUCER:
+		return "producer"
+	case tracepb.Span_SPAN_KIND_CONSUMER:
+		return "consumer"
+	}
+	return "internal"
+}
+
+func statusCode(c tracepb.Status_StatusCode) string {
+	switch c {
+	case tracepb.Status_STATUS_CODE_OK:
+		return "ok"
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return "error"
+	}
+	return "unset"
+}
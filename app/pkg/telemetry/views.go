@@ -0,0 +1,144 @@
+// Package telemetry holds the OpenTelemetry setup shared by the instrumented services.
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"incident-simulation/pkg/attrs"
+)
+
+// DefaultLatencyBuckets covers 5 ms..10 s and is applied to every *_seconds histogram
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultDroppedAttributes are too high-cardinality to keep on any metric
+var DefaultDroppedAttributes = []string{
+	string(semconv.UserIDKey), string(semconv.EnduserIDKey), string(attrs.TransactionIDKey),
+	"user_id", "transaction_id",
+}
+
+// ViewConfig controls histogram buckets and attribute filtering per instrument.
+// The key "*" in DropAttributes applies to every instrument.
+type ViewConfig struct {
+	LatencyBuckets []float64
+	Buckets        map[string][]float64
+	DropAttributes map[string][]string
+}
+
+// DefaultViewConfig returns the latency buckets and drop list used when nothing is configured
+func DefaultViewConfig() ViewConfig {
+	return ViewConfig{
+		LatencyBuckets: DefaultLatencyBuckets,
+		Buckets:        map[string][]float64{},
+		DropAttributes: map[string][]string{"*": DefaultDroppedAttributes},
+	}
+}
+
+// ParseViewConfig extends the defaults with per-instrument overrides:
+//
+//	buckets: "db_query_duration_seconds=0.01,0.1,1;api_response_time_seconds=0.05,0.5,5"
+//	drop:    "*=user.id;api_errors_total=error_type"
+//
+// Bucket bounds must be finite numbers in increasing order.
+func ParseViewConfig(buckets, drop string) (ViewConfig, error) {
+	cfg := DefaultViewConfig()
+
+	var errs []error
+	instruments := parseInstrumentList(buckets)
+	for _, name := range slices.Sorted(maps.Keys(instruments)) {
+		bounds, err := parseBounds(instruments[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("METRIC_VIEW_BUCKETS for %s: %w", name, err))
+			continue
+		}
+		cfg.Buckets[name] = bounds
+	}
+
+	for name, keys := range parseInstrumentList(drop) {
+		cfg.DropAttributes[name] = append(cfg.DropAttributes[name], keys...)
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// parseBounds parses histogram bucket bounds, which must increase strictly
+func parseBounds(values []string) ([]float64, error) {
+	bounds := make([]float64, 0, len(values))
+	for _, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("bound %q is not a finite number", v)
+		}
+		if n := len(bounds); n > 0 && f <= bounds[n-1] {
+			return nil, fmt.Errorf("bound %s is not above %g, want increasing bounds without duplicates", v, bounds[n-1])
+		}
+		bounds = append(bounds, f)
+	}
+	return bounds, nil
+}
+
+// View returns a single view applying cfg to every instrument. One view is used
+// instead of several so an instrument never matches twice and emits duplicate streams.
+func View(cfg ViewConfig) sdkmetric.View {
+	return func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		stream := sdkmetric.Stream{
+			Name:        inst.Name,
+			Description: inst.Description,
+			Unit:        inst.Unit,
+		}
+
+		if inst.Kind == sdkmetric.InstrumentKindHistogram {
+			if bounds, ok := cfg.Buckets[inst.Name]; ok {
+				stream.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: bounds}
+			} else if strings.HasSuffix(inst.Name, "_seconds") && len(cfg.LatencyBuckets) > 0 {
+				stream.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: cfg.LatencyBuckets}
+			}
+		}
+
+		if dropped := cfg.droppedAttributes(inst.Name); len(dropped) > 0 {
+			stream.AttributeFilter = func(kv attribute.KeyValue) bool {
+				return !dropped[kv.Key]
+			}
+		}
+
+		return stream, true
+	}
+}
+
+// droppedAttributes returns the attribute keys dropped from instrument
+func (cfg ViewConfig) droppedAttributes(instrument string) map[attribute.Key]bool {
+	dropped := make(map[attribute.Key]bool)
+	for _, key := range cfg.DropAttributes["*"] {
+		dropped[attribute.Key(key)] = true
+	}
+	for _, key := range cfg.DropAttributes[instrument] {
+		dropped[attribute.Key(key)] = true
+	}
+	return dropped
+}
+
+// parseInstrumentList parses "name=a,b;other=c" into a map of name to values
+func parseInstrumentList(s string) map[string][]string {
+	out := make(map[string][]string)
+	for _, entry := range strings.Split(s, ";") {
+		name, values, ok := strings.Cut(entry, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			continue
+		}
+		for _, v := range strings.Split(values, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out[name] = append(out[name], v)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package telemetry
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestParseViewConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		buckets string
+		want    map[string][]float64
+		wantErr []string
+	}{
+		{"empty", "", map[string][]float64{}, nil},
+		{"two instruments", " db_query_duration_seconds = 0.01, 0.1 ,1 ; api_response_time_seconds=0.05,0.5,5;",
+			map[string][]float64{"db_query_duration_seconds": {0.01, 0.1, 1}, "api_response_time_seconds": {0.05, 0.5, 5}}, nil},
+		{"negative and exponent bounds", "balance=-100,0,1e3", map[string][]float64{"balance": {-100, 0, 1000}}, nil},
+		{"not a number", "db_query_duration_seconds=0.01,fast,1", nil, []string{"db_query_duration_seconds", `"fast" is not a finite number`}},
+		{"NaN", "db_query_duration_seconds=0.01,NaN", nil, []string{`"NaN" is not a finite number`}},
+		{"infinite", "db_query_duration_seconds=0.01,+Inf", nil, []string{`"+Inf" is not a finite number`}},
+		{"unsorted", "db_query_duration_seconds=0.1,0.01,1", nil, []string{"bound 0.01 is not above 0.1"}},
+		{"duplicate", "db_query_duration_seconds=0.01,0.1,0.1", nil, []string{"bound 0.1 is not above 0.1"}},
+		// Every bad instrument is reported, not only the first
+		{"several bad instruments", "b_seconds=2,1;a_seconds=x;ok_seconds=1,2", nil,
+			[]string{"METRIC_VIEW_BUCKETS for a_seconds", "METRIC_VIEW_BUCKETS for b_seconds"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := ParseViewConfig(tc.buckets, "")
+			if len(tc.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("ParseViewConfig(%q) = nil error, want %q", tc.buckets, tc.wantErr)
+				}
+				for _, want := range tc.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseViewConfig(%q): %v", tc.buckets, err)
+			}
+			if len(cfg.Buckets) != len(tc.want) {
+				t.Errorf("buckets %v, want %v", cfg.Buckets, tc.want)
+			}
+			for name, want := range tc.want {
+				if got := cfg.Buckets[name]; !slices.Equal(got, want) {
+					t.Errorf("buckets of %s = %v, want %v", name, got, want)
+				}
+			}
+			if !slices.Equal(cfg.LatencyBuckets, DefaultLatencyBuckets) {
+				t.Errorf("latency buckets %v, want the defaults", cfg.LatencyBuckets)
+			}
+		})
+	}
+}
+
+func TestParseViewConfigDrop(t *testing.T) {
+	cfg, err := ParseViewConfig("", "*=session.id;api_errors_total=error_type,region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped := cfg.droppedAttributes("api_errors_total")
+	for _, key := range []string{"user.id", "transaction_id", "session.id", "error_type", "region"} {
+		if !dropped[attribute.Key(key)] {
+			t.Errorf("%s is kept on api_errors_total, want it dropped", key)
+		}
+	}
+	if other := cfg.droppedAttributes("db_queries_total"); other["error_type"] || !other["session.id"] {
+		t.Errorf("db_queries_total drops %v, want the defaults and session.id", other)
+	}
+}
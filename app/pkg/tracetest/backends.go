@@ -0,0 +1,231 @@
+package tracetest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Tempo fetches traces from Grafana Tempo's /api/traces/{id}
+type Tempo struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// tempoTrace is the OTLP JSON Tempo answers with; older versions name the
+// resource spans batches
+type tempoTrace struct {
+	Batches       []tempoResourceSpans `json:"batches"`
+	ResourceSpans []tempoResourceSpans `json:"resourceSpans"`
+}
+
+type tempoResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []struct {
+		Spans []struct {
+			TraceID      string          `json:"traceId"`
+			SpanID       string          `json:"spanId"`
+			ParentSpanID string          `json:"parentSpanId"`
+			Name         string          `json:"name"`
+			Attributes   []otlpAttribute `json:"attributes"`
+			Status       struct {
+				Code json.RawMessage `json:"code"`
+			} `json:"status"`
+		} `json:"spans"`
+	} `json:"scopeSpans"`
+}
+
+type otlpAttribute struct {
+	Key   string                     `json:"key"`
+	Value map[string]json.RawMessage `json:"value"`
+}
+
+// Trace implements Fetcher
+func (t *Tempo) Trace(ctx context.Context, traceID string) ([]Span, error) {
+	var tr tempoTrace
+	found, err := getJSON(ctx, t.Client, strings.TrimRight(t.BaseURL, "/")+"/api/traces/"+traceID, &tr)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var spans []Span
+	for _, rs := range append(tr.Batches, tr.ResourceSpans...) {
+		service := attributeMap(rs.Resource.Attributes)["service.name"]
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				spans = append(spans, Span{
+					TraceID:      otlpID(s.TraceID),
+					SpanID:       otlpID(s.SpanID),
+					ParentSpanID: otlpID(s.ParentSpanID),
+					Name:         s.Name,
+					Service:      service,
+					Status:       otlpStatus(s.Status.Code),
+					Attributes:   attributeMap(s.Attributes),
+				})
+			}
+		}
+	}
+	return spans, nil
+}
+
+// Jaeger fetches traces from the Jaeger query service's /api/traces/{id}
+type Jaeger struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+type jaegerResponse struct {
+	Data []struct {
+		Spans []struct {
+			TraceID       string `json:"traceID"`
+			SpanID        string `json:"spanID"`
+			OperationName string `json:"operationName"`
+			ProcessID     string `json:"processID"`
+			References    []struct {
+				RefType string `json:"refType"`
+				SpanID  string `json:"spanID"`
+			} `json:"references"`
+			Tags []struct {
+				Key   string      `json:"key"`
+				Value interface{} `json:"value"`
+			} `json:"tags"`
+		} `json:"spans"`
+		Processes map[string]struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"processes"`
+	} `json:"data"`
+}
+
+// Trace implements Fetcher
+func (j *Jaeger) Trace(ctx context.Context, traceID string) ([]Span, error) {
+	var resp jaegerResponse
+	found, err := getJSON(ctx, j.Client, strings.TrimRight(j.BaseURL, "/")+"/api/traces/"+traceID, &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var spans []Span
+	for _, tr := range resp.Data {
+		for _, s := range tr.Spans {
+			span := Span{
+				TraceID:    s.TraceID,
+				SpanID:     s.SpanID,
+				Name:       s.OperationName,
+				Service:    tr.Processes[s.ProcessID].ServiceName,
+				Status:     StatusUnset,
+				Attributes: make(map[string]string, len(s.Tags)),
+			}
+			for _, ref := range s.References {
+				if ref.RefType == "CHILD_OF" {
+					span.ParentSpanID = ref.SpanID
+				}
+			}
+			for _, tag := range s.Tags {
+				span.Attributes[tag.Key] = fmt.Sprint(tag.Value)
+			}
+			// Jaeger keeps the OTel status as tags
+			switch span.Attributes["otel.status_code"] {
+			case "ERROR":
+				span.Status = StatusError
+			case "OK":
+				span.Status = StatusOK
+			}
+			if span.Attributes["error"] == "true" {
+				span.Status = StatusError
+			}
+			delete(span.Attributes, "otel.status_code")
+			delete(span.Attributes, "error")
+			spans = append(spans, span)
+		}
+	}
+	return spans, nil
+}
+
+// attributeMap flattens OTLP JSON attributes to strings
+func attributeMap(kvs []otlpAttribute) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		for _, raw := range kv.Value {
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				m[kv.Key] = s // stringValue, and intValue as protojson writes it
+			} else {
+				m[kv.Key] = string(raw)
+			}
+		}
+	}
+	return m
+}
+
+// otlpID returns a trace or span ID in hex whether it came as hex, as the
+// OTLP JSON encoding has it, or base64, as protobuf JSON has it
+func otlpID(id string) string {
+	if _, err := hex.DecodeString(id); err == nil {
+		return strings.ToLower(id)
+	}
+	if b, err := base64.StdEncoding.DecodeString(id); err == nil {
+		return hex.EncodeToString(b)
+	}
+	return id
+}
+
+// otlpStatus maps a status code, numeric or by enum name, to unset, ok or error
+func otlpStatus(code json.RawMessage) string {
+	var name string
+	if json.Unmarshal(code, &name) != nil {
+		name = string(code)
+	}
+	switch name {
+	case "1", "STATUS_CODE_OK":
+		return StatusOK
+	case "2", "STATUS_CODE_ERROR":
+		return StatusError
+	}
+	return StatusUnset
+}
+
+// getJSON decodes url into out; found is false for a 404
+func getJSON(ctx context.Context, client *http.Client, url string, out interface{}) (found bool, err error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GET %s returned %d", req.URL.Path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("decode %s: %w", req.URL.Path, err)
+	}
+	return true, nil
+}
+
+// NewFetcher returns the fetcher of backend, tempo or jaeger, at baseURL
+func NewFetcher(backend, baseURL string, client *http.Client) (Fetcher, error) {
+	switch backend {
+	case "tempo":
+		return &Tempo{BaseURL: baseURL, Client: client}, nil
+	case "jaeger":
+		return &Jaeger{BaseURL: baseURL, Client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown trace backend %q, want tempo or jaeger", backend)
+}
@@ -0,0 +1,272 @@
+// Package tracetest checks that a request produces the trace it should.
+//
+// A Test sends one known request, starting its trace with a fresh trace ID in
+// traceparent, then fetches that trace from Tempo or Jaeger by ID and checks
+// its spans against expectations loaded from YAML: a span of a name (and
+// service) must be there, possibly a given number of times, with attribute
+// values, a status and a parent. Spans reach the backend after the services'
+// batch delay, so the trace is fetched again until every expected span has
+// arrived or the wait runs out. cmd/tracetest runs a file of tests; Run and
+// Check work on their own, e.g. from a Go test.
+package tracetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Span statuses as expectations and fetchers name them
+const (
+	StatusUnset = "unset"
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Span is one span of a fetched trace
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Service      string
+	Status       string
+	Attributes   map[string]string
+}
+
+// Fetcher returns the spans of one trace; an unknown trace is no spans and
+// no error, since it may not have arrived yet
+type Fetcher interface {
+	Trace(ctx context.Context, traceID string) ([]Span, error)
+}
+
+// Request is the request a test sends
+type Request struct {
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"` // appended to the target URL
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Status  int               `yaml:"status"` // expected response status, 0 accepts any
+}
+
+// SpanExpectation is what the trace must contain
+type SpanExpectation struct {
+	Name       string            `yaml:"name"`
+	Service    string            `yaml:"service"`    // empty matches any service
+	Attributes map[string]string `yaml:"attributes"` // values compared as strings
+	Status     string            `yaml:"status"`     // unset, ok or error; empty matches any
+	Parent     string            `yaml:"parent"`     // name of the parent span; empty matches any
+	Count      *int              `yaml:"count"`      // exact number of matches; unset means at least one
+}
+
+// Test is one request and the spans its trace must have
+type Test struct {
+	Name    string            `yaml:"name"`
+	Request Request           `yaml:"request"`
+	Wait    time.Duration     `yaml:"wait"` // how long to wait for the spans, 30s by default
+	Spans   []SpanExpectation `yaml:"spans"`
+}
+
+// Result is the outcome of one test
+type Result struct {
+	Test     string
+	TraceID  string
+	Status   int
+	Spans    int
+	Failures []string
+	Duration time.Duration
+}
+
+// Passed reports whether every expectation held
+func (r Result) Passed() bool { return len(r.Failures) == 0 }
+
+// Load reads a YAML file with a list of tests under tests
+func Load(path string) ([]Test, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read trace tests: %w", err)
+	}
+	var file struct {
+		Tests []Test `yaml:"tests"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse trace tests %s: %w", path, err)
+	}
+	for i := range file.Tests {
+		if err := file.Tests[i].validate(); err != nil {
+			return nil, fmt.Errorf("trace test %q: %w", file.Tests[i].Name, err)
+		}
+	}
+	return file.Tests, nil
+}
+
+func (t *Test) validate() error {
+	if t.Name == "" || t.Request.Path == "" {
+		return fmt.Errorf("name and request.path are required")
+	}
+	if len(t.Spans) == 0 {
+		return fmt.Errorf("at least one span expectation is required")
+	}
+	if t.Request.Method == "" {
+		t.Request.Method = http.MethodGet
+	}
+	if t.Wait == 0 {
+		t.Wait = 30 * time.Second
+	}
+	for _, s := range t.Spans {
+		if s.Name == "" {
+			return fmt.Errorf("every span expectation needs a name")
+		}
+		switch s.Status {
+		case "", StatusUnset, StatusOK, StatusError:
+		default:
+			return fmt.Errorf("span %q: status must be unset, ok or error", s.Name)
+		}
+		if s.Count != nil && *s.Count < 0 {
+			return fmt.Errorf("span %q: count must not be negative", s.Name)
+		}
+	}
+	return nil
+}
+
+// Run sends the test's request to targetURL and checks the trace fetched
+// for it. An error means the test could not run; failed expectations are in
+// the result.
+func Run(ctx context.Context, client *http.Client, fetcher Fetcher, targetURL string, t Test) (Result, error) {
+	start := time.Now()
+	res := Result{Test: t.Name, TraceID: newID(16)}
+
+	req, err := http.NewRequestWithContext(ctx, t.Request.Method, strings.TrimRight(targetURL, "/")+t.Request.Path, strings.NewReader(t.Request.Body))
+	if err != nil {
+		return res, fmt.Errorf("build request: %w", err)
+	}
+	for k, v := range t.Request.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.Request.Body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// The test is the root of the trace, so its ID is known up front
+	req.Header.Set("traceparent", "00-"+res.TraceID+"-"+newID(8)+"-01")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return res, fmt.Errorf("send request: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res.Status = resp.StatusCode
+	if t.Request.Status != 0 && resp.StatusCode != t.Request.Status {
+		res.Failures = append(res.Failures, fmt.Sprintf("response status %d, want %d", resp.StatusCode, t.Request.Status))
+	}
+
+	// Fetch until every expectation holds or the wait runs out, then report
+	// what the last fetch was missing
+	deadline := time.Now().Add(t.Wait)
+	var failures []string
+	for {
+		spans, err := fetcher.Trace(ctx, res.TraceID)
+		if err != nil {
+			return res, fmt.Errorf("fetch trace %s: %w", res.TraceID, err)
+		}
+		res.Spans = len(spans)
+		failures = Check(spans, t.Spans)
+		if len(failures) == 0 || time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return res, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	res.Failures = append(res.Failures, failures...)
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+// Check returns one failure message for every expectation the spans miss
+func Check(spans []Span, expected []SpanExpectation) []string {
+	byID := make(map[string]Span, len(spans))
+	for _, s := range spans {
+		byID[s.SpanID] = s
+	}
+
+	var failures []string
+	for _, e := range expected {
+		var named, matched int
+		var mismatch string
+		for _, s := range spans {
+			if s.Name != e.Name || (e.Service != "" && s.Service != e.Service) {
+				continue
+			}
+			named++
+			if m := mismatchOf(s, e, byID); m != "" {
+				mismatch = m
+				continue
+			}
+			matched++
+		}
+
+		label := e.Name
+		if e.Service != "" {
+			label = e.Service + " " + e.Name
+		}
+		switch {
+		case e.Count != nil && matched != *e.Count:
+			failures = append(failures, fmt.Sprintf("span %q: %d matching, want %d", label, matched, *e.Count))
+		case e.Count == nil && matched == 0 && named == 0:
+			failures = append(failures, fmt.Sprintf("span %q: not in the trace", label))
+		case e.Count == nil && matched == 0:
+			failures = append(failures, fmt.Sprintf("span %q: %s", label, mismatch))
+		}
+	}
+	return failures
+}
+
+// mismatchOf returns why s does not meet e, or "" when it does
+func mismatchOf(s Span, e SpanExpectation, byID map[string]Span) string {
+	if e.Status != "" && s.Status != e.Status {
+		return fmt.Sprintf("status %s, want %s", s.Status, e.Status)
+	}
+	if e.Parent != "" {
+		parent, ok := byID[s.ParentSpanID]
+		if !ok {
+			return fmt.Sprintf("parent not in the trace, want %q", e.Parent)
+		}
+		if parent.Name != e.Parent {
+			return fmt.Sprintf("parent %q, want %q", parent.Name, e.Parent)
+		}
+	}
+	keys := make([]string, 0, len(e.Attributes))
+	for k := range e.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		got, ok := s.Attributes[k]
+		if !ok {
+			return fmt.Sprintf("attribute %s missing, want %q", k, e.Attributes[k])
+		}
+		if got != e.Attributes[k] {
+			return fmt.Sprintf("attribute %s = %q, want %q", k, got, e.Attributes[k])
+		}
+	}
+	return ""
+}
+
+// newID returns n random bytes in hex, a trace ID for 16 and a span ID for 8
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,111 @@
+package tracetest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tempoBody is a Tempo answer with a server span, its handler span and a
+// failed database call
+const tempoBody = `{"batches":[{
+	"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"core-api-service"}}]},
+	"scopeSpans":[{"spans":[
+		{"traceId":"%[1]s","spanId":"0000000000000001","name":"core-api-service","status":{}},
+		{"traceId":"%[1]s","spanId":"0000000000000002","parentSpanId":"0000000000000001","name":"Process Transaction",
+		 "attributes":[{"key":"user.id","value":{"stringValue":"user_42"}},{"key":"app.transaction.amount","value":{"doubleValue":25}}]},
+		{"traceId":"%[1]s","spanId":"0000000000000003","parentSpanId":"0000000000000002","name":"Database Service Call",
+		 "status":{"code":"STATUS_CODE_ERROR"}}
+	]}]}]}`
+
+func TestRunAgainstTempo(t *testing.T) {
+	var mu sync.Mutex
+	var traceID string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceID = strings.Split(r.Header.Get("traceparent"), "-")[1]
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer target.Close()
+	tempo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/api/traces/"+traceID {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, tempoBody, traceID)
+	}))
+	defer tempo.Close()
+
+	zero := 0
+	test := Test{
+		Name:    "deposit",
+		Request: Request{Method: http.MethodPost, Path: "/api/transaction", Body: `{}`, Status: 500},
+		Wait:    time.Second,
+		Spans: []SpanExpectation{
+			{Name: "Process Transaction", Service: "core-api-service", Parent: "core-api-service",
+				Attributes: map[string]string{"user.id": "user_42", "app.transaction.amount": "25"}},
+			{Name: "Database Service Call", Parent: "Process Transaction", Status: StatusError},
+			{Name: "Payment Gateway Call", Count: &zero},
+		},
+	}
+	res, err := Run(context.Background(), http.DefaultClient, &Tempo{BaseURL: tempo.URL}, target.URL, test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Passed() || res.Spans != 3 || res.TraceID != traceID {
+		t.Fatalf("result = %+v, want a pass over the 3 spans of trace %s", res, traceID)
+	}
+
+	test.Wait = 0
+	test.Request.Status = 200
+	test.Spans = []SpanExpectation{
+		{Name: "Process Transaction", Attributes: map[string]string{"user.id": "user_7"}},
+		{Name: "Database Service Call", Status: StatusOK},
+		{Name: "Database Query", Service: "database-service"},
+	}
+	res, err = Run(context.Background(), http.DefaultClient, &Tempo{BaseURL: tempo.URL}, target.URL, test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"response status 500, want 200",
+		`span "Process Transaction": attribute user.id = "user_42", want "user_7"`,
+		`span "Database Service Call": status error, want ok`,
+		`span "database-service Database Query": not in the trace`,
+	}
+	if strings.Join(res.Failures, "\n") != strings.Join(want, "\n") {
+		t.Errorf("failures =\n%s\nwant\n%s", strings.Join(res.Failures, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestJaegerTrace(t *testing.T) {
+	jaeger := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"spans":[
+			{"traceID":"abc","spanID":"1","operationName":"database-service","processID":"p1"},
+			{"traceID":"abc","spanID":"2","operationName":"Database Query","processID":"p1",
+			 "references":[{"refType":"CHILD_OF","spanID":"1"}],
+			 "tags":[{"key":"db.operation.name","type":"string","value":"deposit"},{"key":"otel.status_code","type":"string","value":"ERROR"}]}
+		],"processes":{"p1":{"serviceName":"database-service"}}}]}`))
+	}))
+	defer jaeger.Close()
+
+	spans, err := (&Jaeger{BaseURL: jaeger.URL}).Trace(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := Check(spans, []SpanExpectation{{
+		Name: "Database Query", Service: "database-service", Parent: "database-service", Status: StatusError,
+		Attributes: map[string]string{"db.operation.name": "deposit"},
+	}})
+	if len(failures) != 0 {
+		t.Errorf("failures = %v", failures)
+	}
+}
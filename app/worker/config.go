@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"incident-simulation/pkg/config"
+)
+
+// Config is the outbox worker configuration
+type Config struct {
+	config.Telemetry
+	config.Audit
+	config.Profiling
+	config.Dev
+	config.Simulation
+
+	ListenAddr          string        `env:"LISTEN_ADDR" flag:"listen" default:":8085" usage:"HTTP listen address"`
+	DBServiceURL        string        `env:"DB_SERVICE_URL" flag:"db-service-url" default:"http://127.0.0.1:8081" usage:"Database service base URL"`
+	PollInterval        time.Duration `env:"OUTBOX_POLL_INTERVAL" flag:"poll-interval" default:"1s" usage:"Pause between outbox polls that found nothing to publish"`
+	PollBatchSize       int           `env:"OUTBOX_POLL_BATCH_SIZE" flag:"poll-batch-size" default:"100" usage:"Most outbox events read per poll"`
+	PublishLatency      time.Duration `env:"OUTBOX_PUBLISH_LATENCY" flag:"publish-latency" default:"5ms" usage:"Simulated time to publish one event"`
+	LagThreshold        time.Duration `env:"OUTBOX_LAG_THRESHOLD" flag:"lag-threshold" default:"30s" usage:"Outbox lag at which /worker/health reports the worker as lagging"`
+	IncidentInterval    time.Duration `env:"INCIDENT_INTERVAL" flag:"incident-interval" default:"60s" usage:"How often the simulator considers starting an incident"`
+	IncidentProbability float64       `env:"INCIDENT_PROBABILITY" flag:"incident-probability" default:"0.15" usage:"Chance of starting an incident at each interval"`
+}
+
+// Validate checks values that the tag-based loader cannot
+func (c *Config) Validate() error {
+	var errs []error
+	if c.PollInterval <= 0 {
+		errs = append(errs, errors.New("OUTBOX_POLL_INTERVAL must be positive"))
+	}
+	if c.PollBatchSize < 1 {
+		errs = append(errs, errors.New("OUTBOX_POLL_BATCH_SIZE must be at least 1"))
+	}
+	if c.PublishLatency < 0 {
+		errs = append(errs, errors.New("OUTBOX_PUBLISH_LATENCY must not be negative"))
+	}
+	if c.LagThreshold <= 0 {
+		errs = append(errs, errors.New("OUTBOX_LAG_THRESHOLD must be positive"))
+	}
+	if c.IncidentInterval <= 0 {
+		errs = append(errs, errors.New("INCIDENT_INTERVAL must be positive"))
+	}
+	if c.IncidentProbability < 0 || c.IncidentProbability > 1 {
+		errs = append(errs, errors.New("INCIDENT_PROBABILITY must be between 0 and 1"))
+	}
+	errs = append(errs, c.Batching.Validate(), c.Sampling.Validate(), c.Logging.Validate())
+	return errors.Join(errs...)
+}
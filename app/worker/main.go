@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/audit"
+	"incident-simulation/pkg/buildinfo"
+	"incident-simulation/pkg/chaos"
+	"incident-simulation/pkg/config"
+	"incident-simulation/pkg/httpx"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+	"incident-simulation/pkg/probes"
+	"incident-simulation/pkg/profiling"
+	"incident-simulation/pkg/simrand"
+	"incident-simulation/pkg/telemetry"
+)
+
+// Incident catalogue of the worker: poller_stall stops polling altogether,
+// slow_publish keeps polling but publishes each event much slower
+var incidentTypes = []string{"poller_stall", "slow_publish"}
+
+// incidentState is the active worker incident, if any
+type incidentState struct {
+	mu     sync.RWMutex
+	active bool
+	kind   string
+}
+
+var incident = &incidentState{kind: "none"}
+
+func (s *incidentState) snapshot() (active bool, kind string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active, s.kind
+}
+
+// Metrics
+var (
+	pollCounter      metric.Int64Counter
+	publishedCounter metric.Int64Counter
+	outboxLag        metric.Float64Histogram
+	pollDuration     metric.Float64Histogram
+	lastPollAge      metric.Float64ObservableGauge
+	incidentGauge    metric.Int64ObservableGauge
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Load configuration (flags > env > .env > YAML > defaults)
+	var cfg Config
+	config.MustLoad(&cfg)
+	log.Println("⚙️  Worker Service configuration:")
+	config.Print(log.Writer(), &cfg)
+
+	// Seeded runs replay the same simulator decisions
+	if cfg.SimSeed != 0 {
+		simrand.Seed(cfg.SimSeed)
+	}
+
+	// In-memory buffer of recent spans and logs for /debug/telemetry/recent
+	recorder := telemetry.NewRecorder("worker-service", cfg.TelemetryBufferSize, cfg.TelemetryBufferSampleRate)
+	// Export outcomes for /debug/otel
+	health := telemetry.NewExportHealth(cfg.OTLP, cfg.Output)
+	// Per-minute latency histograms and error counts for /debug/latency-heatmap and /debug/export
+	heatmap := telemetry.NewHeatmap("worker-service", cfg.LatencyHeatmapMinutes)
+
+	// Initialize OpenTelemetry
+	shutdown := initOpenTelemetry(ctx, "worker-service", cfg.Telemetry, recorder, health, heatmap)
+	defer shutdown()
+
+	// Optional pprof endpoints and continuous profiling
+	stopProfiling := profiling.Start("worker-service", cfg.Profiling, "localhost:6065")
+	defer stopProfiling()
+
+	// Audit trail of incidents, deployments and admin actions
+	if err := audit.Setup("worker-service", cfg.AuditLogFile, cfg.AuditLogKeep); err != nil {
+		log.Fatalf("Invalid audit log: %v", err)
+	}
+	defer audit.Close()
+
+	p := &poller{
+		client:         &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport), Timeout: 10 * time.Second},
+		dbServiceURL:   cfg.DBServiceURL,
+		batchSize:      cfg.PollBatchSize,
+		interval:       cfg.PollInterval,
+		publishLatency: cfg.PublishLatency,
+	}
+
+	// Initialize metrics
+	initMetrics(ctx, p)
+	if err := buildinfo.RegisterMetric("worker-service"); err != nil {
+		logx.Errorw(ctx, "Failed to create build info gauge", "error", err)
+	}
+	if cfg.SimLabelSpans {
+		if err := telemetry.LabelIncidents(incident.snapshot); err != nil {
+			logx.Errorw(ctx, "Failed to label spans with the active incident", "error", err)
+		}
+	}
+
+	// Start background incident simulator
+	go incidentSimulator(ctx, cfg.IncidentInterval, cfg.IncidentProbability)
+
+	// Drain the database service's outbox
+	go p.run(ctx)
+
+	// Start worker
+	startWorker(cfg, p, recorder, health, heatmap)
+}
+
+func initOpenTelemetry(ctx context.Context, serviceName string, cfg config.Telemetry, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) func() {
+	// Resource with service information; OTEL_RESOURCE_ATTRIBUTES overrides it
+	res, err := telemetry.NewResource(ctx, serviceName)
+	if err != nil {
+		log.Fatalf("Failed to create resource: %v", err)
+	}
+
+	// OTLP (endpoint, TLS, headers) or stdout/file exporters
+	exporters, err := telemetry.NewExporters(cfg.OTLP, cfg.Output)
+	if err != nil {
+		log.Fatalf("Invalid telemetry exporter settings: %v", err)
+	}
+
+	// Trace exporter
+	traceExporter, err := exporters.Trace(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create trace exporter: %v", err)
+	}
+
+	// Batch span processor whose queue /debug/otel reports
+	spans := telemetry.NewBatchSpanProcessor(health.Spans(traceExporter), cfg.Batching)
+	health.TrackQueue(spans)
+
+	// Personal data is scrubbed before spans and log records are exported or buffered
+	scrubber := telemetry.NewScrubber(cfg.Scrubbing)
+
+	// Trace provider
+	tp := trace.NewTracerProvider(
+		trace.WithSpanProcessor(scrubber.SpanProcessor(spans)),
+		trace.WithSpanProcessor(scrubber.SpanProcessor(recorder)),
+		trace.WithResource(res),
+		// Ratio sampling, overridden for debug requests
+		trace.WithSampler(telemetry.NewSampler(cfg.Sampling)),
+	)
+	otel.SetTracerProvider(tp)
+
+	// Metric exporter
+	metricExporter, err := exporters.Metric(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create metric exporter: %v", err)
+	}
+
+	views, err := telemetry.ParseViewConfig(cfg.MetricViewBuckets, cfg.MetricViewDropAttributes)
+	if err != nil {
+		log.Fatalf("Invalid metric views: %v", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(telemetry.View(views)),
+		sdkmetric.WithReader(telemetry.NewPeriodicReader(heatmap.Metrics(health.Metrics(metricExporter)), cfg.Batching)),
+	)
+	// Caps the attribute sets of every counter and histogram the service creates
+	otel.SetMeterProvider(telemetry.GuardCardinality(mp, cfg.MetricCardinalityLimit, views))
+
+	// Log Provider
+	exporter, err := exporters.Log(ctx)
+	if err != nil {
+		log.Fatalf("failed to create log exporter: %v", err)
+	}
+
+	// Set up the LoggerProvider with a batch processor
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(scrubber.LogProcessor()),
+		sdklog.WithProcessor(telemetry.NewBatchLogProcessor(health.Logs(exporter), cfg.Batching)),
+		sdklog.WithProcessor(recorder),
+	)
+
+	// Set the global logger provider
+	global.SetLoggerProvider(provider)
+
+	// Bridge logrus to OpenTelemetry; logx adds service and trace fields
+	logx.Setup(serviceName, provider)
+	if _, err := logx.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+
+	// Text map propagators from OTEL_PROPAGATORS
+	propagator, err := telemetry.NewPropagator(cfg.Propagators)
+	if err != nil {
+		log.Fatalf("Invalid propagator settings: %v", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down tracer provider", "error", err)
+		}
+		if err := mp.Shutdown(ctx); err != nil {
+			logx.Errorw(ctx, "Error shutting down meter provider", "error", err)
+		}
+		provider.Shutdown(ctx)
+		exporters.Close()
+	}
+}
+
+func initMetrics(ctx context.Context, p *poller) {
+	meter := otel.Meter("worker-service")
+
+	var err error
+	pollCounter, err = meter.Int64Counter("worker_outbox_polls_total",
+		metric.WithDescription("Total number of outbox polls by status"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create poll counter", "error", err)
+	}
+
+	publishedCounter, err = meter.Int64Counter("worker_outbox_events_published_total",
+		metric.WithDescription("Total number of outbox events published"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create published counter", "error", err)
+	}
+
+	outboxLag, err = meter.Float64Histogram("worker_outbox_lag_seconds",
+		metric.WithDescription("Time from an outbox event's write to its publication in seconds"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create outbox lag histogram", "error", err)
+	}
+
+	pollDuration, err = meter.Float64Histogram("worker_outbox_poll_duration_seconds",
+		metric.WithDescription("Outbox poll duration in seconds, publishing and acknowledgement included"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create poll duration histogram", "error", err)
+	}
+
+	lastPollAge, err = meter.Float64ObservableGauge("worker_outbox_last_poll_age_seconds",
+		metric.WithDescription("Time since the last successful outbox poll in seconds"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create last poll age gauge", "error", err)
+	}
+
+	incidentGauge, err = meter.Int64ObservableGauge("worker_incident_active",
+		metric.WithDescription("Whether a worker incident is currently active"))
+	if err != nil {
+		logx.Errorw(ctx, "Failed to create incident gauge", "error", err)
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveFloat64(lastPollAge, p.sinceLastPoll().Seconds())
+		active, kind := incident.snapshot()
+		var v int64
+		if active {
+			v = 1
+		}
+		o.ObserveInt64(incidentGauge, v, metric.WithAttributes(attribute.String("incident_type", kind)))
+		return nil
+	}, lastPollAge, incidentGauge)
+	if err != nil {
+		logx.Errorw(ctx, "Failed to register worker gauge callback", "error", err)
+	}
+}
+
+func incidentSimulator(ctx context.Context, interval time.Duration, probability float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if active, _ := incident.snapshot(); active || simrand.Float64() >= probability {
+			continue
+		}
+
+		kind := incidentTypes[simrand.Intn(len(incidentTypes))]
+		incident.mu.Lock()
+		incident.active, incident.kind = true, kind
+		incident.mu.Unlock()
+
+		// Incident duration: 30-120 seconds, long enough for the lag to build up
+		duration := time.Duration(30+simrand.Intn(90)) * time.Second
+		audit.Warn(ctx, "incident.started", "🚨 WORKER INCIDENT", "incident_type", kind, "duration", duration.String())
+		go func() {
+			time.Sleep(duration)
+			incident.mu.Lock()
+			incident.active, incident.kind = false, "none"
+			incident.mu.Unlock()
+			audit.Record(ctx, "incident.resolved", "✅ WORKER INCIDENT RESOLVED", "incident_type", kind)
+		}()
+	}
+}
+
+func startWorker(cfg Config, p *poller, recorder *telemetry.Recorder, health *telemetry.ExportHealth, heatmap *telemetry.Heatmap) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /worker/health", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("worker-service").Start(r.Context(), "Worker Health Check")
+		defer span.End()
+
+		_, kind := incident.snapshot()
+		sincePoll, lag := p.sinceLastPoll(), p.lastLag()
+		span.SetAttributes(
+			attrs.IncidentType(kind),
+			attrs.OutboxLag(float64(lag.Milliseconds())),
+		)
+
+		body := map[string]interface{}{
+			"status":                "healthy",
+			"incident_type":         kind,
+			"last_poll_age_ms":      sincePoll.Milliseconds(),
+			"last_published_lag_ms": lag.Milliseconds(),
+			"timestamp":             time.Now().Unix(),
+		}
+		status := http.StatusOK
+		switch {
+		case sincePoll > cfg.LagThreshold:
+			body["status"] = "stalled"
+			status = http.StatusServiceUnavailable
+		case lag > cfg.LagThreshold:
+			body["status"] = "lagging"
+			status = http.StatusServiceUnavailable
+		}
+		if status != http.StatusOK {
+			span.SetStatus(codes.Error, "outbox worker "+body["status"].(string))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		jsonx.NewEncoder(w).Encode(body)
+	})
+
+	// Kubernetes probes sit outside tracing and incident simulation
+	prober := probes.New(2 * time.Second)
+	if cfg.TelemetryExporter == telemetry.ExporterOTLP {
+		prober.AddCheck("otlp_collector", probes.TCPCheck(telemetry.CollectorAddr(cfg.OTLP)))
+		// Not ready until telemetry has reached the collector once
+		prober.AddCheck("telemetry_export", health.Ready)
+	}
+	prober.AddCheck("database_service", probes.HTTPCheck(&http.Client{}, cfg.DBServiceURL+"/healthz"))
+
+	root := http.NewServeMux()
+	prober.Register(root)
+	if cfg.TelemetryBufferSize > 0 {
+		root.Handle("GET /debug/telemetry/recent", recorder)
+	}
+	root.Handle("GET /debug/otel", health)
+	root.Handle("GET /debug/audit", audit.Handler())
+	root.Handle("/debug/loglevel", logx.LevelHandler(audit.Warn))
+	if heatmap.Enabled() {
+		root.Handle("GET /debug/latency-heatmap", heatmap)
+		root.Handle("GET /debug/export", heatmap.Export())
+	}
+	root.Handle("GET /version", buildinfo.Handler("worker-service"))
+	// X-Chaos-* fault injection is a development-only feature
+	var handler http.Handler = mux
+	if cfg.DevMode {
+		handler = chaos.Middleware("worker-service", handler)
+	}
+	handler = httpx.Metrics("worker-service", handler)
+	// X-Debug-Trace and DEBUG_TRACE_USERS requests are sampled whatever TRACE_SAMPLE_RATIO says
+	root.Handle("/", telemetry.DebugTraces(cfg.Sampling, nil, otelhttp.NewHandler(httpx.TraceResponse(handler), "worker-service")))
+
+	prober.MarkStarted()
+	log.Printf("📬 Worker Service running on %s", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, root))
+}
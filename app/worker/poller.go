@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"incident-simulation/pkg/attrs"
+	"incident-simulation/pkg/jsonx"
+	"incident-simulation/pkg/logx"
+)
+
+// OutboxEvent is an event of the database service's outbox
+type OutboxEvent struct {
+	ID        int64     `json:"id"`
+	Operation string    `json:"operation"`
+	UserID    string    `json:"user_id"`
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	SpanID    string    `json:"span_id,omitempty"`
+}
+
+type OutboxBatch struct {
+	Events  []OutboxEvent `json:"events"`
+	Pending int           `json:"pending"`
+}
+
+// slowPublishFactor is how much slower slow_publish makes each event
+const slowPublishFactor = 40
+
+// poller drains the database service's outbox: it reads the oldest pending
+// events, publishes them one by one and acknowledges the batch. It polls again
+// at once while it gets full batches and waits interval otherwise. Lag is
+// measured per event from its write to its publication, so a stalled or slow
+// poller shows up as worker_outbox_lag_seconds growing with the backlog.
+type poller struct {
+	client         *http.Client
+	dbServiceURL   string
+	batchSize      int
+	interval       time.Duration
+	publishLatency time.Duration
+
+	// Unix nanoseconds of the last successful poll, and the lag of the last
+	// published event
+	lastPollAt atomic.Int64
+	lastLagNs  atomic.Int64
+}
+
+func (p *poller) sinceLastPoll() time.Duration {
+	last := p.lastPollAt.Load()
+	if last == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, last))
+}
+
+func (p *poller) lastLag() time.Duration {
+	return time.Duration(p.lastLagNs.Load())
+}
+
+func (p *poller) run(ctx context.Context) {
+	p.lastPollAt.Store(time.Now().UnixNano())
+	stalled := false
+	for {
+		// A stalled poller is hung, not failing: it makes no calls at all
+		if _, kind := incident.snapshot(); kind == "poller_stall" {
+			if !stalled {
+				logx.Warnw(ctx, "⏸️ Outbox poller stalled", "incident_type", kind)
+				stalled = true
+			}
+			time.Sleep(p.interval)
+			continue
+		}
+		if stalled {
+			logx.Infow(ctx, "▶️ Outbox poller resumed", "stalled_for", p.sinceLastPoll().String())
+			stalled = false
+		}
+
+		n, err := p.poll(ctx)
+		if err != nil || n < p.batchSize {
+			time.Sleep(p.interval)
+		}
+	}
+}
+
+// poll publishes one batch of outbox events, returning how many it read
+func (p *poller) poll(ctx context.Context) (int, error) {
+	ctx, span := otel.Tracer("worker-service").Start(ctx, "Poll Outbox")
+	defer span.End()
+
+	start := time.Now()
+	status := "success"
+	defer func() {
+		pollDuration.Record(ctx, time.Since(start).Seconds())
+		pollCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("status", status)))
+	}()
+
+	batch, err := p.fetch(ctx)
+	if err != nil {
+		status = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "outbox read failed")
+		logx.Errorw(ctx, "❌ Outbox poll failed", "error", err)
+		return 0, err
+	}
+	p.lastPollAt.Store(time.Now().UnixNano())
+	span.SetAttributes(
+		attribute.Int("outbox.batch_size", len(batch.Events)),
+		attribute.Int("outbox.pending", batch.Pending),
+	)
+	if len(batch.Events) == 0 {
+		// Caught up: nothing is waiting
+		p.lastLagNs.Store(0)
+		status = "empty"
+		return 0, nil
+	}
+
+	ids := make([]int64, 0, len(batch.Events))
+	for _, e := range batch.Events {
+		p.publish(ctx, e)
+		ids = append(ids, e.ID)
+	}
+	if err := p.ack(ctx, ids); err != nil {
+		// Unacknowledged events are read and published again by the next poll
+		status = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "outbox ack failed")
+		logx.Errorw(ctx, "❌ Outbox ack failed", "outbox.batch_size", len(ids), "error", err)
+		return len(batch.Events), err
+	}
+
+	logx.Infow(ctx, "📬 Outbox batch published", "outbox.batch_size", len(ids), "outbox.pending", batch.Pending-len(ids), "outbox.lag_ms", p.lastLag().Milliseconds())
+	return len(batch.Events), nil
+}
+
+// publish hands one event downstream in a span linked to the write that
+// produced it
+func (p *poller) publish(ctx context.Context, e OutboxEvent) {
+	var opts []trace.SpanStartOption
+	if origin := originSpan(e); origin.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: origin}))
+	}
+	ctx, span := otel.Tracer("worker-service").Start(ctx, "Publish Outbox Event", opts...)
+	defer span.End()
+
+	latency := p.publishLatency
+	if _, kind := incident.snapshot(); kind == "slow_publish" {
+		latency *= slowPublishFactor
+	}
+	time.Sleep(latency)
+
+	lag := time.Since(e.CreatedAt)
+	p.lastLagNs.Store(int64(lag))
+	span.SetAttributes(
+		attrs.OutboxEventID(e.ID),
+		attrs.OutboxLag(float64(lag.Milliseconds())),
+		attrs.TransactionOperation(e.Operation),
+		semconv.UserID(e.UserID),
+	)
+	op := metric.WithAttributes(attribute.String("operation", e.Operation))
+	outboxLag.Record(ctx, lag.Seconds(), op)
+	publishedCounter.Add(ctx, 1, op)
+}
+
+// originSpan is the database span that wrote e, if it was recorded
+func originSpan(e OutboxEvent) trace.SpanContext {
+	traceID, err := trace.TraceIDFromHex(e.TraceID)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	spanID, err := trace.SpanIDFromHex(e.SpanID)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, Remote: true})
+}
+
+func (p *poller) fetch(ctx context.Context) (OutboxBatch, error) {
+	var batch OutboxBatch
+	url := p.dbServiceURL + "/db/outbox?limit=" + strconv.Itoa(p.batchSize)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return batch, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return batch, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return batch, fmt.Errorf("database service returned %d", resp.StatusCode)
+	}
+	err = jsonx.NewDecoder(resp.Body).Decode(&batch)
+	return batch, err
+}
+
+func (p *poller) ack(ctx context.Context, ids []int64) error {
+	body, err := jsonx.Marshal(map[string][]int64{"ids": ids})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.dbServiceURL+"/db/outbox/ack", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("database service returned %d", resp.StatusCode)
+	}
+	return nil
+}